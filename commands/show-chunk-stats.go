@@ -0,0 +1,145 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/activecm/rita/pkg/uconn"
+	"github.com/activecm/rita/resources"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command := cli.Command{
+		Name:      "show-chunk-stats",
+		Usage:     "Print how connections fall into the chunks of a database and recommend a chunk size",
+		ArgsUsage: "<database>",
+		Flags: []cli.Flag{
+			ConfigFlag,
+			humanFlag,
+			delimFlag,
+			cli.BoolFlag{
+				Name:  "chunks, k",
+				Usage: "Print the statistics of each chunk instead of the candidate chunk sizes",
+			},
+		},
+		Action: showChunkStats,
+	}
+
+	bootstrapCommands(command)
+}
+
+func showChunkStats(c *cli.Context) error {
+	db := c.Args().Get(0)
+	if db == "" {
+		return cli.NewExitError("Specify a database", -1)
+	}
+	res := resources.InitResources(getConfigFilePath(c))
+	res.DB.SelectDB(db)
+
+	exists, _, _, totalChunks, err := res.MetaDB.GetRollingSettings(db)
+	if err != nil {
+		res.Log.Error(err)
+		return cli.NewExitError(err, -1)
+	}
+	if !exists {
+		return cli.NewExitError("Database "+db+" does not exist", -1)
+	}
+
+	report, err := uconn.ChunkTuningResults(res, totalChunks)
+	if err != nil {
+		res.Log.Error(err)
+		return cli.NewExitError(err, -1)
+	}
+
+	if len(report.Chunks) == 0 {
+		return cli.NewExitError("No results were found for "+db, -1)
+	}
+
+	if c.Bool("human-readable") {
+		showChunkStatsHuman(report)
+		return nil
+	}
+
+	if c.Bool("chunks") {
+		showChunkStatsDelim(report, c.String("delimiter"))
+		return nil
+	}
+	showChunkCandidatesDelim(report, c.String("delimiter"))
+	return nil
+}
+
+func showChunkStatsDelim(report uconn.ChunkReport, delim string) {
+	headerFields := []string{"Chunk", "Connections", "Pairs", "Start", "End", "Duration"}
+
+	// Print the headers and analytic values, separated by a delimiter
+	fmt.Println(strings.Join(headerFields, delim))
+	for _, chunk := range report.Chunks {
+		fmt.Println(strings.Join(chunkStatRow(chunk), delim))
+	}
+}
+
+func showChunkCandidatesDelim(report uconn.ChunkReport, delim string) {
+	headerFields := []string{"Hours", "Expected Connections", "Split Pairs", "Split Fraction", "Feasible", "Recommended"}
+
+	// Print the headers and analytic values, separated by a delimiter
+	fmt.Println(strings.Join(headerFields, delim))
+	for _, candidate := range report.Candidates {
+		fmt.Println(strings.Join(chunkCandidateRow(candidate, report.RecommendedHours), delim))
+	}
+}
+
+func showChunkStatsHuman(report uconn.ChunkReport) {
+	fmt.Printf("Host pairs: %d (%d with timestamps)\n", report.Pairs, report.TimedPairs)
+	fmt.Printf("Pairs split across chunks: %d (%d could have fit in a single chunk)\n", report.SplitPairs, report.ShortSplitPairs)
+	fmt.Printf("Connections per chunk: mean %s, standard deviation %s\n", f(report.ConnectionsMean), f(report.ConnectionsStdDev))
+	fmt.Printf("Chunk duration (seconds): mean %s, standard deviation %s\n\n", f(report.DurationMean), f(report.DurationStdDev))
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Chunk", "Connections", "Pairs", "Start", "End", "Duration"})
+	for _, chunk := range report.Chunks {
+		table.Append(chunkStatRow(chunk))
+	}
+	table.Render()
+	fmt.Println()
+
+	if len(report.Candidates) == 0 {
+		fmt.Println("No connection timestamps were found, so no chunk size can be recommended")
+		return
+	}
+
+	table = tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Hours", "Expected Connections", "Split Pairs", "Split Fraction", "Feasible", "Recommended"})
+	for _, candidate := range report.Candidates {
+		table.Append(chunkCandidateRow(candidate, report.RecommendedHours))
+	}
+	table.Render()
+
+	fmt.Printf("\nRecommended: chunks of %d hours, keeping %d chunks (--numchunks %d)\n",
+		report.RecommendedHours, report.RecommendedChunks, report.RecommendedChunks)
+}
+
+func chunkStatRow(chunk uconn.ChunkStat) []string {
+	return []string{
+		strconv.Itoa(chunk.ID),
+		i(chunk.Connections),
+		i(chunk.Pairs),
+		i(chunk.Start),
+		i(chunk.End),
+		i(chunk.End - chunk.Start),
+	}
+}
+
+func chunkCandidateRow(candidate uconn.ChunkCandidate, recommendedHours int) []string {
+	return []string{
+		strconv.Itoa(candidate.Hours),
+		f(candidate.Connections),
+		i(candidate.SplitPairs),
+		f(candidate.SplitFraction),
+		strconv.FormatBool(candidate.Feasible),
+		strconv.FormatBool(candidate.Hours == recommendedHours),
+	}
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	//ASNDatabase maps IP ranges to the autonomous system (AS) announcing them, ordered by the
+	//first address of each range. It is read from CSV files laid out like MaxMind's GeoLite2
+	//ASN CSV files, which start each row with the network and its AS number.
+	ASNDatabase []asnRange
+
+	//asnRange is a single network from an ASN database. The addresses are kept in their
+	//16 byte form so IPv4 and IPv6 networks can be compared with each other.
+	asnRange struct {
+		first  net.IP
+		last   net.IP
+		number int64
+	}
+)
+
+// loadASNDatabase reads every given ASN database file into a single database.
+// The networks in the files must not overlap.
+func loadASNDatabase(paths []string) (ASNDatabase, error) {
+	var db ASNDatabase
+	for _, path := range paths {
+		ranges, err := readASNFile(path)
+		if err != nil {
+			return nil, err
+		}
+		db = append(db, ranges...)
+	}
+
+	sort.Slice(db, func(i, j int) bool { return bytes.Compare(db[i].first, db[j].first) < 0 })
+	return db, nil
+}
+
+// readASNFile reads the networks of a single ASN database file. A header row
+// naming the columns is skipped, as is any column after the AS number.
+func readASNFile(path string) ([]asnRange, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	var ranges []asnRange
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if line == 1 && strings.TrimSpace(record[0]) == "network" {
+			continue
+		}
+
+		if len(record) < 2 {
+			return nil, fmt.Errorf("%s line %d: expected a network and an AS number", path, line)
+		}
+		block, err := parseSubnet(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: network %v", path, line, err)
+		}
+		number, err := strconv.ParseInt(strings.TrimSpace(record[1]), 10, 64)
+		if err != nil || number <= 0 {
+			return nil, fmt.Errorf("%s line %d: %q is not a valid AS number", path, line, record[1])
+		}
+
+		last := make(net.IP, len(block.IP))
+		for i := range block.IP {
+			last[i] = block.IP[i] | ^block.Mask[i]
+		}
+		ranges = append(ranges, asnRange{first: block.IP.To16(), last: last.To16(), number: number})
+	}
+	return ranges, nil
+}
+
+//Lookup returns the number of the AS announcing the given IP. Addresses which can't
+//be parsed or aren't in the database have no AS.
+func (db ASNDatabase) Lookup(ip string) (int64, bool) {
+	if len(db) == 0 {
+		return 0, false
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return 0, false
+	}
+	parsed = parsed.To16()
+
+	// find the last range starting at or before the IP
+	i := sort.Search(len(db), func(i int) bool { return bytes.Compare(db[i].first, parsed) > 0 }) - 1
+	if i < 0 || bytes.Compare(parsed, db[i].last) > 0 {
+		return 0, false
+	}
+	return db[i].number, true
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeASNFile writes the given contents to a file in a temporary directory
+func writeASNFile(t *testing.T, name string, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.Nil(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+// TestASNDatabaseLookup ensures IPs are matched to the network containing them
+// across several MaxMind style files
+func TestASNDatabaseLookup(t *testing.T) {
+	ipv4 := writeASNFile(t, "asn-ipv4.csv", "network,autonomous_system_number,autonomous_system_organization\n"+
+		"52.94.0.0/16,16509,AMAZON-02\n"+
+		"1.0.0.0/24,13335,CLOUDFLARENET\n"+
+		"\"203.0.113.7\",64500,\"Example, Inc.\"\n")
+	ipv6 := writeASNFile(t, "asn-ipv6.csv", "network,autonomous_system_number,autonomous_system_organization\n"+
+		"2600:1f18::/32,14618,AMAZON-AES\n")
+
+	db, err := loadASNDatabase([]string{ipv4, ipv6})
+	require.Nil(t, err)
+
+	cases := map[string]int64{
+		"52.94.0.0":     16509,
+		"52.94.255.255": 16509,
+		"1.0.0.1":       13335,
+		"203.0.113.7":   64500,
+		"2600:1f18::1":  14618,
+	}
+	for ip, expected := range cases {
+		number, ok := db.Lookup(ip)
+		assert.True(t, ok, ip)
+		assert.Equal(t, expected, number, ip)
+	}
+
+	for _, ip := range []string{"52.95.0.0", "1.0.1.0", "203.0.113.8", "0.0.0.1", "2600:1f19::1", "not an ip"} {
+		_, ok := db.Lookup(ip)
+		assert.False(t, ok, ip)
+	}
+
+	_, ok := ASNDatabase(nil).Lookup("52.94.0.1")
+	assert.False(t, ok, "an empty database should hold no ASNs")
+}
+
+// TestASNDatabaseValidation ensures malformed files are rejected
+func TestASNDatabaseValidation(t *testing.T) {
+	invalid := []string{
+		"52.94.0.0/33,16509\n",
+		"52.94.0.0/16\n",
+		"52.94.0.0/16,AS16509\n",
+		"52.94.0.0/16,0\n",
+	}
+	for _, contents := range invalid {
+		_, err := loadASNDatabase([]string{writeASNFile(t, "asn.csv", contents)})
+		assert.NotNil(t, err, contents)
+	}
+
+	_, err := loadASNDatabase([]string{filepath.Join(t.TempDir(), "missing.csv")})
+	assert.NotNil(t, err)
+}
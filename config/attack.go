@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type (
+	//AttackTagRule tags the results of an analysis with a MITRE ATT&CK technique id
+	//when they meet the rule's minimum scores. A zero minimum places no limit.
+	AttackTagRule struct {
+		Technique  string  `yaml:"Technique"`
+		Analysis   string  `yaml:"Analysis"`
+		MinScore   float64 `yaml:"MinScore"`
+		MinTsScore float64 `yaml:"MinTsScore"`
+	}
+
+	//AttackTagRules is a set of AttackTagRule entries
+	AttackTagRules []AttackTagRule
+)
+
+const (
+	//BeaconSNIAnalysis names the SNI beaconing analysis in an AttackTagRule
+	BeaconSNIAnalysis = "beaconSNI"
+	//BeaconProxyAnalysis names the proxy beaconing analysis in an AttackTagRule
+	BeaconProxyAnalysis = "beaconProxy"
+)
+
+// attackTechniquePattern matches ATT&CK technique and sub-technique ids such as T1071 and T1071.001
+var attackTechniquePattern = regexp.MustCompile(`^T[0-9]{4}(\.[0-9]{3})?$`)
+
+// validateAttackTagRules checks that each rule names a valid technique, a supported
+// analysis, and minimum scores within 0 to 1, and that no technique is tagged twice
+// by the same analysis
+func validateAttackTagRules(rules AttackTagRules) error {
+	seen := make(map[string]bool)
+	for i, rule := range rules {
+		if !attackTechniquePattern.MatchString(rule.Technique) {
+			return fmt.Errorf("attack tag rule %d: %q is not an ATT&CK technique id", i+1, rule.Technique)
+		}
+
+		if rule.Analysis != BeaconSNIAnalysis && rule.Analysis != BeaconProxyAnalysis {
+			return fmt.Errorf("attack tag rule %d: analysis must be one of %s, not %q", i+1,
+				strings.Join([]string{BeaconSNIAnalysis, BeaconProxyAnalysis}, ", "), rule.Analysis)
+		}
+
+		if rule.MinScore < 0 || rule.MinScore > 1 || rule.MinTsScore < 0 || rule.MinTsScore > 1 {
+			return fmt.Errorf("attack tag rule %d: minimum scores must be between 0 and 1", i+1)
+		}
+
+		// a technique's tags are removed from results which don't meet its rule,
+		// so a second rule for the same technique would undo the first
+		key := rule.Analysis + "/" + rule.Technique
+		if seen[key] {
+			return fmt.Errorf("attack tag rule %d: %s is already tagged by another %s rule", i+1, rule.Technique, rule.Analysis)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// For returns the rules which apply to the given analysis
+func (rules AttackTagRules) For(analysis string) AttackTagRules {
+	var matched AttackTagRules
+	for _, rule := range rules {
+		if rule.Analysis == analysis {
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
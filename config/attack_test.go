@@ -0,0 +1,30 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAttackTagRulesValidation ensures malformed rules are rejected
+func TestAttackTagRulesValidation(t *testing.T) {
+	valid := AttackTagRules{
+		{Technique: "T1090", Analysis: BeaconProxyAnalysis},
+		{Technique: "T1573.002", Analysis: BeaconSNIAnalysis, MinScore: 0.5, MinTsScore: 0.9},
+	}
+	assert.Nil(t, validateAttackTagRules(valid))
+	assert.Equal(t, AttackTagRules{valid[0]}, valid.For(BeaconProxyAnalysis))
+
+	invalid := []AttackTagRules{
+		{{Technique: "1090", Analysis: BeaconProxyAnalysis}},
+		{{Technique: "T1573.2", Analysis: BeaconSNIAnalysis}},
+		{{Technique: "T1090", Analysis: "beacon"}},
+		{{Technique: "T1090", Analysis: BeaconProxyAnalysis, MinScore: 1.5}},
+		{{Technique: "T1090", Analysis: BeaconProxyAnalysis, MinTsScore: -0.1}},
+		{{Technique: "T1090", Analysis: BeaconProxyAnalysis}, {Technique: "T1090", Analysis: BeaconProxyAnalysis, MinScore: 0.5}},
+	}
+
+	for _, rules := range invalid {
+		assert.NotNil(t, validateAttackTagRules(rules))
+	}
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/activecm/rita/util"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type (
+	//BaselineProfile describes the known good beaconing of any FQDN matching Domain. A beacon
+	//whose median connection interval is within Tolerance of Interval matches the profile and
+	//is handled according to Action.
+	BaselineProfile struct {
+		Domain      string        `yaml:"Domain"`
+		Interval    time.Duration `yaml:"Interval"`
+		Tolerance   time.Duration `yaml:"Tolerance"`
+		Action      string        `yaml:"Action"`
+		ScoreFactor float64       `yaml:"ScoreFactor"`
+	}
+
+	//BaselineProfiles is a set of BaselineProfile entries ordered from most to least specific
+	BaselineProfiles []BaselineProfile
+
+	//baselineProfilesFile is the layout of a baseline profiles file on disk
+	baselineProfilesFile struct {
+		Profiles []BaselineProfile `yaml:"Profiles"`
+	}
+)
+
+const (
+	//BaselineSuppress removes beacons matching a baseline profile from the results
+	BaselineSuppress = "suppress"
+	//BaselineDowngrade multiplies the score of beacons matching a baseline profile by its ScoreFactor
+	BaselineDowngrade = "downgrade"
+)
+
+// loadBaselineProfiles reads and validates the baseline profiles file at the given path.
+// An empty path yields no profiles.
+func loadBaselineProfiles(path string) (BaselineProfiles, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file baselineProfilesFile
+	if err := yaml.Unmarshal(contents, &file); err != nil {
+		return nil, err
+	}
+
+	return validateBaselineProfiles(file.Profiles)
+}
+
+// validateBaselineProfiles checks each profile and orders the profiles so that
+// the most specific match is found first
+func validateBaselineProfiles(profiles BaselineProfiles) (BaselineProfiles, error) {
+	for i := range profiles {
+		profile := &profiles[i]
+		profile.Domain = strings.ToLower(strings.TrimSpace(profile.Domain))
+		profile.Action = strings.ToLower(strings.TrimSpace(profile.Action))
+
+		if profile.Domain == "" {
+			return nil, fmt.Errorf("baseline profile %d: domain must not be empty", i+1)
+		}
+		// only subdomain wildcarding is supported, matching the threshold rules
+		if strings.Contains(strings.TrimPrefix(profile.Domain, "*."), "*") {
+			return nil, fmt.Errorf("baseline profile %d: unsupported wildcard in %s", i+1, profile.Domain)
+		}
+		if profile.Interval <= 0 {
+			return nil, fmt.Errorf("baseline profile %d: interval for %s must be positive", i+1, profile.Domain)
+		}
+		if profile.Tolerance < 0 {
+			return nil, fmt.Errorf("baseline profile %d: tolerance for %s must not be negative", i+1, profile.Domain)
+		}
+
+		switch profile.Action {
+		case "":
+			profile.Action = BaselineSuppress
+		case BaselineSuppress:
+		case BaselineDowngrade:
+			if profile.ScoreFactor <= 0 || profile.ScoreFactor >= 1 {
+				return nil, fmt.Errorf("baseline profile %d: score factor for %s must be between 0 and 1, not %v", i+1, profile.Domain, profile.ScoreFactor)
+			}
+		default:
+			return nil, fmt.Errorf("baseline profile %d: action for %s must be %s or %s, not %q", i+1, profile.Domain, BaselineSuppress, BaselineDowngrade, profile.Action)
+		}
+	}
+
+	// a domain may have several profiles, such as a daily check and an hourly
+	// heartbeat, so only the domains are ranked
+	sort.SliceStable(profiles, func(i, j int) bool {
+		return ThresholdRule{Domain: profiles[i].Domain}.specificity() > ThresholdRule{Domain: profiles[j].Domain}.specificity()
+	})
+	return profiles, nil
+}
+
+//Match returns the most specific profile matching the given FQDN whose expected interval
+//covers the given median connection interval, if any
+func (p BaselineProfiles) Match(fqdn string, medianInterval time.Duration) (BaselineProfile, bool) {
+	fqdn = strings.ToLower(fqdn)
+	for _, profile := range p {
+		if !util.ContainsDomain([]string{profile.Domain}, fqdn) {
+			continue
+		}
+		if medianInterval >= profile.Interval-profile.Tolerance && medianInterval <= profile.Interval+profile.Tolerance {
+			return profile, true
+		}
+	}
+	return BaselineProfile{}, false
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// TestBaselineProfilesFile ensures intervals are read as durations and the action defaults to suppress
+func TestBaselineProfilesFile(t *testing.T) {
+	var file baselineProfilesFile
+	require.Nil(t, yaml.Unmarshal([]byte(`
+Profiles:
+  - Domain: "*.update.example.com"
+    Interval: 24h
+    Tolerance: 2h
+  - Domain: telemetry.example.com
+    Interval: 5m
+    Tolerance: 30s
+    Action: downgrade
+    ScoreFactor: 0.5
+`), &file))
+
+	profiles, err := validateBaselineProfiles(file.Profiles)
+	require.Nil(t, err)
+	require.Len(t, profiles, 2)
+	assert.Equal(t, "telemetry.example.com", profiles[0].Domain, "exact domains should be matched first")
+	assert.Equal(t, 5*time.Minute, profiles[0].Interval)
+	assert.Equal(t, BaselineSuppress, profiles[1].Action)
+	assert.Equal(t, 2*time.Hour, profiles[1].Tolerance)
+}
+
+// TestBaselineProfilesMatch ensures a beacon only matches when its interval is within tolerance
+func TestBaselineProfilesMatch(t *testing.T) {
+	profiles, err := validateBaselineProfiles(BaselineProfiles{
+		{Domain: "*.example.com", Interval: time.Hour, Tolerance: 5 * time.Minute},
+		{Domain: "update.example.com", Interval: 24 * time.Hour, Tolerance: 2 * time.Hour},
+	})
+	require.Nil(t, err)
+
+	profile, ok := profiles.Match("UPDATE.example.com", 22*time.Hour)
+	assert.True(t, ok, "the edge of the tolerance should match")
+	assert.Equal(t, "update.example.com", profile.Domain)
+
+	profile, ok = profiles.Match("update.example.com", 62*time.Minute)
+	assert.True(t, ok, "a less specific profile should match when the specific one doesn't cover the interval")
+	assert.Equal(t, "*.example.com", profile.Domain)
+
+	_, ok = profiles.Match("update.example.com", 10*time.Hour)
+	assert.False(t, ok, "intervals outside of every profile should not match")
+
+	_, ok = profiles.Match("example.org", time.Hour)
+	assert.False(t, ok, "unmatched domains should not match")
+}
+
+// TestBaselineProfilesValidation ensures malformed profiles are rejected
+func TestBaselineProfilesValidation(t *testing.T) {
+	invalid := []BaselineProfiles{
+		{{Domain: " ", Interval: time.Hour}},
+		{{Domain: "a.*.com", Interval: time.Hour}},
+		{{Domain: "a.com"}},
+		{{Domain: "a.com", Interval: time.Hour, Tolerance: -time.Minute}},
+		{{Domain: "a.com", Interval: time.Hour, Action: "ignore"}},
+		{{Domain: "a.com", Interval: time.Hour, Action: BaselineDowngrade}},
+		{{Domain: "a.com", Interval: time.Hour, Action: BaselineDowngrade, ScoreFactor: 1}},
+	}
+	for i, profiles := range invalid {
+		_, err := validateBaselineProfiles(profiles)
+		assert.NotNil(t, err, "case %d should be rejected", i)
+	}
+}
@@ -0,0 +1,27 @@
+package config
+
+import "fmt"
+
+const (
+	//BrowsingFilter drops pairs whose connections are mostly clustered like page loads
+	BrowsingFilter = "filter"
+	//BrowsingDowngrade scores pairs whose connections are mostly clustered like page loads lower
+	BrowsingDowngrade = "downgrade"
+)
+
+// validateBrowsingBursts checks the settings used to tell page load bursts apart from beacons
+func validateBrowsingBursts(cfg BrowsingBurstsStaticCfg) error {
+	if cfg.MinSpacing < 0 {
+		return fmt.Errorf("browsing burst minimum spacing must not be negative, not %g", cfg.MinSpacing)
+	}
+	if cfg.MinSpacing == 0 {
+		return nil
+	}
+	if cfg.MaxClusteredFraction <= 0 || cfg.MaxClusteredFraction > 1 {
+		return fmt.Errorf("browsing burst maximum clustered fraction must be above 0 and at most 1, not %g", cfg.MaxClusteredFraction)
+	}
+	if cfg.Action != BrowsingFilter && cfg.Action != BrowsingDowngrade {
+		return fmt.Errorf("browsing burst action must be %s or %s, not %q", BrowsingFilter, BrowsingDowngrade, cfg.Action)
+	}
+	return nil
+}
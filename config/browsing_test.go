@@ -0,0 +1,26 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBrowsingBursts(t *testing.T) {
+	assert.Nil(t, validateBrowsingBursts(BrowsingBurstsStaticCfg{}), "a spacing of 0 should disable the check")
+
+	valid := BrowsingBurstsStaticCfg{MinSpacing: 2, MaxClusteredFraction: 0.8, Action: BrowsingFilter}
+	assert.Nil(t, validateBrowsingBursts(valid))
+
+	invalid := []func(*BrowsingBurstsStaticCfg){
+		func(cfg *BrowsingBurstsStaticCfg) { cfg.MinSpacing = -1 },
+		func(cfg *BrowsingBurstsStaticCfg) { cfg.MaxClusteredFraction = 0 },
+		func(cfg *BrowsingBurstsStaticCfg) { cfg.MaxClusteredFraction = 1.5 },
+		func(cfg *BrowsingBurstsStaticCfg) { cfg.Action = "drop" },
+	}
+	for i, change := range invalid {
+		cfg := valid
+		change(&cfg)
+		assert.NotNil(t, validateBrowsingBursts(cfg), "case %d should be rejected", i)
+	}
+}
@@ -0,0 +1,76 @@
+package config
+
+import "fmt"
+
+type (
+	//ScoreBucket labels the scores from MinScore up to the MinScore of the next bucket
+	ScoreBucket struct {
+		Label    string
+		MinScore float64
+	}
+
+	//ScoreBuckets is a set of ScoreBucket entries sorted by ascending MinScore
+	ScoreBuckets []ScoreBucket
+)
+
+const (
+	//LowSeverity labels scores below ScoreBuckets.Medium
+	LowSeverity = "low"
+	//MediumSeverity labels scores from ScoreBuckets.Medium up to ScoreBuckets.High
+	MediumSeverity = "medium"
+	//HighSeverity labels scores from ScoreBuckets.High up to ScoreBuckets.Critical
+	HighSeverity = "high"
+	//CriticalSeverity labels scores of at least ScoreBuckets.Critical
+	CriticalSeverity = "critical"
+)
+
+// validateScoreBuckets checks that the bucket thresholds are within 0 to 1 and
+// strictly ascending, so that every bucket covers some range of scores
+func validateScoreBuckets(cfg ScoreBucketsStaticCfg) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	thresholds := []float64{cfg.Medium, cfg.High, cfg.Critical}
+	for _, threshold := range thresholds {
+		if threshold < 0 || threshold > 1 {
+			return fmt.Errorf("score bucket thresholds must be between 0 and 1, not %v", threshold)
+		}
+	}
+
+	if !(cfg.Medium < cfg.High && cfg.High < cfg.Critical) {
+		return fmt.Errorf("score bucket thresholds must be ascending: Medium (%v) < High (%v) < Critical (%v)",
+			cfg.Medium, cfg.High, cfg.Critical)
+	}
+	return nil
+}
+
+// Buckets returns the configured score buckets, or nil if bucketing is disabled
+func (cfg ScoreBucketsStaticCfg) Buckets() ScoreBuckets {
+	if !cfg.Enabled {
+		return nil
+	}
+	return ScoreBuckets{
+		{Label: LowSeverity, MinScore: 0},
+		{Label: MediumSeverity, MinScore: cfg.Medium},
+		{Label: HighSeverity, MinScore: cfg.High},
+		{Label: CriticalSeverity, MinScore: cfg.Critical},
+	}
+}
+
+// Label returns the label of the bucket holding the given score. A score equal to a
+// threshold falls into the higher bucket.
+func (buckets ScoreBuckets) Label(score float64) string {
+	label := ""
+	for _, bucket := range buckets {
+		if score < bucket.MinScore {
+			break
+		}
+		label = bucket.Label
+	}
+	// scores below the lowest threshold still belong in the lowest bucket
+	if label == "" && len(buckets) > 0 {
+		label = buckets[0].Label
+	}
+	return label
+}
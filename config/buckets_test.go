@@ -0,0 +1,47 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestScoreBucketLabels ensures scores on a threshold fall into the higher bucket
+func TestScoreBucketLabels(t *testing.T) {
+	cfg := ScoreBucketsStaticCfg{Enabled: true, Medium: 0.5, High: 0.7, Critical: 0.9}
+	assert.Nil(t, validateScoreBuckets(cfg))
+
+	buckets := cfg.Buckets()
+	cases := map[float64]string{
+		0:      LowSeverity,
+		0.4999: LowSeverity,
+		0.5:    MediumSeverity,
+		0.6999: MediumSeverity,
+		0.7:    HighSeverity,
+		0.8999: HighSeverity,
+		0.9:    CriticalSeverity,
+		1:      CriticalSeverity,
+	}
+	for score, label := range cases {
+		assert.Equal(t, label, buckets.Label(score), "score %v", score)
+	}
+
+	assert.Nil(t, ScoreBucketsStaticCfg{Medium: 0.5}.Buckets(), "disabled bucketing should have no buckets")
+}
+
+// TestScoreBucketValidation ensures out of range and unordered thresholds are rejected
+func TestScoreBucketValidation(t *testing.T) {
+	invalid := []ScoreBucketsStaticCfg{
+		{Enabled: true, Medium: -0.1, High: 0.7, Critical: 0.9},
+		{Enabled: true, Medium: 0.5, High: 0.7, Critical: 1.1},
+		{Enabled: true, Medium: 0.7, High: 0.5, Critical: 0.9},
+		{Enabled: true, Medium: 0.5, High: 0.5, Critical: 0.9},
+	}
+
+	for _, cfg := range invalid {
+		assert.NotNil(t, validateScoreBuckets(cfg))
+	}
+
+	// thresholds are only checked when bucketing is enabled
+	assert.Nil(t, validateScoreBuckets(ScoreBucketsStaticCfg{Medium: 2}))
+}
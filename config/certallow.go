@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type (
+	//CertAllowRule matches certificates known to be benign, such as the self-signed
+	//certificates of printers and internal services. Subject and Issuer are glob patterns
+	//matched against the whole distinguished name. An empty pattern matches any name.
+	CertAllowRule struct {
+		Subject string `yaml:"Subject"`
+		Issuer  string `yaml:"Issuer"`
+	}
+
+	//certAllowPattern is a CertAllowRule with its patterns compiled (nil matches any name)
+	certAllowPattern struct {
+		subject *regexp.Regexp
+		issuer  *regexp.Regexp
+	}
+
+	//CertAllowList holds the compiled patterns of the certificates which aren't flagged as invalid
+	CertAllowList []certAllowPattern
+)
+
+//ParseCertAllowList compiles the given rules. Each rule needs a subject or issuer pattern,
+//since a rule without either would allow every certificate.
+func ParseCertAllowList(rules []CertAllowRule) (CertAllowList, error) {
+	var allowList CertAllowList
+	for i, rule := range rules {
+		subject := strings.TrimSpace(rule.Subject)
+		issuer := strings.TrimSpace(rule.Issuer)
+		if subject == "" && issuer == "" {
+			return nil, fmt.Errorf("certificate allow list rule %d: a Subject or Issuer pattern is required", i+1)
+		}
+		allowList = append(allowList, certAllowPattern{
+			subject: compileGlob(subject),
+			issuer:  compileGlob(issuer),
+		})
+	}
+	return allowList, nil
+}
+
+//compileGlob turns a glob pattern into a case insensitive regular expression matching the
+//whole name. * matches any run of characters, including none, and ? matches a single
+//character. Every other character matches itself. nil is returned for an empty pattern.
+func compileGlob(pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.Replace(quoted, `\*`, `.*`, -1)
+	quoted = strings.Replace(quoted, `\?`, `.`, -1)
+	return regexp.MustCompile(`(?is)^` + quoted + `$`)
+}
+
+//Allows returns true if a certificate with the given subject and issuer distinguished
+//names matches any rule. A rule matches when both of its patterns do.
+func (l CertAllowList) Allows(subject string, issuer string) bool {
+	for _, rule := range l {
+		if rule.subject != nil && !rule.subject.MatchString(subject) {
+			continue
+		}
+		if rule.issuer != nil && !rule.issuer.MatchString(issuer) {
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertAllowList(t *testing.T) {
+	allowList, err := ParseCertAllowList([]CertAllowRule{
+		{Subject: "CN=printer-*.corp.local*"},
+		{Subject: "CN=dev?,O=Lab", Issuer: "CN=Lab CA"},
+		{Issuer: "*O=Internal IoT*"},
+	})
+	assert.Nil(t, err)
+
+	assert.True(t, allowList.Allows("CN=printer-3rd-floor.corp.local,O=HP", "CN=printer-3rd-floor.corp.local"))
+	assert.True(t, allowList.Allows("cn=PRINTER-lobby.corp.local", ""), "patterns should match regardless of case")
+	assert.False(t, allowList.Allows("CN=printer.corp.local", ""), "the subject should match the whole pattern")
+
+	assert.True(t, allowList.Allows("CN=dev1,O=Lab", "CN=Lab CA"))
+	assert.False(t, allowList.Allows("CN=dev1,O=Lab", "CN=Other CA"), "both patterns of a rule should match")
+	assert.False(t, allowList.Allows("CN=dev12,O=Lab", "CN=Lab CA"), "? should match a single character")
+
+	assert.True(t, allowList.Allows("CN=camera", "CN=Root,O=Internal IoT,C=US"))
+	assert.False(t, allowList.Allows("CN=login.example.com", "CN=Evil CA"))
+
+	// regular expression characters in a pattern match themselves
+	allowList, err = ParseCertAllowList([]CertAllowRule{{Subject: "CN=a.b(1)"}})
+	assert.Nil(t, err)
+	assert.True(t, allowList.Allows("CN=a.b(1)", ""))
+	assert.False(t, allowList.Allows("CN=axb(1)", ""))
+
+	_, err = ParseCertAllowList([]CertAllowRule{{Subject: " ", Issuer: ""}})
+	assert.NotNil(t, err, "a rule without patterns should be rejected")
+
+	assert.False(t, CertAllowList(nil).Allows("CN=printer", "CN=printer"))
+}
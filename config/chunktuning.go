@@ -0,0 +1,23 @@
+package config
+
+import "fmt"
+
+// validateChunkTuning checks the settings used to recommend a chunk size for rolling databases
+func validateChunkTuning(cfg ChunkTuningStaticCfg) error {
+	if len(cfg.CandidateHours) == 0 {
+		return fmt.Errorf("at least one candidate chunk size must be listed")
+	}
+	for _, hours := range cfg.CandidateHours {
+		// chunks which don't divide a day would start at a different hour each day
+		if hours <= 0 || 24%hours != 0 && hours%24 != 0 {
+			return fmt.Errorf("candidate chunk sizes must divide a day or span whole days, not %d hours", hours)
+		}
+	}
+	if cfg.MaxConnectionsPerChunk <= 0 {
+		return fmt.Errorf("maximum connections per chunk must be above 0, not %d", cfg.MaxConnectionsPerChunk)
+	}
+	if cfg.SplitTolerance < 0 || cfg.SplitTolerance > 1 {
+		return fmt.Errorf("split tolerance must be between 0 and 1, not %g", cfg.SplitTolerance)
+	}
+	return nil
+}
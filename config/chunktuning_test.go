@@ -0,0 +1,27 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateChunkTuning(t *testing.T) {
+	valid := ChunkTuningStaticCfg{CandidateHours: []int{1, 6, 24, 48}, MaxConnectionsPerChunk: 1000, SplitTolerance: 0.05}
+	assert.Nil(t, validateChunkTuning(valid))
+
+	invalid := []func(*ChunkTuningStaticCfg){
+		func(cfg *ChunkTuningStaticCfg) { cfg.CandidateHours = nil },
+		func(cfg *ChunkTuningStaticCfg) { cfg.CandidateHours = []int{0} },
+		func(cfg *ChunkTuningStaticCfg) { cfg.CandidateHours = []int{5} },
+		func(cfg *ChunkTuningStaticCfg) { cfg.CandidateHours = []int{36} },
+		func(cfg *ChunkTuningStaticCfg) { cfg.MaxConnectionsPerChunk = 0 },
+		func(cfg *ChunkTuningStaticCfg) { cfg.SplitTolerance = -0.1 },
+		func(cfg *ChunkTuningStaticCfg) { cfg.SplitTolerance = 1.5 },
+	}
+	for i, change := range invalid {
+		cfg := valid
+		change(&cfg)
+		assert.NotNil(t, validateChunkTuning(cfg), "case %d should be rejected", i)
+	}
+}
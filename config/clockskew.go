@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type (
+	//SensorClockOffset records how far the clock of a sensor runs ahead of the reference clock.
+	//Sensors running behind have a negative offset.
+	SensorClockOffset struct {
+		Sensor string        `yaml:"Sensor"`
+		Offset time.Duration `yaml:"Offset"`
+	}
+
+	//SensorOffsets maps each sensor identifier to the offset of its clock
+	SensorOffsets map[string]time.Duration
+)
+
+// parseSensorOffsets validates the clock offsets of the sensors and indexes them by sensor.
+// Offsets can only be applied when sensorField names where the sensor of each connection
+// is recorded.
+func parseSensorOffsets(sensorField string, offsets []SensorClockOffset) (SensorOffsets, error) {
+	if len(offsets) == 0 {
+		return nil, nil
+	}
+	if strings.TrimSpace(sensorField) == "" {
+		return nil, fmt.Errorf("sensor clock offsets need SensorField to identify the sensor of each connection")
+	}
+
+	parsed := make(SensorOffsets, len(offsets))
+	for _, offset := range offsets {
+		if offset.Sensor == "" {
+			return nil, fmt.Errorf("sensor clock offset of %s has no sensor", offset.Offset)
+		}
+		if _, ok := parsed[offset.Sensor]; ok {
+			return nil, fmt.Errorf("sensor %s has more than one clock offset", offset.Sensor)
+		}
+		parsed[offset.Sensor] = offset.Offset
+	}
+	return parsed, nil
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// TestParseSensorOffsets ensures the sensor clock offsets are indexed by sensor
+func TestParseSensorOffsets(t *testing.T) {
+	offsets, err := parseSensorOffsets("", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, offsets, "no offsets should be needed")
+
+	offsets, err = parseSensorOffsets("sensors", []SensorClockOffset{
+		{Sensor: "sensor-east", Offset: 1500 * time.Millisecond},
+		{Sensor: "sensor-west", Offset: -800 * time.Millisecond},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, SensorOffsets{"sensor-east": 1500 * time.Millisecond, "sensor-west": -800 * time.Millisecond}, offsets)
+
+	_, err = parseSensorOffsets("", []SensorClockOffset{{Sensor: "sensor-east", Offset: time.Second}})
+	assert.NotNil(t, err, "offsets without a sensor field should be rejected")
+
+	_, err = parseSensorOffsets("sensors", []SensorClockOffset{{Offset: time.Second}})
+	assert.NotNil(t, err, "offsets without a sensor should be rejected")
+
+	_, err = parseSensorOffsets("sensors", []SensorClockOffset{
+		{Sensor: "sensor-east", Offset: time.Second},
+		{Sensor: "sensor-east", Offset: 2 * time.Second},
+	})
+	assert.NotNil(t, err, "sensors with several offsets should be rejected")
+}
+
+// TestSensorOffsetsYAML ensures offsets are read from duration strings
+func TestSensorOffsetsYAML(t *testing.T) {
+	var cfg struct {
+		Offsets []SensorClockOffset `yaml:"SensorClockOffsets"`
+	}
+	err := yaml.Unmarshal([]byte("SensorClockOffsets:\n  - Sensor: sensor-east\n    Offset: -250ms\n"), &cfg)
+	require.Nil(t, err)
+	assert.Equal(t, []SensorClockOffset{{Sensor: "sensor-east", Offset: -250 * time.Millisecond}}, cfg.Offsets)
+}
@@ -0,0 +1,22 @@
+package config
+
+import "fmt"
+
+const (
+	//CombineMean scores a beacon with the weighted average of its feature scores
+	CombineMean = "mean"
+	//CombineMin scores a beacon with its lowest weighted feature score
+	CombineMin = "min"
+	//CombineProduct scores a beacon with the product of its feature scores, each raised to its weight
+	CombineProduct = "product"
+	//CombineMax scores a beacon with its highest weighted feature score
+	CombineMax = "max"
+)
+
+// validateScoreCombination checks how a scoring model combines the per feature scores of a beacon
+func validateScoreCombination(combination string) error {
+	if combination != CombineMean && combination != CombineMin && combination != CombineProduct && combination != CombineMax {
+		return fmt.Errorf("score combination must be %s, %s, %s, or %s, not %q", CombineMean, CombineMin, CombineProduct, CombineMax, combination)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidateScoreCombination ensures only the known score combinations are accepted
+func TestValidateScoreCombination(t *testing.T) {
+	for _, combination := range []string{CombineMean, CombineMin, CombineProduct, CombineMax} {
+		assert.Nil(t, validateScoreCombination(combination), combination)
+	}
+	assert.NotNil(t, validateScoreCombination(""), "an empty value should be rejected")
+	assert.NotNil(t, validateScoreCombination("Min"), "values should be case sensitive")
+	assert.NotNil(t, validateScoreCombination("median"))
+}
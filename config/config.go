@@ -65,6 +65,21 @@ func LoadConfig(customConfigPath string) (*Config, error) {
 		return nil, err
 	}
 
+	// Replace the default SNIconn field paths with any set in the static config
+	if err := overrideSNIConnFields(config.S.BeaconSNI.Fields, &config.T.BeaconSNI.SNIConnFieldsCfg); err != nil {
+		return nil, err
+	}
+
+	// The timestamp field units follow the field paths, so they are checked once the paths are known
+	if err := validateTimestampFieldUnits(config.S.BeaconSNI.TimestampFieldUnits, config.T.BeaconSNI.TimestampFields); err != nil {
+		return nil, err
+	}
+
+	// Keep the SNI beacon results of an experimental run apart from the regular results
+	if err := applyBeaconSNIResultSuffix(config.S.BeaconSNI.ResultSuffix, &config.T.BeaconSNI); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
 
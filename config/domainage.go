@@ -0,0 +1,115 @@
+package config
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+//DomainAges maps domains to the date they were registered. It is read from CSV files
+//holding a domain and its registration date on each row, such as an enrichment export or
+//a WHOIS cache. Domains are stored lowercase without a trailing dot.
+type DomainAges map[string]time.Time
+
+//domainDateLayouts lists the formats accepted for registration dates
+var domainDateLayouts = []string{"2006-01-02", time.RFC3339}
+
+// loadDomainAges reads every given domain age file into a single lookup. A domain
+// listed more than once keeps the date from the file read last.
+func loadDomainAges(paths []string) (DomainAges, error) {
+	ages := make(DomainAges)
+	for _, path := range paths {
+		if err := readDomainAgeFile(path, ages); err != nil {
+			return nil, err
+		}
+	}
+	return ages, nil
+}
+
+// readDomainAgeFile adds the domains of a single domain age file to ages. A header
+// row naming the columns is skipped, as is any column after the registration date.
+func readDomainAgeFile(path string, ages DomainAges) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if line == 1 && strings.TrimSpace(record[0]) == "domain" {
+			continue
+		}
+
+		if len(record) < 2 {
+			return fmt.Errorf("%s line %d: expected a domain and a registration date", path, line)
+		}
+		domain := normalizeDomain(record[0])
+		if domain == "" {
+			return fmt.Errorf("%s line %d: the domain is empty", path, line)
+		}
+		registered, err := parseDomainDate(record[1])
+		if err != nil {
+			return fmt.Errorf("%s line %d: %q is not a registration date", path, line, record[1])
+		}
+		ages[domain] = registered
+	}
+	return nil
+}
+
+//parseDomainDate parses a registration date given as a day or an RFC 3339 timestamp.
+//Days are taken as midnight UTC.
+func parseDomainDate(value string) (time.Time, error) {
+	var err error
+	for _, layout := range domainDateLayouts {
+		var date time.Time
+		if date, err = time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+//normalizeDomain lowercases a domain and removes surrounding space and any trailing dot
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+//Lookup returns the registration date of the given FQDN along with the domain it was listed
+//under. The FQDN itself is tried first, followed by its registrable domain (effective TLD+1)
+//according to the public suffix list, since registration dates belong to the registrable
+//domain. FQDNs which aren't listed either way have no registration date.
+func (ages DomainAges) Lookup(fqdn string) (string, time.Time, bool) {
+	if len(ages) == 0 {
+		return "", time.Time{}, false
+	}
+
+	domain := normalizeDomain(fqdn)
+	if registered, ok := ages[domain]; ok {
+		return domain, registered, true
+	}
+
+	registrable, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil || registrable == domain {
+		return "", time.Time{}, false
+	}
+	if registered, ok := ages[registrable]; ok {
+		return registrable, registered, true
+	}
+	return "", time.Time{}, false
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeDomainAgeFile writes the given contents to a file in a temporary directory
+func writeDomainAgeFile(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "domains.csv")
+	require.Nil(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+func TestLoadDomainAges(t *testing.T) {
+	path := writeDomainAgeFile(t, "domain,registered\n"+
+		"# exported from the WHOIS cache\n"+
+		"Evil.co.uk.,2022-08-01\n"+
+		"cdn.example.com,2010-01-02T03:04:05Z,extra\n")
+
+	ages, err := loadDomainAges([]string{path})
+	require.Nil(t, err)
+	assert.Len(t, ages, 2)
+	assert.Equal(t, time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC), ages["evil.co.uk"])
+	assert.Equal(t, time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC), ages["cdn.example.com"])
+
+	for i, contents := range []string{"evil.com\n", "evil.com,yesterday\n", ",2022-08-01\n"} {
+		_, err := loadDomainAges([]string{writeDomainAgeFile(t, contents)})
+		assert.NotNil(t, err, "case %d should be rejected", i)
+	}
+
+	_, err = loadDomainAges([]string{filepath.Join(t.TempDir(), "missing.csv")})
+	assert.NotNil(t, err)
+}
+
+func TestDomainAgesLookup(t *testing.T) {
+	registered := time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+	older := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	ages := DomainAges{"evil.co.uk": registered, "cdn.example.com": older}
+
+	domain, date, ok := ages.Lookup("A1.b2.Evil.co.uk.")
+	assert.True(t, ok, "subdomains should fall back to the registrable domain")
+	assert.Equal(t, "evil.co.uk", domain)
+	assert.Equal(t, registered, date)
+
+	domain, _, ok = ages.Lookup("cdn.example.com")
+	assert.True(t, ok, "listed FQDNs should match directly")
+	assert.Equal(t, "cdn.example.com", domain)
+
+	_, _, ok = ages.Lookup("www.example.com")
+	assert.False(t, ok, "FQDNs listed below the registrable domain should not match their siblings")
+	_, _, ok = ages.Lookup("co.uk")
+	assert.False(t, ok)
+	_, _, ok = DomainAges(nil).Lookup("evil.co.uk")
+	assert.False(t, ok)
+}
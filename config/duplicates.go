@@ -0,0 +1,21 @@
+package config
+
+import "fmt"
+
+const (
+	//DuplicatesFirst analyzes the first document found for a pair and ignores the rest
+	DuplicatesFirst = "first"
+	//DuplicatesError skips a pair with more than one document and reports it as an error
+	DuplicatesError = "error"
+	//DuplicatesMerge joins the chunks of every document found for a pair before analyzing it
+	DuplicatesMerge = "merge"
+)
+
+// validateDuplicateDocuments checks how a beacon dissector handles pairs with more than one
+// connection document
+func validateDuplicateDocuments(handling string) error {
+	if handling != DuplicatesFirst && handling != DuplicatesError && handling != DuplicatesMerge {
+		return fmt.Errorf("duplicate document handling must be %s, %s, or %s, not %q", DuplicatesFirst, DuplicatesError, DuplicatesMerge, handling)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidateDuplicateDocuments ensures only the known ways of handling duplicates are accepted
+func TestValidateDuplicateDocuments(t *testing.T) {
+	for _, handling := range []string{DuplicatesFirst, DuplicatesError, DuplicatesMerge} {
+		assert.Nil(t, validateDuplicateDocuments(handling), handling)
+	}
+	assert.NotNil(t, validateDuplicateDocuments(""), "an empty value should be rejected")
+	assert.NotNil(t, validateDuplicateDocuments("Merge"), "values should be case sensitive")
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// overrideSNIConnFields replaces the SNIconn field paths in fields with the paths set in
+// overrides. The paths depend on each other, so either none or all of them must be set.
+func overrideSNIConnFields(overrides SNIConnFieldsStaticCfg, fields *SNIConnFieldsCfg) error {
+	named := []struct {
+		name  string
+		paths []string
+	}{
+		{"TimestampFields", overrides.TimestampFields},
+		{"BytesFields", overrides.BytesFields},
+		{"CountFields", overrides.CountFields},
+		{"TotalBytesFields", overrides.TotalBytesFields},
+		{"DstIPsFields", overrides.DstIPsFields},
+	}
+
+	var set, missing []string
+	for _, option := range named {
+		if len(option.paths) == 0 {
+			missing = append(missing, option.name)
+			continue
+		}
+		set = append(set, option.name)
+
+		for _, path := range option.paths {
+			if strings.TrimSpace(path) == "" || strings.HasPrefix(path, "$") {
+				return fmt.Errorf("BeaconSNI.Fields.%s: %q is not a valid field path", option.name, path)
+			}
+		}
+	}
+
+	if len(set) == 0 {
+		return nil
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("BeaconSNI.Fields: %s must be set along with %s",
+			strings.Join(missing, ", "), strings.Join(set, ", "))
+	}
+
+	fields.TimestampFields = overrides.TimestampFields
+	fields.BytesFields = overrides.BytesFields
+	fields.CountFields = overrides.CountFields
+	fields.TotalBytesFields = overrides.TotalBytesFields
+	fields.DstIPsFields = overrides.DstIPsFields
+	return nil
+}
+
+// validateTimestampFieldUnits checks that units holds the unit of each of the SNIconn
+// timestamp fields in timestampFields, in the same order. No units leaves every field to be
+// detected from its values.
+func validateTimestampFieldUnits(units []string, timestampFields []string) error {
+	if len(units) == 0 {
+		return nil
+	}
+	if len(units) != len(timestampFields) {
+		return fmt.Errorf("BeaconSNI.TimestampFieldUnits: %d units were given for %d timestamp fields (%s)",
+			len(units), len(timestampFields), strings.Join(timestampFields, ", "))
+	}
+
+	for i, unit := range units {
+		switch unit {
+		case AutoResolution, SecondResolution, MillisecondResolution, MicrosecondResolution:
+		default:
+			return fmt.Errorf("BeaconSNI.TimestampFieldUnits: %q is not a valid unit for %s, use %q, %q, %q, or %q",
+				unit, timestampFields[i], AutoResolution, SecondResolution, MillisecondResolution, MicrosecondResolution)
+		}
+	}
+	return nil
+}
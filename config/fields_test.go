@@ -0,0 +1,53 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestOverrideSNIConnFields ensures the field paths are only replaced when all of them are set
+func TestOverrideSNIConnFields(t *testing.T) {
+	defaults := SNIConnFieldsCfg{
+		TimestampFields:  []string{"dat.http.ts", "dat.tls.ts"},
+		BytesFields:      []string{"dat.http.bytes", "dat.tls.bytes"},
+		CountFields:      []string{"dat.http.count", "dat.tls.count"},
+		TotalBytesFields: []string{"dat.http.tbytes", "dat.tls.tbytes"},
+		DstIPsFields:     []string{"dat.http.dst_ips", "dat.tls.dst_ips"},
+	}
+
+	fields := defaults
+	assert.Nil(t, overrideSNIConnFields(SNIConnFieldsStaticCfg{}, &fields))
+	assert.Equal(t, defaults, fields, "unset overrides should keep the defaults")
+
+	overrides := SNIConnFieldsStaticCfg{
+		TimestampFields:  []string{"conns.time"},
+		BytesFields:      []string{"conns.orig_bytes"},
+		CountFields:      []string{"conns.n"},
+		TotalBytesFields: []string{"conns.total"},
+		DstIPsFields:     []string{"conns.responders"},
+	}
+	assert.Nil(t, overrideSNIConnFields(overrides, &fields))
+	assert.Equal(t, []string{"conns.time"}, fields.TimestampFields)
+	assert.Equal(t, []string{"conns.responders"}, fields.DstIPsFields)
+
+	fields = defaults
+	err := overrideSNIConnFields(SNIConnFieldsStaticCfg{TimestampFields: []string{"conns.time"}}, &fields)
+	assert.NotNil(t, err, "setting only some of the paths should be rejected")
+	assert.Equal(t, defaults, fields, "the defaults should be kept when the overrides are rejected")
+
+	overrides.CountFields = []string{"$conns.n"}
+	assert.NotNil(t, overrideSNIConnFields(overrides, &fields), "paths should not be given as expressions")
+}
+
+// TestValidateTimestampFieldUnits ensures a valid unit is given for each timestamp field
+func TestValidateTimestampFieldUnits(t *testing.T) {
+	fields := []string{"dat.http.ts", "dat.tls.ts"}
+
+	assert.Nil(t, validateTimestampFieldUnits(nil, fields), "no units should detect every field")
+	assert.Nil(t, validateTimestampFieldUnits([]string{"s", "us"}, fields))
+	assert.Nil(t, validateTimestampFieldUnits([]string{"auto", "ms"}, fields))
+
+	assert.NotNil(t, validateTimestampFieldUnits([]string{"s"}, fields), "each field should have a unit")
+	assert.NotNil(t, validateTimestampFieldUnits([]string{"s", "ns"}, fields), "unknown units should be rejected")
+}
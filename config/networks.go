@@ -0,0 +1,132 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+type (
+	//NetworkNameRule gives a friendly name, such as "AWS us-east-1", to every IP in Subnet
+	NetworkNameRule struct {
+		Subnet string `yaml:"Subnet"`
+		Name   string `yaml:"Name"`
+	}
+
+	//NetworkNames is a parsed set of network name rules, ordered from the longest
+	//prefix to the shortest so the most specific subnet is found first
+	NetworkNames []networkName
+
+	//networkName is a NetworkNameRule with its subnet parsed
+	networkName struct {
+		block *net.IPNet
+		name  string
+	}
+
+	//networkNamesFile is the layout of a network names file on disk
+	networkNamesFile struct {
+		Networks []NetworkNameRule `yaml:"Networks"`
+	}
+)
+
+// loadNetworkNames reads the network names file at the given path, if any, and
+// combines it with the rules from the main config. A rule in the main config
+// replaces a rule in the file for the exact same subnet.
+func loadNetworkNames(rules []NetworkNameRule, path string) (NetworkNames, error) {
+	var fileRules []NetworkNameRule
+	if path != "" {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var file networkNamesFile
+		if err := yaml.Unmarshal(contents, &file); err != nil {
+			return nil, err
+		}
+		fileRules = file.Networks
+	}
+
+	return parseNetworkNames(rules, fileRules)
+}
+
+// parseNetworkNames validates both sets of rules and merges them, with the
+// rules in overrides taking the place of base rules for the same subnet
+func parseNetworkNames(overrides []NetworkNameRule, base []NetworkNameRule) (NetworkNames, error) {
+	names, err := validateNetworkNames(overrides)
+	if err != nil {
+		return nil, err
+	}
+	baseNames, err := validateNetworkNames(base)
+	if err != nil {
+		return nil, err
+	}
+
+	replaced := make(map[string]bool)
+	for _, entry := range names {
+		replaced[entry.block.String()] = true
+	}
+	for _, entry := range baseNames {
+		if !replaced[entry.block.String()] {
+			names = append(names, entry)
+		}
+	}
+
+	// the longest prefix wins when several subnets contain the same IP
+	sort.SliceStable(names, func(i, j int) bool {
+		onesI, _ := names[i].block.Mask.Size()
+		onesJ, _ := names[j].block.Mask.Size()
+		return onesI > onesJ
+	})
+	return names, nil
+}
+
+// validateNetworkNames parses the subnet of each rule and checks that every
+// subnet is named exactly once
+func validateNetworkNames(rules []NetworkNameRule) (NetworkNames, error) {
+	names := make(NetworkNames, 0, len(rules))
+	seen := make(map[string]bool)
+	for i, rule := range rules {
+		block, err := parseSubnet(rule.Subnet)
+		if err != nil {
+			return nil, fmt.Errorf("network name %d: subnet %v", i+1, err)
+		}
+
+		name := strings.TrimSpace(rule.Name)
+		if name == "" {
+			return nil, fmt.Errorf("network name %d: name for %s must not be empty", i+1, block)
+		}
+
+		if seen[block.String()] {
+			return nil, fmt.Errorf("network name %d: duplicate name for %s", i+1, block)
+		}
+		seen[block.String()] = true
+
+		names = append(names, networkName{block: block, name: name})
+	}
+	return names, nil
+}
+
+//Lookup returns the name of the most specific subnet containing the given IP.
+//Addresses which can't be parsed are never named.
+func (n NetworkNames) Lookup(ip string) (string, bool) {
+	if len(n) == 0 {
+		return "", false
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", false
+	}
+
+	for _, entry := range n {
+		if entry.block.Contains(parsed) {
+			return entry.name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNetworkNamesPrecedence ensures the most specific subnet names an IP and
+// that rules in the main config replace rules in the file for the same subnet
+func TestNetworkNamesPrecedence(t *testing.T) {
+	names, err := parseNetworkNames(
+		[]NetworkNameRule{
+			{Subnet: "52.0.0.0/8", Name: "Amazon"},
+			{Subnet: "52.94.0.0/16", Name: "Office VPN"},
+		},
+		[]NetworkNameRule{
+			{Subnet: "52.94.0.0/16", Name: "AWS us-east-1"},
+			{Subnet: "52.94.10.0/24", Name: "AWS us-east-1 GovCloud"},
+			{Subnet: "203.0.113.7", Name: " Partner "},
+			{Subnet: "2600:1f18::/32", Name: "AWS us-east-1 IPv6"},
+		},
+	)
+	assert.Nil(t, err)
+
+	cases := map[string]string{
+		"52.1.2.3":     "Amazon",
+		"52.94.1.1":    "Office VPN",
+		"52.94.10.20":  "AWS us-east-1 GovCloud",
+		"203.0.113.7":  "Partner",
+		"2600:1f18::1": "AWS us-east-1 IPv6",
+	}
+	for ip, expected := range cases {
+		name, ok := names.Lookup(ip)
+		assert.True(t, ok, ip)
+		assert.Equal(t, expected, name, ip)
+	}
+
+	for _, ip := range []string{"203.0.113.8", "10.0.0.1", "not an ip"} {
+		_, ok := names.Lookup(ip)
+		assert.False(t, ok, ip)
+	}
+
+	_, ok := NetworkNames(nil).Lookup("52.1.2.3")
+	assert.False(t, ok, "no names should name nothing")
+}
+
+// TestNetworkNamesValidation ensures malformed rules are rejected
+func TestNetworkNamesValidation(t *testing.T) {
+	invalid := [][]NetworkNameRule{
+		{{Subnet: "52.0.0.0/33", Name: "Amazon"}},
+		{{Subnet: "aws.example.com", Name: "Amazon"}},
+		{{Subnet: "52.0.0.0/8", Name: " "}},
+		{{Subnet: "52.0.0.0/8", Name: "Amazon"}, {Subnet: "52.1.0.0/8", Name: "Also Amazon"}},
+	}
+
+	for _, rules := range invalid {
+		_, err := parseNetworkNames(rules, nil)
+		assert.NotNil(t, err)
+		_, err = parseNetworkNames(nil, rules)
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"net"
+)
+
+//KnownProxies is the set of subnets whose hosts are HTTP proxy servers, even when
+//the connections made to them aren't explicitly tagged as proxied
+type KnownProxies []*net.IPNet
+
+// parseKnownProxies parses each entry as a CIDR block, or as a single IPv4 or IPv6
+// address. A malformed entry is returned as an error so RITA refuses to start.
+func parseKnownProxies(entries []string) (KnownProxies, error) {
+	proxies := make(KnownProxies, 0, len(entries))
+	for _, entry := range entries {
+		block, err := parseSubnet(entry)
+		if err != nil {
+			return nil, fmt.Errorf("proxy %v", err)
+		}
+		proxies = append(proxies, block)
+	}
+	return proxies, nil
+}
+
+//Contains returns true if the given IP falls within any of the known proxy subnets
+func (p KnownProxies) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, block := range p {
+		if block.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
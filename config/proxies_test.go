@@ -0,0 +1,28 @@
+package config
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestKnownProxiesContains ensures proxies are matched by CIDR containment
+func TestKnownProxiesContains(t *testing.T) {
+	proxies, err := parseKnownProxies([]string{"10.1.0.0/16", " 192.168.5.5 ", "2001:db8::1"})
+	assert.Nil(t, err)
+
+	assert.True(t, proxies.Contains(net.ParseIP("10.1.200.3")))
+	assert.False(t, proxies.Contains(net.ParseIP("10.2.0.1")))
+	assert.True(t, proxies.Contains(net.ParseIP("192.168.5.5")), "a bare IP should match only itself")
+	assert.False(t, proxies.Contains(net.ParseIP("192.168.5.6")))
+	assert.True(t, proxies.Contains(net.ParseIP("2001:db8::1")))
+	assert.False(t, proxies.Contains(nil))
+
+	assert.False(t, KnownProxies(nil).Contains(net.ParseIP("10.1.0.1")), "an empty list should match nothing")
+
+	for _, entry := range []string{"10.0.0.0/33", "proxy.example.com", ""} {
+		_, err := parseKnownProxies([]string{entry})
+		assert.NotNil(t, err, entry)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
+	"time"
 
 	"github.com/activecm/mgosec"
 	"github.com/blang/semver"
@@ -13,8 +14,12 @@ import (
 type (
 	//RunningCfg holds configuration options that are parsed at run time
 	RunningCfg struct {
-		MongoDB MongoDBRunningCfg
-		Version semver.Version
+		MongoDB     MongoDBRunningCfg
+		BeaconSNI   BeaconSNIRunningCfg
+		BeaconProxy BeaconProxyRunningCfg
+		Filtering   FilteringRunningCfg
+		Certificate CertificateRunningCfg
+		Version     semver.Version
 	}
 
 	//MongoDBRunningCfg holds parsed information for connecting to MongoDB
@@ -24,6 +29,35 @@ type (
 			TLSConfig *tls.Config
 		}
 	}
+
+	//BeaconSNIRunningCfg holds parsed information for the SNI beaconing analysis module
+	BeaconSNIRunningCfg struct {
+		ThresholdRules ThresholdRules
+		Baselines      BaselineProfiles // known good beaconing of specific destinations
+		NetworkNames   NetworkNames     // friendly names given to the networks of responding IPs
+		ASNs           ASNDatabase      // autonomous systems announcing the networks of responding IPs
+		DomainAges     DomainAges       // registration dates of the domains SNIs belong to
+		Location       *time.Location   // timezone used to bucket connections by hour of the day
+		SensorOffsets  SensorOffsets    // clock offsets of the sensors recording SNI connections
+		Syslog         struct {
+			TLSConfig *tls.Config // used when sending findings to syslog over tls
+		}
+	}
+
+	//BeaconProxyRunningCfg holds parsed information for the proxy beaconing analysis module
+	BeaconProxyRunningCfg struct {
+		KnownProxies KnownProxies // proxy servers whose connections are proxied even when they aren't tagged
+	}
+
+	//FilteringRunningCfg holds parsed address filters
+	FilteringRunningCfg struct {
+		NeverAnalyzeSources SourceFilter
+	}
+
+	//CertificateRunningCfg holds parsed information for the invalid certificate analysis module
+	CertificateRunningCfg struct {
+		AllowList CertAllowList // certificates known to be benign, which aren't flagged as invalid
+	}
 )
 
 // initRunningConfig uses data in the static config initialize
@@ -60,6 +94,226 @@ func initRunningConfig(static *StaticCfg, running *RunningCfg) error {
 	}
 	running.MongoDB.AuthMechanismParsed = authMechanism
 
+	//parse out the per destination connection threshold overrides
+	thresholdRules, err := loadThresholdRules(static.BeaconSNI.ThresholdRulesFile, static.Strobe.ConnectionLimit)
+	if err != nil {
+		fmt.Println("[!] Could not load SNI beacon threshold rules file")
+		return err
+	}
+	running.BeaconSNI.ThresholdRules = thresholdRules
+
+	//parse out the known good beaconing profiles of specific destinations
+	baselines, err := loadBaselineProfiles(static.BeaconSNI.BaselineProfilesFile)
+	if err != nil {
+		fmt.Println("[!] Could not load SNI beacon baseline profiles file")
+		return err
+	}
+	running.BeaconSNI.Baselines = baselines
+
+	//parse the friendly names given to the networks of responding IPs
+	networkNames, err := loadNetworkNames(static.BeaconSNI.NetworkNames, static.BeaconSNI.NetworkNamesFile)
+	if err != nil {
+		fmt.Println("[!] Could not load SNI beacon network names")
+		return err
+	}
+	running.BeaconSNI.NetworkNames = networkNames
+
+	//parse the autonomous systems announcing the networks of responding IPs
+	asns, err := loadASNDatabase(static.BeaconSNI.ASNDatabaseFiles)
+	if err != nil {
+		fmt.Println("[!] Could not load SNI beacon ASN database")
+		return err
+	}
+	if len(asns) == 0 && (len(static.BeaconSNI.BoostASNs) > 0 || len(static.BeaconSNI.FilterASNs) > 0) {
+		fmt.Println("[!] SNI beacon BoostASNs and FilterASNs need an ASN database")
+		return fmt.Errorf("no ASN database was loaded from ASNDatabaseFiles %v", static.BeaconSNI.ASNDatabaseFiles)
+	}
+	running.BeaconSNI.ASNs = asns
+
+	//parse the registration dates of the domains SNIs belong to
+	domainAges, err := loadDomainAges(static.BeaconSNI.DomainAgeFiles)
+	if err != nil {
+		fmt.Println("[!] Could not load SNI beacon domain ages")
+		return err
+	}
+	if len(domainAges) == 0 && static.BeaconSNI.YoungDomainBoost > 0 {
+		fmt.Println("[!] SNI beacon YoungDomainBoost needs domain ages")
+		return fmt.Errorf("no domain ages were loaded from DomainAgeFiles %v", static.BeaconSNI.DomainAgeFiles)
+	}
+	if static.BeaconSNI.YoungDomainDays < 1 {
+		fmt.Println("[!] Invalid SNI beacon YoungDomainDays")
+		return fmt.Errorf("YoungDomainDays must be at least 1, not %d", static.BeaconSNI.YoungDomainDays)
+	}
+	running.BeaconSNI.DomainAges = domainAges
+
+	//parse the timezone used to bucket SNI connections by hour of the day
+	location, err := time.LoadLocation(static.BeaconSNI.Timezone)
+	if err != nil {
+		fmt.Println("[!] Could not load SNI beacon timezone")
+		return err
+	}
+	running.BeaconSNI.Location = location
+
+	//parse the clock offsets used to line up the timestamps of each sensor
+	sensorOffsets, err := parseSensorOffsets(static.BeaconSNI.SensorField, static.BeaconSNI.SensorClockOffsets)
+	if err != nil {
+		fmt.Println("[!] Invalid SNI beacon SensorClockOffsets")
+		return err
+	}
+	running.BeaconSNI.SensorOffsets = sensorOffsets
+
+	//parse the syslog endpoint SNI beacon findings are sent to
+	syslogTLS, err := parseSyslog(static.BeaconSNI.Syslog)
+	if err != nil {
+		fmt.Println("[!] Invalid SNI beacon Syslog settings")
+		return err
+	}
+	running.BeaconSNI.Syslog.TLSConfig = syslogTLS
+
+	//make sure the default SNI beacon scoring model can combine its features
+	if err := validateFeatureWeights(static.BeaconSNI.FeatureWeights); err != nil {
+		fmt.Println("[!] Invalid SNI beacon FeatureWeights")
+		return err
+	}
+
+	//make sure SNI beacon findings can be written to the configured database
+	if err := validateSQL(static.BeaconSNI.SQL); err != nil {
+		fmt.Println("[!] Invalid SNI beacon SQL settings")
+		return err
+	}
+
+	//make sure a chunk size can be recommended for rolling databases
+	if err := validateChunkTuning(static.ChunkTuning); err != nil {
+		fmt.Println("[!] Invalid ChunkTuning settings")
+		return err
+	}
+
+	//make sure page load bursts can be told apart from SNI beacons
+	if err := validateBrowsingBursts(static.BeaconSNI.BrowsingBursts); err != nil {
+		fmt.Println("[!] Invalid SNI beacon BrowsingBursts settings")
+		return err
+	}
+
+	//make sure SNI beacon findings can be posted to the configured webhook
+	if err := validateWebhook(static.BeaconSNI.Webhook); err != nil {
+		fmt.Println("[!] Invalid SNI beacon Webhook settings")
+		return err
+	}
+
+	//make sure the beacon analysis knows how much detail to log
+	if err := validateAnalysisVerbosity(static.Log.AnalysisVerbosity); err != nil {
+		fmt.Println("[!] Invalid LogConfig AnalysisVerbosity")
+		return err
+	}
+
+	//make sure the Zeek intel export knows which indicators to write
+	if err := validateZeekIntel(static.BeaconSNI.ZeekIntel); err != nil {
+		fmt.Println("[!] Invalid SNI beacon ZeekIntel settings")
+		return err
+	}
+
+	//make sure the beacon dissectors know how to handle pairs with duplicate documents
+	if err := validateDuplicateDocuments(static.BeaconSNI.DuplicateDocuments); err != nil {
+		fmt.Println("[!] Invalid SNI beacon DuplicateDocuments")
+		return err
+	}
+	if err := validateDuplicateDocuments(static.BeaconProxy.DuplicateDocuments); err != nil {
+		fmt.Println("[!] Invalid proxy beacon DuplicateDocuments")
+		return err
+	}
+
+	//make sure the SNI beacon scoring model knows how to combine the feature scores
+	if err := validateScoreCombination(static.BeaconSNI.ScoreCombination); err != nil {
+		fmt.Println("[!] Invalid SNI beacon ScoreCombination")
+		return err
+	}
+
+	//make sure reverse DNS lookups can be paced and timed out
+	if static.BeaconSNI.ReverseDNS.Enabled && (static.BeaconSNI.ReverseDNS.Timeout <= 0 || static.BeaconSNI.ReverseDNS.MaxLookupsPerSecond <= 0) {
+		fmt.Println("[!] Invalid SNI beacon ReverseDNS settings")
+		return fmt.Errorf("reverse dns timeout and max lookups per second must be above 0, got %d and %d",
+			static.BeaconSNI.ReverseDNS.Timeout, static.BeaconSNI.ReverseDNS.MaxLookupsPerSecond)
+	}
+
+	//make sure the periodogram has bins to count connections into
+	if static.BeaconSNI.Periodogram.Enabled && (static.BeaconSNI.Periodogram.BinSeconds <= 0 || static.BeaconSNI.Periodogram.MaxBins < 8) {
+		fmt.Println("[!] Invalid SNI beacon Periodogram settings")
+		return fmt.Errorf("periodogram bin seconds must be above 0 and max bins at least 8, got %d and %d",
+			static.BeaconSNI.Periodogram.BinSeconds, static.BeaconSNI.Periodogram.MaxBins)
+	}
+
+	//make sure the SNI beacon connection rate can be turned into a connection threshold
+	if static.BeaconSNI.ConnectionRate < 0 {
+		fmt.Println("[!] SNI beacon ConnectionRate must not be negative")
+		return fmt.Errorf("connection rate %v is below 0", static.BeaconSNI.ConnectionRate)
+	}
+
+	//make sure trimming leaves some SNI beacon intervals in the middle untouched
+	if static.BeaconSNI.DeltaTrimPercent < 0 || static.BeaconSNI.DeltaTrimPercent >= 50 {
+		fmt.Println("[!] SNI beacon DeltaTrimPercent must be at least 0 and below 50")
+		return fmt.Errorf("delta trim percent %v is outside [0, 50)", static.BeaconSNI.DeltaTrimPercent)
+	}
+
+	//the fixed payload share is a fraction of the connections
+	if static.BeaconSNI.MinBytesModeFraction < 0 || static.BeaconSNI.MinBytesModeFraction > 1 {
+		fmt.Println("[!] SNI beacon MinBytesModeFraction must be between 0 and 1")
+		return fmt.Errorf("minimum bytes mode fraction %v is outside [0, 1]", static.BeaconSNI.MinBytesModeFraction)
+	}
+
+	//make sure the SNI beacon distinct day requirement can be met
+	if static.BeaconSNI.MinDistinctDays < 0 {
+		fmt.Println("[!] SNI beacon MinDistinctDays must not be negative")
+		return fmt.Errorf("minimum distinct days %d is below 0", static.BeaconSNI.MinDistinctDays)
+	}
+
+	//make sure the analysis time window isn't empty
+	if static.Filtering.AnalysisEnd > 0 && static.Filtering.AnalysisStart > static.Filtering.AnalysisEnd {
+		fmt.Println("[!] Filtering AnalysisStart must not be after AnalysisEnd")
+		return fmt.Errorf("analysis window starts at %d, after it ends at %d", static.Filtering.AnalysisStart, static.Filtering.AnalysisEnd)
+	}
+
+	//parse out the sources which are never analyzed
+	neverAnalyzeSources, err := parseSourceFilter(static.Filtering.NeverAnalyzeSources)
+	if err != nil {
+		fmt.Println("[!] Invalid Filtering NeverAnalyzeSources entry")
+		return err
+	}
+	running.Filtering.NeverAnalyzeSources = neverAnalyzeSources
+
+	//parse out the proxy servers whose connections are proxied even when they aren't tagged
+	knownProxies, err := parseKnownProxies(static.BeaconProxy.KnownProxies)
+	if err != nil {
+		fmt.Println("[!] Invalid BeaconProxy KnownProxies entry")
+		return err
+	}
+	running.BeaconProxy.KnownProxies = knownProxies
+
+	//compile the patterns of the certificates which aren't flagged as invalid
+	certAllowList, err := ParseCertAllowList(static.Certificate.AllowList)
+	if err != nil {
+		fmt.Println("[!] Invalid Certificate AllowList rule")
+		return err
+	}
+	running.Certificate.AllowList = certAllowList
+
+	//make sure the normal range of certificate chain depths is a range
+	if min, max := static.Certificate.MinChainDepth, static.Certificate.MaxChainDepth; min < 0 || max < 0 || (max > 0 && max < min) {
+		fmt.Println("[!] Invalid Certificate MinChainDepth or MaxChainDepth")
+		return fmt.Errorf("certificate chain depths must not be negative and MaxChainDepth (%d) must be at least MinChainDepth (%d)", max, min)
+	}
+
+	//make sure the ATT&CK tag rules are usable
+	if err := validateAttackTagRules(static.AttackTags.Rules); err != nil {
+		fmt.Println("[!] Invalid ATT&CK tag rule")
+		return err
+	}
+
+	//make sure every score bucket covers some range of scores
+	if err := validateScoreBuckets(static.ScoreBuckets); err != nil {
+		fmt.Println("[!] Invalid score bucket thresholds")
+		return err
+	}
+
 	running.Version, err = semver.ParseTolerant(static.Version)
 	if err != nil {
 		fmt.Println("\t[!] Version error: please ensure that you cloned the git repo and are using make to build.")
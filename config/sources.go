@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+//SourceFilter is the set of subnets whose hosts are never analyzed as the source of a connection
+type SourceFilter []*net.IPNet
+
+// parseSourceFilter parses each entry as a CIDR block, or as a single IPv4 or IPv6
+// address. Unlike util.ParseSubnets, a malformed entry is returned as an error so
+// RITA refuses to start rather than exiting from deep inside the parser.
+func parseSourceFilter(entries []string) (SourceFilter, error) {
+	filter := make(SourceFilter, 0, len(entries))
+	for _, entry := range entries {
+		block, err := parseSubnet(entry)
+		if err != nil {
+			return nil, fmt.Errorf("source %v", err)
+		}
+		filter = append(filter, block)
+	}
+	return filter, nil
+}
+
+// parseSubnet parses entry as a CIDR block, or as a single IPv4 or IPv6 address
+// which is treated as a /32 or /128 block
+func parseSubnet(entry string) (*net.IPNet, error) {
+	entry = strings.TrimSpace(entry)
+
+	if !strings.Contains(entry, "/") {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("%q is neither an IP address nor a CIDR block", entry)
+		}
+		bits := 8 * net.IPv6len
+		if ipv4 := ip.To4(); ipv4 != nil {
+			ip, bits = ipv4, 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, block, err := net.ParseCIDR(entry)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a valid CIDR block: %v", entry, err)
+	}
+	return block, nil
+}
+
+//Excludes returns true if the given source IP falls within any of the filtered subnets.
+//Addresses which can't be parsed are never excluded.
+func (f SourceFilter) Excludes(ip string) bool {
+	if len(f) == 0 {
+		return false
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, block := range f {
+		if block.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
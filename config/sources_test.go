@@ -0,0 +1,32 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSourceFilterExcludes ensures sources are matched by CIDR containment
+func TestSourceFilterExcludes(t *testing.T) {
+	filter, err := parseSourceFilter([]string{"10.1.0.0/16", "192.168.5.5", "fd00::/8", " 2001:db8::1 "})
+	assert.Nil(t, err)
+
+	assert.True(t, filter.Excludes("10.1.200.3"))
+	assert.False(t, filter.Excludes("10.2.0.1"))
+	assert.True(t, filter.Excludes("192.168.5.5"), "a bare IP should match only itself")
+	assert.False(t, filter.Excludes("192.168.5.6"))
+	assert.True(t, filter.Excludes("fd12::1"))
+	assert.True(t, filter.Excludes("2001:db8::1"))
+	assert.False(t, filter.Excludes("2001:db8::2"))
+	assert.False(t, filter.Excludes("not an ip"))
+
+	assert.False(t, SourceFilter(nil).Excludes("10.1.0.1"), "an empty filter should exclude nothing")
+}
+
+// TestSourceFilterValidation ensures malformed entries are rejected
+func TestSourceFilterValidation(t *testing.T) {
+	for _, entry := range []string{"10.0.0.0/33", "scanner.example.com", "", "10.0.0"} {
+		_, err := parseSourceFilter([]string{entry})
+		assert.NotNil(t, err, entry)
+	}
+}
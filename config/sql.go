@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	//SQLPostgres selects the PostgreSQL driver registered by github.com/lib/pq
+	SQLPostgres = "postgres"
+	//SQLMySQL selects the MySQL driver registered by github.com/go-sql-driver/mysql
+	SQLMySQL = "mysql"
+	//SQLSQLite selects the SQLite driver registered by github.com/mattn/go-sqlite3
+	SQLSQLite = "sqlite3"
+)
+
+// validateSQL checks the settings used to write SNI beacon findings to a relational database
+func validateSQL(cfg SQLStaticCfg) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.Driver != SQLPostgres && cfg.Driver != SQLMySQL && cfg.Driver != SQLSQLite {
+		return fmt.Errorf("SQL driver must be %s, %s, or %s, not %q", SQLPostgres, SQLMySQL, SQLSQLite, cfg.Driver)
+	}
+	if strings.TrimSpace(cfg.DSN) == "" {
+		return fmt.Errorf("SQL DSN must not be empty")
+	}
+	if cfg.BatchSize < 1 {
+		return fmt.Errorf("SQL batch size must be at least 1, not %d", cfg.BatchSize)
+	}
+	if cfg.BufferSize < cfg.BatchSize {
+		return fmt.Errorf("SQL buffer size (%d) must be at least the batch size (%d)", cfg.BufferSize, cfg.BatchSize)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidateSQL ensures unusable database settings are rejected
+func TestValidateSQL(t *testing.T) {
+	assert.Nil(t, validateSQL(SQLStaticCfg{}), "disabled SQL output should not be checked")
+
+	valid := SQLStaticCfg{Enabled: true, Driver: SQLPostgres, DSN: "postgres://rita@localhost/rita", BatchSize: 100, BufferSize: 10000}
+	assert.Nil(t, validateSQL(valid))
+
+	invalid := []func(*SQLStaticCfg){
+		func(cfg *SQLStaticCfg) { cfg.Driver = "oracle" },
+		func(cfg *SQLStaticCfg) { cfg.DSN = " " },
+		func(cfg *SQLStaticCfg) { cfg.BatchSize = 0 },
+		func(cfg *SQLStaticCfg) { cfg.BufferSize = 10 },
+	}
+	for i, change := range invalid {
+		cfg := valid
+		change(&cfg)
+		assert.NotNil(t, validateSQL(cfg), "case %d should be rejected", i)
+	}
+}
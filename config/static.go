@@ -13,31 +13,42 @@ import (
 type (
 	//StaticCfg is the container for other static config sections
 	StaticCfg struct {
-		UserConfig   UserCfgStaticCfg     `yaml:"UserConfig"`
-		MongoDB      MongoDBStaticCfg     `yaml:"MongoDB"`
-		Rolling      RollingStaticCfg     `yaml:"Rolling"`
-		Log          LogStaticCfg         `yaml:"LogConfig"`
-		Blacklisted  BlacklistedStaticCfg `yaml:"BlackListed"`
-		Beacon       BeaconStaticCfg      `yaml:"Beacon"`
-		BeaconFQDN   BeaconFQDNStaticCfg  `yaml:"BeaconFQDN"`
-		BeaconProxy  BeaconProxyStaticCfg `yaml:"BeaconProxy"`
-		BeaconSNI    BeaconSNIStaticCfg   `yaml:"BeaconSNI"`
-		DNS          DNSStaticCfg         `yaml:"DNS"`
-		UserAgent    UserAgentStaticCfg   `yaml:"UserAgent"`
-		Bro          BroStaticCfg         `yaml:"Bro"` // kept in for MetaDB backwards compatibility
-		Filtering    FilteringStaticCfg   `yaml:"Filtering"`
-		Strobe       StrobeStaticCfg      `yaml:"Strobe"`
-		Version      string
-		ExactVersion string
+		UserConfig    UserCfgStaticCfg       `yaml:"UserConfig"`
+		MongoDB       MongoDBStaticCfg       `yaml:"MongoDB"`
+		Rolling       RollingStaticCfg       `yaml:"Rolling"`
+		ChunkTuning   ChunkTuningStaticCfg   `yaml:"ChunkTuning"`
+		Log           LogStaticCfg           `yaml:"LogConfig"`
+		Blacklisted   BlacklistedStaticCfg   `yaml:"BlackListed"`
+		Beacon        BeaconStaticCfg        `yaml:"Beacon"`
+		BeaconFQDN    BeaconFQDNStaticCfg    `yaml:"BeaconFQDN"`
+		BeaconProxy   BeaconProxyStaticCfg   `yaml:"BeaconProxy"`
+		BeaconSNI     BeaconSNIStaticCfg     `yaml:"BeaconSNI"`
+		MergedBeacon  MergedBeaconStaticCfg  `yaml:"MergedBeacon"`
+		DedupedBeacon DedupedBeaconStaticCfg `yaml:"DedupedBeacon"`
+		AttackTags    AttackTagsStaticCfg    `yaml:"AttackTags"`
+		ScoreBuckets  ScoreBucketsStaticCfg  `yaml:"ScoreBuckets"`
+		Certificate   CertificateStaticCfg   `yaml:"Certificate"`
+		DNS           DNSStaticCfg           `yaml:"DNS"`
+		UserAgent     UserAgentStaticCfg     `yaml:"UserAgent"`
+		Bro           BroStaticCfg           `yaml:"Bro"` // kept in for MetaDB backwards compatibility
+		Filtering     FilteringStaticCfg     `yaml:"Filtering"`
+		Strobe        StrobeStaticCfg        `yaml:"Strobe"`
+		Version       string
+		ExactVersion  string
 	}
 
 	//MongoDBStaticCfg contains the means for connecting to MongoDB
 	MongoDBStaticCfg struct {
-		ConnectionString string        `yaml:"ConnectionString" default:"mongodb://localhost:27017"`
-		AuthMechanism    string        `yaml:"AuthenticationMechanism" default:""`
-		SocketTimeout    time.Duration `yaml:"SocketTimeout" default:"2"`
-		TLS              TLSStaticCfg  `yaml:"TLS"`
-		MetaDB           string        `yaml:"MetaDB" default:"MetaDatabase"`
+		ConnectionString     string        `yaml:"ConnectionString" default:"mongodb://localhost:27017"`
+		AuthMechanism        string        `yaml:"AuthenticationMechanism" default:""`
+		SocketTimeout        time.Duration `yaml:"SocketTimeout" default:"2"`
+		FlushRetries         int           `yaml:"FlushRetries" default:"3"`
+		FlushBackoff         int           `yaml:"FlushBackoff" default:"500"`
+		BackgroundIndexing   bool          `yaml:"BackgroundIndexing" default:"false"`
+		MaxConcurrentQueries int           `yaml:"MaxConcurrentQueries" default:"0"`
+		MaxConnections       int           `yaml:"MaxConnections" default:"0"`
+		TLS                  TLSStaticCfg  `yaml:"TLS"`
+		MetaDB               string        `yaml:"MetaDB" default:"MetaDatabase"`
 	}
 
 	//TLSStaticCfg contains the means for connecting to MongoDB over TLS
@@ -49,10 +60,13 @@ type (
 
 	//LogStaticCfg contains the configuration for logging
 	LogStaticCfg struct {
-		LogLevel    int    `yaml:"LogLevel" default:"2"`
-		RitaLogPath string `yaml:"RitaLogPath" default:"/var/lib/rita/logs"`
-		LogToFile   bool   `yaml:"LogToFile" default:"true"`
-		LogToDB     bool   `yaml:"LogToDB" default:"true"`
+		LogLevel          int    `yaml:"LogLevel" default:"2"`
+		RitaLogPath       string `yaml:"RitaLogPath" default:"/var/lib/rita/logs"`
+		LogToFile         bool   `yaml:"LogToFile" default:"true"`
+		LogToDB           bool   `yaml:"LogToDB" default:"true"`
+		SkipProgressCount bool   `yaml:"SkipProgressCount" default:"false"`
+		AnalysisVerbosity int    `yaml:"AnalysisVerbosity" default:"0"`
+		ProfileFile       string `yaml:"ProfileFile" default:""`
 	}
 
 	//BroStaticCfg controls the file parser
@@ -68,6 +82,13 @@ type (
 		TotalChunks   int
 	}
 
+	//ChunkTuningStaticCfg controls the chunk size recommended for rolling databases
+	ChunkTuningStaticCfg struct {
+		CandidateHours         []int   `yaml:"CandidateHours" default:"[1, 2, 3, 4, 6, 8, 12, 24]"`
+		MaxConnectionsPerChunk int64   `yaml:"MaxConnectionsPerChunk" default:"10000000"`
+		SplitTolerance         float64 `yaml:"SplitTolerance" default:"0.05"`
+	}
+
 	//UserCfgStaticCfg contains
 	UserCfgStaticCfg struct {
 		UpdateCheckFrequency int `yaml:"UpdateCheckFrequency" default:"14"`
@@ -100,14 +121,199 @@ type (
 
 	//BeaconProxyStaticCfg is used to control the proxy beaconing analysis module
 	BeaconProxyStaticCfg struct {
-		Enabled                 bool `yaml:"Enabled" default:"true"`
-		DefaultConnectionThresh int  `yaml:"DefaultConnectionThresh" default:"20"`
+		Enabled                 bool     `yaml:"Enabled" default:"true"`
+		DefaultConnectionThresh int      `yaml:"DefaultConnectionThresh" default:"20"`
+		GroupByDomain           bool     `yaml:"GroupByDomain" default:"false"`
+		ByteRatios              bool     `yaml:"ByteRatios" default:"false"`
+		ExternalOnly            bool     `yaml:"ExternalOnly" default:"false"`
+		InternalDomains         []string `yaml:"InternalDomains" default:"[]"`
+		DedupWindow             int      `yaml:"DedupWindow" default:"0"`
+		DuplicateDocuments      string   `yaml:"DuplicateDocuments" default:"first"`
+		KnownProxies            []string `yaml:"KnownProxies" default:"[]"`
 	}
 
 	//BeaconSNIStaticCfg is used to control the SNI beaconing analysis module
 	BeaconSNIStaticCfg struct {
-		Enabled                 bool `yaml:"Enabled" default:"true"`
-		DefaultConnectionThresh int  `yaml:"DefaultConnectionThresh" default:"20"`
+		Enabled                 bool                      `yaml:"Enabled" default:"true"`
+		DefaultConnectionThresh int                       `yaml:"DefaultConnectionThresh" default:"20"`
+		ConnectionRate          float64                   `yaml:"ConnectionRate" default:"0"` // connections per hour
+		ThresholdRulesFile      string                    `yaml:"ThresholdRulesFile" default:""`
+		BaselineProfilesFile    string                    `yaml:"BaselineProfilesFile" default:""`
+		NetworkNames            []NetworkNameRule         `yaml:"NetworkNames" default:"[]"`
+		NetworkNamesFile        string                    `yaml:"NetworkNamesFile" default:""`
+		ASNDatabaseFiles        []string                  `yaml:"ASNDatabaseFiles" default:"[]"`
+		BoostASNs               []int64                   `yaml:"BoostASNs" default:"[]"`
+		FilterASNs              []int64                   `yaml:"FilterASNs" default:"[]"`
+		ASNBoost                float64                   `yaml:"ASNBoost" default:"0"`
+		DomainAgeFiles          []string                  `yaml:"DomainAgeFiles" default:"[]"`
+		YoungDomainDays         int                       `yaml:"YoungDomainDays" default:"30"`
+		YoungDomainBoost        float64                   `yaml:"YoungDomainBoost" default:"0"`
+		AutoScaleDissectors     bool                      `yaml:"AutoScaleDissectors" default:"false"`
+		MaxDissectors           int                       `yaml:"MaxDissectors" default:"0"`
+		MaxWorkerRestarts       int                       `yaml:"MaxWorkerRestarts" default:"0"`
+		BurstConcentration      float64                   `yaml:"BurstConcentration" default:"0"`
+		DecayHalfLifeDays       float64                   `yaml:"DecayHalfLifeDays" default:"0"`
+		TimestampResolution     string                    `yaml:"TimestampResolution" default:"s"`
+		NormalizeTimestamps     bool                      `yaml:"NormalizeTimestamps" default:"false"`
+		TimestampFieldUnits     []string                  `yaml:"TimestampFieldUnits" default:"[]"`
+		FirstContact            bool                      `yaml:"FirstContact" default:"false"`
+		CheckpointInterval      int                       `yaml:"CheckpointInterval" default:"0"`
+		DuplicateDocuments      string                    `yaml:"DuplicateDocuments" default:"first"`
+		DurationScoring         bool                      `yaml:"DurationScoring" default:"false"`
+		ScoringModel            string                    `yaml:"ScoringModel" default:"default"`
+		ScoreCombination        string                    `yaml:"ScoreCombination" default:"mean"`
+		FeatureWeights          map[string]float64        `yaml:"FeatureWeights"`
+		ScoreFeatures           bool                      `yaml:"ScoreFeatures" default:"false"`
+		PersistFeatures         bool                      `yaml:"PersistFeatures" default:"false"`
+		ParallelWithProxy       bool                      `yaml:"ParallelWithProxy" default:"false"`
+		MaxResponders           int                       `yaml:"MaxResponders" default:"1000"`
+		MinScoreToStore         float64                   `yaml:"MinScoreToStore" default:"0"`
+		ExportMinScore          float64                   `yaml:"ExportMinScore" default:"0.8"`
+		MaxByteSamples          int                       `yaml:"MaxByteSamples" default:"0"`
+		DataSizeBucketWidth     int                       `yaml:"DataSizeBucketWidth" default:"1"`
+		MinBytesModeFraction    float64                   `yaml:"MinBytesModeFraction" default:"0"`
+		RarityBoost             float64                   `yaml:"RarityBoost" default:"0"`
+		CountTrendBoost         float64                   `yaml:"CountTrendBoost" default:"0"`
+		MaxTimingCV             float64                   `yaml:"MaxTimingCV" default:"0"`
+		DeltaTrimPercent        float64                   `yaml:"DeltaTrimPercent" default:"0"`
+		MinDistinctDays         int                       `yaml:"MinDistinctDays" default:"0"`
+		NewBeaconAlerts         bool                      `yaml:"NewBeaconAlerts" default:"false"`
+		SkipStrobeFilter        bool                      `yaml:"SkipStrobeFilter" default:"false"`
+		AuditExamined           bool                      `yaml:"AuditExamined" default:"false"`
+		ExaminedRetentionDays   int                       `yaml:"ExaminedRetentionDays" default:"30"`
+		HourHistogram           bool                      `yaml:"HourHistogram" default:"false"`
+		Timezone                string                    `yaml:"Timezone" default:"UTC"`
+		ScoreOnly               bool                      `yaml:"ScoreOnly" default:"false"`
+		ResultSuffix            string                    `yaml:"ResultSuffix" default:""`
+		MaxRuntime              int                       `yaml:"MaxRuntime" default:"0"`
+		CertCorrelation         bool                      `yaml:"CertCorrelation" default:"false"`
+		ExternalRespondersOnly  bool                      `yaml:"ExternalRespondersOnly" default:"false"`
+		DropSpecialResponders   bool                      `yaml:"DropSpecialResponders" default:"false"`
+		CountSmoothingWindow    int                       `yaml:"CountSmoothingWindow" default:"0"`
+		DiffMinScoreChange      float64                   `yaml:"DiffMinScoreChange" default:"0.1"`
+		NATClientField          string                    `yaml:"NATClientField" default:""`
+		SensorField             string                    `yaml:"SensorField" default:""`
+		SensorClockOffsets      []SensorClockOffset       `yaml:"SensorClockOffsets" default:"[]"`
+		Fields                  SNIConnFieldsStaticCfg    `yaml:"Fields"`
+		Syslog                  SyslogStaticCfg           `yaml:"Syslog"`
+		SQL                     SQLStaticCfg              `yaml:"SQL"`
+		Webhook                 WebhookStaticCfg          `yaml:"Webhook"`
+		AlternatingPairs        AlternatingPairsStaticCfg `yaml:"AlternatingPairs"`
+		ZeekIntel               ZeekIntelStaticCfg        `yaml:"ZeekIntel"`
+		ReverseDNS              ReverseDNSStaticCfg       `yaml:"ReverseDNS"`
+		Periodogram             PeriodogramStaticCfg      `yaml:"Periodogram"`
+		BrowsingBursts          BrowsingBurstsStaticCfg   `yaml:"BrowsingBursts"`
+	}
+
+	//SNIConnFieldsStaticCfg overrides the SNIconn field paths read by the SNI beaconing analysis
+	SNIConnFieldsStaticCfg struct {
+		TimestampFields  []string `yaml:"TimestampFields" default:"[]"`
+		BytesFields      []string `yaml:"BytesFields" default:"[]"`
+		CountFields      []string `yaml:"CountFields" default:"[]"`
+		TotalBytesFields []string `yaml:"TotalBytesFields" default:"[]"`
+		DstIPsFields     []string `yaml:"DstIPsFields" default:"[]"`
+	}
+
+	//SyslogStaticCfg is used to send SNI beacon findings to a syslog endpoint
+	SyslogStaticCfg struct {
+		Enabled            bool    `yaml:"Enabled" default:"false"`
+		Network            string  `yaml:"Network" default:"udp"`
+		Address            string  `yaml:"Address" default:""`
+		CAFile             string  `yaml:"CAFile" default:""`
+		Facility           int     `yaml:"Facility" default:"16"`
+		MinScore           float64 `yaml:"MinScore" default:"0"`
+		BufferSize         int     `yaml:"BufferSize" default:"1000"`
+		MaxAlertsPerSource int     `yaml:"MaxAlertsPerSource" default:"0"`
+	}
+
+	//SQLStaticCfg is used to write SNI beacon findings to a relational database
+	SQLStaticCfg struct {
+		Enabled    bool    `yaml:"Enabled" default:"false"`
+		Driver     string  `yaml:"Driver" default:"postgres"`
+		DSN        string  `yaml:"DSN" default:""`
+		MinScore   float64 `yaml:"MinScore" default:"0"`
+		BatchSize  int     `yaml:"BatchSize" default:"100"`
+		BufferSize int     `yaml:"BufferSize" default:"10000"`
+	}
+
+	//BrowsingBurstsStaticCfg is used to tell the bursts of connections made while loading web pages apart from beacons
+	BrowsingBurstsStaticCfg struct {
+		MinSpacing           float64 `yaml:"MinSpacing" default:"0"` // seconds
+		MaxClusteredFraction float64 `yaml:"MaxClusteredFraction" default:"0.8"`
+		Action               string  `yaml:"Action" default:"filter"`
+	}
+
+	//WebhookStaticCfg is used to POST SNI beacon findings to a webhook as JSON
+	WebhookStaticCfg struct {
+		Enabled            bool    `yaml:"Enabled" default:"false"`
+		URL                string  `yaml:"URL" default:""`
+		Authorization      string  `yaml:"Authorization" default:""`
+		MinScore           float64 `yaml:"MinScore" default:"0.8"`
+		Timeout            int     `yaml:"Timeout" default:"10"`
+		BufferSize         int     `yaml:"BufferSize" default:"1000"`
+		MaxAlertsPerSource int     `yaml:"MaxAlertsPerSource" default:"0"`
+	}
+
+	//AlternatingPairsStaticCfg is used to find sources alternating between two SNIs on a schedule
+	AlternatingPairsStaticCfg struct {
+		Enabled         bool    `yaml:"Enabled" default:"false"`
+		MinScore        float64 `yaml:"MinScore" default:"0.8"`
+		MaxDestinations int     `yaml:"MaxDestinations" default:"50"`
+	}
+
+	//ZeekIntelStaticCfg is used to export SNI beacons as Zeek intel framework entries
+	ZeekIntelStaticCfg struct {
+		Indicators string `yaml:"Indicators" default:"both"`
+		Source     string `yaml:"Source" default:"RITA"`
+	}
+
+	//ReverseDNSStaticCfg is used to annotate the external responders of SNI beacons with their PTR records
+	ReverseDNSStaticCfg struct {
+		Enabled             bool `yaml:"Enabled" default:"false"`
+		Timeout             int  `yaml:"Timeout" default:"2000"` // milliseconds
+		MaxLookupsPerSecond int  `yaml:"MaxLookupsPerSecond" default:"50"`
+	}
+
+	//PeriodogramStaticCfg is used to score SNI beacons on the strongest period in their connections
+	PeriodogramStaticCfg struct {
+		Enabled    bool `yaml:"Enabled" default:"false"`
+		BinSeconds int  `yaml:"BinSeconds" default:"60"`
+		MaxBins    int  `yaml:"MaxBins" default:"4096"`
+	}
+
+	//MergedBeaconStaticCfg is used to control merging SNI and proxy beacons into a single view
+	MergedBeaconStaticCfg struct {
+		Enabled bool `yaml:"Enabled" default:"false"`
+	}
+
+	//DedupedBeaconStaticCfg is used to control deduplicating SNI and FQDN beacons into a single view
+	DedupedBeaconStaticCfg struct {
+		Enabled bool `yaml:"Enabled" default:"false"`
+	}
+
+	//AttackTagsStaticCfg is used to tag beacons with MITRE ATT&CK technique ids
+	AttackTagsStaticCfg struct {
+		Rules AttackTagRules `yaml:"Rules" default:"[]"`
+	}
+
+	//ScoreBucketsStaticCfg is used to label beacon scores with severity buckets. Each
+	//threshold is the lowest score in its bucket, and lower scores are labeled low.
+	ScoreBucketsStaticCfg struct {
+		Enabled  bool    `yaml:"Enabled" default:"false"`
+		Medium   float64 `yaml:"Medium" default:"0.5"`
+		High     float64 `yaml:"High" default:"0.7"`
+		Critical float64 `yaml:"Critical" default:"0.9"`
+	}
+
+	//CertificateStaticCfg is used to control the invalid certificate analysis module
+	CertificateStaticCfg struct {
+		SNIMismatch   bool            `yaml:"SNIMismatch" default:"false"`
+		MinCertAge    int             `yaml:"MinCertAge" default:"0"`   // hours
+		ExpiryWindow  int             `yaml:"ExpiryWindow" default:"0"` // hours
+		GroupByIssuer bool            `yaml:"GroupByIssuer" default:"false"`
+		AllowList     []CertAllowRule `yaml:"AllowList" default:"[]"`
+		MinChainDepth int             `yaml:"MinChainDepth" default:"0"`
+		MaxChainDepth int             `yaml:"MaxChainDepth" default:"0"`
 	}
 
 	//DNSStaticCfg is used to control the DNS analysis module
@@ -128,6 +334,9 @@ type (
 		AlwaysIncludeDomain      []string `yaml:"AlwaysIncludeDomain" default:"[]"`
 		NeverIncludeDomain       []string `yaml:"NeverIncludeDomain" default:"[]"`
 		FilterExternalToInternal bool     `yaml:"FilterExternalToInternal" default:"true"`
+		AnalysisStart            int64    `yaml:"AnalysisStart" default:"0"`
+		AnalysisEnd              int64    `yaml:"AnalysisEnd" default:"0"`
+		NeverAnalyzeSources      []string `yaml:"NeverAnalyzeSources" default:"[]"`
 	}
 
 	//StrobeStaticCfg controls the maximum number of connections between any two given hosts
@@ -136,6 +345,17 @@ type (
 	}
 )
 
+const (
+	//SecondResolution analyzes connection timestamps as whole seconds
+	SecondResolution = "s"
+	//MillisecondResolution analyzes connection timestamps as whole milliseconds
+	MillisecondResolution = "ms"
+	//MicrosecondResolution marks an SNIconn timestamp field as recorded in microseconds
+	MicrosecondResolution = "us"
+	//AutoResolution detects the resolution of an SNIconn timestamp field from its values
+	AutoResolution = "auto"
+)
+
 // readStaticConfigFile attempts to read the contents of the
 // given cfgPath file path (e.g. /etc/rita/config.yaml)
 func readStaticConfigFile(cfgPath string) ([]byte, error) {
@@ -177,6 +397,27 @@ func parseStaticConfig(cfgFile []byte, config *StaticCfg) error {
 
 	// clean all filepaths
 	config.Log.RitaLogPath = filepath.Clean(config.Log.RitaLogPath)
+	if config.Log.ProfileFile != "" {
+		config.Log.ProfileFile = filepath.Clean(config.Log.ProfileFile)
+	}
+	if config.BeaconSNI.ThresholdRulesFile != "" {
+		config.BeaconSNI.ThresholdRulesFile = filepath.Clean(config.BeaconSNI.ThresholdRulesFile)
+	}
+	if config.BeaconSNI.BaselineProfilesFile != "" {
+		config.BeaconSNI.BaselineProfilesFile = filepath.Clean(config.BeaconSNI.BaselineProfilesFile)
+	}
+	if config.BeaconSNI.NetworkNamesFile != "" {
+		config.BeaconSNI.NetworkNamesFile = filepath.Clean(config.BeaconSNI.NetworkNamesFile)
+	}
+	for i := range config.BeaconSNI.ASNDatabaseFiles {
+		config.BeaconSNI.ASNDatabaseFiles[i] = filepath.Clean(config.BeaconSNI.ASNDatabaseFiles[i])
+	}
+	for i := range config.BeaconSNI.DomainAgeFiles {
+		config.BeaconSNI.DomainAgeFiles[i] = filepath.Clean(config.BeaconSNI.DomainAgeFiles[i])
+	}
+	if config.BeaconSNI.Syslog.CAFile != "" {
+		config.BeaconSNI.Syslog.CAFile = filepath.Clean(config.BeaconSNI.Syslog.CAFile)
+	}
 
 	// grab the version constants set by the build process
 	config.Version = Version
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+//resultSuffixPattern limits result suffixes to characters which are safe in a collection name
+var resultSuffixPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+//applyBeaconSNIResultSuffix appends suffix to the names of the collections the SNI beaconing
+//analysis reads from and writes to, separated by an underscore. Every collection is renamed
+//so a suffixed run never reads the checkpoints or results of an unsuffixed run. An empty
+//suffix keeps the default names.
+func applyBeaconSNIResultSuffix(suffix string, tables *BeaconSNITableCfg) error {
+	if suffix == "" {
+		return nil
+	}
+	if !resultSuffixPattern.MatchString(suffix) {
+		return fmt.Errorf("BeaconSNI.ResultSuffix: %q may only contain letters, digits, '_', and '-'", suffix)
+	}
+
+	tables.BeaconSNITable += "_" + suffix
+	tables.CheckpointTable += "_" + suffix
+	tables.ExaminedTable += "_" + suffix
+	tables.AlternatingTable += "_" + suffix
+	tables.FeaturesTable += "_" + suffix
+	return nil
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestApplyBeaconSNIResultSuffix ensures every SNI beacon collection is renamed together
+func TestApplyBeaconSNIResultSuffix(t *testing.T) {
+	defaults := BeaconSNITableCfg{
+		BeaconSNITable:   "beaconSNI",
+		CheckpointTable:  "beaconSNICheckpoint",
+		ExaminedTable:    "beaconSNIExamined",
+		AlternatingTable: "beaconSNIAlternating",
+		FeaturesTable:    "beaconSNIFeatures",
+	}
+
+	tables := defaults
+	assert.Nil(t, applyBeaconSNIResultSuffix("", &tables))
+	assert.Equal(t, defaults, tables, "an empty suffix should keep the defaults")
+
+	assert.Nil(t, applyBeaconSNIResultSuffix("experimental", &tables))
+	assert.Equal(t, BeaconSNITableCfg{
+		BeaconSNITable:   "beaconSNI_experimental",
+		CheckpointTable:  "beaconSNICheckpoint_experimental",
+		ExaminedTable:    "beaconSNIExamined_experimental",
+		AlternatingTable: "beaconSNIAlternating_experimental",
+		FeaturesTable:    "beaconSNIFeatures_experimental",
+	}, tables)
+
+	for _, suffix := range []string{"exp.1", "$exp", "new model", "exp\x00"} {
+		tables = defaults
+		assert.NotNil(t, applyBeaconSNIResultSuffix(suffix, &tables), "%q should be rejected", suffix)
+		assert.Equal(t, defaults, tables, "a rejected suffix should leave the names alone")
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+)
+
+const (
+	//SyslogUDP sends each finding in its own datagram
+	SyslogUDP = "udp"
+	//SyslogTCP sends octet counted findings over a plain TCP stream
+	SyslogTCP = "tcp"
+	//SyslogTLS sends octet counted findings over a TLS stream
+	SyslogTLS = "tls"
+)
+
+// parseSyslog checks the syslog endpoint settings and, for tls endpoints, builds the
+// tls configuration used to verify the endpoint. The system's CAs are used unless a CA
+// file is given.
+func parseSyslog(cfg SyslogStaticCfg) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	if cfg.Network != SyslogUDP && cfg.Network != SyslogTCP && cfg.Network != SyslogTLS {
+		return nil, fmt.Errorf("syslog network must be %s, %s, or %s, not %q", SyslogUDP, SyslogTCP, SyslogTLS, cfg.Network)
+	}
+
+	host, _, err := net.SplitHostPort(cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("syslog address %q must be host:port: %v", cfg.Address, err)
+	}
+
+	// RFC 5424 facilities run from kern (0) to local7 (23)
+	if cfg.Facility < 0 || cfg.Facility > 23 {
+		return nil, fmt.Errorf("syslog facility must be between 0 and 23, not %d", cfg.Facility)
+	}
+
+	if cfg.BufferSize < 1 {
+		return nil, fmt.Errorf("syslog buffer size must be at least 1, not %d", cfg.BufferSize)
+	}
+
+	if cfg.MaxAlertsPerSource < 0 {
+		return nil, fmt.Errorf("syslog max alerts per source must be at least 0, not %d", cfg.MaxAlertsPerSource)
+	}
+
+	if cfg.Network != SyslogTLS {
+		return nil, nil
+	}
+
+	tlsConf := &tls.Config{ServerName: host}
+	if len(cfg.CAFile) > 0 {
+		pem, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConf.RootCAs = x509.NewCertPool()
+		if !tlsConf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("syslog CA file %s holds no certificates", cfg.CAFile)
+		}
+	}
+	return tlsConf, nil
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseSyslog ensures valid endpoints are accepted and tls endpoints are verified by name
+func TestParseSyslog(t *testing.T) {
+	tlsConf, err := parseSyslog(SyslogStaticCfg{})
+	assert.Nil(t, err, "disabled syslog should not be checked")
+	assert.Nil(t, tlsConf)
+
+	tlsConf, err = parseSyslog(SyslogStaticCfg{Enabled: true, Network: SyslogUDP, Address: "10.0.0.1:514", Facility: 16, BufferSize: 1000})
+	assert.Nil(t, err)
+	assert.Nil(t, tlsConf, "udp endpoints don't use tls")
+
+	tlsConf, err = parseSyslog(SyslogStaticCfg{Enabled: true, Network: SyslogTLS, Address: "siem.example.com:6514", Facility: 16, BufferSize: 1000})
+	require.Nil(t, err)
+	require.NotNil(t, tlsConf)
+	assert.Equal(t, "siem.example.com", tlsConf.ServerName)
+	assert.False(t, tlsConf.InsecureSkipVerify)
+}
+
+// TestParseSyslogInvalid ensures unusable endpoint settings are rejected
+func TestParseSyslogInvalid(t *testing.T) {
+	valid := SyslogStaticCfg{Enabled: true, Network: SyslogTCP, Address: "10.0.0.1:601", Facility: 16, BufferSize: 1000}
+
+	invalid := []func(*SyslogStaticCfg){
+		func(cfg *SyslogStaticCfg) { cfg.Network = "sctp" },
+		func(cfg *SyslogStaticCfg) { cfg.Address = "" },
+		func(cfg *SyslogStaticCfg) { cfg.Address = "10.0.0.1" },
+		func(cfg *SyslogStaticCfg) { cfg.Facility = 24 },
+		func(cfg *SyslogStaticCfg) { cfg.BufferSize = 0 },
+		func(cfg *SyslogStaticCfg) { cfg.MaxAlertsPerSource = -1 },
+		func(cfg *SyslogStaticCfg) { cfg.Network, cfg.CAFile = SyslogTLS, "/nonexistent/ca.pem" },
+	}
+	for i, change := range invalid {
+		cfg := valid
+		change(&cfg)
+		_, err := parseSyslog(cfg)
+		assert.NotNil(t, err, "case %d should be rejected", i)
+	}
+}
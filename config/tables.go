@@ -3,16 +3,18 @@ package config
 type (
 	//TableCfg is the container for other table config sections
 	TableCfg struct {
-		Log         LogTableCfg
-		DNS         DNSTableCfg
-		Structure   StructureTableCfg
-		Beacon      BeaconTableCfg
-		BeaconSNI   BeaconSNITableCfg
-		BeaconFQDN  BeaconFQDNTableCfg
-		BeaconProxy BeaconProxyTableCfg
-		UserAgent   UserAgentTableCfg
-		Cert        CertificateTableCfg
-		Meta        MetaTableCfg
+		Log           LogTableCfg
+		DNS           DNSTableCfg
+		Structure     StructureTableCfg
+		Beacon        BeaconTableCfg
+		BeaconSNI     BeaconSNITableCfg
+		BeaconFQDN    BeaconFQDNTableCfg
+		BeaconProxy   BeaconProxyTableCfg
+		MergedBeacon  MergedBeaconTableCfg
+		DedupedBeacon DedupedBeaconTableCfg
+		UserAgent     UserAgentTableCfg
+		Cert          CertificateTableCfg
+		Meta          MetaTableCfg
 	}
 
 	//LogTableCfg contains the configuration for logging
@@ -28,6 +30,7 @@ type (
 		HTTPTable            string `default:"http"`
 		OpenConnTable        string `default:"openconn"`
 		SSLTable             string `default:"ssl"`
+		X509Table            string `default:"x509"`
 		UniqueConnTable      string `default:"uconn"`
 		UniqueConnProxyTable string `default:"uconnProxy"`
 		SNIConnTable         string `default:"SNIconn"`
@@ -46,7 +49,22 @@ type (
 
 	//BeaconSNITableCfg is used to control the SNI beaconing analysis module
 	BeaconSNITableCfg struct {
-		BeaconSNITable string `default:"beaconSNI"`
+		BeaconSNITable   string `default:"beaconSNI"`
+		CheckpointTable  string `default:"beaconSNICheckpoint"`
+		ExaminedTable    string `default:"beaconSNIExamined"`
+		AlternatingTable string `default:"beaconSNIAlternating"`
+		FeaturesTable    string `default:"beaconSNIFeatures"`
+		SNIConnFieldsCfg
+	}
+
+	//SNIConnFieldsCfg holds the SNIconn field paths read by the SNI beaconing analysis.
+	//Each option lists the path of the field for every protocol merged into an SNI beacon.
+	SNIConnFieldsCfg struct {
+		TimestampFields  []string `default:"[\"dat.http.ts\", \"dat.tls.ts\"]"`
+		BytesFields      []string `default:"[\"dat.http.bytes\", \"dat.tls.bytes\"]"`
+		CountFields      []string `default:"[\"dat.http.count\", \"dat.tls.count\"]"`
+		TotalBytesFields []string `default:"[\"dat.http.tbytes\", \"dat.tls.tbytes\"]"`
+		DstIPsFields     []string `default:"[\"dat.http.dst_ips\", \"dat.tls.dst_ips\"]"`
 	}
 
 	//BeaconFQDNTableCfg is used to control the beaconing analysis module
@@ -59,6 +77,16 @@ type (
 		BeaconProxyTable string `default:"beaconProxy"`
 	}
 
+	//MergedBeaconTableCfg is used to control merging SNI and proxy beacons into a single view
+	MergedBeaconTableCfg struct {
+		MergedBeaconTable string `default:"merged_beacons"`
+	}
+
+	//DedupedBeaconTableCfg is used to control deduplicating SNI and FQDN beacons into a single view
+	DedupedBeaconTableCfg struct {
+		DedupedBeaconTable string `default:"deduped_beacons"`
+	}
+
 	//UserAgentTableCfg is used to control the useragent analysis module
 	UserAgentTableCfg struct {
 		UserAgentTable string `default:"useragent"`
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/activecm/rita/util"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type (
+	//ThresholdRule overrides the connection thresholds used during beacon analysis
+	//for any FQDN matching Domain. A zero value leaves the global setting in place.
+	ThresholdRule struct {
+		Domain                  string `yaml:"Domain"`
+		DefaultConnectionThresh int    `yaml:"DefaultConnectionThresh"`
+		ConnectionLimit         int    `yaml:"ConnectionLimit"`
+	}
+
+	//ThresholdRules is a set of ThresholdRule entries ordered from most to least specific
+	ThresholdRules []ThresholdRule
+
+	//thresholdRulesFile is the layout of a threshold rules file on disk
+	thresholdRulesFile struct {
+		Rules []ThresholdRule `yaml:"Rules"`
+	}
+)
+
+// loadThresholdRules reads and validates the threshold rules file at the given path
+// against the global strobe connection limit. An empty path yields no rules.
+func loadThresholdRules(path string, connLimit int) (ThresholdRules, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseThresholdRules(contents, connLimit)
+}
+
+// parseThresholdRules deserializes the yaml in contents into a validated set of rules
+func parseThresholdRules(contents []byte, connLimit int) (ThresholdRules, error) {
+	var file thresholdRulesFile
+	if err := yaml.Unmarshal(contents, &file); err != nil {
+		return nil, err
+	}
+
+	return validateThresholdRules(file.Rules, connLimit)
+}
+
+// validateThresholdRules checks each rule and orders the rules so that
+// the most specific match is found first. A rule's connection threshold must
+// fall below its own connection limit, or connLimit if it doesn't set one.
+func validateThresholdRules(rules ThresholdRules, connLimit int) (ThresholdRules, error) {
+	seen := make(map[string]bool)
+	for i := range rules {
+		rule := &rules[i]
+		rule.Domain = strings.ToLower(strings.TrimSpace(rule.Domain))
+
+		if rule.Domain == "" {
+			return nil, fmt.Errorf("threshold rule %d: domain must not be empty", i+1)
+		}
+		// only subdomain wildcarding (asterisk as the prefix) is supported,
+		// matching the domain filters in the main config
+		if strings.Contains(strings.TrimPrefix(rule.Domain, "*."), "*") {
+			return nil, fmt.Errorf("threshold rule %d: unsupported wildcard in %s", i+1, rule.Domain)
+		}
+		if rule.DefaultConnectionThresh < 0 || rule.ConnectionLimit < 0 {
+			return nil, fmt.Errorf("threshold rule %d: thresholds for %s must not be negative", i+1, rule.Domain)
+		}
+		limit := connLimit
+		if rule.ConnectionLimit > 0 {
+			limit = rule.ConnectionLimit
+		}
+		if limit <= rule.DefaultConnectionThresh {
+			return nil, fmt.Errorf("threshold rule %d: connection limit for %s must be greater than its connection threshold", i+1, rule.Domain)
+		}
+		if seen[rule.Domain] {
+			return nil, fmt.Errorf("threshold rule %d: duplicate rule for %s", i+1, rule.Domain)
+		}
+		seen[rule.Domain] = true
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].specificity() > rules[j].specificity()
+	})
+	return rules, nil
+}
+
+// specificity ranks a rule for precedence. Exact matches always outrank wildcards,
+// and longer wildcard suffixes outrank shorter ones.
+func (r ThresholdRule) specificity() int {
+	if strings.HasPrefix(r.Domain, "*") {
+		return len(r.Domain)
+	}
+	// exact domains sort ahead of every wildcard
+	return len(r.Domain) + 1<<16
+}
+
+//Match returns the most specific rule matching the given FQDN, if any
+func (r ThresholdRules) Match(fqdn string) (ThresholdRule, bool) {
+	fqdn = strings.ToLower(fqdn)
+	for _, rule := range r {
+		if util.ContainsDomain([]string{rule.Domain}, fqdn) {
+			return rule, true
+		}
+	}
+	return ThresholdRule{}, false
+}
+
+//Thresholds returns the connection threshold and strobe connection limit which apply
+//to the given FQDN, falling back to the provided defaults when no rule overrides them
+func (r ThresholdRules) Thresholds(fqdn string, defaultThresh int, defaultLimit int64) (int, int64) {
+	rule, ok := r.Match(fqdn)
+	if !ok {
+		return defaultThresh, defaultLimit
+	}
+	if rule.DefaultConnectionThresh > 0 {
+		defaultThresh = rule.DefaultConnectionThresh
+	}
+	if rule.ConnectionLimit > 0 {
+		defaultLimit = int64(rule.ConnectionLimit)
+	}
+	return defaultThresh, defaultLimit
+}
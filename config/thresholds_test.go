@@ -0,0 +1,57 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestThresholdRulesPrecedence ensures the most specific rule is
+// used when several rules match the same FQDN.
+func TestThresholdRulesPrecedence(t *testing.T) {
+	rules, err := validateThresholdRules(ThresholdRules{
+		{Domain: "*.example.com", DefaultConnectionThresh: 100},
+		{Domain: "*.ntp.example.com", DefaultConnectionThresh: 5000, ConnectionLimit: 100000},
+		{Domain: "time.ntp.example.com", DefaultConnectionThresh: 10000},
+	}, 86400)
+	assert.Nil(t, err)
+
+	thresh, limit := rules.Thresholds("time.ntp.example.com", 20, 86400)
+	assert.Equal(t, 10000, thresh, "exact match should win over wildcards")
+	assert.Equal(t, int64(86400), limit, "unset connection limit should fall back to the default")
+
+	thresh, limit = rules.Thresholds("pool.ntp.example.com", 20, 86400)
+	assert.Equal(t, 5000, thresh, "longest wildcard should win")
+	assert.Equal(t, int64(100000), limit)
+
+	thresh, _ = rules.Thresholds("EXAMPLE.com", 20, 86400)
+	assert.Equal(t, 100, thresh, "wildcard should match the top domain case insensitively")
+
+	thresh, limit = rules.Thresholds("rare.org", 20, 86400)
+	assert.Equal(t, 20, thresh, "unmatched fqdn should use the defaults")
+	assert.Equal(t, int64(86400), limit)
+}
+
+// TestThresholdRulesValidation ensures malformed rules are rejected
+func TestThresholdRulesValidation(t *testing.T) {
+	invalid := []ThresholdRules{
+		{{Domain: " ", DefaultConnectionThresh: 5}},
+		{{Domain: "a.*.com", DefaultConnectionThresh: 5}},
+		{{Domain: "a.com", DefaultConnectionThresh: -1}},
+		{{Domain: "a.com", DefaultConnectionThresh: 50, ConnectionLimit: 10}},
+		{{Domain: "a.com", DefaultConnectionThresh: 5}, {Domain: "A.com", DefaultConnectionThresh: 6}},
+		// without a limit of its own, the rule falls under the global limit
+		{{Domain: "a.com", DefaultConnectionThresh: 86400}},
+	}
+
+	for _, rules := range invalid {
+		_, err := validateThresholdRules(rules, 86400)
+		assert.NotNil(t, err)
+	}
+
+	// a rule's own limit may raise the threshold past the global limit
+	_, err := validateThresholdRules(ThresholdRules{
+		{Domain: "a.com", DefaultConnectionThresh: 100000, ConnectionLimit: 200000},
+	}, 86400)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,20 @@
+package config
+
+import "fmt"
+
+const (
+	//AnalysisVerbositySummary only logs the summary of each analysis run
+	AnalysisVerbositySummary = 0
+	//AnalysisVerbosityPairs also logs the score of every analyzed pair and why skipped pairs were skipped
+	AnalysisVerbosityPairs = 1
+	//AnalysisVerbosityFeatures also logs the feature scores and statistics behind every score
+	AnalysisVerbosityFeatures = 2
+)
+
+// validateAnalysisVerbosity checks the level of detail logged by the beacon analysis
+func validateAnalysisVerbosity(verbosity int) error {
+	if verbosity < AnalysisVerbositySummary || verbosity > AnalysisVerbosityFeatures {
+		return fmt.Errorf("analysis verbosity must be between %d and %d, not %d", AnalysisVerbositySummary, AnalysisVerbosityFeatures, verbosity)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidateAnalysisVerbosity ensures only the known verbosity levels are accepted
+func TestValidateAnalysisVerbosity(t *testing.T) {
+	for _, verbosity := range []int{AnalysisVerbositySummary, AnalysisVerbosityPairs, AnalysisVerbosityFeatures} {
+		assert.Nil(t, validateAnalysisVerbosity(verbosity))
+	}
+	assert.NotNil(t, validateAnalysisVerbosity(-1))
+	assert.NotNil(t, validateAnalysisVerbosity(3))
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// validateWebhook checks the settings used to POST SNI beacon findings to a webhook
+func validateWebhook(cfg WebhookStaticCfg) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	endpoint, err := url.Parse(cfg.URL)
+	if err != nil {
+		return fmt.Errorf("webhook URL %q is not valid: %v", cfg.URL, err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return fmt.Errorf("webhook URL %q must use http or https", cfg.URL)
+	}
+	if endpoint.Host == "" {
+		return fmt.Errorf("webhook URL %q must include a host", cfg.URL)
+	}
+	if cfg.Timeout < 1 {
+		return fmt.Errorf("webhook timeout must be at least 1 second, not %d", cfg.Timeout)
+	}
+	if cfg.BufferSize < 1 {
+		return fmt.Errorf("webhook buffer size must be at least 1, not %d", cfg.BufferSize)
+	}
+	if cfg.MaxAlertsPerSource < 0 {
+		return fmt.Errorf("webhook max alerts per source must be at least 0, not %d", cfg.MaxAlertsPerSource)
+	}
+	return nil
+}
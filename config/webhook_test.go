@@ -0,0 +1,29 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateWebhook(t *testing.T) {
+	assert.Nil(t, validateWebhook(WebhookStaticCfg{}), "a disabled webhook should not be checked")
+
+	valid := WebhookStaticCfg{Enabled: true, URL: "https://alerts.example.com/rita", Timeout: 10, BufferSize: 1000}
+	assert.Nil(t, validateWebhook(valid))
+
+	invalid := []func(*WebhookStaticCfg){
+		func(cfg *WebhookStaticCfg) { cfg.URL = "" },
+		func(cfg *WebhookStaticCfg) { cfg.URL = "ftp://alerts.example.com/rita" },
+		func(cfg *WebhookStaticCfg) { cfg.URL = "https:///rita" },
+		func(cfg *WebhookStaticCfg) { cfg.URL = "https://alerts.example.com/%zz" },
+		func(cfg *WebhookStaticCfg) { cfg.Timeout = 0 },
+		func(cfg *WebhookStaticCfg) { cfg.BufferSize = 0 },
+		func(cfg *WebhookStaticCfg) { cfg.MaxAlertsPerSource = -1 },
+	}
+	for i, change := range invalid {
+		cfg := valid
+		change(&cfg)
+		assert.NotNil(t, validateWebhook(cfg), "case %d should be rejected", i)
+	}
+}
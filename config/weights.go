@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// scoreFeatureNames lists the per feature scores the default SNI beacon scoring model combines
+var scoreFeatureNames = map[string]bool{
+	"ts_skew":       true,
+	"ts_dispersion": true,
+	"ts_conns":      true,
+	"ds_skew":       true,
+	"ds_dispersion": true,
+	"ds_smallness":  true,
+}
+
+// optionalScoreFeatureNames lists the features the default SNI beacon scoring model only
+// combines when they are enabled, such as ds_consistency with BeaconSNI.MinBytesModeFraction
+var optionalScoreFeatureNames = map[string]bool{
+	"ds_consistency": true,
+	"ts_periodicity": true,
+}
+
+// validateFeatureWeights checks the weights given to the features of the default SNI beacon
+// scoring model. Every weight must name a known feature and be non-negative, and since features
+// left out keep a weight of 1, at least one feature must end up with a positive weight. Optional
+// features may be weighted, but don't count towards the positive weight since they may be disabled.
+func validateFeatureWeights(weights map[string]float64) error {
+	names := make([]string, 0, len(weights))
+	for name := range weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	weighted := 0
+	positive := false
+	for _, name := range names {
+		weight := weights[name]
+		if !scoreFeatureNames[name] && !optionalScoreFeatureNames[name] {
+			return fmt.Errorf("unknown SNI beacon score feature %q", name)
+		}
+		if weight < 0 {
+			return fmt.Errorf("weight of SNI beacon score feature %s must not be negative, not %g", name, weight)
+		}
+		if scoreFeatureNames[name] {
+			weighted++
+			if weight > 0 {
+				positive = true
+			}
+		}
+	}
+	if weighted < len(scoreFeatureNames) {
+		positive = true
+	}
+
+	if !positive {
+		return fmt.Errorf("at least one SNI beacon score feature must have a positive weight")
+	}
+	return nil
+}
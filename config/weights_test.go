@@ -0,0 +1,28 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidateFeatureWeights ensures weights which can't produce a score are rejected
+func TestValidateFeatureWeights(t *testing.T) {
+	assert.Nil(t, validateFeatureWeights(nil), "equal weights should be allowed")
+	assert.Nil(t, validateFeatureWeights(map[string]float64{"ts_skew": 2, "ds_smallness": 0}))
+	assert.Nil(t, validateFeatureWeights(map[string]float64{
+		"ts_skew": 0, "ts_dispersion": 0, "ts_conns": 1, "ds_skew": 0, "ds_dispersion": 0, "ds_smallness": 0,
+	}))
+
+	assert.Nil(t, validateFeatureWeights(map[string]float64{"ds_consistency": 2}), "optional features should be allowed")
+	assert.Nil(t, validateFeatureWeights(map[string]float64{"ts_periodicity": 3}))
+
+	assert.NotNil(t, validateFeatureWeights(map[string]float64{"ts_skw": 2}), "unknown features should be rejected")
+	assert.NotNil(t, validateFeatureWeights(map[string]float64{"ts_skew": -1}), "negative weights should be rejected")
+	assert.NotNil(t, validateFeatureWeights(map[string]float64{
+		"ts_skew": 0, "ts_dispersion": 0, "ts_conns": 0, "ds_skew": 0, "ds_dispersion": 0, "ds_smallness": 0,
+	}), "weights which are all zero should be rejected")
+	assert.NotNil(t, validateFeatureWeights(map[string]float64{
+		"ts_skew": 0, "ts_dispersion": 0, "ts_conns": 0, "ds_skew": 0, "ds_dispersion": 0, "ds_smallness": 0, "ds_consistency": 1,
+	}), "an optional feature should not be the only one with a positive weight")
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	//ZeekIntelDomains exports the SNI of each beacon as an Intel::DOMAIN indicator
+	ZeekIntelDomains = "domains"
+	//ZeekIntelIPs exports the responding IPs of each beacon as Intel::ADDR indicators
+	ZeekIntelIPs = "ips"
+	//ZeekIntelBoth exports both the SNIs and the responding IPs of each beacon
+	ZeekIntelBoth = "both"
+)
+
+// validateZeekIntel checks the settings used to export SNI beacons as Zeek intel framework entries
+func validateZeekIntel(cfg ZeekIntelStaticCfg) error {
+	if cfg.Indicators != ZeekIntelDomains && cfg.Indicators != ZeekIntelIPs && cfg.Indicators != ZeekIntelBoth {
+		return fmt.Errorf("Zeek intel indicators must be %s, %s, or %s, not %q", ZeekIntelDomains, ZeekIntelIPs, ZeekIntelBoth, cfg.Indicators)
+	}
+	// the intel file is tab separated, so the source can't break up its line
+	if strings.TrimSpace(cfg.Source) == "" || strings.ContainsAny(cfg.Source, "\t\r\n") {
+		return fmt.Errorf("Zeek intel source must not be empty or contain tabs or line breaks, not %q", cfg.Source)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidateZeekIntel ensures settings which can't produce a valid intel file are rejected
+func TestValidateZeekIntel(t *testing.T) {
+	for _, indicators := range []string{ZeekIntelDomains, ZeekIntelIPs, ZeekIntelBoth} {
+		assert.Nil(t, validateZeekIntel(ZeekIntelStaticCfg{Indicators: indicators, Source: "RITA"}), indicators)
+	}
+
+	assert.NotNil(t, validateZeekIntel(ZeekIntelStaticCfg{Indicators: "urls", Source: "RITA"}), "unknown indicators should be rejected")
+	assert.NotNil(t, validateZeekIntel(ZeekIntelStaticCfg{Indicators: ZeekIntelBoth, Source: " "}), "an empty source should be rejected")
+	assert.NotNil(t, validateZeekIntel(ZeekIntelStaticCfg{Indicators: ZeekIntelBoth, Source: "RITA\tlab"}), "a source with a tab should be rejected")
+}
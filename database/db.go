@@ -2,9 +2,12 @@ package database
 
 import (
 	"fmt"
+	"runtime"
+	"time"
 
 	"github.com/activecm/mgosec"
 	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/util"
 	"github.com/blang/semver"
 	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
@@ -32,10 +35,17 @@ type DB struct {
 	Session  *mgo.Session
 	log      *log.Logger
 	selected string
+	sessions *util.Limiter // bounds the sessions copied with CopySession (nil if unlimited)
 }
 
 //NewDB constructs a new DB struct
 func NewDB(conf *config.Config, log *log.Logger) (*DB, error) {
+	// analysis stages start a worker for every other CPU
+	err := checkMaxConnections(conf.S.MongoDB.MaxConnections, util.Max(1, runtime.NumCPU()/2))
+	if err != nil {
+		return nil, err
+	}
+
 	// Jump into the requested database
 	session, err := connectToMongoDB(conf, log)
 	if err != nil {
@@ -49,9 +59,54 @@ func NewDB(conf *config.Config, log *log.Logger) (*DB, error) {
 		Session:  session,
 		log:      log,
 		selected: "",
+		sessions: util.NewLimiter(conf.S.MongoDB.MaxConnections),
 	}, nil
 }
 
+//RequiredSessions returns the fewest sessions MongoDB.MaxConnections may allow when each stage
+//of an analysis runs the given number of workers. Two analysis modules may run side by side,
+//and each holds a session in the workers of two stages, such as its dissectors and writers, for
+//as long as they run, plus one for the queries its repository makes in the meantime. With fewer
+//sessions, the workers of one stage could hold every session while waiting on a stage which
+//can't get one, stalling the run.
+func RequiredSessions(workers int) int {
+	return 2 * (2*workers + 1)
+}
+
+//checkMaxConnections makes sure a MongoDB.MaxConnections limit leaves enough sessions for
+//analysis stages running the given number of workers. 0 leaves the sessions unlimited.
+func checkMaxConnections(maxConnections int, workers int) error {
+	if required := RequiredSessions(workers); maxConnections > 0 && maxConnections < required {
+		return fmt.Errorf("MongoDB.MaxConnections must be 0 or at least %d on this system, not %d", required, maxConnections)
+	}
+	return nil
+}
+
+//CopySession copies the main session. When MongoDB.MaxConnections is set, it blocks until
+//fewer than that many sessions copied this way are open, so workers across every module
+//can't exhaust MongoDB's connection limit. Every session copied this way
+//must be closed with CloseSession rather than Close, so its slot is freed.
+func (d *DB) CopySession() *mgo.Session {
+	d.sessions.Acquire()
+	copied := false
+	defer func() {
+		// a failed copy would otherwise hold its slot for good
+		if !copied {
+			d.sessions.Release()
+		}
+	}()
+
+	ssn := d.Session.Copy()
+	copied = true
+	return ssn
+}
+
+//CloseSession closes a session copied with CopySession and frees its slot
+func (d *DB) CloseSession(ssn *mgo.Session) {
+	ssn.Close()
+	d.sessions.Release()
+}
+
 //connectToMongoDB connects to MongoDB possibly with authentication and TLS
 func connectToMongoDB(conf *config.Config, logger *log.Logger) (*mgo.Session, error) {
 	connString := conf.S.MongoDB.ConnectionString
@@ -108,8 +163,13 @@ func (d *DB) GetSelectedDB() string {
 //CollectionExists returns true if collection exists in the currently
 //selected database
 func (d *DB) CollectionExists(table string) bool {
-	ssn := d.Session.Copy()
-	defer ssn.Close()
+	ssn := d.CopySession()
+	defer d.CloseSession(ssn)
+	return d.collectionExists(ssn, table)
+}
+
+//collectionExists is CollectionExists run on a session the caller already holds
+func (d *DB) collectionExists(ssn *mgo.Session, table string) bool {
 	coll, err := ssn.DB(d.selected).CollectionNames()
 	if err != nil {
 		d.log.WithFields(log.Fields{
@@ -129,8 +189,8 @@ func (d *DB) CollectionExists(table string) bool {
 //database with the required indexes
 func (d *DB) CreateCollection(name string, indexes []mgo.Index) error {
 	// Make a copy of the current session
-	session := d.Session.Copy()
-	defer session.Close()
+	session := d.CopySession()
+	defer d.CloseSession(session)
 
 	d.log.Debug("Building collection: ", name)
 
@@ -160,7 +220,8 @@ func (d *DB) AggregateCollection(sourceCollection string,
 	session *mgo.Session, pipeline []bson.D) *mgo.Iter {
 
 	// Identify the source collection we will aggregate information from into the new collection
-	if !d.CollectionExists(sourceCollection) {
+	// the caller's session is reused, since waiting on another could stall every session holder
+	if !d.collectionExists(session, sourceCollection) {
 		d.log.Warning("Failed aggregation: (Source collection: ",
 			sourceCollection, " doesn't exist)")
 		return nil
@@ -183,6 +244,24 @@ func (d *DB) AggregateCollection(sourceCollection string,
 	return iter
 }
 
+//RetryBulk calls run, which should run a bulk write, until it succeeds or has been retried
+//retries times. The delay between attempts starts at backoff and doubles after each retry.
+//The session is refreshed before each retry so a dropped connection is re-established.
+//Writes rejected by MongoDB come back as a *mgo.BulkError and are not retried since part
+//of the bulk may already have been applied.
+func RetryBulk(ssn *mgo.Session, retries int, backoff time.Duration, run func() (*mgo.BulkResult, error)) (*mgo.BulkResult, error) {
+	info, err := run()
+	for attempt := 0; err != nil && attempt < retries; attempt++ {
+		if _, rejected := err.(*mgo.BulkError); rejected {
+			break
+		}
+		time.Sleep(backoff << uint(attempt))
+		ssn.Refresh()
+		info, err = run()
+	}
+	return info, err
+}
+
 // MergeBSONMaps recursively merges several bson.M objects into a single map.
 // When merging slices of maps with the same associated key, the slices are concatenated.
 // If two or more maps define the same key and they are not both bson.M objects,
@@ -227,3 +306,57 @@ func MergeBSONMaps(maps ...bson.M) bson.M {
 
 	return result
 }
+
+//ApplyScoreBuckets labels the documents in coll with the bucket holding their score. The
+//label is kept in the score_bucket field of each document, and only documents whose label
+//changed are updated.
+func ApplyScoreBuckets(coll *mgo.Collection, buckets config.ScoreBuckets) error {
+	for i, bucket := range buckets {
+		scoreRange := bson.M{}
+		// scores below the lowest threshold still belong in the lowest bucket
+		if i > 0 {
+			scoreRange["$gte"] = bucket.MinScore
+		}
+		if i+1 < len(buckets) {
+			scoreRange["$lt"] = buckets[i+1].MinScore
+		}
+
+		matchBucket := bson.M{"score_bucket": bson.M{"$ne": bucket.Label}}
+		if len(scoreRange) > 0 {
+			matchBucket["score"] = scoreRange
+		}
+
+		_, err := coll.UpdateAll(matchBucket, bson.M{"$set": bson.M{"score_bucket": bucket.Label}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//ApplyAttackTags tags the documents in coll which meet each rule with the rule's ATT&CK
+//technique id. Documents no longer meeting a rule have its technique removed, so the tags
+//follow the scores as they change between imports. The tags are kept in the
+//attack_techniques array of each document.
+func ApplyAttackTags(coll *mgo.Collection, rules []config.AttackTagRule) error {
+	for _, rule := range rules {
+		matchRule := bson.M{"score": bson.M{"$gte": rule.MinScore}}
+		if rule.MinTsScore > 0 {
+			matchRule["ts.score"] = bson.M{"$gte": rule.MinTsScore}
+		}
+
+		_, err := coll.UpdateAll(matchRule, bson.M{"$addToSet": bson.M{"attack_techniques": rule.Technique}})
+		if err != nil {
+			return err
+		}
+
+		_, err = coll.UpdateAll(
+			bson.M{"attack_techniques": rule.Technique, "$nor": []bson.M{matchRule}},
+			bson.M{"$pull": bson.M{"attack_techniques": rule.Technique}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
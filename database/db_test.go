@@ -0,0 +1,27 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopySessionFreesSlotOnFailure(t *testing.T) {
+	// a DB without a session fails every copy
+	db := &DB{sessions: util.NewLimiter(1)}
+
+	for i := 0; i < 2; i++ {
+		assert.Panics(t, func() { db.CopySession() }, "the second copy should fail rather than wait on the first")
+	}
+}
+
+func TestCheckMaxConnections(t *testing.T) {
+	// two modules, each with two stages of 4 workers and a repository session
+	assert.Equal(t, 18, RequiredSessions(4))
+
+	assert.Nil(t, checkMaxConnections(0, 4), "0 leaves the sessions unlimited")
+	assert.Nil(t, checkMaxConnections(18, 4))
+	assert.NotNil(t, checkMaxConnections(17, 4), "fewer sessions than workers could stall a run")
+	assert.NotNil(t, checkMaxConnections(1, 1))
+}
@@ -0,0 +1,47 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+//namedTask is a unit of import work run alongside other tasks, such as an analysis module
+type namedTask struct {
+	name string
+	run  func() error
+}
+
+//runConcurrently runs every task in its own goroutine and waits for all of them to finish,
+//even if some fail. A task which panics is reported as failed rather than taking down the
+//import. The errors are combined into a single error naming each failed task, in the order
+//the tasks were given. nil is returned if every task succeeded.
+func runConcurrently(tasks ...namedTask) error {
+	errs := make([]error, len(tasks))
+
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		go func(i int, task namedTask) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = fmt.Errorf("panic: %v", r)
+				}
+			}()
+			errs[i] = task.run()
+		}(i, task)
+	}
+	wg.Wait()
+
+	var failures []string
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, tasks[i].name+": "+err.Error())
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d tasks failed: %s", len(failures), len(tasks), strings.Join(failures, "; "))
+}
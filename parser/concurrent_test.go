@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunConcurrently(t *testing.T) {
+	var ran int32
+	task := func(err error) func() error {
+		return func() error {
+			atomic.AddInt32(&ran, 1)
+			return err
+		}
+	}
+
+	err := runConcurrently(
+		namedTask{name: "proxy", run: task(nil)},
+		namedTask{name: "sni", run: task(nil)},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&ran))
+
+	err = runConcurrently(
+		namedTask{name: "proxy", run: task(errors.New("index failed"))},
+		namedTask{name: "sni", run: task(nil)},
+	)
+	assert.EqualError(t, err, "1 of 2 tasks failed: proxy: index failed")
+
+	err = runConcurrently(
+		namedTask{name: "proxy", run: task(errors.New("index failed"))},
+		namedTask{name: "sni", run: func() error { panic("boom") }},
+	)
+	assert.EqualError(t, err, "2 of 2 tasks failed: proxy: index failed; sni: panic: boom",
+		"a panicking task should be reported without stopping the others")
+
+	assert.Nil(t, runConcurrently(), "no tasks should not be an error")
+}
@@ -225,6 +225,7 @@ func mapZeekHeaderToParseType(header *BroHeader, broDataFactory func() pt.BroDat
 	indexMap := ZeekHeaderIndexMap{
 		NthLogFieldExistsInParseType: make([]bool, len(header.Names)),
 		NthLogFieldParseTypeOffset:   make([]int, len(header.Names)),
+		NthLogFieldMillisOffset:      make([]int, len(header.Names)),
 	}
 
 	// parseTypeFieldInfo and the parseTypeFields map record the names, types, and offsets of the
@@ -237,6 +238,9 @@ func mapZeekHeaderToParseType(header *BroHeader, broDataFactory func() pt.BroDat
 	// parseTypeFields maps from Zeek field names to the associated info as defined by the
 	// broData struct tags
 	parseTypeFields := make(map[string]parseTypeFieldInfo)
+	// millisFields maps from Zeek time field names to the offsets of the fields which
+	// receive them in whole milliseconds, as defined by the bromillis struct tags
+	millisFields := make(map[string]int)
 
 	// walk the fields of the broData, making sure the broData struct has
 	// an equal number of named bro fields and bro types
@@ -245,6 +249,11 @@ func mapZeekHeaderToParseType(header *BroHeader, broDataFactory func() pt.BroDat
 		zeekName := structField.Tag.Get("bro")
 		zeekType := structField.Tag.Get("brotype")
 
+		if millisName := structField.Tag.Get("bromillis"); len(millisName) != 0 {
+			millisFields[millisName] = i
+			continue
+		}
+
 		//If this field is not associated with bro, skip it
 		if len(zeekName) == 0 && len(zeekType) == 0 {
 			continue
@@ -261,6 +270,11 @@ func mapZeekHeaderToParseType(header *BroHeader, broDataFactory func() pt.BroDat
 	}
 
 	for index, name := range header.Names {
+		indexMap.NthLogFieldMillisOffset[index] = -1
+		if offset, ok := millisFields[name]; ok && header.Types[index] == pt.Time {
+			indexMap.NthLogFieldMillisOffset[index] = offset
+		}
+
 		fieldInfo, ok := parseTypeFields[name]
 		if !ok {
 			//an unmatched field which exists in the log but not the struct
@@ -304,6 +318,31 @@ func ParseJSONLine(lineBuffer []byte, broDataFactory func() pt.BroData,
 	return dat
 }
 
+//parseTSVMillis reads a Zeek time field into targetField in whole milliseconds
+func parseTSVMillis(fieldText string, targetField reflect.Value, logger *log.Logger) {
+	seconds, fraction := fieldText, ""
+	if decimalPointIdx := strings.Index(fieldText, "."); decimalPointIdx != -1 {
+		seconds, fraction = fieldText[:decimalPointIdx], fieldText[decimalPointIdx+1:]
+	}
+	// the fraction is cut or padded to three digits
+	fraction = (fraction + "000")[:3]
+
+	s, err := strconv.ParseInt(seconds, 10, 64)
+	if err == nil {
+		var ms int64
+		ms, err = strconv.ParseInt(fraction, 10, 64)
+		if err == nil {
+			targetField.SetInt(s*1000 + ms)
+			return
+		}
+	}
+	logger.WithFields(log.Fields{
+		"error": err.Error(),
+		"value": fieldText,
+	}).Error("Couldn't convert unix ts")
+	targetField.SetInt(-1)
+}
+
 func parseTSVField(fieldText string, fieldType string, targetField reflect.Value, logger *log.Logger) {
 	switch fieldType {
 	case pt.Time:
@@ -408,6 +447,15 @@ func parseTSVField(fieldText string, fieldType string, targetField reflect.Value
 	}
 }
 
+//millisOffset returns the offset of the field receiving the nth log field in whole milliseconds,
+//or -1 if there is none
+func millisOffset(fieldMap ZeekHeaderIndexMap, n int) int {
+	if n >= len(fieldMap.NthLogFieldMillisOffset) {
+		return -1
+	}
+	return fieldMap.NthLogFieldMillisOffset[n]
+}
+
 //ParseTSVLine creates a new BroData from a line of a Zeek TSV log.
 //String matching is generally faster than byte matching in Golang for some reason, so we take use a string
 //rather than bytes here.
@@ -439,6 +487,9 @@ func ParseTSVLine(lineString string, header *BroHeader,
 					logger,
 				)
 			}
+			if offset := millisOffset(fieldMap, tokenCounter); offset >= 0 {
+				parseTSVMillis(lineString[:tokenEndIdx], data.Field(offset), logger)
+			}
 		}
 
 		// chomp off the portion we just parsed
@@ -458,6 +509,11 @@ func ParseTSVLine(lineString string, header *BroHeader,
 			logger,
 		)
 	}
+	if tokenCounter < len(header.Names) && lineString != header.Empty && lineString != header.Unset {
+		if offset := millisOffset(fieldMap, tokenCounter); offset >= 0 {
+			parseTSVMillis(lineString, data.Field(offset), logger)
+		}
+	}
 
 	return dat
 }
@@ -0,0 +1,38 @@
+package files
+
+import (
+	"testing"
+
+	pt "github.com/activecm/rita/parser/parsetypes"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTSVLineMillis(t *testing.T) {
+	header := &BroHeader{
+		Names:     []string{"ts", "uid"},
+		Types:     []string{pt.Time, pt.String},
+		Separator: "\t",
+		Empty:     "(empty)",
+		Unset:     "-",
+	}
+	factory := func() pt.BroData { return &pt.SSL{} }
+	logger := log.New()
+
+	fieldMap, err := mapZeekHeaderToParseType(header, factory, logger)
+	require.Nil(t, err)
+
+	ssl := ParseTSVLine("1517336042.090842\tCabc", header, fieldMap, factory, logger).(*pt.SSL)
+	require.Equal(t, int64(1517336042), ssl.TimeStamp)
+	require.Equal(t, int64(1517336042090), ssl.TimeStampMillis)
+	require.Equal(t, "Cabc", ssl.UID)
+
+	// a timestamp in the last field with a short fraction
+	header.Names, header.Types = []string{"uid", "ts"}, []string{pt.String, pt.Time}
+	fieldMap, err = mapZeekHeaderToParseType(header, factory, logger)
+	require.Nil(t, err)
+
+	ssl = ParseTSVLine("Cabc\t1517336042.5", header, fieldMap, factory, logger).(*pt.SSL)
+	require.Equal(t, int64(1517336042), ssl.TimeStamp)
+	require.Equal(t, int64(1517336042500), ssl.TimeStampMillis)
+}
@@ -24,6 +24,9 @@ type BroHeader struct {
 type ZeekHeaderIndexMap struct {
 	NthLogFieldExistsInParseType []bool
 	NthLogFieldParseTypeOffset   []int
+	// NthLogFieldMillisOffset holds the offset of the field which also receives a time field
+	// in whole milliseconds, or -1 if there is none
+	NthLogFieldMillisOffset []int
 }
 
 //IndexedFile ties a file to a target collection and database
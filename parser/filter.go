@@ -18,6 +18,11 @@ type filter struct {
 	neverIncludedDomain  []string
 
 	filterExternalToInternal bool
+
+	knownProxies config.KnownProxies
+
+	// SNI connection timestamps are recorded in whole milliseconds rather than seconds
+	sniTimestampMillis bool
 }
 
 func newFilter(conf *config.Config) filter {
@@ -28,9 +33,20 @@ func newFilter(conf *config.Config) filter {
 		alwaysIncludedDomain:     conf.S.Filtering.AlwaysIncludeDomain,
 		neverIncludedDomain:      conf.S.Filtering.NeverIncludeDomain,
 		filterExternalToInternal: conf.S.Filtering.FilterExternalToInternal,
+		knownProxies:             conf.R.BeaconProxy.KnownProxies,
+		sniTimestampMillis:       conf.S.BeaconSNI.TimestampResolution == config.MillisecondResolution,
 	}
 }
 
+// sniTimestamp returns the timestamp recorded for an SNI connection, in whole seconds,
+// or in whole milliseconds if SNI beacons are analyzed at millisecond resolution
+func (fs *filter) sniTimestamp(seconds int64, millis int64) int64 {
+	if fs.sniTimestampMillis {
+		return millis
+	}
+	return seconds
+}
+
 // filterConnPair returns true if a connection pair is filtered/excluded.
 // This is determined by the following rules, in order:
 //   1. Not filtered if either IP is on the AlwaysInclude list
@@ -135,3 +151,8 @@ func (fs *filter) filterDomain(domain string) bool {
 func (fs *filter) checkIfInternal(host net.IP) bool {
 	return util.ContainsIP(fs.internal, host)
 }
+
+// isKnownProxy returns true if an IP is on the BeaconProxy KnownProxies list
+func (fs *filter) isKnownProxy(IP net.IP) bool {
+	return fs.knownProxies.Contains(IP)
+}
@@ -19,9 +19,11 @@ import (
 	"github.com/activecm/rita/pkg/blacklist"
 	"github.com/activecm/rita/pkg/certificate"
 	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/pkg/dedupedbeacon"
 	"github.com/activecm/rita/pkg/explodeddns"
 	"github.com/activecm/rita/pkg/host"
 	"github.com/activecm/rita/pkg/hostname"
+	"github.com/activecm/rita/pkg/mergedbeacon"
 	"github.com/activecm/rita/pkg/remover"
 	"github.com/activecm/rita/pkg/sniconn"
 	"github.com/activecm/rita/pkg/uconn"
@@ -200,17 +202,20 @@ func (fs *FSImporter) Run(indexedFiles []*files.IndexedFile, threads int) {
 		// build or update the FQDN Beacons Table
 		fs.buildFQDNBeacons(retVals.HostMap, minTimestamp, maxTimestamp)
 
-		// build or update the Proxy Beacons Table
-		fs.buildProxyBeacons(retVals.ProxyUniqueConnMap, retVals.HostMap, minTimestamp, maxTimestamp)
+		// build or update the Proxy and SNI Beacons Tables
+		fs.buildProxyAndSNIBeacons(retVals.ProxyUniqueConnMap, retVals.TLSConnMap, retVals.HTTPConnMap, retVals.HostMap, minTimestamp, maxTimestamp)
 
-		// build or update SNI Beacons Table
-		fs.buildSNIBeacons(retVals.TLSConnMap, retVals.HTTPConnMap, retVals.HostMap, minTimestamp, maxTimestamp)
+		// build the Merged Beacons table from the Proxy and SNI Beacons tables
+		fs.buildMergedBeacons()
+
+		// build the Deduped Beacons table from the SNI and FQDN Beacons tables
+		fs.buildDedupedBeacons()
 
 		// build or update UserAgent table
 		fs.buildUserAgent(retVals.UseragentMap)
 
 		// build or update Certificate table
-		fs.buildCertificates(retVals.CertificateMap)
+		fs.buildCertificates(retVals.CertificateMap, retVals.CertValidityMap)
 
 		// update blacklisted peers in hosts collection
 		fs.markBlacklistedPeers(retVals.HostMap)
@@ -318,6 +323,9 @@ func (fs *FSImporter) parseFiles(indexedFiles []*files.IndexedFile, parsingThrea
 	parseStartTime := time.Now()
 	retVals := newParseResults()
 
+	// certificate validity is only tracked when one of its flags is enabled
+	checkCertValidity := fs.config.S.Certificate.MinCertAge > 0 || fs.config.S.Certificate.ExpiryWindow > 0
+
 	//set up parallel parsing
 	n := len(indexedFiles)
 	parsingWG := new(sync.WaitGroup)
@@ -383,7 +391,12 @@ func (fs *FSImporter) parseFiles(indexedFiles []*files.IndexedFile, parsingThrea
 					case *parsetypes.OpenConn:
 						parseOpenConnEntry(typedEntry, fs.filter, retVals)
 					case *parsetypes.SSL:
-						parseSSLEntry(typedEntry, fs.filter, retVals)
+						parseSSLEntry(typedEntry, fs.filter, fs.config.S.Certificate.SNIMismatch, checkCertValidity, fs.config.S.Certificate.GroupByIssuer,
+							fs.config.S.Certificate.MinChainDepth, fs.config.S.Certificate.MaxChainDepth, retVals)
+					case *parsetypes.X509:
+						if checkCertValidity {
+							parseX509Entry(typedEntry, retVals)
+						}
 					}
 				}
 				indexedFiles[j].ParseTime = time.Now()
@@ -432,7 +445,13 @@ func (fs *FSImporter) buildExplodedDNS(domainMap map[string]int) {
 }
 
 //buildCertificates .....
-func (fs *FSImporter) buildCertificates(certMap map[string]*certificate.Input) {
+func (fs *FSImporter) buildCertificates(certMap map[string]*certificate.Input, validityMap map[string]certificate.Validity) {
+
+	minCertAge := int64(fs.config.S.Certificate.MinCertAge) * 3600
+	expiryWindow := int64(fs.config.S.Certificate.ExpiryWindow) * 3600
+	if minCertAge > 0 || expiryWindow > 0 {
+		certificate.FlagValidity(certMap, validityMap, minCertAge, expiryWindow)
+	}
 
 	if len(certMap) > 0 {
 		// Set up the database
@@ -610,39 +629,153 @@ func (fs *FSImporter) buildFQDNBeacons(hostMap map[string]*host.Input, minTimest
 
 }
 
-func (fs *FSImporter) buildProxyBeacons(uconnProxyMap map[string]*uconnproxy.Input, hostMap map[string]*host.Input, minTimestamp, maxTimestamp int64) {
+//buildProxyAndSNIBeacons runs the proxy and SNI beacon analyses. With
+//BeaconSNI.ParallelWithProxy set and both modules enabled, the analyses run at the same time
+//with their progress bars shown together, and their status lines and any errors are reported
+//once both finish. Either way, the analyses share a limit of
+//MongoDB.MaxConcurrentQueries queries at once.
+func (fs *FSImporter) buildProxyAndSNIBeacons(uconnProxyMap map[string]*uconnproxy.Input, tlsMap map[string]*sniconn.TLSInput, httpMap map[string]*sniconn.HTTPInput, hostMap map[string]*host.Input, minTimestamp, maxTimestamp int64) {
+	limiter := util.NewLimiter(fs.config.S.MongoDB.MaxConcurrentQueries)
+
+	if !fs.config.S.BeaconSNI.ParallelWithProxy || !fs.config.S.BeaconProxy.Enabled || !fs.config.S.BeaconSNI.Enabled {
+		// the errors are already logged by each module
+		fs.buildProxyBeacons(uconnProxyMap, hostMap, minTimestamp, maxTimestamp, limiter, nil)
+		fs.buildSNIBeacons(tlsMap, httpMap, hostMap, minTimestamp, maxTimestamp, limiter, nil)
+		return
+	}
+
+	fmt.Println("\t[-] Running Proxy and SNI Beacon Analysis in parallel ... ")
+	progress := util.NewProgressGroup()
+	err := runConcurrently(
+		namedTask{name: "beaconProxy", run: func() error {
+			return fs.buildProxyBeacons(uconnProxyMap, hostMap, minTimestamp, maxTimestamp, limiter, progress)
+		}},
+		namedTask{name: "beaconSNI", run: func() error {
+			return fs.buildSNIBeacons(tlsMap, httpMap, hostMap, minTimestamp, maxTimestamp, limiter, progress)
+		}},
+	)
+	progress.Wait()
+
+	if err != nil {
+		fmt.Println("\t[!] Proxy and SNI Beacon Analysis finished with errors")
+		fs.log.WithFields(log.Fields{
+			"Module": "beacons",
+			"Error":  err.Error(),
+		}).Error("parallel proxy and SNI beacon analysis failed")
+	}
+}
+
+//buildProxyBeacons runs the proxy beacon analysis, taking a slot from limiter for each
+//uconnproxy query and showing its progress and status lines in group. A nil limiter or
+//group leaves the analysis unlimited or standalone. Errors are logged and the first one
+//is returned.
+func (fs *FSImporter) buildProxyBeacons(uconnProxyMap map[string]*uconnproxy.Input, hostMap map[string]*host.Input, minTimestamp, maxTimestamp int64, limiter *util.Limiter, group *util.ProgressGroup) error {
+	var firstErr error
 	if fs.config.S.BeaconProxy.Enabled {
 		if len(uconnProxyMap) > 0 {
 			beaconProxyRepo := beaconproxy.NewMongoRepository(fs.database, fs.config, fs.log)
+			beaconProxyRepo.SetQueryLimiter(limiter)
+			beaconProxyRepo.SetProgressGroup(group)
 
 			err := beaconProxyRepo.CreateIndexes()
 			if err != nil {
 				fs.log.Error(err)
+				firstErr = err
 			}
 
 			// send proxy uconns to beacon analysis
 			beaconProxyRepo.Upsert(uconnProxyMap, hostMap, minTimestamp, maxTimestamp)
 		} else {
-			fmt.Println("\t[!] No Proxy Beacon data to analyze")
+			group.Println("\t[!] No Proxy Beacon data to analyze")
 		}
 	}
-
+	return firstErr
 }
 
-func (fs *FSImporter) buildSNIBeacons(tlsMap map[string]*sniconn.TLSInput, httpMap map[string]*sniconn.HTTPInput, hostMap map[string]*host.Input, minTimestamp, maxTimestamp int64) {
+//buildSNIBeacons runs the SNI beacon analysis, taking a slot from limiter for each SNIconn
+//pipeline and showing its progress and status lines in group. A nil limiter or group
+//leaves the analysis unlimited or standalone. Errors are logged and the first one is
+//returned.
+func (fs *FSImporter) buildSNIBeacons(tlsMap map[string]*sniconn.TLSInput, httpMap map[string]*sniconn.HTTPInput, hostMap map[string]*host.Input, minTimestamp, maxTimestamp int64, limiter *util.Limiter, group *util.ProgressGroup) error {
+	var firstErr error
 	if fs.config.S.BeaconSNI.Enabled {
 		if len(tlsMap) > 0 || len(httpMap) > 0 {
 			beaconSNIRepo := beaconsni.NewMongoRepository(fs.database, fs.config, fs.log)
+			beaconSNIRepo.SetQueryLimiter(limiter)
+			beaconSNIRepo.SetProgressGroup(group)
 
 			err := beaconSNIRepo.CreateIndexes()
 			if err != nil {
 				fs.log.Error(err)
+				firstErr = err
 			}
 
 			// send SNI conns to beacon analysis
 			beaconSNIRepo.Upsert(tlsMap, httpMap, hostMap, minTimestamp, maxTimestamp)
+
+			// a score only run leaves nothing in the beaconSNI collection to flag
+			if fs.config.S.BeaconSNI.CertCorrelation && !fs.config.S.BeaconSNI.ScoreOnly {
+				group.Println("\t[-] Correlating SNI Beacons with Invalid Certificates ... ")
+				err = beaconSNIRepo.CorrelateCertificates()
+				if err != nil {
+					group.Println("\t[!] Could not correlate SNI Beacons with Invalid Certificates")
+					fs.log.Error(err)
+					if firstErr == nil {
+						firstErr = err
+					}
+				}
+			}
+		} else {
+			group.Println("\t[!] No TLS or HTTP Beacon data to analyze")
+		}
+	}
+	return firstErr
+}
+
+func (fs *FSImporter) buildMergedBeacons() {
+	if fs.config.S.MergedBeacon.Enabled {
+		if fs.config.S.BeaconSNI.ResultSuffix != "" {
+			// the merged beacons aren't suffixed, so experimental SNI results are kept out of them
+			fmt.Println("\t[!] Merging beacons is skipped when the SNI Beacon results are suffixed")
+		} else if fs.config.S.BeaconSNI.Enabled && fs.config.S.BeaconProxy.Enabled {
+			mergedBeaconRepo := mergedbeacon.NewMongoRepository(fs.database, fs.config, fs.log)
+
+			err := mergedBeaconRepo.CreateIndexes()
+			if err != nil {
+				fs.log.Error(err)
+			}
+
+			fmt.Println("\t[-] Merging SNI and Proxy Beacons ... ")
+			err = mergedBeaconRepo.Merge()
+			if err != nil {
+				fmt.Println("\t[!] Could not merge SNI and Proxy Beacons")
+			}
+		} else {
+			fmt.Println("\t[!] Merging beacons requires both SNI and Proxy Beacon analysis")
+		}
+	}
+}
+
+func (fs *FSImporter) buildDedupedBeacons() {
+	if fs.config.S.DedupedBeacon.Enabled {
+		if fs.config.S.BeaconSNI.ResultSuffix != "" {
+			// the deduped beacons aren't suffixed, so experimental SNI results are kept out of them
+			fmt.Println("\t[!] Deduplicating beacons is skipped when the SNI Beacon results are suffixed")
+		} else if fs.config.S.BeaconSNI.Enabled && fs.config.S.BeaconFQDN.Enabled {
+			dedupedBeaconRepo := dedupedbeacon.NewMongoRepository(fs.database, fs.config, fs.log)
+
+			err := dedupedBeaconRepo.CreateIndexes()
+			if err != nil {
+				fs.log.Error(err)
+			}
+
+			fmt.Println("\t[-] Deduplicating SNI and FQDN Beacons ... ")
+			err = dedupedBeaconRepo.Dedup()
+			if err != nil {
+				fmt.Println("\t[!] Could not deduplicate SNI and FQDN Beacons")
+			}
 		} else {
-			fmt.Println("\t[!] No TLS or HTTP Beacon data to analyze")
+			fmt.Println("\t[!] Deduplicating beacons requires both SNI and FQDN Beacon analysis")
 		}
 	}
 }
@@ -667,8 +800,8 @@ func (fs *FSImporter) buildUserAgent(useragentMap map[string]*useragent.Input) {
 }
 
 func (fs *FSImporter) updateTimestampRange() (int64, int64) {
-	session := fs.database.Session.Copy()
-	defer session.Close()
+	session := fs.database.CopySession()
+	defer fs.database.CloseSession(session)
 
 	// set collection name
 	collectionName := fs.config.T.Structure.UniqueConnTable
@@ -61,6 +61,12 @@ func parseHTTPEntry(parseHTTP *parsetypes.HTTP, filter filter, retVals ParseResu
 	// check if destination is a proxy server based on HTTP method
 	dstIsProxy := (method == "CONNECT")
 
+	// proxies aren't always asked to CONNECT, so requests sent to a known
+	// proxy server are treated as proxied as well. These connections are
+	// flagged so that they can be told apart from the explicitly tagged ones.
+	proxyInferred := !dstIsProxy && filter.isKnownProxy(dstIP)
+	dstIsProxy = dstIsProxy || proxyInferred
+
 	// if the HTTP method is CONNECT, then the srcIP is communicating
 	// to an FQDN through the dstIP proxy. We need to handle that
 	// as a special case here so that we don't filter internal->internal
@@ -93,7 +99,7 @@ func parseHTTPEntry(parseHTTP *parsetypes.HTTP, filter filter, retVals ParseResu
 
 	// check if internal IP is requesting a connection through a proxy
 	if dstIsProxy {
-		updateProxiedUniqueConnectionsByHTTP(srcFQDNPair, dstUniqIP, parseHTTP, retVals)
+		updateProxiedUniqueConnectionsByHTTP(srcFQDNPair, dstUniqIP, proxyInferred, parseHTTP, retVals)
 		return
 	}
 
@@ -128,7 +134,7 @@ func updateUseragentsByHTTP(srcUniqIP data.UniqueIP, parseHTTP *parsetypes.HTTP,
 	retVals.UseragentMap[parseHTTP.UserAgent].Requests.Insert(parseHTTP.Host)
 }
 
-func updateProxiedUniqueConnectionsByHTTP(srcFQDNPair data.UniqueSrcFQDNPair, dstUniqIP data.UniqueIP,
+func updateProxiedUniqueConnectionsByHTTP(srcFQDNPair data.UniqueSrcFQDNPair, dstUniqIP data.UniqueIP, proxyInferred bool,
 	parseHTTP *parsetypes.HTTP, retVals ParseResults) {
 
 	retVals.ProxyUniqueConnLock.Lock()
@@ -140,11 +146,17 @@ func updateProxiedUniqueConnectionsByHTTP(srcFQDNPair data.UniqueSrcFQDNPair, ds
 	if _, ok := retVals.ProxyUniqueConnMap[srcFQDNKey]; !ok {
 		// create new host record with src and dst
 		retVals.ProxyUniqueConnMap[srcFQDNKey] = &uconnproxy.Input{
-			Hosts: srcFQDNPair,
-			Proxy: dstUniqIP,
+			Hosts:         srcFQDNPair,
+			Proxy:         dstUniqIP,
+			ProxyInferred: proxyInferred,
 		}
 	}
 
+	// a single explicitly tagged connection confirms the pair is proxied
+	if !proxyInferred {
+		retVals.ProxyUniqueConnMap[srcFQDNKey].ProxyInferred = false
+	}
+
 	// ///// INCREMENT THE CONNECTION COUNT FOR THE PROXIED UNIQUE CONNECTION /////
 	retVals.ProxyUniqueConnMap[srcFQDNKey].ConnectionCount++
 
@@ -154,6 +166,15 @@ func updateProxiedUniqueConnectionsByHTTP(srcFQDNPair data.UniqueSrcFQDNPair, ds
 	retVals.ProxyUniqueConnMap[srcFQDNKey].TsList = append(
 		retVals.ProxyUniqueConnMap[srcFQDNKey].TsList, ts,
 	)
+
+	// ///// APPEND BODY LENGTHS TO PROXIED UNIQUE CONNECTION BYTE LISTS /////
+	retVals.ProxyUniqueConnMap[srcFQDNKey].ReqBytesList = append(
+		retVals.ProxyUniqueConnMap[srcFQDNKey].ReqBytesList, parseHTTP.ReqLen,
+	)
+
+	retVals.ProxyUniqueConnMap[srcFQDNKey].RespBytesList = append(
+		retVals.ProxyUniqueConnMap[srcFQDNKey].RespBytesList, parseHTTP.RespLen,
+	)
 }
 
 func updateHTTPConnectionsByHTTP(srcIP net.IP, dstUniqIP data.UniqueIP, srcFQDNPair data.UniqueSrcFQDNPair, srcFQDNKey string,
@@ -186,7 +207,7 @@ func updateHTTPConnectionsByHTTP(srcIP net.IP, dstUniqIP data.UniqueIP, srcFQDNP
 
 	// ///// APPEND TIMESTAMP TO HTTP TIMESTAMP LIST /////
 	retVals.HTTPConnMap[srcFQDNKey].Timestamps = append(
-		retVals.HTTPConnMap[srcFQDNKey].Timestamps, parseHTTP.TimeStamp,
+		retVals.HTTPConnMap[srcFQDNKey].Timestamps, filter.sniTimestamp(parseHTTP.TimeStamp, parseHTTP.TimeStampMillis),
 	)
 
 	// ///// UNION DESTINATION HOST INTO HTTP RESPONDING HOSTS /////
@@ -11,6 +11,8 @@ type HTTP struct {
 	ID bson.ObjectId `bson:"_id,omitempty"`
 	// TimeStamp of this connection
 	TimeStamp int64 `bson:"ts" bro:"ts" brotype:"time" json:"-"`
+	// TimeStampMillis of this connection, in whole milliseconds
+	TimeStampMillis int64 `bson:"-" bromillis:"ts" json:"-"`
 	// TimeStampGeneric is used when reading from json files
 	TimeStampGeneric interface{} `bson:"-" json:"ts"`
 	// UID is the Unique Id for this connection (generated by Bro)
@@ -84,4 +86,5 @@ func (line *HTTP) TargetCollection(config *config.StructureTableCfg) string {
 //ConvertFromJSON performs any extra conversions necessary when reading from JSON
 func (line *HTTP) ConvertFromJSON() {
 	line.TimeStamp = convertTimestamp(line.TimeStampGeneric)
+	line.TimeStampMillis = convertMillisTimestamp(line.TimeStampGeneric)
 }
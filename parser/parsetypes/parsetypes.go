@@ -1,6 +1,7 @@
 package parsetypes
 
 import (
+	"math"
 	"strings"
 	"time"
 
@@ -41,6 +42,10 @@ func NewBroDataFactory(fileType string) func() BroData {
 		return func() BroData {
 			return &SSL{}
 		}
+	} else if strings.HasPrefix(fileType, "x509") {
+		return func() BroData {
+			return &X509{}
+		}
 	}
 	return nil
 }
@@ -74,6 +79,31 @@ func convertTimestamp(timestamp interface{}) int64 {
 	return 0
 }
 
+// convertMillisTimestamp handles a timestamp in multiple formats and converts
+// it to a Unix timestamp in whole milliseconds
+func convertMillisTimestamp(timestamp interface{}) int64 {
+	switch input := timestamp.(type) {
+	// all number types are assumed to be in unix format, possibly with fractional seconds
+	case int:
+		return int64(input) * 1000
+	case int32:
+		return int64(input) * 1000
+	case int64:
+		return input * 1000
+	case float32:
+		return int64(float64(input) * 1000)
+	case float64:
+		// rounded to the microsecond first, since fractional seconds are rarely exact as doubles
+		return int64(math.Floor(input*1e6+0.5)) / 1000
+	case string:
+		t, err := time.Parse(time.RFC3339, input)
+		if err == nil {
+			return t.UnixNano() / int64(time.Millisecond)
+		}
+	}
+	return 0
+}
+
 // Further documentation on bros datatypes can be found on the bro website at:
 // https://www.bro.org/sphinx/script-reference/types.html
 // It is of value to note that many of these types have applications specific
@@ -8,8 +8,8 @@ import (
 
 func TestNewBroDataFactory(t *testing.T) {
 
-	testCasesIn := []string{"conn", "http", "dns", "httpa", "http_a", "http_eth0", "httpasdf12345=-ASDF?", "open_conn", "ASDF"}
-	testCasesOut := []BroData{&Conn{}, &HTTP{}, &DNS{}, &HTTP{}, &HTTP{}, &HTTP{}, &HTTP{}, &OpenConn{}, nil}
+	testCasesIn := []string{"conn", "http", "dns", "httpa", "http_a", "http_eth0", "httpasdf12345=-ASDF?", "open_conn", "x509", "ASDF"}
+	testCasesOut := []BroData{&Conn{}, &HTTP{}, &DNS{}, &HTTP{}, &HTTP{}, &HTTP{}, &HTTP{}, &OpenConn{}, &X509{}, nil}
 	for i := range testCasesIn {
 		factory := NewBroDataFactory(testCasesIn[i])
 		if factory == nil {
@@ -38,3 +38,23 @@ func TestConvertTimestamp(t *testing.T) {
 		require.Equal(t, testCase.expected, actual, "input: %v", testCase.input)
 	}
 }
+
+func TestConvertMillisTimestamp(t *testing.T) {
+	testCases := []struct {
+		input    interface{}
+		expected int64
+	}{
+		{1517336042.090842, 1517336042090},
+		{1517336042.001, 1517336042001},
+		{1517336042, 1517336042000},
+		{"2018-01-30T18:14:02.5Z", 1517336042500},
+		{0, 0},
+		{"", 0},
+		{nil, 0},
+	}
+
+	for _, testCase := range testCases {
+		actual := convertMillisTimestamp(testCase.input)
+		require.Equal(t, testCase.expected, actual, "input: %v", testCase.input)
+	}
+}
@@ -8,6 +8,8 @@ import (
 type SSL struct {
 	// TimeStamp of this connection
 	TimeStamp int64 `bson:"ts" bro:"ts" brotype:"time" json:"-"`
+	// TimeStampMillis of this connection, in whole milliseconds
+	TimeStampMillis int64 `bson:"-" bromillis:"ts" json:"-"`
 	// TimeStampGeneric is used when reading from json files
 	TimeStampGeneric interface{} `bson:"-" json:"ts"`
 	// UID is the Unique Id for this connection (generated by Bro)
@@ -72,6 +74,9 @@ type SSL struct {
 	Logged bool `bson:"logged" bro:"logged" brotype:"bool" json:"logged"`
 	// CertChainFuids
 	CertChainFuids []string `bson:"cert_chain_fuids" bro:"cert_chain_fuids" brotype:"vector[string]" json:"cert_chain_fuids"`
+	// CertChainFps lists the fingerprints of the certificates the server presented, leaf first.
+	// Note: only present in newer zeek versions, which no longer log cert_chain_fuids.
+	CertChainFps []string `bson:"cert_chain_fps" bro:"cert_chain_fps" brotype:"vector[string]" json:"cert_chain_fps"`
 	// ClientCertChainFuids
 	ClientCertChainFuids []string `bson:"client_cert_chain_fuids"  bro:"client_cert_chain_fuids" brotype:"vector[string]" json:"client_cert_chain_fuids"`
 	// Subject
@@ -104,4 +109,5 @@ func (line *SSL) TargetCollection(config *config.StructureTableCfg) string {
 //ConvertFromJSON performs any extra conversions necessary when reading from JSON
 func (line *SSL) ConvertFromJSON() {
 	line.TimeStamp = convertTimestamp(line.TimeStampGeneric)
+	line.TimeStampMillis = convertMillisTimestamp(line.TimeStampGeneric)
 }
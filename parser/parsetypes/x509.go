@@ -0,0 +1,43 @@
+package parsetypes
+
+import (
+	"github.com/activecm/rita/config"
+)
+
+// X509 provides a data structure for the certificate validity data in zeek's x509 log
+type X509 struct {
+	// TimeStamp of this certificate record
+	TimeStamp int64 `bson:"ts" bro:"ts" brotype:"time" json:"-"`
+	// TimeStampGeneric is used when reading from json files
+	TimeStampGeneric interface{} `bson:"-" json:"ts"`
+	// ID is the file id of the certificate, matching an entry in ssl.log's cert_chain_fuids.
+	// Newer versions of zeek log fingerprints instead of file ids.
+	ID string `bson:"id" bro:"id" brotype:"string" json:"id"`
+	// Fingerprint of the certificate, matching an entry in ssl.log's cert_chain_fps.
+	// Note: may not be present in older zeek versions.
+	Fingerprint string `bson:"fingerprint" bro:"fingerprint" brotype:"string" json:"fingerprint"`
+	// NotValidBefore is the time the certificate becomes valid
+	NotValidBefore int64 `bson:"certificate_not_valid_before" bro:"certificate.not_valid_before" brotype:"time" json:"-"`
+	// NotValidBeforeGeneric is used when reading from json files
+	NotValidBeforeGeneric interface{} `bson:"-" json:"certificate.not_valid_before"`
+	// NotValidAfter is the time the certificate expires
+	NotValidAfter int64 `bson:"certificate_not_valid_after" bro:"certificate.not_valid_after" brotype:"time" json:"-"`
+	// NotValidAfterGeneric is used when reading from json files
+	NotValidAfterGeneric interface{} `bson:"-" json:"certificate.not_valid_after"`
+	// AgentHostname names which sensor recorded this event. Only set when combining logs from multiple sensors.
+	AgentHostname string `bson:"agent_hostname" bro:"agent_hostname" brotype:"string" json:"agent_hostname"`
+	// AgentUUID identifies which sensor recorded this event. Only set when combining logs from multiple sensors.
+	AgentUUID string `bson:"agent_uuid" bro:"agent_uuid" brotype:"string" json:"agent_uuid"`
+}
+
+//TargetCollection returns the mongo collection this entry should be inserted
+func (line *X509) TargetCollection(config *config.StructureTableCfg) string {
+	return config.X509Table
+}
+
+//ConvertFromJSON performs any extra conversions necessary when reading from JSON
+func (line *X509) ConvertFromJSON() {
+	line.TimeStamp = convertTimestamp(line.TimeStampGeneric)
+	line.NotValidBefore = convertTimestamp(line.NotValidBeforeGeneric)
+	line.NotValidAfter = convertTimestamp(line.NotValidAfterGeneric)
+}
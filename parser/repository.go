@@ -29,6 +29,8 @@ type ParseResults struct {
 	UseragentLock       *sync.Mutex
 	CertificateMap      map[string]*certificate.Input
 	CertificateLock     *sync.Mutex
+	CertValidityMap     map[string]certificate.Validity
+	CertValidityLock    *sync.Mutex
 	ExplodedDNSMap      map[string]int
 	ExplodedDNSLock     *sync.Mutex
 	TLSConnMap          map[string]*sniconn.TLSInput
@@ -54,6 +56,8 @@ func newParseResults() ParseResults {
 		UseragentLock:       new(sync.Mutex),
 		CertificateMap:      make(map[string]*certificate.Input),
 		CertificateLock:     new(sync.Mutex),
+		CertValidityMap:     make(map[string]certificate.Validity),
+		CertValidityLock:    new(sync.Mutex),
 		ExplodedDNSMap:      make(map[string]int),
 		ExplodedDNSLock:     new(sync.Mutex),
 		TLSConnMap:          make(map[string]*sniconn.TLSInput),
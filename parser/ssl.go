@@ -13,7 +13,7 @@ import (
 	"github.com/activecm/rita/util"
 )
 
-func parseSSLEntry(parseSSL *parsetypes.SSL, filter filter, retVals ParseResults) {
+func parseSSLEntry(parseSSL *parsetypes.SSL, filter filter, detectSNIMismatch bool, checkCertValidity bool, groupIssuers bool, minChainDepth int, maxChainDepth int, retVals ParseResults) {
 	src := parseSSL.Source
 	dst := parseSSL.Destination
 	certStatus := parseSSL.ValidationStatus
@@ -52,13 +52,79 @@ func parseSSLEntry(parseSSL *parsetypes.SSL, filter filter, retVals ParseResults
 
 	updateHostsBySSL(srcIP, dstIP, srcUniqIP, dstUniqIP, srcKey, dstKey, newUniqueConnection, filter, retVals)
 
-	if certificateIsInvalid {
-		updateCertificatesBySSL(srcUniqIP, dstUniqIP, dstKey, certStatus, retVals)
+	// domain fronting shows up as a certificate for a different name than the one requested.
+	// Only the subject logged alongside the SNI in the same record is compared.
+	sniMismatch := detectSNIMismatch && certificate.SNIMismatch(parseSSL.ServerName, parseSSL.Subject)
+
+	// the validity of the certificate is only known once the x509 logs have been parsed,
+	// so every server is recorded along with the certificate it presented
+	leafCert := ""
+	if checkCertValidity {
+		leafCert = leafCertificate(parseSSL)
+	}
+
+	// the depth of every chain is recorded so the depths a server presented can be reviewed,
+	// while only chains outside the configured depths get a server recorded on their own
+	depth := 0
+	if minChainDepth > 0 || maxChainDepth > 0 {
+		depth = chainDepth(parseSSL)
+	}
+	oddChain := certificate.OddChainDepth(depth, minChainDepth, maxChainDepth)
+
+	if certificateIsInvalid || sniMismatch || leafCert != "" || oddChain {
+		invalidStatus := ""
+		if certificateIsInvalid {
+			invalidStatus = certStatus
+		}
+		mismatchedSNI := ""
+		if sniMismatch {
+			mismatchedSNI = parseSSL.ServerName
+		}
+		// the names of invalid certificates are checked against the allow list during analysis,
+		// while issuers are only grouped to find infrastructure behind invalid certificates
+		var invalidCert, issued certificate.IssuedCert
+		if certificateIsInvalid {
+			invalidCert = certificate.IssuedCert{Issuer: parseSSL.Issuer, Subject: parseSSL.Subject}
+			if groupIssuers {
+				issued = invalidCert
+			}
+		}
+		updateCertificatesBySSL(srcUniqIP, dstUniqIP, dstKey, invalidStatus, mismatchedSNI, leafCert, invalidCert, issued, depth, oddChain, parseSSL.TimeStamp, retVals)
 		// the unique connection record may have been created before the certificate record was seen
 		copyServiceTuplesFromUconnToCerts(dstKey, srcDstKey, retVals)
 	}
 }
 
+//leafCertificate returns the fingerprint of the certificate the server presented, or its
+//file id for older versions of zeek. An empty string is returned if neither was logged.
+func leafCertificate(parseSSL *parsetypes.SSL) string {
+	if len(parseSSL.CertChainFps) > 0 && parseSSL.CertChainFps[0] != "-" {
+		return parseSSL.CertChainFps[0]
+	}
+	if len(parseSSL.CertChainFuids) > 0 && parseSSL.CertChainFuids[0] != "-" {
+		return parseSSL.CertChainFuids[0]
+	}
+	return ""
+}
+
+//chainDepth returns the number of certificates in the chain the server presented, counting
+//the fingerprints logged by newer versions of zeek or the file ids logged by older ones.
+//0 is returned if neither was logged.
+func chainDepth(parseSSL *parsetypes.SSL) int {
+	for _, chain := range [][]string{parseSSL.CertChainFps, parseSSL.CertChainFuids} {
+		depth := 0
+		for _, cert := range chain {
+			if cert != "-" && cert != "" {
+				depth++
+			}
+		}
+		if depth > 0 {
+			return depth
+		}
+	}
+	return 0
+}
+
 func updateUseragentsBySSL(srcUniqIP data.UniqueIP, parseSSL *parsetypes.SSL, retVals ParseResults) {
 
 	retVals.UseragentLock.Lock()
@@ -116,7 +182,7 @@ func updateTLSConnectionsBySSL(srcIP net.IP, dstUniqIP data.UniqueIP, srcFQDNPai
 
 	// ///// APPEND TIMESTAMP TO TLS TIMESTAMP LIST /////
 	retVals.TLSConnMap[srcFQDNKey].Timestamps = append(
-		retVals.TLSConnMap[srcFQDNKey].Timestamps, parseSSL.TimeStamp,
+		retVals.TLSConnMap[srcFQDNKey].Timestamps, filter.sniTimestamp(parseSSL.TimeStamp, parseSSL.TimeStampMillis),
 	)
 
 	// ///// UNION DESTINATION HOST INTO TLS RESPONDING HOSTS /////
@@ -220,7 +286,8 @@ func updateHostsBySSL(srcIP, dstIP net.IP, srcUniqIP, dstUniqIP data.UniqueIP, s
 }
 
 func updateCertificatesBySSL(srcUniqIP data.UniqueIP, dstUniqIP data.UniqueIP, dstKey string,
-	certStatus string, retVals ParseResults) {
+	invalidStatus string, mismatchedSNI string, leafCert string, invalidCert certificate.IssuedCert, issued certificate.IssuedCert,
+	chainDepth int, oddChain bool, ts int64, retVals ParseResults) {
 
 	retVals.CertificateLock.Lock()
 	defer retVals.CertificateLock.Unlock()
@@ -228,18 +295,58 @@ func updateCertificatesBySSL(srcUniqIP data.UniqueIP, dstUniqIP data.UniqueIP, d
 	if _, ok := retVals.CertificateMap[dstKey]; !ok {
 		// create new uconn record if it does not exist
 		retVals.CertificateMap[dstKey] = &certificate.Input{
-			Host:         dstUniqIP,
-			OrigIps:      make(data.UniqueIPSet),
-			InvalidCerts: make(data.StringSet),
-			Tuples:       make(data.StringSet),
+			Host:             dstUniqIP,
+			OrigIps:          make(data.UniqueIPSet),
+			InvalidCerts:     make(data.StringSet),
+			Tuples:           make(data.StringSet),
+			SNIMismatches:    make(data.StringSet),
+			Issued:           make(certificate.IssuedCertSet),
+			InvalidCertNames: make(certificate.CertNameSet),
+			LeafCerts:        make(map[string]*certificate.CertSighting),
+			ChainDepths:      make(data.IntSet),
 		}
 	}
 
-	// ///// INCREMENT CONNECTION COUNTER FOR DESTINATION WITH INVALID CERTIFICATE /////
-	retVals.CertificateMap[dstKey].Seen++
+	if invalidStatus != "" {
+		// ///// INCREMENT CONNECTION COUNTER FOR DESTINATION WITH INVALID CERTIFICATE /////
+		retVals.CertificateMap[dstKey].Seen++
+
+		// ///// UNION CERTIFICATE STATUS INTO SET OF CERTIFICATE STATUSES FOR DESTINATINO HOST /////
+		retVals.CertificateMap[dstKey].InvalidCerts.Insert(invalidStatus)
+
+		// ///// UNION ISSUER AND SUBJECT INTO SET OF INVALID CERTIFICATE NAMES FOR DESTINATION HOST /////
+		retVals.CertificateMap[dstKey].InvalidCertNames.Insert(invalidCert)
+	}
+
+	// ///// UNION ISSUER AND SUBJECT INTO SET OF CERTIFICATES THE DESTINATION PRESENTED /////
+	retVals.CertificateMap[dstKey].Issued.Insert(issued)
 
-	// ///// UNION CERTIFICATE STATUS INTO SET OF CERTIFICATE STATUSES FOR DESTINATINO HOST /////
-	retVals.CertificateMap[dstKey].InvalidCerts.Insert(certStatus)
+	// ///// UNION MISMATCHED SERVER NAME INTO SET OF SERVER NAMES THE CERTIFICATE DIDN'T MATCH /////
+	if mismatchedSNI != "" {
+		retVals.CertificateMap[dstKey].SNIMismatches.Insert(mismatchedSNI)
+	}
+
+	// ///// UNION CHAIN DEPTH INTO SET OF CHAIN DEPTHS THE DESTINATION PRESENTED /////
+	if chainDepth > 0 {
+		retVals.CertificateMap[dstKey].ChainDepths.Insert(chainDepth)
+	}
+	if oddChain {
+		retVals.CertificateMap[dstKey].OddChainDepth = true
+	}
+
+	// ///// RECORD WHEN THE DESTINATION PRESENTED ITS CERTIFICATE /////
+	if leafCert != "" {
+		if sighting, ok := retVals.CertificateMap[dstKey].LeafCerts[leafCert]; ok {
+			if ts < sighting.FirstSeen {
+				sighting.FirstSeen = ts
+			}
+			if ts > sighting.LastSeen {
+				sighting.LastSeen = ts
+			}
+		} else {
+			retVals.CertificateMap[dstKey].LeafCerts[leafCert] = &certificate.CertSighting{FirstSeen: ts, LastSeen: ts}
+		}
+	}
 
 	// ///// UNION SOURCE HOST INTO SET OF HOSTS WHICH FETCHED THE DESTINATION'S INVALID CERTIFICATE /////
 	retVals.CertificateMap[dstKey].OrigIps.Insert(srcUniqIP)
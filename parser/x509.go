@@ -0,0 +1,28 @@
+package parser
+
+import (
+	"github.com/activecm/rita/parser/parsetypes"
+	"github.com/activecm/rita/pkg/certificate"
+)
+
+func parseX509Entry(parseX509 *parsetypes.X509, retVals ParseResults) {
+	// certificates missing either end of their validity period can't be checked
+	if parseX509.NotValidBefore <= 0 || parseX509.NotValidAfter <= 0 {
+		return
+	}
+
+	validity := certificate.Validity{
+		NotValidBefore: parseX509.NotValidBefore,
+		NotValidAfter:  parseX509.NotValidAfter,
+	}
+
+	retVals.CertValidityLock.Lock()
+	defer retVals.CertValidityLock.Unlock()
+
+	// ///// RECORD THE VALIDITY PERIOD UNDER EACH KEY SSL.LOG MAY USE FOR THE CERTIFICATE /////
+	for _, key := range []string{parseX509.ID, parseX509.Fingerprint} {
+		if key != "" && key != "-" {
+			retVals.CertValidityMap[key] = validity
+		}
+	}
+}
@@ -26,7 +26,7 @@ type (
 		conf             *config.Config       // contains details needed to access MongoDB
 		log              *log.Logger          // main logger for RITA
 		analyzedCallback func(mgoBulkActions) // analysis results are sent to this callback as MongoDB bulk actions
-		closedCallback   func()               // called when .close() is called and no more calls to analyzedCallback will be made
+		closedCallback   func() error         // called when .close() is called and no more calls to analyzedCallback will be made
 		analysisChannel  chan *uconn.Input    // holds unanalyzed unique connection data
 		analysisWg       sync.WaitGroup       // wait for analysis to finish
 	}
@@ -34,7 +34,7 @@ type (
 
 //newAnalyzer creates a new analyzer for calculating the beacon statistics of unique connections
 func newAnalyzer(min int64, max int64, chunk int, db *database.DB, conf *config.Config, log *log.Logger,
-	analyzedCallback func(mgoBulkActions), closedCallback func()) *analyzer {
+	analyzedCallback func(mgoBulkActions), closedCallback func() error) *analyzer {
 	return &analyzer{
 		tsMin:            min,
 		tsMax:            max,
@@ -53,11 +53,11 @@ func (a *analyzer) collect(data *uconn.Input) {
 	a.analysisChannel <- data
 }
 
-//close waits for the analyzer to finish
-func (a *analyzer) close() {
+//close waits for the analyzer to finish and returns any error from the rest of the closing cascade
+func (a *analyzer) close() error {
 	close(a.analysisChannel)
 	a.analysisWg.Wait()
-	a.closedCallback()
+	return a.closedCallback()
 }
 
 //start kicks off a new analysis thread
@@ -16,14 +16,14 @@ type (
 		db                *database.DB       // provides access to MongoDB
 		conf              *config.Config     // contains details needed to access MongoDB
 		dissectedCallback func(*uconn.Input) // gathered unique connection details are sent to this callback
-		closedCallback    func()             // called when .close() is called and no more calls to dissectedCallback will be made
+		closedCallback    func() error       // called when .close() is called and no more calls to dissectedCallback will be made
 		dissectChannel    chan *uconn.Input  // holds data to be processed
 		dissectWg         sync.WaitGroup     // wait for dissector to finish
 	}
 )
 
 //newDissector creates a new dissector for gathering data
-func newDissector(connLimit int64, db *database.DB, conf *config.Config, dissectedCallback func(*uconn.Input), closedCallback func()) *dissector {
+func newDissector(connLimit int64, db *database.DB, conf *config.Config, dissectedCallback func(*uconn.Input), closedCallback func() error) *dissector {
 	return &dissector{
 		connLimit:         connLimit,
 		db:                db,
@@ -39,19 +39,19 @@ func (d *dissector) collect(datum *uconn.Input) {
 	d.dissectChannel <- datum
 }
 
-//close waits for the dissector to finish
-func (d *dissector) close() {
+//close waits for the dissector to finish and returns any error from the rest of the closing cascade
+func (d *dissector) close() error {
 	close(d.dissectChannel)
 	d.dissectWg.Wait()
-	d.closedCallback()
+	return d.closedCallback()
 }
 
 //start kicks off a new dissector thread
 func (d *dissector) start() {
 	d.dissectWg.Add(1)
 	go func() {
-		ssn := d.db.Session.Copy()
-		defer ssn.Close()
+		ssn := d.db.CopySession()
+		defer d.db.CloseSession(ssn)
 
 		for datum := range d.dissectChannel {
 
@@ -11,8 +11,6 @@ import (
 	"github.com/activecm/rita/util"
 
 	"github.com/globalsign/mgo"
-	"github.com/vbauerster/mpb"
-	"github.com/vbauerster/mpb/decor"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -33,8 +31,8 @@ func NewMongoRepository(db *database.DB, conf *config.Config, logger *log.Logger
 }
 
 func (r *repo) CreateIndexes() error {
-	session := r.database.Session.Copy()
-	defer session.Close()
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
 
 	// set collection name
 	collectionName := r.config.T.Beacon.BeaconTable
@@ -114,23 +112,21 @@ func (r *repo) Upsert(uconnMap map[string]*uconn.Input, hostMap map[string]*host
 	}
 
 	// progress bar for troubleshooting
-	p := mpb.New(mpb.WithWidth(20))
-	bar := p.AddBar(int64(len(uconnMap)),
-		mpb.PrependDecorators(
-			decor.Name("\t[-] Beacon Analysis:", decor.WC{W: 30, C: decor.DidentRight}),
-			decor.CountersNoUnit(" %d / %d ", decor.WCSyncWidth),
-		),
-		mpb.AppendDecorators(decor.Percentage()),
-	)
+	bar := util.NewCountedProgress("\t[-] Beacon Analysis:", int64(len(uconnMap)))
 	// loop over map entries
 	for _, entry := range uconnMap {
 		dissectorWorker.collect(entry)
-		bar.IncrBy(1)
+		bar.Increment()
 	}
-	p.Wait()
+	bar.Wait()
 
 	// start the closing cascade (this will also close the other channels)
-	dissectorWorker.close()
+	if err := dissectorWorker.close(); err != nil {
+		r.log.WithFields(log.Fields{
+			"Module": "beacon",
+			"Error":  err.Error(),
+		}).Error("beacon results were not fully saved")
+	}
 
 	// Phase 2: Summary
 
@@ -161,23 +157,21 @@ func (r *repo) Upsert(uconnMap map[string]*uconn.Input, hostMap map[string]*host
 	}
 
 	// add a progress bar for troubleshooting
-	p = mpb.New(mpb.WithWidth(20))
-	bar = p.AddBar(int64(len(localHosts)),
-		mpb.PrependDecorators(
-			decor.Name("\t[-] Beacon Aggregation:", decor.WC{W: 30, C: decor.DidentRight}),
-			decor.CountersNoUnit(" %d / %d ", decor.WCSyncWidth),
-		),
-		mpb.AppendDecorators(decor.Percentage()),
-	)
+	bar = util.NewCountedProgress("\t[-] Beacon Aggregation:", int64(len(localHosts)))
 
 	// loop over the local hosts that need to be summarized
 	for _, localHost := range localHosts {
 		summarizerWorker.collect(localHost)
-		bar.IncrBy(1)
+		bar.Increment()
 	}
 
-	p.Wait()
+	bar.Wait()
 
 	// start the closing cascade (this will also close the other channels)
-	summarizerWorker.close()
+	if err := summarizerWorker.close(); err != nil {
+		r.log.WithFields(log.Fields{
+			"Module": "beacon",
+			"Error":  err.Error(),
+		}).Error("beacon summaries were not fully saved")
+	}
 }
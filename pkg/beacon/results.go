@@ -7,8 +7,8 @@ import (
 
 //Results finds beacons in the database greater than a given cutoffScore
 func Results(res *resources.Resources, cutoffScore float64) ([]Result, error) {
-	ssn := res.DB.Session.Copy()
-	defer ssn.Close()
+	ssn := res.DB.CopySession()
+	defer res.DB.CloseSession(ssn)
 
 	var beacons []Result
 
@@ -23,8 +23,8 @@ func Results(res *resources.Resources, cutoffScore float64) ([]Result, error) {
 //The results will be sorted by connection count ordered by sortDir (-1 or 1).
 //limit and noLimit control how many results are returned.
 func StrobeResults(res *resources.Resources, sortDir, limit int, noLimit bool) ([]StrobeResult, error) {
-	ssn := res.DB.Session.Copy()
-	defer ssn.Close()
+	ssn := res.DB.CopySession()
+	defer res.DB.CloseSession(ssn)
 
 	var strobes []StrobeResult
 
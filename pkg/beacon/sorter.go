@@ -18,7 +18,7 @@ type (
 		db             *database.DB       // provides access to MongoDB
 		conf           *config.Config     // contains details needed to access MongoDB
 		sortedCallback func(*uconn.Input) // called on each sorted result
-		closedCallback func()             // called when .close() is called and no more calls to sortedCallback will be made
+		closedCallback func() error       // called when .close() is called and no more calls to sortedCallback will be made
 		sortChannel    chan *uconn.Input  // holds unsorted data
 		sortWg         sync.WaitGroup     // wait for analysis to finish
 	}
@@ -26,7 +26,7 @@ type (
 
 //newSorter creates a new sorter which sorts unique connection data
 //for use in quantile based statistics
-func newSorter(db *database.DB, conf *config.Config, sortedCallback func(*uconn.Input), closedCallback func()) *sorter {
+func newSorter(db *database.DB, conf *config.Config, sortedCallback func(*uconn.Input), closedCallback func() error) *sorter {
 	return &sorter{
 		db:             db,
 		conf:           conf,
@@ -41,11 +41,11 @@ func (s *sorter) collect(data *uconn.Input) {
 	s.sortChannel <- data
 }
 
-//close waits for the sorter to finish
-func (s *sorter) close() {
+//close waits for the sorter to finish and returns any error from the rest of the closing cascade
+func (s *sorter) close() error {
 	close(s.sortChannel)
 	s.sortWg.Wait()
-	s.closedCallback()
+	return s.closedCallback()
 }
 
 //start kicks off a new sorter thread
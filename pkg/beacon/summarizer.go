@@ -19,14 +19,14 @@ type (
 		conf               *config.Config       // contains details needed to access MongoDB
 		log                *log.Logger          // main logger for RITA
 		summarizedCallback func(mgoBulkActions) // called on each summarized result
-		closedCallback     func()               // called when .close() is called and no more calls to summarizedCallback will be made
+		closedCallback     func() error         // called when .close() is called and no more calls to summarizedCallback will be made
 		summaryChannel     chan data.UniqueIP   // holds unsummarized data
 		summaryWg          sync.WaitGroup       // wait for summary to finish
 	}
 )
 
 //newSummarizer creates a new summarizer for beacon data
-func newSummarizer(chunk int, db *database.DB, conf *config.Config, log *log.Logger, summarizedCallback func(mgoBulkActions), closedCallback func()) *summarizer {
+func newSummarizer(chunk int, db *database.DB, conf *config.Config, log *log.Logger, summarizedCallback func(mgoBulkActions), closedCallback func() error) *summarizer {
 	return &summarizer{
 		chunk:              chunk,
 		db:                 db,
@@ -43,11 +43,11 @@ func (s *summarizer) collect(datum data.UniqueIP) {
 	s.summaryChannel <- datum
 }
 
-//close waits for the summarizer to finish
-func (s *summarizer) close() {
+//close waits for the summarizer to finish and returns any error from the rest of the closing cascade
+func (s *summarizer) close() error {
 	close(s.summaryChannel)
 	s.summaryWg.Wait()
-	s.closedCallback()
+	return s.closedCallback()
 }
 
 //start kicks off a new summary thread
@@ -55,8 +55,8 @@ func (s *summarizer) start() {
 	s.summaryWg.Add(1)
 	go func() {
 
-		ssn := s.db.Session.Copy()
-		defer ssn.Close()
+		ssn := s.db.CopySession()
+		defer s.db.CloseSession(ssn)
 
 		for datum := range s.summaryChannel {
 			beaconCollection := ssn.DB(s.db.GetSelectedDB()).C(s.conf.T.Beacon.BeaconTable)
@@ -1,7 +1,10 @@
 package beacon
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
@@ -18,6 +21,7 @@ type (
 		writeChannel chan mgoBulkActions // holds analyzed data
 		writeWg      sync.WaitGroup      // wait for writing to finish
 		writerName   string              // used in error reporting
+		failed       int64               // number of final writes which failed after being retried
 	}
 )
 
@@ -37,18 +41,23 @@ func (w *mgoBulkWriter) collect(data mgoBulkActions) {
 	w.writeChannel <- data
 }
 
-//close waits for the write threads to finish
-func (w *mgoBulkWriter) close() {
+//close waits for the write threads to finish. An error is returned if any of the
+//final writes failed, since the results they held were not saved.
+func (w *mgoBulkWriter) close() error {
 	close(w.writeChannel)
 	w.writeWg.Wait()
+	if failed := atomic.LoadInt64(&w.failed); failed > 0 {
+		return fmt.Errorf("%s: %d final writes could not be saved", w.writerName, failed)
+	}
+	return nil
 }
 
 //start kicks off a new write thread
 func (w *mgoBulkWriter) start() {
 	w.writeWg.Add(1)
 	go func() {
-		ssn := w.db.Session.Copy()
-		defer ssn.Close()
+		ssn := w.db.CopySession()
+		defer w.db.CloseSession(ssn)
 
 		bulkBuffers := map[string]*mgo.Bulk{}
 		bulkBufferLengths := map[string]int{}
@@ -79,9 +88,13 @@ func (w *mgoBulkWriter) start() {
 				}
 			}
 		}
+		// nothing else will write these results out, so give transient errors a chance to clear
+		retries := w.conf.S.MongoDB.FlushRetries
+		backoff := time.Duration(w.conf.S.MongoDB.FlushBackoff) * time.Millisecond
 		for tgtColl, bulkBuffer := range bulkBuffers {
-			info, err := bulkBuffer.Run()
+			info, err := database.RetryBulk(ssn, retries, backoff, bulkBuffer.Run)
 			if err != nil {
+				atomic.AddInt64(&w.failed, 1)
 				w.log.WithFields(log.Fields{
 					"Module":     w.writerName,
 					"Collection": tgtColl,
@@ -16,14 +16,14 @@ type (
 		db                *database.DB     // provides access to MongoDB
 		conf              *config.Config   // contains details needed to access MongoDB
 		dissectedCallback func(*fqdnInput) // gathered unique connection details are sent to this callback
-		closedCallback    func()           // called when .close() is called and no more calls to analyzedCallback will be made
+		closedCallback    func() error     // called when .close() is called and no more calls to analyzedCallback will be made
 		dissectChannel    chan *fqdnInput  // holds data to be processed
 		dissectWg         sync.WaitGroup   // wait for analysis to finish
 	}
 )
 
 //newdissector creates a new dissector for gathering data
-func newDissector(connLimit int64, db *database.DB, conf *config.Config, dissectedCallback func(*fqdnInput), closedCallback func()) *dissector {
+func newDissector(connLimit int64, db *database.DB, conf *config.Config, dissectedCallback func(*fqdnInput), closedCallback func() error) *dissector {
 	return &dissector{
 		connLimit:         connLimit,
 		db:                db,
@@ -39,11 +39,11 @@ func (d *dissector) collect(entry *fqdnInput) {
 	d.dissectChannel <- entry
 }
 
-//close waits for the dissector to finish
-func (d *dissector) close() {
+//close waits for the dissector to finish and returns any error from the rest of the closing cascade
+func (d *dissector) close() error {
 	close(d.dissectChannel)
 	d.dissectWg.Wait()
-	d.closedCallback()
+	return d.closedCallback()
 }
 
 /*
@@ -139,8 +139,8 @@ func (d *dissector) start() {
 	d.dissectWg.Add(1)
 
 	go func() {
-		ssn := d.db.Session.Copy()
-		defer ssn.Close()
+		ssn := d.db.CopySession()
+		defer d.db.CloseSession(ssn)
 
 		for entry := range d.dissectChannel {
 			// This will work for both updating and inserting completely new Beacons
@@ -3,7 +3,6 @@ package beaconfqdn
 import (
 	"fmt"
 	"runtime"
-	"time"
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
@@ -11,11 +10,8 @@ import (
 	"github.com/activecm/rita/pkg/host"
 	"github.com/activecm/rita/util"
 
-	"github.com/briandowns/spinner"
 	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
-	"github.com/vbauerster/mpb"
-	"github.com/vbauerster/mpb/decor"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -36,8 +32,8 @@ func NewMongoRepository(db *database.DB, conf *config.Config, logger *log.Logger
 }
 
 func (r *repo) CreateIndexes() error {
-	session := r.database.Session.Copy()
-	defer session.Close()
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
 
 	// set collection name
 	collectionName := r.config.T.BeaconFQDN.BeaconFQDNTable
@@ -74,12 +70,10 @@ func (r *repo) CreateIndexes() error {
 //may have been contacted. Then it gathers the associated IPs for each of the
 //hostnames, passing them onto the beacon analysis.
 func (r *repo) Upsert(hostMap map[string]*host.Input, minTimestamp, maxTimestamp int64) {
-	session := r.database.Session.Copy()
-	defer session.Close()
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
 
-	s := spinner.New(spinner.CharSets[36], 200*time.Millisecond)
-	s.Prefix = "\t[-] Gathering FQDNs for Beacon Analysis ...\t"
-	s.Start()
+	gathering := util.NewIndeterminateProgress("\t[-] Gathering FQDNs for Beacon Analysis")
 
 	// determine which hostnames need their fqdn beacon entries updated by
 	// checking which hostnames are associated with the external IPs we saw in this import run.
@@ -97,8 +91,7 @@ func (r *repo) Upsert(hostMap map[string]*host.Input, minTimestamp, maxTimestamp
 		r.log.WithError(err).Error("could not determine which hostnames need beacon data updates")
 	}
 
-	s.Stop()
-	fmt.Println()
+	gathering.Wait()
 
 	if len(affectedHostnames) == 0 {
 		fmt.Println("\t[!] No FQDN Beacon data to analyze")
@@ -155,14 +148,7 @@ func (r *repo) Upsert(hostMap map[string]*host.Input, minTimestamp, maxTimestamp
 	}
 
 	// progress bar for troubleshooting
-	p := mpb.New(mpb.WithWidth(20))
-	bar := p.AddBar(int64(len(affectedHostnames)),
-		mpb.PrependDecorators(
-			decor.Name("\t[-] FQDN Beacon Analysis:", decor.WC{W: 30, C: decor.DidentRight}),
-			decor.CountersNoUnit(" %d / %d ", decor.WCSyncWidth),
-		),
-		mpb.AppendDecorators(decor.Percentage()),
-	)
+	bar := util.NewCountedProgress("\t[-] FQDN Beacon Analysis:", int64(len(affectedHostnames)))
 
 	// loop over map entries (each hostname)
 	for _, entry := range affectedHostnames {
@@ -185,14 +171,19 @@ func (r *repo) Upsert(hostMap map[string]*host.Input, minTimestamp, maxTimestamp
 		}
 
 		// progress bar increment
-		bar.IncrBy(1)
+		bar.Increment()
 
 	}
 
-	p.Wait()
+	bar.Wait()
 
 	// start the closing cascade (this will also close the other channels)
-	dissectorWorker.close()
+	if err := dissectorWorker.close(); err != nil {
+		r.log.WithFields(log.Fields{
+			"Module": "beaconsFQDN",
+			"Error":  err.Error(),
+		}).Error("FQDN beacon results were not fully saved")
+	}
 
 	// Phase 2: Summary
 
@@ -228,24 +219,22 @@ func (r *repo) Upsert(hostMap map[string]*host.Input, minTimestamp, maxTimestamp
 	}
 
 	// add a progress bar for troubleshooting
-	p = mpb.New(mpb.WithWidth(20))
-	bar = p.AddBar(int64(len(localHosts)),
-		mpb.PrependDecorators(
-			decor.Name("\t[-] FQDN Beacon Aggregation:", decor.WC{W: 30, C: decor.DidentRight}),
-			decor.CountersNoUnit(" %d / %d ", decor.WCSyncWidth),
-		),
-		mpb.AppendDecorators(decor.Percentage()),
-	)
+	bar = util.NewCountedProgress("\t[-] FQDN Beacon Aggregation:", int64(len(localHosts)))
 
 	// loop over the local hosts that need to be summarized
 	for _, localHost := range localHosts {
 		summarizerWorker.collect(localHost)
-		bar.IncrBy(1)
+		bar.Increment()
 	}
-	p.Wait()
+	bar.Wait()
 
 	// start the closing cascade (this will also close the other channels)
-	summarizerWorker.close()
+	if err := summarizerWorker.close(); err != nil {
+		r.log.WithFields(log.Fields{
+			"Module": "beaconsFQDN",
+			"Error":  err.Error(),
+		}).Error("FQDN beacon summaries were not fully saved")
+	}
 }
 
 // affectedHostnameIPs gathers all of the hostnames associated with the external IPs which generated
@@ -274,8 +263,8 @@ func (r *repo) affectedHostnameIPsSimple(hostMap map[string]*host.Input) ([]host
 	externalHosts := make([]data.UniqueIP, 0, len(hostMap)/2)
 	var affectedHostnamesBuffer []hostnameIPs
 
-	ssn := r.database.Session.Copy()
-	defer ssn.Close()
+	ssn := r.database.CopySession()
+	defer r.database.CloseSession(ssn)
 
 	for _, host := range hostMap {
 		if host.IsLocal {
@@ -304,8 +293,8 @@ func (r *repo) affectedHostnameIPsChunked(hostMap map[string]*host.Input) ([]hos
 	externalHosts := make([]data.UniqueIP, 0, util.Min(200000, len(hostMap)/2))
 	var affectedHostnamesBuffer []hostnameIPs
 
-	ssn := r.database.Session.Copy()
-	defer ssn.Close()
+	ssn := r.database.CopySession()
+	defer r.database.CloseSession(ssn)
 
 	// we will need to remove duplicate results from each query of 200,000 hosts, slowing down the process
 	// and consuming more RAM
@@ -17,7 +17,7 @@ type (
 		db             *database.DB     // provides access to MongoDB
 		conf           *config.Config   // contains details needed to access MongoDB
 		sortedCallback func(*fqdnInput) // called on each sorted result
-		closedCallback func()           // called when .close() is called and no more calls to analyzedCallback will be made
+		closedCallback func() error     // called when .close() is called and no more calls to analyzedCallback will be made
 		sortChannel    chan *fqdnInput  // holds unsorted data
 		sortWg         sync.WaitGroup   // wait for analysis to finish
 	}
@@ -25,7 +25,7 @@ type (
 
 //newsorter creates a new sorter which sorts (src->fqdn) connection data
 //for use in quantile based statistics
-func newSorter(db *database.DB, conf *config.Config, sortedCallback func(*fqdnInput), closedCallback func()) *sorter {
+func newSorter(db *database.DB, conf *config.Config, sortedCallback func(*fqdnInput), closedCallback func() error) *sorter {
 	return &sorter{
 		db:             db,
 		conf:           conf,
@@ -40,11 +40,11 @@ func (s *sorter) collect(entry *fqdnInput) {
 	s.sortChannel <- entry
 }
 
-//close waits for the sorter to finish
-func (s *sorter) close() {
+//close waits for the sorter to finish and returns any error from the rest of the closing cascade
+func (s *sorter) close() error {
 	close(s.sortChannel)
 	s.sortWg.Wait()
-	s.closedCallback()
+	return s.closedCallback()
 }
 
 //start kicks off a new sorter thread
@@ -1,7 +1,10 @@
 package beaconfqdn
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
@@ -18,6 +21,7 @@ type (
 		log              *log.Logger    // main logger for RITA
 		writeChannel     chan update    // holds analyzed data
 		writeWg          sync.WaitGroup // wait for writing to finish
+		failed           int64          // number of final writes which failed after being retried
 	}
 )
 
@@ -37,18 +41,23 @@ func (w *writer) collect(data update) {
 	w.writeChannel <- data
 }
 
-//close waits for the write threads to finish
-func (w *writer) close() {
+//close waits for the write threads to finish. An error is returned if any of the
+//final writes failed, since the results they held were not saved.
+func (w *writer) close() error {
 	close(w.writeChannel)
 	w.writeWg.Wait()
+	if failed := atomic.LoadInt64(&w.failed); failed > 0 {
+		return fmt.Errorf("%s: %d final writes could not be saved", w.targetCollection, failed)
+	}
+	return nil
 }
 
 //start kicks off a new write thread
 func (w *writer) start() {
 	w.writeWg.Add(1)
 	go func() {
-		ssn := w.db.Session.Copy()
-		defer ssn.Close()
+		ssn := w.db.CopySession()
+		defer w.db.CloseSession(ssn)
 
 		bulk := ssn.DB(w.db.GetSelectedDB()).C(w.targetCollection).Bulk()
 		bulk.Unordered()
@@ -91,8 +100,12 @@ func (w *writer) start() {
 			sizeBytes += actionSize
 		}
 
-		info, err := bulk.Run()
+		// nothing else will write these results out, so give transient errors a chance to clear
+		retries := w.conf.S.MongoDB.FlushRetries
+		backoff := time.Duration(w.conf.S.MongoDB.FlushBackoff) * time.Millisecond
+		info, err := database.RetryBulk(ssn, retries, backoff, bulk.Run)
 		if err != nil {
+			atomic.AddInt64(&w.failed, 1)
 			w.log.WithFields(log.Fields{
 				"Module": "beaconsFQDN",
 				"Info":   info,
@@ -26,7 +26,7 @@ type (
 		conf             *config.Config         // contains details needed to access MongoDB
 		log              *log.Logger            // main logger for RITA
 		analyzedCallback func(mgoBulkActions)   // called on each analyzed result
-		closedCallback   func()                 // called when .close() is called and no more calls to analyzedCallback will be made
+		closedCallback   func() error           // called when .close() is called and no more calls to analyzedCallback will be made
 		analysisChannel  chan *uconnproxy.Input // holds unanalyzed data
 		analysisWg       sync.WaitGroup         // wait for analysis to finish
 	}
@@ -34,7 +34,7 @@ type (
 
 //newAnalyzer creates a new analyzer for calculating the beacon statistics of proxied unique connections
 func newAnalyzer(min int64, max int64, chunk int, db *database.DB, conf *config.Config, log *log.Logger,
-	analyzedCallback func(mgoBulkActions), closedCallback func()) *analyzer {
+	analyzedCallback func(mgoBulkActions), closedCallback func() error) *analyzer {
 	return &analyzer{
 		tsMin:            min,
 		tsMax:            max,
@@ -53,11 +53,11 @@ func (a *analyzer) collect(data *uconnproxy.Input) {
 	a.analysisChannel <- data
 }
 
-//close waits for the analyzer to finish
-func (a *analyzer) close() {
+//close waits for the analyzer to finish and returns any error from the rest of the closing cascade
+func (a *analyzer) close() error {
 	close(a.analysisChannel)
 	a.analysisWg.Wait()
-	a.closedCallback()
+	return a.closedCallback()
 }
 
 //start kicks off a new analysis thread
@@ -74,7 +74,15 @@ func (a *analyzer) start() {
 				// copy variables to be used by bulk callback to prevent capturing by reference
 				pairSelector := entry.Hosts.BSONKey()
 				update := mgoBulkActions{
-					a.conf.T.Structure.UniqueConnProxyTable: func(b *mgo.Bulk) int {
+					a.conf.T.BeaconProxy.BeaconProxyTable: func(b *mgo.Bulk) int {
+						b.Remove(pairSelector)
+						return 1
+					},
+				}
+				// a domain group exceeding the limit does not make any single
+				// FQDN in the group a strobe, so only per FQDN pairs are flagged
+				if len(entry.GroupedFQDNs) == 0 {
+					update[a.conf.T.Structure.UniqueConnProxyTable] = func(b *mgo.Bulk) int {
 						b.Upsert(
 							pairSelector,
 							bson.M{
@@ -82,11 +90,7 @@ func (a *analyzer) start() {
 							},
 						)
 						return 1
-					},
-					a.conf.T.BeaconProxy.BeaconProxyTable: func(b *mgo.Bulk) int {
-						b.Remove(pairSelector)
-						return 1
-					},
+					}
 				}
 				a.analyzedCallback(update)
 			} else {
@@ -182,6 +186,7 @@ func (a *analyzer) start() {
 					"$set": bson.M{
 						"connection_count":   entry.ConnectionCount,
 						"proxy":              entry.Proxy,
+						"proxy_inferred":     entry.ProxyInferred,
 						"src_network_name":   entry.Hosts.SrcNetworkName,
 						"ts.range":           tsIntervalRange,
 						"ts.mode":            tsMode,
@@ -194,6 +199,8 @@ func (a *analyzer) start() {
 						"ts.score":           tsScore,
 						"score":              score,
 						"cid":                a.chunk,
+						"domain_grouped":     len(entry.GroupedFQDNs) > 0,
+						"grouped_fqdns":      entry.GroupedFQDNs,
 					},
 				}
 
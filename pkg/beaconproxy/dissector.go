@@ -1,28 +1,53 @@
 package beaconproxy
 
 import (
+	"fmt"
+	"net"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
 	"github.com/activecm/rita/pkg/uconnproxy"
+	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
 )
 
 type (
 	dissector struct {
-		connLimit         int64                   // limit for strobe classification
-		db                *database.DB            // provides access to MongoDB
-		conf              *config.Config          // contains details needed to access MongoDB
-		dissectedCallback func(*uconnproxy.Input) // called on each analyzed result
-		closedCallback    func()                  // called when .close() is called and no more calls to analyzedCallback will be made
-		dissectChannel    chan *uconnproxy.Input  // holds unanalyzed data
-		dissectWg         sync.WaitGroup          // wait for analysis to finish
+		connLimit         int64                        // limit for strobe classification
+		db                *database.DB                 // provides access to MongoDB
+		conf              *config.Config               // contains details needed to access MongoDB
+		dissectedCallback func(*uconnproxy.Input)      // called on each analyzed result
+		closedCallback    func(dissectorSummary) error // called with the run summary when .close() is called and no more calls to analyzedCallback will be made
+		dissectChannel    chan *uconnproxy.Input       // holds unanalyzed data
+		dissectWg         sync.WaitGroup               // wait for analysis to finish
+		summary           *dissectorSummary            // counts the outcome of each dissected pair
+		internalSubnets   []*net.IPNet                 // subnets considered internal to the network
+		internalFQDNs     map[string]bool              // caches whether each FQDN is internal when only external destinations are analyzed
+		internalFQDNsMu   sync.Mutex                   // guards internalFQDNs
+		queryLimiter      *util.Limiter                // caps the per pair queries run at once, shared with other modules (nil if unlimited)
+	}
+
+	//dissectorSummary reports how a dissector run went. The counters are updated atomically
+	//by the dissector threads and are final once closedCallback is called.
+	dissectorSummary struct {
+		Examined   int64 // pairs collected by the dissector
+		Beacons    int64 // pairs sent on for beacon analysis
+		Strobes    int64 // pairs sent on as strobes
+		Errors     int64 // pairs which could not be read from MongoDB or had duplicate documents
+		Dropped    int64 // pairs dropped for having too few unique timestamps
+		Internal   int64 // pairs skipped for connecting to an internal destination
+		Duplicates int64 // pairs with more than one uconnproxy document, counted when BeaconProxy.DuplicateDocuments is error or merge
+		QueryTime  int64 // nanoseconds spent running uconnproxy pipelines, summed over every dissector thread
 	}
 )
 
 //newdissector creates a new collector for gathering data
-func newDissector(connLimit int64, db *database.DB, conf *config.Config, dissectedCallback func(*uconnproxy.Input), closedCallback func()) *dissector {
+func newDissector(connLimit int64, db *database.DB, conf *config.Config, dissectedCallback func(*uconnproxy.Input), closedCallback func(dissectorSummary) error) *dissector {
 	return &dissector{
 		connLimit:         connLimit,
 		db:                db,
@@ -30,32 +55,54 @@ func newDissector(connLimit int64, db *database.DB, conf *config.Config, dissect
 		dissectedCallback: dissectedCallback,
 		closedCallback:    closedCallback,
 		dissectChannel:    make(chan *uconnproxy.Input),
+		summary:           &dissectorSummary{},
+		internalSubnets:   util.ParseSubnets(conf.S.Filtering.InternalSubnets),
+		internalFQDNs:     make(map[string]bool),
 	}
 }
 
+//enableQueryLimiter makes the dissector take a slot from limiter for every query it runs for a
+//pair, so modules sharing the limiter don't overwhelm MongoDB together
+func (d *dissector) enableQueryLimiter(limiter *util.Limiter) {
+	d.queryLimiter = limiter
+}
+
 //collect sends a chunk of data to be analyzed
 func (d *dissector) collect(entry *uconnproxy.Input) {
 	d.dissectChannel <- entry
 }
 
-//close waits for the collector to finish
-func (d *dissector) close() {
+//close waits for the collector to finish and returns any error from the rest of the closing cascade
+func (d *dissector) close() error {
 	close(d.dissectChannel)
 	d.dissectWg.Wait()
-	d.closedCallback()
+	return d.closedCallback(*d.summary)
 }
 
 //start kicks off a new analysis thread
 func (d *dissector) start() {
 	d.dissectWg.Add(1)
 	go func() {
-		ssn := d.db.Session.Copy()
-		defer ssn.Close()
+		ssn := d.db.CopySession()
+		defer d.db.CloseSession(ssn)
 
 		for datum := range d.dissectChannel {
+			atomic.AddInt64(&d.summary.Examined, 1)
+
+			// proxied connections to internal destinations are usually benign
+			if d.conf.S.BeaconProxy.ExternalOnly && d.internalDestination(ssn, datum.Hosts.FQDN) {
+				atomic.AddInt64(&d.summary.Internal, 1)
+				continue
+			}
 
 			matchNoStrobeKey := datum.Hosts.BSONKey()
 
+			// when grouping by registrable domain, the pair stands in for the
+			// uconnproxy records of every FQDN in the group
+			if len(datum.GroupedFQDNs) > 0 {
+				matchNoStrobeKey["fqdn"] = bson.M{"$in": datum.GroupedFQDNs}
+			}
+
 			// we are able to filter out already flagged strobes here
 			// because we use the uconnproxy table to access them. The uconnproxy table has
 			// already had its counts and stats updated.
@@ -101,13 +148,38 @@ func (d *dissector) start() {
 				}},
 			}
 
+			if len(datum.GroupedFQDNs) > 0 {
+				uconnProxyFindQuery = groupedFindQuery(matchNoStrobeKey, d.conf.S.BeaconProxy.DefaultConnectionThresh)
+			} else if duplicates, err := d.duplicateDocuments(ssn, matchNoStrobeKey); err != nil {
+				atomic.AddInt64(&d.summary.Errors, 1)
+				continue
+			} else if duplicates {
+				// the $limit stage assumes the pair has a single document, so extra
+				// documents point to a data integrity problem
+				atomic.AddInt64(&d.summary.Duplicates, 1)
+				if d.conf.S.BeaconProxy.DuplicateDocuments == config.DuplicatesError {
+					atomic.AddInt64(&d.summary.Errors, 1)
+					continue
+				}
+				uconnProxyFindQuery = mergeDuplicates(uconnProxyFindQuery)
+			}
+
 			var res struct {
 				Count  int64   `bson:"count"`
 				Ts     []int64 `bson:"ts"`
 				TsFull []int64 `bson:"ts_full"`
 			}
 
-			_ = ssn.DB(d.db.GetSelectedDB()).C(d.conf.T.Structure.UniqueConnProxyTable).Pipe(uconnProxyFindQuery).AllowDiskUse().One(&res)
+			d.queryLimiter.Acquire()
+			queryStart := time.Now()
+			err := ssn.DB(d.db.GetSelectedDB()).C(d.conf.T.Structure.UniqueConnProxyTable).Pipe(uconnProxyFindQuery).AllowDiskUse().One(&res)
+			atomic.AddInt64(&d.summary.QueryTime, int64(time.Since(queryStart)))
+			d.queryLimiter.Release()
+
+			// not found just means the pair didn't meet the connection threshold
+			if err != nil && err != mgo.ErrNotFound {
+				atomic.AddInt64(&d.summary.Errors, 1)
+			}
 
 			// Check for errors and parse results
 			// this is here because it will still return an empty document even if there are no results
@@ -116,12 +188,15 @@ func (d *dissector) start() {
 					Hosts:           datum.Hosts,
 					Proxy:           datum.Proxy,
 					ConnectionCount: res.Count,
+					GroupedFQDNs:    datum.GroupedFQDNs,
+					ProxyInferred:   datum.ProxyInferred,
 				}
 
 				// check if uconnproxy has become a strobe
 				if analysisInput.ConnectionCount > d.connLimit {
 
 					// set to sorter channel
+					atomic.AddInt64(&d.summary.Strobes, 1)
 					d.dissectedCallback(analysisInput)
 
 				} else { // otherwise, parse timestamps
@@ -129,9 +204,29 @@ func (d *dissector) start() {
 					analysisInput.TsList = res.Ts
 					analysisInput.TsListFull = res.TsFull
 
+					// a single page load through a proxy fetches several objects within a few seconds,
+					// so optionally treat every connection within the window as one check-in
+					if window := d.conf.S.BeaconProxy.DedupWindow; window > 0 {
+						analysisInput.TsList = dedupTimestamps(res.TsFull, int64(window))
+					}
+
 					// send to sorter channel if we have over UNIQUE 3 timestamps (analysis needs this verification)
 					if len(analysisInput.TsList) > 3 {
+						if d.conf.S.BeaconProxy.ByteRatios {
+							d.queryLimiter.Acquire()
+							ratios, err := byteRatios(ssn.DB(d.db.GetSelectedDB()).C(d.conf.T.Structure.UniqueConnProxyTable), matchNoStrobeKey)
+							d.queryLimiter.Release()
+							if err != nil {
+								// the pair is still analyzed, just without its byte ratios
+								atomic.AddInt64(&d.summary.Errors, 1)
+							}
+							analysisInput.ByteRatioList = ratios
+						}
+
+						atomic.AddInt64(&d.summary.Beacons, 1)
 						d.dissectedCallback(analysisInput)
+					} else {
+						atomic.AddInt64(&d.summary.Dropped, 1)
 					}
 
 				}
@@ -140,3 +235,162 @@ func (d *dissector) start() {
 		d.dissectWg.Done()
 	}()
 }
+
+//duplicateDocuments reports whether more than one uconnproxy document matches the given key.
+//Documents are only counted when BeaconProxy.DuplicateDocuments is error or merge.
+func (d *dissector) duplicateDocuments(ssn *mgo.Session, matchKey bson.M) (bool, error) {
+	handling := d.conf.S.BeaconProxy.DuplicateDocuments
+	if handling != config.DuplicatesError && handling != config.DuplicatesMerge {
+		return false, nil
+	}
+	d.queryLimiter.Acquire()
+	count, err := ssn.DB(d.db.GetSelectedDB()).C(d.conf.T.Structure.UniqueConnProxyTable).Find(matchKey).Count()
+	d.queryLimiter.Release()
+	return count > 1, err
+}
+
+//mergeDuplicates replaces the $limit stage of the given uconnproxy query with stages joining
+//every matched document into one. The dat chunks of the documents are concatenated, while the
+//_id and any other fields are taken from the first document.
+func mergeDuplicates(query []bson.M) []bson.M {
+	merged := make([]bson.M, 0, len(query)+1)
+	for _, stage := range query {
+		if _, ok := stage["$limit"]; !ok {
+			merged = append(merged, stage)
+			continue
+		}
+		merged = append(merged,
+			bson.M{"$group": bson.M{
+				"_id":   nil,
+				"first": bson.M{"$first": "$$ROOT"},
+				"dat":   bson.M{"$push": bson.M{"$ifNull": []interface{}{"$dat", []interface{}{}}}},
+			}},
+			bson.M{"$replaceRoot": bson.M{"newRoot": bson.M{
+				"$mergeObjects": []interface{}{"$first", bson.M{"dat": bson.M{"$reduce": bson.M{
+					"input":        "$dat",
+					"initialValue": []interface{}{},
+					"in":           bson.M{"$concatArrays": []interface{}{"$$value", "$$this"}},
+				}}}},
+			}}},
+		)
+	}
+	return merged
+}
+
+//String formats the summary as a single report line
+func (s dissectorSummary) String() string {
+	return fmt.Sprintf("beaconproxy: %d examined, %d beacons, %d strobes, %d errors, %d dropped, %d internal, %d duplicates",
+		s.Examined, s.Beacons, s.Strobes, s.Errors, s.Dropped, s.Internal, s.Duplicates)
+}
+
+//dedupTimestamps sorts the given timestamps in place and returns the first timestamp of each
+//check-in. A check-in starts at the first timestamp more than window seconds after the start
+//of the previous check-in. Measuring from the start rather than the previous timestamp keeps
+//steady traffic from chaining into a single check-in.
+func dedupTimestamps(tsFull []int64, window int64) []int64 {
+	// the sorter would sort the timestamps anyways, so sorting them in place costs nothing extra
+	sort.Sort(util.SortableInt64(tsFull))
+
+	var checkIns []int64
+	for _, ts := range tsFull {
+		if len(checkIns) == 0 || ts-checkIns[len(checkIns)-1] > window {
+			checkIns = append(checkIns, ts)
+		}
+	}
+	return checkIns
+}
+
+//groupedFindQuery gathers the timestamps and connection counts across all of the uconnproxy
+//records matched by matchKey so a domain group can be analyzed as a single pair. Unlike the
+//per FQDN query, every record in the group has to be merged before the threshold is checked.
+func groupedFindQuery(matchKey bson.M, connThresh int) []bson.M {
+	return []bson.M{
+		{"$match": matchKey},
+		{"$project": bson.M{
+			"ts":    "$dat.ts",
+			"count": bson.M{"$sum": "$dat.count"},
+		}},
+		{"$group": bson.M{
+			"_id":   nil,
+			"ts":    bson.M{"$push": "$ts"},
+			"count": bson.M{"$sum": "$count"},
+		}},
+		{"$match": bson.M{"count": bson.M{"$gt": connThresh}}},
+		{"$unwind": "$ts"},
+		{"$unwind": "$ts"},
+		{"$unwind": "$ts"},
+		{"$group": bson.M{
+			"_id":     "$_id",
+			"ts":      bson.M{"$addToSet": "$ts"},
+			"ts_full": bson.M{"$push": "$ts"},
+			"count":   bson.M{"$first": "$count"},
+		}},
+		{"$project": bson.M{
+			"_id":     0,
+			"ts":      1,
+			"ts_full": 1,
+			"count":   1,
+		}},
+	}
+}
+
+//byteRatios gathers the request and response body lengths of every connection in the
+//uconnproxy records matched by matchKey and returns the response to request ratio of each
+//connection. Records written before body lengths were stored simply contribute no ratios.
+func byteRatios(coll *mgo.Collection, matchKey bson.M) ([]float64, error) {
+	var docs []struct {
+		ReqBytes  []int64 `bson:"req_bytes"`
+		RespBytes []int64 `bson:"resp_bytes"`
+	}
+
+	err := coll.Pipe([]bson.M{
+		{"$match": matchKey},
+		{"$project": bson.M{
+			"_id":        0,
+			"req_bytes":  flattenDat("$dat.req_bytes"),
+			"resp_bytes": flattenDat("$dat.resp_bytes"),
+		}},
+	}).AllowDiskUse().All(&docs)
+	if err != nil {
+		return nil, err
+	}
+
+	var ratios []float64
+	for _, doc := range docs {
+		ratios = append(ratios, computeByteRatios(doc.ReqBytes, doc.RespBytes)...)
+	}
+	return ratios, nil
+}
+
+//flattenDat concatenates the per chunk arrays found at path into a single array,
+//treating chunks which are missing the array as empty
+func flattenDat(path string) bson.M {
+	return bson.M{"$reduce": bson.M{
+		"input":        path,
+		"initialValue": []interface{}{},
+		"in": bson.M{"$concatArrays": []interface{}{
+			"$$value",
+			bson.M{"$ifNull": []interface{}{"$$this", []interface{}{}}},
+		}},
+	}}
+}
+
+//computeByteRatios divides each response body length by the matching request body length.
+//Most requests (e.g. GET) carry no body, so a zero length request is counted as a single byte
+//rather than being dropped. If the lists are uneven, only the connections found in both are used.
+func computeByteRatios(reqBytes []int64, respBytes []int64) []float64 {
+	n := len(reqBytes)
+	if len(respBytes) < n {
+		n = len(respBytes)
+	}
+
+	ratios := make([]float64, 0, n)
+	for i := 0; i < n; i++ {
+		req := reqBytes[i]
+		if req <= 0 {
+			req = 1
+		}
+		ratios = append(ratios, float64(respBytes[i])/float64(req))
+	}
+	return ratios
+}
@@ -0,0 +1,45 @@
+package beaconproxy
+
+import (
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeByteRatios(t *testing.T) {
+	ratios := computeByteRatios([]int64{100, 0, 50, 10}, []int64{1000, 300, 50})
+
+	assert.Equal(t, []float64{10, 300, 1}, ratios, "zero length requests should count as a single byte and uneven lists should be trimmed")
+	assert.Empty(t, computeByteRatios(nil, nil))
+}
+
+func TestDedupTimestamps(t *testing.T) {
+	// three page loads an hour apart, each fetching several objects
+	tsFull := []int64{3601, 0, 7200, 1, 3600, 2, 3602, 7204}
+
+	assert.Equal(t, []int64{0, 3600, 7200}, dedupTimestamps(tsFull, 5))
+	assert.Equal(t, []int64{0, 1, 2, 3600, 3601, 3602, 7200, 7204}, tsFull, "the timestamps should be sorted in place")
+
+	// a window of 0 only merges identical timestamps
+	assert.Equal(t, []int64{0, 1, 2, 3600}, dedupTimestamps([]int64{2, 0, 0, 1, 3600, 3600}, 0))
+
+	// check-ins are measured from their first timestamp so steady traffic isn't merged into one
+	assert.Equal(t, []int64{0, 4, 8}, dedupTimestamps([]int64{0, 2, 4, 6, 8}, 3))
+}
+
+func TestMergeDuplicates(t *testing.T) {
+	query := []bson.M{
+		{"$match": bson.M{"src": "10.0.0.1"}},
+		{"$limit": 1},
+		{"$project": bson.M{"ts": "$dat.ts"}},
+	}
+
+	merged := mergeDuplicates(query)
+	assert.Len(t, merged, 4)
+	assert.Equal(t, query[0], merged[0])
+	assert.NotContains(t, merged, bson.M{"$limit": 1}, "every matched document should be read")
+	assert.Contains(t, merged[1], "$group")
+	assert.Contains(t, merged[2], "$replaceRoot")
+	assert.Equal(t, query[2], merged[3])
+}
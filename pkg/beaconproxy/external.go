@@ -0,0 +1,85 @@
+package beaconproxy
+
+import (
+	"net"
+
+	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+//internalDestination returns true if the given FQDN is internal to the network. Each FQDN
+//is shared by the pairs of every host which contacted it, so the result is cached for the
+//rest of the run.
+func (d *dissector) internalDestination(ssn *mgo.Session, fqdn string) bool {
+	d.internalFQDNsMu.Lock()
+	internal, ok := d.internalFQDNs[fqdn]
+	d.internalFQDNsMu.Unlock()
+	if ok {
+		return internal
+	}
+
+	internal = d.classifyFQDN(fqdn, func() ([]string, error) {
+		return d.resolvedIPs(ssn, fqdn)
+	})
+
+	d.internalFQDNsMu.Lock()
+	d.internalFQDNs[fqdn] = internal
+	d.internalFQDNsMu.Unlock()
+	return internal
+}
+
+//classifyFQDN decides if the given FQDN is internal to the network. Proxied connections
+//are recorded by the FQDN requested from the proxy rather than by the IP address the proxy
+//connected to, so the FQDN is checked in turn against:
+//  - the internal subnets, if the proxy was asked for an IP address directly
+//  - BeaconProxy.InternalDomains, for internal domains missing from the DNS logs
+//  - the IPs the FQDN resolved to in the DNS logs, which must all be internal
+//FQDNs which never resolved are treated as external, so they are still analyzed.
+func (d *dissector) classifyFQDN(fqdn string, resolve func() ([]string, error)) bool {
+	if ip := net.ParseIP(fqdn); ip != nil {
+		return util.ContainsIP(d.internalSubnets, ip)
+	}
+
+	if util.ContainsDomain(d.conf.S.BeaconProxy.InternalDomains, fqdn) {
+		return true
+	}
+
+	resolvedIPs, err := resolve()
+	if err != nil || len(resolvedIPs) == 0 {
+		return false
+	}
+
+	for _, resolvedIP := range resolvedIPs {
+		ip := net.ParseIP(resolvedIP)
+		if ip == nil || !util.ContainsIP(d.internalSubnets, ip) {
+			return false
+		}
+	}
+	return true
+}
+
+//resolvedIPs returns the IPs the given FQDN resolved to across every chunk of the hostnames collection
+func (d *dissector) resolvedIPs(ssn *mgo.Session, fqdn string) ([]string, error) {
+	var res struct {
+		IPs []string `bson:"ips"`
+	}
+
+	d.queryLimiter.Acquire()
+	err := ssn.DB(d.db.GetSelectedDB()).C(d.conf.T.DNS.HostnamesTable).Pipe([]bson.M{
+		{"$match": bson.M{"host": fqdn}},
+		{"$project": bson.M{"ips": "$dat.ips.ip"}},
+		{"$unwind": "$ips"},
+		{"$unwind": "$ips"},
+		{"$group": bson.M{
+			"_id": "$_id",
+			"ips": bson.M{"$addToSet": "$ips"},
+		}},
+	}).One(&res)
+	d.queryLimiter.Release()
+
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	return res.IPs, err
+}
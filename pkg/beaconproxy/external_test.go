@@ -0,0 +1,34 @@
+package beaconproxy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyFQDN(t *testing.T) {
+	conf := &config.Config{}
+	conf.S.BeaconProxy.InternalDomains = []string{"*.corp.example.com"}
+	d := &dissector{
+		conf:            conf,
+		internalSubnets: util.ParseSubnets([]string{"10.0.0.0/8"}),
+	}
+
+	resolvesTo := func(ips ...string) func() ([]string, error) {
+		return func() ([]string, error) { return ips, nil }
+	}
+
+	assert.True(t, d.classifyFQDN("10.1.2.3", resolvesTo()), "internal IP addresses are internal")
+	assert.False(t, d.classifyFQDN("8.8.8.8", resolvesTo()), "public IP addresses are external")
+	assert.True(t, d.classifyFQDN("wiki.corp.example.com", resolvesTo("8.8.8.8")), "internal domains are internal regardless of DNS")
+	assert.True(t, d.classifyFQDN("corp.example.com", resolvesTo()), "wildcards should match the top domain")
+	assert.True(t, d.classifyFQDN("nas.example.com", resolvesTo("10.0.0.5", "10.0.0.6")))
+	assert.False(t, d.classifyFQDN("mixed.example.com", resolvesTo("10.0.0.5", "1.1.1.1")), "any external address makes the FQDN external")
+	assert.False(t, d.classifyFQDN("unknown.example.com", resolvesTo()), "FQDNs which never resolved are external")
+	assert.False(t, d.classifyFQDN("error.example.com", func() ([]string, error) {
+		return nil, errors.New("lookup failed")
+	}), "failed lookups should not hide a beacon")
+}
@@ -0,0 +1,83 @@
+package beaconproxy
+
+import (
+	"strings"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/pkg/uconnproxy"
+	"github.com/activecm/rita/util"
+	"golang.org/x/net/publicsuffix"
+)
+
+//domainCache memoizes the registrable domain (effective TLD+1) of each FQDN
+//since many source hosts tend to contact the same FQDNs
+type domainCache map[string]string
+
+//registrableDomain returns the effective TLD+1 of the given FQDN according to the
+//public suffix list (e.g. a1.evil.co.uk -> evil.co.uk). IP addresses and names which
+//are themselves public suffixes are returned unchanged.
+func (c domainCache) registrableDomain(fqdn string) string {
+	if domain, ok := c[fqdn]; ok {
+		return domain
+	}
+
+	domain := fqdn
+	if !util.IsIP(fqdn) {
+		etldPlusOne, err := publicsuffix.EffectiveTLDPlusOne(strings.TrimSuffix(strings.ToLower(fqdn), "."))
+		if err == nil {
+			domain = etldPlusOne
+		}
+	}
+
+	c[fqdn] = domain
+	return domain
+}
+
+//groupByDomain merges the unique proxy connections of each source host by the registrable
+//domain of their FQDNs so that campaigns spread over many subdomains are analyzed as one.
+//The FQDNs making up each group are recorded in GroupedFQDNs. The group's Proxy is the proxy
+//carrying the most of its connections, with ties going to the lowest proxy key, so the same
+//proxy is stored on every run.
+func groupByDomain(uconnProxyMap map[string]*uconnproxy.Input) map[string]*uconnproxy.Input {
+	cache := make(domainCache)
+	groups := make(map[string]*uconnproxy.Input)
+	proxyCounts := make(map[string]map[string]int64) // connections through each proxy, by group
+
+	for _, entry := range uconnProxyMap {
+		src := data.UniqueIP{
+			IP:          entry.Hosts.SrcIP,
+			NetworkUUID: entry.Hosts.SrcNetworkUUID,
+			NetworkName: entry.Hosts.SrcNetworkName,
+		}
+		groupHosts := data.NewUniqueSrcFQDNPair(src, cache.registrableDomain(entry.Hosts.FQDN))
+		groupKey := groupHosts.MapKey()
+
+		group, ok := groups[groupKey]
+		if !ok {
+			group = &uconnproxy.Input{
+				Hosts:         groupHosts,
+				Proxy:         entry.Proxy,
+				ProxyInferred: true,
+			}
+			groups[groupKey] = group
+			proxyCounts[groupKey] = make(map[string]int64)
+		}
+
+		// the group is only inferred if none of its FQDNs were explicitly proxied
+		group.ProxyInferred = group.ProxyInferred && entry.ProxyInferred
+
+		if !util.StringInSlice(entry.Hosts.FQDN, group.GroupedFQDNs) {
+			group.GroupedFQDNs = append(group.GroupedFQDNs, entry.Hosts.FQDN)
+		}
+
+		proxyKey := entry.Proxy.MapKey()
+		counts := proxyCounts[groupKey]
+		counts[proxyKey] += entry.ConnectionCount
+		best := group.Proxy.MapKey()
+		if counts[proxyKey] > counts[best] || (counts[proxyKey] == counts[best] && proxyKey < best) {
+			group.Proxy = entry.Proxy
+		}
+	}
+
+	return groups
+}
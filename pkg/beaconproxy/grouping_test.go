@@ -0,0 +1,96 @@
+package beaconproxy
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/pkg/uconnproxy"
+	"github.com/activecm/rita/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistrableDomain(t *testing.T) {
+	cache := make(domainCache)
+
+	assert.Equal(t, "evil.com", cache.registrableDomain("a1.evil.com"))
+	assert.Equal(t, "evil.co.uk", cache.registrableDomain("b2.c3.evil.co.uk"))
+	assert.Equal(t, "10.1.2.3", cache.registrableDomain("10.1.2.3"), "ip addresses should not be grouped")
+	assert.Equal(t, "evil.com", cache["a1.evil.com"], "results should be cached")
+}
+
+func TestGroupByDomain(t *testing.T) {
+	src := data.UniqueIP{
+		IP:          "10.0.0.1",
+		NetworkUUID: util.UnknownPrivateNetworkUUID,
+		NetworkName: util.UnknownPrivateNetworkName,
+	}
+	input := make(map[string]*uconnproxy.Input)
+	for _, fqdn := range []string{"a1.evil.com", "b2.evil.com", "www.good.org"} {
+		pair := data.NewUniqueSrcFQDNPair(src, fqdn)
+		input[pair.MapKey()] = &uconnproxy.Input{Hosts: pair}
+	}
+
+	groups := groupByDomain(input)
+	assert.Equal(t, 2, len(groups))
+
+	evil := groups[data.NewUniqueSrcFQDNPair(src, "evil.com").MapKey()]
+	if assert.NotNil(t, evil) {
+		assert.ElementsMatch(t, []string{"a1.evil.com", "b2.evil.com"}, evil.GroupedFQDNs)
+	}
+}
+
+func TestGroupByDomainProxyInferred(t *testing.T) {
+	src := data.UniqueIP{
+		IP:          "10.0.0.1",
+		NetworkUUID: util.UnknownPrivateNetworkUUID,
+		NetworkName: util.UnknownPrivateNetworkName,
+	}
+	input := make(map[string]*uconnproxy.Input)
+	for fqdn, inferred := range map[string]bool{"a1.evil.com": true, "b2.evil.com": false, "www.good.org": true} {
+		pair := data.NewUniqueSrcFQDNPair(src, fqdn)
+		input[pair.MapKey()] = &uconnproxy.Input{Hosts: pair, ProxyInferred: inferred}
+	}
+
+	groups := groupByDomain(input)
+	assert.False(t, groups[data.NewUniqueSrcFQDNPair(src, "evil.com").MapKey()].ProxyInferred,
+		"a group with an explicitly proxied FQDN should not be inferred")
+	assert.True(t, groups[data.NewUniqueSrcFQDNPair(src, "good.org").MapKey()].ProxyInferred)
+}
+
+func TestGroupByDomainProxy(t *testing.T) {
+	src := data.UniqueIP{
+		IP:          "10.0.0.1",
+		NetworkUUID: util.UnknownPrivateNetworkUUID,
+		NetworkName: util.UnknownPrivateNetworkName,
+	}
+	proxy := func(ip string) data.UniqueIP {
+		return data.UniqueIP{IP: ip, NetworkUUID: util.UnknownPrivateNetworkUUID, NetworkName: util.UnknownPrivateNetworkName}
+	}
+
+	entries := []struct {
+		fqdn  string
+		proxy string
+		count int64
+	}{
+		{"a1.evil.com", "10.0.0.9", 10},
+		{"b2.evil.com", "10.0.0.8", 30},
+		{"c3.evil.com", "10.0.0.9", 15},
+		{"a1.good.org", "10.0.0.7", 5},
+		{"b2.good.org", "10.0.0.6", 5},
+	}
+
+	// the proxy shouldn't depend on the order the entries are visited in
+	for i := 0; i < 20; i++ {
+		input := make(map[string]*uconnproxy.Input)
+		for _, entry := range entries {
+			pair := data.NewUniqueSrcFQDNPair(src, entry.fqdn)
+			input[pair.MapKey()] = &uconnproxy.Input{Hosts: pair, Proxy: proxy(entry.proxy), ConnectionCount: entry.count}
+		}
+
+		groups := groupByDomain(input)
+		assert.Equal(t, "10.0.0.8", groups[data.NewUniqueSrcFQDNPair(src, "evil.com").MapKey()].Proxy.IP,
+			"the proxy carrying the most connections should be kept")
+		assert.Equal(t, "10.0.0.6", groups[data.NewUniqueSrcFQDNPair(src, "good.org").MapKey()].Proxy.IP,
+			"ties should go to the lowest proxy")
+	}
+}
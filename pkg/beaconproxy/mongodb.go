@@ -2,6 +2,7 @@ package beaconproxy
 
 import (
 	"runtime"
+	"time"
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
@@ -11,16 +12,17 @@ import (
 	"github.com/activecm/rita/util"
 
 	"github.com/globalsign/mgo"
-	"github.com/vbauerster/mpb"
-	"github.com/vbauerster/mpb/decor"
+	"github.com/globalsign/mgo/bson"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type repo struct {
-	database *database.DB
-	config   *config.Config
-	log      *log.Logger
+	database     *database.DB
+	config       *config.Config
+	log          *log.Logger
+	queryLimiter *util.Limiter       // caps the queries run at once by the dissector (nil if unlimited)
+	progress     *util.ProgressGroup // shows the progress bars alongside other modules (nil if standalone)
 }
 
 //NewMongoRepository create new repository
@@ -32,9 +34,21 @@ func NewMongoRepository(db *database.DB, conf *config.Config, logger *log.Logger
 	}
 }
 
+//SetQueryLimiter shares limiter with the dissector, which takes a slot for every query it runs
+//for a pair. The same limiter may be shared with other modules running at the same time.
+func (r *repo) SetQueryLimiter(limiter *util.Limiter) {
+	r.queryLimiter = limiter
+}
+
+//SetProgressGroup shows the progress bars of the analysis in group rather than on their own,
+//so they can be displayed alongside the bars of other modules running at the same time
+func (r *repo) SetProgressGroup(group *util.ProgressGroup) {
+	r.progress = group
+}
+
 func (r *repo) CreateIndexes() error {
-	session := r.database.Session.Copy()
-	defer session.Close()
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
 
 	// set collection name
 	collectionName := r.config.T.BeaconProxy.BeaconProxyTable
@@ -68,12 +82,68 @@ func (r *repo) CreateIndexes() error {
 	return nil
 }
 
+//CountEligible estimates how many source IP, FQDN pairs will be dissected during proxy beacon
+//analysis of the current chunk: pairs updated in the current chunk which have not been flagged
+//as strobes and made more connections than BeaconProxy.DefaultConnectionThresh. Pairs are
+//counted per FQDN even when BeaconProxy.GroupByDomain is enabled.
+func CountEligible(db *database.DB, conf *config.Config) (int64, error) {
+	session := db.CopySession()
+	defer db.CloseSession(session)
+
+	var res struct {
+		Count int64 `bson:"count"`
+	}
+
+	err := session.DB(db.GetSelectedDB()).C(conf.T.Structure.UniqueConnProxyTable).
+		Pipe(countEligiblePipeline(conf.S.Rolling.CurrentChunk, conf.S.BeaconProxy.DefaultConnectionThresh)).
+		AllowDiskUse().One(&res)
+
+	// $count doesn't output a document when nothing matches
+	if err == mgo.ErrNotFound {
+		return 0, nil
+	}
+	return res.Count, err
+}
+
+//countEligiblePipeline counts the uconnproxy documents updated in the given chunk which
+//aren't strobes and whose connection counts add up to more than connThresh
+func countEligiblePipeline(chunk int, connThresh int) []bson.M {
+	return []bson.M{
+		{"$match": bson.M{
+			"cid":    chunk,
+			"strobe": bson.M{"$ne": true},
+		}},
+		{"$project": bson.M{
+			"_id":   0,
+			"count": bson.M{"$sum": "$dat.count"},
+		}},
+		{"$match": bson.M{"count": bson.M{"$gt": connThresh}}},
+		{"$count": "count"},
+	}
+}
+
 //Upsert derives beacon statistics from the given unique proxy connections and creates
 //summaries for the given local hosts. The results are pushed to MongoDB.
 func (r *repo) Upsert(uconnProxyMap map[string]*uconnproxy.Input, hostMap map[string]*host.Input, minTimestamp, maxTimestamp int64) {
+	// the run is profiled once it returns, after the host summaries have been written
+	var summary dissectorSummary
+	if profileFile := r.config.S.Log.ProfileFile; profileFile != "" {
+		started := time.Now()
+		defer func() {
+			r.appendProfile(profileFile, summary, time.Since(started))
+		}()
+	}
+
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	// sources such as scanners and monitoring servers are never analyzed
+	uconnProxyMap = filterSources(uconnProxyMap, r.config.R.Filtering.NeverAnalyzeSources)
 
-	session := r.database.Session.Copy()
-	defer session.Close()
+	// optionally analyze each source host's traffic per registrable domain instead of per FQDN
+	if r.config.S.BeaconProxy.GroupByDomain {
+		uconnProxyMap = groupByDomain(uconnProxyMap)
+	}
 
 	// Create the workers
 
@@ -84,6 +154,8 @@ func (r *repo) Upsert(uconnProxyMap map[string]*uconnproxy.Input, hostMap map[st
 		r.log,
 		"beaconsProxy",
 	)
+	writerWorker.enableAttackTags(r.config.T.BeaconProxy.BeaconProxyTable, r.config.S.AttackTags.Rules.For(config.BeaconProxyAnalysis))
+	writerWorker.enableScoreBuckets(r.config.T.BeaconProxy.BeaconProxyTable, r.config.S.ScoreBuckets.Buckets())
 
 	// stage 4 - perform the analysis
 	analyzerWorker := newAnalyzer(
@@ -111,9 +183,24 @@ func (r *repo) Upsert(uconnProxyMap map[string]*uconnproxy.Input, hostMap map[st
 		r.database,
 		r.config,
 		sorterWorker.collect,
-		sorterWorker.close,
+		func(dissected dissectorSummary) error {
+			summary = dissected
+			r.log.WithFields(log.Fields{
+				"Module":     "beaconsProxy",
+				"Examined":   summary.Examined,
+				"Beacons":    summary.Beacons,
+				"Strobes":    summary.Strobes,
+				"Errors":     summary.Errors,
+				"Dropped":    summary.Dropped,
+				"Internal":   summary.Internal,
+				"Duplicates": summary.Duplicates,
+			}).Info(summary.String())
+			return sorterWorker.close()
+		},
 	)
 
+	dissectorWorker.enableQueryLimiter(r.queryLimiter)
+
 	// kick off the threaded goroutines
 	for i := 0; i < util.Max(1, runtime.NumCPU()/2); i++ {
 		dissectorWorker.start()
@@ -123,14 +210,7 @@ func (r *repo) Upsert(uconnProxyMap map[string]*uconnproxy.Input, hostMap map[st
 	}
 
 	// progress bar for troubleshooting
-	p := mpb.New(mpb.WithWidth(20))
-	bar := p.AddBar(int64(len(uconnProxyMap)),
-		mpb.PrependDecorators(
-			decor.Name("\t[-] Proxy Beacon Analysis:", decor.WC{W: 30, C: decor.DidentRight}),
-			decor.CountersNoUnit(" %d / %d ", decor.WCSyncWidth),
-		),
-		mpb.AppendDecorators(decor.Percentage()),
-	)
+	bar := r.progress.NewCountedProgress("\t[-] Proxy Beacon Analysis:", int64(len(uconnProxyMap)))
 
 	// loop over map entries (each hostname)
 	for _, entry := range uconnProxyMap {
@@ -138,13 +218,18 @@ func (r *repo) Upsert(uconnProxyMap map[string]*uconnproxy.Input, hostMap map[st
 		dissectorWorker.collect(entry)
 
 		// progress bar increment
-		bar.IncrBy(1)
+		bar.Increment()
 
 	}
-	p.Wait()
+	bar.Wait()
 
 	// start the closing cascade (this will also close the other channels)
-	dissectorWorker.close()
+	if err := dissectorWorker.close(); err != nil {
+		r.log.WithFields(log.Fields{
+			"Module": "beaconsProxy",
+			"Error":  err.Error(),
+		}).Error("proxy beacon results were not fully saved")
+	}
 
 	// Phase 2: Summary
 
@@ -174,23 +259,61 @@ func (r *repo) Upsert(uconnProxyMap map[string]*uconnproxy.Input, hostMap map[st
 	}
 
 	// add a progress bar for troubleshooting
-	p = mpb.New(mpb.WithWidth(20))
-	bar = p.AddBar(int64(len(localHosts)),
-		mpb.PrependDecorators(
-			decor.Name("\t[-] Proxy Beacon Aggregation:", decor.WC{W: 30, C: decor.DidentRight}),
-			decor.CountersNoUnit(" %d / %d ", decor.WCSyncWidth),
-		),
-		mpb.AppendDecorators(decor.Percentage()),
-	)
+	bar = r.progress.NewCountedProgress("\t[-] Proxy Beacon Aggregation:", int64(len(localHosts)))
 
 	// loop over the local hosts that need to be summarized
 	for _, localHost := range localHosts {
 		summarizerWorker.collect(localHost)
-		bar.IncrBy(1)
+		bar.Increment()
 	}
 
-	p.Wait()
+	bar.Wait()
 
 	// start the closing cascade (this will also close the other channels)
-	summarizerWorker.close()
+	if err := summarizerWorker.close(); err != nil {
+		r.log.WithFields(log.Fields{
+			"Module": "beaconsProxy",
+			"Error":  err.Error(),
+		}).Error("proxy beacon summaries were not fully saved")
+	}
+}
+
+//appendProfile appends the timing of an analysis run to the profile file. Failing to
+//profile a run is logged rather than treated as an analysis error.
+func (r *repo) appendProfile(profileFile string, summary dissectorSummary, elapsed time.Duration) {
+	err := util.AppendProfile(profileFile, util.AnalysisProfile{
+		Time:          time.Now().Unix(),
+		Module:        "beaconProxy",
+		Database:      r.database.GetSelectedDB(),
+		Chunk:         r.config.S.Rolling.CurrentChunk,
+		PairsExamined: summary.Examined,
+		BeaconsFound:  summary.Beacons,
+		DurationMs:    elapsed.Milliseconds(),
+		QueryMs:       time.Duration(summary.QueryTime).Milliseconds(),
+	})
+	if err != nil {
+		r.log.WithFields(log.Fields{
+			"Module": "beaconsProxy",
+			"Error":  err.Error(),
+		}).Error("could not append to the analysis profile file")
+	}
+}
+
+//PurgeChunk removes the proxy beacon results of the given chunk. Every beacon last written
+//in the chunk is removed along with the hosts' max proxy beacon summaries for the chunk.
+//Beacons updated by a later chunk are kept.
+func (r *repo) PurgeChunk(chunkID int) error {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+	db := session.DB(r.database.GetSelectedDB())
+
+	if _, err := db.C(r.config.T.BeaconProxy.BeaconProxyTable).RemoveAll(bson.M{"cid": chunkID}); err != nil {
+		return err
+	}
+
+	_, err := db.C(r.config.T.Structure.HostTable).UpdateAll(
+		bson.M{"dat": bson.M{"$elemMatch": bson.M{"cid": chunkID, "mbproxy": bson.M{"$exists": true}}}},
+		bson.M{"$pull": bson.M{"dat": bson.M{"cid": chunkID, "mbproxy": bson.M{"$exists": true}}}},
+	)
+	return err
 }
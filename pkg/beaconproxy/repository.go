@@ -4,6 +4,7 @@ import (
 	"github.com/activecm/rita/pkg/data"
 	"github.com/activecm/rita/pkg/host"
 	"github.com/activecm/rita/pkg/uconnproxy"
+	"github.com/activecm/rita/util"
 	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
 )
@@ -14,6 +15,9 @@ type (
 	Repository interface {
 		CreateIndexes() error
 		Upsert(uconnProxyMap map[string]*uconnproxy.Input, hostMap map[string]*host.Input, minTimestamp, maxTimestamp int64)
+		PurgeChunk(chunkID int) error
+		SetQueryLimiter(limiter *util.Limiter)
+		SetProgressGroup(group *util.ProgressGroup)
 	}
 
 	mgoBulkAction func(*mgo.Bulk) int
@@ -32,14 +36,18 @@ type (
 	//Result represents a beacon proxy between a source IP and
 	// an fqdn.
 	Result struct {
-		FQDN           string        `bson:"fqdn"`
-		SrcIP          string        `bson:"src"`
-		SrcNetworkName string        `bson:"src_network_name"`
-		SrcNetworkUUID bson.Binary   `bson:"src_network_uuid"`
-		Connections    int64         `bson:"connection_count"`
-		Ts             TSData        `bson:"ts"`
-		Score          float64       `bson:"score"`
-		Proxy          data.UniqueIP `bson:"proxy"`
+		FQDN             string        `bson:"fqdn"`
+		SrcIP            string        `bson:"src"`
+		SrcNetworkName   string        `bson:"src_network_name"`
+		SrcNetworkUUID   bson.Binary   `bson:"src_network_uuid"`
+		Connections      int64         `bson:"connection_count"`
+		Ts               TSData        `bson:"ts"`
+		Score            float64       `bson:"score"`
+		Proxy            data.UniqueIP `bson:"proxy"`
+		DomainGrouped    bool          `bson:"domain_grouped"`
+		GroupedFQDNs     []string      `bson:"grouped_fqdns"`
+		AttackTechniques []string      `bson:"attack_techniques"`
+		ScoreBucket      string        `bson:"score_bucket"`
 	}
 
 	//StrobeResult represents a unique connection with a large amount
@@ -7,8 +7,8 @@ import (
 
 //Results finds beacons FQDN in the database greater than a given cutoffScore
 func Results(res *resources.Resources, cutoffScore float64) ([]Result, error) {
-	ssn := res.DB.Session.Copy()
-	defer ssn.Close()
+	ssn := res.DB.CopySession()
+	defer res.DB.CloseSession(ssn)
 
 	var beaconsProxy []Result
 
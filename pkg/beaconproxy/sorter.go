@@ -15,14 +15,14 @@ type (
 		db             *database.DB            // provides access to MongoDB
 		conf           *config.Config          // contains details needed to access MongoDB
 		sortedCallback func(*uconnproxy.Input) // called on each analyzed result
-		closedCallback func()                  // called when .close() is called and no more calls to analyzedCallback will be made
+		closedCallback func() error            // called when .close() is called and no more calls to analyzedCallback will be made
 		sortChannel    chan *uconnproxy.Input  // holds unanalyzed data
 		sortWg         sync.WaitGroup          // wait for analysis to finish
 	}
 )
 
 //newsorter creates a new collector for gathering data
-func newSorter(db *database.DB, conf *config.Config, sortedCallback func(*uconnproxy.Input), closedCallback func()) *sorter {
+func newSorter(db *database.DB, conf *config.Config, sortedCallback func(*uconnproxy.Input), closedCallback func() error) *sorter {
 	return &sorter{
 		db:             db,
 		conf:           conf,
@@ -37,11 +37,11 @@ func (s *sorter) collect(entry *uconnproxy.Input) {
 	s.sortChannel <- entry
 }
 
-//close waits for the collector to finish
-func (s *sorter) close() {
+//close waits for the collector to finish and returns any error from the rest of the closing cascade
+func (s *sorter) close() error {
 	close(s.sortChannel)
 	s.sortWg.Wait()
-	s.closedCallback()
+	return s.closedCallback()
 }
 
 //start kicks off a new analysis thread
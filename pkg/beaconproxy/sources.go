@@ -0,0 +1,22 @@
+package beaconproxy
+
+import (
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/uconnproxy"
+)
+
+//filterSources returns the unique proxy connections whose source host is not excluded
+//by the given filter. The input map is returned as is when the filter is empty.
+func filterSources(uconnProxyMap map[string]*uconnproxy.Input, neverAnalyze config.SourceFilter) map[string]*uconnproxy.Input {
+	if len(neverAnalyze) == 0 {
+		return uconnProxyMap
+	}
+
+	filtered := make(map[string]*uconnproxy.Input, len(uconnProxyMap))
+	for key, entry := range uconnProxyMap {
+		if !neverAnalyze.Excludes(entry.Hosts.SrcIP) {
+			filtered[key] = entry
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,31 @@
+package beaconproxy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/pkg/uconnproxy"
+	"github.com/activecm/rita/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterSources(t *testing.T) {
+	input := make(map[string]*uconnproxy.Input)
+	for _, ip := range []string{"10.0.0.1", "10.0.5.1"} {
+		src := data.UniqueIP{IP: ip, NetworkUUID: util.UnknownPrivateNetworkUUID, NetworkName: util.UnknownPrivateNetworkName}
+		pair := data.NewUniqueSrcFQDNPair(src, "c2.example.com")
+		input[pair.MapKey()] = &uconnproxy.Input{Hosts: pair}
+	}
+
+	assert.Equal(t, input, filterSources(input, nil), "an empty filter should keep every source")
+
+	_, scanners, _ := net.ParseCIDR("10.0.5.0/24")
+	filtered := filterSources(input, config.SourceFilter{scanners})
+	assert.Len(t, filtered, 1)
+	for _, entry := range filtered {
+		assert.Equal(t, "10.0.0.1", entry.Hosts.SrcIP)
+	}
+	assert.Len(t, input, 2, "the input map should be left alone")
+}
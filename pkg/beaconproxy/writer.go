@@ -1,7 +1,10 @@
 package beaconproxy
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
@@ -12,12 +15,17 @@ import (
 type (
 	//mgoBulkWriter provides a worker for writing bulk actions to MongoDB
 	mgoBulkWriter struct { //structure for writing results to mongo
-		db           *database.DB        // provides access to MongoDB
-		conf         *config.Config      // contains details needed to access MongoDB
-		log          *log.Logger         // main logger for RITA
-		writeChannel chan mgoBulkActions // holds analyzed data
-		writeWg      sync.WaitGroup      // wait for writing to finish
-		writerName   string              // used in error reporting
+		db           *database.DB           // provides access to MongoDB
+		conf         *config.Config         // contains details needed to access MongoDB
+		log          *log.Logger            // main logger for RITA
+		writeChannel chan mgoBulkActions    // holds analyzed data
+		writeWg      sync.WaitGroup         // wait for writing to finish
+		writerName   string                 // used in error reporting
+		failed       int64                  // number of final writes which failed after being retried
+		tagColl      string                 // collection tagged with ATT&CK techniques once every write is done
+		tagRules     []config.AttackTagRule // rules used to tag tagColl (nil if disabled)
+		bucketColl   string                 // collection labeled with score buckets once every write is done
+		buckets      config.ScoreBuckets    // buckets used to label bucketColl (nil if disabled)
 	}
 )
 
@@ -32,23 +40,70 @@ func newMgoBulkWriter(db *database.DB, conf *config.Config, log *log.Logger, wri
 	}
 }
 
+//enableAttackTags tags the results in the given collection with the ATT&CK techniques
+//of the given rules after every result has been written
+func (w *mgoBulkWriter) enableAttackTags(tagColl string, tagRules []config.AttackTagRule) {
+	w.tagColl = tagColl
+	w.tagRules = tagRules
+}
+
+//enableScoreBuckets labels the results in the given collection with the bucket holding
+//their score after every result has been written
+func (w *mgoBulkWriter) enableScoreBuckets(bucketColl string, buckets config.ScoreBuckets) {
+	w.bucketColl = bucketColl
+	w.buckets = buckets
+}
+
 //collect sends a group of results to the writer for writing out to the database
 func (w *mgoBulkWriter) collect(data mgoBulkActions) {
 	w.writeChannel <- data
 }
 
-//close waits for the write threads to finish
-func (w *mgoBulkWriter) close() {
+//close waits for the write threads to finish. An error is returned if any of the
+//final writes failed, since the results they held were not saved.
+func (w *mgoBulkWriter) close() error {
 	close(w.writeChannel)
 	w.writeWg.Wait()
+
+	// the buckets and rules match on the stored scores, so they can only be applied once the results are saved
+	if len(w.buckets) > 0 {
+		ssn := w.db.CopySession()
+		err := database.ApplyScoreBuckets(ssn.DB(w.db.GetSelectedDB()).C(w.bucketColl), w.buckets)
+		w.db.CloseSession(ssn)
+		if err != nil {
+			w.log.WithFields(log.Fields{
+				"Module":     w.writerName,
+				"Collection": w.bucketColl,
+				"Error":      err.Error(),
+			}).Error("could not label results with score buckets")
+		}
+	}
+
+	if len(w.tagRules) > 0 {
+		ssn := w.db.CopySession()
+		err := database.ApplyAttackTags(ssn.DB(w.db.GetSelectedDB()).C(w.tagColl), w.tagRules)
+		w.db.CloseSession(ssn)
+		if err != nil {
+			w.log.WithFields(log.Fields{
+				"Module":     w.writerName,
+				"Collection": w.tagColl,
+				"Error":      err.Error(),
+			}).Error("could not tag results with ATT&CK techniques")
+		}
+	}
+
+	if failed := atomic.LoadInt64(&w.failed); failed > 0 {
+		return fmt.Errorf("%s: %d final writes could not be saved", w.writerName, failed)
+	}
+	return nil
 }
 
 //start kicks off a new write thread
 func (w *mgoBulkWriter) start() {
 	w.writeWg.Add(1)
 	go func() {
-		ssn := w.db.Session.Copy()
-		defer ssn.Close()
+		ssn := w.db.CopySession()
+		defer w.db.CloseSession(ssn)
 
 		bulkBuffers := map[string]*mgo.Bulk{}
 		bulkBufferLengths := map[string]int{}
@@ -79,9 +134,13 @@ func (w *mgoBulkWriter) start() {
 				}
 			}
 		}
+		// nothing else will write these results out, so give transient errors a chance to clear
+		retries := w.conf.S.MongoDB.FlushRetries
+		backoff := time.Duration(w.conf.S.MongoDB.FlushBackoff) * time.Millisecond
 		for tgtColl, bulkBuffer := range bulkBuffers {
-			info, err := bulkBuffer.Run()
+			info, err := database.RetryBulk(ssn, retries, backoff, bulkBuffer.Run)
 			if err != nil {
+				atomic.AddInt64(&w.failed, 1)
 				w.log.WithFields(log.Fields{
 					"Module":     w.writerName,
 					"Collection": tgtColl,
@@ -0,0 +1,267 @@
+package beaconsni
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo"
+)
+
+const (
+	alternationMinConns   = 3   // fewest connections each SNI must make while both are active
+	alternationMinBalance = 0.5 // smallest ratio between the connection counts of two correlated SNIs
+)
+
+type (
+	//AlternatingPair is a source which alternates its connections between two SNIs on a schedule,
+	//such as reaching one SNI at T and the other at T plus half the interval. Each SNI may look
+	//irregular on its own while the merged connections are regular. The interval is measured on
+	//the merged connections in the timestamp resolution of the analysis.
+	AlternatingPair struct {
+		data.UniqueSrcIP `bson:",inline"`
+		FQDNs            []string `bson:"fqdns"`            // the two SNIs, in alphabetical order
+		ConnectionCount  int64    `bson:"connection_count"` // unique connection times to either SNI while both were active
+		Interval         int64    `bson:"interval"`         // median interval between the merged connections
+		TimingCV         float64  `bson:"timing_cv"`        // coefficient of variation of the merged intervals
+		Resolution       string   `bson:"resolution"`       // s or ms
+		Alternation      float64  `bson:"alternation"`      // share of consecutive connections which switch SNIs
+		Balance          float64  `bson:"balance"`          // connections to the less used SNI over the more used one
+		Regularity       float64  `bson:"regularity"`       // 1 - timing_cv, floored at 0
+		Score            float64  `bson:"score"`
+		Chunk            int      `bson:"cid"`
+	}
+
+	//alternationDestination holds the unique connection timestamps of a source to a single SNI
+	alternationDestination struct {
+		fqdn string
+		ts   []int64
+	}
+
+	//alternationSource holds the SNIs a single source was analyzed with
+	alternationSource struct {
+		src          data.UniqueSrcIP
+		destinations []alternationDestination
+	}
+
+	//alternationCollector gathers the connection timestamps of every scored pair by source, so
+	//the SNIs of each source can be correlated once analysis finishes
+	alternationCollector struct {
+		mu      sync.Mutex
+		sources map[string]*alternationSource
+	}
+)
+
+//newAlternationCollector creates a new, empty alternation collector
+func newAlternationCollector() *alternationCollector {
+	return &alternationCollector{sources: make(map[string]*alternationSource)}
+}
+
+//add records the unique, sorted connection timestamps of a pair. It is safe to call from
+//several analysis threads.
+func (c *alternationCollector) add(res DissectorResults) {
+	ts := make([]int64, len(res.TsList))
+	copy(ts, res.TsList)
+
+	key := res.Hosts.UniqueSrcIP.Unpair().MapKey()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	source, ok := c.sources[key]
+	if !ok {
+		source = &alternationSource{src: res.Hosts.UniqueSrcIP}
+		c.sources[key] = source
+	}
+	source.destinations = append(source.destinations, alternationDestination{fqdn: res.Hosts.FQDN, ts: ts})
+}
+
+//analyzedSources returns every source with at least one collected pair, ordered by key
+func (c *alternationCollector) analyzedSources() []data.UniqueSrcIP {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.sources))
+	for key := range c.sources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sources := make([]data.UniqueSrcIP, len(keys))
+	for i, key := range keys {
+		sources[i] = c.sources[key].src
+	}
+	return sources
+}
+
+//correlate compares every two SNIs of each source and returns the pairs scoring at least
+//minScore, ordered by source and then by SNIs. Sources with more than maxDestinations SNIs
+//only compare the maxDestinations SNIs they connected to most often, and a maxDestinations
+//of 0 compares them all.
+func (c *alternationCollector) correlate(maxDestinations int, minScore float64, resolution string, chunk int) []AlternatingPair {
+	var pairs []AlternatingPair
+	for _, src := range c.analyzedSources() {
+		c.mu.Lock()
+		destinations := c.sources[src.Unpair().MapKey()].destinations
+		c.mu.Unlock()
+
+		if maxDestinations > 0 && len(destinations) > maxDestinations {
+			sort.Slice(destinations, func(i, j int) bool {
+				if len(destinations[i].ts) != len(destinations[j].ts) {
+					return len(destinations[i].ts) > len(destinations[j].ts)
+				}
+				return destinations[i].fqdn < destinations[j].fqdn
+			})
+			destinations = destinations[:maxDestinations]
+		}
+		sort.Slice(destinations, func(i, j int) bool { return destinations[i].fqdn < destinations[j].fqdn })
+
+		for i := 0; i < len(destinations); i++ {
+			for j := i + 1; j < len(destinations); j++ {
+				pair, ok := scoreAlternation(destinations[i], destinations[j])
+				if !ok || pair.Score < minScore {
+					continue
+				}
+				pair.UniqueSrcIP = src
+				pair.Resolution = resolution
+				pair.Chunk = chunk
+				pairs = append(pairs, pair)
+			}
+		}
+	}
+	return pairs
+}
+
+//scoreAlternation correlates the connections a source made to two SNIs. Only the connections
+//made while both SNIs were active are compared, and each SNI must make at least
+//alternationMinConns of them. SNIs whose connection counts are further apart than
+//alternationMinBalance are not candidates, since a schedule alternating between them would
+//use both about as often. The connections are merged in time order, and the score averages
+//how often consecutive connections switch SNIs with how regular the merged intervals are,
+//which is one less their coefficient of variation.
+//false is returned if the SNIs are not candidates.
+func scoreAlternation(a alternationDestination, b alternationDestination) (AlternatingPair, bool) {
+	if len(a.ts) == 0 || len(b.ts) == 0 {
+		return AlternatingPair{}, false
+	}
+
+	start, end := a.ts[0], a.ts[len(a.ts)-1]
+	if b.ts[0] > start {
+		start = b.ts[0]
+	}
+	if last := b.ts[len(b.ts)-1]; last < end {
+		end = last
+	}
+	if start >= end {
+		return AlternatingPair{}, false
+	}
+	aTs, bTs := tsWithin(a.ts, start, end), tsWithin(b.ts, start, end)
+	if len(aTs) < alternationMinConns || len(bTs) < alternationMinConns {
+		return AlternatingPair{}, false
+	}
+
+	balance := float64(len(aTs)) / float64(len(bTs))
+	if balance > 1 {
+		balance = 1 / balance
+	}
+	if balance < alternationMinBalance {
+		return AlternatingPair{}, false
+	}
+
+	// merge the two sorted lists, counting how often the SNI changes from one connection to the next
+	merged := make([]int64, 0, len(aTs)+len(bTs))
+	switches := 0
+	i, j := 0, 0
+	lastFromA := false
+	for i < len(aTs) || j < len(bTs) {
+		fromA := j == len(bTs) || (i < len(aTs) && aTs[i] <= bTs[j])
+		if len(merged) > 0 && fromA != lastFromA {
+			switches++
+		}
+		if fromA {
+			merged = append(merged, aTs[i])
+			i++
+		} else {
+			merged = append(merged, bTs[j])
+			j++
+		}
+		lastFromA = fromA
+	}
+
+	intervals := make([]int64, len(merged)-1)
+	for k := range intervals {
+		intervals[k] = merged[k+1] - merged[k]
+	}
+	sort.Sort(util.SortableInt64(intervals))
+	median := intervals[util.Round(.5*float64(len(intervals)-1))]
+
+	// the coefficient of variation is used rather than the median absolute deviation, since
+	// two independent beacons bunched together have two interval modes which the median hides
+	cv := timingCV(merged)
+	regularity := math.Max(1.0-cv, 0)
+	alternation := float64(switches) / float64(len(merged)-1)
+
+	return AlternatingPair{
+		FQDNs:           []string{a.fqdn, b.fqdn},
+		ConnectionCount: int64(len(merged)),
+		Interval:        median,
+		TimingCV:        cv,
+		Alternation:     alternation,
+		Balance:         balance,
+		Regularity:      regularity,
+		Score:           math.Ceil(((alternation+regularity)/2.0)*1000) / 1000,
+	}, true
+}
+
+//tsWithin returns the part of a sorted timestamp list from start to end, inclusive
+func tsWithin(ts []int64, start int64, end int64) []int64 {
+	first := sort.Search(len(ts), func(i int) bool { return ts[i] >= start })
+	last := sort.Search(len(ts), func(i int) bool { return ts[i] > end })
+	return ts[first:last]
+}
+
+//saveAlternatingPairs replaces the alternating pairs of the given sources with the given pairs.
+//Every source analyzed in the run is cleared, so pairs which no longer alternate are removed.
+func (r *repo) saveAlternatingPairs(sources []data.UniqueSrcIP, pairs []AlternatingPair) error {
+	if len(sources) == 0 {
+		return nil
+	}
+	if err := r.createAlternatingCollection(); err != nil {
+		return err
+	}
+
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	bulk := session.DB(r.database.GetSelectedDB()).C(r.config.T.BeaconSNI.AlternatingTable).Bulk()
+	for _, src := range sources {
+		bulk.RemoveAll(src.BSONKey())
+	}
+	for _, pair := range pairs {
+		bulk.Insert(pair)
+	}
+	_, err := bulk.Run()
+	return err
+}
+
+//createAlternatingCollection creates the alternating pairs collection if it doesn't exist yet
+func (r *repo) createAlternatingCollection() error {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	collectionName := r.config.T.BeaconSNI.AlternatingTable
+
+	names, _ := session.DB(r.database.GetSelectedDB()).CollectionNames()
+	for _, name := range names {
+		if name == collectionName {
+			return nil
+		}
+	}
+
+	return r.database.CreateCollection(collectionName, []mgo.Index{
+		{Key: []string{"src", "src_network_uuid"}},
+		{Key: []string{"fqdns"}},
+		{Key: []string{"-score"}},
+	})
+}
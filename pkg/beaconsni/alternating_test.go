@@ -0,0 +1,100 @@
+package beaconsni
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//everyN returns count timestamps starting at start, step apart
+func everyN(start int64, step int64, count int) []int64 {
+	ts := make([]int64, count)
+	for i := range ts {
+		ts[i] = start + int64(i)*step
+	}
+	return ts
+}
+
+func TestScoreAlternationInterleaved(t *testing.T) {
+	// a at T, b at T plus half the interval
+	a := alternationDestination{fqdn: "a.example.com", ts: everyN(0, 60, 20)}
+	b := alternationDestination{fqdn: "b.example.com", ts: everyN(30, 60, 20)}
+
+	pair, ok := scoreAlternation(a, b)
+	require.True(t, ok)
+	assert.Equal(t, []string{"a.example.com", "b.example.com"}, pair.FQDNs)
+	assert.Equal(t, 1.0, pair.Alternation)
+	assert.Equal(t, 1.0, pair.Regularity)
+	assert.Equal(t, 1.0, pair.Score)
+	assert.Equal(t, int64(30), pair.Interval)
+	assert.Equal(t, 0.0, pair.TimingCV)
+	// a's first and b's last connections fall outside of the overlap, so they are left out
+	assert.Equal(t, int64(38), pair.ConnectionCount)
+}
+
+func TestScoreAlternationIrregularAlone(t *testing.T) {
+	// the schedule picks the SNIs in an uneven order, so neither looks
+	// regular on its own, but together they connect every 30 seconds
+	order := "ababbaabab"
+	var a, b alternationDestination
+	for i, ts := range everyN(0, 30, 40) {
+		if order[i%len(order)] == 'a' {
+			a.ts = append(a.ts, ts)
+		} else {
+			b.ts = append(b.ts, ts)
+		}
+	}
+
+	pair, ok := scoreAlternation(a, b)
+	require.True(t, ok)
+	assert.Equal(t, 1.0, pair.Regularity)
+	assert.True(t, pair.Alternation < 1.0)
+	assert.True(t, pair.Score > 0.8)
+}
+
+func TestScoreAlternationCandidates(t *testing.T) {
+	a := alternationDestination{ts: everyN(0, 60, 20)}
+
+	_, ok := scoreAlternation(a, alternationDestination{ts: everyN(2000, 60, 20)})
+	assert.False(t, ok, "SNIs which were never active at the same time should not be compared")
+
+	_, ok = scoreAlternation(a, alternationDestination{ts: everyN(30, 240, 5)})
+	assert.False(t, ok, "SNIs used much less often than the other should not be compared")
+
+	_, ok = scoreAlternation(a, alternationDestination{ts: everyN(30, 60, 2)})
+	assert.False(t, ok, "SNIs with too few connections should not be compared")
+
+	// two independent beacons whose connections bunch together
+	pair, ok := scoreAlternation(a, alternationDestination{ts: everyN(1, 60, 20)})
+	require.True(t, ok)
+	assert.True(t, pair.Score < 0.8, "connections bunched together should not look like a schedule")
+}
+
+func TestAlternationCollectorCorrelate(t *testing.T) {
+	src := data.UniqueSrcIP{SrcIP: "10.0.0.1"}
+	other := data.UniqueSrcIP{SrcIP: "10.0.0.2"}
+
+	collector := newAlternationCollector()
+	add := func(src data.UniqueSrcIP, fqdn string, ts []int64) {
+		collector.add(DissectorResults{Hosts: data.UniqueSrcFQDNPair{UniqueSrcIP: src, FQDN: fqdn}, TsList: ts})
+	}
+	add(src, "b.example.com", everyN(30, 60, 20))
+	add(src, "a.example.com", everyN(0, 60, 20))
+	add(src, "rare.example.com", everyN(15, 600, 3))
+	add(other, "b.example.com", everyN(30, 60, 20))
+
+	assert.Equal(t, []data.UniqueSrcIP{src, other}, collector.analyzedSources())
+
+	pairs := collector.correlate(0, 0.8, "s", 3)
+	require.Len(t, pairs, 1, "a single SNI can't alternate")
+	assert.Equal(t, src, pairs[0].UniqueSrcIP)
+	assert.Equal(t, []string{"a.example.com", "b.example.com"}, pairs[0].FQDNs)
+	assert.Equal(t, "s", pairs[0].Resolution)
+	assert.Equal(t, 3, pairs[0].Chunk)
+
+	// the SNI with the fewest connections is dropped first
+	assert.Len(t, collector.correlate(2, 0.8, "s", 3), 1)
+	assert.Len(t, collector.correlate(1, 0.8, "s", 3), 0)
+}
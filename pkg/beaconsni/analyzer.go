@@ -2,12 +2,13 @@ package beaconsni
 
 import (
 	"math"
-	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
-	"github.com/activecm/rita/util"
+	"github.com/activecm/rita/pkg/data"
 
 	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
@@ -18,45 +19,191 @@ type (
 	//analyzer handles calculating statistical measures of the distributions of the
 	//timestamps and data sizes between hosts and SNIs (FQDNs)
 	analyzer struct {
-		tsMin            int64                 // min timestamp for the whole dataset
-		tsMax            int64                 // max timestamp for the whole dataset
-		chunk            int                   // current chunk (0 if not on rolling analysis)
-		db               *database.DB          // provides access to MongoDB
-		conf             *config.Config        // contains details needed to access MongoDB
-		log              *log.Logger           // main logger for RITA
-		analyzedCallback func(mgoBulkActions)  // analysis results are sent to this callback as MongoDB bulk actions
-		closedCallback   func()                // called when .close() is called and no more calls to analyzedCallback will be made
-		analysisChannel  chan dissectorResults // holds unanalyzed SNI connection data
-		analysisWg       sync.WaitGroup        // wait for analysis to finish
+		tsMin             int64                                 // min timestamp for the whole dataset
+		tsMax             int64                                 // max timestamp for the whole dataset
+		chunk             int                                   // current chunk (0 if not on rolling analysis)
+		db                *database.DB                          // provides access to MongoDB
+		conf              *config.Config                        // contains details needed to access MongoDB
+		log               *log.Logger                           // main logger for RITA
+		analyzedCallback  func(mgoBulkActions)                  // analysis results are sent to this callback as MongoDB bulk actions
+		closedCallback    func() error                          // called when .close() is called and no more calls to analyzedCallback will be made
+		model             ScoringModel                          // scores each beacon
+		analysisChannel   chan DissectorResults                 // holds unanalyzed SNI connection data
+		analysisWg        sync.WaitGroup                        // wait for analysis to finish
+		priorBeacons      map[string]struct{}                   // map keys of the pairs which were beacons before this run
+		newBeaconCallback func(data.UniqueSrcFQDNPair, float64) // beacons missing from priorBeacons are sent to this callback with their score (nil if disabled)
+		scoredCallback    func(ScoredBeacon)                    // every scored beacon is sent to this callback (nil if disabled)
+		findingCallback   func(Finding)                         // every scored beacon is sent to this callback as a finding (nil if disabled)
+		timingCallback    func(DissectorResults)                // the connection details of every scored pair are sent to this callback (nil if disabled)
+		belowMinScore     int64                                 // number of beacons not stored since they scored below BeaconSNI.MinScoreToStore
+		storeFeatures     bool                                  // store the dissector results of every scored pair so it can be rescored later
+		provenance        *Provenance                           // recorded with every stored beacon (nil if disabled)
+		ptrWait           time.Duration                         // longest to wait on the reverse DNS lookups of a beacon's responders
+		checkpoint        *checkpointer                         // tracks the writes of every pair and is told when each pair is analyzed (nil if disabled)
 	}
 )
 
 //newAnalyzer creates a new analyzer for calculating the beacon statistics of SNI connections
-func newAnalyzer(min int64, max int64, chunk int, db *database.DB, conf *config.Config, log *log.Logger,
-	analyzedCallback func(mgoBulkActions), closedCallback func()) *analyzer {
+func newAnalyzer(min int64, max int64, chunk int, model ScoringModel, db *database.DB, conf *config.Config, log *log.Logger,
+	analyzedCallback func(mgoBulkActions), closedCallback func() error) *analyzer {
 	return &analyzer{
 		tsMin:            min,
 		tsMax:            max,
 		chunk:            chunk,
+		model:            model,
 		db:               db,
 		conf:             conf,
 		log:              log,
 		analyzedCallback: analyzedCallback,
 		closedCallback:   closedCallback,
-		analysisChannel:  make(chan dissectorResults),
+		analysisChannel:  make(chan DissectorResults),
+	}
+}
+
+//enableNewBeacons sends every beacon which is missing from priorBeacons to newBeaconCallback.
+//priorBeacons is only read once analysis starts, so it is shared by the analysis threads.
+func (a *analyzer) enableNewBeacons(priorBeacons map[string]struct{}, newBeaconCallback func(data.UniqueSrcFQDNPair, float64)) {
+	a.priorBeacons = priorBeacons
+	a.newBeaconCallback = newBeaconCallback
+}
+
+//enableScoredCallback sends the score of every beacon to scoredCallback in addition
+//to the usual analysis results
+func (a *analyzer) enableScoredCallback(scoredCallback func(ScoredBeacon)) {
+	a.scoredCallback = scoredCallback
+}
+
+//enableFindingCallback sends every scored beacon to findingCallback as a finding
+func (a *analyzer) enableFindingCallback(findingCallback func(Finding)) {
+	a.findingCallback = findingCallback
+}
+
+//enableTimingCallback sends the connection details of every pair which is scored to timingCallback,
+//before any baseline profile is applied
+func (a *analyzer) enableTimingCallback(timingCallback func(DissectorResults)) {
+	a.timingCallback = timingCallback
+}
+
+//enableFeatureStore stores the dissector results of every scored pair in the features
+//collection, so the pairs can be rescored without re-dissecting SNIconn
+func (a *analyzer) enableFeatureStore() {
+	a.storeFeatures = true
+}
+
+//enableProvenance records the RITA version and scoring model which scored each beacon
+//with the beacon, so beacons scored inconsistently can be found later
+func (a *analyzer) enableProvenance(provenance Provenance) {
+	a.provenance = &provenance
+}
+
+//enableReverseDNS waits up to ptrWait for the reverse DNS lookups attached to each stored
+//beacon, and records the PTR records which were found
+func (a *analyzer) enableReverseDNS(ptrWait time.Duration) {
+	a.ptrWait = ptrWait
+}
+
+//isNewBeacon returns true if new beacon alerts are enabled and the given pair
+//was not a beacon before this run
+func (a *analyzer) isNewBeacon(pair data.UniqueSrcFQDNPair) bool {
+	if a.newBeaconCallback == nil {
+		return false
+	}
+	_, seen := a.priorBeacons[pair.MapKey()]
+	return !seen
+}
+
+//baselineProfile returns the baseline profile matching the given SNI and the median
+//connection interval in stats, if any
+func (a *analyzer) baselineProfile(fqdn string, stats beaconStats) (config.BaselineProfile, bool) {
+	if len(a.conf.R.BeaconSNI.Baselines) == 0 {
+		return config.BaselineProfile{}, false
+	}
+
+	medianInterval := time.Duration(stats.tsMedian) * time.Second
+	if stats.tsResolution == config.MillisecondResolution {
+		medianInterval = time.Duration(stats.tsMedian) * time.Millisecond
+	}
+	return a.conf.R.BeaconSNI.Baselines.Match(fqdn, medianInterval)
+}
+
+//enableCheckpoints tracks the writes made for every pair with the given checkpointer, and
+//tells it once the analyzer is done with the results of each pair
+func (a *analyzer) enableCheckpoints(checkpoint *checkpointer) {
+	a.checkpoint = checkpoint
+}
+
+//write sends the bulk actions made for the given pair on to be written
+func (a *analyzer) write(pair data.UniqueSrcFQDNPair, actions mgoBulkActions) {
+	if a.checkpoint != nil {
+		actions = a.checkpoint.track(pair, actions)
+	}
+	a.analyzedCallback(actions)
+}
+
+//finished releases the hold the dissector placed on the given pair when it sent the pair's
+//results on for analysis
+func (a *analyzer) finished(pair data.UniqueSrcFQDNPair) {
+	if a.checkpoint != nil {
+		a.checkpoint.release(pair)
 	}
 }
 
 //collect gathers sorted SNI connection data for analysis
-func (a *analyzer) collect(data dissectorResults) {
+func (a *analyzer) collect(data DissectorResults) {
 	a.analysisChannel <- data
 }
 
-//close waits for the analyzer to finish
-func (a *analyzer) close() {
+//removeBeacon removes any beacon left over for the given pair from earlier analysis
+func (a *analyzer) removeBeacon(pair data.UniqueSrcFQDNPair) {
+	pairSelector := pair.BSONKey()
+	a.write(pair, mgoBulkActions{
+		a.conf.T.BeaconSNI.BeaconSNITable: func(b *mgo.Bulk) int {
+			b.Remove(pairSelector)
+			return 1
+		},
+	})
+}
+
+//close waits for the analyzer to finish and returns any error from the rest of the closing cascade
+func (a *analyzer) close() error {
 	close(a.analysisChannel)
 	a.analysisWg.Wait()
-	a.closedCallback()
+
+	if belowMinScore := atomic.LoadInt64(&a.belowMinScore); belowMinScore > 0 {
+		a.log.WithFields(log.Fields{
+			"Module":   "beaconSNI",
+			"MinScore": a.conf.S.BeaconSNI.MinScoreToStore,
+			"Dropped":  belowMinScore,
+		}).Info("did not store SNI beacons scoring below the minimum score")
+	}
+	return a.closedCallback()
+}
+
+//logScore logs the score of a beacon, and whether it scored high enough to be stored. When
+//Log.AnalysisVerbosity is AnalysisVerbosityFeatures, the per feature scores and the timing and
+//data size statistics the score was based on are logged as well.
+func (a *analyzer) logScore(res DissectorResults, stats beaconStats, score float64, breakdown map[string]float64) {
+	fields := log.Fields{
+		"Module":      "beaconSNI",
+		"Data":        res.Hosts,
+		"Score":       score,
+		"Connections": res.ConnectionCount,
+		"Stored":      score >= a.conf.S.BeaconSNI.MinScoreToStore,
+	}
+
+	if a.conf.S.Log.AnalysisVerbosity >= config.AnalysisVerbosityFeatures {
+		fields["Breakdown"] = breakdown
+		fields["TsMode"] = stats.tsMode
+		fields["TsDispersion"] = stats.tsMadm
+		fields["TsSkew"] = stats.tsSkew
+		fields["TsScore"] = stats.tsScore
+		fields["DsMode"] = stats.dsMode
+		fields["DsDispersion"] = stats.dsMadm
+		fields["DsSkew"] = stats.dsSkew
+		fields["DsScore"] = stats.dsScore
+	}
+
+	a.log.WithFields(fields).Info("scored SNI beacon")
 }
 
 //start kicks off a new analysis thread
@@ -92,131 +239,64 @@ func (a *analyzer) start() {
 						return 1
 					},
 				}
-				a.analyzedCallback(update)
-			} else {
-				//store the diff slice length since we use it a lot
-				//for timestamps this is one less then the data slice length
-				//since we are calculating the times in between readings
-				tsLength := len(res.TsList) - 1
-				dsLength := len(res.OrigBytesList)
-
-				//find the delta times between the timestamps
-				diff := make([]int64, tsLength)
-				for i := 0; i < tsLength; i++ {
-					diff[i] = res.TsList[i+1] - res.TsList[i]
-				}
-
-				//find the delta times between full list of timestamps
-				//(this will be used for the intervals list. Bowleys skew
-				//must use a unique timestamp list with no duplicates)
-				tsLengthFull := len(res.TsListFull) - 1
-				//find the delta times between the timestamps
-				diffFull := make([]int64, tsLengthFull)
-				for i := 0; i < tsLengthFull; i++ {
-					diffFull[i] = res.TsListFull[i+1] - res.TsListFull[i]
-				}
-
-				//perfect beacons should have symmetric delta time and size distributions
-				//Bowley's measure of skew is used to check symmetry
-				sort.Sort(util.SortableInt64(diff))
-				tsSkew := float64(0)
-				dsSkew := float64(0)
-
-				//tsLength -1 is used since diff is a zero based slice
-				tsLow := diff[util.Round(.25*float64(tsLength-1))]
-				tsMid := diff[util.Round(.5*float64(tsLength-1))]
-				tsHigh := diff[util.Round(.75*float64(tsLength-1))]
-				tsBowleyNum := tsLow + tsHigh - 2*tsMid
-				tsBowleyDen := tsHigh - tsLow
-
-				//we do the same for datasizes
-				dsLow := res.OrigBytesList[util.Round(.25*float64(dsLength-1))]
-				dsMid := res.OrigBytesList[util.Round(.5*float64(dsLength-1))]
-				dsHigh := res.OrigBytesList[util.Round(.75*float64(dsLength-1))]
-				dsBowleyNum := dsLow + dsHigh - 2*dsMid
-				dsBowleyDen := dsHigh - dsLow
-
-				//tsSkew should equal zero if the denominator equals zero
-				//bowley skew is unreliable if Q2 = Q1 or Q2 = Q3
-				if tsBowleyDen != 0 && tsMid != tsLow && tsMid != tsHigh {
-					tsSkew = float64(tsBowleyNum) / float64(tsBowleyDen)
-				}
-
-				if dsBowleyDen != 0 && dsMid != dsLow && dsMid != dsHigh {
-					dsSkew = float64(dsBowleyNum) / float64(dsBowleyDen)
-				}
-
-				//perfect beacons should have very low dispersion around the
-				//median of their delta times
-				//Median Absolute Deviation About the Median
-				//is used to check dispersion
-				devs := make([]int64, tsLength)
-				for i := 0; i < tsLength; i++ {
-					devs[i] = util.Abs(diff[i] - tsMid)
+				// a strobe is never rescored into a beacon
+				if a.storeFeatures {
+					update[a.conf.T.BeaconSNI.FeaturesTable] = func(b *mgo.Bulk) int {
+						b.Remove(pairSelector)
+						return 1
+					}
 				}
-
-				dsDevs := make([]int64, dsLength)
-				for i := 0; i < dsLength; i++ {
-					dsDevs[i] = util.Abs(res.OrigBytesList[i] - dsMid)
+				a.write(res.Hosts, update)
+			} else {
+				if a.timingCallback != nil {
+					a.timingCallback(res)
 				}
 
-				sort.Sort(util.SortableInt64(devs))
-				sort.Sort(util.SortableInt64(dsDevs))
-
-				tsMadm := devs[util.Round(.5*float64(tsLength-1))]
-				dsMadm := dsDevs[util.Round(.5*float64(dsLength-1))]
-
-				//Store the range for human analysis
-				tsIntervalRange := diff[tsLength-1] - diff[0]
-				dsRange := res.OrigBytesList[dsLength-1] - res.OrigBytesList[0]
-
-				//get a list of the intervals found in the data,
-				//the number of times the interval was found,
-				//and the most occurring interval
-				//sort intervals list (origbytes already sorted)
-				sort.Sort(util.SortableInt64(diffFull))
-				intervals, intervalCounts, tsMode, tsModeCount := createCountMap(diffFull)
-				dsSizes, dsCounts, dsMode, dsModeCount := createCountMap(res.OrigBytesList)
-
-				//more skewed distributions receive a lower score
-				//less skewed distributions receive a higher score
-				tsSkewScore := 1.0 - math.Abs(tsSkew) //smush tsSkew
-				dsSkewScore := 1.0 - math.Abs(dsSkew) //smush dsSkew
-
-				//lower dispersion is better, cutoff dispersion scores at 30 seconds
-				tsMadmScore := 1.0 - float64(tsMadm)/30.0
-				if tsMadmScore < 0 {
-					tsMadmScore = 0
+				// the features are stored before baselines and the minimum score are applied, so
+				// pairs dropped by either can become beacons when they are rescored
+				if a.storeFeatures {
+					a.write(res.Hosts, a.featureActions(res))
 				}
 
-				//lower dispersion is better, cutoff dispersion scores at 32 bytes
-				dsMadmScore := 1.0 - float64(dsMadm)/32.0
-				if dsMadmScore < 0 {
-					dsMadmScore = 0
+				// the statistics are stored for analysts no matter which model produced the score
+				// the default model reuses them rather than computing them again
+				res, stats := withStats(res, a.conf, a.tsMin, a.tsMax)
+				score, breakdown := a.model.Score(res)
+
+				// beacons matching the known good behavior of their destination are noise. Suppressed
+				// beacons are removed along with any earlier result, while downgraded beacons are kept.
+				if profile, ok := a.baselineProfile(res.Hosts.FQDN, stats); ok {
+					if profile.Action == config.BaselineSuppress {
+						a.removeBeacon(res.Hosts)
+						a.log.WithFields(log.Fields{
+							"Module":  "beaconSNI",
+							"Data":    res.Hosts,
+							"Profile": profile.Domain,
+						}).Debug("suppressed SNI beacon matching a baseline profile")
+						a.finished(res.Hosts)
+						continue
+					}
+					score = math.Ceil(score*profile.ScoreFactor*1000) / 1000
+					if breakdown == nil {
+						breakdown = make(map[string]float64)
+					}
+					breakdown["baseline"] = profile.ScoreFactor
 				}
 
-				//smaller data sizes receive a higher score
-				dsSmallnessScore := 1.0 - float64(dsMode)/65535.0
-				if dsSmallnessScore < 0 {
-					dsSmallnessScore = 0
+				// per pair logging is checked first so the default run doesn't build log fields
+				if a.conf.S.Log.AnalysisVerbosity >= config.AnalysisVerbosityPairs {
+					a.logScore(res, stats, score, breakdown)
 				}
 
-				// connection count scoring
-				tsConnDiv := (float64(a.tsMax) - float64(a.tsMin)) / 10.0
-				tsConnCountScore := float64(res.ConnectionCount) / tsConnDiv
-				if tsConnCountScore > 1.0 {
-					tsConnCountScore = 1.0
+				// low scoring beacons only bloat the collection, so they are counted rather than stored.
+				// Any earlier result is removed since the pair no longer scores high enough to keep.
+				if score < a.conf.S.BeaconSNI.MinScoreToStore {
+					a.removeBeacon(res.Hosts)
+					atomic.AddInt64(&a.belowMinScore, 1)
+					a.finished(res.Hosts)
+					continue
 				}
 
-				//score numerators
-				tsSum := tsSkewScore + tsMadmScore + tsConnCountScore
-				dsSum := dsSkewScore + dsMadmScore + dsSmallnessScore
-
-				//score averages
-				tsScore := math.Ceil((tsSum/3.0)*1000) / 1000
-				dsScore := math.Ceil((dsSum/3.0)*1000) / 1000
-				score := math.Ceil(((tsSum+dsSum)/6.0)*1000) / 1000
-
 				// copy variables to be used by bulk callback to prevent capturing by reference
 				pairSelector := res.Hosts.BSONKey()
 				beaconQuery := bson.M{
@@ -224,30 +304,89 @@ func (a *analyzer) start() {
 						"connection_count":   res.ConnectionCount,
 						"avg_bytes":          res.TotalBytes / res.ConnectionCount,
 						"total_bytes":        res.TotalBytes,
-						"ts.range":           tsIntervalRange,
-						"ts.mode":            tsMode,
-						"ts.mode_count":      tsModeCount,
-						"ts.intervals":       intervals,
-						"ts.interval_counts": intervalCounts,
-						"ts.dispersion":      tsMadm,
-						"ts.skew":            tsSkew,
-						"ts.conns_score":     tsConnCountScore,
-						"ts.score":           tsScore,
-						"ds.range":           dsRange,
-						"ds.mode":            dsMode,
-						"ds.mode_count":      dsModeCount,
-						"ds.sizes":           dsSizes,
-						"ds.counts":          dsCounts,
-						"ds.dispersion":      dsMadm,
-						"ds.skew":            dsSkew,
-						"ds.score":           dsScore,
+						"ts.range":           stats.tsIntervalRange,
+						"ts.mode":            stats.tsMode,
+						"ts.mode_count":      stats.tsModeCount,
+						"ts.intervals":       stats.intervals,
+						"ts.interval_counts": stats.intervalCounts,
+						"ts.dispersion":      stats.tsMadm,
+						"ts.skew":            stats.tsSkew,
+						"ts.conns_score":     stats.tsConnCountScore,
+						"ts.score":           stats.tsScore,
+						"ts.resolution":      stats.tsResolution,
+						"ds.range":           stats.dsRange,
+						"ds.mode":            stats.dsMode,
+						"ds.mode_count":      stats.dsModeCount,
+						"ds.sizes":           stats.dsSizes,
+						"ds.counts":          stats.dsCounts,
+						"ds.dispersion":      stats.dsMadm,
+						"ds.skew":            stats.dsSkew,
+						"ds.score":           stats.dsScore,
+						"ds.downsampled":     res.BytesDownsampled,
+						"ds.mode_fraction":   res.BytesModeFraction,
 						"score":              score,
+						"score_breakdown":    breakdown,
+						"source_cardinality": res.SourceCardinality,
 						"cid":                a.chunk,
 						"src_network_name":   res.Hosts.SrcNetworkName,
 						"responding_ips":     res.RespondingIPs,
 					},
 				}
 
+				// the feature vector explains the score, but is only stored on request to keep documents small
+				if a.conf.S.BeaconSNI.ScoreFeatures {
+					beaconQuery["$set"].(bson.M)["score_features"] = scoreFeatures(res, stats, breakdown)
+				}
+
+				// the recency weighted count is only known when decay is enabled
+				if res.DecayedCount > 0 {
+					beaconQuery["$set"].(bson.M)["ts.decayed_count"] = res.DecayedCount
+				}
+
+				// the clustered share is only measured when a minimum spacing is set
+				if res.ClusteredFraction > 0 {
+					beaconQuery["$set"].(bson.M)["ts.clustered"] = res.ClusteredFraction
+				}
+
+				// the domain's age is only known when it is listed in a domain age file
+				if res.DomainAgeKnown {
+					beaconQuery["$set"].(bson.M)["domain_age"] = res.DomainAge
+				}
+
+				// the period is only searched for when the periodogram is enabled
+				if res.DominantPeriod > 0 {
+					beaconQuery["$set"].(bson.M)["ts.period"] = res.DominantPeriod
+					beaconQuery["$set"].(bson.M)["ts.periodicity"] = res.Periodicity
+				}
+
+				// the trend is only measured when it is scored
+				if res.CountTrend != 0 {
+					beaconQuery["$set"].(bson.M)["ts.count_trend"] = res.CountTrend
+				}
+
+				// the number of intervals clamped shows how much trimming moved the timing scores
+				if res.TrimmedDeltas != nil {
+					beaconQuery["$set"].(bson.M)["ts.winsorized"] = stats.tsWinsorized
+				}
+
+				// the version and model are stamped on every write, so a rescored beacon is brought up to date
+				if a.provenance != nil {
+					beaconQuery["$set"].(bson.M)["dat.analyzer_version"] = a.provenance.AnalyzerVersion
+					beaconQuery["$set"].(bson.M)["dat.scoring_model"] = a.provenance.ScoringModel
+				}
+
+				// most lookups finished while the pair was being scored, so this rarely waits
+				if len(res.ptrLookups) > 0 {
+					if ptrs := waitPTRs(res.ptrLookups, a.ptrWait); len(ptrs) > 0 {
+						beaconQuery["$set"].(bson.M)["responder_ptrs"] = ptrs
+					}
+				}
+
+				// beacons of clients behind a NAT record the address they were seen from
+				if res.NATSrcIP != "" {
+					beaconQuery["$set"].(bson.M)["nat_src"] = res.NATSrcIP
+				}
+
 				update := mgoBulkActions{
 					a.conf.T.BeaconSNI.BeaconSNITable: func(b *mgo.Bulk) int {
 						b.Upsert(pairSelector, beaconQuery)
@@ -255,8 +394,26 @@ func (a *analyzer) start() {
 					},
 				}
 
-				a.analyzedCallback(update)
+				a.write(res.Hosts, update)
+
+				if a.scoredCallback != nil {
+					a.scoredCallback(ScoredBeacon{
+						Hosts:           res.Hosts,
+						ConnectionCount: res.ConnectionCount,
+						Score:           score,
+						ScoreBreakdown:  breakdown,
+					})
+				}
+
+				if a.findingCallback != nil {
+					a.findingCallback(newFinding(res, score, breakdown, a.conf.S.BeaconSNI.TimestampResolution == config.MillisecondResolution))
+				}
+
+				if a.isNewBeacon(res.Hosts) {
+					a.newBeaconCallback(res.Hosts, score)
+				}
 			}
+			a.finished(res.Hosts)
 		}
 		a.analysisWg.Done()
 	}()
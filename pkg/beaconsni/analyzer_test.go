@@ -0,0 +1,163 @@
+package beaconsni
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsNewBeacon(t *testing.T) {
+	seen := data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "10.0.0.1"}, FQDN: "old.example.com"}
+	unseen := data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "10.0.0.1"}, FQDN: "new.example.com"}
+
+	a := &analyzer{}
+	assert.False(t, a.isNewBeacon(unseen), "new beacon alerts should be disabled by default")
+
+	a.enableNewBeacons(
+		map[string]struct{}{seen.MapKey(): {}},
+		func(data.UniqueSrcFQDNPair, float64) {},
+	)
+	assert.False(t, a.isNewBeacon(seen), "beacons from the prior run are not new")
+	assert.True(t, a.isNewBeacon(unseen), "beacons missing from the prior run are new")
+}
+
+func TestBaselineProfiles(t *testing.T) {
+	logger := log.New()
+	logger.Out = ioutil.Discard
+
+	conf := &config.Config{}
+	conf.R.BeaconSNI.Baselines = config.BaselineProfiles{
+		{Domain: "update.example.com", Interval: time.Hour, Tolerance: time.Minute, Action: config.BaselineSuppress},
+		{Domain: "telemetry.example.com", Interval: time.Hour, Tolerance: time.Minute, Action: config.BaselineDowngrade, ScoreFactor: 0.5},
+	}
+
+	// hourly connections with a constant data size
+	hourly := func(fqdn string) DissectorResults {
+		ts := []int64{0, 3600, 7200, 10800, 14400, 18000}
+		return DissectorResults{
+			Hosts:           data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "10.0.0.1"}, FQDN: fqdn},
+			ConnectionCount: int64(len(ts)),
+			TotalBytes:      600,
+			TsList:          ts,
+			TsListFull:      ts,
+			OrigBytesList:   []int64{100, 100, 100, 100, 100, 100},
+		}
+	}
+
+	var actions []mgoBulkActions
+	scored := make(map[string]ScoredBeacon)
+	a := newAnalyzer(0, 18000, 0, newDefaultModel(conf, 0, 18000), nil, conf, logger,
+		func(update mgoBulkActions) { actions = append(actions, update) },
+		func() error { return nil },
+	)
+	a.enableScoredCallback(func(beacon ScoredBeacon) { scored[beacon.Hosts.FQDN] = beacon })
+	a.start()
+	a.collect(hourly("update.example.com"))
+	a.collect(hourly("telemetry.example.com"))
+	a.collect(hourly("unknown.example.com"))
+	require.Nil(t, a.close())
+
+	assert.Len(t, actions, 3, "suppressed beacons should still remove any earlier result")
+	assert.NotContains(t, scored, "update.example.com", "suppressed beacons should not be reported")
+
+	require.Contains(t, scored, "unknown.example.com")
+	require.Contains(t, scored, "telemetry.example.com")
+	base := scored["unknown.example.com"].Score
+	assert.InDelta(t, base*0.5, scored["telemetry.example.com"].Score, 0.001, "downgraded beacons should have their score scaled")
+	assert.Equal(t, 0.5, scored["telemetry.example.com"].ScoreBreakdown["baseline"])
+	assert.NotContains(t, scored["unknown.example.com"].ScoreBreakdown, "baseline")
+}
+
+func TestMinScoreToStore(t *testing.T) {
+	logger := log.New()
+	logger.Out = ioutil.Discard
+
+	ts := []int64{0, 3600, 7200, 10800, 14400, 18000}
+	res := DissectorResults{
+		Hosts:           data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "10.0.0.1"}, FQDN: "c2.example.com"},
+		ConnectionCount: int64(len(ts)),
+		TotalBytes:      600,
+		TsList:          ts,
+		TsListFull:      ts,
+		OrigBytesList:   []int64{100, 100, 100, 100, 100, 100},
+	}
+
+	conf := &config.Config{}
+	score, _ := newDefaultModel(conf, 0, 18000).Score(res)
+
+	// analyze runs the pair with the given minimum score, returning whether it was stored
+	analyze := func(minScore float64) bool {
+		conf.S.BeaconSNI.MinScoreToStore = minScore
+
+		var actions []mgoBulkActions
+		stored := false
+		a := newAnalyzer(0, 18000, 0, newDefaultModel(conf, 0, 18000), nil, conf, logger,
+			func(update mgoBulkActions) { actions = append(actions, update) },
+			func() error { return nil },
+		)
+		a.enableScoredCallback(func(ScoredBeacon) { stored = true })
+		a.start()
+		a.collect(res)
+		require.Nil(t, a.close())
+
+		require.Len(t, actions, 1, "beacons below the minimum score should still remove any earlier result")
+		if stored {
+			assert.EqualValues(t, 0, a.belowMinScore)
+		} else {
+			assert.EqualValues(t, 1, a.belowMinScore)
+		}
+		return stored
+	}
+
+	assert.True(t, analyze(0), "every beacon should be stored by default")
+	assert.True(t, analyze(score), "beacons scoring exactly the minimum score should be stored")
+	assert.False(t, analyze(score+0.001), "beacons scoring below the minimum score should not be stored")
+}
+
+func TestAnalysisVerbosity(t *testing.T) {
+	ts := []int64{0, 3600, 7200, 10800, 14400, 18000}
+	res := DissectorResults{
+		Hosts:           data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "10.0.0.1"}, FQDN: "c2.example.com"},
+		ConnectionCount: int64(len(ts)),
+		TotalBytes:      600,
+		TsList:          ts,
+		TsListFull:      ts,
+		OrigBytesList:   []int64{100, 100, 100, 100, 100, 100},
+	}
+
+	// analyze runs the pair at the given verbosity, returning what was logged
+	analyze := func(verbosity int) []*log.Entry {
+		logger, hook := test.NewNullLogger()
+		conf := &config.Config{}
+		conf.S.Log.AnalysisVerbosity = verbosity
+
+		a := newAnalyzer(0, 18000, 0, newDefaultModel(conf, 0, 18000), nil, conf, logger,
+			func(mgoBulkActions) {},
+			func() error { return nil },
+		)
+		a.start()
+		a.collect(res)
+		require.Nil(t, a.close())
+		return hook.AllEntries()
+	}
+
+	assert.Empty(t, analyze(config.AnalysisVerbositySummary), "nothing should be logged per pair by default")
+
+	entries := analyze(config.AnalysisVerbosityPairs)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "scored SNI beacon", entries[0].Message)
+	assert.Contains(t, entries[0].Data, "Score")
+	assert.NotContains(t, entries[0].Data, "Breakdown", "feature scores should only be logged at the highest verbosity")
+
+	entries = analyze(config.AnalysisVerbosityFeatures)
+	require.Len(t, entries, 1)
+	assert.Contains(t, entries[0].Data, "Breakdown")
+	assert.Contains(t, entries[0].Data, "TsDispersion")
+}
@@ -0,0 +1,56 @@
+package beaconsni
+
+import (
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+)
+
+//labelASNs sets the ASN of each responder found in the given ASN database
+func labelASNs(responders []data.UniqueIP, asns config.ASNDatabase) {
+	if len(asns) == 0 {
+		return
+	}
+	for i := range responders {
+		if number, ok := asns.Lookup(responders[i].IP); ok {
+			responders[i].ASN = number
+		}
+	}
+}
+
+//anyInASNs returns true if at least one of the responders is in one of the given ASNs
+func anyInASNs(responders []data.UniqueIP, asns []int64) bool {
+	for _, responder := range responders {
+		if containsASN(asns, responder.ASN) {
+			return true
+		}
+	}
+	return false
+}
+
+//allInASNs returns true if there is at least one responder and every responder is in
+//one of the given ASNs. Responders without a known ASN are never in the list.
+func allInASNs(responders []data.UniqueIP, asns []int64) bool {
+	if len(responders) == 0 || len(asns) == 0 {
+		return false
+	}
+	for _, responder := range responders {
+		if !containsASN(asns, responder.ASN) {
+			return false
+		}
+	}
+	return true
+}
+
+//containsASN returns true if the given ASN is in the list. The lists are short
+//enough that a linear search beats building a set.
+func containsASN(asns []int64, asn int64) bool {
+	if asn == 0 {
+		return false
+	}
+	for _, listed := range asns {
+		if listed == asn {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package beaconsni
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllInASNs(t *testing.T) {
+	cloud := []int64{16509, 8075}
+	responders := []data.UniqueIP{{IP: "52.94.0.1", ASN: 16509}, {IP: "20.0.0.1", ASN: 8075}}
+	assert.True(t, allInASNs(responders, cloud))
+
+	mixed := append(responders, data.UniqueIP{IP: "203.0.113.7", ASN: 64500})
+	assert.False(t, allInASNs(mixed, cloud), "a single responder outside of the list should keep the pair")
+
+	unknown := append(responders, data.UniqueIP{IP: "198.51.100.1"})
+	assert.False(t, allInASNs(unknown, cloud), "a responder without an ASN should keep the pair")
+
+	assert.False(t, allInASNs(nil, cloud), "a pair without responders should be kept")
+	assert.False(t, allInASNs(responders, nil), "an empty list should filter nothing")
+}
+
+func TestAnyInASNs(t *testing.T) {
+	responders := []data.UniqueIP{{IP: "52.94.0.1", ASN: 16509}, {IP: "198.51.100.1"}}
+	assert.True(t, anyInASNs(responders, []int64{16509}))
+	assert.False(t, anyInASNs(responders, []int64{64500}))
+	assert.False(t, anyInASNs(responders, nil))
+}
@@ -0,0 +1,21 @@
+package beaconsni
+
+//clusteredFraction returns the share of the intervals between consecutive connections in
+//tsListFull which are shorter than minSpacing, in the same unit as the timestamps. Loading
+//a web page opens many connections within a second or two, so browsing shows up as most
+//intervals being clustered, while a beacon keeps its connections apart. Connections made at
+//the same time count as a clustered interval. The timestamps must be sorted, and 0 is
+//returned if there are fewer than two of them.
+func clusteredFraction(tsListFull []int64, minSpacing float64) float64 {
+	if len(tsListFull) < 2 {
+		return 0
+	}
+
+	clustered := 0
+	for i := 1; i < len(tsListFull); i++ {
+		if float64(tsListFull[i]-tsListFull[i-1]) < minSpacing {
+			clustered++
+		}
+	}
+	return float64(clustered) / float64(len(tsListFull)-1)
+}
@@ -0,0 +1,23 @@
+package beaconsni
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusteredFraction(t *testing.T) {
+	// two page loads an hour apart, each opening four connections within a second
+	browsing := []int64{0, 0, 1, 1, 3600, 3600, 3600, 3601}
+	assert.InDelta(t, 6.0/7.0, clusteredFraction(browsing, 2), 0.001)
+
+	beacon := []int64{0, 60, 120, 180, 240}
+	assert.Equal(t, 0.0, clusteredFraction(beacon, 2))
+	assert.Equal(t, 1.0, clusteredFraction(beacon, 61), "intervals equal to the spacing should not be clustered")
+
+	// millisecond timestamps are compared against a spacing in milliseconds
+	assert.Equal(t, 0.5, clusteredFraction([]int64{0, 250, 5000}, 1000))
+
+	assert.Equal(t, 0.0, clusteredFraction([]int64{10}, 2))
+	assert.Equal(t, 0.0, clusteredFraction(nil, 2))
+}
@@ -0,0 +1,108 @@
+package beaconsni
+
+import (
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	log "github.com/sirupsen/logrus"
+)
+
+//certFlagBatchSize is the number of beacons flagged by each update
+const certFlagBatchSize = 1000
+
+//CorrelateCertificates flags the SNI beacons whose source was presented an invalid certificate
+//by one of the beacon's responding IPs by setting invalid_cert to true. Flags left by earlier
+//correlations are cleared first, since beacons are updated in place.
+func (r *repo) CorrelateCertificates() error {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	coll := session.DB(r.database.GetSelectedDB()).C(r.config.T.BeaconSNI.BeaconSNITable)
+
+	if _, err := coll.UpdateAll(
+		bson.M{"invalid_cert": true},
+		bson.M{"$unset": bson.M{"invalid_cert": ""}},
+	); err != nil {
+		return err
+	}
+
+	iter := coll.Pipe(certCorrelationPipeline(r.config.T.Cert.CertificateTable)).AllowDiskUse().Iter()
+
+	var flagged int
+	var batch []bson.ObjectId
+	var match struct {
+		ID bson.ObjectId `bson:"_id"`
+	}
+	for iter.Next(&match) {
+		batch = append(batch, match.ID)
+		if len(batch) == certFlagBatchSize {
+			if err := flagInvalidCerts(coll, batch); err != nil {
+				iter.Close()
+				return err
+			}
+			flagged += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+
+	if len(batch) > 0 {
+		if err := flagInvalidCerts(coll, batch); err != nil {
+			return err
+		}
+		flagged += len(batch)
+	}
+
+	r.log.WithFields(log.Fields{
+		"Module":  "beaconSNI",
+		"Flagged": flagged,
+	}).Info("correlated SNI beacons with invalid certificates")
+	return nil
+}
+
+//flagInvalidCerts sets invalid_cert on the beacons with the given ids
+func flagInvalidCerts(coll *mgo.Collection, ids []bson.ObjectId) error {
+	_, err := coll.UpdateAll(
+		bson.M{"_id": bson.M{"$in": ids}},
+		bson.M{"$set": bson.M{"invalid_cert": true}},
+	)
+	return err
+}
+
+//certCorrelationPipeline returns the ids of the SNI beacons with a responding IP which presented
+//an invalid certificate to the beacon's source. Each responder is joined with certTable on its
+//IP and network UUID, then the source is looked for in the orig_ips of the server's dat
+//subdocuments. Subdocuments which only recorded server name mismatches have a seen of 0 and
+//are skipped.
+func certCorrelationPipeline(certTable string) []bson.M {
+	return []bson.M{
+		{"$project": bson.M{
+			"src":              1,
+			"src_network_uuid": 1,
+			"responding_ips":   1,
+		}},
+		{"$unwind": "$responding_ips"},
+		// the unique ip, network_uuid index on the cert collection keeps the join cheap,
+		// the network UUID is checked below
+		{"$lookup": bson.M{
+			"from":         certTable,
+			"localField":   "responding_ips.ip",
+			"foreignField": "ip",
+			"as":           "cert",
+		}},
+		{"$unwind": "$cert"},
+		{"$match": bson.M{"$expr": bson.M{
+			"$eq": []interface{}{"$cert.network_uuid", "$responding_ips.network_uuid"},
+		}}},
+		{"$unwind": "$cert.dat"},
+		{"$match": bson.M{"cert.dat.seen": bson.M{"$gt": 0}}},
+		{"$unwind": "$cert.dat.orig_ips"},
+		{"$match": bson.M{"$expr": bson.M{"$and": []bson.M{
+			{"$eq": []interface{}{"$cert.dat.orig_ips.ip", "$src"}},
+			{"$eq": []interface{}{"$cert.dat.orig_ips.network_uuid", "$src_network_uuid"}},
+		}}}},
+		// a beacon may match on several responders or chunks, but is only flagged once
+		{"$group": bson.M{"_id": "$_id"}},
+	}
+}
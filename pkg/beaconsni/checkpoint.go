@@ -0,0 +1,191 @@
+package beaconsni
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/globalsign/mgo"
+)
+
+type (
+	//checkpointer tracks which pairs have been finished with so an interrupted run can be
+	//resumed. Pairs must be collected in the order given to newCheckpointer, but may finish
+	//in any order since several dissector threads run at once. A pair is finished once the
+	//dissector is done with it and every write made for it has been flushed by the writer.
+	//The saved checkpoint is the last pair in the unbroken run of finished pairs from the
+	//start of the order.
+	checkpointer struct {
+		mu        sync.Mutex
+		pairs     []data.UniqueSrcFQDNPair // pairs in the order they are collected
+		index     map[string]int           // pair map key to position in pairs
+		done      map[int]bool             // pairs the dissector is done with past the unbroken run
+		pending   map[int]int              // results and writes of each pair which haven't been saved yet
+		buffered  map[*mgo.Bulk][]int      // pairs with writes waiting in each bulk buffer
+		next      int                      // position of the first unfinished pair
+		interval  int                      // number of finished pairs between checkpoints
+		sinceLast int                      // number of finished pairs since the last checkpoint
+		save      func(data.UniqueSrcFQDNPair)
+	}
+
+	//checkpoint is the state document used to resume an interrupted SNI beacon analysis
+	checkpoint struct {
+		ID       string                 `bson:"_id"`
+		CID      int                    `bson:"cid"`
+		LastPair data.UniqueSrcFQDNPair `bson:"last_pair"`
+	}
+)
+
+//checkpointID is the _id of the SNI beacon checkpoint state document
+const checkpointID = "beaconsni"
+
+//sortPairs orders the pairs by their map keys so that the order is stable across runs
+func sortPairs(pairs []data.UniqueSrcFQDNPair) {
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].MapKey() < pairs[j].MapKey()
+	})
+}
+
+//resumePairs drops every pair up to and including lastPair from the sorted pairs
+func resumePairs(pairs []data.UniqueSrcFQDNPair, lastPair data.UniqueSrcFQDNPair) []data.UniqueSrcFQDNPair {
+	lastKey := lastPair.MapKey()
+	skip := sort.Search(len(pairs), func(i int) bool {
+		return pairs[i].MapKey() > lastKey
+	})
+	return pairs[skip:]
+}
+
+//newCheckpointer creates a checkpointer for the given sorted pairs which calls save
+//every interval finished pairs
+func newCheckpointer(pairs []data.UniqueSrcFQDNPair, interval int, save func(data.UniqueSrcFQDNPair)) *checkpointer {
+	index := make(map[string]int, len(pairs))
+	for i, pair := range pairs {
+		index[pair.MapKey()] = i
+	}
+	return &checkpointer{
+		pairs:    pairs,
+		index:    index,
+		done:     make(map[int]bool),
+		pending:  make(map[int]int),
+		buffered: make(map[*mgo.Bulk][]int),
+		interval: interval,
+		save:     save,
+	}
+}
+
+//alias lets the results of a client behind the NAT address of the given collected pair be
+//tracked under the collected pair. A client which is a collected pair itself keeps its own place.
+func (c *checkpointer) alias(client data.UniqueSrcFQDNPair, collected data.UniqueSrcFQDNPair) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.index[client.MapKey()]; ok {
+		return
+	}
+	if i, ok := c.index[collected.MapKey()]; ok {
+		c.index[client.MapKey()] = i
+	}
+}
+
+//hold keeps the given pair from being finished until release is called for it, such as
+//while its results make their way through the sorter and analyzer
+func (c *checkpointer) hold(pair data.UniqueSrcFQDNPair) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if i, ok := c.index[pair.MapKey()]; ok {
+		c.pending[i]++
+	}
+}
+
+//release undoes a call to hold for the given pair
+func (c *checkpointer) release(pair data.UniqueSrcFQDNPair) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if i, ok := c.index[pair.MapKey()]; ok {
+		c.pending[i]--
+		c.advance()
+	}
+}
+
+//track holds the given pair until every bulk buffer its actions are added to has been
+//flushed. The returned actions record the buffers they are added to, and flushed must be
+//called once each of those buffers has been run successfully.
+func (c *checkpointer) track(pair data.UniqueSrcFQDNPair, actions mgoBulkActions) mgoBulkActions {
+	c.mu.Lock()
+	i, ok := c.index[pair.MapKey()]
+	if ok {
+		c.pending[i] += len(actions)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return actions
+	}
+
+	tracked := make(mgoBulkActions, len(actions))
+	for tgtColl, action := range actions {
+		action := action
+		tracked[tgtColl] = func(b *mgo.Bulk) int {
+			c.mu.Lock()
+			c.buffered[b] = append(c.buffered[b], i)
+			c.mu.Unlock()
+			return action(b)
+		}
+	}
+	return tracked
+}
+
+//flushed releases the pairs whose writes were waiting in the given bulk buffer. It must only
+//be called once the buffer has been run successfully, since a failed run keeps its actions.
+func (c *checkpointer) flushed(b *mgo.Bulk) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, i := range c.buffered[b] {
+		c.pending[i]--
+	}
+	delete(c.buffered, b)
+	c.advance()
+}
+
+//markDone records that the dissector has finished with the given pair
+func (c *checkpointer) markDone(pair data.UniqueSrcFQDNPair) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, ok := c.index[pair.MapKey()]
+	if !ok {
+		return
+	}
+	c.done[i] = true
+	c.advance()
+}
+
+//advance extends the unbroken run over the pairs which are finished, saving a checkpoint every
+//interval pairs. The caller must hold c.mu.
+func (c *checkpointer) advance() {
+	for c.done[c.next] && c.pending[c.next] == 0 {
+		delete(c.done, c.next)
+		delete(c.pending, c.next)
+		c.next++
+		c.sinceLast++
+	}
+
+	if c.sinceLast < c.interval {
+		return
+	}
+	c.sinceLast = 0
+	c.save(c.pairs[c.next-1])
+}
+
+//saveProgress saves the last pair in the unbroken run of finished pairs. Pairs whose writes
+//failed are never finished, so the checkpoint stays in front of them.
+func (c *checkpointer) saveProgress() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.next > 0 {
+		c.save(c.pairs[c.next-1])
+	}
+}
@@ -0,0 +1,130 @@
+package beaconsni
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/globalsign/mgo"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPairs(fqdns ...string) []data.UniqueSrcFQDNPair {
+	var pairs []data.UniqueSrcFQDNPair
+	for _, fqdn := range fqdns {
+		pairs = append(pairs, data.UniqueSrcFQDNPair{
+			UniqueSrcIP: data.UniqueSrcIP{SrcIP: "10.0.0.1"},
+			FQDN:        fqdn,
+		})
+	}
+	return pairs
+}
+
+func TestCheckpointerOutOfOrder(t *testing.T) {
+	pairs := testPairs("d.com", "b.com", "a.com", "c.com", "f.com", "e.com")
+	sortPairs(pairs)
+
+	var saved []string
+	c := newCheckpointer(pairs, 2, func(pair data.UniqueSrcFQDNPair) {
+		saved = append(saved, pair.FQDN)
+	})
+
+	c.markDone(pairs[1])
+	c.markDone(pairs[0])
+	assert.Equal(t, []string{"b.com"}, saved)
+
+	// d.com finishing before c.com does not extend the unbroken run
+	c.markDone(pairs[3])
+	assert.Equal(t, []string{"b.com"}, saved)
+	c.markDone(pairs[2])
+	assert.Equal(t, []string{"b.com", "d.com"}, saved)
+
+	c.markDone(pairs[5])
+	c.markDone(pairs[4])
+	assert.Equal(t, []string{"b.com", "d.com", "f.com"}, saved)
+}
+
+func TestCheckpointerWaitsForFlush(t *testing.T) {
+	pairs := testPairs("a.com", "b.com", "c.com")
+
+	var saved []string
+	c := newCheckpointer(pairs, 1, func(pair data.UniqueSrcFQDNPair) {
+		saved = append(saved, pair.FQDN)
+	})
+
+	// a.com's results are still on their way to the analyzer when the dissector is done with it
+	c.hold(pairs[0])
+	c.markDone(pairs[0])
+	assert.Empty(t, saved)
+
+	// the analyzer writes a.com's results to two bulk buffers
+	first, second := &mgo.Bulk{}, &mgo.Bulk{}
+	actions := c.track(pairs[0], mgoBulkActions{
+		"beaconSNI": func(*mgo.Bulk) int { return 1 },
+		"features":  func(*mgo.Bulk) int { return 1 },
+	})
+	actions["beaconSNI"](first)
+	actions["features"](second)
+	c.release(pairs[0])
+	assert.Empty(t, saved, "the writes have not been saved yet")
+
+	// b.com has nothing to write
+	c.markDone(pairs[1])
+
+	c.flushed(first)
+	assert.Empty(t, saved, "one of the writes has not been saved yet")
+	c.flushed(second)
+	assert.Equal(t, []string{"b.com"}, saved, "the run should extend past a.com and b.com at once")
+}
+
+func TestCheckpointerAlias(t *testing.T) {
+	pairs := testPairs("a.com", "b.com")
+	client := data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "192.168.1.5"}, FQDN: "a.com"}
+
+	var saved []string
+	c := newCheckpointer(pairs, 1, func(pair data.UniqueSrcFQDNPair) {
+		saved = append(saved, pair.FQDN)
+	})
+
+	// the results of a client behind a.com's NAT address hold back a.com
+	c.alias(client, pairs[0])
+	c.hold(client)
+	c.markDone(pairs[0])
+	assert.Empty(t, saved)
+	c.release(client)
+	assert.Equal(t, []string{"a.com"}, saved)
+
+	// a collected pair keeps its own place
+	c.alias(pairs[1], pairs[0])
+	c.markDone(pairs[1])
+	assert.Equal(t, []string{"a.com", "b.com"}, saved)
+}
+
+func TestCheckpointerSaveProgress(t *testing.T) {
+	pairs := testPairs("a.com", "b.com", "c.com", "d.com")
+
+	var saved []string
+	c := newCheckpointer(pairs, 10, func(pair data.UniqueSrcFQDNPair) {
+		saved = append(saved, pair.FQDN)
+	})
+
+	// nothing has finished, so there is nothing to save
+	c.saveProgress()
+	assert.Empty(t, saved)
+
+	// c.com finished, but b.com was never collected, so the run ends at a.com
+	c.markDone(pairs[0])
+	c.markDone(pairs[2])
+	c.saveProgress()
+	assert.Equal(t, []string{"a.com"}, saved, "progress should not trail behind")
+}
+
+func TestResumePairs(t *testing.T) {
+	pairs := testPairs("c.com", "a.com", "b.com", "d.com")
+	sortPairs(pairs)
+
+	resumed := resumePairs(pairs, pairs[1])
+	assert.Equal(t, testPairs("c.com", "d.com"), resumed)
+
+	// a checkpoint past every pair leaves nothing to do
+	assert.Empty(t, resumePairs(pairs, testPairs("z.com")[0]))
+}
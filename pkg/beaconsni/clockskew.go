@@ -0,0 +1,69 @@
+package beaconsni
+
+import (
+	"sort"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/util"
+)
+
+//correctClocks lines up the connections recorded by sensors with a clock offset with the
+//reference clock by moving each timestamp back by its sensor's offset. Connections from
+//sensors without an offset, or without a sensor, are left alone. The number of corrected
+//connections is returned.
+func correctClocks(conns []natConn, offsets config.SensorOffsets) int {
+	if len(offsets) == 0 {
+		return 0
+	}
+
+	corrected := 0
+	for i := range conns {
+		if offset, ok := offsets[conns[i].Sensor]; ok {
+			conns[i].Ts -= offset.Seconds()
+			corrected++
+		}
+	}
+	return corrected
+}
+
+//correctedTimestamps corrects the clocks of the given connections and lists their unique and
+//full timestamps in order. Connections outside of the window from start to end, inclusive, are
+//left out after they are corrected, and a bound of 0 leaves that end open. The timestamps are
+//truncated to whole seconds, or milliseconds if millis is set. false is returned if none of
+//the connections were corrected, in which case the timestamps gathered by the pipeline are kept.
+func correctedTimestamps(conns []natConn, offsets config.SensorOffsets, start int64, end int64, millis bool) ([]int64, []int64, bool) {
+	if correctClocks(conns, offsets) == 0 {
+		return nil, nil, false
+	}
+
+	var ts, tsFull []int64
+	seen := make(map[int64]bool, len(conns))
+	for _, conn := range conns {
+		if (start > 0 && conn.Ts < float64(start)) || (end > 0 && conn.Ts > float64(end)) {
+			continue
+		}
+
+		connTs := int64(conn.Ts)
+		if millis {
+			connTs = int64(conn.Ts * 1000)
+		}
+		tsFull = append(tsFull, connTs)
+		if !seen[connTs] {
+			seen[connTs] = true
+			ts = append(ts, connTs)
+		}
+	}
+
+	sort.Sort(util.SortableInt64(ts))
+	sort.Sort(util.SortableInt64(tsFull))
+	return ts, tsFull, true
+}
+
+//correctedTimestamps corrects the timestamps of a pair's connections using the sensor clock
+//offsets, analysis window, and timestamp resolution in the config
+func (d *dissector) correctedTimestamps(conns []natConn) ([]int64, []int64, bool) {
+	return correctedTimestamps(
+		conns, d.conf.R.BeaconSNI.SensorOffsets, d.conf.S.Filtering.AnalysisStart, d.conf.S.Filtering.AnalysisEnd,
+		d.conf.S.BeaconSNI.TimestampResolution == config.MillisecondResolution,
+	)
+}
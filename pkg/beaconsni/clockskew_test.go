@@ -0,0 +1,72 @@
+package beaconsni
+
+import (
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/globalsign/mgo/bson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorrectedTimestamps(t *testing.T) {
+	offsets := config.SensorOffsets{"sensor-east": 2 * time.Second, "sensor-west": -1500 * time.Millisecond}
+	conns := func() []natConn {
+		return []natConn{
+			{Ts: 100, Sensor: "sensor-ref"},
+			{Ts: 162, Sensor: "sensor-east"},
+			{Ts: 218.5, Sensor: "sensor-west"},
+			{Ts: 280},
+			{Ts: 340, Sensor: "sensor-ref"},
+			{Ts: 340, Sensor: "sensor-ref"},
+		}
+	}
+
+	ts, tsFull, ok := correctedTimestamps(conns(), offsets, 0, 0, false)
+	require.True(t, ok)
+	assert.Equal(t, []int64{100, 160, 220, 280, 340}, ts, "the drift should be removed before the intervals are measured")
+	assert.Equal(t, []int64{100, 160, 220, 280, 340, 340}, tsFull)
+
+	_, tsFull, _ = correctedTimestamps(conns(), offsets, 0, 0, true)
+	assert.Equal(t, []int64{100000, 160000, 220000, 280000, 340000, 340000}, tsFull)
+
+	_, tsFull, _ = correctedTimestamps(conns(), offsets, 160, 280, false)
+	assert.Equal(t, []int64{160, 220, 280}, tsFull, "the window should be applied to the corrected timestamps")
+
+	_, _, ok = correctedTimestamps(conns(), config.SensorOffsets{"sensor-north": time.Second}, 0, 0, false)
+	assert.False(t, ok, "the pipeline's timestamps should be kept when nothing was corrected")
+}
+
+func TestNATClientsCorrectClocks(t *testing.T) {
+	conf := &config.Config{}
+	conf.S.BeaconSNI.NATClientField = "nat.clients"
+	conf.R.BeaconSNI.SensorOffsets = config.SensorOffsets{"sensor-east": 3 * time.Second}
+	d := &dissector{conf: conf}
+
+	clients := d.natClients(data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "203.0.113.1"}, FQDN: "c2.example.com"}, []natConn{
+		{Ts: 100, Client: "10.0.0.5"},
+		{Ts: 163, Client: "10.0.0.5", Sensor: "sensor-east"},
+	})
+	require.Len(t, clients, 1)
+	assert.Equal(t, []int64{100, 160}, clients[0].tsFull)
+}
+
+func TestAddSensorConns(t *testing.T) {
+	pipeline := []bson.M{
+		{"$match": bson.M{"src": "10.0.0.1"}},
+		{"$limit": 1},
+		{"$project": bson.M{"ts": 1}},
+	}
+
+	pipeline = addConnList(pipeline, "sensor_conns", map[string]string{"sensor": "sensors"})
+	require.Len(t, pipeline, 4)
+
+	conn := pipeline[2]["$addFields"].(bson.M)["sensor_conns"].(bson.M)["$reduce"].(bson.M)["in"].(bson.M)["$concatArrays"].([]interface{})[1].(bson.M)["$map"].(bson.M)["in"].(bson.M)
+	assert.Contains(t, conn, "ts")
+	assert.Equal(t, bson.M{"$toString": bson.M{"$arrayElemAt": []interface{}{
+		bson.M{"$ifNull": []interface{}{"$$this.http.sensors", []interface{}{}}}, "$$i",
+	}}}, conn["sensor"])
+	assert.Equal(t, 1, pipeline[3]["$project"].(bson.M)["sensor_conns"])
+}
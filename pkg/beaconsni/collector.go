@@ -0,0 +1,60 @@
+package beaconsni
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/activecm/rita/pkg/data"
+)
+
+type (
+	//ScoredBeacon is the score given to a single SNI beacon by a score only analysis run
+	ScoredBeacon struct {
+		Hosts           data.UniqueSrcFQDNPair
+		ConnectionCount int64
+		Score           float64
+		ScoreBreakdown  map[string]float64
+	}
+
+	//scoreCollector stands in for the mgoBulkWriter when BeaconSNI.ScoreOnly is enabled.
+	//The analyzer's scores are kept in memory and its database writes are dropped.
+	scoreCollector struct {
+		mu      sync.Mutex
+		results []ScoredBeacon
+	}
+)
+
+//newScoreCollector creates a new, empty score collector
+func newScoreCollector() *scoreCollector {
+	return &scoreCollector{}
+}
+
+//collect drops a group of results which would otherwise be written to the database
+func (c *scoreCollector) collect(mgoBulkActions) {}
+
+//add stores the score of a single beacon. It is safe to call from several analysis threads.
+func (c *scoreCollector) add(beacon ScoredBeacon) {
+	c.mu.Lock()
+	c.results = append(c.results, beacon)
+	c.mu.Unlock()
+}
+
+//close ends the closing cascade. There is nothing to flush, so it never fails.
+func (c *scoreCollector) close() error {
+	return nil
+}
+
+//scores returns the collected beacons ordered by descending score. Ties are ordered
+//by pair so repeated runs over the same data produce the same slice.
+func (c *scoreCollector) scores() []ScoredBeacon {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sort.Slice(c.results, func(i, j int) bool {
+		if c.results[i].Score != c.results[j].Score {
+			return c.results[i].Score > c.results[j].Score
+		}
+		return c.results[i].Hosts.MapKey() < c.results[j].Hosts.MapKey()
+	})
+	return c.results
+}
@@ -0,0 +1,46 @@
+package beaconsni
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScoreCollector(t *testing.T) {
+	pair := func(fqdn string) data.UniqueSrcFQDNPair {
+		return data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "10.0.0.1"}, FQDN: fqdn}
+	}
+
+	c := newScoreCollector()
+	assert.Empty(t, c.scores(), "a new collector should hold no scores")
+
+	// the analysis threads add scores concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.add(ScoredBeacon{Hosts: pair(fmt.Sprintf("%d.example.com", i)), Score: float64(i%5) / 10})
+		}(i)
+	}
+	wg.Wait()
+
+	// database writes are dropped
+	c.collect(mgoBulkActions{})
+	assert.Nil(t, c.close())
+
+	scores := c.scores()
+	require.Len(t, scores, 10)
+	for i := 1; i < len(scores); i++ {
+		assert.True(t, scores[i-1].Score >= scores[i].Score, "scores should be in descending order")
+		if scores[i-1].Score == scores[i].Score {
+			assert.True(t, scores[i-1].Hosts.MapKey() < scores[i].Hosts.MapKey(), "ties should be ordered by pair")
+		}
+	}
+	assert.Equal(t, 0.4, scores[0].Score)
+	assert.Equal(t, "4.example.com", scores[0].Hosts.FQDN)
+}
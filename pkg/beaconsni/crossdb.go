@@ -0,0 +1,125 @@
+package beaconsni
+
+import (
+	"sort"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	log "github.com/sirupsen/logrus"
+)
+
+//MergeAcrossDatabases gathers the SNI connection details of the given pair from each of the
+//named databases and merges them into a single set of results spanning all of them. This
+//supports long term trend analysis over a series of databases (e.g. one per month).
+//Databases without a usable record of the pair are skipped. mgo.ErrNotFound is returned
+//if none of the databases have one.
+func (r *repo) MergeAcrossDatabases(dbNames []string, pair data.UniqueSrcFQDNPair) (DissectorResults, error) {
+	merged := DissectorResults{Hosts: pair}
+
+	// every connection counts towards the merged results, so no threshold is applied per database
+	d := newDissector(int64(r.config.S.Strobe.ConnectionLimit), r.keyBuilder, r.database, r.config, r.log, nil, nil)
+	pipeline := d.buildPipeline(pair, 0)
+
+	ssn := r.database.CopySession()
+	defer r.database.CloseSession(ssn)
+
+	var parts []sniconnDetails
+	for _, dbName := range dbNames {
+		coll := ssn.DB(dbName).C(r.config.T.Structure.SNIConnTable)
+
+		var res sniconnDetails
+		r.queryLimiter.Acquire()
+		err := coll.Pipe(pipeline).AllowDiskUse().One(&res)
+		r.queryLimiter.Release()
+		if err == mgo.ErrNotFound {
+			res, err = r.reconciledDetails(coll, pair)
+		}
+
+		if err == mgo.ErrNotFound {
+			continue
+		} else if err != nil {
+			return merged, err
+		}
+		parts = append(parts, res)
+	}
+
+	if len(parts) == 0 {
+		return merged, mgo.ErrNotFound
+	}
+
+	mergeDetails(&merged, parts)
+	return merged, nil
+}
+
+//reconciledDetails looks for the pair under a different network UUID. Databases imported from
+//different sensors may record the same source with different network UUIDs. The record is only
+//used if the source IP and SNI match exactly one record, since several records means the
+//source IP was seen on several networks and there is no way to tell which one is the pair.
+func (r *repo) reconciledDetails(coll *mgo.Collection, pair data.UniqueSrcFQDNPair) (sniconnDetails, error) {
+	var res sniconnDetails
+
+	srcFQDNKey := bson.M{"src": pair.SrcIP, "fqdn": pair.FQDN}
+	r.queryLimiter.Acquire()
+	matches, err := coll.Find(srcFQDNKey).Count()
+	r.queryLimiter.Release()
+	if err != nil {
+		return res, err
+	}
+	if matches != 1 {
+		return res, mgo.ErrNotFound
+	}
+
+	d := newDissector(
+		int64(r.config.S.Strobe.ConnectionLimit),
+		func(data.UniqueSrcFQDNPair) bson.M { return srcFQDNKey },
+		r.database, r.config, r.log, nil, nil,
+	)
+
+	r.queryLimiter.Acquire()
+	err = coll.Pipe(d.buildPipeline(pair, 0)).AllowDiskUse().One(&res)
+	r.queryLimiter.Release()
+	if err == nil {
+		r.log.WithFields(log.Fields{
+			"Module":   "beaconSNI",
+			"Data":     pair,
+			"Database": coll.Database.Name,
+		}).Info("merged SNI connections recorded under a different network UUID")
+	}
+	return res, err
+}
+
+//mergeDetails combines the SNI connection details gathered from several databases. The
+//connection counts and total bytes are summed, the unique timestamps and responding IPs are
+//unioned, and the full timestamp, byte, and duration lists are concatenated. The timestamp
+//lists are sorted since each database only covers part of the overall time span.
+func mergeDetails(merged *DissectorResults, parts []sniconnDetails) {
+	uniqueTs := make(map[int64]struct{})
+	respondingIPs := make(map[string]struct{})
+
+	for _, part := range parts {
+		merged.ConnectionCount += part.Count
+		merged.TotalBytes += part.TBytes
+
+		for _, ts := range part.Ts {
+			if _, ok := uniqueTs[ts]; !ok {
+				uniqueTs[ts] = struct{}{}
+				merged.TsList = append(merged.TsList, ts)
+			}
+		}
+
+		for _, ip := range part.RespondingIPs {
+			if _, ok := respondingIPs[ip.MapKey()]; !ok {
+				respondingIPs[ip.MapKey()] = struct{}{}
+				merged.RespondingIPs = append(merged.RespondingIPs, ip)
+			}
+		}
+
+		merged.TsListFull = append(merged.TsListFull, part.TsFull...)
+		merged.OrigBytesList = append(merged.OrigBytesList, part.Bytes...)
+		merged.DurationList = append(merged.DurationList, part.Durations...)
+	}
+
+	sort.Slice(merged.TsList, func(i, j int) bool { return merged.TsList[i] < merged.TsList[j] })
+	sort.Slice(merged.TsListFull, func(i, j int) bool { return merged.TsListFull[i] < merged.TsListFull[j] })
+}
@@ -0,0 +1,43 @@
+package beaconsni
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeDetails(t *testing.T) {
+	responderA := data.UniqueIP{IP: "1.1.1.1", NetworkUUID: util.PublicNetworkUUID, NetworkName: util.PublicNetworkName}
+	responderB := data.UniqueIP{IP: "2.2.2.2", NetworkUUID: util.PublicNetworkUUID, NetworkName: util.PublicNetworkName}
+
+	parts := []sniconnDetails{
+		{
+			Count:         3,
+			Ts:            []int64{300, 100, 200},
+			TsFull:        []int64{300, 100, 200},
+			Bytes:         []int64{10, 20, 30},
+			TBytes:        60,
+			RespondingIPs: []data.UniqueIP{responderA},
+		},
+		{
+			Count:         3,
+			Ts:            []int64{50, 300},
+			TsFull:        []int64{50, 300, 300},
+			Bytes:         []int64{40, 50, 60},
+			TBytes:        150,
+			RespondingIPs: []data.UniqueIP{responderA, responderB},
+		},
+	}
+
+	var merged DissectorResults
+	mergeDetails(&merged, parts)
+
+	assert.Equal(t, int64(6), merged.ConnectionCount, "connection counts should be summed")
+	assert.Equal(t, int64(210), merged.TotalBytes, "total bytes should be summed")
+	assert.Equal(t, []int64{50, 100, 200, 300}, merged.TsList, "unique timestamps should be unioned and sorted")
+	assert.Equal(t, []int64{50, 100, 200, 300, 300, 300}, merged.TsListFull, "full timestamps should be concatenated and sorted")
+	assert.Len(t, merged.OrigBytesList, 6)
+	assert.Equal(t, []data.UniqueIP{responderA, responderB}, merged.RespondingIPs, "responding IPs should be unioned")
+}
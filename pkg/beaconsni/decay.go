@@ -0,0 +1,28 @@
+package beaconsni
+
+import "math"
+
+//decayedCount weighs each connection in tsFull by its age relative to tsMax, the last
+//timestamp of the dataset, halving the weight of a connection every halfLife seconds.
+//The weights are summed, so a connection at tsMax counts as 1 and one made a half-life
+//earlier counts as 0.5. Timestamps after tsMax count as 1. When millis is set, tsFull is
+//in milliseconds while tsMax and halfLife stay in seconds.
+func decayedCount(tsFull []int64, tsMax int64, halfLife float64, millis bool) float64 {
+	if halfLife <= 0 {
+		return float64(len(tsFull))
+	}
+
+	scale := 1.0
+	if millis {
+		scale = 1000.0
+	}
+	end := float64(tsMax) * scale
+	halfLife *= scale
+
+	count := 0.0
+	for _, ts := range tsFull {
+		age := math.Max(end-float64(ts), 0)
+		count += math.Pow(0.5, age/halfLife)
+	}
+	return count
+}
@@ -0,0 +1,40 @@
+package beaconsni
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecayedCount(t *testing.T) {
+	day := int64(24 * 60 * 60)
+	end := 10 * day
+	halfLife := float64(day)
+
+	assert.InDelta(t, 1.0, decayedCount([]int64{end}, end, halfLife, false), 1e-9)
+	assert.InDelta(t, 0.5, decayedCount([]int64{end - day}, end, halfLife, false), 1e-9)
+	assert.InDelta(t, 1.75, decayedCount([]int64{end - 2*day, end - day, end}, end, halfLife, false), 1e-9)
+	assert.InDelta(t, 1.0, decayedCount([]int64{end + day}, end, halfLife, false), 1e-9, "connections after the end should not count for more than 1")
+
+	// millisecond timestamps are compared against the end and half-life in seconds
+	assert.InDelta(t, 0.5, decayedCount([]int64{(end - day) * 1000}, end, halfLife, true), 1e-9)
+
+	assert.Equal(t, 3.0, decayedCount([]int64{0, 1, 2}, end, 0, false), "without a half-life every connection should count fully")
+}
+
+func TestDecayedConnectionScore(t *testing.T) {
+	ts := []int64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90}
+	res := DissectorResults{
+		ConnectionCount: int64(len(ts)),
+		TsList:          ts,
+		TsListFull:      ts,
+		OrigBytesList:   []int64{100, 100, 100, 100, 100, 100, 100, 100, 100, 100},
+	}
+	stats := computeStats(res, &config.Config{}, 0, 100)
+	assert.Equal(t, 1.0, stats.tsConnCountScore)
+
+	res.DecayedCount = 5
+	stats = computeStats(res, &config.Config{}, 0, 100)
+	assert.Equal(t, 0.5, stats.tsConnCountScore, "the decayed count should replace the raw count")
+}
@@ -0,0 +1,148 @@
+package beaconsni
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/activecm/rita/database"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	//BeaconDiff holds the SNI beacons which differ between two analysis runs. Each list is
+	//ordered by pair, except for Changed, which puts the largest score changes first.
+	BeaconDiff struct {
+		Added   []DiffedBeacon // beacons found in the current database only
+		Removed []DiffedBeacon // beacons found in the previous database only
+		Changed []DiffedBeacon // beacons whose score moved by at least BeaconSNI.DiffMinScoreChange
+	}
+
+	//DiffedBeacon is a single beacon reported by Diff. PreviousScore is 0 for added beacons
+	//and Score is 0 for removed beacons.
+	DiffedBeacon struct {
+		data.UniqueSrcFQDNPair
+		PreviousScore float64
+		Score         float64
+	}
+
+	//diffBeacon holds the fields of a beaconSNI document needed to compare two runs
+	diffBeacon struct {
+		data.UniqueSrcFQDNPair `bson:",inline"`
+		Score                  float64 `bson:"score"`
+	}
+)
+
+//ErrIncompatibleSchema is returned by Diff when the previous database has no SNI beacons
+//or was analyzed by a major version of RITA with a different SNI beacon schema
+var ErrIncompatibleSchema = errors.New("the previous database does not hold SNI beacons compatible with this version of RITA")
+
+//Diff compares the SNI beacons in the selected database with those in the database selected
+//on previous. Beacons are matched on their source IP, source network UUID, and SNI.
+func (r *repo) Diff(previous *database.DB) (BeaconDiff, error) {
+	if err := r.checkDiffSchema(previous); err != nil {
+		return BeaconDiff{}, err
+	}
+
+	previousBeacons, err := loadDiffBeacons(previous, r.config.T.BeaconSNI.BeaconSNITable)
+	if err != nil {
+		return BeaconDiff{}, err
+	}
+	currentBeacons, err := loadDiffBeacons(r.database, r.config.T.BeaconSNI.BeaconSNITable)
+	if err != nil {
+		return BeaconDiff{}, err
+	}
+
+	return diffBeacons(previousBeacons, currentBeacons, r.config.S.BeaconSNI.DiffMinScoreChange), nil
+}
+
+//checkDiffSchema makes sure the previous database can be compared with the selected one. The
+//beaconSNI collection must exist, and both databases must have been analyzed by the same major
+//version of RITA. Databases missing from the metadatabase can't be checked, so they are allowed.
+func (r *repo) checkDiffSchema(previous *database.DB) error {
+	if !previous.CollectionExists(r.config.T.BeaconSNI.BeaconSNITable) {
+		return ErrIncompatibleSchema
+	}
+
+	metaDB := database.NewMetaDB(r.config, previous.Session, r.log)
+	compatible, err := metaDB.CheckCompatibleAnalyze(previous.GetSelectedDB())
+	if err == mgo.ErrNotFound {
+		r.log.WithFields(log.Fields{
+			"Module":   "beaconSNI",
+			"Database": previous.GetSelectedDB(),
+		}).Warn("previous database is missing from the metadatabase, comparing its SNI beacons anyway")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !compatible {
+		return ErrIncompatibleSchema
+	}
+	return nil
+}
+
+//loadDiffBeacons reads the key and score of every beacon in the given database
+func loadDiffBeacons(db *database.DB, beaconTable string) ([]diffBeacon, error) {
+	ssn := db.CopySession()
+	defer db.CloseSession(ssn)
+
+	var beacons []diffBeacon
+	err := ssn.DB(db.GetSelectedDB()).C(beaconTable).Find(nil).
+		Select(bson.M{"_id": 0, "src": 1, "src_network_uuid": 1, "src_network_name": 1, "fqdn": 1, "score": 1}).
+		All(&beacons)
+	return beacons, err
+}
+
+//diffBeacons compares two sets of beacons. A beacon found in both sets is reported as changed
+//when the absolute difference between its scores is at least minScoreChange.
+func diffBeacons(previous []diffBeacon, current []diffBeacon, minScoreChange float64) BeaconDiff {
+	var diff BeaconDiff
+
+	previousScores := make(map[string]float64, len(previous))
+	for _, beacon := range previous {
+		previousScores[beacon.MapKey()] = beacon.Score
+	}
+
+	for _, beacon := range current {
+		key := beacon.MapKey()
+		previousScore, ok := previousScores[key]
+		if !ok {
+			diff.Added = append(diff.Added, DiffedBeacon{UniqueSrcFQDNPair: beacon.UniqueSrcFQDNPair, Score: beacon.Score})
+			continue
+		}
+		delete(previousScores, key)
+
+		if math.Abs(beacon.Score-previousScore) >= minScoreChange && beacon.Score != previousScore {
+			diff.Changed = append(diff.Changed, DiffedBeacon{
+				UniqueSrcFQDNPair: beacon.UniqueSrcFQDNPair, PreviousScore: previousScore, Score: beacon.Score,
+			})
+		}
+	}
+
+	// whatever is left over was only in the previous run
+	for _, beacon := range previous {
+		if _, ok := previousScores[beacon.MapKey()]; ok {
+			diff.Removed = append(diff.Removed, DiffedBeacon{UniqueSrcFQDNPair: beacon.UniqueSrcFQDNPair, PreviousScore: beacon.Score})
+		}
+	}
+
+	byPair := func(beacons []DiffedBeacon) func(i, j int) bool {
+		return func(i, j int) bool { return beacons[i].MapKey() < beacons[j].MapKey() }
+	}
+	sort.Slice(diff.Added, byPair(diff.Added))
+	sort.Slice(diff.Removed, byPair(diff.Removed))
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		deltaI := math.Abs(diff.Changed[i].Score - diff.Changed[i].PreviousScore)
+		deltaJ := math.Abs(diff.Changed[j].Score - diff.Changed[j].PreviousScore)
+		if deltaI != deltaJ {
+			return deltaI > deltaJ
+		}
+		return diff.Changed[i].MapKey() < diff.Changed[j].MapKey()
+	})
+
+	return diff
+}
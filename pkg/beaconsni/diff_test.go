@@ -0,0 +1,60 @@
+package beaconsni
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffBeacons(t *testing.T) {
+	beacon := func(fqdn string, score float64) diffBeacon {
+		return diffBeacon{
+			UniqueSrcFQDNPair: data.NewUniqueSrcFQDNPair(data.UniqueIP{IP: "10.0.0.1"}, fqdn),
+			Score:             score,
+		}
+	}
+
+	previous := []diffBeacon{
+		beacon("gone.example.com", 0.7),
+		beacon("steady.example.com", 0.8),
+		beacon("nudged.example.com", 0.5),
+		beacon("rising.example.com", 0.3),
+		beacon("falling.example.com", 0.9),
+	}
+	current := []diffBeacon{
+		beacon("steady.example.com", 0.8),
+		beacon("nudged.example.com", 0.55),
+		beacon("rising.example.com", 0.6),
+		beacon("falling.example.com", 0.75),
+		beacon("new.example.com", 0.85),
+	}
+
+	diff := diffBeacons(previous, current, 0.1)
+
+	assert.Len(t, diff.Added, 1)
+	assert.Equal(t, "new.example.com", diff.Added[0].FQDN)
+	assert.Equal(t, 0.85, diff.Added[0].Score)
+
+	assert.Len(t, diff.Removed, 1)
+	assert.Equal(t, "gone.example.com", diff.Removed[0].FQDN)
+	assert.Equal(t, 0.7, diff.Removed[0].PreviousScore)
+
+	// the small change to nudged.example.com is under the threshold
+	assert.Len(t, diff.Changed, 2)
+	assert.Equal(t, "rising.example.com", diff.Changed[0].FQDN, "the largest change should come first")
+	assert.Equal(t, "falling.example.com", diff.Changed[1].FQDN)
+	assert.Equal(t, 0.9, diff.Changed[1].PreviousScore)
+	assert.Equal(t, 0.75, diff.Changed[1].Score)
+
+	// a threshold of 0 reports every change, but never an unchanged score
+	diff = diffBeacons(previous, current, 0)
+	assert.Len(t, diff.Changed, 3)
+
+	// beacons on different networks are different beacons
+	other := beacon("steady.example.com", 0.8)
+	other.SrcNetworkUUID.Data = []byte{1}
+	diff = diffBeacons([]diffBeacon{beacon("steady.example.com", 0.8)}, []diffBeacon{other}, 0.1)
+	assert.Len(t, diff.Added, 1)
+	assert.Len(t, diff.Removed, 1)
+}
@@ -1,195 +1,1169 @@
 package beaconsni
 
 import (
+	"fmt"
+	"math"
+	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
 	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
+	log "github.com/sirupsen/logrus"
 )
 
 type (
 	//dissector gathers all of the connection details between a host and an SNI
 	dissector struct {
-		connLimit         int64                       // limit for strobe classification
-		db                *database.DB                // provides access to MongoDB
-		conf              *config.Config              // contains details needed to access MongoDB
-		dissectedCallback func(dissectorResults)      // gathered SNI connection details are sent to this callback
-		closedCallback    func()                      // called when .close() is called and no more calls to dissectedCallback will be made
-		dissectChannel    chan data.UniqueSrcFQDNPair // holds data to be processed
-		dissectWg         sync.WaitGroup              // wait for dissector to finish
+		connLimit            int64                                               // limit for strobe classification
+		connThresh           int                                                 // pairs must make more connections than this, unless a threshold rule says otherwise
+		keyBuilder           func(data.UniqueSrcFQDNPair) bson.M                 // builds the SNIconn match filter for a pair
+		db                   *database.DB                                        // provides access to MongoDB
+		conf                 *config.Config                                      // contains details needed to access MongoDB
+		log                  *log.Logger                                         // main logger for RITA
+		dissectedCallback    func(DissectorResults)                              // gathered SNI connection details are sent to this callback
+		closedCallback       func(dissectorSummary) error                        // called with the run summary when .close() is called and no more calls to dissectedCallback will be made
+		dissectChannel       chan data.UniqueSrcFQDNPair                         // holds data to be processed
+		dissectWg            sync.WaitGroup                                      // wait for dissector to finish
+		scaler               *dissectorScaler                                    // adds dissector threads on demand (nil if disabled)
+		knownFQDNs           map[string]struct{}                                 // FQDNs seen in previous chunks, used for first contact detection
+		firstContactCallback func(data.UniqueSrcFQDNPair)                        // pairs contacting an FQDN missing from knownFQDNs are sent to this callback (nil if disabled)
+		summary              *dissectorSummary                                   // counts the outcome of each dissected pair
+		checkpoint           *checkpointer                                       // records progress so an interrupted run can be resumed (nil if disabled)
+		examinedCallback     func(data.UniqueSrcFQDNPair, ExaminedReason, int64) // pairs which were not analyzed as beacons are sent to this callback with their connection count (nil if unused)
+		sourceCounts         map[string]int                                      // caches the number of sources which contacted each SNI
+		sourceCountsMu       sync.Mutex                                          // guards sourceCounts
+		liveWorkers          int64                                               // dissector threads which are still running, updated atomically
+		restarts             int64                                               // dissector threads replaced after a panic, updated atomically
+		internalSubnets      []*net.IPNet                                        // subnets considered internal to the network
+		decayHalfLife        float64                                             // seconds for the weight of a connection to halve (0 if disabled)
+		decayEnd             int64                                               // last timestamp of the dataset, connections are weighed by their age relative to it
+		queryLimiter         *util.Limiter                                       // caps the SNIconn queries run at once, shared with other modules (nil if unlimited)
+		ptrResolver          *ptrResolver                                        // looks up the PTR records of external responders in the background (nil if disabled)
+	}
+
+	//sniconnDetails holds the output of the SNIconn aggregation pipeline for a single pair
+	sniconnDetails struct {
+		Count         int64           `bson:"count"`
+		Ts            []int64         `bson:"ts"`
+		TsFull        []int64         `bson:"ts_full"`
+		Bytes         []int64         `bson:"bytes"`
+		Durations     []float64       `bson:"durations"`
+		TBytes        int64           `bson:"tbytes"`
+		RespondingIPs []data.UniqueIP `bson:"responding_ips"`
+		ChunkCounts   []chunkCount    `bson:"chunk_counts"`
+		NATConns      []natConn       `bson:"nat_conns"`
+		SensorConns   []natConn       `bson:"sensor_conns"`
+	}
+
+	//chunkCount holds the connections counted for a pair by a single http or tls entry of a chunk
+	chunkCount struct {
+		CID   int   `bson:"cid"`
+		Count int64 `bson:"count"`
+	}
+
+	//ExaminedReason explains why an examined pair was not analyzed as a beacon
+	ExaminedReason string
+
+	//dissectorSummary reports how a dissector run went. The counters are updated atomically
+	//by the dissector threads and are final once closedCallback is called.
+	dissectorSummary struct {
+		Examined   int64 // pairs collected by the dissector
+		Beacons    int64 // pairs sent on for beacon analysis
+		Strobes    int64 // pairs sent on as strobes
+		Errors     int64 // pairs which could not be read from MongoDB or passed on to dissectedCallback
+		Dropped    int64 // pairs dropped for having too few unique timestamps
+		Filtered   int64 // pairs filtered out before beacon analysis
+		Restarts   int64 // dissector threads replaced after a panic
+		Duplicates int64 // pairs with more than one SNIconn document, counted when BeaconSNI.DuplicateDocuments is error or merge
+		QueryTime  int64 // nanoseconds spent running SNIconn pipelines, summed over every dissector thread
+	}
+
+	//dissectorScaler tracks how often sends to the dissector threads block in order to
+	//decide when more threads are needed. It is only ever touched by the goroutine calling
+	//collect() and start(), so it needs no locking.
+	dissectorScaler struct {
+		workers    int // number of dissector threads started so far
+		maxWorkers int // upper bound on the number of dissector threads
+		sends      int // sends made during the current window
+		blocked    int // sends during the current window which found every thread busy
 	}
 )
 
-//newDissector creates a new dissector for gathering data
-func newDissector(connLimit int64, db *database.DB, conf *config.Config, dissectedCallback func(dissectorResults), closedCallback func()) *dissector {
+//LikelyCDN marks a pair which connected to more distinct responding IPs than BeaconSNI.MaxResponders allows
+const LikelyCDN ExaminedReason = "LikelyCDN"
+
+//IrregularTiming marks a pair whose connection intervals varied more than BeaconSNI.MaxTimingCV allows
+const IrregularTiming ExaminedReason = "IrregularTiming"
+
+//InternalResponders marks a pair whose responding IPs were all internal while
+//BeaconSNI.ExternalRespondersOnly was set
+const InternalResponders ExaminedReason = "InternalResponders"
+
+//SpecialUseResponders marks a pair whose responding IPs were all special use addresses, such as
+//loopback addresses, while BeaconSNI.DropSpecialResponders was set
+const SpecialUseResponders ExaminedReason = "SpecialUseResponders"
+
+//FilteredASNs marks a pair whose responding IPs were all in one of BeaconSNI.FilterASNs
+const FilteredASNs ExaminedReason = "FilteredASNs"
+
+//BelowThreshold marks a pair which made too few connections to be analyzed, or which was
+//flagged as a strobe before the current run
+const BelowThreshold ExaminedReason = "BelowThreshold"
+
+//TooFewTimestamps marks a pair which met the connection threshold with too few unique timestamps to be scored
+const TooFewTimestamps ExaminedReason = "TooFewTimestamps"
+
+//BrowsingBursts marks a pair whose connections were mostly closer together than
+//BeaconSNI.BrowsingBursts.MinSpacing, as when loading web pages
+const BrowsingBursts ExaminedReason = "BrowsingBursts"
+
+//OutsideWindow marks a pair which met the connection threshold with every connection outside
+//the analysis window, as stored or once its timestamps were corrected, leaving nothing to analyze
+const OutsideWindow ExaminedReason = "OutsideWindow"
+
+//FewDistinctDays marks a pair whose connections fell on fewer calendar days than BeaconSNI.MinDistinctDays requires
+const FewDistinctDays ExaminedReason = "FewDistinctDays"
+
+const (
+	// scaleWindow is the number of pairs collected between scaling decisions
+	scaleWindow = 200
+	// scaleSaturation is the fraction of blocked sends in a window which triggers a new thread
+	scaleSaturation = 0.5
+)
+
+//newDissector creates a new dissector for gathering data. keyBuilder overrides how the
+//SNIconn match filter is built for each pair, and defaults to the pair's BSONKey() when nil.
+func newDissector(connLimit int64, keyBuilder func(data.UniqueSrcFQDNPair) bson.M, db *database.DB, conf *config.Config, log *log.Logger, dissectedCallback func(DissectorResults), closedCallback func(dissectorSummary) error) *dissector {
+	if keyBuilder == nil {
+		keyBuilder = func(pair data.UniqueSrcFQDNPair) bson.M { return pair.BSONKey() }
+	}
 	return &dissector{
 		connLimit:         connLimit,
+		connThresh:        conf.S.BeaconSNI.DefaultConnectionThresh,
+		keyBuilder:        keyBuilder,
 		db:                db,
 		conf:              conf,
+		log:               log,
 		dissectedCallback: dissectedCallback,
 		closedCallback:    closedCallback,
 		dissectChannel:    make(chan data.UniqueSrcFQDNPair),
+		summary:           &dissectorSummary{},
+		sourceCounts:      make(map[string]int),
+		internalSubnets:   util.ParseSubnets(conf.S.Filtering.InternalSubnets),
 	}
 }
 
 //collect gathers a pair of hosts to obtain SNI connection data for
 func (d *dissector) collect(datum data.UniqueSrcFQDNPair) {
-	d.dissectChannel <- datum
+	if d.scaler == nil {
+		d.dissectChannel <- datum
+		return
+	}
+
+	// the channel is unbuffered, so a send only succeeds immediately
+	// if a dissector thread is already waiting for work
+	select {
+	case d.dissectChannel <- datum:
+	default:
+		d.scaler.blocked++
+		d.dissectChannel <- datum
+	}
+	d.scaler.sends++
+
+	if d.scaler.sends >= scaleWindow {
+		d.autoScale()
+	}
+}
+
+//enableAutoScaling lets the dissector add threads, up to maxWorkers, whenever the
+//existing threads can't keep up with collect(). Call start() for the initial threads
+//after enabling auto scaling.
+func (d *dissector) enableAutoScaling(maxWorkers int) {
+	d.scaler = &dissectorScaler{maxWorkers: maxWorkers}
+}
+
+//enableFirstContact sends every pair whose FQDN is not in knownFQDNs to firstContactCallback.
+//The check happens before, and independently of, the beacon thresholds.
+func (d *dissector) enableFirstContact(knownFQDNs map[string]struct{}, firstContactCallback func(data.UniqueSrcFQDNPair)) {
+	d.knownFQDNs = knownFQDNs
+	d.firstContactCallback = firstContactCallback
 }
 
-//close waits for the dissector to finish
-func (d *dissector) close() {
+//enableCheckpoints reports every finished pair to the given checkpointer, and holds each
+//pair sent on for analysis until the analyzer is done with it. The pairs must be collected
+//in the order the checkpointer was created with.
+func (d *dissector) enableCheckpoints(checkpoint *checkpointer) {
+	d.checkpoint = checkpoint
+}
+
+//enableExaminedCallback sends every pair which is not analyzed as a beacon or strobe to
+//examinedCallback along with the reason it was skipped and its connection count. Pairs
+//below the connection threshold are only sent when BeaconSNI.AuditExamined is set, since
+//counting their connections costs an extra query per pair.
+func (d *dissector) enableExaminedCallback(examinedCallback func(data.UniqueSrcFQDNPair, ExaminedReason, int64)) {
+	d.examinedCallback = examinedCallback
+}
+
+//skip sends a pair which was not analyzed as a beacon or strobe to the examined callback
+//along with the reason it was skipped and its connection count, if the callback is enabled
+func (d *dissector) skip(pair data.UniqueSrcFQDNPair, reason ExaminedReason, count int64) {
+	if d.examinedCallback != nil {
+		d.examinedCallback(pair, reason, count)
+	}
+}
+
+//auditing returns true if pairs below the connection threshold are sent to the examined
+//callback as well, which takes an extra query per pair
+func (d *dissector) auditing() bool {
+	return d.examinedCallback != nil && d.conf.S.BeaconSNI.AuditExamined
+}
+
+//enableDecay weighs the connections of each beacon by their recency when counting them for
+//scoring. A connection made halfLifeDays before end counts half as much as one made at end.
+//The strobe and connection thresholds still use the raw count.
+func (d *dissector) enableDecay(halfLifeDays float64, end int64) {
+	d.decayHalfLife = halfLifeDays * 24 * 60 * 60
+	d.decayEnd = end
+}
+
+//enableReverseDNS queues the reverse DNS lookups of the external responders of every pair
+//sent on for beacon analysis with resolver. The lookups are attached to the pair's results
+//without waiting for them to finish.
+func (d *dissector) enableReverseDNS(resolver *ptrResolver) {
+	d.ptrResolver = resolver
+}
+
+//enableQueryLimiter makes the dissector take a slot from limiter for every query it runs against
+//SNIconn, so modules sharing the limiter don't overwhelm MongoDB together
+func (d *dissector) enableQueryLimiter(limiter *util.Limiter) {
+	d.queryLimiter = limiter
+}
+
+//enableConnectionRate replaces BeaconSNI.DefaultConnectionThresh with the number of connections
+//made at rate connections per hour over the dataset spanning minTimestamp to maxTimestamp.
+//The effective threshold is returned. Per destination threshold rules still take precedence.
+func (d *dissector) enableConnectionRate(rate float64, minTimestamp int64, maxTimestamp int64) int {
+	d.connThresh = rateThreshold(rate, minTimestamp, maxTimestamp)
+	return d.connThresh
+}
+
+//rateThreshold converts a rate in connections per hour into a connection count over the
+//dataset spanning minTimestamp to maxTimestamp, given in seconds. Pairs must make more
+//connections than the threshold, and a connection count is whole, so making more than the
+//exact product is the same as making more than its floor.
+func rateThreshold(rate float64, minTimestamp int64, maxTimestamp int64) int {
+	hours := float64(maxTimestamp-minTimestamp) / 3600.0
+	if hours <= 0 || rate <= 0 {
+		return 0
+	}
+	return int(math.Floor(rate * hours))
+}
+
+//likelyCDN returns true if a pair's connections were spread across more responding IPs than
+//configured. Traffic spread across that many servers is almost certainly a CDN rather than C2.
+func (d *dissector) likelyCDN(responders int) bool {
+	maxResponders := d.conf.S.BeaconSNI.MaxResponders
+	return maxResponders > 0 && responders > maxResponders
+}
+
+//internalResponders returns true if BeaconSNI.ExternalRespondersOnly is set and every one
+//of a pair's responding IPs is internal. A single external responder keeps the pair, as do
+//pairs without any responders or with responders which can't be parsed, since there is
+//nothing to show they stayed inside the network.
+func (d *dissector) internalResponders(responders []data.UniqueIP) bool {
+	if !d.conf.S.BeaconSNI.ExternalRespondersOnly || len(responders) == 0 {
+		return false
+	}
+
+	for _, responder := range responders {
+		ip := net.ParseIP(responder.IP)
+		if ip == nil || !util.ContainsIP(d.internalSubnets, ip) {
+			return false
+		}
+	}
+	return true
+}
+
+//withoutSpecialUse returns the given responders without those whose addresses are special
+//use, such as loopback and link local addresses, along with the number removed. Responders
+//which can't be parsed are kept. The given slice is left unchanged.
+func withoutSpecialUse(responders []data.UniqueIP) ([]data.UniqueIP, int) {
+	kept := make([]data.UniqueIP, 0, len(responders))
+	for _, responder := range responders {
+		if ip := net.ParseIP(responder.IP); ip != nil && util.IPIsSpecialUse(ip) {
+			continue
+		}
+		kept = append(kept, responder)
+	}
+	return kept, len(responders) - len(kept)
+}
+
+//isBurst returns true if at least BeaconSNI.BurstConcentration of the given chunk counts came
+//from a single chunk. Pairs seen in a single chunk can't be told apart from a strobe, so they
+//never count as a burst. The http and tls entries of a chunk are added together first.
+func (d *dissector) isBurst(datum data.UniqueSrcFQDNPair, chunkCounts []chunkCount) bool {
+	concentration := d.conf.S.BeaconSNI.BurstConcentration
+	if concentration <= 0 {
+		return false
+	}
+
+	perChunk := make(map[int]int64)
+	var total, largest int64
+	for _, chunk := range chunkCounts {
+		perChunk[chunk.CID] += chunk.Count
+		total += chunk.Count
+		if perChunk[chunk.CID] > largest {
+			largest = perChunk[chunk.CID]
+		}
+	}
+
+	if len(perChunk) < 2 || float64(largest) < concentration*float64(total) {
+		return false
+	}
+
+	if d.log != nil {
+		d.log.WithFields(log.Fields{
+			"Module":        "beaconSNI",
+			"Data":          datum,
+			"Connections":   total,
+			"Concentration": float64(largest) / float64(total),
+		}).Debug("treating SNI connection burst as a beacon candidate rather than a strobe")
+	}
+	return true
+}
+
+//strobeCount returns the connection count compared against the strobe limit. When
+//BeaconSNI.CountSmoothingWindow is set, it is the average connections per chunk over the
+//chunks in the window which the pair was seen in, rounded to the nearest connection.
+//Otherwise, it is the pair's total connection count.
+func (d *dissector) strobeCount(connectionCount int64, chunkCounts []chunkCount) int64 {
+	window := d.conf.S.BeaconSNI.CountSmoothingWindow
+	if window <= 0 {
+		return connectionCount
+	}
+	return smoothedCount(chunkCounts, d.conf.S.Rolling.CurrentChunk, window)
+}
+
+//smoothedCount averages the connections per chunk over the window chunks ending with the
+//current chunk. The http and tls entries of a chunk are added together first, and chunks
+//in which the pair wasn't seen are left out of the average.
+func smoothedCount(chunkCounts []chunkCount, currentChunk int, window int) int64 {
+	perChunk := make(map[int]int64)
+	for _, chunk := range chunkCounts {
+		if chunk.CID > currentChunk-window && chunk.CID <= currentChunk {
+			perChunk[chunk.CID] += chunk.Count
+		}
+	}
+	if len(perChunk) == 0 {
+		return 0
+	}
+
+	var total int64
+	for _, count := range perChunk {
+		total += count
+	}
+	return int64(math.Round(float64(total) / float64(len(perChunk))))
+}
+
+//isFirstContact returns true if first contact detection is enabled and the
+//given FQDN was not seen before the current chunk
+func (d *dissector) isFirstContact(fqdn string) bool {
+	if d.firstContactCallback == nil {
+		return false
+	}
+	_, known := d.knownFQDNs[fqdn]
+	return !known
+}
+
+//autoScale starts another dissector thread if most of the sends in the last window
+//blocked waiting on a busy thread. The new thread is started from the collecting
+//goroutine, so dissectWg.Add() always happens before close() calls dissectWg.Wait().
+func (d *dissector) autoScale() {
+	saturation := float64(d.scaler.blocked) / float64(d.scaler.sends)
+	d.scaler.sends = 0
+	d.scaler.blocked = 0
+
+	if saturation < scaleSaturation || d.scaler.workers >= d.scaler.maxWorkers {
+		return
+	}
+
+	d.log.WithFields(log.Fields{
+		"Module":     "beaconSNI",
+		"Workers":    d.scaler.workers + 1,
+		"Saturation": saturation,
+	}).Debug("adding SNI beacon dissector thread")
+	d.start()
+}
+
+//close waits for the dissector to finish and returns any error from the rest of the closing cascade
+func (d *dissector) close() error {
 	close(d.dissectChannel)
 	d.dissectWg.Wait()
-	d.closedCallback()
+	return d.closedCallback(*d.summary)
 }
 
 //start kicks off a new dissector thread
 func (d *dissector) start() {
+	if d.scaler != nil {
+		d.scaler.workers++
+	}
+	d.spawn()
+}
+
+//supervise replaces a dissector thread which panicked, as long as fewer than
+//BeaconSNI.MaxWorkerRestarts threads have been replaced so far. It must be deferred
+//by the dying thread itself, after dissectWg.Done(), so the replacement's dissectWg.Add()
+//happens before the dying thread's dissectWg.Done() and close() keeps waiting on it.
+//If dissectChannel has already been closed the replacement simply finds no work left.
+//When the last thread dies without a replacement, it drains dissectChannel instead
+//so collect() can't block forever on a send nobody will receive.
+func (d *dissector) supervise() {
+	r := recover()
+	if r == nil {
+		atomic.AddInt64(&d.liveWorkers, -1)
+		return
+	}
+	atomic.AddInt64(&d.summary.Errors, 1)
+
+	if atomic.AddInt64(&d.restarts, 1) <= int64(d.conf.S.BeaconSNI.MaxWorkerRestarts) {
+		atomic.AddInt64(&d.summary.Restarts, 1)
+		d.log.WithFields(log.Fields{
+			"Module": "beaconSNI",
+			"Panic":  r,
+		}).Warn("restarting SNI beacon dissector thread after a panic")
+		d.spawn()
+		atomic.AddInt64(&d.liveWorkers, -1)
+		return
+	}
+
+	d.log.WithFields(log.Fields{
+		"Module": "beaconSNI",
+		"Panic":  r,
+	}).Error("SNI beacon dissector thread died and the restart limit was reached")
+
+	if atomic.AddInt64(&d.liveWorkers, -1) == 0 {
+		// every pair still sent to the dissector is lost, so count each one as an error
+		for range d.dissectChannel {
+			atomic.AddInt64(&d.summary.Errors, 1)
+		}
+	}
+}
+
+//spawn starts a dissector thread under supervision
+func (d *dissector) spawn() {
+	atomic.AddInt64(&d.liveWorkers, 1)
 	d.dissectWg.Add(1)
 	go func() {
-		ssn := d.db.Session.Copy()
-		defer ssn.Close()
+		// deferred so close() can't hang on a thread which stopped early
+		defer d.dissectWg.Done()
+		// deferred after Done() so it runs first and a replacement is counted before this thread stops
+		defer d.supervise()
+
+		ssn := d.db.CopySession()
+		defer d.db.CloseSession(ssn)
 
 		for datum := range d.dissectChannel {
+			atomic.AddInt64(&d.summary.Examined, 1)
 
-			matchNoStrobeKey := datum.BSONKey()
-
-			// we are able to filter out already flagged strobes here
-			// because we use the sniconns table to access them. The sniconns table has
-			// already had its counts and stats updated.
-			matchNoStrobeKey["dat.tls.strobe"] = bson.M{"$ne": true}
-			matchNoStrobeKey["dat.http.strobe"] = bson.M{"$ne": true}
-			matchNoStrobeKey["dat.merged.strobe"] = bson.M{"$ne": true}
-
-			sniconnFindQuery := []bson.M{
-				{"$match": matchNoStrobeKey},
-				{"$limit": 1},
-				{"$project": bson.M{
-					"ts":             bson.M{"$concatArrays": []string{"$dat.http.ts", "$dat.tls.ts"}},
-					"bytes":          bson.M{"$concatArrays": []string{"$dat.http.bytes", "$dat.tls.bytes"}},
-					"count":          bson.M{"$concatArrays": []string{"$dat.http.count", "$dat.tls.count"}},
-					"tbytes":         bson.M{"$concatArrays": []string{"$dat.http.tbytes", "$dat.tls.tbytes"}},
-					"responding_ips": bson.M{"$concatArrays": []string{"$dat.http.dst_ips", "$dat.tls.dst_ips"}},
-				}},
-				{"$unwind": "$count"},
-				{"$group": bson.M{
-					"_id":            "$_id",
-					"ts":             bson.M{"$first": "$ts"},
-					"bytes":          bson.M{"$first": "$bytes"},
-					"count":          bson.M{"$sum": "$count"},
-					"tbytes":         bson.M{"$first": "$tbytes"},
-					"responding_ips": bson.M{"$first": "$responding_ips"},
-				}},
-				{"$match": bson.M{"count": bson.M{"$gt": d.conf.S.BeaconSNI.DefaultConnectionThresh}}},
-				{"$unwind": "$tbytes"},
-				{"$group": bson.M{
-					"_id":            "$_id",
-					"ts":             bson.M{"$first": "$ts"},
-					"bytes":          bson.M{"$first": "$bytes"},
-					"count":          bson.M{"$first": "$count"},
-					"tbytes":         bson.M{"$sum": "$tbytes"},
-					"responding_ips": bson.M{"$first": "$responding_ips"},
-				}},
-				{"$unwind": "$ts"},
-				{"$unwind": "$ts"},
-				{"$group": bson.M{
-					"_id":            "$_id",
-					"ts":             bson.M{"$addToSet": "$ts"},
-					"ts_full":        bson.M{"$push": "$ts"},
-					"bytes":          bson.M{"$first": "$bytes"},
-					"count":          bson.M{"$first": "$count"},
-					"tbytes":         bson.M{"$first": "$tbytes"},
-					"responding_ips": bson.M{"$first": "$responding_ips"},
-				}},
-				{"$unwind": "$bytes"},
-				{"$unwind": "$bytes"},
-				{"$group": bson.M{
-					"_id":            "$_id",
-					"ts":             bson.M{"$first": "$ts"},
-					"ts_full":        bson.M{"$first": "$ts_full"},
-					"bytes":          bson.M{"$push": "$bytes"},
-					"count":          bson.M{"$first": "$count"},
-					"tbytes":         bson.M{"$first": "$tbytes"},
-					"responding_ips": bson.M{"$first": "$responding_ips"},
-				}},
-				{"$unwind": "$responding_ips"},
-				{"$unwind": "$responding_ips"},
-				{"$group": bson.M{
-					"_id": bson.M{
-						"sniconn_id":       "$_id",
-						"dst_ip":           "$responding_ips.ip",
-						"dst_network_uuid": "$responding_ips.network_uuid",
-					},
-					"ts":               bson.M{"$first": "$ts"},
-					"ts_full":          bson.M{"$first": "$ts_full"},
-					"bytes":            bson.M{"$first": "$bytes"},
-					"count":            bson.M{"$first": "$count"},
-					"tbytes":           bson.M{"$first": "$tbytes"},
-					"dst_network_name": bson.M{"$last": "$responding_ips.network_name"},
-				}},
-				{"$group": bson.M{
-					"_id":     "$_id.sniconn_id",
-					"ts":      bson.M{"$first": "$ts"},
-					"ts_full": bson.M{"$first": "$ts_full"},
-					"bytes":   bson.M{"$first": "$bytes"},
-					"count":   bson.M{"$first": "$count"},
-					"tbytes":  bson.M{"$first": "$tbytes"},
-					"responding_ips": bson.M{"$push": bson.M{
-						"ip":           "$_id.dst_ip",
-						"network_uuid": "$_id.dst_network_uuid",
-						"network_name": "$dst_network_name",
-					}},
-				}},
-				{"$project": bson.M{
-					"_id":            "$_id",
-					"ts":             1,
-					"ts_full":        1,
-					"bytes":          1,
-					"count":          1,
-					"tbytes":         1,
-					"responding_ips": 1,
-				}},
+			// a brand new destination is worth surfacing whether or not the pair beacons
+			if d.isFirstContact(datum.FQDN) {
+				d.firstContactCallback(datum)
 			}
 
-			var res struct {
-				Count         int64           `bson:"count"`
-				Ts            []int64         `bson:"ts"`
-				TsFull        []int64         `bson:"ts_full"`
-				Bytes         []int64         `bson:"bytes"`
-				TBytes        int64           `bson:"tbytes"`
-				RespondingIPs []data.UniqueIP `bson:"responding_ips"`
+			// pick the thresholds for this pair, taking any per destination overrides into account
+			connThresh, connLimit := d.conf.R.BeaconSNI.ThresholdRules.Thresholds(
+				datum.FQDN, d.connThresh, d.connLimit,
+			)
+
+			sniconnFindQuery := d.buildPipeline(datum, connThresh)
+
+			var res sniconnDetails
+
+			// a pair with duplicate documents is only analyzed if they can be merged
+			err := d.checkDuplicates(ssn, datum)
+			if err == nil {
+				d.queryLimiter.Acquire()
+				queryStart := time.Now()
+				err = ssn.DB(d.db.GetSelectedDB()).C(d.conf.T.Structure.SNIConnTable).Pipe(sniconnFindQuery).AllowDiskUse().One(&res)
+				atomic.AddInt64(&d.summary.QueryTime, int64(time.Since(queryStart)))
+				d.queryLimiter.Release()
 			}
 
-			_ = ssn.DB(d.db.GetSelectedDB()).C(d.conf.T.Structure.SNIConnTable).Pipe(sniconnFindQuery).AllowDiskUse().One(&res)
+			// not found just means the pair didn't meet the connection threshold
+			if err != nil && err != mgo.ErrNotFound {
+				atomic.AddInt64(&d.summary.Errors, 1)
+				d.log.WithFields(log.Fields{
+					"Module": "beaconSNI",
+					"Data":   datum,
+					"Error":  err.Error(),
+				}).Debug("could not gather SNI connection details")
+			}
+
+			// record pairs which fell short of the threshold for coverage auditing
+			if res.Count == 0 && (err == nil || err == mgo.ErrNotFound) &&
+				d.auditing() {
+				count, inWindow := d.connectionCounts(ssn, datum)
+				d.skip(datum, unmatchedReason(count, inWindow, connThresh), count)
+			}
 
 			// Check for errors and parse results
 			// this is here because it will still return an empty document even if there are no results
 			if res.Count > 0 {
-				analysisInput := dissectorResults{
+				analysisInput := DissectorResults{
 					Hosts:           datum,
 					RespondingIPs:   res.RespondingIPs,
 					ConnectionCount: res.Count,
 					TotalBytes:      res.TBytes,
 				}
 
-				// check if sniconn has become a strobe
-				if analysisInput.ConnectionCount > d.connLimit {
-					d.dissectedCallback(analysisInput)
+				// responders such as 127.0.0.1 come from misconfigured DNS or ingest rather than real servers
+				specialUse := 0
+				if d.conf.S.BeaconSNI.DropSpecialResponders {
+					analysisInput.RespondingIPs, specialUse = withoutSpecialUse(analysisInput.RespondingIPs)
+				}
+
+				// replace bare network names with the friendly names analysts recognize
+				nameResponders(analysisInput.RespondingIPs, d.conf.R.BeaconSNI.NetworkNames)
+				labelASNs(analysisInput.RespondingIPs, d.conf.R.BeaconSNI.ASNs)
+
+				// check if sniconn has become a strobe. A pair whose connections mostly came
+				// from a single chunk had a one time burst and is analyzed as usual instead.
+				if d.strobeCount(analysisInput.ConnectionCount, res.ChunkCounts) > connLimit && !d.isBurst(datum, res.ChunkCounts) {
+					atomic.AddInt64(&d.summary.Strobes, 1)
+					d.dissected(analysisInput)
+				} else if specialUse > 0 && len(analysisInput.RespondingIPs) == 0 {
+					// none of the pair's traffic reached a real server
+					atomic.AddInt64(&d.summary.Filtered, 1)
+					d.skip(datum, SpecialUseResponders, res.Count)
+				} else if d.likelyCDN(len(analysisInput.RespondingIPs)) {
+					atomic.AddInt64(&d.summary.Filtered, 1)
+					d.skip(datum, LikelyCDN, res.Count)
+				} else if d.internalResponders(analysisInput.RespondingIPs) {
+					// beacons which never leave the network are usually benign
+					atomic.AddInt64(&d.summary.Filtered, 1)
+					d.skip(datum, InternalResponders, res.Count)
+				} else if allInASNs(analysisInput.RespondingIPs, d.conf.S.BeaconSNI.FilterASNs) {
+					// beacons to major cloud providers are usually software updates and telemetry
+					atomic.AddInt64(&d.summary.Filtered, 1)
+					d.skip(datum, FilteredASNs, res.Count)
+				} else if clients := d.natClients(datum, res.NATConns); clients != nil {
+					// connections made from behind a NAT are analyzed for each client on its own
+					d.dissectNATClients(ssn, analysisInput, clients, connThresh)
 				} else { // otherwise, parse timestamps and orig ip bytes
 					analysisInput.TsList = res.Ts
 					analysisInput.TsListFull = res.TsFull
+					// sensors with drifting clocks would add jitter, so their timestamps are lined up first
+					if ts, tsFull, ok := d.correctedTimestamps(res.SensorConns); ok {
+						analysisInput.TsList, analysisInput.TsListFull = ts, tsFull
+					}
 					analysisInput.OrigBytesList = res.Bytes
-					// the analysis worker requires that we have over UNIQUE 3 timestamps
-					// we drop the input here since it is the earliest place in the pipeline to do so
-					if len(analysisInput.TsList) > 3 {
-						d.dissectedCallback(analysisInput)
+					analysisInput.DurationList = res.Durations
+					if d.conf.S.BeaconSNI.CountTrendBoost > 0 {
+						analysisInput.CountTrend, analysisInput.CountTrendRatio = countTrend(
+							res.ChunkCounts, d.conf.S.Rolling.CurrentChunk,
+						)
 					}
+					d.dissectBeacon(ssn, analysisInput)
 				}
 			}
+
+			if d.checkpoint != nil {
+				d.checkpoint.markDone(datum)
+			}
+		}
+	}()
+}
+
+//dissectBeacon prepares the connection details of a pair which passed the strobe and responder
+//checks and sends them on for beacon analysis, unless the pair has no timestamps left in the
+//analysis window, too few unique timestamps, connections on too few distinct days, or too
+//irregular timing. The timestamps, data sizes, and durations must already be set.
+func (d *dissector) dissectBeacon(ssn *mgo.Session, analysisInput DissectorResults) {
+	pair := analysisInput.Hosts
+
+	// the pipeline drops entries left empty by the analysis window, but timestamps corrected
+	// for clock skew are windowed afterwards and may all fall outside of it
+	if len(analysisInput.TsListFull) == 0 {
+		atomic.AddInt64(&d.summary.Dropped, 1)
+		d.skip(pair, OutsideWindow, analysisInput.ConnectionCount)
+		return
+	}
+
+	analysisInput.SourceCardinality = d.sourceCardinality(ssn, pair.FQDN)
+
+	// the domain's age is taken at the first connection, so older logs are judged by when they were made
+	if ages := d.conf.R.BeaconSNI.DomainAges; len(ages) > 0 {
+		firstSeen := unixTime(analysisInput.TsListFull[0], d.conf.S.BeaconSNI.TimestampResolution == config.MillisecondResolution)
+		analysisInput.DomainAge, analysisInput.DomainYouth, analysisInput.DomainAgeKnown = domainAge(
+			ages, pair.FQDN, firstSeen, d.conf.S.BeaconSNI.YoungDomainDays,
+		)
+	}
+
+	d.timingFeatures(&analysisInput)
+	d.sizeFeatures(&analysisInput)
+
+	// the analysis worker requires that we have over UNIQUE 3 timestamps
+	// we drop the input here since it is the earliest place in the pipeline to do so
+	if len(analysisInput.TsList) > 3 {
+		if d.browsingBurst(analysisInput.ClusteredFraction) {
+			// page loads are the cheapest to tell apart, so they are dropped first
+			atomic.AddInt64(&d.summary.Filtered, 1)
+			d.skip(pair, BrowsingBursts, analysisInput.ConnectionCount)
+		} else if d.fewDistinctDays(analysisInput.DistinctDays) {
+			// a burst confined to a few days is dropped before the costlier timing check
+			atomic.AddInt64(&d.summary.Filtered, 1)
+			d.skip(pair, FewDistinctDays, analysisInput.ConnectionCount)
+		} else if d.irregularTiming(analysisInput.TsList, analysisInput.TrimmedDeltas) {
+			atomic.AddInt64(&d.summary.Filtered, 1)
+			d.skip(pair, IrregularTiming, analysisInput.ConnectionCount)
+		} else {
+			// the lookups run while the pair is sorted and scored
+			if d.ptrResolver != nil {
+				analysisInput.ptrLookups = d.ptrResolver.lookupExternal(analysisInput.RespondingIPs, d.internalSubnets)
+			}
+			atomic.AddInt64(&d.summary.Beacons, 1)
+			d.dissected(analysisInput)
+		}
+	} else {
+		atomic.AddInt64(&d.summary.Dropped, 1)
+		d.skip(pair, TooFewTimestamps, analysisInput.ConnectionCount)
+	}
+}
+
+//buildPipeline builds the SNIconn aggregation pipeline used to gather the connection
+//details of the given pair, including every stage enabled by the configuration
+func (d *dissector) buildPipeline(datum data.UniqueSrcFQDNPair, connThresh int) []bson.M {
+	// timestamps are collected as whole seconds by default. In millisecond mode they are
+	// scaled before being added to the unique set so sub-second differences are kept.
+	millis := d.conf.S.BeaconSNI.TimestampResolution == config.MillisecondResolution
+	var tsValue interface{} = "$ts"
+	if !d.conf.S.BeaconSNI.NormalizeTimestamps {
+		tsValue = storedTimestamp("$ts", millis)
+	}
+
+	pipeline := sniconnPipeline(d.matchNoStrobeKey(datum), d.conf.T.BeaconSNI.SNIConnFieldsCfg, connThresh, tsValue, d.conf.S.BeaconSNI.DurationScoring)
+
+	// fields recorded at different resolutions are brought to a common one, in the analysis
+	// unit, before they are merged. The analysis window is then applied in that unit.
+	start, end := d.conf.S.Filtering.AnalysisStart, d.conf.S.Filtering.AnalysisEnd
+	if d.conf.S.BeaconSNI.NormalizeTimestamps {
+		unitStart, unitEnd := windowBounds(start, end, millis)
+		pipeline = normalizeTimestamps(pipeline, d.conf.T.BeaconSNI.TimestampFields,
+			d.conf.S.BeaconSNI.TimestampFieldUnits, millis, unitStart, unitEnd)
+	}
+
+	// per chunk counts are only needed to tell bursts apart from strobes, to smooth the strobe
+	// count, and to measure the trend of the counts
+	if d.conf.S.BeaconSNI.BurstConcentration > 0 || d.conf.S.BeaconSNI.CountSmoothingWindow > 0 ||
+		d.conf.S.BeaconSNI.CountTrendBoost > 0 {
+		addChunkCounts(pipeline)
+	}
+
+	// otherwise, only consider the connections made within the analysis window, if one is set
+	if !d.conf.S.BeaconSNI.NormalizeTimestamps && (start > 0 || end > 0) {
+		pipeline = addTimeWindow(pipeline, start, end)
+	}
+
+	// the sensor of each connection is only needed to correct the sensors' clocks
+	sensorField := ""
+	if len(d.conf.R.BeaconSNI.SensorOffsets) > 0 {
+		sensorField = d.conf.S.BeaconSNI.SensorField
+	}
+
+	// the individual connections are gathered before the window is applied, so they are windowed
+	// by natClients or correctedTimestamps once their clocks are corrected
+	if field := d.conf.S.BeaconSNI.NATClientField; field != "" {
+		pipeline = addNATConns(pipeline, field, sensorField)
+	} else if sensorField != "" {
+		pipeline = addConnList(pipeline, "sensor_conns", map[string]string{"sensor": sensorField})
+	}
+
+	// merging replaces the $limit stage, so the stages added above read the merged document
+	if d.conf.S.BeaconSNI.DuplicateDocuments == config.DuplicatesMerge {
+		pipeline = mergeDuplicates(pipeline)
+	}
+
+	return pipeline
+}
+
+//explainPipeline returns the SNIconn aggregation pipeline the dissector would run for the
+//given pair, using the same thresholds as the analysis
+func (d *dissector) explainPipeline(datum data.UniqueSrcFQDNPair) ([]bson.M, error) {
+	if datum.SrcIP == "" || datum.FQDN == "" {
+		return nil, fmt.Errorf("the source IP and SNI of the pair must be set")
+	}
+
+	connThresh, _ := d.conf.R.BeaconSNI.ThresholdRules.Thresholds(
+		datum.FQDN, d.connThresh, d.connLimit,
+	)
+
+	return d.buildPipeline(datum, connThresh), nil
+}
+
+//checkDuplicates counts the SNIconn documents selected for the pair when BeaconSNI.DuplicateDocuments
+//is error or merge. The pipeline's $limit stage assumes the pair key selects a single document,
+//so a pair with more than one points to a data integrity problem. It is logged, and in error mode
+//an error is returned so the pair is skipped rather than analyzed on part of its connections.
+func (d *dissector) checkDuplicates(ssn *mgo.Session, datum data.UniqueSrcFQDNPair) error {
+	handling := d.conf.S.BeaconSNI.DuplicateDocuments
+	if handling != config.DuplicatesError && handling != config.DuplicatesMerge {
+		return nil
+	}
+
+	d.queryLimiter.Acquire()
+	count, err := ssn.DB(d.db.GetSelectedDB()).C(d.conf.T.Structure.SNIConnTable).Find(d.matchNoStrobeKey(datum)).Count()
+	d.queryLimiter.Release()
+	if err != nil || count < 2 {
+		return err
+	}
+	atomic.AddInt64(&d.summary.Duplicates, 1)
+
+	entry := d.log.WithFields(log.Fields{
+		"Module":    "beaconSNI",
+		"Data":      datum,
+		"Documents": count,
+	})
+	if handling == config.DuplicatesMerge {
+		entry.Warn("merging duplicate SNIconn documents")
+		return nil
+	}
+	entry.Error("found duplicate SNIconn documents, skipping pair")
+	return fmt.Errorf("found %d SNIconn documents for the pair", count)
+}
+
+//mergeDuplicates replaces the $limit stage of the given SNIconn pipeline with stages joining
+//every selected document into one. The dat chunks of the documents are concatenated in the
+//order the documents were found, while the _id and any other fields are taken from the first
+//document. A pair with a single document passes through unchanged.
+func mergeDuplicates(pipeline []bson.M) []bson.M {
+	merged := make([]bson.M, 0, len(pipeline)+1)
+	for _, stage := range pipeline {
+		if _, ok := stage["$limit"]; !ok {
+			merged = append(merged, stage)
+			continue
+		}
+		merged = append(merged,
+			bson.M{"$group": bson.M{
+				"_id":   nil,
+				"first": bson.M{"$first": "$$ROOT"},
+				"dat":   bson.M{"$push": bson.M{"$ifNull": []interface{}{"$dat", []interface{}{}}}},
+			}},
+			bson.M{"$replaceRoot": bson.M{"newRoot": bson.M{
+				"$mergeObjects": []interface{}{"$first", bson.M{"dat": flattenArrays("$dat")}},
+			}}},
+		)
+	}
+	return merged
+}
+
+//connectionCounts returns the number of connections a pair made in the current SNIconn
+//document, regardless of the connection threshold, along with the number made within the
+//analysis window. Without a window, every connection is within it. Strobes are counted as 0,
+//since their connections aren't kept.
+func (d *dissector) connectionCounts(ssn *mgo.Session, datum data.UniqueSrcFQDNPair) (int64, int64) {
+	var res struct {
+		Count    int64 `bson:"count"`
+		InWindow int64 `bson:"in_window"`
+	}
+
+	start, end := d.conf.S.Filtering.AnalysisStart, d.conf.S.Filtering.AnalysisEnd
+	var pipeline []bson.M
+	if d.conf.S.BeaconSNI.NormalizeTimestamps && (start > 0 || end > 0) {
+		// the window is applied to the normalized timestamps, as it is when gathering them
+		millis := d.conf.S.BeaconSNI.TimestampResolution == config.MillisecondResolution
+		unitStart, unitEnd := windowBounds(start, end, millis)
+		pipeline = connectionCountPipeline(d.matchNoStrobeKey(datum), d.conf.T.BeaconSNI.CountFields, 0, 0)
+		pipeline[2]["$project"].(bson.M)["in_window"] = bson.M{"$size": flattenArrays(windowTimestamps(
+			normalizedTimestamps(d.conf.T.BeaconSNI.TimestampFields, d.conf.S.BeaconSNI.TimestampFieldUnits, millis),
+			unitStart, unitEnd,
+		))}
+	} else {
+		pipeline = connectionCountPipeline(d.matchNoStrobeKey(datum), d.conf.T.BeaconSNI.CountFields, start, end)
+	}
+	d.queryLimiter.Acquire()
+	err := ssn.DB(d.db.GetSelectedDB()).C(d.conf.T.Structure.SNIConnTable).Pipe(pipeline).One(&res)
+	d.queryLimiter.Release()
+
+	if err != nil && err != mgo.ErrNotFound {
+		d.log.WithFields(log.Fields{
+			"Module": "beaconSNI",
+			"Data":   datum,
+			"Error":  err.Error(),
+		}).Debug("could not count SNI connections")
+	}
+	return res.Count, res.InWindow
+}
+
+//connectionCountPipeline sums the connections of the SNIconn documents selected by
+//matchNoStrobeKey into count, and the connections made within the analysis window from start
+//to end into in_window. The total is taken before the window is applied by addTimeWindow,
+//which recomputes the count of each entry from the timestamps it keeps.
+func connectionCountPipeline(matchNoStrobeKey bson.M, countFields []string, start int64, end int64) []bson.M {
+	pipeline := []bson.M{
+		{"$match": matchNoStrobeKey},
+		{"$addFields": bson.M{"count": bson.M{"$sum": concatFields(countFields)}}},
+		{"$project": bson.M{"count": 1, "in_window": "$count"}},
+		{"$group": bson.M{
+			"_id":       nil,
+			"count":     bson.M{"$sum": "$count"},
+			"in_window": bson.M{"$sum": "$in_window"},
+		}},
+	}
+
+	if start > 0 || end > 0 {
+		pipeline[2]["$project"].(bson.M)["in_window"] = bson.M{"$sum": concatProtocols("count")}
+		pipeline = addTimeWindow(pipeline, start, end)
+	}
+	return pipeline
+}
+
+//unmatchedReason returns the reason recorded for a pair the SNIconn pipeline didn't return,
+//given its connection count and the number of its connections within the analysis window. A
+//pair which met the connection threshold without a single connection in the window is
+//recorded as OutsideWindow rather than BelowThreshold.
+func unmatchedReason(count int64, inWindow int64, connThresh int) ExaminedReason {
+	if count > int64(connThresh) && inWindow == 0 {
+		return OutsideWindow
+	}
+	return BelowThreshold
+}
+
+//sourceCardinality returns the number of distinct sources which contacted the given SNI, or 0
+//if it could not be counted. SNIconn holds one document per source and SNI, so this is the
+//number of SNIconn documents for the SNI, which the fqdn index answers without a scan. Popular
+//SNIs are shared by many pairs, so each count is cached for the rest of the run.
+func (d *dissector) sourceCardinality(ssn *mgo.Session, fqdn string) int {
+	d.sourceCountsMu.Lock()
+	count, ok := d.sourceCounts[fqdn]
+	d.sourceCountsMu.Unlock()
+	if ok {
+		return count
+	}
+
+	d.queryLimiter.Acquire()
+	count, err := ssn.DB(d.db.GetSelectedDB()).C(d.conf.T.Structure.SNIConnTable).Find(bson.M{"fqdn": fqdn}).Count()
+	d.queryLimiter.Release()
+	if err != nil {
+		d.log.WithFields(log.Fields{
+			"Module": "beaconSNI",
+			"FQDN":   fqdn,
+			"Error":  err.Error(),
+		}).Debug("could not count the sources which contacted SNI")
+		return 0
+	}
+
+	d.sourceCountsMu.Lock()
+	d.sourceCounts[fqdn] = count
+	d.sourceCountsMu.Unlock()
+	return count
+}
+
+//dissected sends the gathered results on to dissectedCallback. A panic in the callback is
+//logged and counted as an error rather than killing the dissector thread.
+func (d *dissector) dissected(res DissectorResults) {
+	// the pair isn't checkpointed until the analyzer is done with its results
+	if d.checkpoint != nil {
+		d.checkpoint.hold(res.Hosts)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if d.checkpoint != nil {
+				d.checkpoint.release(res.Hosts)
+			}
+			atomic.AddInt64(&d.summary.Errors, 1)
+			d.log.WithFields(log.Fields{
+				"Module": "beaconSNI",
+				"Data":   res.Hosts,
+				"Panic":  r,
+			}).Error("SNI beacon results callback panicked")
 		}
-		d.dissectWg.Done()
 	}()
+	d.dissectedCallback(res)
+}
+
+//matchNoStrobeKey builds the filter selecting the SNIconn document of the given pair
+//as long as it hasn't been flagged as a strobe. If BeaconSNI.SkipStrobeFilter is set,
+//the strobe clauses are left out and the pair is selected regardless.
+func (d *dissector) matchNoStrobeKey(datum data.UniqueSrcFQDNPair) bson.M {
+	// copy the key so the strobe clauses never leak into a map held by the key builder
+	matchNoStrobeKey := bson.M{}
+	for field, value := range d.keyBuilder(datum) {
+		matchNoStrobeKey[field] = value
+	}
+
+	// the caller has promised to only collect pairs which aren't strobes
+	if d.conf.S.BeaconSNI.SkipStrobeFilter {
+		return matchNoStrobeKey
+	}
+
+	// we are able to filter out already flagged strobes here
+	// because we use the sniconns table to access them. The sniconns table has
+	// already had its counts and stats updated.
+	matchNoStrobeKey["dat.tls.strobe"] = bson.M{"$ne": true}
+	matchNoStrobeKey["dat.http.strobe"] = bson.M{"$ne": true}
+	matchNoStrobeKey["dat.merged.strobe"] = bson.M{"$ne": true}
+
+	return matchNoStrobeKey
+}
+
+//sniconnPipeline gathers the timestamps, byte counts, and responding IPs of the SNI connections
+//selected by matchNoStrobeKey if the pair made more than connThresh connections. fields holds
+//the paths the details are read from. tsValue is the expression used to read each timestamp.
+//If withDurations is set, the connection durations are gathered as well.
+func sniconnPipeline(matchNoStrobeKey bson.M, fields config.SNIConnFieldsCfg, connThresh int, tsValue interface{}, withDurations bool) []bson.M {
+	pipeline := []bson.M{
+		{"$match": matchNoStrobeKey},
+		{"$limit": 1},
+		// tbytes is summed here rather than unwound and regrouped later since
+		// $sum over an array adds up its numeric elements in a single stage. Likewise,
+		// the per chunk responder lists are flattened here rather than unwound twice.
+		{"$project": bson.M{
+			"ts":             concatFields(fields.TimestampFields),
+			"bytes":          concatFields(fields.BytesFields),
+			"count":          concatFields(fields.CountFields),
+			"tbytes":         bson.M{"$sum": concatFields(fields.TotalBytesFields)},
+			"responding_ips": flattenArrays(concatFields(fields.DstIPsFields)),
+		}},
+		{"$unwind": "$count"},
+		{"$group": bson.M{
+			"_id":            "$_id",
+			"ts":             bson.M{"$first": "$ts"},
+			"bytes":          bson.M{"$first": "$bytes"},
+			"count":          bson.M{"$sum": "$count"},
+			"tbytes":         bson.M{"$first": "$tbytes"},
+			"responding_ips": bson.M{"$first": "$responding_ips"},
+		}},
+		{"$match": bson.M{"count": bson.M{"$gt": connThresh}}},
+		{"$unwind": "$ts"},
+		{"$unwind": "$ts"},
+		{"$group": bson.M{
+			"_id":            "$_id",
+			"ts":             bson.M{"$addToSet": tsValue},
+			"ts_full":        bson.M{"$push": tsValue},
+			"bytes":          bson.M{"$first": "$bytes"},
+			"count":          bson.M{"$first": "$count"},
+			"tbytes":         bson.M{"$first": "$tbytes"},
+			"responding_ips": bson.M{"$first": "$responding_ips"},
+		}},
+		{"$unwind": "$bytes"},
+		{"$unwind": "$bytes"},
+		{"$group": bson.M{
+			"_id":            "$_id",
+			"ts":             bson.M{"$first": "$ts"},
+			"ts_full":        bson.M{"$first": "$ts_full"},
+			"bytes":          bson.M{"$push": "$bytes"},
+			"count":          bson.M{"$first": "$count"},
+			"tbytes":         bson.M{"$first": "$tbytes"},
+			"responding_ips": bson.M{"$first": "$responding_ips"},
+		}},
+		{"$unwind": "$responding_ips"},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"sniconn_id":       "$_id",
+				"dst_ip":           "$responding_ips.ip",
+				"dst_network_uuid": "$responding_ips.network_uuid",
+			},
+			"ts":               bson.M{"$first": "$ts"},
+			"ts_full":          bson.M{"$first": "$ts_full"},
+			"bytes":            bson.M{"$first": "$bytes"},
+			"count":            bson.M{"$first": "$count"},
+			"tbytes":           bson.M{"$first": "$tbytes"},
+			"dst_network_name": bson.M{"$last": "$responding_ips.network_name"},
+		}},
+		{"$group": bson.M{
+			"_id":     "$_id.sniconn_id",
+			"ts":      bson.M{"$first": "$ts"},
+			"ts_full": bson.M{"$first": "$ts_full"},
+			"bytes":   bson.M{"$first": "$bytes"},
+			"count":   bson.M{"$first": "$count"},
+			"tbytes":  bson.M{"$first": "$tbytes"},
+			"responding_ips": bson.M{"$push": bson.M{
+				"ip":           "$_id.dst_ip",
+				"network_uuid": "$_id.dst_network_uuid",
+				"network_name": "$dst_network_name",
+			}},
+		}},
+		{"$project": bson.M{
+			"_id":            "$_id",
+			"ts":             1,
+			"ts_full":        1,
+			"bytes":          1,
+			"count":          1,
+			"tbytes":         1,
+			"responding_ips": 1,
+		}},
+	}
+
+	if withDurations {
+		addDurations(pipeline)
+	}
+	return pipeline
+}
+
+//addDurations carries the connection durations through the given SNIconn pipeline. The
+//durations are flattened into a single list while projecting, so the unwinds of the other
+//fields only need to carry the list along. Missing durations default to an empty list.
+func addDurations(pipeline []bson.M) {
+	projected := false
+	for _, stage := range pipeline {
+		if project, ok := stage["$project"].(bson.M); ok {
+			if !projected {
+				// the first projection joins the per chunk duration lists of both protocols
+				project["durations"] = flattenArrays(concatProtocols("durations"))
+				projected = true
+			} else {
+				project["durations"] = 1
+			}
+		}
+		if group, ok := stage["$group"].(bson.M); ok {
+			group["durations"] = bson.M{"$first": "$durations"}
+		}
+	}
+}
+
+//addChunkCounts carries the connection count of each http and tls entry, along with the
+//chunk it belongs to, through the given SNIconn pipeline. Like the analysis window, the
+//counts are read from the default SNIconn schema.
+func addChunkCounts(pipeline []bson.M) {
+	countEntry := func(entry string) bson.M {
+		return bson.M{"$map": bson.M{
+			"input": bson.M{"$filter": bson.M{
+				"input": bson.M{"$ifNull": []interface{}{"$dat", []interface{}{}}},
+				"as":    "chunk",
+				"cond":  bson.M{"$ne": []interface{}{bson.M{"$type": "$$chunk." + entry + ".count"}, "missing"}},
+			}},
+			"as": "chunk",
+			"in": bson.M{"cid": "$$chunk.cid", "count": "$$chunk." + entry + ".count"},
+		}}
+	}
+
+	projected := false
+	for _, stage := range pipeline {
+		if project, ok := stage["$project"].(bson.M); ok {
+			if !projected {
+				project["chunk_counts"] = bson.M{"$concatArrays": []interface{}{countEntry("http"), countEntry("tls")}}
+				projected = true
+			} else {
+				project["chunk_counts"] = 1
+			}
+		}
+		if group, ok := stage["$group"].(bson.M); ok {
+			group["chunk_counts"] = bson.M{"$first": "$chunk_counts"}
+		}
+	}
+}
+
+//addTimeWindow limits the given SNIconn pipeline to the connections made between start and end,
+//inclusive. A value of 0 leaves that end of the window open. Right after the document is
+//selected, the timestamps of each per chunk entry are run through $filter to keep only those
+//within the window, and the entry's connection count is recomputed as the number of timestamps
+//left. Entries left without any timestamps are removed entirely. Data sizes and durations are
+//not recorded with a timestamp, so they are kept for every entry with a connection in the window.
+func addTimeWindow(pipeline []bson.M, start int64, end int64) []bson.M {
+	var bounds []interface{}
+	if start > 0 {
+		bounds = append(bounds, bson.M{"$gte": []interface{}{"$$ts", start}})
+	}
+	if end > 0 {
+		bounds = append(bounds, bson.M{"$lte": []interface{}{"$$ts", end}})
+	}
+	inWindow := bson.M{"$and": bounds}
+
+	// windowEntry rewrites the http or tls entry of a chunk, removing it if none of its connections remain
+	windowEntry := func(entry string) bson.M {
+		return bson.M{"$let": bson.M{
+			"vars": bson.M{
+				"ts": bson.M{"$filter": bson.M{
+					"input": bson.M{"$ifNull": []interface{}{entry + ".ts", []interface{}{}}},
+					"as":    "ts",
+					"cond":  inWindow,
+				}},
+			},
+			"in": bson.M{"$cond": []interface{}{
+				bson.M{"$gt": []interface{}{bson.M{"$size": "$$ts"}, 0}},
+				bson.M{
+					"ts":        "$$ts",
+					"count":     bson.M{"$size": "$$ts"},
+					"bytes":     entry + ".bytes",
+					"tbytes":    entry + ".tbytes",
+					"durations": entry + ".durations",
+					"dst_ips":   entry + ".dst_ips",
+				},
+				"$$REMOVE",
+			}},
+		}}
+	}
+
+	window := bson.M{"$addFields": bson.M{
+		"dat": bson.M{"$map": bson.M{
+			"input": "$dat",
+			"as":    "chunk",
+			"in": bson.M{
+				"cid":    "$$chunk.cid",
+				"http":   windowEntry("$$chunk.http"),
+				"tls":    windowEntry("$$chunk.tls"),
+				"merged": "$$chunk.merged",
+			},
+		}},
+	}}
+
+	// the window goes in right after the $match and $limit stages selecting the document
+	windowed := make([]bson.M, 0, len(pipeline)+1)
+	windowed = append(windowed, pipeline[:2]...)
+	windowed = append(windowed, window)
+	return append(windowed, pipeline[2:]...)
+}
+
+//concatProtocols joins the given field from the http and tls entries of an SNIconn document.
+//$concatArrays returns null if any of its inputs are missing, so each protocol defaults to an
+//empty array to keep an SNI seen over only one protocol from losing its data.
+func concatProtocols(field string) bson.M {
+	return concatFields([]string{"dat.http." + field, "dat.tls." + field})
+}
+
+//concatFields joins the fields at the given paths of an SNIconn document. Like concatProtocols,
+//each missing field defaults to an empty array.
+func concatFields(paths []string) bson.M {
+	arrays := make([]bson.M, 0, len(paths))
+	for _, path := range paths {
+		arrays = append(arrays, bson.M{"$ifNull": []interface{}{"$" + path, []interface{}{}}})
+	}
+	return bson.M{"$concatArrays": arrays}
+}
+
+//flattenArrays joins the arrays held by the given array of arrays into a single array in
+//one expression. An SNIconn field read across the dat subdocuments holds one array per chunk,
+//and flattening it matches unwinding it twice: every element is kept, in order, including
+//duplicates, and chunks with an empty array add nothing.
+func flattenArrays(arrays interface{}) bson.M {
+	return bson.M{"$reduce": bson.M{
+		"input":        arrays,
+		"initialValue": []interface{}{},
+		"in":           bson.M{"$concatArrays": []interface{}{"$$value", "$$this"}},
+	}}
+}
+
+//String formats the summary as a single report line
+func (s dissectorSummary) String() string {
+	return fmt.Sprintf("beaconsni: %d examined, %d beacons, %d strobes, %d errors, %d dropped, %d filtered, %d restarts",
+		s.Examined, s.Beacons, s.Strobes, s.Errors, s.Dropped, s.Filtered, s.Restarts)
+}
+
+//nameResponders replaces the network name of every responding IP which falls within
+//a named subnet in place. Responders outside of every named subnet are left as they are.
+func nameResponders(responders []data.UniqueIP, names config.NetworkNames) {
+	if len(names) == 0 {
+		return
+	}
+	for i := range responders {
+		if name, ok := names.Lookup(responders[i].IP); ok {
+			responders[i].NetworkName = name
+		}
+	}
 }
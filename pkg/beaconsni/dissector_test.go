@@ -0,0 +1,348 @@
+package beaconsni
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/database"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/globalsign/mgo/bson"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsFirstContact(t *testing.T) {
+	d := &dissector{}
+	assert.False(t, d.isFirstContact("new.example.com"), "first contact should be disabled by default")
+
+	d.enableFirstContact(
+		map[string]struct{}{"known.example.com": {}},
+		func(data.UniqueSrcFQDNPair) {},
+	)
+	assert.False(t, d.isFirstContact("known.example.com"), "previously seen SNIs are not first contacts")
+	assert.True(t, d.isFirstContact("new.example.com"), "unseen SNIs are first contacts")
+}
+
+func TestDissectorSummaryString(t *testing.T) {
+	summary := dissectorSummary{Examined: 12000, Beacons: 47, Strobes: 3, Errors: 1, Dropped: 9, Filtered: 2}
+	assert.Equal(t, "beaconsni: 12000 examined, 47 beacons, 3 strobes, 1 errors, 9 dropped, 2 filtered, 0 restarts", summary.String())
+}
+
+func TestMatchNoStrobeKey(t *testing.T) {
+	pair := data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "10.0.0.1"}, FQDN: "a.example.com"}
+	notStrobe := bson.M{"$ne": true}
+
+	conf := &config.Config{}
+	d := newDissector(0, nil, nil, conf, nil, nil, nil)
+	key := d.matchNoStrobeKey(pair)
+	assert.Equal(t, "10.0.0.1", key["src"], "the default key should come from BSONKey")
+	assert.Equal(t, "a.example.com", key["fqdn"])
+	assert.Equal(t, notStrobe, key["dat.tls.strobe"])
+
+	sensorKey := bson.M{"src": pair.SrcIP, "fqdn": pair.FQDN, "sensor": "sensor-1"}
+	d = newDissector(0, func(data.UniqueSrcFQDNPair) bson.M { return sensorKey }, nil, conf, nil, nil, nil)
+	key = d.matchNoStrobeKey(pair)
+	assert.Equal(t, "sensor-1", key["sensor"], "custom fields should be kept")
+	assert.Equal(t, notStrobe, key["dat.tls.strobe"], "strobe filters should be merged onto custom keys")
+	assert.Equal(t, notStrobe, key["dat.http.strobe"])
+	assert.Equal(t, notStrobe, key["dat.merged.strobe"])
+	assert.Len(t, sensorKey, 3, "the key builder's map should not be modified")
+
+	conf.S.BeaconSNI.SkipStrobeFilter = true
+	key = d.matchNoStrobeKey(pair)
+	assert.Equal(t, sensorKey, key, "the strobe filters should be left out when skipped")
+}
+
+func TestLikelyCDN(t *testing.T) {
+	conf := &config.Config{}
+	conf.S.BeaconSNI.MaxResponders = 100
+	d := newDissector(0, nil, nil, conf, nil, nil, nil)
+
+	assert.False(t, d.likelyCDN(99))
+	assert.False(t, d.likelyCDN(100), "reaching the cap should not filter the pair")
+	assert.True(t, d.likelyCDN(101), "exceeding the cap should filter the pair")
+
+	conf.S.BeaconSNI.MaxResponders = 0
+	assert.False(t, d.likelyCDN(100000), "a cap of 0 should disable the filter")
+}
+
+func TestInternalResponders(t *testing.T) {
+	conf := &config.Config{}
+	conf.S.Filtering.InternalSubnets = []string{"10.0.0.0/8", "192.168.0.0/16"}
+	d := newDissector(0, nil, nil, conf, nil, nil, nil)
+
+	internal := []data.UniqueIP{{IP: "10.1.1.1"}, {IP: "192.168.5.5"}}
+	mixed := []data.UniqueIP{{IP: "10.1.1.1"}, {IP: "8.8.8.8"}}
+
+	assert.False(t, d.internalResponders(internal), "the filter should be disabled by default")
+
+	conf.S.BeaconSNI.ExternalRespondersOnly = true
+	assert.True(t, d.internalResponders(internal))
+	assert.False(t, d.internalResponders(mixed), "a single external responder should keep the pair")
+	assert.False(t, d.internalResponders(nil), "pairs without responders should be kept")
+	assert.False(t, d.internalResponders([]data.UniqueIP{{IP: "not an ip"}}), "unparseable responders should be kept")
+}
+
+func TestWithoutSpecialUse(t *testing.T) {
+	responders := []data.UniqueIP{{IP: "127.0.0.1"}, {IP: "8.8.8.8"}, {IP: "169.254.10.1"}, {IP: "10.1.1.1"}, {IP: "not an ip"}}
+
+	kept, removed := withoutSpecialUse(responders)
+	assert.Equal(t, []data.UniqueIP{{IP: "8.8.8.8"}, {IP: "10.1.1.1"}, {IP: "not an ip"}}, kept,
+		"private and unparseable responders should be kept in order")
+	assert.Equal(t, 2, removed)
+	assert.Equal(t, "127.0.0.1", responders[0].IP, "the given responders should be left unchanged")
+
+	kept, removed = withoutSpecialUse([]data.UniqueIP{{IP: "::1"}, {IP: "fe80::1"}})
+	assert.Len(t, kept, 0, "a pair with only special use responders should have none left")
+	assert.Equal(t, 2, removed)
+
+	kept, removed = withoutSpecialUse(nil)
+	assert.Len(t, kept, 0)
+	assert.Equal(t, 0, removed)
+}
+
+func TestDissectedRecoversFromPanic(t *testing.T) {
+	logger := log.New()
+	logger.Out = ioutil.Discard
+
+	var received []DissectorResults
+	d := newDissector(0, nil, nil, &config.Config{}, logger,
+		func(res DissectorResults) {
+			if res.ConnectionCount < 0 {
+				panic("bad results")
+			}
+			received = append(received, res)
+		},
+		func(dissectorSummary) error { return nil },
+	)
+
+	assert.NotPanics(t, func() { d.dissected(DissectorResults{ConnectionCount: -1}) })
+	assert.Equal(t, int64(1), d.summary.Errors, "the panic should be counted as an error")
+
+	d.dissected(DissectorResults{ConnectionCount: 5})
+	assert.Len(t, received, 1, "results should keep flowing after a panic")
+	assert.Equal(t, int64(1), d.summary.Errors)
+}
+
+func TestDissectBeaconOutsideWindow(t *testing.T) {
+	pair := data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "10.0.0.1"}, FQDN: "c2.example.com"}
+	var dissected []DissectorResults
+	d := newDissector(0, nil, nil, &config.Config{}, log.New(),
+		func(res DissectorResults) { dissected = append(dissected, res) }, nil,
+	)
+	var reasons []ExaminedReason
+	d.enableExaminedCallback(func(_ data.UniqueSrcFQDNPair, reason ExaminedReason, _ int64) {
+		reasons = append(reasons, reason)
+	})
+
+	// every connection falls before the window once the sensor's clock is corrected
+	ts, tsFull, ok := correctedTimestamps([]natConn{
+		{Ts: 100, Sensor: "sensor-east"},
+		{Ts: 160, Sensor: "sensor-east"},
+		{Ts: 220, Sensor: "sensor-east"},
+		{Ts: 280, Sensor: "sensor-east"},
+		{Ts: 340, Sensor: "sensor-east"},
+	}, config.SensorOffsets{"sensor-east": 2 * time.Second}, 1000, 2000, false)
+	assert.True(t, ok)
+	assert.Len(t, tsFull, 0)
+
+	assert.NotPanics(t, func() {
+		d.dissectBeacon(nil, DissectorResults{Hosts: pair, ConnectionCount: 5, TsList: ts, TsListFull: tsFull})
+	})
+	assert.Equal(t, []ExaminedReason{OutsideWindow}, reasons)
+	assert.Len(t, dissected, 0)
+	assert.Equal(t, int64(1), d.summary.Dropped)
+}
+
+func TestUnmatchedReason(t *testing.T) {
+	assert.Equal(t, BelowThreshold, unmatchedReason(15, 15, 20))
+	assert.Equal(t, BelowThreshold, unmatchedReason(30, 10, 20), "too few connections within the window")
+	assert.Equal(t, OutsideWindow, unmatchedReason(30, 0, 20))
+	assert.Equal(t, BelowThreshold, unmatchedReason(0, 0, 20), "strobes are counted as 0")
+
+	pipeline := connectionCountPipeline(bson.M{}, []string{"dat.tls.count"}, 0, 0)
+	assert.Equal(t, bson.M{"count": 1, "in_window": "$count"}, pipeline[2]["$project"], "every connection is within a missing window")
+
+	pipeline = connectionCountPipeline(bson.M{}, []string{"dat.tls.count"}, 1000, 2000)
+	require.Len(t, pipeline, 5)
+	assert.Contains(t, pipeline[1], "$addFields", "the total should be taken before the window")
+	assert.Contains(t, pipeline[2]["$addFields"], "dat", "the window should follow the total")
+	assert.Equal(t, bson.M{"$sum": concatProtocols("count")}, pipeline[3]["$project"].(bson.M)["in_window"])
+}
+
+func TestSourceCardinalityCache(t *testing.T) {
+	d := newDissector(0, nil, nil, &config.Config{}, log.New(), nil, nil)
+	d.sourceCounts["cached.example.com"] = 3
+
+	// cached counts are answered without touching MongoDB
+	assert.Equal(t, 3, d.sourceCardinality(nil, "cached.example.com"))
+}
+
+func TestExplainPipeline(t *testing.T) {
+	pair := data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "10.0.0.1"}, FQDN: "a.example.com"}
+	conf := &config.Config{}
+	conf.S.BeaconSNI.DefaultConnectionThresh = 20
+	d := newDissector(0, nil, nil, conf, nil, nil, nil)
+
+	pipeline, err := d.explainPipeline(pair)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"$match": d.matchNoStrobeKey(pair)}, pipeline[0], "the pipeline should start by selecting the pair")
+	assert.Contains(t, pipeline, bson.M{"$match": bson.M{"count": bson.M{"$gt": 20}}}, "the connection threshold should be applied")
+
+	conf.S.Filtering.AnalysisStart = 100
+	pipeline, err = d.explainPipeline(pair)
+	assert.Nil(t, err)
+	assert.Contains(t, pipeline[2], "$addFields", "the analysis window stage should be included")
+
+	_, err = d.explainPipeline(data.UniqueSrcFQDNPair{FQDN: "a.example.com"})
+	assert.NotNil(t, err, "pairs without a source should be rejected")
+}
+
+func TestRateThreshold(t *testing.T) {
+	day := int64(24 * 60 * 60)
+	assert.Equal(t, 24, rateThreshold(1, 0, day))
+	assert.Equal(t, 168, rateThreshold(1, 0, 7*day), "the threshold should grow with the dataset")
+	assert.Equal(t, 12, rateThreshold(0.5, day, 2*day))
+	assert.Equal(t, 2, rateThreshold(1, 0, 9000), "more than 2.5 connections is the same as more than 2")
+	assert.Equal(t, 0, rateThreshold(1, day, day), "a dataset without a duration should not need any connections")
+	assert.Equal(t, 0, rateThreshold(0, 0, day))
+}
+
+func TestEnableConnectionRate(t *testing.T) {
+	pair := data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "10.0.0.1"}, FQDN: "a.example.com"}
+	conf := &config.Config{}
+	conf.S.BeaconSNI.DefaultConnectionThresh = 20
+	d := newDissector(0, nil, nil, conf, nil, nil, nil)
+
+	assert.Equal(t, 48, d.enableConnectionRate(2, 0, 24*60*60))
+	pipeline, err := d.explainPipeline(pair)
+	assert.Nil(t, err)
+	assert.Contains(t, pipeline, bson.M{"$match": bson.M{"count": bson.M{"$gt": 48}}}, "the rate should replace the default threshold")
+}
+
+func TestMergeDuplicatesPipeline(t *testing.T) {
+	pair := data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "10.0.0.1"}, FQDN: "a.example.com"}
+	conf := &config.Config{}
+	conf.S.Filtering.AnalysisStart = 100
+	d := newDissector(0, nil, nil, conf, nil, nil, nil)
+
+	pipeline, _ := d.explainPipeline(pair)
+	assert.Equal(t, bson.M{"$limit": 1}, pipeline[1], "only the first document should be read by default")
+
+	conf.S.BeaconSNI.DuplicateDocuments = config.DuplicatesMerge
+	merged, _ := d.explainPipeline(pair)
+	assert.Len(t, merged, len(pipeline)+1)
+	assert.NotContains(t, merged, bson.M{"$limit": 1}, "every document should be read when merging")
+	assert.Contains(t, merged[1], "$group")
+	assert.Contains(t, merged[2], "$replaceRoot")
+	assert.Contains(t, merged[3], "$addFields", "the analysis window should apply to the merged document")
+}
+
+func TestSNIconnPipelineUnwindsRespondersOnce(t *testing.T) {
+	pipeline := sniconnPipeline(bson.M{}, config.SNIConnFieldsCfg{}, 20, "$ts", false)
+
+	unwinds := 0
+	for _, stage := range pipeline {
+		if stage["$unwind"] == "$responding_ips" {
+			unwinds++
+		}
+	}
+	assert.Equal(t, 1, unwinds, "the responders should be flattened before a single unwind")
+}
+
+func TestSNIconnPipelineFields(t *testing.T) {
+	fields := config.SNIConnFieldsCfg{
+		TimestampFields:  []string{"conns.time"},
+		BytesFields:      []string{"conns.orig_bytes"},
+		CountFields:      []string{"conns.n", "legacy.n"},
+		TotalBytesFields: []string{"conns.total"},
+		DstIPsFields:     []string{"conns.responders"},
+	}
+
+	project := sniconnPipeline(bson.M{}, fields, 20, "$ts", false)[2]["$project"].(bson.M)
+	assert.Equal(t, concatFields([]string{"conns.time"}), project["ts"], "the timestamp path should be substituted")
+	assert.Equal(t, bson.M{"$concatArrays": []bson.M{
+		{"$ifNull": []interface{}{"$conns.n", []interface{}{}}},
+		{"$ifNull": []interface{}{"$legacy.n", []interface{}{}}},
+	}}, project["count"], "every count path should be joined")
+	assert.Equal(t, bson.M{"$sum": concatFields([]string{"conns.total"})}, project["tbytes"])
+	assert.Equal(t, flattenArrays(concatFields([]string{"conns.responders"})), project["responding_ips"])
+
+	assert.Equal(t, concatFields([]string{"dat.http.ts", "dat.tls.ts"}), concatProtocols("ts"), "the default paths should be unchanged")
+}
+
+func TestSupervisedRestarts(t *testing.T) {
+	logger := log.New()
+	logger.Out = ioutil.Discard
+
+	conf := &config.Config{}
+	conf.S.BeaconSNI.MaxWorkerRestarts = 2
+
+	var summary dissectorSummary
+	// a DB without a session makes every dissector thread panic as soon as it starts
+	d := newDissector(0, nil, &database.DB{}, conf, logger, nil,
+		func(s dissectorSummary) error {
+			summary = s
+			return nil
+		},
+	)
+	d.start()
+
+	// the last thread to die drains the channel, so collect() must not block
+	d.collect(data.UniqueSrcFQDNPair{FQDN: "a.example.com"})
+	assert.Nil(t, d.close())
+
+	assert.Equal(t, int64(2), summary.Restarts, "threads should only be replaced up to the limit")
+	assert.Equal(t, int64(4), summary.Errors, "each panic and each drained pair should be counted as an error")
+	assert.Equal(t, int64(0), d.liveWorkers)
+}
+
+func TestIsBurst(t *testing.T) {
+	conf := &config.Config{}
+	d := newDissector(0, nil, nil, conf, nil, nil, nil)
+
+	burst := []chunkCount{{CID: 0, Count: 10}, {CID: 1, Count: 900}, {CID: 1, Count: 50}, {CID: 2, Count: 40}}
+	assert.False(t, d.isBurst(data.UniqueSrcFQDNPair{}, burst), "a BurstConcentration of 0 should disable burst detection")
+
+	conf.S.BeaconSNI.BurstConcentration = 0.9
+	assert.True(t, d.isBurst(data.UniqueSrcFQDNPair{}, burst), "the entries of a chunk should be added together")
+
+	steady := []chunkCount{{CID: 0, Count: 300}, {CID: 1, Count: 350}, {CID: 2, Count: 350}}
+	assert.False(t, d.isBurst(data.UniqueSrcFQDNPair{}, steady))
+
+	single := []chunkCount{{CID: 3, Count: 500}, {CID: 3, Count: 500}}
+	assert.False(t, d.isBurst(data.UniqueSrcFQDNPair{}, single), "a pair seen in a single chunk should stay a strobe")
+
+	// the busiest chunk alone is over the strobe limit, which sniconn leaves to the dissector
+	conf.S.Strobe.ConnectionLimit = 86400
+	conf.S.BeaconSNI.BurstConcentration = 0.8
+	overLimit := []chunkCount{{CID: 0, Count: 2000}, {CID: 1, Count: 2000}, {CID: 2, Count: 90000}, {CID: 3, Count: 2000}, {CID: 4, Count: 2000}}
+	assert.True(t, d.isBurst(data.UniqueSrcFQDNPair{}, overLimit), "a chunk over the strobe limit should still be a burst")
+}
+
+func TestSmoothedCount(t *testing.T) {
+	chunkCounts := []chunkCount{
+		{CID: 1, Count: 500},
+		{CID: 2, Count: 40000}, {CID: 2, Count: 10000},
+		{CID: 3, Count: 110000},
+		{CID: 5, Count: 60000},
+	}
+
+	// chunks 3 through 5, with chunk 4 left out of the average
+	assert.Equal(t, int64(85000), smoothedCount(chunkCounts, 5, 3))
+	// the http and tls entries of chunk 2 are added together
+	assert.Equal(t, int64(73333), smoothedCount(chunkCounts, 5, 4))
+	assert.Equal(t, int64(0), smoothedCount(chunkCounts, 9, 2), "a window without any chunks has no connections")
+
+	conf := &config.Config{}
+	conf.S.Rolling.CurrentChunk = 5
+	d := newDissector(0, nil, nil, conf, nil, nil, nil)
+	assert.Equal(t, int64(220500), d.strobeCount(220500, chunkCounts), "the total should be used by default")
+
+	conf.S.BeaconSNI.CountSmoothingWindow = 3
+	assert.Equal(t, int64(85000), d.strobeCount(220500, chunkCounts))
+}
@@ -0,0 +1,31 @@
+package beaconsni
+
+import (
+	"time"
+
+	"github.com/activecm/rita/config"
+)
+
+//domainAge looks up the registration date of the pair's SNI and returns how many days
+//before the pair's first connection the domain was registered, along with its youth. The
+//youth falls linearly from 1 for a domain first contacted the day it was registered to 0
+//for one youngDays old or older. Domains registered after the first connection, which
+//happens when the registration date was renewed or misreported, are taken as brand new.
+//The returned bool is false if the domain's registration date isn't known.
+func domainAge(ages config.DomainAges, fqdn string, firstSeen time.Time, youngDays int) (float64, float64, bool) {
+	_, registered, ok := ages.Lookup(fqdn)
+	if !ok {
+		return 0, 0, false
+	}
+
+	days := firstSeen.Sub(registered).Hours() / 24
+	if days < 0 {
+		days = 0
+	}
+
+	youth := 0.0
+	if youngDays > 0 && days < float64(youngDays) {
+		youth = 1 - days/float64(youngDays)
+	}
+	return days, youth, true
+}
@@ -0,0 +1,32 @@
+package beaconsni
+
+import (
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDomainAge(t *testing.T) {
+	registered := time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+	ages := config.DomainAges{"evil.com": registered, "old.com": time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	days, youth, ok := domainAge(ages, "cdn.evil.com", registered.Add(6*24*time.Hour), 30)
+	assert.True(t, ok)
+	assert.InDelta(t, 6, days, 0.001)
+	assert.InDelta(t, 0.8, youth, 0.001)
+
+	days, youth, ok = domainAge(ages, "evil.com", registered.Add(-48*time.Hour), 30)
+	assert.True(t, ok)
+	assert.Equal(t, 0.0, days, "domains registered after the first connection should be brand new")
+	assert.Equal(t, 1.0, youth)
+
+	days, youth, ok = domainAge(ages, "old.com", registered, 30)
+	assert.True(t, ok)
+	assert.True(t, days > 2000)
+	assert.Equal(t, 0.0, youth, "old domains should not be young")
+
+	_, _, ok = domainAge(ages, "unknown.com", registered, 30)
+	assert.False(t, ok)
+}
@@ -0,0 +1,84 @@
+package beaconsni
+
+import (
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+//examinedActions builds the writes made for a pair which was examined but not analyzed as a
+//beacon. A pair may have been a beacon in a previous chunk before its traffic spread out
+//across a CDN, its timing became irregular, it was confined to too few days, its connections were clustered like
+//page loads, or it was found to only reach internal
+//or special use responders, so any beacon left over from earlier analysis is cleared out, along with its
+//stored features when BeaconSNI.PersistFeatures is set. When BeaconSNI.AuditExamined is set,
+//the pair is also recorded in the examined collection as evidence that it was analyzed.
+func examinedActions(conf *config.Config, pair data.UniqueSrcFQDNPair, reason ExaminedReason, connectionCount int64, chunk int, examinedAt time.Time) mgoBulkActions {
+	pairSelector := pair.BSONKey()
+	actions := mgoBulkActions{}
+
+	if reason == LikelyCDN || reason == IrregularTiming || reason == FewDistinctDays || reason == InternalResponders || reason == SpecialUseResponders || reason == FilteredASNs ||
+		reason == BrowsingBursts {
+		actions[conf.T.BeaconSNI.BeaconSNITable] = func(b *mgo.Bulk) int {
+			b.Remove(pairSelector)
+			return 1
+		}
+		// the stored features would bring the beacon back when rescoring
+		if conf.S.BeaconSNI.PersistFeatures {
+			actions[conf.T.BeaconSNI.FeaturesTable] = func(b *mgo.Bulk) int {
+				b.Remove(pairSelector)
+				return 1
+			}
+		}
+	}
+
+	if conf.S.BeaconSNI.AuditExamined {
+		actions[conf.T.BeaconSNI.ExaminedTable] = func(b *mgo.Bulk) int {
+			b.Upsert(
+				pairSelector,
+				bson.M{"$set": bson.M{
+					"src_network_name": pair.SrcNetworkName,
+					"reason":           reason,
+					"connection_count": connectionCount,
+					"cid":              chunk,
+					"examined_at":      examinedAt,
+				}},
+			)
+			return 1
+		}
+	}
+
+	return actions
+}
+
+//createExaminedCollection creates the examined collection if it doesn't exist yet. Records
+//expire BeaconSNI.ExaminedRetentionDays after the pair was last examined.
+func (r *repo) createExaminedCollection() error {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	collectionName := r.config.T.BeaconSNI.ExaminedTable
+
+	names, _ := session.DB(r.database.GetSelectedDB()).CollectionNames()
+	for _, name := range names {
+		if name == collectionName {
+			return nil
+		}
+	}
+
+	indexes := []mgo.Index{
+		{Key: []string{"src", "fqdn", "src_network_uuid"}, Unique: true},
+		{Key: []string{"reason"}},
+	}
+	if days := r.config.S.BeaconSNI.ExaminedRetentionDays; days > 0 {
+		indexes = append(indexes, mgo.Index{
+			Key:         []string{"examined_at"},
+			ExpireAfter: time.Duration(days) * 24 * time.Hour,
+		})
+	}
+
+	return r.database.CreateCollection(collectionName, indexes)
+}
@@ -0,0 +1,51 @@
+package beaconsni
+
+import (
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExaminedActions(t *testing.T) {
+	conf := &config.Config{}
+	conf.T.BeaconSNI.BeaconSNITable = "beaconSNI"
+	conf.T.BeaconSNI.ExaminedTable = "beaconSNIExamined"
+
+	pair := data.NewUniqueSrcFQDNPair(data.UniqueIP{IP: "10.0.0.1"}, "example.com")
+	now := time.Now()
+
+	// without auditing, only filtered pairs lose their old beacons
+	actions := examinedActions(conf, pair, LikelyCDN, 30, 1, now)
+	assert.Len(t, actions, 1)
+	_, ok := actions["beaconSNI"]
+	assert.True(t, ok)
+
+	actions = examinedActions(conf, pair, InternalResponders, 30, 1, now)
+	assert.Len(t, actions, 1)
+
+	actions = examinedActions(conf, pair, FewDistinctDays, 30, 1, now)
+	assert.Len(t, actions, 1)
+
+	actions = examinedActions(conf, pair, SpecialUseResponders, 30, 1, now)
+	assert.Len(t, actions, 1)
+
+	actions = examinedActions(conf, pair, BrowsingBursts, 30, 1, now)
+	assert.Len(t, actions, 1)
+
+	actions = examinedActions(conf, pair, BelowThreshold, 2, 1, now)
+	assert.Len(t, actions, 0)
+
+	// with auditing, every examined pair is recorded
+	conf.S.BeaconSNI.AuditExamined = true
+
+	actions = examinedActions(conf, pair, IrregularTiming, 30, 1, now)
+	assert.Len(t, actions, 2)
+
+	actions = examinedActions(conf, pair, TooFewTimestamps, 25, 1, now)
+	assert.Len(t, actions, 1)
+	_, ok = actions["beaconSNIExamined"]
+	assert.True(t, ok)
+}
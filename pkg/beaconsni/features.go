@@ -0,0 +1,76 @@
+package beaconsni
+
+import "sort"
+
+//ScoreFeature is a single entry of a beacon's feature vector. Value is the measurement the
+//feature is derived from and Score is what the scoring model made of it. Either is left out
+//when it isn't known, such as the score of a feature the model doesn't use.
+type ScoreFeature struct {
+	Value *float64 `bson:"value,omitempty"`
+	Score *float64 `bson:"score,omitempty"`
+}
+
+//scoreFeatures builds the feature vector stored in score_features when BeaconSNI.ScoreFeatures
+//is enabled. The measurements behind the default model's features are paired with the scores
+//in breakdown, and any other feature the model reported is kept with its score alone.
+func scoreFeatures(res DissectorResults, stats beaconStats, breakdown map[string]float64) map[string]ScoreFeature {
+	values := map[string]float64{
+		"ts_skew":       stats.tsSkew,
+		"ts_dispersion": float64(stats.tsMadm),
+		"ts_conns":      float64(res.ConnectionCount),
+		"ds_skew":       stats.dsSkew,
+		"ds_dispersion": float64(stats.dsMadm),
+		"ds_smallness":  float64(stats.dsMode),
+	}
+	// the measurement is kept even when the model doesn't score consistency
+	values[consistencyFeature] = res.BytesModeFraction
+	if res.SourceCardinality > 0 {
+		values["rarity"] = float64(res.SourceCardinality)
+	}
+	// the clustered share is only measured when BeaconSNI.BrowsingBursts.MinSpacing is set
+	if res.ClusteredFraction > 0 {
+		values["clustered"] = res.ClusteredFraction
+	}
+	// the domain's age is only known when it is listed in BeaconSNI.DomainAgeFiles
+	if res.DomainAgeKnown {
+		values["domain_age"] = res.DomainAge
+	}
+	// the period is only searched for when BeaconSNI.Periodogram is enabled
+	if res.DominantPeriod > 0 {
+		values[periodicityFeature] = res.DominantPeriod
+	}
+	// durations are only gathered when BeaconSNI.DurationScoring is enabled
+	if len(res.DurationList) > 0 {
+		values["duration"] = medianDuration(res.DurationList)
+	}
+	// sizes which climb by a fixed step are recorded for models looking for encoded payloads
+	if len(res.SizeSteps) >= progressionMinSteps {
+		values["ds_progression"] = res.SizeProgression
+	}
+
+	features := make(map[string]ScoreFeature, len(values)+len(breakdown))
+	for name, value := range values {
+		value := value
+		features[name] = ScoreFeature{Value: &value}
+	}
+	for name, score := range breakdown {
+		score := score
+		feature := features[name]
+		feature.Score = &score
+		features[name] = feature
+	}
+	return features
+}
+
+//medianDuration returns the median of the given connection durations without reordering them
+func medianDuration(durations []float64) float64 {
+	sorted := make([]float64, len(durations))
+	copy(sorted, durations)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -0,0 +1,85 @@
+package beaconsni
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScoreFeatures(t *testing.T) {
+	ts := []int64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90}
+	res := DissectorResults{
+		ConnectionCount:   int64(len(ts)),
+		TsList:            ts,
+		TsListFull:        ts,
+		OrigBytesList:     []int64{100, 100, 100, 100, 100, 100, 100, 100, 100, 100},
+		SourceCardinality: 4,
+		DurationList:      []float64{3, 0.5, 1, 2},
+	}
+
+	conf := &config.Config{}
+	stats := computeStats(res, conf, 0, 100)
+	_, breakdown := newDefaultModel(conf, 0, 100).Score(res)
+	features := scoreFeatures(res, stats, breakdown)
+
+	require.Contains(t, features, "ts_conns")
+	assert.Equal(t, 10.0, *features["ts_conns"].Value, "the connection count should be recorded")
+	assert.Equal(t, 1.0, *features["ts_conns"].Score)
+
+	require.Contains(t, features, "ds_smallness")
+	assert.Equal(t, 100.0, *features["ds_smallness"].Value, "the data size mode should be recorded")
+	assert.Equal(t, breakdown["ds_smallness"], *features["ds_smallness"].Score)
+
+	require.Contains(t, features, "ts_dispersion")
+	assert.Equal(t, 0.0, *features["ts_dispersion"].Value, "zero values should be kept")
+
+	// the default model only scores rarity when the boost is enabled
+	require.Contains(t, features, "rarity")
+	assert.Equal(t, 4.0, *features["rarity"].Value)
+	assert.Nil(t, features["rarity"].Score)
+
+	require.Contains(t, features, "duration")
+	assert.Equal(t, 1.5, *features["duration"].Value)
+	assert.Nil(t, features["duration"].Score)
+	assert.Equal(t, []float64{3, 0.5, 1, 2}, res.DurationList, "the durations should not be reordered")
+}
+
+func TestScoreFeaturesOtherModels(t *testing.T) {
+	ts := []int64{0, 10, 20, 30}
+	res := DissectorResults{
+		ConnectionCount: int64(len(ts)),
+		TsList:          ts,
+		TsListFull:      ts,
+		OrigBytesList:   []int64{100, 100, 100, 100},
+	}
+
+	_, breakdown := constantModel{}.Score(res)
+	features := scoreFeatures(res, computeStats(res, &config.Config{}, 0, 100), breakdown)
+
+	require.Contains(t, features, "constant")
+	assert.Nil(t, features["constant"].Value, "features of other models have no known measurement")
+	assert.Equal(t, 0.5, *features["constant"].Score)
+	assert.NotContains(t, features, "duration", "durations should only be recorded when gathered")
+}
+
+func TestScoreFeaturesProgression(t *testing.T) {
+	ts := []int64{0, 10, 20, 30}
+	res := DissectorResults{
+		ConnectionCount: int64(len(ts)),
+		TsList:          ts,
+		TsListFull:      ts,
+		OrigBytesList:   []int64{100, 116, 132, 148},
+	}
+	conf := &config.Config{}
+	stats := computeStats(res, conf, 0, 100)
+
+	assert.NotContains(t, scoreFeatures(res, stats, nil), "ds_progression", "the progression is only recorded when the dissector found one")
+
+	res.UniqueSizes, res.SizeSteps, res.SizeProgression = sizeProgression(res.OrigBytesList)
+	features := scoreFeatures(res, stats, nil)
+	require.Contains(t, features, "ds_progression")
+	assert.Equal(t, 1.0, *features["ds_progression"].Value)
+	assert.Nil(t, features["ds_progression"].Score)
+}
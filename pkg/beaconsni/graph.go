@@ -0,0 +1,179 @@
+package beaconsni
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/globalsign/mgo/bson"
+)
+
+type (
+	//graphBeacon holds the fields of a beaconSNI document needed to export the beacon graph
+	graphBeacon struct {
+		data.UniqueSrcFQDNPair `bson:",inline"`
+		Connections            int64           `bson:"connection_count"`
+		Score                  float64         `bson:"score"`
+		RespondingIPs          []data.UniqueIP `bson:"responding_ips"`
+	}
+
+	//graphElement is a single node or edge in the Cytoscape.js elements format
+	graphElement struct {
+		Group string           `json:"group"`
+		Data  graphElementData `json:"data"`
+	}
+
+	//graphElementData holds the attributes of a node or edge. Nodes set Type and Label,
+	//while edges set Source, Target, and Weight.
+	graphElementData struct {
+		ID      string  `json:"id"`
+		Type    string  `json:"type,omitempty"`
+		Label   string  `json:"label,omitempty"`
+		Network string  `json:"network,omitempty"`
+		Source  string  `json:"source,omitempty"`
+		Target  string  `json:"target,omitempty"`
+		Weight  int64   `json:"weight,omitempty"`
+		Score   float64 `json:"score,omitempty"`
+	}
+
+	//graphWriter streams the beacon graph as a JSON document. The beacons must be added
+	//grouped by FQDN so the FQDN to responder edges can be written as each group ends.
+	graphWriter struct {
+		w          *bufio.Writer
+		err        error
+		elements   int              // elements written so far
+		seen       map[string]bool  // ids of the source and responder nodes written so far
+		fqdn       string           // FQDN of the current group
+		responders []string         // responder node ids of the current group, in the order first seen
+		weights    map[string]int64 // connections made to each responder of the current group
+	}
+)
+
+//ExportGraph writes the SNI beacons scoring at least BeaconSNI.ExportMinScore to w as a graph
+//of source hosts, SNIs, and responding IPs in the Cytoscape.js elements JSON format. The
+//beacons are streamed from MongoDB, so the whole graph is never held in memory.
+func (r *repo) ExportGraph(w io.Writer) error {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	// sorting on the indexed fqdn field groups the beacons without a blocking sort
+	iter := session.DB(r.database.GetSelectedDB()).C(r.config.T.BeaconSNI.BeaconSNITable).
+		Find(bson.M{"score": bson.M{"$gte": r.config.S.BeaconSNI.ExportMinScore}}).
+		Select(bson.M{"_id": 0, "src": 1, "src_network_uuid": 1, "src_network_name": 1, "fqdn": 1,
+			"connection_count": 1, "score": 1, "responding_ips": 1}).
+		Sort("fqdn").
+		Iter()
+
+	graph := newGraphWriter(w)
+
+	var beacon graphBeacon
+	for iter.Next(&beacon) {
+		graph.add(beacon)
+		beacon = graphBeacon{}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+
+	return graph.close()
+}
+
+//newGraphWriter creates a graphWriter and opens the elements list
+func newGraphWriter(w io.Writer) *graphWriter {
+	graph := &graphWriter{
+		w:       bufio.NewWriter(w),
+		seen:    make(map[string]bool),
+		weights: make(map[string]int64),
+	}
+	_, graph.err = graph.w.WriteString("{\"elements\":[")
+	return graph
+}
+
+//add writes the nodes and the source to SNI edge of a beacon, and adds its connections
+//to the weights of the SNI's responder edges
+func (g *graphWriter) add(beacon graphBeacon) {
+	fqdnID := "fqdn:" + beacon.FQDN
+	if beacon.FQDN != g.fqdn || g.elements == 0 {
+		g.flushResponders()
+		g.fqdn = beacon.FQDN
+		g.write(graphElement{Group: "nodes", Data: graphElementData{ID: fqdnID, Type: "fqdn", Label: beacon.FQDN}})
+	}
+
+	srcID := graphNodeID("src", beacon.SrcIP, beacon.SrcNetworkUUID)
+	if !g.seen[srcID] {
+		g.seen[srcID] = true
+		g.write(graphElement{Group: "nodes", Data: graphElementData{
+			ID: srcID, Type: "source", Label: beacon.SrcIP, Network: beacon.SrcNetworkName,
+		}})
+	}
+
+	g.write(graphElement{Group: "edges", Data: graphElementData{
+		ID: srcID + "->" + fqdnID, Source: srcID, Target: fqdnID, Weight: beacon.Connections, Score: beacon.Score,
+	}})
+
+	for _, responder := range beacon.RespondingIPs {
+		respID := graphNodeID("resp", responder.IP, responder.NetworkUUID)
+		if !g.seen[respID] {
+			g.seen[respID] = true
+			g.write(graphElement{Group: "nodes", Data: graphElementData{
+				ID: respID, Type: "responder", Label: responder.IP, Network: responder.NetworkName,
+			}})
+		}
+		if _, ok := g.weights[respID]; !ok {
+			g.responders = append(g.responders, respID)
+		}
+		g.weights[respID] += beacon.Connections
+	}
+}
+
+//flushResponders writes the SNI to responder edges of the current group
+func (g *graphWriter) flushResponders() {
+	fqdnID := "fqdn:" + g.fqdn
+	for _, respID := range g.responders {
+		g.write(graphElement{Group: "edges", Data: graphElementData{
+			ID: fqdnID + "->" + respID, Source: fqdnID, Target: respID, Weight: g.weights[respID],
+		}})
+	}
+	g.responders = g.responders[:0]
+	g.weights = make(map[string]int64)
+}
+
+//write appends an element to the list. After the first error, nothing more is written.
+func (g *graphWriter) write(element graphElement) {
+	if g.err != nil {
+		return
+	}
+
+	encoded, err := json.Marshal(element)
+	if err != nil {
+		g.err = err
+		return
+	}
+
+	if g.elements > 0 {
+		g.w.WriteByte(',')
+	}
+	g.w.WriteByte('\n')
+	_, g.err = g.w.Write(encoded)
+	g.elements++
+}
+
+//close writes the edges of the last group, closes the elements list, and flushes the output
+func (g *graphWriter) close() error {
+	g.flushResponders()
+	if g.err != nil {
+		return g.err
+	}
+
+	if _, err := g.w.WriteString("\n]}\n"); err != nil {
+		return err
+	}
+	return g.w.Flush()
+}
+
+//graphNodeID builds a node id which tells the same IP on different networks apart
+func graphNodeID(prefix string, ip string, networkUUID bson.Binary) string {
+	return prefix + ":" + ip + "@" + hex.EncodeToString(networkUUID.Data)
+}
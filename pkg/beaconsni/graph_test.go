@@ -0,0 +1,76 @@
+package beaconsni
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/globalsign/mgo/bson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphWriter(t *testing.T) {
+	network := bson.Binary{Kind: bson.BinaryUUID, Data: []byte{0xab, 0xcd}}
+	src := data.UniqueSrcIP{SrcIP: "10.0.0.1", SrcNetworkUUID: network, SrcNetworkName: "lan"}
+	otherSrc := data.UniqueSrcIP{SrcIP: "10.0.0.2", SrcNetworkUUID: network, SrcNetworkName: "lan"}
+	cdn := data.UniqueIP{IP: "1.1.1.1", NetworkUUID: network, NetworkName: "public"}
+	other := data.UniqueIP{IP: "2.2.2.2", NetworkUUID: network, NetworkName: "public"}
+
+	var buf bytes.Buffer
+	graph := newGraphWriter(&buf)
+	graph.add(graphBeacon{
+		UniqueSrcFQDNPair: data.UniqueSrcFQDNPair{UniqueSrcIP: src, FQDN: "a.example.com"},
+		Connections:       100, Score: 0.9, RespondingIPs: []data.UniqueIP{cdn},
+	})
+	graph.add(graphBeacon{
+		UniqueSrcFQDNPair: data.UniqueSrcFQDNPair{UniqueSrcIP: otherSrc, FQDN: "a.example.com"},
+		Connections:       50, Score: 0.8, RespondingIPs: []data.UniqueIP{cdn, other},
+	})
+	graph.add(graphBeacon{
+		UniqueSrcFQDNPair: data.UniqueSrcFQDNPair{UniqueSrcIP: src, FQDN: "b.example.com"},
+		Connections:       20, Score: 0.85, RespondingIPs: []data.UniqueIP{cdn},
+	})
+	require.Nil(t, graph.close())
+
+	var output struct {
+		Elements []graphElement `json:"elements"`
+	}
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &output))
+
+	nodes := make(map[string]graphElementData)
+	edges := make(map[string]graphElementData)
+	for _, element := range output.Elements {
+		if element.Group == "nodes" {
+			_, dup := nodes[element.Data.ID]
+			assert.False(t, dup, "nodes should only be written once")
+			nodes[element.Data.ID] = element.Data
+		} else {
+			edges[element.Data.ID] = element.Data
+		}
+	}
+
+	srcID := "src:10.0.0.1@abcd"
+	cdnID := "resp:1.1.1.1@abcd"
+	assert.Len(t, nodes, 6, "2 SNIs, 2 sources, and 2 responders")
+	assert.Equal(t, graphElementData{ID: srcID, Type: "source", Label: "10.0.0.1", Network: "lan"}, nodes[srcID])
+	assert.Equal(t, "responder", nodes[cdnID].Type)
+
+	assert.Len(t, edges, 6, "3 source edges and 3 responder edges")
+	assert.Equal(t, graphElementData{
+		ID: srcID + "->fqdn:a.example.com", Source: srcID, Target: "fqdn:a.example.com", Weight: 100, Score: 0.9,
+	}, edges[srcID+"->fqdn:a.example.com"])
+	assert.Equal(t, int64(150), edges["fqdn:a.example.com->"+cdnID].Weight, "responder edges should sum the connections of every beacon")
+	assert.Equal(t, int64(50), edges["fqdn:a.example.com->resp:2.2.2.2@abcd"].Weight)
+	assert.Equal(t, int64(20), edges["fqdn:b.example.com->"+cdnID].Weight, "responder weights should not carry over between SNIs")
+}
+
+func TestGraphWriterEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, newGraphWriter(&buf).close())
+
+	var output map[string][]interface{}
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &output), "an empty graph should still be valid JSON")
+	assert.Empty(t, output["elements"])
+}
@@ -1,7 +1,9 @@
 package beaconsni
 
 import (
+	"net"
 	"runtime"
+	"time"
 
 	"github.com/activecm/rita/config"
 	"github.com/activecm/rita/database"
@@ -10,32 +12,65 @@ import (
 	"github.com/activecm/rita/pkg/sniconn"
 	"github.com/activecm/rita/util"
 	"github.com/globalsign/mgo"
-	"github.com/vbauerster/mpb"
-	"github.com/vbauerster/mpb/decor"
+	"github.com/globalsign/mgo/bson"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type repo struct {
-	database *database.DB
-	config   *config.Config
-	log      *log.Logger
+	database          *database.DB
+	config            *config.Config
+	log               *log.Logger
+	keyBuilder        func(data.UniqueSrcFQDNPair) bson.M
+	newBeaconCallback func(data.UniqueSrcFQDNPair, float64)
+	queryLimiter      *util.Limiter       // caps the queries run at once by the dissector (nil if unlimited)
+	progress          *util.ProgressGroup // shows the progress bars alongside other modules (nil if standalone)
 }
 
 //NewMongoRepository bundles the given resources for updating MongoDB with SNI connection data
 func NewMongoRepository(db *database.DB, conf *config.Config, logger *log.Logger) Repository {
+	return NewMongoRepositoryWithKeyBuilder(db, conf, logger, nil)
+}
+
+//NewMongoRepositoryWithKeyBuilder bundles the given resources for updating MongoDB with SNI
+//connection data. keyBuilder builds the filter used to select the SNIconn document of each
+//source IP, SNI pair, allowing extra fields such as a sensor id to be matched. The strobe
+//filters are added to whatever keyBuilder returns. A nil keyBuilder selects documents
+//by the pair's BSONKey().
+func NewMongoRepositoryWithKeyBuilder(db *database.DB, conf *config.Config, logger *log.Logger, keyBuilder func(data.UniqueSrcFQDNPair) bson.M) Repository {
 	return &repo{
-		database: db,
-		config:   conf,
-		log:      logger,
+		database:   db,
+		config:     conf,
+		log:        logger,
+		keyBuilder: keyBuilder,
 	}
 }
 
+//SetNewBeaconCallback sets the callback which is given each beacon that was not a beacon
+//before the current run when BeaconSNI.NewBeaconAlerts is enabled. If no callback is set,
+//new beacons are logged instead.
+func (r *repo) SetNewBeaconCallback(newBeaconCallback func(pair data.UniqueSrcFQDNPair, score float64)) {
+	r.newBeaconCallback = newBeaconCallback
+}
+
+//SetQueryLimiter shares limiter with the dissector, which takes a slot for every SNIconn query it
+//runs for a pair, and with MergeAcrossDatabases. The same limiter may be shared with other
+//modules running at the same time.
+func (r *repo) SetQueryLimiter(limiter *util.Limiter) {
+	r.queryLimiter = limiter
+}
+
+//SetProgressGroup shows the progress bars of the analysis in group rather than on their own,
+//so they can be displayed alongside the bars of other modules running at the same time
+func (r *repo) SetProgressGroup(group *util.ProgressGroup) {
+	r.progress = group
+}
+
 // CreateIndexes creates indexes for the beaconSNI collection
 func (r *repo) CreateIndexes() error {
 
-	session := r.database.Session.Copy()
-	defer session.Close()
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
 
 	// set collection name
 	collectionName := r.config.T.BeaconSNI.BeaconSNITable
@@ -69,9 +104,222 @@ func (r *repo) CreateIndexes() error {
 	return nil
 }
 
+//TopBeacons returns summaries of the highest scoring SNI beacons with a score of at least
+//minScore, ordered by descending score. At most limit summaries are returned.
+func (r *repo) TopBeacons(minScore float64, limit int) ([]BeaconSummary, error) {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	var summaries []BeaconSummary
+
+	err := session.DB(r.database.GetSelectedDB()).C(r.config.T.BeaconSNI.BeaconSNITable).
+		Pipe(topBeaconsPipeline(minScore, limit)).AllowDiskUse().All(&summaries)
+
+	return summaries, err
+}
+
+//topBeaconsPipeline matches and sorts the beacons on score before
+//trimming each result down to the fields in BeaconSummary
+func topBeaconsPipeline(minScore float64, limit int) []bson.M {
+	return []bson.M{
+		{"$match": bson.M{"score": bson.M{"$gte": minScore}}},
+		{"$sort": bson.M{"score": -1}},
+		{"$limit": limit},
+		{"$project": bson.M{
+			"_id":               0,
+			"src":               1,
+			"fqdn":              1,
+			"score":             1,
+			"connection_count":  1,
+			"attack_techniques": 1,
+			"score_bucket":      1,
+		}},
+	}
+}
+
+//CountEligible estimates how many source IP, SNI pairs will be dissected during SNI beacon
+//analysis of the current chunk: pairs updated in the current chunk which have not been
+//flagged as strobes and made more connections than BeaconSNI.DefaultConnectionThresh.
+//Per destination threshold rules are not taken into account.
+func CountEligible(db *database.DB, conf *config.Config) (int64, error) {
+	session := db.CopySession()
+	defer db.CloseSession(session)
+
+	var res struct {
+		Count int64 `bson:"count"`
+	}
+
+	err := session.DB(db.GetSelectedDB()).C(conf.T.Structure.SNIConnTable).
+		Pipe(countEligiblePipeline(conf.S.Rolling.CurrentChunk, conf.S.BeaconSNI.DefaultConnectionThresh, conf.T.BeaconSNI.CountFields)).
+		AllowDiskUse().One(&res)
+
+	// $count doesn't output a document when nothing matches
+	if err == mgo.ErrNotFound {
+		return 0, nil
+	}
+	return res.Count, err
+}
+
+//countEligiblePipeline counts the SNIconn documents updated in the given chunk which aren't
+//strobes and whose connection counts, read from countFields, add up to more than connThresh
+func countEligiblePipeline(chunk int, connThresh int, countFields []string) []bson.M {
+	return []bson.M{
+		{"$match": bson.M{
+			"cid":               chunk,
+			"dat.tls.strobe":    bson.M{"$ne": true},
+			"dat.http.strobe":   bson.M{"$ne": true},
+			"dat.merged.strobe": bson.M{"$ne": true},
+		}},
+		{"$project": bson.M{
+			"_id":   0,
+			"count": bson.M{"$sum": concatFields(countFields)},
+		}},
+		{"$match": bson.M{"count": bson.M{"$gt": connThresh}}},
+		{"$count": "count"},
+	}
+}
+
+//knownFQDNs returns the set of SNIs contacted in any chunk other than the current one
+func (r *repo) knownFQDNs() (map[string]struct{}, error) {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	knownFQDNsQuery := []bson.M{
+		{"$match": bson.M{"dat": bson.M{"$elemMatch": bson.M{
+			"cid": bson.M{"$ne": r.config.S.Rolling.CurrentChunk},
+		}}}},
+		{"$group": bson.M{"_id": "$fqdn"}},
+	}
+
+	var res struct {
+		FQDN string `bson:"_id"`
+	}
+
+	knownFQDNs := make(map[string]struct{})
+	iter := session.DB(r.database.GetSelectedDB()).C(r.config.T.Structure.SNIConnTable).
+		Pipe(knownFQDNsQuery).AllowDiskUse().Iter()
+	for iter.Next(&res) {
+		knownFQDNs[res.FQDN] = struct{}{}
+	}
+
+	return knownFQDNs, iter.Close()
+}
+
+//priorBeacons returns the map keys of every pair currently stored in the beaconSNI collection.
+//This must be called before the analysis of the current run starts writing results.
+func (r *repo) priorBeacons() (map[string]struct{}, error) {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	var pair data.UniqueSrcFQDNPair
+
+	priorBeacons := make(map[string]struct{})
+	iter := session.DB(r.database.GetSelectedDB()).C(r.config.T.BeaconSNI.BeaconSNITable).
+		Find(nil).Select(bson.M{"src": 1, "src_network_uuid": 1, "fqdn": 1}).Iter()
+	for iter.Next(&pair) {
+		priorBeacons[pair.MapKey()] = struct{}{}
+	}
+
+	return priorBeacons, iter.Close()
+}
+
+//firstContactActions records a first contact between the given pair in the current chunk.
+//Like the merged strobe flag, it is pushed as its own dat entry so that it rolls off with the chunk.
+func firstContactActions(conf *config.Config, pair data.UniqueSrcFQDNPair, chunk int) mgoBulkActions {
+	pairSelector := pair.BSONKey()
+	return mgoBulkActions{
+		conf.T.Structure.SNIConnTable: func(b *mgo.Bulk) int {
+			b.Upsert(
+				pairSelector,
+				bson.M{"$push": bson.M{
+					"dat": bson.M{
+						"$each": []bson.M{{
+							"cid": chunk,
+							"merged": bson.M{
+								"first_contact": true,
+							},
+						}},
+					},
+				}},
+			)
+			return 1
+		},
+	}
+}
+
+//loadCheckpoint returns the last pair analyzed by an interrupted run over the current chunk, if any
+func (r *repo) loadCheckpoint() (data.UniqueSrcFQDNPair, bool) {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	var state checkpoint
+	err := session.DB(r.database.GetSelectedDB()).C(r.config.T.BeaconSNI.CheckpointTable).
+		FindId(checkpointID).One(&state)
+
+	// checkpoints left behind by other chunks are stale
+	if err != nil || state.CID != r.config.S.Rolling.CurrentChunk {
+		return data.UniqueSrcFQDNPair{}, false
+	}
+	return state.LastPair, true
+}
+
+//saveCheckpoint records the last pair in the unbroken run of analyzed pairs
+func (r *repo) saveCheckpoint(lastPair data.UniqueSrcFQDNPair) {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	_, err := session.DB(r.database.GetSelectedDB()).C(r.config.T.BeaconSNI.CheckpointTable).
+		UpsertId(checkpointID, checkpoint{
+			ID:       checkpointID,
+			CID:      r.config.S.Rolling.CurrentChunk,
+			LastPair: lastPair,
+		})
+	if err != nil {
+		r.log.WithFields(log.Fields{
+			"Module": "beaconSNI",
+			"Error":  err.Error(),
+		}).Error("could not save SNI beacon checkpoint")
+	}
+}
+
+//clearCheckpoint removes the checkpoint once the analysis has finished
+func (r *repo) clearCheckpoint() {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	err := session.DB(r.database.GetSelectedDB()).C(r.config.T.BeaconSNI.CheckpointTable).
+		RemoveId(checkpointID)
+	if err != nil && err != mgo.ErrNotFound {
+		r.log.WithFields(log.Fields{
+			"Module": "beaconSNI",
+			"Error":  err.Error(),
+		}).Error("could not clear SNI beacon checkpoint")
+	}
+}
+
+//ExplainPipeline returns the SNIconn aggregation pipeline built to analyze the given pair.
+//If runExplain is set, the pipeline is also explained by MongoDB and the query plan is returned.
+func (r *repo) ExplainPipeline(pair data.UniqueSrcFQDNPair, runExplain bool) ([]bson.M, bson.M, error) {
+	d := newDissector(int64(r.config.S.Strobe.ConnectionLimit), r.keyBuilder, r.database, r.config, r.log, nil, nil)
+
+	pipeline, err := d.explainPipeline(pair)
+	if err != nil || !runExplain {
+		return pipeline, nil, err
+	}
+
+	ssn := r.database.CopySession()
+	defer r.database.CloseSession(ssn)
+
+	var plan bson.M
+	err = ssn.DB(r.database.GetSelectedDB()).C(r.config.T.Structure.SNIConnTable).Pipe(pipeline).AllowDiskUse().Explain(&plan)
+	return pipeline, plan, err
+}
+
 //Upsert calculates beacon statistics given SNI connection data in MongoDB. Summaries are
-//created for the given local hosts in MongoDB.
-func (r *repo) Upsert(tlsMap map[string]*sniconn.TLSInput, httpMap map[string]*sniconn.HTTPInput, hostMap map[string]*host.Input, minTimestamp, maxTimestamp int64) {
+//created for the given local hosts in MongoDB unless BeaconSNI.ResultSuffix is set. When
+//BeaconSNI.ScoreOnly is enabled, nothing is written to MongoDB and the scored beacons are
+//returned instead. Otherwise, nil is returned.
+func (r *repo) Upsert(tlsMap map[string]*sniconn.TLSInput, httpMap map[string]*sniconn.HTTPInput, hostMap map[string]*host.Input, minTimestamp, maxTimestamp int64) []ScoredBeacon {
 	selectors := make(map[string]data.UniqueSrcFQDNPair)
 	for tlsKey, tlsValue := range tlsMap {
 		selectors[tlsKey] = tlsValue.Hosts
@@ -81,6 +329,79 @@ func (r *repo) Upsert(tlsMap map[string]*sniconn.TLSInput, httpMap map[string]*s
 		selectors[httpKey] = httpValue.Hosts
 	}
 
+	pairs := make([]data.UniqueSrcFQDNPair, 0, len(selectors))
+	for _, selector := range selectors {
+		// sources such as scanners and monitoring servers are never analyzed
+		if r.config.R.Filtering.NeverAnalyzeSources.Excludes(selector.SrcIP) {
+			continue
+		}
+		pairs = append(pairs, selector)
+	}
+
+	// checkpoints rely on the pairs being collected in the same order every run.
+	// A score only run has no saved results to resume from.
+	var checkpoints *checkpointer
+	if interval := r.config.S.BeaconSNI.CheckpointInterval; interval > 0 && !r.config.S.BeaconSNI.ScoreOnly {
+		sortPairs(pairs)
+		if lastPair, ok := r.loadCheckpoint(); ok {
+			pairs = resumePairs(pairs, lastPair)
+			r.log.WithFields(log.Fields{
+				"Module":  "beaconSNI",
+				"Skipped": len(selectors) - len(pairs),
+			}).Info("resuming SNI beacon analysis from checkpoint")
+		}
+		checkpoints = newCheckpointer(pairs, interval, r.saveCheckpoint)
+	}
+
+	// the pairs are enqueued like any other stream, closing the input once every pair is sent
+	input := make(chan data.UniqueSrcFQDNPair)
+	go func() {
+		for _, pair := range pairs {
+			input <- pair
+		}
+		close(input)
+	}()
+
+	return r.analyze(input, int64(len(pairs)), checkpoints, hostMap, minTimestamp, maxTimestamp)
+}
+
+//UpsertStream calculates beacon statistics for the pairs received from input, which the
+//caller populates and must close once every pair has been sent. The pairs are handed to the
+//dissector workers as they arrive, and closing input starts the closing cascade once the
+//last pair is handed off. Pairs from sources excluded by Filtering.NeverAnalyzeSources are
+//skipped. Checkpoints are not kept, since the order of the pairs isn't known ahead of time.
+//Otherwise, the analysis runs as it does in Upsert and returns the same results.
+func (r *repo) UpsertStream(input <-chan data.UniqueSrcFQDNPair, hostMap map[string]*host.Input, minTimestamp, maxTimestamp int64) []ScoredBeacon {
+	if r.config.S.BeaconSNI.CheckpointInterval > 0 {
+		r.log.WithFields(log.Fields{
+			"Module": "beaconSNI",
+		}).Warn("checkpoints are not kept when SNI pairs are streamed")
+	}
+	return r.analyze(input, -1, nil, hostMap, minTimestamp, maxTimestamp)
+}
+
+//analyze runs the SNI beacon analysis over the pairs received from input until it is closed.
+//total sizes the progress bar, and a negative total shows a spinner instead. checkpoints
+//tracks the finished pairs when set, and is expected to hold the pairs in the order they
+//are sent. The local hosts in hostMap are summarized once every pair has been analyzed.
+func (r *repo) analyze(input <-chan data.UniqueSrcFQDNPair, total int64, checkpoints *checkpointer, hostMap map[string]*host.Input, minTimestamp, maxTimestamp int64) []ScoredBeacon {
+	// the run is profiled once it returns, after the host summaries have been written
+	var summary dissectorSummary
+	if profileFile := r.config.S.Log.ProfileFile; profileFile != "" {
+		started := time.Now()
+		defer func() {
+			r.appendProfile(profileFile, summary, time.Since(started))
+		}()
+	}
+
+	// the time budget covers the whole run, including the setup queries below
+	var deadline <-chan time.Time
+	if maxRuntime := r.config.S.BeaconSNI.MaxRuntime; maxRuntime > 0 {
+		timer := time.NewTimer(time.Duration(maxRuntime) * time.Minute)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
 	//Create the workers
 	writerWorker := newMgoBulkWriter(
 		r.database,
@@ -88,17 +409,87 @@ func (r *repo) Upsert(tlsMap map[string]*sniconn.TLSInput, httpMap map[string]*s
 		r.log,
 		"beaconsni",
 	)
+	writerWorker.enableAttackTags(r.config.T.BeaconSNI.BeaconSNITable, r.config.S.AttackTags.Rules.For(config.BeaconSNIAnalysis))
+	writerWorker.enableScoreBuckets(r.config.T.BeaconSNI.BeaconSNITable, r.config.S.ScoreBuckets.Buckets())
+
+	// the writes made for a pair hold back its checkpoint until the writer has saved them
+	writePair := func(pair data.UniqueSrcFQDNPair, actions mgoBulkActions) {
+		if checkpoints != nil {
+			actions = checkpoints.track(pair, actions)
+		}
+		writerWorker.collect(actions)
+	}
+
+	// when only scoring, the analyzer's results are kept in memory rather than written out
+	scoreOnly := r.config.S.BeaconSNI.ScoreOnly
+	analyzedCallback, analyzedClosedCallback := writerWorker.collect, writerWorker.close
+	var collector *scoreCollector
+	if scoreOnly {
+		collector = newScoreCollector()
+		analyzedCallback, analyzedClosedCallback = collector.collect, collector.close
+	}
+
+	// connections outside of the analysis window are ignored, so the
+	// window also bounds the timestamps used when scoring
+	if start := r.config.S.Filtering.AnalysisStart; start > 0 && start > minTimestamp {
+		minTimestamp = start
+	}
+	if end := r.config.S.Filtering.AnalysisEnd; end > 0 && end < maxTimestamp {
+		maxTimestamp = end
+	}
+
+	model, provenance := r.runModel(minTimestamp, maxTimestamp)
 
 	analyzerWorker := newAnalyzer(
 		minTimestamp,
 		maxTimestamp,
 		r.config.S.Rolling.CurrentChunk,
+		model,
 		r.database,
 		r.config,
 		r.log,
-		writerWorker.collect,
-		writerWorker.close,
+		analyzedCallback,
+		analyzedClosedCallback,
 	)
+	analyzerWorker.enableProvenance(provenance)
+	if scoreOnly {
+		analyzerWorker.enableScoredCallback(collector.add)
+	}
+
+	// findings are sent to external systems as they are scored. Score only runs
+	// are rehearsals, so nothing is sent.
+	var sink ResultSink
+	if !scoreOnly {
+		var err error
+		sink, err = newResultSink(r.config, r.database.GetSelectedDB(), r.log)
+		if err != nil {
+			r.log.WithFields(log.Fields{
+				"Module": "beaconSNI",
+				"Error":  err.Error(),
+			}).Error("could not set up the SNI beacon result sinks, findings will not be sent")
+		}
+	}
+	if sink != nil {
+		analyzerWorker.enableFindingCallback(sink.Emit)
+	}
+
+	// the features of every scored pair are kept so the beacons can be rescored later
+	if r.config.S.BeaconSNI.PersistFeatures && !scoreOnly {
+		if err := r.createFeaturesCollection(); err != nil {
+			r.log.WithFields(log.Fields{
+				"Module": "beaconSNI",
+				"Error":  err.Error(),
+			}).Error("could not create the SNI beacon features collection")
+		}
+		analyzerWorker.enableFeatureStore()
+	}
+
+	// the timing of every pair is kept so the SNIs of each source can be correlated afterwards
+	var alternations *alternationCollector
+	if r.config.S.BeaconSNI.AlternatingPairs.Enabled && !scoreOnly {
+		alternations = newAlternationCollector()
+		analyzerWorker.enableTimingCallback(alternations.add)
+	}
 
 	sorterWorker := newSorter(
 		r.database,
@@ -109,38 +500,260 @@ func (r *repo) Upsert(tlsMap map[string]*sniconn.TLSInput, httpMap map[string]*s
 
 	dissectorWorker := newDissector(
 		int64(r.config.S.Strobe.ConnectionLimit),
+		r.keyBuilder,
 		r.database,
 		r.config,
+		r.log,
 		sorterWorker.collect,
-		sorterWorker.close,
+		func(dissected dissectorSummary) error {
+			summary = dissected
+			r.log.WithFields(log.Fields{
+				"Module":     "beaconSNI",
+				"Examined":   summary.Examined,
+				"Beacons":    summary.Beacons,
+				"Strobes":    summary.Strobes,
+				"Errors":     summary.Errors,
+				"Dropped":    summary.Dropped,
+				"Filtered":   summary.Filtered,
+				"Duplicates": summary.Duplicates,
+			}).Info(summary.String())
+			return sorterWorker.close()
+		},
 	)
 
+	// the examined collection is only written to when auditing is enabled
+	if r.config.S.BeaconSNI.AuditExamined && !scoreOnly {
+		if err := r.createExaminedCollection(); err != nil {
+			r.log.WithFields(log.Fields{
+				"Module": "beaconSNI",
+				"Error":  err.Error(),
+			}).Error("could not create the examined SNI pairs collection")
+		}
+	}
+
+	// skipped pairs are only logged at debug level unless per pair logging was asked for
+	verbose := r.config.S.Log.AnalysisVerbosity >= config.AnalysisVerbosityPairs
+	if !scoreOnly || verbose {
+		dissectorWorker.enableExaminedCallback(func(pair data.UniqueSrcFQDNPair, reason ExaminedReason, connectionCount int64) {
+			entry := r.log.WithFields(log.Fields{
+				"Module": "beaconSNI",
+				"Data":   pair,
+				"Reason": reason,
+			})
+			if verbose {
+				entry.WithField("Connections", connectionCount).Info("skipped SNI beacon analysis")
+			} else {
+				entry.Debug("skipped SNI beacon analysis")
+			}
+
+			// a score only run doesn't write anything
+			if scoreOnly {
+				return
+			}
+
+			actions := examinedActions(r.config, pair, reason, connectionCount, r.config.S.Rolling.CurrentChunk, time.Now())
+			if len(actions) > 0 {
+				writePair(pair, actions)
+			}
+		})
+	}
+
+	// flag brand new destinations. This only makes sense once previous chunks
+	// have been imported, otherwise every SNI would be a first contact.
+	if r.config.S.BeaconSNI.FirstContact && r.config.S.Rolling.Rolling && !scoreOnly {
+		knownFQDNs, err := r.knownFQDNs()
+		if err != nil {
+			r.log.WithFields(log.Fields{
+				"Module": "beaconSNI",
+				"Error":  err.Error(),
+			}).Error("could not load known SNIs, skipping first contact detection")
+		} else if len(knownFQDNs) > 0 {
+			chunk := r.config.S.Rolling.CurrentChunk
+			dissectorWorker.enableFirstContact(knownFQDNs, func(pair data.UniqueSrcFQDNPair) {
+				writePair(pair, firstContactActions(r.config, pair, chunk))
+			})
+		}
+	}
+
+	// alert on beacons which weren't around for the previous run. The prior set must be
+	// captured before any results are written, since the beacons are updated in place.
+	if r.config.S.BeaconSNI.NewBeaconAlerts {
+		priorBeacons, err := r.priorBeacons()
+		if err != nil {
+			r.log.WithFields(log.Fields{
+				"Module": "beaconSNI",
+				"Error":  err.Error(),
+			}).Error("could not load the previous SNI beacons, skipping new beacon alerts")
+		} else if len(priorBeacons) > 0 {
+			newBeaconCallback := r.newBeaconCallback
+			if newBeaconCallback == nil {
+				newBeaconCallback = func(pair data.UniqueSrcFQDNPair, score float64) {
+					r.log.WithFields(log.Fields{
+						"Module": "beaconSNI",
+						"Data":   pair,
+						"Score":  score,
+					}).Info("new SNI beacon")
+				}
+			}
+			analyzerWorker.enableNewBeacons(priorBeacons, newBeaconCallback)
+		}
+	}
+
+	// the connection threshold follows the length of the analyzed window when given as a rate
+	if rate := r.config.S.BeaconSNI.ConnectionRate; rate > 0 {
+		connThresh := dissectorWorker.enableConnectionRate(rate, minTimestamp, maxTimestamp)
+		r.log.WithFields(log.Fields{
+			"Module":    "beaconSNI",
+			"Rate":      rate,
+			"Hours":     float64(maxTimestamp-minTimestamp) / 3600.0,
+			"Threshold": connThresh,
+		}).Info("derived the SNI beacon connection threshold from the connection rate")
+	}
+
+	// external responders are annotated with their PTR records, unless DNS isn't reachable
+	if rdns := r.config.S.BeaconSNI.ReverseDNS; rdns.Enabled && !scoreOnly {
+		timeout := time.Duration(rdns.Timeout) * time.Millisecond
+		resolver := newPTRResolver(rdns.MaxLookupsPerSecond, timeout, net.DefaultResolver.LookupAddr)
+		// the analyzer has stopped waiting on lookups once the closing cascade finishes
+		defer resolver.close()
+		dissectorWorker.enableReverseDNS(resolver)
+		analyzerWorker.enableReverseDNS(timeout)
+	}
+
+	// the SNIconn pipelines share MongoDB with any module running alongside this one
+	dissectorWorker.enableQueryLimiter(r.queryLimiter)
+
+	// recent connections count for more when scoring, relative to the end of the analyzed window
+	if halfLife := r.config.S.BeaconSNI.DecayHalfLifeDays; halfLife > 0 {
+		dissectorWorker.enableDecay(halfLife, maxTimestamp)
+	}
+
+	// a pair is only checkpointed once its results have made it through the analyzer and writer
+	if checkpoints != nil {
+		dissectorWorker.enableCheckpoints(checkpoints)
+		analyzerWorker.enableCheckpoints(checkpoints)
+		writerWorker.enableCheckpoints(checkpoints)
+	}
+
+	// when auto scaling, start with a single dissector and let it add more threads as needed
+	dissectorThreads := util.Max(1, runtime.NumCPU()/2)
+	if r.config.S.BeaconSNI.AutoScaleDissectors {
+		maxDissectors := r.config.S.BeaconSNI.MaxDissectors
+		if maxDissectors <= 0 {
+			maxDissectors = runtime.NumCPU()
+		}
+		dissectorWorker.enableAutoScaling(maxDissectors)
+		dissectorThreads = 1
+	}
+
 	//kick off the threaded goroutines
-	for i := 0; i < util.Max(1, runtime.NumCPU()/2); i++ {
+	for i := 0; i < dissectorThreads; i++ {
 		dissectorWorker.start()
+	}
+	for i := 0; i < util.Max(1, runtime.NumCPU()/2); i++ {
 		sorterWorker.start()
 		analyzerWorker.start()
-		writerWorker.start()
+		if !scoreOnly {
+			writerWorker.start()
+		}
 	}
 
-	// progress bar for troubleshooting
-	p := mpb.New(mpb.WithWidth(20))
-	bar := p.AddBar(int64(len(selectors)),
-		mpb.PrependDecorators(
-			decor.Name("\t[-] SNI Beacon Analysis:", decor.WC{W: 30, C: decor.DidentRight}),
-			decor.CountersNoUnit(" %d / %d ", decor.WCSyncWidth),
-		),
-		mpb.AppendDecorators(decor.Percentage()),
-	)
-	// loop over map entries
-	for _, entry := range selectors {
+	// progress bar for troubleshooting. Streamed pairs can't be counted ahead of time.
+	var bar *util.Progress
+	if total < 0 {
+		bar = util.NewIndeterminateProgress("\t[-] SNI Beacon Analysis")
+	} else {
+		bar = r.progress.NewCountedProgress("\t[-] SNI Beacon Analysis:", total)
+	}
+	// collect the pairs until the input is closed, stopping early if the time budget runs
+	// out. Pairs which were already collected are still analyzed and written by the closing
+	// cascade. The rest of the input is drained so whoever is sending it doesn't block.
+	unexamined := 0
+	timedOut := false
+	for entry := range input {
+		if !timedOut {
+			select {
+			case <-deadline:
+				timedOut = true
+			default:
+			}
+		}
+		if timedOut {
+			unexamined++
+			continue
+		}
+		// streamed pairs haven't been filtered by the caller
+		if r.config.R.Filtering.NeverAnalyzeSources.Excludes(entry.SrcIP) {
+			continue
+		}
 		dissectorWorker.collect(entry)
-		bar.IncrBy(1)
+		bar.Increment()
+	}
+	bar.Wait()
+
+	if unexamined > 0 {
+		r.log.WithFields(log.Fields{
+			"Module":     "beaconSNI",
+			"MaxRuntime": r.config.S.BeaconSNI.MaxRuntime,
+			"Unexamined": unexamined,
+		}).Warn("SNI beacon analysis was time limited, some pairs were not examined")
 	}
-	p.Wait()
 
 	// start the closing cascade (this will also close the other channels)
-	dissectorWorker.close()
+	if err := dissectorWorker.close(); err != nil {
+		// keep the checkpoint so the next run resumes the unsaved results
+		r.log.WithFields(log.Fields{
+			"Module": "beaconSNI",
+			"Error":  err.Error(),
+		}).Error("SNI beacon results were not fully saved")
+	} else if checkpoints != nil && unexamined > 0 {
+		// every collected result has been written, so the next run can resume right after them
+		checkpoints.saveProgress()
+	} else if checkpoints != nil {
+		// every result has been written, so there is nothing left to resume
+		r.clearCheckpoint()
+	}
+
+	// every finding has been emitted once the closing cascade finishes
+	if sink != nil {
+		if err := sink.Close(); err != nil {
+			r.log.WithFields(log.Fields{
+				"Module": "beaconSNI",
+				"Error":  err.Error(),
+			}).Error("some SNI beacon findings were not sent")
+		}
+	}
+
+	// every pair has been analyzed, so each source's SNIs can be compared with one another
+	if alternations != nil {
+		resolution := config.SecondResolution
+		if r.config.S.BeaconSNI.TimestampResolution == config.MillisecondResolution {
+			resolution = config.MillisecondResolution
+		}
+		cfg := r.config.S.BeaconSNI.AlternatingPairs
+		pairs := alternations.correlate(cfg.MaxDestinations, cfg.MinScore, resolution, r.config.S.Rolling.CurrentChunk)
+		if err := r.saveAlternatingPairs(alternations.analyzedSources(), pairs); err != nil {
+			r.log.WithFields(log.Fields{
+				"Module": "beaconSNI",
+				"Error":  err.Error(),
+			}).Error("could not save the SNI pairs sources alternate between")
+		} else {
+			r.log.WithFields(log.Fields{
+				"Module": "beaconSNI",
+				"Pairs":  len(pairs),
+			}).Info("correlated the SNIs of each source for alternating beacons")
+		}
+	}
+
+	// nothing was written, so there is nothing to summarize
+	if scoreOnly {
+		return collector.scores()
+	}
+
+	// the host summaries aren't suffixed, so an experimental run leaves the regular summaries alone
+	if r.config.S.BeaconSNI.ResultSuffix != "" {
+		return nil
+	}
 
 	// // Phase 2: Summary
 
@@ -171,23 +784,77 @@ func (r *repo) Upsert(tlsMap map[string]*sniconn.TLSInput, httpMap map[string]*s
 	}
 
 	// add a progress bar for troubleshooting
-	p = mpb.New(mpb.WithWidth(20))
-	bar = p.AddBar(int64(len(localHosts)),
-		mpb.PrependDecorators(
-			decor.Name("\t[-] SNI Beacon Aggregation:", decor.WC{W: 30, C: decor.DidentRight}),
-			decor.CountersNoUnit(" %d / %d ", decor.WCSyncWidth),
-		),
-		mpb.AppendDecorators(decor.Percentage()),
-	)
+	bar = r.progress.NewCountedProgress("\t[-] SNI Beacon Aggregation:", int64(len(localHosts)))
 
 	// loop over the local hosts that need to be summarized
 	for _, localHost := range localHosts {
 		summarizerWorker.collect(localHost)
-		bar.IncrBy(1)
+		bar.Increment()
 	}
 
-	p.Wait()
+	bar.Wait()
 
 	// start the closing cascade (this will also close the other channels)
-	summarizerWorker.close()
+	if err := summarizerWorker.close(); err != nil {
+		r.log.WithFields(log.Fields{
+			"Module": "beaconSNI",
+			"Error":  err.Error(),
+		}).Error("SNI beacon summaries were not fully saved")
+	}
+	return nil
+}
+
+//appendProfile appends the timing of an analysis run to the profile file. Failing to
+//profile a run is logged rather than treated as an analysis error.
+func (r *repo) appendProfile(profileFile string, summary dissectorSummary, elapsed time.Duration) {
+	err := util.AppendProfile(profileFile, util.AnalysisProfile{
+		Time:          time.Now().Unix(),
+		Module:        "beaconSNI",
+		Database:      r.database.GetSelectedDB(),
+		Chunk:         r.config.S.Rolling.CurrentChunk,
+		PairsExamined: summary.Examined,
+		BeaconsFound:  summary.Beacons,
+		DurationMs:    elapsed.Milliseconds(),
+		QueryMs:       time.Duration(summary.QueryTime).Milliseconds(),
+	})
+	if err != nil {
+		r.log.WithFields(log.Fields{
+			"Module": "beaconSNI",
+			"Error":  err.Error(),
+		}).Error("could not append to the analysis profile file")
+	}
+}
+
+//PurgeChunk removes the SNI beacon results of the given chunk. Beacons are flat documents
+//which are rewritten in full whenever a pair is analyzed, so every beacon last written in
+//the chunk is removed, as are the hosts' max SNI beacon summaries, any examined pair records,
+//any stored features, and any checkpoint left by the chunk. Beacons updated by a later chunk
+//are kept, since their scores already reflect the later data.
+func (r *repo) PurgeChunk(chunkID int) error {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+	db := session.DB(r.database.GetSelectedDB())
+
+	if _, err := db.C(r.config.T.BeaconSNI.BeaconSNITable).RemoveAll(bson.M{"cid": chunkID}); err != nil {
+		return err
+	}
+
+	_, err := db.C(r.config.T.Structure.HostTable).UpdateAll(
+		bson.M{"dat": bson.M{"$elemMatch": bson.M{"cid": chunkID, "mbsni": bson.M{"$exists": true}}}},
+		bson.M{"$pull": bson.M{"dat": bson.M{"cid": chunkID, "mbsni": bson.M{"$exists": true}}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.C(r.config.T.BeaconSNI.ExaminedTable).RemoveAll(bson.M{"cid": chunkID}); err != nil {
+		return err
+	}
+
+	if _, err := db.C(r.config.T.BeaconSNI.FeaturesTable).RemoveAll(bson.M{"cid": chunkID}); err != nil {
+		return err
+	}
+
+	_, err = db.C(r.config.T.BeaconSNI.CheckpointTable).RemoveAll(bson.M{"_id": checkpointID, "cid": chunkID})
+	return err
 }
@@ -0,0 +1,687 @@
+// +build integration
+
+package beaconsni
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/resources"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/globalsign/mgo/dbtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// Server holds the dbtest DBServer
+var Server dbtest.DBServer
+
+// Set the test database
+var testTargetDB = "tmp_test_db"
+
+var testRes *resources.Resources
+
+var testRepo Repository
+
+var testBeacons = []bson.M{
+	{"src": "10.0.0.1", "fqdn": "a.example.com", "score": 0.95, "connection_count": 100,
+		"attack_techniques": []string{"T1071.001", "T1573.002"}, "score_bucket": "high"},
+	{"src": "10.0.0.1", "fqdn": "b.example.com", "score": 0.42, "connection_count": 30},
+	{"src": "10.0.0.2", "fqdn": "c.example.com", "score": 0.81, "connection_count": 250},
+	{"src": "10.0.0.3", "fqdn": "d.example.com", "score": 0.88, "connection_count": 75},
+	{"src": "10.0.0.4", "fqdn": "e.example.com", "score": 0.10, "connection_count": 21},
+}
+
+func TestTopBeacons(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	coll := ssn.DB(testTargetDB).C(testRes.Config.T.BeaconSNI.BeaconSNITable)
+	for _, beacon := range testBeacons {
+		assert.Nil(t, coll.Insert(beacon))
+	}
+
+	summaries, err := testRepo.TopBeacons(0.8, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []BeaconSummary{
+		{Src: "10.0.0.1", FQDN: "a.example.com", Score: 0.95, Connections: 100,
+			AttackTechniques: []string{"T1071.001", "T1573.002"}, ScoreBucket: "high"},
+		{Src: "10.0.0.3", FQDN: "d.example.com", Score: 0.88, Connections: 75},
+	}, summaries)
+
+	summaries, err = testRepo.TopBeacons(0.8, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(summaries), "all beacons above the threshold should be returned")
+
+	summaries, err = testRepo.TopBeacons(0.99, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(summaries), "no beacons should be returned above the max score")
+}
+
+var testSNIConn = bson.M{
+	"src":  "10.0.0.5",
+	"fqdn": "tbytes.example.com",
+	"dat": []bson.M{
+		{"cid": 0, "tls": bson.M{
+			"ts": []int64{10, 20, 30}, "bytes": []int64{100, 110, 120}, "count": 3, "tbytes": 1000,
+			"dst_ips": []bson.M{{"ip": "1.1.1.1", "network_uuid": "a", "network_name": "a"}},
+		}},
+		{"cid": 0, "http": bson.M{
+			"ts": []int64{15, 25}, "bytes": []int64{200, 210}, "count": 2, "tbytes": 2500,
+			"dst_ips": []bson.M{{"ip": "1.1.1.2", "network_uuid": "a", "network_name": "a"}},
+		}},
+		{"cid": 1, "tls": bson.M{
+			"ts": []int64{40, 50}, "bytes": []int64{130, 140}, "count": 2, "tbytes": 750,
+			"dst_ips": []bson.M{{"ip": "1.1.1.1", "network_uuid": "a", "network_name": "a"}},
+		}},
+	},
+}
+
+//legacyTBytesPipeline rebuilds the SNIconn pipeline as it was before tbytes was
+//summed in the $project stage, unwinding and regrouping tbytes instead
+func legacyTBytesPipeline(matchKey bson.M, connThresh int) []bson.M {
+	pipeline := sniconnPipeline(matchKey, testRes.Config.T.BeaconSNI.SNIConnFieldsCfg, connThresh, "$ts", false)
+	pipeline[2]["$project"].(bson.M)["tbytes"] = concatProtocols("tbytes")
+
+	// the tbytes round trip followed the connection threshold $match
+	legacy := append([]bson.M{}, pipeline[:6]...)
+	legacy = append(legacy,
+		bson.M{"$unwind": "$tbytes"},
+		bson.M{"$group": bson.M{
+			"_id":            "$_id",
+			"ts":             bson.M{"$first": "$ts"},
+			"bytes":          bson.M{"$first": "$bytes"},
+			"count":          bson.M{"$first": "$count"},
+			"tbytes":         bson.M{"$sum": "$tbytes"},
+			"responding_ips": bson.M{"$first": "$responding_ips"},
+		}},
+	)
+	return append(legacy, pipeline[6:]...)
+}
+
+func TestSNIconnPipelineTBytes(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	coll := ssn.DB(testTargetDB).C(testRes.Config.T.Structure.SNIConnTable)
+	assert.Nil(t, coll.Insert(testSNIConn))
+
+	matchKey := bson.M{"src": "10.0.0.5", "fqdn": "tbytes.example.com"}
+
+	type pipelineResult struct {
+		Count  int64   `bson:"count"`
+		Ts     []int64 `bson:"ts"`
+		TsFull []int64 `bson:"ts_full"`
+		Bytes  []int64 `bson:"bytes"`
+		TBytes int64   `bson:"tbytes"`
+	}
+
+	var legacyRes, res pipelineResult
+	assert.Nil(t, coll.Pipe(legacyTBytesPipeline(matchKey, 1)).One(&legacyRes))
+	assert.Nil(t, coll.Pipe(sniconnPipeline(matchKey, testRes.Config.T.BeaconSNI.SNIConnFieldsCfg, 1, "$ts", false)).One(&res))
+
+	// $addToSet does not guarantee an order
+	sort.Slice(legacyRes.Ts, func(i, j int) bool { return legacyRes.Ts[i] < legacyRes.Ts[j] })
+	sort.Slice(res.Ts, func(i, j int) bool { return res.Ts[i] < res.Ts[j] })
+
+	assert.Equal(t, int64(4250), res.TBytes, "tbytes should be summed across protocols and chunks")
+	assert.Equal(t, int64(7), res.Count)
+	assert.Equal(t, legacyRes, res, "summing tbytes in $project should not change the results")
+}
+
+//legacyRespondersPipeline rebuilds the SNIconn pipeline as it was before the per chunk
+//responder lists were flattened in the $project stage, unwinding them twice instead
+func legacyRespondersPipeline(matchKey bson.M, connThresh int) []bson.M {
+	pipeline := sniconnPipeline(matchKey, testRes.Config.T.BeaconSNI.SNIConnFieldsCfg, connThresh, "$ts", false)
+	pipeline[2]["$project"].(bson.M)["responding_ips"] = concatProtocols("dst_ips")
+
+	legacy := make([]bson.M, 0, len(pipeline)+1)
+	for _, stage := range pipeline {
+		legacy = append(legacy, stage)
+		if stage["$unwind"] == "$responding_ips" {
+			legacy = append(legacy, bson.M{"$unwind": "$responding_ips"})
+		}
+	}
+	return legacy
+}
+
+func TestSNIconnPipelineFlattenedResponders(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	responder := func(ip string, uuid string, name string) bson.M {
+		return bson.M{"ip": ip, "network_uuid": uuid, "network_name": name}
+	}
+	coll := ssn.DB(testTargetDB).C(testRes.Config.T.Structure.SNIConnTable)
+	assert.Nil(t, coll.Insert(bson.M{
+		"src":  "10.0.0.10",
+		"fqdn": "responders.example.com",
+		"dat": []bson.M{
+			{"cid": 0, "tls": bson.M{
+				"ts": []int64{10, 20}, "bytes": []int64{1, 1}, "count": 2, "tbytes": 2,
+				"dst_ips": []bson.M{responder("1.1.2.1", "a", "a"), responder("1.1.2.2", "a", "a")},
+			}},
+			// the same responder on a different network is a different responder
+			{"cid": 0, "http": bson.M{
+				"ts": []int64{30}, "bytes": []int64{1}, "count": 1, "tbytes": 1,
+				"dst_ips": []bson.M{responder("1.1.2.1", "b", "b")},
+			}},
+			// an empty responder list adds nothing
+			{"cid": 1, "tls": bson.M{
+				"ts": []int64{40}, "bytes": []int64{1}, "count": 1, "tbytes": 1,
+				"dst_ips": []bson.M{},
+			}},
+			// repeated responders are merged, keeping the last network name
+			{"cid": 1, "http": bson.M{
+				"ts": []int64{50}, "bytes": []int64{1}, "count": 1, "tbytes": 1,
+				"dst_ips": []bson.M{responder("1.1.2.2", "a", "renamed"), responder("1.1.2.3", "a", "a")},
+			}},
+		},
+	}))
+
+	type pipelineResult struct {
+		Count         int64    `bson:"count"`
+		TsFull        []int64  `bson:"ts_full"`
+		RespondingIPs []bson.M `bson:"responding_ips"`
+	}
+	byResponder := func(res pipelineResult) {
+		sort.Slice(res.RespondingIPs, func(i, j int) bool {
+			keyI := res.RespondingIPs[i]["ip"].(string) + res.RespondingIPs[i]["network_uuid"].(string)
+			keyJ := res.RespondingIPs[j]["ip"].(string) + res.RespondingIPs[j]["network_uuid"].(string)
+			return keyI < keyJ
+		})
+	}
+
+	matchKey := bson.M{"src": "10.0.0.10", "fqdn": "responders.example.com"}
+
+	var legacyRes, res pipelineResult
+	assert.Nil(t, coll.Pipe(legacyRespondersPipeline(matchKey, 1)).One(&legacyRes))
+	assert.Nil(t, coll.Pipe(sniconnPipeline(matchKey, testRes.Config.T.BeaconSNI.SNIConnFieldsCfg, 1, "$ts", false)).One(&res))
+
+	// responders are regrouped with $push after the unwind, which does not guarantee an order
+	byResponder(legacyRes)
+	byResponder(res)
+
+	assert.Len(t, res.RespondingIPs, 4)
+	assert.Equal(t, legacyRes, res, "flattening the responders should not change the results")
+
+	// a pair without any responders is dropped by the unwind either way
+	assert.Nil(t, coll.Insert(bson.M{
+		"src":  "10.0.0.11",
+		"fqdn": "noresponders.example.com",
+		"dat": []bson.M{
+			{"cid": 0, "tls": bson.M{"ts": []int64{10, 20}, "bytes": []int64{1, 1}, "count": 2, "tbytes": 2, "dst_ips": []bson.M{}}},
+		},
+	}))
+	matchKey = bson.M{"src": "10.0.0.11", "fqdn": "noresponders.example.com"}
+	assert.Equal(t, mgo.ErrNotFound, coll.Pipe(legacyRespondersPipeline(matchKey, 1)).One(&legacyRes))
+	assert.Equal(t, mgo.ErrNotFound, coll.Pipe(sniconnPipeline(matchKey, testRes.Config.T.BeaconSNI.SNIConnFieldsCfg, 1, "$ts", false)).One(&res))
+}
+
+var testTLSOnlySNIConn = bson.M{
+	"src":  "10.0.0.6",
+	"fqdn": "tlsonly.example.com",
+	"dat": []bson.M{
+		{"cid": 0, "tls": bson.M{
+			"ts": []int64{10, 20, 30, 40, 50}, "bytes": []int64{100, 100, 100, 100, 100}, "count": 5, "tbytes": 500,
+			"dst_ips": []bson.M{{"ip": "1.1.1.3", "network_uuid": "a", "network_name": "a"}},
+		}},
+	},
+}
+
+func TestSNIconnPipelineTLSOnly(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	coll := ssn.DB(testTargetDB).C(testRes.Config.T.Structure.SNIConnTable)
+	assert.Nil(t, coll.Insert(testTLSOnlySNIConn))
+
+	var res struct {
+		Count  int64   `bson:"count"`
+		TsFull []int64 `bson:"ts_full"`
+		TBytes int64   `bson:"tbytes"`
+	}
+
+	matchKey := bson.M{"src": "10.0.0.6", "fqdn": "tlsonly.example.com"}
+	assert.Nil(t, coll.Pipe(sniconnPipeline(matchKey, testRes.Config.T.BeaconSNI.SNIConnFieldsCfg, 1, "$ts", false)).One(&res))
+
+	assert.Equal(t, int64(5), res.Count, "the tls count should survive the missing http data")
+	assert.Equal(t, int64(500), res.TBytes)
+	assert.Equal(t, []int64{10, 20, 30, 40, 50}, res.TsFull)
+}
+
+func TestSNIconnPipelineDurations(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	coll := ssn.DB(testTargetDB).C(testRes.Config.T.Structure.SNIConnTable)
+	assert.Nil(t, coll.Insert(bson.M{
+		"src":  "10.0.0.7",
+		"fqdn": "durations.example.com",
+		"dat": []bson.M{
+			{"cid": 0, "tls": bson.M{
+				"ts": []int64{10, 20, 30}, "bytes": []int64{100, 100, 100}, "count": 3, "tbytes": 300,
+				"durations": []float64{0.5, 0.25, 0.5},
+				"dst_ips":   []bson.M{{"ip": "1.1.1.4", "network_uuid": "a", "network_name": "a"}},
+			}},
+			// imported before durations were stored
+			{"cid": 1, "http": bson.M{
+				"ts": []int64{40, 50}, "bytes": []int64{100, 100}, "count": 2, "tbytes": 200,
+				"dst_ips": []bson.M{{"ip": "1.1.1.4", "network_uuid": "a", "network_name": "a"}},
+			}},
+		},
+	}))
+
+	var res struct {
+		Count     int64     `bson:"count"`
+		Durations []float64 `bson:"durations"`
+	}
+
+	matchKey := bson.M{"src": "10.0.0.7", "fqdn": "durations.example.com"}
+	assert.Nil(t, coll.Pipe(sniconnPipeline(matchKey, testRes.Config.T.BeaconSNI.SNIConnFieldsCfg, 1, "$ts", true)).One(&res))
+	assert.Equal(t, int64(5), res.Count)
+	assert.Equal(t, []float64{0.5, 0.25, 0.5}, res.Durations, "missing durations should be skipped")
+
+	res.Durations = nil
+	assert.Nil(t, coll.Pipe(sniconnPipeline(matchKey, testRes.Config.T.BeaconSNI.SNIConnFieldsCfg, 1, "$ts", false)).One(&res))
+	assert.Nil(t, res.Durations, "durations should only be gathered when requested")
+}
+
+func TestSNIconnPipelineTimeWindow(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	coll := ssn.DB(testTargetDB).C(testRes.Config.T.Structure.SNIConnTable)
+	assert.Nil(t, coll.Insert(bson.M{
+		"src":  "10.0.0.8",
+		"fqdn": "window.example.com",
+		"dat": []bson.M{
+			// entirely before the window
+			{"cid": 0, "tls": bson.M{
+				"ts": []int64{10, 20}, "bytes": []int64{1, 1}, "count": 2, "tbytes": 2,
+				"dst_ips": []bson.M{{"ip": "1.1.1.5", "network_uuid": "a", "network_name": "a"}},
+			}},
+			// straddles the start of the window
+			{"cid": 1, "tls": bson.M{
+				"ts": []int64{90, 100, 110}, "bytes": []int64{5, 5, 5}, "count": 3, "tbytes": 15,
+				"dst_ips": []bson.M{{"ip": "1.1.1.5", "network_uuid": "a", "network_name": "a"}},
+			}},
+			// straddles the end of the window
+			{"cid": 1, "http": bson.M{
+				"ts": []int64{190, 200, 210}, "bytes": []int64{7, 7, 7}, "count": 3, "tbytes": 21,
+				"dst_ips": []bson.M{{"ip": "1.1.1.5", "network_uuid": "a", "network_name": "a"}},
+			}},
+		},
+	}))
+
+	var res struct {
+		Count  int64   `bson:"count"`
+		TsFull []int64 `bson:"ts_full"`
+		Bytes  []int64 `bson:"bytes"`
+		TBytes int64   `bson:"tbytes"`
+	}
+
+	matchKey := bson.M{"src": "10.0.0.8", "fqdn": "window.example.com"}
+	pipeline := addTimeWindow(sniconnPipeline(matchKey, testRes.Config.T.BeaconSNI.SNIConnFieldsCfg, 1, "$ts", false), 100, 200)
+	assert.Nil(t, coll.Pipe(pipeline).One(&res))
+
+	sort.Slice(res.TsFull, func(i, j int) bool { return res.TsFull[i] < res.TsFull[j] })
+	assert.Equal(t, []int64{100, 110, 190, 200}, res.TsFull, "only timestamps within the window should be kept")
+	assert.Equal(t, int64(4), res.Count, "the count should be recomputed from the kept timestamps")
+	assert.Equal(t, int64(36), res.TBytes, "entries entirely outside of the window should be dropped")
+	assert.Equal(t, 6, len(res.Bytes))
+
+	// the connection threshold applies to the recomputed count
+	assert.Equal(t, mgo.ErrNotFound, coll.Pipe(addTimeWindow(sniconnPipeline(matchKey, testRes.Config.T.BeaconSNI.SNIConnFieldsCfg, 4, "$ts", false), 100, 200)).One(&res))
+
+	// an open ended window only bounds one side
+	assert.Nil(t, coll.Pipe(addTimeWindow(sniconnPipeline(matchKey, testRes.Config.T.BeaconSNI.SNIConnFieldsCfg, 1, "$ts", false), 0, 20)).One(&res))
+	assert.Equal(t, int64(2), res.Count)
+}
+
+func TestConnectionCountPipelineWindow(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	coll := ssn.DB(testTargetDB).C(testRes.Config.T.Structure.SNIConnTable)
+	assert.Nil(t, coll.Insert(bson.M{
+		"src":  "10.0.0.12",
+		"fqdn": "outside.example.com",
+		"dat": []bson.M{
+			{"cid": 0, "tls": bson.M{
+				"ts": []int64{10, 20, 30}, "bytes": []int64{1, 1, 1}, "count": 3, "tbytes": 3,
+				"dst_ips": []bson.M{{"ip": "1.1.1.9", "network_uuid": "a", "network_name": "a"}},
+			}},
+			{"cid": 1, "http": bson.M{
+				"ts": []int64{40, 50}, "bytes": []int64{1, 1}, "count": 2, "tbytes": 2,
+				"dst_ips": []bson.M{{"ip": "1.1.1.9", "network_uuid": "a", "network_name": "a"}},
+			}},
+		},
+	}))
+
+	matchKey := bson.M{"src": "10.0.0.12", "fqdn": "outside.example.com"}
+	countFields := testRes.Config.T.BeaconSNI.CountFields
+
+	// the pair meets the threshold, but the pipeline doesn't return it once the window is applied
+	var details sniconnDetails
+	pipeline := addTimeWindow(sniconnPipeline(matchKey, testRes.Config.T.BeaconSNI.SNIConnFieldsCfg, 2, "$ts", false), 100, 200)
+	assert.Equal(t, mgo.ErrNotFound, coll.Pipe(pipeline).One(&details))
+
+	var res struct {
+		Count    int64 `bson:"count"`
+		InWindow int64 `bson:"in_window"`
+	}
+	assert.Nil(t, coll.Pipe(connectionCountPipeline(matchKey, countFields, 100, 200)).One(&res))
+	assert.Equal(t, int64(5), res.Count, "the total should ignore the window")
+	assert.Equal(t, int64(0), res.InWindow)
+	assert.Equal(t, OutsideWindow, unmatchedReason(res.Count, res.InWindow, 2))
+
+	assert.Nil(t, coll.Pipe(connectionCountPipeline(matchKey, countFields, 25, 200)).One(&res))
+	assert.Equal(t, int64(3), res.InWindow)
+	assert.Equal(t, BelowThreshold, unmatchedReason(res.Count, res.InWindow, 3))
+
+	assert.Nil(t, coll.Pipe(connectionCountPipeline(matchKey, countFields, 0, 0)).One(&res))
+	assert.Equal(t, res.Count, res.InWindow)
+}
+
+func TestSNIconnPipelineChunkCounts(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	coll := ssn.DB(testTargetDB).C(testRes.Config.T.Structure.SNIConnTable)
+	assert.Nil(t, coll.Insert(bson.M{
+		"src":  "10.0.0.9",
+		"fqdn": "burst.example.com",
+		"dat": []bson.M{
+			{"cid": 0, "tls": bson.M{
+				"ts": []int64{10, 20}, "bytes": []int64{1, 1}, "count": 2, "tbytes": 2,
+				"dst_ips": []bson.M{{"ip": "1.1.1.6", "network_uuid": "a", "network_name": "a"}},
+			}},
+			{"cid": 1, "http": bson.M{
+				"ts": []int64{30, 40, 50}, "bytes": []int64{5, 5, 5}, "count": 3, "tbytes": 15,
+				"dst_ips": []bson.M{{"ip": "1.1.1.6", "network_uuid": "a", "network_name": "a"}},
+			}},
+		},
+	}))
+
+	matchKey := bson.M{"src": "10.0.0.9", "fqdn": "burst.example.com"}
+	pipeline := sniconnPipeline(matchKey, testRes.Config.T.BeaconSNI.SNIConnFieldsCfg, 1, "$ts", false)
+	addChunkCounts(pipeline)
+
+	var res sniconnDetails
+	assert.Nil(t, coll.Pipe(pipeline).One(&res))
+	assert.ElementsMatch(t, []chunkCount{{CID: 0, Count: 2}, {CID: 1, Count: 3}}, res.ChunkCounts)
+}
+
+func TestSNIconnPipelineMergeDuplicates(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	coll := ssn.DB(testTargetDB).C(testRes.Config.T.Structure.SNIConnTable)
+	for _, ts := range [][]int64{{10, 20}, {30, 40, 50}} {
+		assert.Nil(t, coll.Insert(bson.M{
+			"src":  "10.0.0.10",
+			"fqdn": "duplicate.example.com",
+			"dat": []bson.M{
+				{"cid": 0, "tls": bson.M{
+					"ts": ts, "bytes": make([]int64, len(ts)), "count": len(ts), "tbytes": 0,
+					"dst_ips": []bson.M{{"ip": "1.1.1.7", "network_uuid": "a", "network_name": "a"}},
+				}},
+			},
+		}))
+	}
+
+	matchKey := bson.M{"src": "10.0.0.10", "fqdn": "duplicate.example.com"}
+	pipeline := sniconnPipeline(matchKey, testRes.Config.T.BeaconSNI.SNIConnFieldsCfg, 1, "$ts", false)
+
+	var res sniconnDetails
+	assert.Nil(t, coll.Pipe(pipeline).One(&res))
+	assert.True(t, res.Count < 5, "only one document should be read without merging")
+
+	assert.Nil(t, coll.Pipe(mergeDuplicates(pipeline)).One(&res))
+	assert.Equal(t, int64(5), res.Count, "the connections of both documents should be counted")
+	assert.ElementsMatch(t, []int64{10, 20, 30, 40, 50}, res.TsFull)
+}
+
+func TestCountEligible(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	conf := *testRes.Config
+	conf.S.BeaconSNI.DefaultConnectionThresh = 20
+	chunk := conf.S.Rolling.CurrentChunk
+
+	coll := ssn.DB(testTargetDB).C(conf.T.Structure.SNIConnTable)
+	for _, sniconn := range []bson.M{
+		// eligible once the counts of both protocols are added up
+		{"src": "10.0.1.1", "fqdn": "eligible.example.com", "cid": chunk, "dat": []bson.M{
+			{"cid": chunk, "tls": bson.M{"count": 15}},
+			{"cid": chunk, "http": bson.M{"count": 10}},
+		}},
+		{"src": "10.0.1.2", "fqdn": "quiet.example.com", "cid": chunk, "dat": []bson.M{
+			{"cid": chunk, "tls": bson.M{"count": 5}},
+		}},
+		{"src": "10.0.1.3", "fqdn": "strobe.example.com", "cid": chunk, "dat": []bson.M{
+			{"cid": chunk, "tls": bson.M{"count": 100, "strobe": true}},
+		}},
+		{"src": "10.0.1.4", "fqdn": "stale.example.com", "cid": chunk + 1, "dat": []bson.M{
+			{"cid": chunk + 1, "tls": bson.M{"count": 100}},
+		}},
+	} {
+		assert.Nil(t, coll.Insert(sniconn))
+	}
+
+	count, err := CountEligible(testRes.DB, &conf)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+
+	conf.S.BeaconSNI.DefaultConnectionThresh = 1000
+	count, err = CountEligible(testRes.DB, &conf)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count, "no pairs should be eligible above the connection threshold")
+}
+
+func TestPurgeChunk(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	db := ssn.DB(testTargetDB)
+	beaconColl := db.C(testRes.Config.T.BeaconSNI.BeaconSNITable)
+	hostColl := db.C(testRes.Config.T.Structure.HostTable)
+
+	assert.Nil(t, beaconColl.Insert(
+		bson.M{"src": "10.0.2.1", "fqdn": "old.example.com", "cid": 7},
+		bson.M{"src": "10.0.2.1", "fqdn": "new.example.com", "cid": 8},
+	))
+	assert.Nil(t, hostColl.Insert(bson.M{"ip": "10.0.2.1", "dat": []bson.M{
+		{"cid": 7, "mbsni": "old.example.com"},
+		{"cid": 7, "mbproxy": "proxied.example.com"},
+		{"cid": 8, "mbsni": "new.example.com"},
+	}}))
+
+	assert.Nil(t, testRepo.PurgeChunk(7))
+
+	var beacons []bson.M
+	assert.Nil(t, beaconColl.Find(bson.M{"src": "10.0.2.1"}).All(&beacons))
+	assert.Len(t, beacons, 1)
+	assert.Equal(t, "new.example.com", beacons[0]["fqdn"], "beacons written by later chunks should be kept")
+
+	var host struct {
+		Dat []bson.M `bson:"dat"`
+	}
+	assert.Nil(t, hostColl.Find(bson.M{"ip": "10.0.2.1"}).One(&host))
+	assert.Len(t, host.Dat, 2, "only the chunk's SNI beacon summary should be pulled")
+}
+
+func TestCorrelateCertificates(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	db := ssn.DB(testTargetDB)
+	beaconColl := db.C(testRes.Config.T.BeaconSNI.BeaconSNITable)
+	certColl := db.C(testRes.Config.T.Cert.CertificateTable)
+
+	responder := func(ip string, uuid string) []bson.M {
+		return []bson.M{{"ip": ip, "network_uuid": uuid, "network_name": uuid}}
+	}
+	assert.Nil(t, beaconColl.Insert(
+		bson.M{"src": "10.0.3.1", "src_network_uuid": "a", "fqdn": "invalid.example.com", "responding_ips": responder("2.2.2.1", "a")},
+		bson.M{"src": "10.0.3.2", "src_network_uuid": "a", "fqdn": "invalid.example.com", "responding_ips": responder("2.2.2.1", "a")},
+		bson.M{"src": "10.0.3.1", "src_network_uuid": "a", "fqdn": "other.example.com", "responding_ips": responder("2.2.2.1", "b")},
+		bson.M{"src": "10.0.3.1", "src_network_uuid": "a", "fqdn": "mismatch.example.com", "responding_ips": responder("2.2.2.2", "a")},
+		bson.M{"src": "10.0.3.1", "src_network_uuid": "a", "fqdn": "stale.example.com", "invalid_cert": true},
+	))
+	assert.Nil(t, certColl.Insert(
+		bson.M{"ip": "2.2.2.1", "network_uuid": "a", "dat": []bson.M{
+			{"seen": 4, "orig_ips": []bson.M{{"ip": "10.0.3.1", "network_uuid": "a", "network_name": "a"}}},
+		}},
+		bson.M{"ip": "2.2.2.2", "network_uuid": "a", "dat": []bson.M{
+			{"seen": 0, "sni_mismatch": true, "orig_ips": []bson.M{{"ip": "10.0.3.1", "network_uuid": "a", "network_name": "a"}}},
+		}},
+	))
+
+	assert.Nil(t, testRepo.CorrelateCertificates())
+
+	var flagged []bson.M
+	assert.Nil(t, beaconColl.Find(bson.M{"src": bson.M{"$in": []string{"10.0.3.1", "10.0.3.2"}}, "invalid_cert": true}).All(&flagged))
+	assert.Len(t, flagged, 1, "only the source presented the invalid certificate by the responder should be flagged")
+	assert.Equal(t, "invalid.example.com", flagged[0]["fqdn"])
+	assert.Equal(t, "10.0.3.1", flagged[0]["src"])
+}
+
+func TestUpsertStream(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	conf := *testRes.Config
+	conf.S.BeaconSNI.ScoreOnly = true
+	conf.S.BeaconSNI.DefaultConnectionThresh = 10
+	chunk := conf.S.Rolling.CurrentChunk
+
+	var ts, bytes []int64
+	for i := int64(0); i < 24; i++ {
+		ts = append(ts, 1000+i*3600)
+		bytes = append(bytes, 100)
+	}
+	assert.Nil(t, ssn.DB(testTargetDB).C(conf.T.Structure.SNIConnTable).Insert(bson.M{
+		"src": "10.0.5.1", "fqdn": "streamed.example.com", "cid": chunk, "dat": []bson.M{
+			{"cid": chunk, "tls": bson.M{
+				"ts": ts, "bytes": bytes, "count": len(ts), "tbytes": 2400,
+				"dst_ips": []bson.M{{"ip": "1.1.1.5", "network_uuid": "a", "network_name": "a"}},
+			}},
+		},
+	}))
+
+	// the caller produces the pairs, closing the input once they're all sent
+	input := make(chan data.UniqueSrcFQDNPair)
+	go func() {
+		input <- data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "10.0.5.1"}, FQDN: "streamed.example.com"}
+		input <- data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "10.0.5.2"}, FQDN: "missing.example.com"}
+		close(input)
+	}()
+
+	repo := NewMongoRepository(testRes.DB, &conf, testRes.Log)
+	scores := repo.UpsertStream(input, nil, ts[0], ts[len(ts)-1])
+	assert.Len(t, scores, 1, "only the pair with SNIconn data should be scored")
+	assert.Equal(t, "streamed.example.com", scores[0].Hosts.FQDN)
+	assert.Equal(t, int64(len(ts)), scores[0].ConnectionCount)
+}
+
+func TestStalePairs(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	coll := ssn.DB(testTargetDB).C(testRes.Config.T.BeaconSNI.BeaconSNITable)
+	for _, beacon := range []bson.M{
+		{"src": "10.0.6.1", "fqdn": "current.example.com", "dat": bson.M{"analyzer_version": "v9.0.0", "scoring_model": "default"}},
+		{"src": "10.0.6.2", "fqdn": "old.example.com", "dat": bson.M{"analyzer_version": "v8.0.0", "scoring_model": "default"}},
+		{"src": "10.0.6.3", "fqdn": "model.example.com", "dat": bson.M{"analyzer_version": "v9.0.0", "scoring_model": "custom"}},
+		{"src": "10.0.6.4", "fqdn": "legacy.example.com"},
+	} {
+		assert.Nil(t, coll.Insert(beacon))
+	}
+
+	stale, err := testRepo.(*repo).stalePairs(Provenance{AnalyzerVersion: "v9.0.0", ScoringModel: "default"})
+	assert.Nil(t, err)
+
+	key := func(src, fqdn string) string {
+		return data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: src}, FQDN: fqdn}.MapKey()
+	}
+	assert.NotContains(t, stale, key("10.0.6.1", "current.example.com"))
+	assert.Contains(t, stale, key("10.0.6.2", "old.example.com"), "beacons from another version should be stale")
+	assert.Contains(t, stale, key("10.0.6.3", "model.example.com"), "beacons from another model should be stale")
+	assert.Contains(t, stale, key("10.0.6.4", "legacy.example.com"), "beacons without provenance should be stale")
+}
+
+func TestResultSuffix(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	// LoadConfig suffixes the collection names the same way
+	conf := *testRes.Config
+	conf.S.BeaconSNI.ResultSuffix = "experimental"
+	conf.T.BeaconSNI.BeaconSNITable += "_experimental"
+	suffixedRepo := NewMongoRepository(testRes.DB, &conf, testRes.Log)
+	assert.Nil(t, suffixedRepo.CreateIndexes())
+
+	names, err := ssn.DB(testTargetDB).CollectionNames()
+	assert.Nil(t, err)
+	assert.Contains(t, names, "beaconSNI_experimental")
+
+	// write a beacon through the analyzer and writer, as a run would
+	ts := []int64{0, 3600, 7200, 10800, 14400, 18000}
+	writer := newMgoBulkWriter(testRes.DB, &conf, testRes.Log, "beaconSNI")
+	analyzer := newAnalyzer(0, 18000, conf.S.Rolling.CurrentChunk, newDefaultModel(&conf, 0, 18000),
+		testRes.DB, &conf, testRes.Log, writer.collect, writer.close)
+	writer.start()
+	analyzer.start()
+	analyzer.collect(DissectorResults{
+		Hosts:           data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "10.0.4.1"}, FQDN: "experimental.example.com"},
+		ConnectionCount: int64(len(ts)),
+		TotalBytes:      600,
+		TsList:          ts,
+		TsListFull:      ts,
+		OrigBytesList:   []int64{100, 100, 100, 100, 100, 100},
+	})
+	assert.Nil(t, analyzer.close())
+
+	pair := bson.M{"src": "10.0.4.1", "fqdn": "experimental.example.com"}
+	count, err := ssn.DB(testTargetDB).C("beaconSNI_experimental").Find(pair).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count, "the beacon should be written to the suffixed collection")
+
+	count, err = ssn.DB(testTargetDB).C(testRes.Config.T.BeaconSNI.BeaconSNITable).Find(pair).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count, "the regular results should be left alone")
+
+	// the read side follows the suffix as well
+	summaries, err := suffixedRepo.TopBeacons(0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, summaries, 1)
+	assert.Equal(t, "experimental.example.com", summaries[0].FQDN)
+}
+
+// TestMain wraps all tests with the needed initialized mock DB and fixtures
+func TestMain(m *testing.M) {
+	// Store temporary databases files in a temporary directory
+	tempDir, _ := ioutil.TempDir("", "testing")
+	Server.SetPath(tempDir)
+
+	// Set the main session variable to the temporary MongoDB instance
+	testRes = resources.InitTestResources()
+	testRes.DB.SelectDB(testTargetDB)
+
+	testRepo = NewMongoRepository(testRes.DB, testRes.Config, testRes.Log)
+
+	// Run the test suite
+	retCode := m.Run()
+
+	// Shut down the temporary server and removes data on disk.
+	Server.Stop()
+
+	// call with result of m.Run()
+	os.Exit(retCode)
+}
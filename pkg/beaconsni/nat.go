@@ -0,0 +1,202 @@
+package beaconsni
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+type (
+	//natConn is a single connection read by the SNIconn pipeline when BeaconSNI.NATClientField
+	//or BeaconSNI.SensorField is set. Timestamps are read as stored, so they may hold fractions
+	//of a second. Sensor is only read when clock offsets are configured.
+	natConn struct {
+		Ts     float64 `bson:"ts"`
+		Bytes  int64   `bson:"bytes"`
+		Client string  `bson:"client"`
+		Sensor string  `bson:"sensor"`
+	}
+
+	//natClient holds the connections a single client behind a NAT address made to an SNI
+	natClient struct {
+		id     string
+		ts     []int64 // unique timestamps
+		tsFull []int64
+		bytes  []int64
+	}
+)
+
+//addNATConns reads every connection of the SNIconn document with its timestamp, data size, and
+//client identifier into nat_conns. The identifier is taken from the field of each http and tls
+//entry at the given path, which lists one identifier for every timestamp in the entry, just like
+//bytes. Connections without an identifier get a null client. When sensorField is set, the sensor
+//which recorded each connection is read the same way. Like the chunk counts, the connections
+//are read from the default SNIconn schema. The stage goes in right after the $match and $limit
+//stages selecting the document, ahead of any analysis window.
+func addNATConns(pipeline []bson.M, field string, sensorField string) []bson.M {
+	fields := map[string]string{"client": field}
+	if sensorField != "" {
+		fields["sensor"] = sensorField
+	}
+	return addConnList(pipeline, "nat_conns", fields)
+}
+
+//addConnList reads every connection of the SNIconn document into the list with the given name.
+//Each connection holds its timestamp and data size, along with a string for each of the given
+//fields, which map a key to the path of a field in each http and tls entry listing one value
+//for every timestamp. The list is carried through the rest of the pipeline.
+func addConnList(pipeline []bson.M, name string, fields map[string]string) []bson.M {
+	elemAt := func(array string) bson.M {
+		return bson.M{"$arrayElemAt": []interface{}{bson.M{"$ifNull": []interface{}{array, []interface{}{}}}, "$$i"}}
+	}
+
+	// entryConns lists the connections of the http or tls entry of a chunk
+	entryConns := func(entry string) bson.M {
+		conn := bson.M{
+			"ts":    elemAt(entry + ".ts"),
+			"bytes": elemAt(entry + ".bytes"),
+		}
+		for key, path := range fields {
+			conn[key] = bson.M{"$toString": elemAt(entry + "." + path)}
+		}
+		return bson.M{"$map": bson.M{
+			"input": bson.M{"$range": []interface{}{0, bson.M{"$size": bson.M{"$ifNull": []interface{}{entry + ".ts", []interface{}{}}}}}},
+			"as":    "i",
+			"in":    conn,
+		}}
+	}
+
+	conns := bson.M{"$addFields": bson.M{
+		name: bson.M{"$reduce": bson.M{
+			"input":        bson.M{"$ifNull": []interface{}{"$dat", []interface{}{}}},
+			"initialValue": []interface{}{},
+			"in": bson.M{"$concatArrays": []interface{}{
+				"$$value", entryConns("$$this.http"), entryConns("$$this.tls"),
+			}},
+		}},
+	}}
+
+	// carry the connections through the rest of the pipeline
+	for _, stage := range pipeline {
+		if project, ok := stage["$project"].(bson.M); ok {
+			project[name] = 1
+		}
+		if group, ok := stage["$group"].(bson.M); ok {
+			group[name] = bson.M{"$first": "$" + name}
+		}
+	}
+
+	withConns := make([]bson.M, 0, len(pipeline)+1)
+	withConns = append(withConns, pipeline[:2]...)
+	withConns = append(withConns, conns)
+	return append(withConns, pipeline[2:]...)
+}
+
+//natClients groups the connections of a pair by client using the analysis window and timestamp
+//resolution in the config. The clocks of the sensors are corrected first. nil is returned if no
+//connection carried a client identifier, in which case the pair is analyzed as a whole.
+func (d *dissector) natClients(datum data.UniqueSrcFQDNPair, conns []natConn) []natClient {
+	if d.conf.S.BeaconSNI.NATClientField == "" {
+		return nil
+	}
+	correctClocks(conns, d.conf.R.BeaconSNI.SensorOffsets)
+	return groupNATClients(
+		conns, datum.SrcIP, d.conf.S.Filtering.AnalysisStart, d.conf.S.Filtering.AnalysisEnd,
+		d.conf.S.BeaconSNI.TimestampResolution == config.MillisecondResolution,
+	)
+}
+
+//groupNATClients groups the given connections by client. Connections without a client
+//identifier fall back to srcIP, the NAT address itself. Connections outside of the window
+//from start to end, inclusive, are left out, and a bound of 0 leaves that end open. The
+//timestamps are truncated to whole seconds, or milliseconds if millis is set. The clients
+//are ordered by identifier. nil is returned if none of the connections had an identifier.
+func groupNATClients(conns []natConn, srcIP string, start int64, end int64, millis bool) []natClient {
+	byClient := make(map[string]*natClient)
+	identified := false
+
+	for _, conn := range conns {
+		if (start > 0 && conn.Ts < float64(start)) || (end > 0 && conn.Ts > float64(end)) {
+			continue
+		}
+
+		id := conn.Client
+		if id == "" || id == "-" {
+			id = srcIP
+		} else {
+			identified = true
+		}
+
+		client, ok := byClient[id]
+		if !ok {
+			client = &natClient{id: id}
+			byClient[id] = client
+		}
+
+		ts := int64(conn.Ts)
+		if millis {
+			ts = int64(conn.Ts * 1000)
+		}
+		client.tsFull = append(client.tsFull, ts)
+		client.bytes = append(client.bytes, conn.Bytes)
+	}
+
+	if !identified {
+		return nil
+	}
+
+	clients := make([]natClient, 0, len(byClient))
+	for _, client := range byClient {
+		seen := make(map[int64]bool, len(client.tsFull))
+		for _, ts := range client.tsFull {
+			if !seen[ts] {
+				seen[ts] = true
+				client.ts = append(client.ts, ts)
+			}
+		}
+		clients = append(clients, *client)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].id < clients[j].id })
+	return clients
+}
+
+//dissectNATClients analyzes the connections of each client behind a NAT address on its own.
+//Each client takes the place of the source IP in the pair, keeping the NAT address's network,
+//and must make more than connThresh connections on its own. The pair's total bytes are split
+//between the clients by their share of the connections, since they aren't recorded per connection.
+func (d *dissector) dissectNATClients(ssn *mgo.Session, analysisInput DissectorResults, clients []natClient, connThresh int) {
+	var total int64
+	for _, client := range clients {
+		total += int64(len(client.tsFull))
+	}
+
+	for _, client := range clients {
+		clientInput := analysisInput
+		clientInput.Hosts.SrcIP = client.id
+		if client.id != analysisInput.Hosts.SrcIP {
+			clientInput.NATSrcIP = analysisInput.Hosts.SrcIP
+		}
+		if d.checkpoint != nil {
+			d.checkpoint.alias(clientInput.Hosts, analysisInput.Hosts)
+		}
+		clientInput.ConnectionCount = int64(len(client.tsFull))
+
+		if clientInput.ConnectionCount <= int64(connThresh) {
+			atomic.AddInt64(&d.summary.Dropped, 1)
+			if d.auditing() {
+				d.skip(clientInput.Hosts, BelowThreshold, clientInput.ConnectionCount)
+			}
+			continue
+		}
+
+		clientInput.TotalBytes = analysisInput.TotalBytes * clientInput.ConnectionCount / total
+		clientInput.TsList = client.ts
+		clientInput.TsListFull = client.tsFull
+		clientInput.OrigBytesList = client.bytes
+		d.dissectBeacon(ssn, clientInput)
+	}
+}
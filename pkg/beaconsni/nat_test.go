@@ -0,0 +1,61 @@
+package beaconsni
+
+import (
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupNATClients(t *testing.T) {
+	conns := []natConn{
+		{Ts: 100, Bytes: 10, Client: "10.0.0.5"},
+		{Ts: 160, Bytes: 20, Client: "10.0.0.6"},
+		{Ts: 200, Bytes: 11, Client: "10.0.0.5"},
+		{Ts: 200, Bytes: 12, Client: "10.0.0.5"},
+		{Ts: 250, Bytes: 30},
+		{Ts: 300, Bytes: 31, Client: "-"},
+	}
+
+	clients := groupNATClients(conns, "203.0.113.1", 0, 0, false)
+	require.Len(t, clients, 3)
+
+	assert.Equal(t, "10.0.0.5", clients[0].id)
+	assert.Equal(t, []int64{100, 200}, clients[0].ts, "duplicate timestamps should only be listed once")
+	assert.Equal(t, []int64{100, 200, 200}, clients[0].tsFull)
+	assert.Equal(t, []int64{10, 11, 12}, clients[0].bytes)
+
+	assert.Equal(t, "10.0.0.6", clients[1].id)
+
+	assert.Equal(t, "203.0.113.1", clients[2].id, "connections without a client should fall back to the source IP")
+	assert.Equal(t, []int64{250, 300}, clients[2].tsFull)
+
+	windowed := groupNATClients(conns, "203.0.113.1", 150, 250, false)
+	require.Len(t, windowed, 3)
+	assert.Equal(t, []int64{200, 200}, windowed[0].tsFull, "connections outside of the window should be left out")
+	assert.Equal(t, []int64{250}, windowed[2].tsFull)
+
+	millis := groupNATClients([]natConn{{Ts: 100.25, Client: "10.0.0.5"}}, "203.0.113.1", 0, 0, true)
+	assert.Equal(t, []int64{100250}, millis[0].tsFull)
+
+	assert.Nil(t, groupNATClients([]natConn{{Ts: 100}, {Ts: 200, Client: "-"}}, "203.0.113.1", 0, 0, false),
+		"pairs without any identified clients should be analyzed as a whole")
+}
+
+func TestAddNATConns(t *testing.T) {
+	pipeline := []bson.M{
+		{"$match": bson.M{"src": "203.0.113.1"}},
+		{"$limit": 1},
+		{"$project": bson.M{"ts": 1}},
+		{"$group": bson.M{"_id": "$_id", "ts": bson.M{"$first": "$ts"}}},
+	}
+
+	pipeline = addNATConns(pipeline, "nat.clients", "")
+	require.Len(t, pipeline, 5)
+
+	_, ok := pipeline[2]["$addFields"]
+	assert.True(t, ok, "the connections should be read right after the document is selected")
+	assert.Equal(t, 1, pipeline[3]["$project"].(bson.M)["nat_conns"])
+	assert.Equal(t, bson.M{"$first": "$nat_conns"}, pipeline[4]["$group"].(bson.M)["nat_conns"])
+}
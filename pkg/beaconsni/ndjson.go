@@ -0,0 +1,94 @@
+package beaconsni
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/google/uuid"
+)
+
+//ndjsonWriter writes documents as newline delimited JSON, one document per line
+type ndjsonWriter struct {
+	w       *bufio.Writer
+	encoder *json.Encoder
+}
+
+//StreamNDJSON writes every document in the beaconSNI collection to w as a single line of JSON.
+//Each line holds the whole document except for its MongoDB _id. The documents are read with
+//a cursor and written out one at a time, so large collections are never held in memory.
+func (r *repo) StreamNDJSON(w io.Writer) error {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	iter := session.DB(r.database.GetSelectedDB()).C(r.config.T.BeaconSNI.BeaconSNITable).
+		Find(nil).
+		Select(bson.M{"_id": 0}).
+		Iter()
+
+	out := newNDJSONWriter(w)
+
+	var doc bson.M
+	for iter.Next(&doc) {
+		if err := out.write(doc); err != nil {
+			iter.Close()
+			return err
+		}
+		// a fresh map keeps fields from the previous document out of the next one
+		doc = nil
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+
+	return out.flush()
+}
+
+//newNDJSONWriter creates an ndjsonWriter which buffers its output to w
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	buffered := bufio.NewWriter(w)
+	return &ndjsonWriter{w: buffered, encoder: json.NewEncoder(buffered)}
+}
+
+//write encodes the document on its own line. The encoder never indents
+//its output and ends every value with a newline.
+func (n *ndjsonWriter) write(doc bson.M) error {
+	return n.encoder.Encode(toJSONValue(doc))
+}
+
+//flush writes out any buffered lines
+func (n *ndjsonWriter) flush() error {
+	return n.w.Flush()
+}
+
+//toJSONValue converts the BSON specific types in a decoded document to values which
+//marshal to readable JSON. Object ids become their hex string, and UUIDs such as network
+//UUIDs become their canonical string. Other binary data is left to encode as base64.
+func toJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.M:
+		converted := make(map[string]interface{}, len(v))
+		for key, field := range v {
+			converted[key] = toJSONValue(field)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, elem := range v {
+			converted[i] = toJSONValue(elem)
+		}
+		return converted
+	case bson.ObjectId:
+		return v.Hex()
+	case bson.Binary:
+		if v.Kind == bson.BinaryUUID {
+			if id, err := uuid.FromBytes(v.Data); err == nil {
+				return id.String()
+			}
+		}
+		return v.Data
+	default:
+		return v
+	}
+}
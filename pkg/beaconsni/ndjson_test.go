@@ -0,0 +1,55 @@
+package beaconsni
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo/bson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNDJSONWriter(t *testing.T) {
+	docs := []bson.M{
+		{
+			"src":              "10.0.0.1",
+			"src_network_uuid": util.UnknownPrivateNetworkUUID,
+			"fqdn":             "a.example.com",
+			"score":            0.95,
+			"ts":               bson.M{"mode": int64(60), "intervals": []interface{}{int64(59), int64(60)}},
+			"responding_ips": []interface{}{
+				bson.M{"ip": "1.1.1.1", "network_uuid": util.PublicNetworkUUID, "network_name": util.PublicNetworkName},
+			},
+		},
+		{"src": "10.0.0.2", "fqdn": "b.example.com\nwith a newline", "score": 0.5},
+		{"ref": bson.ObjectIdHex("5f0c1e8a9d3b4a2e1c0d4f6a")},
+	}
+
+	var buf bytes.Buffer
+	out := newNDJSONWriter(&buf)
+	for _, doc := range docs {
+		require.Nil(t, out.write(doc))
+	}
+	require.Nil(t, out.flush())
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, len(docs), "each document should be written on its own line")
+
+	parsed := make([]map[string]interface{}, len(lines))
+	for i, line := range lines {
+		require.Nil(t, json.Unmarshal([]byte(line), &parsed[i]), "every line should be valid JSON")
+	}
+
+	assert.Equal(t, "10.0.0.1", parsed[0]["src"])
+	assert.Equal(t, "ffffffff-ffff-ffff-ffff-fffffffffffe", parsed[0]["src_network_uuid"], "network UUIDs should be written as strings")
+	assert.Equal(t, []interface{}{float64(59), float64(60)}, parsed[0]["ts"].(map[string]interface{})["intervals"])
+	responder := parsed[0]["responding_ips"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "1.1.1.1", responder["ip"])
+	assert.Equal(t, util.PublicNetworkName, responder["network_name"])
+
+	assert.Equal(t, "b.example.com\nwith a newline", parsed[1]["fqdn"], "newlines in values should be escaped")
+	assert.Equal(t, "5f0c1e8a9d3b4a2e1c0d4f6a", parsed[2]["ref"])
+}
@@ -0,0 +1,145 @@
+package beaconsni
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+//periodicityFeature scores how strongly the connections repeat with a single period, as found
+//by a periodogram. The default model only uses it when BeaconSNI.Periodogram is enabled.
+const periodicityFeature = "ts_periodicity"
+
+//periodogramMinBins is the fewest bins a periodogram is computed over. Shorter series
+//can't show a repeating pattern.
+const periodogramMinBins = 8
+
+//dominantPeriod bins the connections in tsFull and returns the strongest period in their
+//periodogram in seconds, along with its significance. When millis is set, tsFull is in
+//milliseconds while binSeconds stays in seconds.
+func dominantPeriod(tsFull []int64, binSeconds int, maxBins int, millis bool) (float64, float64) {
+	scale := int64(1)
+	if millis {
+		scale = 1000
+	}
+
+	bins, binWidth := binConnections(tsFull, int64(binSeconds)*scale, maxBins)
+	period, significance := periodogram(bins)
+	return period * float64(binWidth) / float64(scale), significance
+}
+
+//binConnections counts the connections in tsFull falling into consecutive bins of binWidth,
+//starting from the earliest timestamp. If that would take more than maxBins bins, the width is
+//widened until the series fits. The counts are returned along with the width used.
+func binConnections(tsFull []int64, binWidth int64, maxBins int) ([]float64, int64) {
+	if len(tsFull) == 0 || binWidth <= 0 {
+		return nil, binWidth
+	}
+
+	min, max := tsFull[0], tsFull[0]
+	for _, ts := range tsFull {
+		if ts < min {
+			min = ts
+		}
+		if ts > max {
+			max = ts
+		}
+	}
+
+	span := max - min + 1
+	if maxBins > 0 && span > binWidth*int64(maxBins) {
+		binWidth = (span + int64(maxBins) - 1) / int64(maxBins)
+	}
+
+	bins := make([]float64, (span+binWidth-1)/binWidth)
+	for _, ts := range tsFull {
+		bins[(ts-min)/binWidth]++
+	}
+	return bins, binWidth
+}
+
+//periodogram finds the strongest frequency in the binned connection counts. The counts are
+//centered on their mean, zero padded to a power of two, and transformed with an FFT. The power
+//of each frequency is normalized by the variance of the counts, and the strongest frequency
+//below the Nyquist frequency is returned as its period in bins along with its significance.
+//The significance is 1 minus the false alarm probability of a peak this strong arising from
+//noise across every frequency examined, so it is near 1 for a clear period and spread evenly
+//between 0 and 1 for random connections. Series shorter than periodogramMinBins, or without
+//any variance, have no period.
+func periodogram(bins []float64) (float64, float64) {
+	n := len(bins)
+	if n < periodogramMinBins {
+		return 0, 0
+	}
+
+	mean := 0.0
+	for _, count := range bins {
+		mean += count
+	}
+	mean /= float64(n)
+
+	size := 1
+	for size < n {
+		size <<= 1
+	}
+	series := make([]complex128, size)
+	variance := 0.0
+	for i, count := range bins {
+		series[i] = complex(count-mean, 0)
+		variance += (count - mean) * (count - mean)
+	}
+	variance /= float64(n)
+	if variance == 0 {
+		return 0, 0
+	}
+
+	fft(series)
+
+	// frequency 0 only holds the mean, which was removed
+	peak, peakPower := 0, 0.0
+	frequencies := size/2 - 1
+	for k := 1; k <= frequencies; k++ {
+		power := cmplx.Abs(series[k]) * cmplx.Abs(series[k]) / (float64(n) * variance)
+		if power > peakPower {
+			peak, peakPower = k, power
+		}
+	}
+	if peak == 0 {
+		return 0, 0
+	}
+
+	// Scargle's false alarm probability for the highest of several exponentially distributed powers
+	falseAlarm := 1 - math.Pow(1-math.Exp(-peakPower), float64(frequencies))
+	return float64(size) / float64(peak), math.Max(0, math.Min(1, 1-falseAlarm))
+}
+
+//fft replaces the values, whose length must be a power of two, with their discrete
+//Fourier transform using the iterative radix-2 Cooley-Tukey algorithm
+func fft(values []complex128) {
+	n := len(values)
+
+	// reorder the values by the bit reversal of their index
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			values[i], values[j] = values[j], values[i]
+		}
+	}
+
+	for length := 2; length <= n; length <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(length)))
+		for start := 0; start < n; start += length {
+			twiddle := complex(1, 0)
+			for k := 0; k < length/2; k++ {
+				even := values[start+k]
+				odd := values[start+k+length/2] * twiddle
+				values[start+k] = even + odd
+				values[start+k+length/2] = even - odd
+				twiddle *= step
+			}
+		}
+	}
+}
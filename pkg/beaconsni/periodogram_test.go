@@ -0,0 +1,60 @@
+package beaconsni
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinConnections(t *testing.T) {
+	bins, width := binConnections([]int64{100, 105, 130, 161}, 30, 0)
+	assert.Equal(t, int64(30), width)
+	assert.Equal(t, []float64{2, 1, 1}, bins)
+
+	// a day of 1 second bins doesn't fit in 100 bins, so the width is widened
+	bins, width = binConnections([]int64{0, 86399}, 1, 100)
+	assert.Equal(t, int64(864), width)
+	assert.Len(t, bins, 100)
+
+	bins, _ = binConnections(nil, 60, 100)
+	assert.Nil(t, bins)
+}
+
+func TestFFT(t *testing.T) {
+	values := []complex128{1, 2, 3, 4, 0, 0, 0, 0}
+	fft(values)
+	assert.InDelta(t, 10, real(values[0]), 1e-9)
+	assert.InDelta(t, -2, real(values[2]), 1e-9)
+	assert.InDelta(t, 2, imag(values[2]), 1e-9)
+	assert.InDelta(t, -2, real(values[4]), 1e-9)
+}
+
+func TestPeriodogram(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	// hourly check ins jittered by up to a minute either way
+	var jittery []int64
+	for i := int64(0); i < 24; i++ {
+		jittery = append(jittery, i*3600+rng.Int63n(120))
+	}
+	bins, width := binConnections(jittery, 60, 4096)
+	period, significance := periodogram(bins)
+	assert.InDelta(t, 3600, period*float64(width), 120, "the dominant period should be an hour")
+	assert.True(t, significance > 0.99, "a jittery beacon should still be clearly periodic")
+
+	var random []int64
+	for i := 0; i < 24; i++ {
+		random = append(random, rng.Int63n(86400))
+	}
+	bins, _ = binConnections(random, 60, 4096)
+	_, significance = periodogram(bins)
+	assert.True(t, significance < 0.99, "random connections should not be clearly periodic")
+
+	period, significance = periodogram([]float64{1, 1, 1, 1, 1, 1, 1, 1})
+	assert.Equal(t, 0.0, period, "a series without variance has no period")
+	assert.Equal(t, 0.0, significance)
+
+	period, _ = periodogram([]float64{1, 0, 1})
+	assert.Equal(t, 0.0, period, "a short series has no period")
+}
@@ -0,0 +1,45 @@
+package beaconsni
+
+import "sort"
+
+//progressionMinSteps is the fewest steps between unique data sizes needed to call the sizes
+//a progression. Two sizes always differ by a single constant step.
+const progressionMinSteps = 2
+
+//sizeProgression returns the unique data sizes in bytes in ascending order, the steps between
+//each size and the next, and how constant those steps are. The constancy is the share of the
+//steps equal to the most common step. Sizes which climb by a fixed step, as when C2 encodes
+//data in its payload sizes, score 1, while natural traffic has uneven steps and scores lower.
+//0 is returned if there are fewer than progressionMinSteps steps. bytes is left untouched.
+func sizeProgression(bytes []int64) ([]int64, []int64, float64) {
+	if len(bytes) == 0 {
+		return nil, nil, 0
+	}
+
+	sorted := make([]int64, len(bytes))
+	copy(sorted, bytes)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	sizes := sorted[:1]
+	for _, size := range sorted[1:] {
+		if size != sizes[len(sizes)-1] {
+			sizes = append(sizes, size)
+		}
+	}
+
+	steps := make([]int64, len(sizes)-1)
+	stepCounts := make(map[int64]int)
+	mostCommon := 0
+	for i := range steps {
+		steps[i] = sizes[i+1] - sizes[i]
+		stepCounts[steps[i]]++
+		if stepCounts[steps[i]] > mostCommon {
+			mostCommon = stepCounts[steps[i]]
+		}
+	}
+
+	if len(steps) < progressionMinSteps {
+		return sizes, steps, 0
+	}
+	return sizes, steps, float64(mostCommon) / float64(len(steps))
+}
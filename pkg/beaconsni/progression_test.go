@@ -0,0 +1,41 @@
+package beaconsni
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSizeProgression(t *testing.T) {
+	bytes := []int64{148, 100, 132, 116, 100, 132}
+
+	sizes, steps, progression := sizeProgression(bytes)
+	assert.Equal(t, []int64{100, 116, 132, 148}, sizes)
+	assert.Equal(t, []int64{16, 16, 16}, steps)
+	assert.Equal(t, 1.0, progression)
+	assert.Equal(t, []int64{148, 100, 132, 116, 100, 132}, bytes, "the data sizes should not be reordered")
+
+	// a single missing size leaves most of the steps equal
+	_, steps, progression = sizeProgression([]int64{100, 116, 148, 164, 180})
+	assert.Equal(t, []int64{16, 32, 16, 16}, steps)
+	assert.Equal(t, 0.75, progression)
+
+	_, _, progression = sizeProgression([]int64{120, 517, 96, 1402, 233})
+	assert.Equal(t, 0.25, progression, "natural sizes should not share steps")
+}
+
+func TestSizeProgressionFewSizes(t *testing.T) {
+	sizes, steps, progression := sizeProgression([]int64{100, 100, 100})
+	assert.Equal(t, []int64{100}, sizes)
+	assert.Empty(t, steps)
+	assert.Equal(t, 0.0, progression)
+
+	_, steps, progression = sizeProgression([]int64{100, 200})
+	assert.Equal(t, []int64{100}, steps)
+	assert.Equal(t, 0.0, progression, "a single step can't show a pattern")
+
+	sizes, steps, progression = sizeProgression(nil)
+	assert.Nil(t, sizes)
+	assert.Nil(t, steps)
+	assert.Equal(t, 0.0, progression)
+}
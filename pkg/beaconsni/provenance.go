@@ -0,0 +1,90 @@
+package beaconsni
+
+import (
+	"sort"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/globalsign/mgo/bson"
+	log "github.com/sirupsen/logrus"
+)
+
+//Provenance identifies what scored a beacon. Beacons scored by different RITA versions or
+//scoring models can't be ranked against one another. Beacons stored before provenance was
+//recorded have an empty Provenance.
+type Provenance struct {
+	AnalyzerVersion string `bson:"analyzer_version"` // RITA version which scored the beacon
+	ScoringModel    string `bson:"scoring_model"`    // name of the scoring model which scored the beacon
+}
+
+//ResultProvenances returns the distinct provenances of the given results, ordered by
+//version and then by scoring model. More than one means the results were scored inconsistently.
+func ResultProvenances(results []Result) []Provenance {
+	seen := make(map[Provenance]struct{})
+	var provenances []Provenance
+	for _, result := range results {
+		if _, ok := seen[result.Provenance]; ok {
+			continue
+		}
+		seen[result.Provenance] = struct{}{}
+		provenances = append(provenances, result.Provenance)
+	}
+
+	sort.Slice(provenances, func(i, j int) bool {
+		if provenances[i].AnalyzerVersion != provenances[j].AnalyzerVersion {
+			return provenances[i].AnalyzerVersion < provenances[j].AnalyzerVersion
+		}
+		return provenances[i].ScoringModel < provenances[j].ScoringModel
+	})
+	return provenances
+}
+
+//runModel creates the scoring model for a run over the connections made between minTimestamp
+//and maxTimestamp, along with the provenance recorded with every beacon it scores. An unknown
+//BeaconSNI.ScoringModel falls back to the default model rather than skipping the analysis.
+func (r *repo) runModel(minTimestamp, maxTimestamp int64) (ScoringModel, Provenance) {
+	name := r.config.S.BeaconSNI.ScoringModel
+	model, ok := newScoringModel(name, r.config, minTimestamp, maxTimestamp)
+	if !ok {
+		r.log.WithFields(log.Fields{
+			"Module": "beaconSNI",
+			"Model":  name,
+		}).Error("unknown SNI beacon scoring model, using the default model")
+		name = DefaultScoringModel
+		model = newDefaultModel(r.config, minTimestamp, maxTimestamp)
+	}
+	return model, Provenance{AnalyzerVersion: r.config.S.Version, ScoringModel: name}
+}
+
+//currentProvenance returns the provenance runModel records for the current configuration
+func (r *repo) currentProvenance() Provenance {
+	name := r.config.S.BeaconSNI.ScoringModel
+	scoringModelsMu.RLock()
+	_, ok := scoringModels[name]
+	scoringModelsMu.RUnlock()
+	if !ok {
+		name = DefaultScoringModel
+	}
+	return Provenance{AnalyzerVersion: r.config.S.Version, ScoringModel: name}
+}
+
+//stalePairs returns the map keys of the stored beacons which weren't scored with the given
+//provenance, including beacons stored before provenance was recorded
+func (r *repo) stalePairs(current Provenance) (map[string]struct{}, error) {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	var pair data.UniqueSrcFQDNPair
+
+	stale := make(map[string]struct{})
+	iter := session.DB(r.database.GetSelectedDB()).C(r.config.T.BeaconSNI.BeaconSNITable).
+		Find(bson.M{"$or": []bson.M{
+			{"dat.analyzer_version": bson.M{"$ne": current.AnalyzerVersion}},
+			{"dat.scoring_model": bson.M{"$ne": current.ScoringModel}},
+		}}).
+		Select(bson.M{"src": 1, "src_network_uuid": 1, "fqdn": 1}).Iter()
+	for iter.Next(&pair) {
+		stale[pair.MapKey()] = struct{}{}
+	}
+
+	return stale, iter.Close()
+}
@@ -0,0 +1,26 @@
+package beaconsni
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultProvenances(t *testing.T) {
+	current := Provenance{AnalyzerVersion: "v4.1.0", ScoringModel: DefaultScoringModel}
+	results := []Result{
+		{Provenance: current},
+		{Provenance: Provenance{AnalyzerVersion: "v4.0.0", ScoringModel: DefaultScoringModel}},
+		{Provenance: current},
+		{}, // stored before provenance was recorded
+	}
+
+	assert.Equal(t, []Provenance{
+		{},
+		{AnalyzerVersion: "v4.0.0", ScoringModel: DefaultScoringModel},
+		current,
+	}, ResultProvenances(results))
+
+	assert.Equal(t, []Provenance{current}, ResultProvenances(results[:1]), "consistent results should have a single provenance")
+	assert.Len(t, ResultProvenances(nil), 0)
+}
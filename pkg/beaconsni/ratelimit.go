@@ -0,0 +1,159 @@
+package beaconsni
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/activecm/rita/pkg/data"
+	log "github.com/sirupsen/logrus"
+)
+
+//overflowFQDNs is the most SNIs listed in the summary of the findings held back for a source
+const overflowFQDNs = 10
+
+type (
+	//sourceLimitedSink passes at most limit findings from each source IP on to sink, so a
+	//compromised subnet can't flood an alerting endpoint. The findings held back once a
+	//source reaches the limit are summarized, and the summaries are sent when the sink is
+	//closed. Findings are passed on in the order they are scored, so a source's first
+	//findings are sent rather than its highest scoring ones.
+	sourceLimitedSink struct {
+		sink     ResultSink
+		name     string  // name of the sink in log messages
+		limit    int     // findings passed on per source
+		minScore float64 // findings scoring below this are left to the sink to skip, and aren't counted
+		log      *log.Logger
+		mu       sync.Mutex
+		passed   map[string]int             // findings passed on so far, by source
+		held     map[string]*sourceOverflow // findings held back so far, by source
+	}
+
+	//sourceOverflow gathers the findings held back for a single source
+	sourceOverflow struct {
+		summary  Finding   // summary sent in place of the findings
+		findings []Finding // findings held back, which the summarized SNIs are picked from
+	}
+)
+
+//limitPerSource wraps sink so it receives at most limit findings from each source, along with
+//a summary of the rest. sink is returned as it is if limit is 0.
+func limitPerSource(sink ResultSink, name string, limit int, minScore float64, logger *log.Logger) ResultSink {
+	if limit <= 0 {
+		return sink
+	}
+	return &sourceLimitedSink{
+		sink:     sink,
+		name:     name,
+		limit:    limit,
+		minScore: minScore,
+		log:      logger,
+		passed:   make(map[string]int),
+		held:     make(map[string]*sourceOverflow),
+	}
+}
+
+//Emit passes the finding on to the sink, unless its source already reached the limit, in which
+//case the finding is added to the source's summary
+func (s *sourceLimitedSink) Emit(finding Finding) {
+	if finding.Score < s.minScore {
+		s.sink.Emit(finding)
+		return
+	}
+
+	key := finding.Hosts.UniqueSrcIP.Unpair().MapKey()
+
+	s.mu.Lock()
+	if s.passed[key] < s.limit {
+		s.passed[key]++
+		s.mu.Unlock()
+		s.sink.Emit(finding)
+		return
+	}
+
+	overflow, ok := s.held[key]
+	if !ok {
+		overflow = &sourceOverflow{summary: Finding{
+			Hosts:    data.UniqueSrcFQDNPair{UniqueSrcIP: finding.Hosts.UniqueSrcIP},
+			Overflow: &OverflowSummary{},
+		}}
+		s.held[key] = overflow
+	}
+	overflow.add(finding)
+	s.mu.Unlock()
+}
+
+//Close sends the summary of every source which reached the limit, highest scoring first, and
+//then closes the sink
+func (s *sourceLimitedSink) Close() error {
+	s.mu.Lock()
+	summaries := make([]Finding, 0, len(s.held))
+	var suppressed int
+	for _, overflow := range s.held {
+		summaries = append(summaries, overflow.build())
+		suppressed += overflow.summary.Overflow.Suppressed
+	}
+	s.mu.Unlock()
+
+	sort.SliceStable(summaries, func(i, j int) bool {
+		if summaries[i].Score != summaries[j].Score {
+			return summaries[i].Score > summaries[j].Score
+		}
+		return summaries[i].Hosts.SrcIP < summaries[j].Hosts.SrcIP
+	})
+	for _, summary := range summaries {
+		s.sink.Emit(summary)
+	}
+
+	if len(summaries) > 0 {
+		s.log.WithFields(log.Fields{
+			"Module":     "beaconSNI",
+			"Sink":       s.name,
+			"Sources":    len(summaries),
+			"Suppressed": suppressed,
+		}).Info("summarized SNI beacon findings from sources over the alert limit")
+	}
+	return s.sink.Close()
+}
+
+//add folds a held back finding into the summary. The summary keeps the highest score, the
+//total connection count, and the earliest and latest connections of the findings.
+func (o *sourceOverflow) add(finding Finding) {
+	summary := &o.summary
+	if summary.Overflow.Suppressed == 0 || finding.Score > summary.Score {
+		summary.Score = finding.Score
+	}
+	summary.Overflow.Suppressed++
+	summary.ConnectionCount += finding.ConnectionCount
+
+	if !finding.FirstSeen.IsZero() {
+		if summary.FirstSeen.IsZero() || finding.FirstSeen.Before(summary.FirstSeen) {
+			summary.FirstSeen = finding.FirstSeen
+		}
+		if finding.LastSeen.After(summary.LastSeen) {
+			summary.LastSeen = finding.LastSeen
+		}
+	}
+	o.findings = append(o.findings, finding)
+}
+
+//build completes the summary by listing the SNIs of the highest scoring findings held back
+func (o *sourceOverflow) build() Finding {
+	sort.SliceStable(o.findings, func(i, j int) bool {
+		if o.findings[i].Score != o.findings[j].Score {
+			return o.findings[i].Score > o.findings[j].Score
+		}
+		return o.findings[i].Hosts.FQDN < o.findings[j].Hosts.FQDN
+	})
+
+	fqdns := make([]string, 0, overflowFQDNs)
+	for _, finding := range o.findings {
+		if len(fqdns) == overflowFQDNs {
+			break
+		}
+		fqdns = append(fqdns, finding.Hosts.FQDN)
+	}
+
+	summary := o.summary
+	summary.Overflow = &OverflowSummary{Suppressed: o.summary.Overflow.Suppressed, FQDNs: fqdns}
+	return summary
+}
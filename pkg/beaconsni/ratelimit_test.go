@@ -0,0 +1,80 @@
+package beaconsni
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/pkg/data"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//recordingSink keeps the findings it receives
+type recordingSink struct {
+	findings []Finding
+	closed   bool
+}
+
+func (r *recordingSink) Emit(finding Finding) { r.findings = append(r.findings, finding) }
+
+func (r *recordingSink) Close() error {
+	r.closed = true
+	return nil
+}
+
+func newTestLimitedSink(sink ResultSink, limit int, minScore float64) ResultSink {
+	logger := log.New()
+	logger.Out = ioutil.Discard
+	return limitPerSource(sink, "test", limit, minScore, logger)
+}
+
+func sourceFinding(src string, fqdn string, score float64, first int64) Finding {
+	return Finding{
+		Hosts:           data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: src}, FQDN: fqdn},
+		Score:           score,
+		ConnectionCount: 100,
+		FirstSeen:       time.Unix(first, 0),
+		LastSeen:        time.Unix(first+3600, 0),
+	}
+}
+
+func TestLimitPerSourceDisabled(t *testing.T) {
+	sink := &recordingSink{}
+	assert.Equal(t, ResultSink(sink), newTestLimitedSink(sink, 0, 0), "a limit of 0 should not wrap the sink")
+}
+
+func TestLimitPerSource(t *testing.T) {
+	sink := &recordingSink{}
+	limited := newTestLimitedSink(sink, 2, 0.5)
+
+	for i := 0; i < 15; i++ {
+		limited.Emit(sourceFinding("10.0.0.1", fmt.Sprintf("c2-%02d.example.com", i), 0.6+float64(i)/100, 1600000000+int64(i)))
+	}
+	limited.Emit(sourceFinding("10.0.0.2", "c2.example.com", 0.9, 1600000000))
+	// findings the sink skips don't count towards the limit
+	limited.Emit(sourceFinding("10.0.0.2", "low.example.com", 0.1, 1600000000))
+	limited.Emit(sourceFinding("10.0.0.2", "other.example.com", 0.8, 1600000000))
+
+	require.Len(t, sink.findings, 5, "only the first findings of each source should be passed on")
+	assert.Equal(t, "c2-01.example.com", sink.findings[1].Hosts.FQDN)
+	assert.Equal(t, "other.example.com", sink.findings[4].Hosts.FQDN)
+
+	require.Nil(t, limited.Close())
+	assert.True(t, sink.closed)
+	require.Len(t, sink.findings, 6, "the held back findings should be summarized once")
+
+	summary := sink.findings[5]
+	require.NotNil(t, summary.Overflow)
+	assert.Equal(t, "10.0.0.1", summary.Hosts.SrcIP)
+	assert.Empty(t, summary.Hosts.FQDN)
+	assert.Equal(t, 13, summary.Overflow.Suppressed)
+	assert.Equal(t, 0.74, summary.Score, "the summary should keep the highest score held back")
+	assert.Equal(t, int64(1300), summary.ConnectionCount)
+	assert.Equal(t, time.Unix(1600000002, 0), summary.FirstSeen)
+	assert.Equal(t, time.Unix(1600000014+3600, 0), summary.LastSeen)
+	require.Len(t, summary.Overflow.FQDNs, overflowFQDNs)
+	assert.Equal(t, "c2-14.example.com", summary.Overflow.FQDNs[0], "the highest scoring SNIs should be listed first")
+}
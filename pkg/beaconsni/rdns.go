@@ -0,0 +1,169 @@
+package beaconsni
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/util"
+)
+
+type (
+	//ptrResolver performs reverse DNS lookups of responding IPs in the background. Lookups
+	//are queued without blocking, started no faster than the configured rate, and cached
+	//for the rest of the run so each address is only looked up once.
+	ptrResolver struct {
+		lookupAddr func(context.Context, string) ([]string, error) // performs a single reverse DNS lookup
+		timeout    time.Duration                                   // longest a single lookup may take
+		interval   time.Duration                                   // time between the start of consecutive lookups
+		cache      map[string]*ptrLookup                           // lookups by IP address, whether finished or not
+		cacheMu    sync.Mutex                                      // guards cache
+		queue      chan *ptrLookup                                 // lookups waiting on the rate limit
+		stop       chan struct{}                                   // closed when the run is over
+		lookupWg   sync.WaitGroup                                  // wait for every started lookup to finish
+	}
+
+	//ptrLookup is the reverse DNS lookup of a single responding IP. names may only be read
+	//once done is closed.
+	ptrLookup struct {
+		ip    string
+		names []string
+		done  chan struct{}
+	}
+
+	//responderPTR holds the PTR records of a single responding IP
+	responderPTR struct {
+		IP    string   `bson:"ip"`
+		Names []string `bson:"ptr"`
+	}
+)
+
+// ptrQueueSize bounds the lookups waiting on the rate limit. Further addresses are skipped
+// until the queue drains, rather than blocking the dissector threads.
+const ptrQueueSize = 10000
+
+//newPTRResolver creates a ptrResolver which starts at most ratePerSecond lookups each second
+//and gives up on a lookup after timeout
+func newPTRResolver(ratePerSecond int, timeout time.Duration, lookupAddr func(context.Context, string) ([]string, error)) *ptrResolver {
+	r := &ptrResolver{
+		lookupAddr: lookupAddr,
+		timeout:    timeout,
+		interval:   time.Second / time.Duration(util.Max(1, ratePerSecond)),
+		cache:      make(map[string]*ptrLookup),
+		queue:      make(chan *ptrLookup, ptrQueueSize),
+		stop:       make(chan struct{}),
+	}
+
+	r.lookupWg.Add(1)
+	go r.run()
+	return r
+}
+
+//run starts the queued lookups, pacing them by the rate limit. Each lookup runs in its own
+//goroutine so a slow DNS server can't hold up the lookups behind it.
+func (r *ptrResolver) run() {
+	defer r.lookupWg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for lookup := range r.queue {
+		select {
+		case <-ticker.C:
+		case <-r.stop:
+			// the run is over, so lookups still waiting on the rate limit are abandoned
+			close(lookup.done)
+			continue
+		}
+		r.lookupWg.Add(1)
+		go func(lookup *ptrLookup) {
+			defer r.lookupWg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+			defer cancel()
+
+			// failed lookups are cached as having no names, since asking again is unlikely to help
+			names, err := r.lookupAddr(ctx, lookup.ip)
+			if err == nil {
+				for _, name := range names {
+					lookup.names = append(lookup.names, strings.TrimSuffix(name, "."))
+				}
+			}
+			close(lookup.done)
+		}(lookup)
+	}
+}
+
+//lookup returns the reverse DNS lookup of ip, queueing it if it hasn't been asked for before.
+//It never blocks. nil is returned if the queue is full, in which case a later pair may ask again.
+func (r *ptrResolver) lookup(ip string) *ptrLookup {
+	r.cacheMu.Lock()
+	defer r.cacheMu.Unlock()
+
+	if cached, ok := r.cache[ip]; ok {
+		return cached
+	}
+
+	lookup := &ptrLookup{ip: ip, done: make(chan struct{})}
+	select {
+	case r.queue <- lookup:
+		r.cache[ip] = lookup
+		return lookup
+	default:
+		return nil
+	}
+}
+
+//lookupExternal queues the lookups of the responders outside of the internal subnets
+//and of the special use ranges, returning them in the order of the responders
+func (r *ptrResolver) lookupExternal(responders []data.UniqueIP, internalSubnets []*net.IPNet) []*ptrLookup {
+	var lookups []*ptrLookup
+	for _, responder := range responders {
+		ip := net.ParseIP(responder.IP)
+		if ip == nil || util.ContainsIP(internalSubnets, ip) || util.IPIsSpecialUse(ip) {
+			continue
+		}
+		if lookup := r.lookup(responder.IP); lookup != nil {
+			lookups = append(lookups, lookup)
+		}
+	}
+	return lookups
+}
+
+//close abandons the queued lookups and waits for the ones already started to finish or
+//time out. lookup must not be called afterwards.
+func (r *ptrResolver) close() {
+	close(r.stop)
+	close(r.queue)
+	r.lookupWg.Wait()
+}
+
+//waitPTRs gathers the PTR records of the given lookups, waiting until they finish or until
+//maxWait passes. Lookups which haven't finished by then, or which found no names, are left out.
+func waitPTRs(lookups []*ptrLookup, maxWait time.Duration) []responderPTR {
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+
+	var ptrs []responderPTR
+	expired := false
+	for _, lookup := range lookups {
+		// once the wait is over, only the lookups which already finished are gathered
+		if !expired {
+			select {
+			case <-lookup.done:
+			case <-timer.C:
+				expired = true
+			}
+		}
+		select {
+		case <-lookup.done:
+			if len(lookup.names) > 0 {
+				ptrs = append(ptrs, responderPTR{IP: lookup.ip, Names: lookup.names})
+			}
+		default:
+		}
+	}
+	return ptrs
+}
@@ -0,0 +1,51 @@
+package beaconsni
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPTRResolver(t *testing.T) {
+	var calls int64
+	resolver := newPTRResolver(1000, time.Second, func(ctx context.Context, ip string) ([]string, error) {
+		atomic.AddInt64(&calls, 1)
+		if ip == "45.33.32.156" {
+			return nil, errors.New("no such host")
+		}
+		return []string{"ec2-" + ip + ".compute.amazonaws.com."}, nil
+	})
+
+	responders := []data.UniqueIP{{IP: "93.184.216.34"}, {IP: "10.0.0.5"}, {IP: "127.0.0.1"}, {IP: "45.33.32.156"}}
+	internal := util.ParseSubnets([]string{"10.0.0.0/8"})
+
+	lookups := resolver.lookupExternal(responders, internal)
+	assert.Len(t, lookups, 2, "internal and special use responders should not be looked up")
+
+	ptrs := waitPTRs(lookups, time.Second)
+	assert.Equal(t, []responderPTR{{IP: "93.184.216.34", Names: []string{"ec2-93.184.216.34.compute.amazonaws.com"}}}, ptrs,
+		"failed lookups should be left out and trailing dots trimmed")
+
+	// a second pair sharing the responder is answered from the cache
+	again := resolver.lookupExternal(responders[:1], internal)
+	assert.Equal(t, lookups[0], again[0])
+
+	resolver.close()
+	assert.Equal(t, int64(2), atomic.LoadInt64(&calls))
+}
+
+func TestWaitPTRsTimeout(t *testing.T) {
+	done := &ptrLookup{ip: "93.184.216.34", names: []string{"a.example.com"}, done: make(chan struct{})}
+	close(done.done)
+	pending := &ptrLookup{ip: "203.0.113.8", done: make(chan struct{})}
+
+	ptrs := waitPTRs([]*ptrLookup{pending, done}, 10*time.Millisecond)
+	assert.Equal(t, []responderPTR{{IP: "93.184.216.34", Names: []string{"a.example.com"}}}, ptrs,
+		"finished lookups should still be gathered once the wait is over")
+}
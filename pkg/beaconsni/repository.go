@@ -1,30 +1,81 @@
 package beaconsni
 
 import (
+	"io"
+
+	"github.com/activecm/rita/database"
 	"github.com/activecm/rita/pkg/data"
 	"github.com/activecm/rita/pkg/host"
 	"github.com/activecm/rita/pkg/sniconn"
+	"github.com/activecm/rita/util"
 	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
 )
 
 // Repository for beaconsni collection
 type Repository interface {
 	CreateIndexes() error
-	Upsert(tlsMap map[string]*sniconn.TLSInput, httpMap map[string]*sniconn.HTTPInput, hostMap map[string]*host.Input, minTimestamp, maxTimestamp int64)
+	Upsert(tlsMap map[string]*sniconn.TLSInput, httpMap map[string]*sniconn.HTTPInput, hostMap map[string]*host.Input, minTimestamp, maxTimestamp int64) []ScoredBeacon
+	UpsertStream(input <-chan data.UniqueSrcFQDNPair, hostMap map[string]*host.Input, minTimestamp, maxTimestamp int64) []ScoredBeacon
+	TopBeacons(minScore float64, limit int) ([]BeaconSummary, error)
+	ExportSTIX(w io.Writer) error
+	ExportGraph(w io.Writer) error
+	ExportZeekIntel(w io.Writer) error
+	StreamNDJSON(w io.Writer) error
+	ExplainPipeline(pair data.UniqueSrcFQDNPair, runExplain bool) ([]bson.M, bson.M, error)
+	MergeAcrossDatabases(dbNames []string, pair data.UniqueSrcFQDNPair) (DissectorResults, error)
+	SetNewBeaconCallback(newBeaconCallback func(pair data.UniqueSrcFQDNPair, score float64))
+	PurgeChunk(chunkID int) error
+	Rescore() error
+	RescoreStale() error
+	SetQueryLimiter(limiter *util.Limiter)
+	SetProgressGroup(group *util.ProgressGroup)
+	CorrelateCertificates() error
+	Diff(previous *database.DB) (BeaconDiff, error)
 }
 
 type mgoBulkAction func(*mgo.Bulk) int
 
 type mgoBulkActions map[string]mgoBulkAction
 
-type dissectorResults struct {
-	Hosts           data.UniqueSrcFQDNPair
-	RespondingIPs   []data.UniqueIP
-	ConnectionCount int64
-	TotalBytes      int64
-	TsList          []int64
-	TsListFull      []int64
-	OrigBytesList   []int64
+//DissectorResults holds the connection details gathered for a source IP, SNI pair.
+//Beacons are scored on these details, while strobes only carry the connection count.
+type DissectorResults struct {
+	Hosts             data.UniqueSrcFQDNPair
+	RespondingIPs     []data.UniqueIP
+	ConnectionCount   int64
+	TotalBytes        int64
+	TsList            []int64
+	TsListFull        []int64
+	OrigBytesList     []int64
+	DurationList      []float64
+	BytesDownsampled  bool    // set when OrigBytesList is a uniform sample of the data sizes
+	BytesMode         int64   // lower bound of the BeaconSNI.DataSizeBucketWidth wide bucket holding the most data sizes
+	BytesModeCount    int     // number of data sizes in the BytesMode bucket (0 if not computed)
+	BytesModeFraction float64 // share of connections whose data size equals the most common exact size (0 if there are none)
+	SourceCardinality int     // number of distinct sources which contacted the SNI (0 if unknown)
+	HourHistogram     [24]int // connections made in each hour of the day in BeaconSNI.Timezone (all 0 if disabled)
+	JitterRatio       float64 // standard deviation of the intervals in TsListFull over their mean (0 if the mean is 0)
+	NATSrcIP          string  // NAT address the client in Hosts connected from when BeaconSNI.NATClientField is set
+	DecayedCount      float64 // connections in TsListFull weighted by recency when BeaconSNI.DecayHalfLifeDays is set (0 if disabled)
+	UniqueSizes       []int64 // distinct data sizes in bytes, ascending, taken before OrigBytesList is downsampled
+	SizeSteps         []int64 // differences between consecutive UniqueSizes
+	SizeProgression   float64 // share of SizeSteps equal to the most common step (0 if there are fewer than 2 steps)
+	DistinctDays      int     // calendar days in BeaconSNI.Timezone on which connections in TsListFull were made
+	Deltas            []int64 // intervals between the distinct timestamps in TsListFull, ascending (nil unless BeaconSNI.DeltaTrimPercent is set)
+	TrimmedDeltas     []int64 // Deltas winsorized by BeaconSNI.DeltaTrimPercent, which the timing skew and dispersion are scored on
+	WinsorizedDeltas  int     // number of Deltas whose value was clamped in TrimmedDeltas
+	CountTrend        float64 // least squares slope of the connections per chunk (0 unless BeaconSNI.CountTrendBoost is set)
+	CountTrendRatio   float64 // CountTrend over the mean connections per chunk, clamped between 0 and 1
+	DominantPeriod    float64 // seconds between repeats of the strongest frequency in the periodogram (0 unless BeaconSNI.Periodogram is enabled)
+	Periodicity       float64 // significance of the strongest frequency in the periodogram, between 0 and 1
+	DomainAgeKnown    bool    // set when the registration date of the SNI's domain is in BeaconSNI.DomainAgeFiles
+	DomainAge         float64 // days between the registration of the SNI's domain and the first connection in TsListFull
+	DomainYouth       float64 // 1 for a domain contacted the day it was registered, falling to 0 at BeaconSNI.YoungDomainDays
+	ClusteredFraction float64 // share of the intervals in TsListFull shorter than BeaconSNI.BrowsingBursts.MinSpacing (0 if disabled)
+
+	ptrLookups []*ptrLookup // reverse DNS lookups of the external RespondingIPs, resolved in the background (nil if disabled)
+	stats      *cachedStats // statistics the analyzer computed before scoring, reused by the default model (nil until then)
 }
 
 //Result represents an SNI beacon between a source IP and
@@ -32,29 +83,58 @@ type dissectorResults struct {
 // Contains information on connection delta times and the amount of data transferred
 type Result struct {
 	data.UniqueSrcFQDNPair `bson:",inline"`
-	Connections            int64   `bson:"connection_count"`
-	AvgBytes               float64 `bson:"avg_bytes"`
-	Ts                     TSData  `bson:"ts"`
-	Ds                     DSData  `bson:"ds"`
-	Score                  float64 `bson:"score"`
+	Connections            int64                   `bson:"connection_count"`
+	AvgBytes               float64                 `bson:"avg_bytes"`
+	Ts                     TSData                  `bson:"ts"`
+	Ds                     DSData                  `bson:"ds"`
+	Score                  float64                 `bson:"score"`
+	ScoreBreakdown         map[string]float64      `bson:"score_breakdown"`
+	SourceCardinality      int                     `bson:"source_cardinality"`
+	AttackTechniques       []string                `bson:"attack_techniques"`
+	ScoreBucket            string                  `bson:"score_bucket"`
+	InvalidCert            bool                    `bson:"invalid_cert"`
+	NATSrcIP               string                  `bson:"nat_src,omitempty"`
+	DomainAge              *float64                `bson:"domain_age,omitempty"` // days between the domain's registration and the first connection (nil if unknown)
+	ScoreFeatures          map[string]ScoreFeature `bson:"score_features,omitempty"`
+	Provenance             Provenance              `bson:"dat"`
 	// ResolvedIPs            []data.UniqueIP // Requires lookup on SNIconn collection
 }
 
 //TSData ...
 type TSData struct {
-	Range      int64   `bson:"range"`
-	Mode       int64   `bson:"mode"`
-	ModeCount  int64   `bson:"mode_count"`
-	Skew       float64 `bson:"skew"`
-	Dispersion int64   `bson:"dispersion"`
-	Duration   float64 `bson:"duration"`
+	Range        int64   `bson:"range"`
+	Mode         int64   `bson:"mode"`
+	ModeCount    int64   `bson:"mode_count"`
+	Skew         float64 `bson:"skew"`
+	Dispersion   int64   `bson:"dispersion"`
+	Duration     float64 `bson:"duration"`
+	Resolution   string  `bson:"resolution"`
+	DecayedCount float64 `bson:"decayed_count,omitempty"` // connection count weighted by recency (0 unless BeaconSNI.DecayHalfLifeDays is set)
+	Winsorized   int     `bson:"winsorized,omitempty"`    // intervals clamped before scoring (0 unless BeaconSNI.DeltaTrimPercent is set)
+	CountTrend   float64 `bson:"count_trend,omitempty"`   // slope of the connections per chunk (0 unless BeaconSNI.CountTrendBoost is set)
+	Period       float64 `bson:"period,omitempty"`        // strongest period in the periodogram, in seconds (0 unless BeaconSNI.Periodogram is enabled)
+	Periodicity  float64 `bson:"periodicity,omitempty"`   // significance of the strongest period, between 0 and 1
+	Clustered    float64 `bson:"clustered,omitempty"`     // share of intervals shorter than BeaconSNI.BrowsingBursts.MinSpacing
 }
 
 //DSData ...
 type DSData struct {
-	Skew       float64 `bson:"skew"`
-	Dispersion int64   `bson:"dispersion"`
-	Range      int64   `bson:"range"`
-	Mode       int64   `bson:"mode"`
-	ModeCount  int64   `bson:"mode_count"`
+	Skew         float64 `bson:"skew"`
+	Dispersion   int64   `bson:"dispersion"`
+	Range        int64   `bson:"range"`
+	Mode         int64   `bson:"mode"`
+	ModeCount    int64   `bson:"mode_count"`
+	Downsampled  bool    `bson:"downsampled"`
+	ModeFraction float64 `bson:"mode_fraction"` // share of connections sending exactly the most common data size
+}
+
+//BeaconSummary is a lightweight view of an SNI beacon for consumers which
+//only need to know which pairs scored highly
+type BeaconSummary struct {
+	Src              string   `bson:"src"`
+	FQDN             string   `bson:"fqdn"`
+	Score            float64  `bson:"score"`
+	Connections      int64    `bson:"connection_count"`
+	AttackTechniques []string `bson:"attack_techniques"`
+	ScoreBucket      string   `bson:"score_bucket"`
 }
@@ -0,0 +1,307 @@
+package beaconsni
+
+import (
+	"runtime"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	//featureDocument holds the dissector results of a scored pair along with the parameters of
+	//the run which scored it, so the pair can be scored again without re-dissecting SNIconn
+	featureDocument struct {
+		data.UniqueSrcFQDNPair `bson:",inline"`
+		RespondingIPs          []data.UniqueIP `bson:"responding_ips"`
+		ConnectionCount        int64           `bson:"connection_count"`
+		TotalBytes             int64           `bson:"total_bytes"`
+		TsList                 []int64         `bson:"ts"`
+		TsListFull             []int64         `bson:"ts_full"`
+		OrigBytesList          []int64         `bson:"bytes"`
+		DurationList           []float64       `bson:"durations"`
+		BytesDownsampled       bool            `bson:"bytes_downsampled"`
+		BytesMode              int64           `bson:"bytes_mode"`
+		BytesModeCount         int             `bson:"bytes_mode_count"`
+		BytesModeFraction      float64         `bson:"bytes_mode_fraction"`
+		SourceCardinality      int             `bson:"source_cardinality"`
+		HourHistogram          []int           `bson:"hour_histogram"`
+		JitterRatio            float64         `bson:"jitter_ratio"`
+		NATSrcIP               string          `bson:"nat_src"`
+		DecayedCount           float64         `bson:"decayed_count"`
+		UniqueSizes            []int64         `bson:"unique_sizes"`
+		SizeSteps              []int64         `bson:"size_steps"`
+		SizeProgression        float64         `bson:"size_progression"`
+		DistinctDays           int             `bson:"distinct_days"`
+		Deltas                 []int64         `bson:"deltas,omitempty"`
+		TrimmedDeltas          []int64         `bson:"trimmed_deltas,omitempty"`
+		WinsorizedDeltas       int             `bson:"winsorized_deltas"`
+		CountTrend             float64         `bson:"count_trend"`
+		CountTrendRatio        float64         `bson:"count_trend_ratio"`
+		DominantPeriod         float64         `bson:"dominant_period"`
+		Periodicity            float64         `bson:"periodicity"`
+		DomainAgeKnown         bool            `bson:"domain_age_known"`
+		DomainAge              float64         `bson:"domain_age"`
+		DomainYouth            float64         `bson:"domain_youth"`
+		ClusteredFraction      float64         `bson:"clustered_fraction"`
+		TsMin                  int64           `bson:"ts_min"` // min timestamp of the dataset the pair was scored in
+		TsMax                  int64           `bson:"ts_max"` // max timestamp of the dataset the pair was scored in
+		Chunk                  int             `bson:"cid"`
+	}
+
+	//rescoreRun identifies the pairs which were scored against the same dataset and chunk
+	rescoreRun struct {
+		TsMin int64 `bson:"ts_min"`
+		TsMax int64 `bson:"ts_max"`
+		Chunk int   `bson:"cid"`
+	}
+)
+
+//newFeatureDocument records the dissector results of a pair scored against the dataset
+//spanning tsMin to tsMax in the given chunk
+func newFeatureDocument(res DissectorResults, tsMin int64, tsMax int64, chunk int) featureDocument {
+	return featureDocument{
+		UniqueSrcFQDNPair: res.Hosts,
+		RespondingIPs:     res.RespondingIPs,
+		ConnectionCount:   res.ConnectionCount,
+		TotalBytes:        res.TotalBytes,
+		TsList:            res.TsList,
+		TsListFull:        res.TsListFull,
+		OrigBytesList:     res.OrigBytesList,
+		DurationList:      res.DurationList,
+		BytesDownsampled:  res.BytesDownsampled,
+		BytesMode:         res.BytesMode,
+		BytesModeCount:    res.BytesModeCount,
+		BytesModeFraction: res.BytesModeFraction,
+		SourceCardinality: res.SourceCardinality,
+		HourHistogram:     res.HourHistogram[:],
+		JitterRatio:       res.JitterRatio,
+		NATSrcIP:          res.NATSrcIP,
+		DecayedCount:      res.DecayedCount,
+		UniqueSizes:       res.UniqueSizes,
+		SizeSteps:         res.SizeSteps,
+		SizeProgression:   res.SizeProgression,
+		DistinctDays:      res.DistinctDays,
+		Deltas:            res.Deltas,
+		TrimmedDeltas:     res.TrimmedDeltas,
+		WinsorizedDeltas:  res.WinsorizedDeltas,
+		CountTrend:        res.CountTrend,
+		CountTrendRatio:   res.CountTrendRatio,
+		DominantPeriod:    res.DominantPeriod,
+		Periodicity:       res.Periodicity,
+		DomainAgeKnown:    res.DomainAgeKnown,
+		DomainAge:         res.DomainAge,
+		DomainYouth:       res.DomainYouth,
+		ClusteredFraction: res.ClusteredFraction,
+		TsMin:             tsMin,
+		TsMax:             tsMax,
+		Chunk:             chunk,
+	}
+}
+
+//results rebuilds the dissector results the document was recorded from
+func (f featureDocument) results() DissectorResults {
+	res := DissectorResults{
+		Hosts:             f.UniqueSrcFQDNPair,
+		RespondingIPs:     f.RespondingIPs,
+		ConnectionCount:   f.ConnectionCount,
+		TotalBytes:        f.TotalBytes,
+		TsList:            f.TsList,
+		TsListFull:        f.TsListFull,
+		OrigBytesList:     f.OrigBytesList,
+		DurationList:      f.DurationList,
+		BytesDownsampled:  f.BytesDownsampled,
+		BytesMode:         f.BytesMode,
+		BytesModeCount:    f.BytesModeCount,
+		BytesModeFraction: f.BytesModeFraction,
+		SourceCardinality: f.SourceCardinality,
+		JitterRatio:       f.JitterRatio,
+		NATSrcIP:          f.NATSrcIP,
+		DecayedCount:      f.DecayedCount,
+		UniqueSizes:       f.UniqueSizes,
+		SizeSteps:         f.SizeSteps,
+		SizeProgression:   f.SizeProgression,
+		DistinctDays:      f.DistinctDays,
+		Deltas:            f.Deltas,
+		TrimmedDeltas:     f.TrimmedDeltas,
+		WinsorizedDeltas:  f.WinsorizedDeltas,
+		CountTrend:        f.CountTrend,
+		CountTrendRatio:   f.CountTrendRatio,
+		DominantPeriod:    f.DominantPeriod,
+		Periodicity:       f.Periodicity,
+		DomainAgeKnown:    f.DomainAgeKnown,
+		DomainAge:         f.DomainAge,
+		DomainYouth:       f.DomainYouth,
+		ClusteredFraction: f.ClusteredFraction,
+	}
+	copy(res.HourHistogram[:], f.HourHistogram)
+	return res
+}
+
+//featureActions stores the dissector results of a scored pair in the features collection
+func (a *analyzer) featureActions(res DissectorResults) mgoBulkActions {
+	// copy variables to be used by bulk callback to prevent capturing by reference
+	pairSelector := res.Hosts.BSONKey()
+	features := newFeatureDocument(res, a.tsMin, a.tsMax, a.chunk)
+	return mgoBulkActions{
+		a.conf.T.BeaconSNI.FeaturesTable: func(b *mgo.Bulk) int {
+			b.Upsert(pairSelector, features)
+			return 1
+		},
+	}
+}
+
+//Rescore scores every pair in the features collection again with the current scoring
+//configuration and updates their beacons in place, without re-dissecting SNIconn. The
+//features collection is only filled when BeaconSNI.PersistFeatures is set. Pairs are scored
+//against the dataset and chunk they were last analyzed in, so scores only change when the
+//scoring configuration has. The max SNI beacon summaries of the pairs' sources are rebuilt
+//afterwards.
+func (r *repo) Rescore() error {
+	return r.rescore(nil)
+}
+
+//RescoreStale rescores the pairs whose beacons were scored by another RITA version or scoring
+//model than the current one, including beacons stored before the version was recorded, as
+//Rescore does. Beacons which are already up to date are left alone.
+func (r *repo) RescoreStale() error {
+	stale, err := r.stalePairs(r.currentProvenance())
+	if err != nil {
+		return err
+	}
+
+	r.log.WithFields(log.Fields{
+		"Module": "beaconSNI",
+		"Stale":  len(stale),
+	}).Info("found SNI beacons scored by another version or scoring model")
+
+	if len(stale) == 0 {
+		return nil
+	}
+	return r.rescore(stale)
+}
+
+//rescore scores the pairs in the features collection again. When only is set, pairs whose
+//map keys are missing from it are skipped.
+func (r *repo) rescore(only map[string]struct{}) error {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+	coll := session.DB(r.database.GetSelectedDB()).C(r.config.T.BeaconSNI.FeaturesTable)
+
+	var runs []rescoreRun
+	err := coll.Pipe([]bson.M{
+		{"$group": bson.M{"_id": bson.M{"ts_min": "$ts_min", "ts_max": "$ts_max", "cid": "$cid"}}},
+		{"$replaceRoot": bson.M{"newRoot": "$_id"}},
+		{"$sort": bson.D{{Name: "cid", Value: 1}, {Name: "ts_min", Value: 1}, {Name: "ts_max", Value: 1}}},
+	}).AllowDiskUse().All(&runs)
+	if err != nil {
+		return err
+	}
+
+	// every run shares a writer so the score buckets and ATT&CK tags are applied once at the end
+	writerWorker := newMgoBulkWriter(r.database, r.config, r.log, "beaconSNI")
+	writerWorker.enableAttackTags(r.config.T.BeaconSNI.BeaconSNITable, r.config.S.AttackTags.Rules.For(config.BeaconSNIAnalysis))
+	writerWorker.enableScoreBuckets(r.config.T.BeaconSNI.BeaconSNITable, r.config.S.ScoreBuckets.Buckets())
+	for i := 0; i < util.Max(1, runtime.NumCPU()/2); i++ {
+		writerWorker.start()
+	}
+
+	// the sources of the rescored pairs are summarized again for the chunk they were scored in
+	sources := make(map[int]map[string]data.UniqueIP)
+
+	var rescored int64
+	for _, run := range runs {
+		model, provenance := r.runModel(run.TsMin, run.TsMax)
+
+		// the writer is closed once every run is done
+		analyzerWorker := newAnalyzer(run.TsMin, run.TsMax, run.Chunk, model, r.database, r.config, r.log,
+			writerWorker.collect, func() error { return nil })
+		analyzerWorker.enableProvenance(provenance)
+		for i := 0; i < util.Max(1, runtime.NumCPU()/2); i++ {
+			analyzerWorker.start()
+		}
+
+		if sources[run.Chunk] == nil {
+			sources[run.Chunk] = make(map[string]data.UniqueIP)
+		}
+
+		var features featureDocument
+		iter := coll.Find(bson.M{"ts_min": run.TsMin, "ts_max": run.TsMax, "cid": run.Chunk}).Iter()
+		for iter.Next(&features) {
+			res := features.results()
+			features = featureDocument{}
+			if _, ok := only[res.Hosts.MapKey()]; only != nil && !ok {
+				continue
+			}
+			sources[run.Chunk][res.Hosts.UniqueSrcIP.Unpair().MapKey()] = res.Hosts.UniqueSrcIP.Unpair()
+			analyzerWorker.collect(res)
+			rescored++
+		}
+		iterErr := iter.Close()
+
+		// the collected pairs are still written out if the iteration stopped early
+		analyzerWorker.close()
+		if iterErr != nil {
+			writerWorker.close()
+			return iterErr
+		}
+	}
+
+	if err := writerWorker.close(); err != nil {
+		return err
+	}
+
+	r.log.WithFields(log.Fields{
+		"Module":   "beaconSNI",
+		"Rescored": rescored,
+	}).Info("rescored SNI beacons from their stored features")
+
+	for chunk, chunkSources := range sources {
+		summaryWriter := newMgoBulkWriter(r.database, r.config, r.log, "beaconSNI")
+		summarizerWorker := newSummarizer(chunk, r.database, r.config, r.log, summaryWriter.collect, summaryWriter.close)
+		for i := 0; i < util.Max(1, runtime.NumCPU()/2); i++ {
+			summarizerWorker.start()
+			summaryWriter.start()
+		}
+		hostColl := session.DB(r.database.GetSelectedDB()).C(r.config.T.Structure.HostTable)
+		for _, source := range chunkSources {
+			// the earlier summary is replaced, and left out if the source no longer has a beacon
+			err := hostColl.Update(source.BSONKey(), bson.M{"$pull": bson.M{"dat": bson.M{"cid": chunk, "mbsni": bson.M{"$exists": true}}}})
+			if err != nil && err != mgo.ErrNotFound {
+				r.log.WithFields(log.Fields{
+					"Module": "beaconSNI",
+					"Data":   source,
+					"Error":  err.Error(),
+				}).Error("could not clear the SNI beacon summary of a host")
+			}
+			summarizerWorker.collect(source)
+		}
+		if err := summarizerWorker.close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//createFeaturesCollection creates the features collection if it doesn't exist yet
+func (r *repo) createFeaturesCollection() error {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	collectionName := r.config.T.BeaconSNI.FeaturesTable
+
+	names, _ := session.DB(r.database.GetSelectedDB()).CollectionNames()
+	for _, name := range names {
+		if name == collectionName {
+			return nil
+		}
+	}
+
+	return r.database.CreateCollection(collectionName, []mgo.Index{
+		{Key: []string{"src", "fqdn", "src_network_uuid"}, Unique: true},
+		{Key: []string{"cid", "ts_min", "ts_max"}},
+	})
+}
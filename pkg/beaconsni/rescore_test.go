@@ -0,0 +1,61 @@
+package beaconsni
+
+import (
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeatureDocumentRoundTrip(t *testing.T) {
+	res := DissectorResults{
+		Hosts:             data.NewUniqueSrcFQDNPair(data.UniqueIP{IP: "10.0.0.1"}, "example.com"),
+		RespondingIPs:     []data.UniqueIP{{IP: "1.1.1.1"}},
+		ConnectionCount:   4,
+		TotalBytes:        400,
+		TsList:            []int64{0, 60, 120},
+		TsListFull:        []int64{0, 60, 60, 120},
+		OrigBytesList:     []int64{100, 100, 100, 100},
+		DurationList:      []float64{1, 1, 1, 1},
+		BytesDownsampled:  true,
+		BytesMode:         96,
+		BytesModeCount:    4,
+		SourceCardinality: 2,
+		JitterRatio:       0.5,
+		NATSrcIP:          "192.168.0.1",
+		DecayedCount:      3.5,
+		UniqueSizes:       []int64{100},
+		SizeSteps:         []int64{},
+	}
+	res.HourHistogram[3] = 4
+
+	features := newFeatureDocument(res, 0, 200, 7)
+	assert.Equal(t, int64(0), features.TsMin)
+	assert.Equal(t, int64(200), features.TsMax)
+	assert.Equal(t, 7, features.Chunk)
+	assert.Len(t, features.HourHistogram, 24)
+
+	assert.Equal(t, res, features.results())
+
+	// documents stored without a histogram rebuild an empty one
+	features.HourHistogram = nil
+	assert.Equal(t, [24]int{}, features.results().HourHistogram)
+}
+
+func TestExaminedActionsPersistFeatures(t *testing.T) {
+	conf := &config.Config{}
+	conf.T.BeaconSNI.BeaconSNITable = "beaconSNI"
+	conf.T.BeaconSNI.FeaturesTable = "beaconSNIFeatures"
+	conf.S.BeaconSNI.PersistFeatures = true
+
+	pair := data.NewUniqueSrcFQDNPair(data.UniqueIP{IP: "10.0.0.1"}, "example.com")
+
+	actions := examinedActions(conf, pair, LikelyCDN, 30, 1, time.Now())
+	_, ok := actions["beaconSNIFeatures"]
+	assert.True(t, ok, "the features of filtered pairs should be removed with their beacon")
+
+	actions = examinedActions(conf, pair, BelowThreshold, 2, 1, time.Now())
+	assert.Len(t, actions, 0)
+}
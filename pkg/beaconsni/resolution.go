@@ -0,0 +1,231 @@
+package beaconsni
+
+import (
+	"strconv"
+
+	"github.com/activecm/rita/config"
+	"github.com/globalsign/mgo/bson"
+)
+
+const (
+	//microsPerSecond is the number of microseconds in a second, the coarsest timestamp unit
+	microsPerSecond = 1000000
+	//microsPerMilli is the number of microseconds in a millisecond
+	microsPerMilli = 1000
+	//minMilliTimestamp is the smallest value a millisecond timestamp field is detected from.
+	//Second timestamps stay below it until the year 5138, and millisecond timestamps have
+	//been above it since 1973.
+	minMilliTimestamp = 1e11
+	//minMicroTimestamp is the smallest value a microsecond timestamp field is detected from
+	minMicroTimestamp = 1e14
+)
+
+//timestampUnits maps the units which may be set for a timestamp field to their length in
+//microseconds
+var timestampUnits = map[string]int{
+	config.SecondResolution:      microsPerSecond,
+	config.MillisecondResolution: microsPerMilli,
+	config.MicrosecondResolution: 1,
+}
+
+//storedTimestamp reads the timestamp ts as whole seconds, or whole milliseconds if millis is
+//set. The sniconn package stores whole seconds, or whole milliseconds when the data is imported
+//at millisecond resolution, so a rolling database may hold both. Each timestamp is read in the
+//unit its size points to, the same way normalizedTimestamps detects the unit of a field.
+func storedTimestamp(ts string, millis bool) bson.M {
+	isMillis := bson.M{"$gte": []interface{}{ts, minMilliTimestamp}}
+	if !millis {
+		seconds := bson.M{"$toLong": bson.M{"$floor": bson.M{"$divide": []interface{}{ts, 1000}}}}
+		return bson.M{"$cond": []interface{}{isMillis, seconds, ts}}
+	}
+	return bson.M{"$cond": []interface{}{isMillis, ts, bson.M{"$multiply": []interface{}{ts, 1000}}}}
+}
+
+//normalizeTimestamps replaces the timestamps read by the first projection of the given SNIconn
+//pipeline with the ones from normalizedTimestamps, which are already in the analysis unit. If
+//start or end is set, only the timestamps between them, inclusive and in the analysis unit, are
+//kept, and the connection count of each chunk is recomputed as the number of timestamps left.
+//A value of 0 leaves that end of the window open.
+func normalizeTimestamps(pipeline []bson.M, paths []string, units []string, millis bool, start int64, end int64) []bson.M {
+	for i, stage := range pipeline {
+		project, ok := stage["$project"].(bson.M)
+		if !ok {
+			continue
+		}
+
+		ts := normalizedTimestamps(paths, units, millis)
+		if start <= 0 && end <= 0 {
+			project["ts"] = ts
+			return pipeline
+		}
+		project["ts"] = windowTimestamps(ts, start, end)
+
+		// the counts are summed right after the projection, so they are replaced before then
+		counted := make([]bson.M, 0, len(pipeline)+1)
+		counted = append(counted, pipeline[:i+1]...)
+		counted = append(counted, bson.M{"$addFields": bson.M{"count": chunkSizes("$ts")}})
+		return append(counted, pipeline[i+1:]...)
+	}
+	return pipeline
+}
+
+//windowBounds converts the bounds of the analysis window from seconds to the analysis unit,
+//milliseconds if millis is set. An open end of the window stays 0.
+func windowBounds(start int64, end int64, millis bool) (int64, int64) {
+	if millis {
+		return start * 1000, end * 1000
+	}
+	return start, end
+}
+
+//windowTimestamps keeps the timestamps in the per chunk arrays held in chunks which fall between
+//start and end, inclusive. A value of 0 leaves that end of the window open.
+func windowTimestamps(chunks interface{}, start int64, end int64) bson.M {
+	var bounds []interface{}
+	if start > 0 {
+		bounds = append(bounds, bson.M{"$gte": []interface{}{"$$t", start}})
+	}
+	if end > 0 {
+		bounds = append(bounds, bson.M{"$lte": []interface{}{"$$t", end}})
+	}
+
+	return bson.M{"$map": bson.M{
+		"input": chunks,
+		"as":    "chunk",
+		"in": bson.M{"$filter": bson.M{
+			"input": "$$chunk",
+			"as":    "t",
+			"cond":  bson.M{"$and": bounds},
+		}},
+	}}
+}
+
+//chunkSizes counts the timestamps in each of the per chunk arrays held in chunks
+func chunkSizes(chunks interface{}) bson.M {
+	return bson.M{"$map": bson.M{
+		"input": chunks,
+		"as":    "chunk",
+		"in":    bson.M{"$size": "$$chunk"},
+	}}
+}
+
+//normalizedTimestamps joins the timestamp fields at the given paths of an SNIconn document
+//like concatFields does, after bringing them to a common resolution. Merging a field recorded
+//in whole seconds with one recorded to the microsecond would otherwise turn the fractions of
+//the finer field into jitter the beacon never had.
+//
+//Each field is read in its unit from units, or detected from the field's values if its unit is
+//"auto" or units is empty. A field holding values of at least minMicroTimestamp is read as
+//microseconds, one holding values of at least minMilliTimestamp as milliseconds, and any other
+//as seconds. The resolution of a field is its unit, except that seconds with a fractional part
+//are taken to be precise to the microsecond. A field without timestamps doesn't constrain the
+//others.
+//
+//Every timestamp is converted to microseconds, truncated to the coarsest resolution among the
+//fields, and then expressed in whole seconds, or whole milliseconds if millis is set. The
+//per chunk arrays of each field are kept, so the result unwinds like concatFields does.
+func normalizedTimestamps(paths []string, units []string, millis bool) bson.M {
+	outUnit := microsPerSecond
+	if millis {
+		outUnit = microsPerMilli
+	}
+
+	chunks := bson.M{}
+	maxes := bson.M{}
+	unitVars := bson.M{}
+	grains := bson.M{}
+	grainNames := make([]interface{}, 0, len(paths))
+	converted := make([]interface{}, 0, len(paths))
+	for i, path := range paths {
+		suffix := strconv.Itoa(i)
+		chunks["f"+suffix] = bson.M{"$ifNull": []interface{}{"$" + path, []interface{}{}}}
+
+		unit := config.AutoResolution
+		if len(units) > 0 {
+			unit = units[i]
+		}
+		if length, ok := timestampUnits[unit]; ok {
+			unitVars["u"+suffix] = length
+			grains["g"+suffix] = length
+		} else {
+			maxes["m"+suffix] = bson.M{"$max": flattenArrays("$$f" + suffix)}
+			unitVars["u"+suffix] = detectedUnit("$$m" + suffix)
+			grains["g"+suffix] = detectedGrain("$$f"+suffix, "$$m"+suffix, "$$u"+suffix)
+		}
+		grainNames = append(grainNames, "$$g"+suffix)
+		converted = append(converted, convertChunks("$$f"+suffix, "$$u"+suffix, outUnit))
+	}
+
+	// each variable depends on the ones before it, and $let can't read the variables it sets
+	expr := bson.M{"$let": bson.M{
+		"vars": bson.M{"grain": bson.M{"$max": grainNames}},
+		"in":   bson.M{"$concatArrays": converted},
+	}}
+	for _, vars := range []bson.M{grains, unitVars, maxes, chunks} {
+		if len(vars) > 0 {
+			expr = bson.M{"$let": bson.M{"vars": vars, "in": expr}}
+		}
+	}
+	return expr
+}
+
+//detectedUnit reads the length in microseconds of the unit of a timestamp field from the
+//largest of its timestamps, max
+func detectedUnit(max string) bson.M {
+	return bson.M{"$switch": bson.M{
+		"branches": []bson.M{
+			{"case": bson.M{"$gte": []interface{}{max, minMicroTimestamp}}, "then": 1},
+			{"case": bson.M{"$gte": []interface{}{max, minMilliTimestamp}}, "then": microsPerMilli},
+		},
+		"default": microsPerSecond,
+	}}
+}
+
+//detectedGrain reads the resolution in microseconds of the timestamp field whose per chunk
+//arrays are held in chunks, given its largest timestamp max and the length of its unit
+func detectedGrain(chunks string, max string, unit string) bson.M {
+	fractional := bson.M{"$anyElementTrue": []interface{}{bson.M{"$map": bson.M{
+		"input": flattenArrays(chunks),
+		"as":    "t",
+		"in":    bson.M{"$ne": []interface{}{"$$t", bson.M{"$trunc": "$$t"}}},
+	}}}}
+
+	return bson.M{"$switch": bson.M{
+		"branches": []bson.M{
+			// $max is null for a field without timestamps
+			{"case": bson.M{"$eq": []interface{}{max, nil}}, "then": 1},
+			{"case": bson.M{"$and": []interface{}{
+				bson.M{"$eq": []interface{}{unit, microsPerSecond}},
+				fractional,
+			}}, "then": 1},
+		},
+		"default": unit,
+	}}
+}
+
+//convertChunks converts each timestamp in the per chunk arrays held in chunks from unit
+//microseconds to whole outUnit microseconds, truncated to the common resolution in $$grain
+func convertChunks(chunks string, unit string, outUnit int) bson.M {
+	// the product is rounded to the microsecond, since fractional seconds are rarely exact
+	// as doubles
+	micros := bson.M{"$floor": bson.M{"$add": []interface{}{
+		bson.M{"$multiply": []interface{}{"$$t", unit}},
+		0.5,
+	}}}
+	truncated := bson.M{"$multiply": []interface{}{
+		bson.M{"$floor": bson.M{"$divide": []interface{}{micros, "$$grain"}}},
+		"$$grain",
+	}}
+
+	return bson.M{"$map": bson.M{
+		"input": chunks,
+		"as":    "chunk",
+		"in": bson.M{"$map": bson.M{
+			"input": "$$chunk",
+			"as":    "t",
+			"in": bson.M{"$toLong": bson.M{"$floor": bson.M{
+				"$divide": []interface{}{truncated, outUnit},
+			}}},
+		}},
+	}}
+}
@@ -0,0 +1,157 @@
+package beaconsni
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/globalsign/mgo/bson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//letLevels unwraps the nested $let expressions of expr, returning the variables set by each
+//level from the outermost in, along with the innermost expression
+func letLevels(t *testing.T, expr bson.M) ([]bson.M, interface{}) {
+	var levels []bson.M
+	for {
+		let, ok := expr["$let"].(bson.M)
+		if !ok {
+			return levels, expr
+		}
+		levels = append(levels, let["vars"].(bson.M))
+		inner, ok := let["in"].(bson.M)
+		require.True(t, ok)
+		expr = inner
+	}
+}
+
+func TestNormalizedTimestampsDetectsUnits(t *testing.T) {
+	paths := []string{"dat.http.ts", "dat.tls.ts"}
+	levels, inner := letLevels(t, normalizedTimestamps(paths, nil, false))
+
+	require.Len(t, levels, 5, "auto detection needs the fields, maxima, units, grains, and common grain")
+	assert.Equal(t, bson.M{"$ifNull": []interface{}{"$dat.tls.ts", []interface{}{}}}, levels[0]["f1"])
+	assert.Contains(t, levels[1], "m0")
+	assert.Equal(t, detectedUnit("$$m1"), levels[2]["u1"])
+	assert.Equal(t, detectedGrain("$$f0", "$$m0", "$$u0"), levels[3]["g0"])
+	assert.Equal(t, bson.M{"$max": []interface{}{"$$g0", "$$g1"}}, levels[4]["grain"])
+
+	converted := inner.(bson.M)["$concatArrays"].([]interface{})
+	assert.Equal(t, convertChunks("$$f1", "$$u1", microsPerSecond), converted[1], "fields should be joined in order")
+}
+
+func TestNormalizedTimestampsConfiguredUnits(t *testing.T) {
+	paths := []string{"dat.http.ts", "dat.tls.ts"}
+	units := []string{config.SecondResolution, config.MicrosecondResolution}
+	levels, inner := letLevels(t, normalizedTimestamps(paths, units, true))
+
+	require.Len(t, levels, 4, "configured units should not be detected")
+	assert.Equal(t, bson.M{"u0": microsPerSecond, "u1": 1}, levels[1])
+	assert.Equal(t, bson.M{"g0": microsPerSecond, "g1": 1}, levels[2])
+
+	converted := inner.(bson.M)["$concatArrays"].([]interface{})
+	assert.Equal(t, convertChunks("$$f0", "$$u0", microsPerMilli), converted[0], "millisecond analysis should convert to milliseconds")
+
+	// a mix of configured and detected units only detects the fields left on auto
+	levels, _ = letLevels(t, normalizedTimestamps(paths, []string{config.AutoResolution, config.MillisecondResolution}, false))
+	require.Len(t, levels, 5)
+	assert.Equal(t, []string{"m0"}, keys(levels[1]))
+	assert.Equal(t, microsPerMilli, levels[2]["u1"])
+}
+
+func TestNormalizeTimestampsPipeline(t *testing.T) {
+	fields := config.SNIConnFieldsCfg{
+		TimestampFields:  []string{"dat.http.ts", "dat.tls.ts"},
+		BytesFields:      []string{"dat.http.bytes", "dat.tls.bytes"},
+		CountFields:      []string{"dat.http.count", "dat.tls.count"},
+		TotalBytesFields: []string{"dat.http.tbytes", "dat.tls.tbytes"},
+		DstIPsFields:     []string{"dat.http.dst_ips", "dat.tls.dst_ips"},
+	}
+	pipeline := sniconnPipeline(bson.M{}, fields, 20, "$ts", false)
+	stages := len(pipeline)
+	pipeline = normalizeTimestamps(pipeline, fields.TimestampFields, nil, false, 0, 0)
+
+	require.Len(t, pipeline, stages, "without a window, the counts are left as they are")
+	assert.Equal(t, normalizedTimestamps(fields.TimestampFields, nil, false), pipeline[2]["$project"].(bson.M)["ts"])
+	last := pipeline[len(pipeline)-1]["$project"].(bson.M)
+	assert.Equal(t, 1, last["ts"], "later projections should keep the normalized timestamps")
+
+	// the window is applied in the analysis unit, after the timestamps are normalized
+	pipeline = normalizeTimestamps(sniconnPipeline(bson.M{}, fields, 20, "$ts", false), fields.TimestampFields, nil, true, 100000, 0)
+	require.Len(t, pipeline, stages+1)
+	ts := pipeline[2]["$project"].(bson.M)["ts"].(bson.M)["$map"].(bson.M)
+	assert.Equal(t, normalizedTimestamps(fields.TimestampFields, nil, true), ts["input"])
+	cond := ts["in"].(bson.M)["$filter"].(bson.M)["cond"]
+	assert.Equal(t, bson.M{"$and": []interface{}{bson.M{"$gte": []interface{}{"$$t", int64(100000)}}}}, cond)
+	assert.Equal(t, bson.M{"$addFields": bson.M{"count": chunkSizes("$ts")}}, pipeline[3])
+	assert.Equal(t, "$count", pipeline[4]["$unwind"], "the recomputed counts should be summed")
+}
+
+func TestWindowBounds(t *testing.T) {
+	start, end := windowBounds(100, 0, true)
+	assert.Equal(t, int64(100000), start)
+	assert.Equal(t, int64(0), end, "an open end should stay open")
+
+	start, end = windowBounds(100, 200, false)
+	assert.Equal(t, int64(100), start)
+	assert.Equal(t, int64(200), end)
+}
+
+func TestNormalizedPipelineWindow(t *testing.T) {
+	conf := &config.Config{}
+	conf.T.BeaconSNI.SNIConnFieldsCfg = config.SNIConnFieldsCfg{
+		TimestampFields:  []string{"dat.http.ts", "dat.tls.ts"},
+		BytesFields:      []string{"dat.http.bytes", "dat.tls.bytes"},
+		CountFields:      []string{"dat.http.count", "dat.tls.count"},
+		TotalBytesFields: []string{"dat.http.tbytes", "dat.tls.tbytes"},
+		DstIPsFields:     []string{"dat.http.dst_ips", "dat.tls.dst_ips"},
+	}
+	conf.S.BeaconSNI.NormalizeTimestamps = true
+	conf.S.Filtering.AnalysisStart = 100
+	keyBuilder := func(pair data.UniqueSrcFQDNPair) bson.M { return pair.BSONKey() }
+	d := newDissector(0, keyBuilder, nil, conf, nil, nil, nil)
+
+	for _, stage := range d.buildPipeline(data.UniqueSrcFQDNPair{}, 20) {
+		if fields, ok := stage["$addFields"].(bson.M); ok {
+			assert.NotContains(t, fields, "dat", "the stored timestamps should not be windowed")
+		}
+	}
+}
+
+//keys lists the keys of m
+func keys(m bson.M) []string {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestStoredTimestampsInPipeline(t *testing.T) {
+	conf := &config.Config{}
+	keyBuilder := func(pair data.UniqueSrcFQDNPair) bson.M { return pair.BSONKey() }
+	d := newDissector(0, keyBuilder, nil, conf, nil, nil, nil)
+
+	tsGroup := func() bson.M {
+		for _, stage := range d.buildPipeline(data.UniqueSrcFQDNPair{}, 20) {
+			if group, ok := stage["$group"].(bson.M); ok {
+				if ts, ok := group["ts"].(bson.M); ok && ts["$addToSet"] != nil {
+					return group
+				}
+			}
+		}
+		require.FailNow(t, "no stage gathers the unique timestamps")
+		return nil
+	}
+
+	group := tsGroup()
+	assert.Equal(t, bson.M{"$addToSet": storedTimestamp("$ts", false)}, group["ts"], "millisecond timestamps should be read as seconds")
+	assert.Equal(t, bson.M{"$push": storedTimestamp("$ts", false)}, group["ts_full"])
+
+	conf.S.BeaconSNI.TimestampResolution = config.MillisecondResolution
+	assert.Equal(t, bson.M{"$addToSet": storedTimestamp("$ts", true)}, tsGroup()["ts"])
+
+	conf.S.BeaconSNI.NormalizeTimestamps = true
+	assert.Equal(t, bson.M{"$addToSet": "$ts"}, tsGroup()["ts"], "normalized timestamps are already in the analysis unit")
+}
@@ -0,0 +1,451 @@
+package beaconsni
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/util"
+)
+
+type (
+	//ScoringModel turns the connection details gathered for an SNI beacon into a composite
+	//score between 0 and 1, along with the per feature scores which went into it. The details
+	//are sorted before they are scored. Score may be called from several analysis threads at once.
+	ScoringModel interface {
+		Score(DissectorResults) (float64, map[string]float64)
+	}
+
+	//ScoringModelFactory creates the ScoringModel used for an analysis run over the
+	//connections made between minTimestamp and maxTimestamp
+	ScoringModelFactory func(conf *config.Config, minTimestamp, maxTimestamp int64) ScoringModel
+
+	//defaultModel scores beacons on the skew and dispersion of their connection intervals
+	//and data sizes, how often they connect, and how small their data sizes are
+	defaultModel struct {
+		conf        *config.Config     // selects the timestamp resolution
+		tsMin       int64              // min timestamp for the whole dataset
+		tsMax       int64              // max timestamp for the whole dataset
+		weights     map[string]float64 // weight of each feature in the composite score
+		totalWeight float64            // sum of the feature weights
+		combination string             // how the feature scores are combined (BeaconSNI.ScoreCombination)
+	}
+
+	//beaconStats holds the statistics derived from the connection details of a beacon
+	beaconStats struct {
+		tsResolution     string
+		tsIntervalRange  int64
+		tsWinsorized     int
+		tsMode           int64
+		tsModeCount      int64
+		intervals        []int64
+		intervalCounts   []int64
+		tsMedian         int64
+		tsMadm           int64
+		tsSkew           float64
+		tsSkewScore      float64
+		tsMadmScore      float64
+		tsConnCountScore float64
+		tsScore          float64
+		dsRange          int64
+		dsMode           int64
+		dsModeCount      int64
+		dsSizes          []int64
+		dsCounts         []int64
+		dsMadm           int64
+		dsSkew           float64
+		dsSkewScore      float64
+		dsMadmScore      float64
+		dsSmallnessScore float64
+		dsConsistency    float64
+		dsScore          float64
+	}
+
+	//cachedStats holds the statistics computed for a beacon over the dataset from tsMin to tsMax
+	cachedStats struct {
+		tsMin int64
+		tsMax int64
+		stats beaconStats
+	}
+)
+
+//DefaultScoringModel is the name of the scoring model RITA ships with
+const DefaultScoringModel = "default"
+
+var (
+	scoringModelsMu sync.RWMutex
+	scoringModels   = map[string]ScoringModelFactory{
+		DefaultScoringModel: newDefaultModel,
+	}
+)
+
+//RegisterScoringModel makes a scoring model available to SNI beacon analysis under the
+//given name, which may then be selected with the BeaconSNI ScoringModel setting.
+//Registering a name again replaces the previous model.
+func RegisterScoringModel(name string, factory ScoringModelFactory) {
+	scoringModelsMu.Lock()
+	defer scoringModelsMu.Unlock()
+	scoringModels[name] = factory
+}
+
+//newScoringModel creates the scoring model registered under the given name
+func newScoringModel(name string, conf *config.Config, minTimestamp, maxTimestamp int64) (ScoringModel, bool) {
+	scoringModelsMu.RLock()
+	factory, ok := scoringModels[name]
+	scoringModelsMu.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+	return factory(conf, minTimestamp, maxTimestamp), true
+}
+
+//defaultFeatures lists the per feature scores the default model combines
+var defaultFeatures = []string{"ts_skew", "ts_dispersion", "ts_conns", "ds_skew", "ds_dispersion", "ds_smallness"}
+
+//consistencyFeature scores how many connections send exactly the same data size. The default
+//model only uses it when BeaconSNI.MinBytesModeFraction is set.
+const consistencyFeature = "ds_consistency"
+
+//newDefaultModel creates the default scoring model. Each feature is weighted as set in
+//BeaconSNI.FeatureWeights, and features left out are weighted 1.
+func newDefaultModel(conf *config.Config, minTimestamp, maxTimestamp int64) ScoringModel {
+	features := append([]string(nil), defaultFeatures...)
+	if conf.S.BeaconSNI.MinBytesModeFraction > 0 {
+		features = append(features, consistencyFeature)
+	}
+	if conf.S.BeaconSNI.Periodogram.Enabled {
+		features = append(features, periodicityFeature)
+	}
+
+	weights := make(map[string]float64, len(features))
+	totalWeight := 0.0
+	for _, feature := range features {
+		weight, ok := conf.S.BeaconSNI.FeatureWeights[feature]
+		if !ok {
+			weight = 1
+		}
+		weights[feature] = weight
+		totalWeight += weight
+	}
+
+	return defaultModel{
+		conf:        conf,
+		tsMin:       minTimestamp,
+		tsMax:       maxTimestamp,
+		weights:     weights,
+		totalWeight: totalWeight,
+		combination: conf.S.BeaconSNI.ScoreCombination,
+	}
+}
+
+//Score combines the timestamp and data size subscores as set in BeaconSNI.ScoreCombination,
+//taking their weighted average by default
+func (m defaultModel) Score(res DissectorResults) (float64, map[string]float64) {
+	stats := statsFor(res, m.conf, m.tsMin, m.tsMax)
+
+	tsSum := m.weights["ts_skew"]*stats.tsSkewScore + m.weights["ts_dispersion"]*stats.tsMadmScore + m.weights["ts_conns"]*stats.tsConnCountScore
+	dsSum := m.weights["ds_skew"]*stats.dsSkewScore + m.weights["ds_dispersion"]*stats.dsMadmScore + m.weights["ds_smallness"]*stats.dsSmallnessScore
+	dsSum += m.weights[consistencyFeature] * stats.dsConsistency
+	tsSum += m.weights[periodicityFeature] * res.Periodicity
+	score := math.Ceil(((tsSum+dsSum)/m.totalWeight)*1000) / 1000
+
+	breakdown := map[string]float64{
+		"ts_skew":       stats.tsSkewScore,
+		"ts_dispersion": stats.tsMadmScore,
+		"ts_conns":      stats.tsConnCountScore,
+		"ds_skew":       stats.dsSkewScore,
+		"ds_dispersion": stats.dsMadmScore,
+		"ds_smallness":  stats.dsSmallnessScore,
+	}
+	if _, ok := m.weights[consistencyFeature]; ok {
+		breakdown[consistencyFeature] = stats.dsConsistency
+	}
+	if _, ok := m.weights[periodicityFeature]; ok {
+		breakdown[periodicityFeature] = res.Periodicity
+	}
+
+	// the boosts below apply to the combined score however it was combined
+	switch m.combination {
+	case config.CombineMin, config.CombineProduct, config.CombineMax:
+		score = math.Ceil(combineScores(m.combination, m.weights, breakdown)*1000) / 1000
+	}
+
+	// an SNI contacted by few sources is more suspicious, so rare
+	// destinations move the score towards 1
+	if boost := m.conf.S.BeaconSNI.RarityBoost; boost > 0 && res.SourceCardinality > 0 {
+		rarity := 1.0 / float64(res.SourceCardinality)
+		score = math.Ceil((score+boost*rarity*(1-score))*1000) / 1000
+		breakdown["rarity"] = rarity
+	}
+
+	// a beacon whose connections per chunk keep rising is ramping up, so the
+	// score is moved towards 1 in proportion to how steeply
+	if boost := m.conf.S.BeaconSNI.CountTrendBoost; boost > 0 && res.CountTrendRatio > 0 {
+		score = math.Ceil((score+boost*res.CountTrendRatio*(1-score))*1000) / 1000
+		breakdown["count_trend"] = res.CountTrendRatio
+	}
+
+	// command and control domains are often registered just before use, so beacons to
+	// young domains move the score towards 1 in proportion to how young the domain is
+	if boost := m.conf.S.BeaconSNI.YoungDomainBoost; boost > 0 && res.DomainYouth > 0 {
+		score = math.Ceil((score+boost*res.DomainYouth*(1-score))*1000) / 1000
+		breakdown["domain_age"] = res.DomainYouth
+	}
+
+	// responders in ASNs known for bulletproof hosting make a beacon more
+	// suspicious, so the score is moved towards 1
+	if boost := m.conf.S.BeaconSNI.ASNBoost; boost > 0 && anyInASNs(res.RespondingIPs, m.conf.S.BeaconSNI.BoostASNs) {
+		score = math.Ceil((score+boost*(1-score))*1000) / 1000
+		breakdown["asn"] = 1
+	}
+
+	// connections mostly clustered like page loads are more likely browsing than a beacon, so
+	// the score is scaled down by the clustered share once every boost has been applied
+	if cfg := m.conf.S.BeaconSNI.BrowsingBursts; cfg.MinSpacing > 0 && cfg.Action == config.BrowsingDowngrade &&
+		res.ClusteredFraction > cfg.MaxClusteredFraction {
+		score = math.Ceil(score*(1-res.ClusteredFraction)*1000) / 1000
+		breakdown["clustered"] = res.ClusteredFraction
+	}
+
+	return score, breakdown
+}
+
+//combineScores combines the scores of the features with a weight above 0. min and max take the
+//lowest and highest score, ignoring the size of the weights, while product multiplies the scores
+//raised to their weights. 0 is returned if no feature is weighted.
+func combineScores(combination string, weights map[string]float64, scores map[string]float64) float64 {
+	combined := 0.0
+	first := true
+	for feature, weight := range weights {
+		if weight <= 0 {
+			continue
+		}
+		score := scores[feature]
+
+		switch {
+		case first && combination == config.CombineProduct:
+			combined = math.Pow(score, weight)
+		case first:
+			combined = score
+		case combination == config.CombineMin:
+			combined = math.Min(combined, score)
+		case combination == config.CombineMax:
+			combined = math.Max(combined, score)
+		case combination == config.CombineProduct:
+			combined *= math.Pow(score, weight)
+		}
+		first = false
+	}
+	return combined
+}
+
+//statsFor returns the statistics of a beacon over the dataset from tsMin to tsMax, reusing the
+//ones cached on res by withStats if they were computed over the same dataset
+func statsFor(res DissectorResults, conf *config.Config, tsMin, tsMax int64) beaconStats {
+	if res.stats != nil && res.stats.tsMin == tsMin && res.stats.tsMax == tsMax {
+		return res.stats.stats
+	}
+	return computeStats(res, conf, tsMin, tsMax)
+}
+
+//withStats computes the statistics of a beacon over the dataset from tsMin to tsMax and caches
+//them on res, so scoring it doesn't compute them again
+func withStats(res DissectorResults, conf *config.Config, tsMin, tsMax int64) (DissectorResults, beaconStats) {
+	stats := computeStats(res, conf, tsMin, tsMax)
+	res.stats = &cachedStats{tsMin: tsMin, tsMax: tsMax, stats: stats}
+	return res, stats
+}
+
+//computeStats derives the statistics stored for a beacon from its sorted connection details.
+//The timestamp and data size scores are included since they are stored regardless of the scoring model.
+func computeStats(res DissectorResults, conf *config.Config, tsMin, tsMax int64) beaconStats {
+	//store the diff slice length since we use it a lot
+	//for timestamps this is one less then the data slice length
+	//since we are calculating the times in between readings
+	tsLength := len(res.TsList) - 1
+	dsLength := len(res.OrigBytesList)
+
+	//timestamps (and therefore intervals) are in milliseconds
+	//rather than seconds if configured
+	tsResolution := config.SecondResolution
+	tsScale := 1.0
+	if conf.S.BeaconSNI.TimestampResolution == config.MillisecondResolution {
+		tsResolution = config.MillisecondResolution
+		tsScale = 1000.0
+	}
+
+	//find the delta times between the timestamps
+	diff := make([]int64, tsLength)
+	for i := 0; i < tsLength; i++ {
+		diff[i] = res.TsList[i+1] - res.TsList[i]
+	}
+
+	//score the winsorized intervals from the dissector when outlier trimming is enabled
+	if len(res.TrimmedDeltas) > 0 {
+		diff = append([]int64(nil), res.TrimmedDeltas...)
+		tsLength = len(diff)
+	}
+
+	//find the delta times between full list of timestamps
+	//(this will be used for the intervals list. Bowleys skew
+	//must use a unique timestamp list with no duplicates)
+	tsLengthFull := len(res.TsListFull) - 1
+	//find the delta times between the timestamps
+	diffFull := make([]int64, tsLengthFull)
+	for i := 0; i < tsLengthFull; i++ {
+		diffFull[i] = res.TsListFull[i+1] - res.TsListFull[i]
+	}
+
+	//perfect beacons should have symmetric delta time and size distributions
+	//Bowley's measure of skew is used to check symmetry
+	sort.Sort(util.SortableInt64(diff))
+	tsSkew := float64(0)
+	dsSkew := float64(0)
+
+	//tsLength -1 is used since diff is a zero based slice
+	tsLow := diff[util.Round(.25*float64(tsLength-1))]
+	tsMid := diff[util.Round(.5*float64(tsLength-1))]
+	tsHigh := diff[util.Round(.75*float64(tsLength-1))]
+	tsBowleyNum := tsLow + tsHigh - 2*tsMid
+	tsBowleyDen := tsHigh - tsLow
+
+	//we do the same for datasizes
+	dsLow := res.OrigBytesList[util.Round(.25*float64(dsLength-1))]
+	dsMid := res.OrigBytesList[util.Round(.5*float64(dsLength-1))]
+	dsHigh := res.OrigBytesList[util.Round(.75*float64(dsLength-1))]
+	dsBowleyNum := dsLow + dsHigh - 2*dsMid
+	dsBowleyDen := dsHigh - dsLow
+
+	//tsSkew should equal zero if the denominator equals zero
+	//bowley skew is unreliable if Q2 = Q1 or Q2 = Q3
+	if tsBowleyDen != 0 && tsMid != tsLow && tsMid != tsHigh {
+		tsSkew = float64(tsBowleyNum) / float64(tsBowleyDen)
+	}
+
+	if dsBowleyDen != 0 && dsMid != dsLow && dsMid != dsHigh {
+		dsSkew = float64(dsBowleyNum) / float64(dsBowleyDen)
+	}
+
+	//perfect beacons should have very low dispersion around the
+	//median of their delta times
+	//Median Absolute Deviation About the Median
+	//is used to check dispersion
+	devs := make([]int64, tsLength)
+	for i := 0; i < tsLength; i++ {
+		devs[i] = util.Abs(diff[i] - tsMid)
+	}
+
+	dsDevs := make([]int64, dsLength)
+	for i := 0; i < dsLength; i++ {
+		dsDevs[i] = util.Abs(res.OrigBytesList[i] - dsMid)
+	}
+
+	sort.Sort(util.SortableInt64(devs))
+	sort.Sort(util.SortableInt64(dsDevs))
+
+	tsMadm := devs[util.Round(.5*float64(tsLength-1))]
+	dsMadm := dsDevs[util.Round(.5*float64(dsLength-1))]
+
+	//Store the range for human analysis, over the intervals before any trimming
+	tsIntervalRange := diff[tsLength-1] - diff[0]
+	if len(res.Deltas) > 0 {
+		tsIntervalRange = res.Deltas[len(res.Deltas)-1] - res.Deltas[0]
+	}
+	dsRange := res.OrigBytesList[dsLength-1] - res.OrigBytesList[0]
+
+	//get a list of the intervals found in the data,
+	//the number of times the interval was found,
+	//and the most occurring interval
+	//sort intervals list (origbytes already sorted)
+	sort.Sort(util.SortableInt64(diffFull))
+	intervals, intervalCounts, tsMode, tsModeCount := createCountMap(diffFull)
+	dsSizes, dsCounts, dsMode, dsModeCount := createCountMap(res.OrigBytesList)
+	// prefer the bucketed mode from the dissector, which groups sizes with slight jitter together
+	if res.BytesModeCount > 0 {
+		dsMode, dsModeCount = res.BytesMode, int64(res.BytesModeCount)
+	}
+
+	//more skewed distributions receive a lower score
+	//less skewed distributions receive a higher score
+	tsSkewScore := 1.0 - math.Abs(tsSkew) //smush tsSkew
+	dsSkewScore := 1.0 - math.Abs(dsSkew) //smush dsSkew
+
+	//lower dispersion is better, cutoff dispersion scores at 30 seconds
+	tsMadmScore := 1.0 - float64(tsMadm)/(30.0*tsScale)
+	if tsMadmScore < 0 {
+		tsMadmScore = 0
+	}
+
+	//lower dispersion is better, cutoff dispersion scores at 32 bytes
+	dsMadmScore := 1.0 - float64(dsMadm)/32.0
+	if dsMadmScore < 0 {
+		dsMadmScore = 0
+	}
+
+	//smaller data sizes receive a higher score
+	dsSmallnessScore := 1.0 - float64(dsMode)/65535.0
+	if dsSmallnessScore < 0 {
+		dsSmallnessScore = 0
+	}
+
+	//a fixed payload sent by enough of the connections scores its share of them. Below the
+	//minimum share, the sizes are left to the dispersion score.
+	dsConsistency := 0.0
+	minModeFraction := conf.S.BeaconSNI.MinBytesModeFraction
+	if minModeFraction > 0 && res.BytesModeFraction >= minModeFraction {
+		dsConsistency = res.BytesModeFraction
+	}
+
+	// connection count scoring. When decay is enabled, older connections count for less.
+	connCount := float64(res.ConnectionCount)
+	if res.DecayedCount > 0 {
+		connCount = res.DecayedCount
+	}
+	tsConnDiv := (float64(tsMax) - float64(tsMin)) / 10.0
+	tsConnCountScore := connCount / tsConnDiv
+	if tsConnCountScore > 1.0 {
+		tsConnCountScore = 1.0
+	}
+
+	//score numerators
+	tsSum := tsSkewScore + tsMadmScore + tsConnCountScore
+	dsSum := dsSkewScore + dsMadmScore + dsSmallnessScore
+
+	//score averages
+	tsScore := math.Ceil((tsSum/3.0)*1000) / 1000
+	dsScore := math.Ceil((dsSum/3.0)*1000) / 1000
+	if minModeFraction > 0 {
+		dsScore = math.Ceil(((dsSum+dsConsistency)/4.0)*1000) / 1000
+	}
+
+	return beaconStats{
+		tsResolution:     tsResolution,
+		tsIntervalRange:  tsIntervalRange,
+		tsWinsorized:     res.WinsorizedDeltas,
+		tsMode:           tsMode,
+		tsModeCount:      tsModeCount,
+		intervals:        intervals,
+		intervalCounts:   intervalCounts,
+		tsMedian:         tsMid,
+		tsMadm:           tsMadm,
+		tsSkew:           tsSkew,
+		tsSkewScore:      tsSkewScore,
+		tsMadmScore:      tsMadmScore,
+		tsConnCountScore: tsConnCountScore,
+		tsScore:          tsScore,
+		dsRange:          dsRange,
+		dsMode:           dsMode,
+		dsModeCount:      dsModeCount,
+		dsSizes:          dsSizes,
+		dsCounts:         dsCounts,
+		dsMadm:           dsMadm,
+		dsSkew:           dsSkew,
+		dsSkewScore:      dsSkewScore,
+		dsMadmScore:      dsMadmScore,
+		dsSmallnessScore: dsSmallnessScore,
+		dsConsistency:    dsConsistency,
+		dsScore:          dsScore,
+	}
+}
@@ -0,0 +1,328 @@
+package beaconsni
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/stretchr/testify/assert"
+)
+
+//constantModel is a stand in for a user provided scoring model
+type constantModel struct{}
+
+func (constantModel) Score(DissectorResults) (float64, map[string]float64) {
+	return 0.5, map[string]float64{"constant": 0.5}
+}
+
+func TestDefaultModelScore(t *testing.T) {
+	ts := []int64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90}
+	res := DissectorResults{
+		ConnectionCount: int64(len(ts)),
+		TsList:          ts,
+		TsListFull:      ts,
+		OrigBytesList:   []int64{100, 100, 100, 100, 100, 100, 100, 100, 100, 100},
+	}
+
+	model := newDefaultModel(&config.Config{}, 0, 100)
+	score, breakdown := model.Score(res)
+
+	assert.Equal(t, 1.0, score, "a perfect beacon should receive a perfect score")
+	assert.Equal(t, 1.0, breakdown["ts_skew"])
+	assert.Equal(t, 1.0, breakdown["ts_dispersion"])
+	assert.Equal(t, 1.0, breakdown["ts_conns"])
+	assert.Equal(t, 1.0, breakdown["ds_skew"])
+	assert.Equal(t, 1.0, breakdown["ds_dispersion"])
+	assert.InDelta(t, 1.0-100.0/65535.0, breakdown["ds_smallness"], 1e-9)
+}
+
+func TestDefaultModelReusesStats(t *testing.T) {
+	ts := []int64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90}
+	res := DissectorResults{
+		ConnectionCount: int64(len(ts)),
+		TsList:          ts,
+		TsListFull:      ts,
+		OrigBytesList:   []int64{100, 100, 100, 100, 100, 100, 100, 100, 100, 100},
+	}
+	conf := &config.Config{}
+
+	cached, stats := withStats(res, conf, 0, 100)
+	assert.Equal(t, computeStats(res, conf, 0, 100), stats)
+
+	// a marker in the cache shows whether the model read it
+	cached.stats.stats.tsSkewScore = 0.25
+	_, breakdown := newDefaultModel(conf, 0, 100).Score(cached)
+	assert.Equal(t, 0.25, breakdown["ts_skew"], "the cached statistics should be scored")
+
+	_, breakdown = newDefaultModel(conf, 0, 200).Score(cached)
+	assert.Equal(t, 1.0, breakdown["ts_skew"], "statistics cached over another dataset should be recomputed")
+}
+
+func TestDefaultModelFeatureWeights(t *testing.T) {
+	// regular timestamps with large data sizes, so only ds_smallness is low
+	ts := []int64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90}
+	res := DissectorResults{
+		ConnectionCount: int64(len(ts)),
+		TsList:          ts,
+		TsListFull:      ts,
+		OrigBytesList:   []int64{60000, 60000, 60000, 60000, 60000, 60000, 60000, 60000, 60000, 60000},
+	}
+	smallness := 1.0 - 60000.0/65535.0
+
+	conf := &config.Config{}
+	equal, breakdown := newDefaultModel(conf, 0, 100).Score(res)
+	assert.InDelta(t, (5+smallness)/6, equal, 0.001, "features should be weighted equally by default")
+
+	conf.S.BeaconSNI.FeatureWeights = map[string]float64{"ds_smallness": 0}
+	ignored, weightedBreakdown := newDefaultModel(conf, 0, 100).Score(res)
+	assert.Equal(t, 1.0, ignored, "a feature weighted 0 should not affect the score")
+	assert.Equal(t, breakdown, weightedBreakdown, "the per feature scores should not be weighted")
+
+	conf.S.BeaconSNI.FeatureWeights = map[string]float64{"ts_skew": 0, "ts_dispersion": 0, "ts_conns": 0, "ds_skew": 0, "ds_dispersion": 0, "ds_smallness": 3}
+	only, _ := newDefaultModel(conf, 0, 100).Score(res)
+	assert.InDelta(t, smallness, only, 0.001)
+
+	conf.S.BeaconSNI.FeatureWeights = map[string]float64{"ds_smallness": 5}
+	emphasized, _ := newDefaultModel(conf, 0, 100).Score(res)
+	assert.InDelta(t, (5+5*smallness)/10, emphasized, 0.001, "features left out should be weighted 1")
+}
+
+func TestDefaultModelScoreCombination(t *testing.T) {
+	// regular timestamps with large data sizes, so only ds_smallness is low
+	ts := []int64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90}
+	res := DissectorResults{
+		ConnectionCount: int64(len(ts)),
+		TsList:          ts,
+		TsListFull:      ts,
+		OrigBytesList:   []int64{60000, 60000, 60000, 60000, 60000, 60000, 60000, 60000, 60000, 60000},
+	}
+	smallness := 1.0 - 60000.0/65535.0
+
+	score := func(combination string, weights map[string]float64) float64 {
+		conf := &config.Config{}
+		conf.S.BeaconSNI.ScoreCombination = combination
+		conf.S.BeaconSNI.FeatureWeights = weights
+		score, _ := newDefaultModel(conf, 0, 100).Score(res)
+		return score
+	}
+
+	assert.InDelta(t, (5+smallness)/6, score(config.CombineMean, nil), 0.001)
+	assert.Equal(t, score(config.CombineMean, nil), score("", nil), "an unset combination should take the mean")
+	assert.InDelta(t, smallness, score(config.CombineMin, nil), 0.001, "min should take the least suspicious feature")
+	assert.Equal(t, 1.0, score(config.CombineMax, nil), "max should take the most suspicious feature")
+	assert.InDelta(t, smallness, score(config.CombineProduct, nil), 0.001)
+
+	weights := map[string]float64{"ds_smallness": 2}
+	assert.InDelta(t, smallness, score(config.CombineMin, weights), 0.001, "min should ignore the size of the weights")
+	assert.InDelta(t, smallness*smallness, score(config.CombineProduct, weights), 0.001, "product should raise each score to its weight")
+
+	weights = map[string]float64{"ds_smallness": 0}
+	assert.Equal(t, 1.0, score(config.CombineMin, weights), "features weighted 0 should be left out")
+	assert.Equal(t, 1.0, score(config.CombineProduct, weights))
+
+	assert.Equal(t, 0.0, combineScores(config.CombineMax, map[string]float64{"ts_skew": 0}, map[string]float64{"ts_skew": 1}),
+		"no weighted features should score 0")
+}
+
+func TestDefaultModelConsistency(t *testing.T) {
+	// a fixed 60000 byte payload with a few larger check ins keeps ds_smallness low
+	ts := []int64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90}
+	res := DissectorResults{
+		ConnectionCount:   int64(len(ts)),
+		TsList:            ts,
+		TsListFull:        ts,
+		OrigBytesList:     []int64{60000, 60000, 60000, 60000, 60000, 60000, 60000, 60000, 60000, 65000},
+		BytesModeFraction: 0.9,
+	}
+
+	conf := &config.Config{}
+	base, breakdown := newDefaultModel(conf, 0, 100).Score(res)
+	_, ok := breakdown[consistencyFeature]
+	assert.False(t, ok, "consistency should only be scored when a minimum fraction is set")
+	assert.Equal(t, 0.0, computeStats(res, conf, 0, 100).dsConsistency)
+
+	conf.S.BeaconSNI.MinBytesModeFraction = 0.8
+	consistent, breakdown := newDefaultModel(conf, 0, 100).Score(res)
+	assert.Equal(t, 0.9, breakdown[consistencyFeature])
+	assert.True(t, consistent > base, "a fixed payload should raise the score")
+
+	stats := computeStats(res, conf, 0, 100)
+	assert.InDelta(t, (stats.dsSkewScore+stats.dsMadmScore+stats.dsSmallnessScore+0.9)/4, stats.dsScore, 0.001,
+		"the stored data size score should include consistency")
+
+	conf.S.BeaconSNI.MinBytesModeFraction = 0.95
+	_, breakdown = newDefaultModel(conf, 0, 100).Score(res)
+	assert.Equal(t, 0.0, breakdown[consistencyFeature], "a fraction below the minimum should not score")
+}
+
+func TestDefaultModelRarityBoost(t *testing.T) {
+	// irregular timestamps and data sizes keep the base score away from 1
+	res := DissectorResults{
+		ConnectionCount: 6,
+		TsList:          []int64{0, 1, 5, 30, 31, 90},
+		TsListFull:      []int64{0, 1, 5, 30, 31, 90},
+		OrigBytesList:   []int64{10, 200, 500, 3000, 9000, 40000},
+	}
+
+	conf := &config.Config{}
+	base, baseBreakdown := newDefaultModel(conf, 0, 100).Score(res)
+	_, ok := baseBreakdown["rarity"]
+	assert.False(t, ok, "rarity should only be scored when the boost is enabled")
+
+	conf.S.BeaconSNI.RarityBoost = 0.5
+	unknown, _ := newDefaultModel(conf, 0, 100).Score(res)
+	assert.Equal(t, base, unknown, "an unknown cardinality should not change the score")
+
+	res.SourceCardinality = 1
+	single, breakdown := newDefaultModel(conf, 0, 100).Score(res)
+	assert.Equal(t, 1.0, breakdown["rarity"])
+	assert.InDelta(t, base+0.5*(1-base), single, 0.001)
+
+	res.SourceCardinality = 50
+	common, _ := newDefaultModel(conf, 0, 100).Score(res)
+	assert.True(t, base <= common && common < single, "widely contacted SNIs should barely be boosted")
+}
+
+func TestDefaultModelCountTrendBoost(t *testing.T) {
+	res := DissectorResults{
+		ConnectionCount: 6,
+		TsList:          []int64{0, 1, 5, 30, 31, 90},
+		TsListFull:      []int64{0, 1, 5, 30, 31, 90},
+		OrigBytesList:   []int64{10, 200, 500, 3000, 9000, 40000},
+		CountTrend:      10,
+		CountTrendRatio: 0.5,
+	}
+
+	conf := &config.Config{}
+	base, baseBreakdown := newDefaultModel(conf, 0, 100).Score(res)
+	_, ok := baseBreakdown["count_trend"]
+	assert.False(t, ok, "the trend should only be scored when the boost is enabled")
+
+	conf.S.BeaconSNI.CountTrendBoost = 0.5
+	ramping, breakdown := newDefaultModel(conf, 0, 100).Score(res)
+	assert.Equal(t, 0.5, breakdown["count_trend"])
+	assert.InDelta(t, base+0.25*(1-base), ramping, 0.001)
+
+	res.CountTrend, res.CountTrendRatio = -5, 0
+	falling, _ := newDefaultModel(conf, 0, 100).Score(res)
+	assert.Equal(t, base, falling, "falling counts should not be boosted")
+}
+
+func TestDefaultModelPeriodicity(t *testing.T) {
+	res := DissectorResults{
+		ConnectionCount: 6,
+		TsList:          []int64{0, 1, 5, 30, 31, 90},
+		TsListFull:      []int64{0, 1, 5, 30, 31, 90},
+		OrigBytesList:   []int64{10, 200, 500, 3000, 9000, 40000},
+		DominantPeriod:  30,
+		Periodicity:     1,
+	}
+
+	conf := &config.Config{}
+	base, baseBreakdown := newDefaultModel(conf, 0, 100).Score(res)
+	_, ok := baseBreakdown[periodicityFeature]
+	assert.False(t, ok, "periodicity should only be scored when the periodogram is enabled")
+
+	conf.S.BeaconSNI.Periodogram.Enabled = true
+	periodic, breakdown := newDefaultModel(conf, 0, 100).Score(res)
+	assert.Equal(t, 1.0, breakdown[periodicityFeature])
+	assert.True(t, periodic > base, "a significant period should raise the score")
+
+	res.Periodicity = 0
+	_, breakdown = newDefaultModel(conf, 0, 100).Score(res)
+	assert.Equal(t, 0.0, breakdown[periodicityFeature])
+}
+
+func TestDefaultModelYoungDomainBoost(t *testing.T) {
+	res := DissectorResults{
+		ConnectionCount: 6,
+		TsList:          []int64{0, 1, 5, 30, 31, 90},
+		TsListFull:      []int64{0, 1, 5, 30, 31, 90},
+		OrigBytesList:   []int64{10, 200, 500, 3000, 9000, 40000},
+		DomainAgeKnown:  true,
+		DomainAge:       6,
+		DomainYouth:     0.8,
+	}
+
+	conf := &config.Config{}
+	base, baseBreakdown := newDefaultModel(conf, 0, 100).Score(res)
+	_, ok := baseBreakdown["domain_age"]
+	assert.False(t, ok, "the domain's age should only be scored when the boost is enabled")
+
+	conf.S.BeaconSNI.YoungDomainBoost = 0.5
+	young, breakdown := newDefaultModel(conf, 0, 100).Score(res)
+	assert.Equal(t, 0.8, breakdown["domain_age"])
+	assert.InDelta(t, base+0.4*(1-base), young, 0.001)
+
+	res.DomainAge, res.DomainYouth = 400, 0
+	old, _ := newDefaultModel(conf, 0, 100).Score(res)
+	assert.Equal(t, base, old, "old domains should not be boosted")
+}
+
+func TestDefaultModelBrowsingDowngrade(t *testing.T) {
+	res := DissectorResults{
+		ConnectionCount:   6,
+		TsList:            []int64{0, 1, 5, 30, 31, 90},
+		TsListFull:        []int64{0, 1, 5, 30, 31, 90},
+		OrigBytesList:     []int64{10, 200, 500, 3000, 9000, 40000},
+		ClusteredFraction: 0.9,
+	}
+
+	conf := &config.Config{}
+	conf.S.BeaconSNI.BrowsingBursts = config.BrowsingBurstsStaticCfg{MinSpacing: 2, MaxClusteredFraction: 0.8, Action: config.BrowsingFilter}
+	base, baseBreakdown := newDefaultModel(conf, 0, 100).Score(res)
+	_, ok := baseBreakdown["clustered"]
+	assert.False(t, ok, "filtered pairs should not be downgraded")
+
+	conf.S.BeaconSNI.BrowsingBursts.Action = config.BrowsingDowngrade
+	downgraded, breakdown := newDefaultModel(conf, 0, 100).Score(res)
+	assert.Equal(t, 0.9, breakdown["clustered"])
+	assert.InDelta(t, base*0.1, downgraded, 0.002)
+
+	res.ClusteredFraction = 0.5
+	spaced, _ := newDefaultModel(conf, 0, 100).Score(res)
+	assert.Equal(t, base, spaced, "pairs under the maximum clustered fraction should not be downgraded")
+}
+
+func TestDefaultModelASNBoost(t *testing.T) {
+	res := DissectorResults{
+		ConnectionCount: 6,
+		TsList:          []int64{0, 1, 5, 30, 31, 90},
+		TsListFull:      []int64{0, 1, 5, 30, 31, 90},
+		OrigBytesList:   []int64{10, 200, 500, 3000, 9000, 40000},
+		RespondingIPs:   []data.UniqueIP{{IP: "1.1.1.1", ASN: 13335}, {IP: "203.0.113.7", ASN: 64500}},
+	}
+
+	conf := &config.Config{}
+	conf.S.BeaconSNI.BoostASNs = []int64{64500}
+	base, baseBreakdown := newDefaultModel(conf, 0, 100).Score(res)
+	_, ok := baseBreakdown["asn"]
+	assert.False(t, ok, "ASNs should only be scored when the boost is enabled")
+
+	conf.S.BeaconSNI.ASNBoost = 0.5
+	boosted, breakdown := newDefaultModel(conf, 0, 100).Score(res)
+	assert.Equal(t, 1.0, breakdown["asn"])
+	assert.InDelta(t, base+0.5*(1-base), boosted, 0.001)
+
+	conf.S.BeaconSNI.BoostASNs = []int64{64501}
+	unlisted, _ := newDefaultModel(conf, 0, 100).Score(res)
+	assert.Equal(t, base, unlisted, "responders outside of the boosted ASNs should not change the score")
+}
+
+func TestRegisterScoringModel(t *testing.T) {
+	_, ok := newScoringModel("constant", &config.Config{}, 0, 100)
+	assert.False(t, ok, "unregistered models should not be found")
+
+	RegisterScoringModel("constant", func(*config.Config, int64, int64) ScoringModel {
+		return constantModel{}
+	})
+
+	model, ok := newScoringModel("constant", &config.Config{}, 0, 100)
+	assert.True(t, ok)
+	score, breakdown := model.Score(DissectorResults{})
+	assert.Equal(t, 0.5, score)
+	assert.Equal(t, map[string]float64{"constant": 0.5}, breakdown)
+
+	_, ok = newScoringModel(DefaultScoringModel, &config.Config{}, 0, 100)
+	assert.True(t, ok, "the default model should always be registered")
+}
@@ -0,0 +1,116 @@
+package beaconsni
+
+import (
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	//ResultSink receives the SNI beacons found during analysis as they are scored. Emit is
+	//called from several analysis threads and must not block the analysis, so sinks handle
+	//their own delivery errors. Close is called once analysis ends and flushes any findings
+	//which have not been delivered yet.
+	ResultSink interface {
+		Emit(Finding)
+		Close() error
+	}
+
+	//Finding is a single scored SNI beacon sent to a ResultSink
+	Finding struct {
+		Hosts           data.UniqueSrcFQDNPair
+		Score           float64
+		ConnectionCount int64
+		FirstSeen       time.Time
+		LastSeen        time.Time
+		ScoreBreakdown  map[string]float64 // per feature scores from the scoring model
+		Overflow        *OverflowSummary   // set when the finding summarizes the findings held back for Hosts.SrcIP (Hosts.FQDN is then empty)
+	}
+
+	//OverflowSummary describes the findings of a source held back from a sink once the source
+	//reached the sink's MaxAlertsPerSource. The finding carrying it holds the highest score,
+	//the total connection count, and the earliest and latest connections of those findings.
+	OverflowSummary struct {
+		Suppressed int      // findings held back
+		FQDNs      []string // SNIs of the highest scoring findings held back, at most overflowFQDNs
+	}
+
+	//multiSink sends each finding to several sinks
+	multiSink []ResultSink
+)
+
+//newResultSink creates the result sinks enabled in the config, combining them if there are
+//several. nil is returned if findings aren't sent anywhere. dbName is the RITA database the
+//findings come from.
+func newResultSink(conf *config.Config, dbName string, logger *log.Logger) (ResultSink, error) {
+	var sinks multiSink
+	if conf.S.BeaconSNI.Syslog.Enabled {
+		cfg := conf.S.BeaconSNI.Syslog
+		sinks = append(sinks, limitPerSource(newSyslogSink(conf, logger), "syslog", cfg.MaxAlertsPerSource, cfg.MinScore, logger))
+	}
+	if conf.S.BeaconSNI.SQL.Enabled {
+		sink, err := newSQLSink(conf, dbName, logger)
+		if err != nil {
+			// the sinks which were already started must not be left running
+			sinks.Close()
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if conf.S.BeaconSNI.Webhook.Enabled {
+		cfg := conf.S.BeaconSNI.Webhook
+		sinks = append(sinks, limitPerSource(newWebhookSink(conf, dbName, logger), "webhook", cfg.MaxAlertsPerSource, cfg.MinScore, logger))
+	}
+
+	switch len(sinks) {
+	case 0:
+		return nil, nil
+	case 1:
+		return sinks[0], nil
+	}
+	return sinks, nil
+}
+
+//Emit sends the finding to every sink
+func (m multiSink) Emit(finding Finding) {
+	for _, sink := range m {
+		sink.Emit(finding)
+	}
+}
+
+//Close closes every sink and returns the first error
+func (m multiSink) Close() error {
+	var firstErr error
+	for _, sink := range m {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+//newFinding builds the finding for a scored beacon. The first and last connections are
+//taken from the sorted, unique timestamps, which are in milliseconds if millis is set.
+func newFinding(res DissectorResults, score float64, breakdown map[string]float64, millis bool) Finding {
+	finding := Finding{
+		Hosts:           res.Hosts,
+		Score:           score,
+		ConnectionCount: res.ConnectionCount,
+		ScoreBreakdown:  breakdown,
+	}
+	if len(res.TsList) > 0 {
+		finding.FirstSeen = unixTime(res.TsList[0], millis)
+		finding.LastSeen = unixTime(res.TsList[len(res.TsList)-1], millis)
+	}
+	return finding
+}
+
+//unixTime converts a timestamp in Unix seconds, or milliseconds if millis is set, to a time
+func unixTime(ts int64, millis bool) time.Time {
+	if millis {
+		return time.Unix(0, ts*int64(time.Millisecond))
+	}
+	return time.Unix(ts, 0)
+}
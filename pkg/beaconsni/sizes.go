@@ -0,0 +1,103 @@
+package beaconsni
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+//sizeFeatures measures the data sizes of a pair's connections for scoring, then caps the
+//list of sizes kept for the rest of the analysis
+func (d *dissector) sizeFeatures(analysisInput *DissectorResults) {
+	// negative byte counts come from misconfigured sensors or counter overflows
+	// and would skew the data size scoring, so clamp them before analysis
+	if sanitized := sanitizeBytes(analysisInput.OrigBytesList); sanitized > 0 {
+		d.log.WithFields(log.Fields{
+			"Module":    "beaconSNI",
+			"Data":      analysisInput.Hosts,
+			"Sanitized": sanitized,
+		}).Warn("clamped negative byte counts to zero")
+	}
+
+	// a sample could skip sizes in a progression, so the unique sizes are taken from every connection
+	analysisInput.UniqueSizes, analysisInput.SizeSteps, analysisInput.SizeProgression = sizeProgression(
+		analysisInput.OrigBytesList,
+	)
+
+	// a fixed payload is measured over every connection, since a sample would only estimate it
+	analysisInput.BytesModeFraction = bytesModeFraction(analysisInput.OrigBytesList)
+
+	// the data sizes are only needed for dispersion scoring, which a uniform
+	// sample estimates well, so cap the list to bound the memory used by large beacons
+	analysisInput.OrigBytesList, analysisInput.BytesDownsampled = downsampleBytes(
+		analysisInput.OrigBytesList, d.conf.S.BeaconSNI.MaxByteSamples,
+	)
+
+	// the data size mode is taken over buckets so sizes with slight jitter are grouped together
+	analysisInput.BytesMode, analysisInput.BytesModeCount = bucketedMode(
+		analysisInput.OrigBytesList, d.conf.S.BeaconSNI.DataSizeBucketWidth,
+	)
+}
+
+//sanitizeBytes clamps any negative values in the given list of byte counts to zero
+//in place and returns the number of values which were changed
+func sanitizeBytes(bytes []int64) int {
+	sanitized := 0
+	for i := range bytes {
+		if bytes[i] < 0 {
+			bytes[i] = 0
+			sanitized++
+		}
+	}
+	return sanitized
+}
+
+//downsampleBytes returns a uniform sample of maxSamples values from the given list of byte
+//counts if the list is longer than maxSamples. The sampled indices are evenly spaced across
+//the list, so the same input always yields the same sample. The second return value reports
+//whether the list was downsampled. A maxSamples value of 0 or less disables downsampling.
+func downsampleBytes(bytes []int64, maxSamples int) ([]int64, bool) {
+	if maxSamples <= 0 || len(bytes) <= maxSamples {
+		return bytes, false
+	}
+
+	sample := make([]int64, maxSamples)
+	for i := range sample {
+		sample[i] = bytes[i*len(bytes)/maxSamples]
+	}
+	return sample, true
+}
+
+//bucketedMode groups the given data sizes into buckets of bucketWidth bytes and returns the
+//lower bound of the bucket holding the most sizes along with the number of sizes in it. The
+//size s falls into the bucket starting at s - s%bucketWidth. Ties go to the smaller bucket.
+//A bucketWidth below 1 is treated as 1, which yields the most common exact size.
+func bucketedMode(bytes []int64, bucketWidth int) (int64, int) {
+	width := int64(bucketWidth)
+	if width < 1 {
+		width = 1
+	}
+
+	counts := make(map[int64]int)
+	for _, size := range bytes {
+		counts[size-size%width]++
+	}
+
+	var mode int64
+	var modeCount int
+	for bucket, count := range counts {
+		if count > modeCount || (count == modeCount && bucket < mode) {
+			mode = bucket
+			modeCount = count
+		}
+	}
+	return mode, modeCount
+}
+
+//bytesModeFraction returns the share of the given data sizes equal to the most common exact
+//size. Beacons which send a fixed payload every check in come close to 1. An empty list yields 0.
+func bytesModeFraction(bytes []int64) float64 {
+	if len(bytes) == 0 {
+		return 0
+	}
+	_, modeCount := bucketedMode(bytes, 1)
+	return float64(modeCount) / float64(len(bytes))
+}
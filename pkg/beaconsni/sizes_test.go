@@ -0,0 +1,88 @@
+package beaconsni
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeBytes(t *testing.T) {
+	bytes := []int64{-5, 0, 12, -1, 300, -65536}
+
+	sanitized := sanitizeBytes(bytes)
+
+	assert.Equal(t, 3, sanitized, "all negative values should be counted")
+	assert.Equal(t, []int64{0, 0, 12, 0, 300, 0}, bytes, "negative values should be clamped to zero")
+
+	assert.Equal(t, 0, sanitizeBytes([]int64{1, 2, 3}), "clean lists should not be altered")
+}
+
+func TestDownsampleBytes(t *testing.T) {
+	bytes := make([]int64, 1000)
+	for i := range bytes {
+		bytes[i] = int64(i)
+	}
+
+	sample, downsampled := downsampleBytes(bytes, 100)
+	assert.True(t, downsampled)
+	assert.Len(t, sample, 100)
+	assert.Equal(t, int64(0), sample[0])
+	assert.Equal(t, int64(990), sample[99], "the sample should span the whole list")
+
+	again, _ := downsampleBytes(bytes, 100)
+	assert.Equal(t, sample, again, "downsampling should be deterministic")
+
+	short, downsampled := downsampleBytes(bytes[:50], 100)
+	assert.False(t, downsampled)
+	assert.Len(t, short, 50)
+
+	all, downsampled := downsampleBytes(bytes, 0)
+	assert.False(t, downsampled, "0 should disable downsampling")
+	assert.Len(t, all, 1000)
+}
+
+func BenchmarkDownsampleBytes(b *testing.B) {
+	bytes := make([]int64, 1000000)
+	for i := range bytes {
+		bytes[i] = int64(i % 1500)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		downsampleBytes(bytes, 10000)
+	}
+}
+
+func TestBucketedMode(t *testing.T) {
+	bytes := []int64{100, 101, 103, 96, 200, 200, 200}
+
+	mode, count := bucketedMode(bytes, 1)
+	assert.Equal(t, int64(200), mode, "a width of 1 should find the most common exact size")
+	assert.Equal(t, 3, count)
+
+	mode, count = bucketedMode(bytes, 16)
+	assert.Equal(t, int64(96), mode, "the mode should be reported as the lower bound of its bucket")
+	assert.Equal(t, 4, count)
+
+	mode, count = bucketedMode([]int64{5, 20}, 10)
+	assert.Equal(t, int64(0), mode, "ties should go to the smaller bucket")
+	assert.Equal(t, 1, count)
+
+	mode, _ = bucketedMode(bytes, 0)
+	assert.Equal(t, int64(200), mode, "widths below 1 should be treated as 1")
+}
+
+func TestBytesModeFraction(t *testing.T) {
+	fixed := make([]int64, 20)
+	for i := range fixed {
+		fixed[i] = 517
+	}
+	fixed[3] = 1200
+	assert.InDelta(t, 0.95, bytesModeFraction(fixed), 1e-9)
+
+	assert.InDelta(t, 3.0/7.0, bytesModeFraction([]int64{100, 101, 103, 96, 200, 200, 200}), 1e-9,
+		"sizes which only differ slightly should not count towards the mode")
+	assert.Equal(t, 1.0, bytesModeFraction([]int64{42}))
+	assert.Equal(t, 0.0, bytesModeFraction(nil), "an empty list should yield 0")
+}
@@ -16,35 +16,35 @@ type (
 	sorter struct {
 		db             *database.DB           // provides access to MongoDB
 		conf           *config.Config         // contains details needed to access MongoDB
-		sortedCallback func(dissectorResults) // called on each sorted result
-		closedCallback func()                 // called when .close() is called and no more calls to sortedCallback will be made
-		sortChannel    chan dissectorResults  // holds unsorted data
+		sortedCallback func(DissectorResults) // called on each sorted result
+		closedCallback func() error           // called when .close() is called and no more calls to sortedCallback will be made
+		sortChannel    chan DissectorResults  // holds unsorted data
 		sortWg         sync.WaitGroup         // wait for analysis to finish
 	}
 )
 
 //newSorter creates a new sorter which sorts SNI connection data
 //for use in quantile based statistics
-func newSorter(db *database.DB, conf *config.Config, sortedCallback func(dissectorResults), closedCallback func()) *sorter {
+func newSorter(db *database.DB, conf *config.Config, sortedCallback func(DissectorResults), closedCallback func() error) *sorter {
 	return &sorter{
 		db:             db,
 		conf:           conf,
 		sortedCallback: sortedCallback,
 		closedCallback: closedCallback,
-		sortChannel:    make(chan dissectorResults),
+		sortChannel:    make(chan DissectorResults),
 	}
 }
 
 //collect gathers a chunk of data to be sorted
-func (s *sorter) collect(data dissectorResults) {
+func (s *sorter) collect(data DissectorResults) {
 	s.sortChannel <- data
 }
 
-//close waits for the sorter to finish
-func (s *sorter) close() {
+//close waits for the sorter to finish and returns any error from the rest of the closing cascade
+func (s *sorter) close() error {
 	close(s.sortChannel)
 	s.sortWg.Wait()
-	s.closedCallback()
+	return s.closedCallback()
 }
 
 //start kicks off a new sorter thread
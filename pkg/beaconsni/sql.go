@@ -0,0 +1,264 @@
+package beaconsni
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/activecm/rita/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	sqlTable         = "beacons"
+	sqlFlushInterval = 5 * time.Second // longest a partial batch waits to be written
+)
+
+//sqlColumns lists the columns of the beacons table in the order findings are inserted
+var sqlColumns = []string{"dataset", "src", "fqdn", "score", "connection_count", "first_seen", "last_seen", "analyzed_at"}
+
+//sqlDialect holds the statements which differ between the supported databases
+type sqlDialect struct {
+	timestampType string             // column type of the timestamps
+	placeholder   func(i int) string // bind parameter for the i-th value, counting from 1
+}
+
+//sqlDialects maps each supported driver to its dialect
+var sqlDialects = map[string]sqlDialect{
+	config.SQLPostgres: {
+		timestampType: "TIMESTAMP WITH TIME ZONE",
+		placeholder:   func(i int) string { return fmt.Sprintf("$%d", i) },
+	},
+	config.SQLMySQL: {
+		timestampType: "DATETIME",
+		placeholder:   func(int) string { return "?" },
+	},
+	config.SQLSQLite: {
+		timestampType: "DATETIME",
+		placeholder:   func(int) string { return "?" },
+	},
+}
+
+//createTable returns the statement creating the beacons table if it doesn't exist
+func (d sqlDialect) createTable() string {
+	return "CREATE TABLE IF NOT EXISTS " + sqlTable + " (" +
+		"dataset VARCHAR(255) NOT NULL, " +
+		"src VARCHAR(255) NOT NULL, " +
+		"fqdn VARCHAR(255) NOT NULL, " +
+		"score DOUBLE PRECISION NOT NULL, " +
+		"connection_count BIGINT NOT NULL, " +
+		"first_seen " + d.timestampType + ", " +
+		"last_seen " + d.timestampType + ", " +
+		"analyzed_at " + d.timestampType + " NOT NULL)"
+}
+
+//insert returns the statement inserting a single finding
+func (d sqlDialect) insert() string {
+	placeholders := make([]string, len(sqlColumns))
+	for i := range placeholders {
+		placeholders[i] = d.placeholder(i + 1)
+	}
+	return "INSERT INTO " + sqlTable + " (" + strings.Join(sqlColumns, ", ") + ") VALUES (" + strings.Join(placeholders, ", ") + ")"
+}
+
+//sqlSink writes findings to the beacons table of a relational database. Findings are buffered
+//and written in batches by a single goroutine, each batch in its own transaction, so a slow
+//database never blocks the analysis. Findings which don't fit in the buffer, or whose batch
+//can't be written, are dropped and counted.
+type sqlSink struct {
+	db         *sql.DB
+	dialect    sqlDialect
+	dataset    string    // RITA database the findings come from
+	analyzedAt time.Time // when the analysis run started, shared by every finding
+	minScore   float64   // findings scoring below this are not written
+	batchSize  int       // findings written per transaction
+	created    bool      // set once the table is known to exist
+	log        *log.Logger
+	queue      chan Finding  // findings waiting to be written
+	done       chan struct{} // closed when the writer goroutine exits
+	written    int64         // findings written so far
+	dropped    int64         // findings dropped so far
+	warnOnce   sync.Once     // the first write failure is logged as a warning
+}
+
+//newSQLSink connects to the database configured in BeaconSNI.SQL and starts the writer
+//goroutine. The driver must be compiled into RITA, otherwise an error is returned.
+func newSQLSink(conf *config.Config, dataset string, logger *log.Logger) (*sqlSink, error) {
+	cfg := conf.S.BeaconSNI.SQL
+
+	dialect, ok := sqlDialects[cfg.Driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported SQL driver %q", cfg.Driver)
+	}
+
+	// this fails if the driver wasn't compiled in, but doesn't connect yet
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	return startSQLSink(db, dialect, dataset, cfg, logger), nil
+}
+
+//startSQLSink creates a SQL sink writing to the given database and starts its writer goroutine
+func startSQLSink(db *sql.DB, dialect sqlDialect, dataset string, cfg config.SQLStaticCfg, logger *log.Logger) *sqlSink {
+	s := &sqlSink{
+		db:         db,
+		dialect:    dialect,
+		dataset:    dataset,
+		analyzedAt: time.Now().UTC(),
+		minScore:   cfg.MinScore,
+		batchSize:  cfg.BatchSize,
+		log:        logger,
+		queue:      make(chan Finding, cfg.BufferSize),
+		done:       make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+//Emit queues a finding to be written. Findings scoring below BeaconSNI.SQL.MinScore are
+//skipped, and if the buffer is full the finding is dropped.
+func (s *sqlSink) Emit(finding Finding) {
+	if finding.Score < s.minScore {
+		return
+	}
+	select {
+	case s.queue <- finding:
+	default:
+		s.drop(1, fmt.Errorf("the buffer of %d findings is full", cap(s.queue)))
+	}
+}
+
+//Close writes the buffered findings and disconnects from the database. An error is
+//returned if any finding was dropped during the run.
+func (s *sqlSink) Close() error {
+	close(s.queue)
+	<-s.done
+	s.db.Close()
+
+	written, dropped := atomic.LoadInt64(&s.written), atomic.LoadInt64(&s.dropped)
+	s.log.WithFields(log.Fields{
+		"Module":  "beaconSNI",
+		"Dataset": s.dataset,
+		"Written": written,
+		"Dropped": dropped,
+	}).Info("wrote SNI beacon findings to SQL")
+
+	if dropped > 0 {
+		return fmt.Errorf("%d SNI beacon findings were not written to SQL", dropped)
+	}
+	return nil
+}
+
+//run gathers the queued findings into batches until the queue is closed. A partial batch
+//is written once it has waited for sqlFlushInterval.
+func (s *sqlSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(sqlFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Finding, 0, s.batchSize)
+	for {
+		select {
+		case finding, ok := <-s.queue:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+			batch = append(batch, finding)
+			if len(batch) == s.batchSize {
+				s.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			s.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+//flush writes a batch of findings, creating the table first if this is the first write
+func (s *sqlSink) flush(batch []Finding) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := s.write(batch); err != nil {
+		s.drop(int64(len(batch)), err)
+		return
+	}
+	atomic.AddInt64(&s.written, int64(len(batch)))
+}
+
+//write inserts a batch of findings in a single transaction
+func (s *sqlSink) write(batch []Finding) error {
+	if !s.created {
+		if _, err := s.db.Exec(s.dialect.createTable()); err != nil {
+			return fmt.Errorf("could not create the %s table: %v", sqlTable, err)
+		}
+		s.created = true
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(s.dialect.insert())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, finding := range batch {
+		if _, err := stmt.Exec(s.row(finding)...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+//row returns the values inserted for a finding, in the order of sqlColumns. Unknown
+//first and last connections are stored as NULL.
+func (s *sqlSink) row(finding Finding) []interface{} {
+	nullTime := func(t time.Time) sql.NullTime {
+		return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+	}
+	return []interface{}{
+		s.dataset,
+		finding.Hosts.SrcIP,
+		finding.Hosts.FQDN,
+		finding.Score,
+		finding.ConnectionCount,
+		nullTime(finding.FirstSeen),
+		nullTime(finding.LastSeen),
+		s.analyzedAt,
+	}
+}
+
+//drop counts findings which won't be written. Only the first failure is logged as a warning,
+//so an unreachable database doesn't flood the log. The rest are logged at debug level.
+func (s *sqlSink) drop(count int64, err error) {
+	atomic.AddInt64(&s.dropped, count)
+
+	entry := s.log.WithFields(log.Fields{
+		"Module":   "beaconSNI",
+		"Findings": count,
+		"Error":    err.Error(),
+	})
+	warned := false
+	s.warnOnce.Do(func() {
+		warned = true
+		entry.Warn("could not write SNI beacon findings to SQL, dropping them")
+	})
+	if !warned {
+		entry.Debug("could not write SNI beacon findings to SQL, dropping them")
+	}
+}
@@ -0,0 +1,158 @@
+package beaconsni
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/config"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//recordingDriver is a database/sql driver which records the statements executed through it
+type recordingDriver struct {
+	mu        sync.Mutex
+	execs     []string         // statements executed outside of a prepared statement
+	rows      [][]driver.Value // values inserted by committed transactions
+	pending   [][]driver.Value // values inserted by the open transaction
+	commits   int
+	failExecs int // number of upcoming Exec calls which fail
+}
+
+type recordingConn struct{ d *recordingDriver }
+type recordingStmt struct{ d *recordingDriver }
+type recordingTx struct{ d *recordingDriver }
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) { return recordingConn{d}, nil }
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) { return recordingStmt(c), nil }
+func (c recordingConn) Close() error                              { return nil }
+func (c recordingConn) Begin() (driver.Tx, error)                 { return recordingTx(c), nil }
+
+//Exec runs statements which aren't prepared, such as creating the table
+func (c recordingConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	if c.d.failExecs > 0 {
+		c.d.failExecs--
+		return nil, errors.New("database unavailable")
+	}
+	c.d.execs = append(c.d.execs, query)
+	return driver.RowsAffected(0), nil
+}
+
+func (s recordingStmt) Close() error  { return nil }
+func (s recordingStmt) NumInput() int { return -1 }
+func (s recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.pending = append(s.d.pending, args)
+	return driver.RowsAffected(1), nil
+}
+func (s recordingStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func (t recordingTx) Commit() error {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	t.d.rows = append(t.d.rows, t.d.pending...)
+	t.d.pending = nil
+	t.d.commits++
+	return nil
+}
+func (t recordingTx) Rollback() error {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	t.d.pending = nil
+	return nil
+}
+
+//newRecordingDB opens a database backed by a new recording driver, registered under the test's name
+func newRecordingDB(t *testing.T) (*sql.DB, *recordingDriver) {
+	d := &recordingDriver{}
+	name := "recording-" + t.Name()
+	sql.Register(name, d)
+
+	db, err := sql.Open(name, "")
+	require.Nil(t, err)
+	return db, d
+}
+
+func TestSQLDialects(t *testing.T) {
+	postgres := sqlDialects[config.SQLPostgres]
+	assert.Equal(t,
+		"INSERT INTO beacons (dataset, src, fqdn, score, connection_count, first_seen, last_seen, analyzed_at) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		postgres.insert(),
+	)
+	assert.Contains(t, postgres.createTable(), "CREATE TABLE IF NOT EXISTS beacons (")
+	assert.Contains(t, postgres.createTable(), "first_seen TIMESTAMP WITH TIME ZONE,")
+
+	for _, driverName := range []string{config.SQLMySQL, config.SQLSQLite} {
+		dialect := sqlDialects[driverName]
+		assert.True(t, strings.HasSuffix(dialect.insert(), "VALUES (?, ?, ?, ?, ?, ?, ?, ?)"), driverName)
+		assert.Contains(t, dialect.createTable(), "analyzed_at DATETIME NOT NULL)", driverName)
+	}
+}
+
+func newTestSQLSink(db *sql.DB, batchSize int) *sqlSink {
+	logger := log.New()
+	logger.Out = ioutil.Discard
+
+	cfg := config.SQLStaticCfg{Enabled: true, Driver: config.SQLSQLite, MinScore: 0.5, BatchSize: batchSize, BufferSize: 100}
+	return startSQLSink(db, sqlDialects[config.SQLSQLite], "dnscat2-ja3-strobe-agent", cfg, logger)
+}
+
+func TestSQLSinkBatches(t *testing.T) {
+	db, d := newRecordingDB(t)
+	sink := newTestSQLSink(db, 2)
+
+	for i := 0; i < 5; i++ {
+		sink.Emit(testFinding())
+	}
+	low := testFinding()
+	low.Score = 0.2
+	sink.Emit(low)
+
+	unseen := testFinding()
+	unseen.FirstSeen, unseen.LastSeen = time.Time{}, time.Time{}
+	sink.Emit(unseen)
+	require.Nil(t, sink.Close())
+
+	require.Len(t, d.execs, 1, "the table should be created once")
+	assert.True(t, strings.HasPrefix(d.execs[0], "CREATE TABLE IF NOT EXISTS beacons"))
+
+	require.Len(t, d.rows, 6, "findings below the minimum score should not be written")
+	assert.Equal(t, 3, d.commits, "the findings should be written in batches of 2")
+
+	row := d.rows[0]
+	assert.Equal(t, "dnscat2-ja3-strobe-agent", row[0])
+	assert.Equal(t, "10.0.0.1", row[1])
+	assert.Equal(t, "c2.example.com", row[2])
+	assert.Equal(t, 0.874, row[3])
+	assert.Equal(t, int64(500), row[4])
+	assert.Equal(t, time.Unix(1600000000, 0).UTC(), row[5])
+	assert.Nil(t, d.rows[5][5], "unknown timestamps should be written as NULL")
+}
+
+func TestSQLSinkCreateTableFailure(t *testing.T) {
+	db, d := newRecordingDB(t)
+	d.failExecs = 1
+	sink := newTestSQLSink(db, 1)
+
+	sink.Emit(testFinding())
+	sink.Emit(testFinding())
+
+	assert.NotNil(t, sink.Close(), "dropped findings should be reported")
+	assert.EqualValues(t, 1, sink.dropped, "the batch which couldn't create the table should be dropped")
+	assert.EqualValues(t, 1, sink.written, "the table should be created by the next batch")
+	assert.Len(t, d.rows, 1)
+}
@@ -0,0 +1,187 @@
+package beaconsni
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/google/uuid"
+)
+
+type (
+	//stixBundle is a STIX 2.1 bundle holding the objects exported for a set of SNI beacons
+	stixBundle struct {
+		Type    string        `json:"type"`
+		ID      string        `json:"id"`
+		Objects []interface{} `json:"objects"`
+	}
+
+	//stixObservable is a STIX 2.1 domain-name, ipv4-addr, or ipv6-addr cyber-observable object
+	stixObservable struct {
+		Type        string `json:"type"`
+		SpecVersion string `json:"spec_version"`
+		ID          string `json:"id"`
+		Value       string `json:"value"`
+	}
+
+	//stixIndicator is a STIX 2.1 indicator matching the SNI of a beacon
+	stixIndicator struct {
+		Type               string                  `json:"type"`
+		SpecVersion        string                  `json:"spec_version"`
+		ID                 string                  `json:"id"`
+		Created            string                  `json:"created"`
+		Modified           string                  `json:"modified"`
+		Name               string                  `json:"name"`
+		Description        string                  `json:"description"`
+		IndicatorTypes     []string                `json:"indicator_types"`
+		Pattern            string                  `json:"pattern"`
+		PatternType        string                  `json:"pattern_type"`
+		ValidFrom          string                  `json:"valid_from"`
+		Confidence         int                     `json:"confidence"`
+		ExternalReferences []stixExternalReference `json:"external_references,omitempty"`
+	}
+
+	//stixExternalReference points a STIX object at an entry in an outside framework such as ATT&CK
+	stixExternalReference struct {
+		SourceName string `json:"source_name"`
+		ExternalID string `json:"external_id"`
+		URL        string `json:"url"`
+	}
+
+	//stixRelationship is a STIX 2.1 relationship tying an indicator to the host which beaconed
+	stixRelationship struct {
+		Type             string `json:"type"`
+		SpecVersion      string `json:"spec_version"`
+		ID               string `json:"id"`
+		Created          string `json:"created"`
+		Modified         string `json:"modified"`
+		RelationshipType string `json:"relationship_type"`
+		SourceRef        string `json:"source_ref"`
+		TargetRef        string `json:"target_ref"`
+	}
+)
+
+const (
+	stixSpecVersion = "2.1"
+	// stixTimestampFormat is the RFC 3339 format with millisecond precision used by STIX
+	stixTimestampFormat = "2006-01-02T15:04:05.000Z"
+)
+
+//stixSCONamespace is the namespace defined by STIX 2.1 for deterministic cyber-observable ids
+var stixSCONamespace = uuid.MustParse("00abedb4-aa42-466c-9c01-fed23315a9b7")
+
+//ExportSTIX writes the SNI beacons scoring at least BeaconSNI.ExportMinScore to w as a STIX 2.1 bundle
+func (r *repo) ExportSTIX(w io.Writer) error {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	var summaries []BeaconSummary
+	err := session.DB(r.database.GetSelectedDB()).C(r.config.T.BeaconSNI.BeaconSNITable).
+		Find(bson.M{"score": bson.M{"$gte": r.config.S.BeaconSNI.ExportMinScore}}).
+		Select(bson.M{"_id": 0, "src": 1, "fqdn": 1, "score": 1, "connection_count": 1, "attack_techniques": 1}).
+		Sort("-score").
+		All(&summaries)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(newSTIXBundle(summaries, time.Now()))
+}
+
+//newSTIXBundle maps each beacon to a domain-name object for its SNI, an ipv4-addr or
+//ipv6-addr object for its source, an indicator matching the SNI, and a relationship
+//from the indicator to the source. Observables shared by several beacons are only
+//included once.
+func newSTIXBundle(summaries []BeaconSummary, now time.Time) stixBundle {
+	timestamp := now.UTC().Format(stixTimestampFormat)
+
+	bundle := stixBundle{
+		Type:    "bundle",
+		ID:      "bundle--" + uuid.New().String(),
+		Objects: []interface{}{},
+	}
+
+	seen := make(map[string]bool)
+	addObservable := func(obs stixObservable) {
+		if !seen[obs.ID] {
+			seen[obs.ID] = true
+			bundle.Objects = append(bundle.Objects, obs)
+		}
+	}
+
+	for _, beacon := range summaries {
+		domain := newSTIXObservable("domain-name", beacon.FQDN)
+		addObservable(domain)
+
+		addrType := "ipv6-addr"
+		if ip := net.ParseIP(beacon.Src); ip != nil && ip.To4() != nil {
+			addrType = "ipv4-addr"
+		}
+		src := newSTIXObservable(addrType, beacon.Src)
+		addObservable(src)
+
+		indicator := stixIndicator{
+			Type:           "indicator",
+			SpecVersion:    stixSpecVersion,
+			ID:             "indicator--" + uuid.New().String(),
+			Created:        timestamp,
+			Modified:       timestamp,
+			Name:           "SNI beacon to " + beacon.FQDN,
+			Description:    fmt.Sprintf("%s beaconed to %s over %d connections with a score of %.3f", beacon.Src, beacon.FQDN, beacon.Connections, beacon.Score),
+			IndicatorTypes: []string{"anomalous-activity"},
+			Pattern:        fmt.Sprintf("[domain-name:value = '%s']", escapeSTIXString(beacon.FQDN)),
+			PatternType:    "stix",
+			ValidFrom:      timestamp,
+			Confidence:     int(beacon.Score * 100),
+		}
+
+		for _, technique := range beacon.AttackTechniques {
+			indicator.ExternalReferences = append(indicator.ExternalReferences, newAttackReference(technique))
+		}
+
+		bundle.Objects = append(bundle.Objects, indicator, stixRelationship{
+			Type:             "relationship",
+			SpecVersion:      stixSpecVersion,
+			ID:               "relationship--" + uuid.New().String(),
+			Created:          timestamp,
+			Modified:         timestamp,
+			RelationshipType: "related-to",
+			SourceRef:        indicator.ID,
+			TargetRef:        src.ID,
+		})
+	}
+
+	return bundle
+}
+
+//newSTIXObservable creates a cyber-observable with the deterministic id STIX 2.1 derives from its value
+func newSTIXObservable(objectType string, value string) stixObservable {
+	contributing, _ := json.Marshal(map[string]string{"value": value})
+	return stixObservable{
+		Type:        objectType,
+		SpecVersion: stixSpecVersion,
+		ID:          objectType + "--" + uuid.NewSHA1(stixSCONamespace, contributing).String(),
+		Value:       value,
+	}
+}
+
+//newAttackReference creates an external reference to the given ATT&CK technique. Sub-technique
+//ids such as T1071.001 are linked to their page at /techniques/T1071/001.
+func newAttackReference(technique string) stixExternalReference {
+	return stixExternalReference{
+		SourceName: "mitre-attack",
+		ExternalID: technique,
+		URL:        "https://attack.mitre.org/techniques/" + strings.Replace(technique, ".", "/", 1) + "/",
+	}
+}
+
+//escapeSTIXString escapes a value for use as a string constant in a STIX pattern
+func escapeSTIXString(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+}
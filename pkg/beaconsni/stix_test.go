@@ -0,0 +1,83 @@
+package beaconsni
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSTIXBundle(t *testing.T) {
+	summaries := []BeaconSummary{
+		{Src: "10.0.0.1", FQDN: "c2.example.com", Score: 0.95, Connections: 500, AttackTechniques: []string{"T1573.002"}},
+		{Src: "fd00::1", FQDN: "c2.example.com", Score: 0.9, Connections: 400},
+	}
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var buf bytes.Buffer
+	require.Nil(t, json.NewEncoder(&buf).Encode(newSTIXBundle(summaries, now)))
+
+	var bundle struct {
+		Type    string                   `json:"type"`
+		ID      string                   `json:"id"`
+		Objects []map[string]interface{} `json:"objects"`
+	}
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &bundle))
+
+	assert.Equal(t, "bundle", bundle.Type)
+	assert.True(t, strings.HasPrefix(bundle.ID, "bundle--"))
+
+	byType := make(map[string][]map[string]interface{})
+	for _, object := range bundle.Objects {
+		objectType := object["type"].(string)
+		assert.True(t, strings.HasPrefix(object["id"].(string), objectType+"--"), "ids must be prefixed with the object type")
+		assert.Equal(t, "2.1", object["spec_version"])
+		byType[objectType] = append(byType[objectType], object)
+	}
+
+	// the shared SNI is only exported once
+	require.Len(t, byType["domain-name"], 1)
+	assert.Equal(t, "c2.example.com", byType["domain-name"][0]["value"])
+
+	require.Len(t, byType["ipv4-addr"], 1)
+	assert.Equal(t, "10.0.0.1", byType["ipv4-addr"][0]["value"])
+	require.Len(t, byType["ipv6-addr"], 1)
+	assert.Equal(t, "fd00::1", byType["ipv6-addr"][0]["value"])
+
+	require.Len(t, byType["indicator"], 2)
+	indicator := byType["indicator"][0]
+	assert.Equal(t, "[domain-name:value = 'c2.example.com']", indicator["pattern"])
+	assert.Equal(t, "stix", indicator["pattern_type"])
+	assert.Equal(t, "2020-01-02T03:04:05.000Z", indicator["valid_from"])
+	assert.Equal(t, float64(95), indicator["confidence"])
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"source_name": "mitre-attack",
+		"external_id": "T1573.002",
+		"url":         "https://attack.mitre.org/techniques/T1573/002/",
+	}}, indicator["external_references"], "ATT&CK tags should be exported as external references")
+	_, ok := byType["indicator"][1]["external_references"]
+	assert.False(t, ok, "untagged beacons should not list references")
+
+	require.Len(t, byType["relationship"], 2)
+	relationship := byType["relationship"][0]
+	assert.Equal(t, "related-to", relationship["relationship_type"])
+	assert.Equal(t, indicator["id"], relationship["source_ref"])
+	assert.Equal(t, byType["ipv4-addr"][0]["id"], relationship["target_ref"])
+}
+
+func TestNewSTIXObservableDeterministic(t *testing.T) {
+	first := newSTIXObservable("domain-name", "c2.example.com")
+	second := newSTIXObservable("domain-name", "c2.example.com")
+	other := newSTIXObservable("domain-name", "cdn.example.com")
+
+	assert.Equal(t, first.ID, second.ID)
+	assert.NotEqual(t, first.ID, other.ID)
+}
+
+func TestEscapeSTIXString(t *testing.T) {
+	assert.Equal(t, `it\'s\\here`, escapeSTIXString(`it's\here`))
+}
@@ -0,0 +1,310 @@
+package beaconsni
+
+import (
+	"crypto/tls"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/activecm/rita/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	syslogAttempts     = 3                // tries per finding before it is dropped
+	syslogSeverity     = 4                // RFC 5424 warning severity
+	syslogAppName      = "rita"           // RFC 5424 APP-NAME
+	syslogMsgID        = "beaconSNI"      // RFC 5424 MSGID
+	syslogDialTimeout  = 5 * time.Second  // limit on connecting to the endpoint
+	syslogWriteTimeout = 5 * time.Second  // limit on sending a single finding
+	syslogFlushTimeout = 30 * time.Second // limit on sending the buffered findings when closing
+	syslogTimeFormat   = "2006-01-02T15:04:05.000000Z07:00"
+	cefVendor          = "Active Countermeasures"
+	cefProduct         = "RITA"
+	cefSignatureID     = "beaconSNI"
+	cefName            = "SNI Beacon"
+	cefSummaryID       = "beaconSNISummary"
+	cefSummaryName     = "SNI Beacon Alerts Suppressed"
+)
+
+//syslogRetryDelay is the wait before the first retry of a finding. It doubles with each retry.
+var syslogRetryDelay = time.Second
+
+//syslogSink sends findings to a syslog endpoint as RFC 5424 messages with CEF bodies.
+//Findings are buffered and sent by a single goroutine, so an unreachable endpoint never
+//blocks the analysis. Findings which don't fit in the buffer, or which can't be sent
+//after syslogAttempts tries, are dropped and counted.
+type syslogSink struct {
+	network  string      // udp, tcp, or tls
+	address  string      // host:port of the endpoint
+	tlsConf  *tls.Config // used to verify tls endpoints
+	facility int         // RFC 5424 facility
+	minScore float64     // findings scoring below this are not sent
+	hostname string      // RFC 5424 HOSTNAME
+	procID   string      // RFC 5424 PROCID
+	version  string      // RITA version reported in the CEF header
+	log      *log.Logger
+	queue    chan Finding  // findings waiting to be sent
+	done     chan struct{} // closed when the sender goroutine exits
+	stop     chan struct{} // closed when Close gives up waiting on the endpoint
+	conn     net.Conn      // current connection to the endpoint (nil if disconnected)
+	sent     int64         // findings delivered so far
+	dropped  int64         // findings dropped so far
+	warnOnce sync.Once     // the first delivery failure is logged as a warning
+}
+
+//newSyslogSink creates a syslog sink and starts its sender goroutine. The endpoint is
+//connected to when the first finding is sent.
+func newSyslogSink(conf *config.Config, logger *log.Logger) *syslogSink {
+	cfg := conf.S.BeaconSNI.Syslog
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	s := &syslogSink{
+		network:  cfg.Network,
+		address:  cfg.Address,
+		tlsConf:  conf.R.BeaconSNI.Syslog.TLSConfig,
+		facility: cfg.Facility,
+		minScore: cfg.MinScore,
+		hostname: syslogHeaderField(hostname, 255),
+		procID:   strconv.Itoa(os.Getpid()),
+		version:  conf.S.Version,
+		log:      logger,
+		queue:    make(chan Finding, cfg.BufferSize),
+		done:     make(chan struct{}),
+		stop:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+//Emit queues a finding to be sent. Findings scoring below BeaconSNI.Syslog.MinScore are
+//skipped, and if the buffer is full the finding is dropped.
+func (s *syslogSink) Emit(finding Finding) {
+	if finding.Score < s.minScore {
+		return
+	}
+	select {
+	case s.queue <- finding:
+	default:
+		s.drop(fmt.Errorf("the buffer of %d findings is full", cap(s.queue)))
+	}
+}
+
+//Close waits for the buffered findings to be sent and disconnects from the endpoint.
+//Findings still waiting after syslogFlushTimeout are dropped. An error is returned
+//if any finding was dropped during the run.
+func (s *syslogSink) Close() error {
+	close(s.queue)
+	select {
+	case <-s.done:
+	case <-time.After(syslogFlushTimeout):
+		close(s.stop)
+		<-s.done
+	}
+
+	sent, dropped := atomic.LoadInt64(&s.sent), atomic.LoadInt64(&s.dropped)
+	s.log.WithFields(log.Fields{
+		"Module":  "beaconSNI",
+		"Address": s.address,
+		"Sent":    sent,
+		"Dropped": dropped,
+	}).Info("sent SNI beacon findings to syslog")
+
+	if dropped > 0 {
+		return fmt.Errorf("%d SNI beacon findings were not sent to syslog at %s", dropped, s.address)
+	}
+	return nil
+}
+
+//run sends the queued findings until the queue is closed
+func (s *syslogSink) run() {
+	defer close(s.done)
+	for finding := range s.queue {
+		select {
+		case <-s.stop:
+			s.drop(fmt.Errorf("timed out sending the buffered findings"))
+			continue
+		default:
+		}
+
+		if err := s.send(syslogMessage(finding, s.facility, s.hostname, s.procID, s.version, time.Now())); err != nil {
+			s.drop(err)
+		}
+	}
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+//send writes a single message to the endpoint, reconnecting and retrying with an
+//increasing delay if the write fails
+func (s *syslogSink) send(msg string) error {
+	var err error
+	for attempt := 0; attempt < syslogAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-s.stop:
+				return err
+			case <-time.After(syslogRetryDelay << uint(attempt-1)):
+			}
+		}
+
+		if s.conn == nil {
+			if s.conn, err = s.dial(); err != nil {
+				s.conn = nil
+				continue
+			}
+		}
+
+		s.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+		if _, err = s.conn.Write(syslogFrame(msg, s.network)); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			continue
+		}
+
+		atomic.AddInt64(&s.sent, 1)
+		return nil
+	}
+	return err
+}
+
+//dial connects to the endpoint
+func (s *syslogSink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogDialTimeout}
+	if s.network == config.SyslogTLS {
+		return tls.DialWithDialer(dialer, "tcp", s.address, s.tlsConf)
+	}
+	return dialer.Dial(s.network, s.address)
+}
+
+//drop counts a finding which won't be sent. Only the first failure is logged as a warning,
+//so an unreachable endpoint doesn't flood the log. The rest are logged at debug level.
+func (s *syslogSink) drop(err error) {
+	atomic.AddInt64(&s.dropped, 1)
+
+	entry := s.log.WithFields(log.Fields{
+		"Module":  "beaconSNI",
+		"Address": s.address,
+		"Error":   err.Error(),
+	})
+	warned := false
+	s.warnOnce.Do(func() {
+		warned = true
+		entry.Warn("could not send SNI beacon finding to syslog, dropping it")
+	})
+	if !warned {
+		entry.Debug("could not send SNI beacon finding to syslog, dropping it")
+	}
+}
+
+//syslogMessage formats a finding as an RFC 5424 message with a CEF body. The structured
+//data is left empty (-) since the details are carried by the CEF extension.
+func syslogMessage(finding Finding, facility int, hostname string, procID string, version string, now time.Time) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %s %s - %s",
+		facility*8+syslogSeverity,
+		now.UTC().Format(syslogTimeFormat),
+		hostname,
+		syslogAppName,
+		procID,
+		syslogMsgID,
+		cefMessage(finding, version),
+	)
+}
+
+//syslogFrame prepares a message for the wire. Datagrams hold a single message, while
+//streams prefix each message with its length in bytes (RFC 6587 octet counting).
+func syslogFrame(msg string, network string) []byte {
+	if network == config.SyslogUDP {
+		return []byte(msg)
+	}
+	return []byte(strconv.Itoa(len(msg)) + " " + msg)
+}
+
+//syslogHeaderField makes a value safe for an RFC 5424 header field, which must be printable
+//ASCII without spaces and at most maxLen characters. Empty values become the nil value (-).
+func syslogHeaderField(value string, maxLen int) string {
+	field := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, value)
+	if len(field) > maxLen {
+		field = field[:maxLen]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
+
+//cefMessage formats a finding as a CEF event. The severity is the score scaled to 0-10.
+//The source IP is mapped to src, the SNI to dhost, the connection count to cnt, the first
+//and last connections to start and end (milliseconds since the epoch), and the score to
+//the custom floating point field cfp1. The summary of the findings held back for a source
+//is sent as its own event type without a dhost. The number of findings held back is mapped
+//to the custom number field cn1, and the SNIs of the highest scoring ones to the custom
+//string field cs1, separated by commas.
+func cefMessage(finding Finding, version string) string {
+	signatureID, name := cefSignatureID, cefName
+	if finding.Overflow != nil {
+		signatureID, name = cefSummaryID, cefSummaryName
+	}
+
+	header := []string{
+		"CEF:0",
+		cefHeaderField(cefVendor),
+		cefHeaderField(cefProduct),
+		cefHeaderField(version),
+		cefHeaderField(signatureID),
+		cefHeaderField(name),
+		strconv.Itoa(int(math.Round(finding.Score * 10))),
+	}
+
+	extension := []string{"src=" + cefExtensionValue(finding.Hosts.SrcIP)}
+	if finding.Overflow == nil {
+		extension = append(extension, "dhost="+cefExtensionValue(finding.Hosts.FQDN))
+	}
+	extension = append(extension, "cnt="+strconv.FormatInt(finding.ConnectionCount, 10))
+	if !finding.FirstSeen.IsZero() {
+		extension = append(extension,
+			"start="+strconv.FormatInt(finding.FirstSeen.UnixMilli(), 10),
+			"end="+strconv.FormatInt(finding.LastSeen.UnixMilli(), 10),
+		)
+	}
+	extension = append(extension,
+		"cfp1="+strconv.FormatFloat(finding.Score, 'f', 3, 64),
+		"cfp1Label=score",
+	)
+	if finding.Overflow != nil {
+		extension = append(extension,
+			"cn1="+strconv.Itoa(finding.Overflow.Suppressed),
+			"cn1Label=suppressed",
+			"cs1="+cefExtensionValue(strings.Join(finding.Overflow.FQDNs, ",")),
+			"cs1Label=suppressedSNIs",
+		)
+	}
+
+	return strings.Join(header, "|") + "|" + strings.Join(extension, " ")
+}
+
+//cefHeaderField escapes the backslashes and pipes in a CEF header field
+func cefHeaderField(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`).Replace(value)
+}
+
+//cefExtensionValue escapes the backslashes, equal signs, and line breaks in a CEF extension value
+func cefExtensionValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r\n", `\n`, "\n", `\n`, "\r", `\r`).Replace(value)
+}
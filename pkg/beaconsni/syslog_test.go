@@ -0,0 +1,162 @@
+package beaconsni
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testFinding() Finding {
+	return Finding{
+		Hosts:           data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "10.0.0.1"}, FQDN: "c2.example.com"},
+		Score:           0.874,
+		ConnectionCount: 500,
+		FirstSeen:       time.Unix(1600000000, 0),
+		LastSeen:        time.Unix(1600086400, 0),
+	}
+}
+
+func TestCEFMessage(t *testing.T) {
+	assert.Equal(t,
+		"CEF:0|Active Countermeasures|RITA|v4.0.0|beaconSNI|SNI Beacon|9|"+
+			"src=10.0.0.1 dhost=c2.example.com cnt=500 start=1600000000000 end=1600086400000 cfp1=0.874 cfp1Label=score",
+		cefMessage(testFinding(), "v4.0.0"),
+	)
+
+	// findings without timestamps leave out start and end
+	finding := testFinding()
+	finding.FirstSeen, finding.LastSeen = time.Time{}, time.Time{}
+	assert.NotContains(t, cefMessage(finding, "v4.0.0"), "start=")
+}
+
+func TestCEFSummaryMessage(t *testing.T) {
+	finding := testFinding()
+	finding.Hosts.FQDN = ""
+	finding.Overflow = &OverflowSummary{Suppressed: 12, FQDNs: []string{"a.example.com", "b.example.com"}}
+
+	assert.Equal(t,
+		"CEF:0|Active Countermeasures|RITA|v4.0.0|beaconSNISummary|SNI Beacon Alerts Suppressed|9|"+
+			"src=10.0.0.1 cnt=500 start=1600000000000 end=1600086400000 cfp1=0.874 cfp1Label=score "+
+			"cn1=12 cn1Label=suppressed cs1=a.example.com,b.example.com cs1Label=suppressedSNIs",
+		cefMessage(finding, "v4.0.0"),
+	)
+}
+
+func TestCEFEscaping(t *testing.T) {
+	assert.Equal(t, `v4\|dev\\1`, cefHeaderField(`v4|dev\1`))
+	assert.Equal(t, `a\=b\\c\nd|e`, cefExtensionValue("a=b\\c\nd|e"))
+
+	finding := testFinding()
+	finding.Hosts.FQDN = "evil=name.example.com"
+	assert.Contains(t, cefMessage(finding, "v4.0.0"), `dhost=evil\=name.example.com `)
+}
+
+func TestSyslogMessage(t *testing.T) {
+	now := time.Date(2020, 9, 13, 12, 26, 40, 123456000, time.FixedZone("EST", -5*3600))
+	msg := syslogMessage(testFinding(), 16, "sensor", "4242", "v4.0.0", now)
+
+	// local0 (16) at warning severity (4)
+	assert.True(t, strings.HasPrefix(msg, "<132>1 2020-09-13T17:26:40.123456Z sensor rita 4242 beaconSNI - CEF:0|"), msg)
+}
+
+func TestSyslogFrame(t *testing.T) {
+	assert.Equal(t, "<132>1 msg", string(syslogFrame("<132>1 msg", config.SyslogUDP)))
+	assert.Equal(t, "10 <132>1 msg", string(syslogFrame("<132>1 msg", config.SyslogTCP)))
+	assert.Equal(t, "10 <132>1 msg", string(syslogFrame("<132>1 msg", config.SyslogTLS)))
+}
+
+func TestSyslogHeaderField(t *testing.T) {
+	assert.Equal(t, "sensor-1", syslogHeaderField("sensor -1\n", 255))
+	assert.Equal(t, "sens", syslogHeaderField("sensor", 4))
+	assert.Equal(t, "-", syslogHeaderField(" ", 255))
+}
+
+func newTestSyslogSink(network string, address string, minScore float64) *syslogSink {
+	logger := log.New()
+	logger.Out = ioutil.Discard
+
+	conf := &config.Config{}
+	conf.S.Version = "v4.0.0"
+	conf.S.BeaconSNI.Syslog = config.SyslogStaticCfg{
+		Enabled: true, Network: network, Address: address, Facility: 16, MinScore: minScore, BufferSize: 10,
+	}
+	return newSyslogSink(conf, logger)
+}
+
+func TestSyslogSinkTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer listener.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+
+		// read octet counted messages until the sink disconnects
+		var msgs []string
+		reader := bufio.NewReader(conn)
+		for {
+			length, err := reader.ReadString(' ')
+			if err != nil {
+				break
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(length))
+			if err != nil {
+				break
+			}
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(reader, msg); err != nil {
+				break
+			}
+			msgs = append(msgs, string(msg))
+		}
+		received <- msgs
+	}()
+
+	sink := newTestSyslogSink(config.SyslogTCP, listener.Addr().String(), 0.5)
+	sink.Emit(testFinding())
+	low := testFinding()
+	low.Score = 0.2
+	sink.Emit(low)
+	require.Nil(t, sink.Close())
+
+	msgs := <-received
+	require.Len(t, msgs, 1, "findings below the minimum score should not be sent")
+	assert.Contains(t, msgs[0], "src=10.0.0.1 dhost=c2.example.com cnt=500")
+}
+
+func TestSyslogSinkUnreachable(t *testing.T) {
+	// nothing listens on a closed listener's port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	oldDelay := syslogRetryDelay
+	syslogRetryDelay = time.Millisecond
+	defer func() { syslogRetryDelay = oldDelay }()
+
+	sink := newTestSyslogSink(config.SyslogTCP, address, 0)
+	sink.Emit(testFinding())
+	sink.Emit(testFinding())
+
+	assert.NotNil(t, sink.Close(), "dropped findings should be reported")
+	assert.EqualValues(t, 0, sink.sent)
+	assert.EqualValues(t, 2, sink.dropped)
+}
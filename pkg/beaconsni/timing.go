@@ -0,0 +1,168 @@
+package beaconsni
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/activecm/rita/config"
+)
+
+//timingFeatures measures the timing of a pair's connections for scoring and the timing
+//filters. The full timestamp list is sorted in place along the way.
+func (d *dissector) timingFeatures(analysisInput *DissectorResults) {
+	millis := d.conf.S.BeaconSNI.TimestampResolution == config.MillisecondResolution
+
+	analysisInput.JitterRatio = jitterRatio(analysisInput.TsListFull)
+
+	// a few missed or doubled check ins would otherwise spoil the timing scores of a regular
+	// beacon. The full intervals are kept alongside the trimmed ones so the trim can be reviewed.
+	if percent := d.conf.S.BeaconSNI.DeltaTrimPercent; percent > 0 {
+		analysisInput.Deltas = distinctDeltas(analysisInput.TsListFull)
+		analysisInput.TrimmedDeltas, analysisInput.WinsorizedDeltas = winsorize(analysisInput.Deltas, percent)
+	}
+
+	if d.decayHalfLife > 0 {
+		analysisInput.DecayedCount = decayedCount(analysisInput.TsListFull, d.decayEnd, d.decayHalfLife, millis)
+	}
+
+	if d.conf.S.BeaconSNI.HourHistogram {
+		analysisInput.HourHistogram = hourHistogram(analysisInput.TsListFull, d.conf.R.BeaconSNI.Location, millis)
+	}
+
+	// the strongest period is found on its own bins, so it isn't thrown off by the interval trimming
+	if cfg := d.conf.S.BeaconSNI.Periodogram; cfg.Enabled {
+		analysisInput.DominantPeriod, analysisInput.Periodicity = dominantPeriod(
+			analysisInput.TsListFull, cfg.BinSeconds, cfg.MaxBins, millis,
+		)
+	}
+
+	// jitterRatio sorted the timestamps, so the intervals between them can be read off in order
+	if spacing := d.conf.S.BeaconSNI.BrowsingBursts.MinSpacing; spacing > 0 {
+		if millis {
+			spacing *= 1000
+		}
+		analysisInput.ClusteredFraction = clusteredFraction(analysisInput.TsListFull, spacing)
+	}
+
+	analysisInput.DistinctDays = distinctDays(analysisInput.TsListFull, d.conf.R.BeaconSNI.Location, millis)
+}
+
+//irregularTiming returns true if the intervals between the given unique timestamps vary
+//more than configured. Such a pair is too irregular to be scored as a beacon, so it is cheaper
+//to drop it here than to send it through the rest of the analysis. When trimmedDeltas is given,
+//the winsorized intervals are checked instead, so a few outliers can't push a regular beacon
+//over the limit.
+func (d *dissector) irregularTiming(tsList []int64, trimmedDeltas []int64) bool {
+	maxCV := d.conf.S.BeaconSNI.MaxTimingCV
+	if maxCV <= 0 {
+		return false
+	}
+
+	if len(trimmedDeltas) > 0 {
+		return intervalCV(trimmedDeltas) > maxCV
+	}
+
+	// the sorter would sort the timestamps anyways, so sorting them in place costs nothing extra
+	sort.Slice(tsList, func(i, j int) bool { return tsList[i] < tsList[j] })
+	return timingCV(tsList) > maxCV
+}
+
+//browsingBurst returns true if more of a pair's connection intervals were clustered than
+//BeaconSNI.BrowsingBursts allows while its action is to filter the pair. Such a pair looks
+//like web browsing, which opens many connections while loading each page, rather than a beacon.
+func (d *dissector) browsingBurst(clustered float64) bool {
+	cfg := d.conf.S.BeaconSNI.BrowsingBursts
+	return cfg.MinSpacing > 0 && cfg.Action == config.BrowsingFilter && clustered > cfg.MaxClusteredFraction
+}
+
+//fewDistinctDays returns true if the connections of a pair fell on fewer distinct calendar days
+//than configured. Such a pair is a short lived burst rather than a beacon which persists from
+//day to day.
+func (d *dissector) fewDistinctDays(days int) bool {
+	minDays := d.conf.S.BeaconSNI.MinDistinctDays
+	return minDays > 0 && days < minDays
+}
+
+//timingCV returns the coefficient of variation (population standard deviation / mean) of the
+//intervals between the given sorted, unique timestamps. Perfectly regular timing has a CV of 0,
+//while randomly (exponentially) distributed intervals have a CV near 1. Fewer than two
+//intervals are treated as perfectly regular.
+func timingCV(sortedTs []int64) float64 {
+	if len(sortedTs) < 3 {
+		return 0
+	}
+
+	deltas := len(sortedTs) - 1
+	mean := float64(sortedTs[deltas]-sortedTs[0]) / float64(deltas)
+	if mean <= 0 {
+		return 0
+	}
+
+	var sumSquares float64
+	for i := 0; i < deltas; i++ {
+		diff := float64(sortedTs[i+1]-sortedTs[i]) - mean
+		sumSquares += diff * diff
+	}
+
+	return math.Sqrt(sumSquares/float64(deltas)) / mean
+}
+
+//jitterRatio returns the coefficient of variation of the intervals between every connection,
+//including those sharing a timestamp. Deliberately jittered C2 keeps this ratio steady from
+//run to run, much like a regular beacon keeps its interval. The timestamps are sorted in place
+//since the sorter would sort them anyways.
+func jitterRatio(tsListFull []int64) float64 {
+	sort.Slice(tsListFull, func(i, j int) bool { return tsListFull[i] < tsListFull[j] })
+	return timingCV(tsListFull)
+}
+
+//hourHistogram counts the given timestamps by the hour of the day they fall in within the
+//given location. Timestamps are Unix seconds, or milliseconds if millis is set. A nil location
+//is treated as UTC. Every connection is counted, so tsListFull should be given rather than
+//the unique timestamps.
+func hourHistogram(tsListFull []int64, location *time.Location, millis bool) [24]int {
+	var histogram [24]int
+	if location == nil {
+		location = time.UTC
+	}
+
+	for _, ts := range tsListFull {
+		var t time.Time
+		if millis {
+			t = time.Unix(0, ts*int64(time.Millisecond))
+		} else {
+			t = time.Unix(ts, 0)
+		}
+		histogram[t.In(location).Hour()]++
+	}
+	return histogram
+}
+
+//distinctDays counts the distinct calendar days the given timestamps fall on within the given
+//location. Timestamps are Unix seconds, or milliseconds if millis is set. A nil location is
+//treated as UTC. Each day runs from midnight to midnight in the location, so two connections a
+//minute apart either side of midnight fall on two days.
+func distinctDays(tsListFull []int64, location *time.Location, millis bool) int {
+	if location == nil {
+		location = time.UTC
+	}
+
+	type day struct {
+		year  int
+		month time.Month
+		day   int
+	}
+	days := make(map[day]struct{})
+	for _, ts := range tsListFull {
+		var t time.Time
+		if millis {
+			t = time.Unix(0, ts*int64(time.Millisecond))
+		} else {
+			t = time.Unix(ts, 0)
+		}
+		year, month, dayOfMonth := t.In(location).Date()
+		days[day{year, month, dayOfMonth}] = struct{}{}
+	}
+	return len(days)
+}
@@ -0,0 +1,109 @@
+package beaconsni
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimingCV(t *testing.T) {
+	assert.Equal(t, 0.0, timingCV([]int64{0, 60, 120, 180, 240}), "regular intervals should have no variation")
+	assert.Equal(t, 0.0, timingCV([]int64{0, 60}), "a single interval should be treated as regular")
+	assert.InDelta(t, 0.5, timingCV([]int64{0, 50, 200, 250, 400}), 0.0001)
+}
+
+func TestJitterRatio(t *testing.T) {
+	tsListFull := []int64{150, 0, 60, 90}
+	// intervals of 60, 30, and 60 have a mean of 50 and a standard deviation of sqrt(200)
+	assert.InDelta(t, math.Sqrt(200)/50, jitterRatio(tsListFull), 0.0001)
+	assert.Equal(t, []int64{0, 60, 90, 150}, tsListFull, "the timestamps should be sorted in place")
+
+	// duplicate timestamps are kept, so they count as zero length intervals
+	assert.InDelta(t, math.Sqrt(2), jitterRatio([]int64{0, 0, 0, 90}), 0.0001)
+	assert.Equal(t, 0.0, jitterRatio([]int64{30, 30, 30, 30}), "a mean interval of 0 should be guarded")
+}
+
+func TestIrregularTiming(t *testing.T) {
+	conf := &config.Config{}
+	d := newDissector(0, nil, nil, conf, nil, nil, nil)
+
+	tsList := []int64{400, 0, 250, 50, 200}
+	assert.False(t, d.irregularTiming(tsList, nil), "a MaxTimingCV of 0 should disable the gate")
+
+	conf.S.BeaconSNI.MaxTimingCV = 0.4
+	assert.True(t, d.irregularTiming(tsList, nil))
+	assert.Equal(t, []int64{0, 50, 200, 250, 400}, tsList, "the timestamps should be sorted in place")
+
+	conf.S.BeaconSNI.MaxTimingCV = 0.6
+	assert.False(t, d.irregularTiming(tsList, nil))
+
+	conf.S.BeaconSNI.MaxTimingCV = 0.4
+	assert.False(t, d.irregularTiming(tsList, []int64{100, 100, 100, 100}), "the trimmed intervals should be checked when given")
+}
+
+func TestHourHistogram(t *testing.T) {
+	// 2021-01-01 09:30 and 23:59 UTC, then 2021-01-02 00:00 UTC twice
+	tsListFull := []int64{1609493400, 1609545540, 1609545600, 1609545600}
+
+	histogram := hourHistogram(tsListFull, nil, false)
+	assert.Equal(t, 1, histogram[9])
+	assert.Equal(t, 1, histogram[23])
+	assert.Equal(t, 2, histogram[0], "repeated timestamps should each be counted")
+
+	// five hours behind UTC shifts every connection back by five hours
+	histogram = hourHistogram(tsListFull, time.FixedZone("UTC-5", -5*60*60), false)
+	assert.Equal(t, 1, histogram[4])
+	assert.Equal(t, 1, histogram[18])
+	assert.Equal(t, 2, histogram[19])
+
+	millis := make([]int64, len(tsListFull))
+	for i, ts := range tsListFull {
+		millis[i] = ts*1000 + 999
+	}
+	assert.Equal(t, hourHistogram(tsListFull, nil, false), hourHistogram(millis, nil, true), "milliseconds should be converted to seconds")
+}
+
+func TestDistinctDays(t *testing.T) {
+	// 2021-01-01 09:30 and 23:59 UTC, then 2021-01-02 00:00 UTC twice
+	tsListFull := []int64{1609493400, 1609545540, 1609545600, 1609545600}
+
+	assert.Equal(t, 2, distinctDays(tsListFull, nil, false))
+	assert.Equal(t, 0, distinctDays(nil, nil, false))
+
+	// five hours behind UTC, every connection falls on 2021-01-01
+	assert.Equal(t, 1, distinctDays(tsListFull, time.FixedZone("UTC-5", -5*60*60), false))
+
+	millis := make([]int64, len(tsListFull))
+	for i, ts := range tsListFull {
+		millis[i] = ts * 1000
+	}
+	assert.Equal(t, 2, distinctDays(millis, nil, true), "milliseconds should be converted to seconds")
+}
+
+func TestFewDistinctDays(t *testing.T) {
+	conf := &config.Config{}
+	d := newDissector(0, nil, nil, conf, nil, nil, nil)
+
+	assert.False(t, d.fewDistinctDays(1), "a MinDistinctDays of 0 should disable the filter")
+
+	conf.S.BeaconSNI.MinDistinctDays = 3
+	assert.True(t, d.fewDistinctDays(2))
+	assert.False(t, d.fewDistinctDays(3))
+}
+
+func TestBrowsingBurst(t *testing.T) {
+	conf := &config.Config{}
+	d := newDissector(0, nil, nil, conf, nil, nil, nil)
+
+	assert.False(t, d.browsingBurst(1), "a MinSpacing of 0 should disable the filter")
+
+	conf.S.BeaconSNI.BrowsingBursts = config.BrowsingBurstsStaticCfg{MinSpacing: 2, MaxClusteredFraction: 0.8, Action: config.BrowsingFilter}
+	assert.True(t, d.browsingBurst(0.9))
+	assert.False(t, d.browsingBurst(0.8))
+
+	conf.S.BeaconSNI.BrowsingBursts.Action = config.BrowsingDowngrade
+	assert.False(t, d.browsingBurst(0.9), "downgraded pairs should still be analyzed")
+}
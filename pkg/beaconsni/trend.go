@@ -0,0 +1,50 @@
+package beaconsni
+
+import "math"
+
+//countTrend fits a least squares line to the pair's connections per chunk, from the first chunk
+//the pair was seen in through currentChunk, and returns its slope in connections per chunk along
+//with the slope divided by the mean connections per chunk, clamped between 0 and 1. The http and
+//tls entries of a chunk are added together first, and chunks in the range in which the pair wasn't
+//seen count as 0 connections, so a pair which went quiet trends downwards. A pair seen in a single
+//chunk has a slope of 0.
+func countTrend(chunkCounts []chunkCount, currentChunk int) (float64, float64) {
+	perChunk := make(map[int]int64)
+	first := currentChunk
+	for _, chunk := range chunkCounts {
+		// chunks after the current one can only come from a database being re-imported
+		if chunk.CID > currentChunk {
+			continue
+		}
+		perChunk[chunk.CID] += chunk.Count
+		if chunk.CID < first {
+			first = chunk.CID
+		}
+	}
+
+	n := float64(currentChunk - first + 1)
+	if n < 2 || len(perChunk) == 0 {
+		return 0, 0
+	}
+
+	// the chunk ids are consecutive, so the mean of x is the middle chunk
+	meanX := float64(first+currentChunk) / 2
+	var total float64
+	for _, count := range perChunk {
+		total += float64(count)
+	}
+	meanY := total / n
+
+	var covariance, variance float64
+	for cid := first; cid <= currentChunk; cid++ {
+		dx := float64(cid) - meanX
+		covariance += dx * (float64(perChunk[cid]) - meanY)
+		variance += dx * dx
+	}
+
+	slope := covariance / variance
+	if meanY == 0 {
+		return slope, 0
+	}
+	return slope, math.Max(0, math.Min(1, slope/meanY))
+}
@@ -0,0 +1,33 @@
+package beaconsni
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountTrend(t *testing.T) {
+	// 10, 20, 30 connections over chunks 1 to 3, with chunk 2 split over http and tls
+	ramping := []chunkCount{{CID: 1, Count: 10}, {CID: 2, Count: 15}, {CID: 2, Count: 5}, {CID: 3, Count: 30}}
+	slope, ratio := countTrend(ramping, 3)
+	assert.InDelta(t, 10, slope, 1e-9)
+	assert.InDelta(t, 0.5, ratio, 1e-9, "the slope should be measured against the mean of 20 per chunk")
+
+	steady := []chunkCount{{CID: 4, Count: 20}, {CID: 5, Count: 20}, {CID: 6, Count: 20}}
+	slope, ratio = countTrend(steady, 6)
+	assert.InDelta(t, 0, slope, 1e-9)
+	assert.Equal(t, 0.0, ratio)
+
+	// chunks 2 and 3 had no connections, so the pair went quiet
+	quiet := []chunkCount{{CID: 1, Count: 30}}
+	slope, ratio = countTrend(quiet, 3)
+	assert.InDelta(t, -15, slope, 1e-9)
+	assert.Equal(t, 0.0, ratio, "falling counts should not be scored")
+
+	slope, ratio = countTrend([]chunkCount{{CID: 3, Count: 50}}, 3)
+	assert.Equal(t, 0.0, slope, "a single chunk should have no trend")
+	assert.Equal(t, 0.0, ratio)
+
+	slope, _ = countTrend(nil, 3)
+	assert.Equal(t, 0.0, slope)
+}
@@ -0,0 +1,76 @@
+package beaconsni
+
+import (
+	"math"
+	"sort"
+)
+
+//distinctDeltas returns the intervals between the distinct timestamps in the sorted
+//tsListFull, in ascending order. Duplicate timestamps are skipped rather than counted as
+//zero length intervals, so the intervals match those the scoring takes between the unique
+//timestamps in TsList.
+func distinctDeltas(tsListFull []int64) []int64 {
+	var deltas []int64
+	for i := 1; i < len(tsListFull); i++ {
+		if delta := tsListFull[i] - tsListFull[i-1]; delta > 0 {
+			deltas = append(deltas, delta)
+		}
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i] < deltas[j] })
+	return deltas
+}
+
+//winsorize returns a copy of the given ascending intervals with the lowest and highest
+//percent of them clamped to the lowest and highest intervals kept, along with the number of
+//intervals whose value changed. The number clamped at each end is rounded down, so nothing
+//changes until percent covers a whole interval. percent must be below 50. sorted is left
+//untouched.
+func winsorize(sorted []int64, percent float64) ([]int64, int) {
+	trimmed := make([]int64, len(sorted))
+	copy(trimmed, sorted)
+
+	n := len(sorted)
+	k := int(math.Floor(float64(n) * percent / 100))
+	if k <= 0 || n-1-k < k {
+		return trimmed, 0
+	}
+
+	low, high := sorted[k], sorted[n-1-k]
+	clamped := 0
+	for i := range trimmed {
+		if trimmed[i] < low {
+			trimmed[i] = low
+			clamped++
+		} else if trimmed[i] > high {
+			trimmed[i] = high
+			clamped++
+		}
+	}
+	return trimmed, clamped
+}
+
+//intervalCV returns the coefficient of variation (population standard deviation / mean) of the
+//given intervals. It matches timingCV for the intervals between the same timestamps. Fewer than
+//two intervals, or a mean of 0, are treated as perfectly regular.
+func intervalCV(deltas []int64) float64 {
+	if len(deltas) < 2 {
+		return 0
+	}
+
+	var sum float64
+	for _, delta := range deltas {
+		sum += float64(delta)
+	}
+	mean := sum / float64(len(deltas))
+	if mean <= 0 {
+		return 0
+	}
+
+	var sumSquares float64
+	for _, delta := range deltas {
+		diff := float64(delta) - mean
+		sumSquares += diff * diff
+	}
+
+	return math.Sqrt(sumSquares/float64(len(deltas))) / mean
+}
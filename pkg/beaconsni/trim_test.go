@@ -0,0 +1,74 @@
+package beaconsni
+
+import (
+	"math"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistinctDeltas(t *testing.T) {
+	assert.Equal(t, []int64{10, 10, 30}, distinctDeltas([]int64{0, 10, 10, 20, 20, 50}), "duplicate timestamps should be skipped")
+	assert.Nil(t, distinctDeltas([]int64{5, 5}))
+	assert.Nil(t, distinctDeltas(nil))
+}
+
+func TestWinsorize(t *testing.T) {
+	deltas := []int64{1, 58, 60, 60, 60, 60, 60, 61, 62, 300}
+
+	trimmed, clamped := winsorize(deltas, 10)
+	assert.Equal(t, []int64{58, 58, 60, 60, 60, 60, 60, 61, 62, 62}, trimmed)
+	assert.Equal(t, 2, clamped)
+	assert.Equal(t, int64(1), deltas[0], "the full intervals should be left alone")
+
+	trimmed, clamped = winsorize(deltas, 9.9)
+	assert.Equal(t, deltas, trimmed, "nothing should change until a whole interval is covered")
+	assert.Equal(t, 0, clamped)
+
+	// clamped intervals which already equal the bound aren't counted
+	trimmed, clamped = winsorize([]int64{60, 60, 60, 60, 60}, 20)
+	assert.Equal(t, []int64{60, 60, 60, 60, 60}, trimmed)
+	assert.Equal(t, 0, clamped)
+
+	trimmed, clamped = winsorize(nil, 10)
+	assert.Len(t, trimmed, 0)
+	assert.Equal(t, 0, clamped)
+}
+
+func TestIntervalCV(t *testing.T) {
+	ts := []int64{0, 50, 200, 250, 400}
+	assert.InDelta(t, timingCV(ts), intervalCV([]int64{50, 150, 50, 150}), 1e-9, "the CV should match that of the timestamps")
+	assert.Equal(t, 0.0, intervalCV([]int64{60}))
+	assert.Equal(t, 0.0, intervalCV([]int64{0, 0}))
+}
+
+func TestTrimmedDeltasScoring(t *testing.T) {
+	// a 60 second beacon which missed a check in and doubled up on another
+	ts := []int64{0}
+	for _, delta := range []int64{60, 60, 60, 60, 60, 60, 60, 1, 59, 60, 60, 60, 60, 60, 60, 120, 60, 60, 60, 60} {
+		ts = append(ts, ts[len(ts)-1]+delta)
+	}
+	bytes := make([]int64, len(ts))
+	for i := range bytes {
+		bytes[i] = 100
+	}
+	res := DissectorResults{
+		ConnectionCount: int64(len(ts)),
+		TsList:          ts,
+		TsListFull:      ts,
+		OrigBytesList:   bytes,
+	}
+
+	untrimmed := intervalCV(distinctDeltas(ts))
+	res.Deltas = distinctDeltas(ts)
+	res.TrimmedDeltas, res.WinsorizedDeltas = winsorize(res.Deltas, 10)
+	assert.Equal(t, 3, res.WinsorizedDeltas)
+	assert.True(t, intervalCV(res.TrimmedDeltas) < untrimmed/10, "trimming should take out most of the variation")
+
+	stats := computeStats(res, &config.Config{}, 0, ts[len(ts)-1])
+	assert.Equal(t, int64(119), stats.tsIntervalRange, "the range should cover the full intervals")
+	assert.Equal(t, 3, stats.tsWinsorized)
+	assert.Equal(t, int64(0), stats.tsMadm)
+	assert.False(t, math.IsNaN(stats.tsSkew))
+}
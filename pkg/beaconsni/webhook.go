@@ -0,0 +1,259 @@
+package beaconsni
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/activecm/rita/config"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	webhookAttempts     = 4                // tries per finding before it is dropped
+	webhookFlushTimeout = 30 * time.Second // limit on posting the buffered findings when closing
+	webhookTimeFormat   = time.RFC3339
+)
+
+//webhookRetryDelay is the wait before the first retry of a finding. It doubles with each retry.
+var webhookRetryDelay = time.Second
+
+//webhookPayload is the JSON object posted for each finding
+type webhookPayload struct {
+	Dataset         string             `json:"dataset"`
+	Src             string             `json:"src"`
+	SrcNetworkUUID  string             `json:"src_network_uuid,omitempty"`
+	SrcNetworkName  string             `json:"src_network_name"`
+	FQDN            string             `json:"fqdn"`
+	Score           float64            `json:"score"`
+	ConnectionCount int64              `json:"connection_count"`
+	FirstSeen       string             `json:"first_seen,omitempty"`
+	LastSeen        string             `json:"last_seen,omitempty"`
+	ScoreBreakdown  map[string]float64 `json:"score_breakdown"`
+	Version         string             `json:"rita_version"`
+	Summary         bool               `json:"summary,omitempty"`          // set on the summary of the findings held back for Src
+	Suppressed      int                `json:"suppressed,omitempty"`       // findings held back for Src
+	SuppressedFQDNs []string           `json:"suppressed_fqdns,omitempty"` // SNIs of the highest scoring findings held back
+}
+
+//webhookSink POSTs each finding to a webhook as a JSON object. Findings are buffered and
+//posted one at a time by a single goroutine, so a slow or unreachable webhook never blocks
+//the analysis. Findings which don't fit in the buffer, which the webhook rejects, or which
+//can't be delivered after webhookAttempts tries are dropped and counted.
+type webhookSink struct {
+	url           string
+	authorization string  // sent as the Authorization header if set
+	dataset       string  // RITA database the findings come from
+	version       string  // RITA version reported in each payload
+	minScore      float64 // findings scoring below this are not posted
+	client        *http.Client
+	log           *log.Logger
+	queue         chan Finding       // findings waiting to be posted
+	done          chan struct{}      // closed when the sender goroutine exits
+	ctx           context.Context    // cancelled when Close gives up waiting on the webhook
+	cancel        context.CancelFunc // cancels ctx
+	sent          int64              // findings delivered so far
+	dropped       int64              // findings dropped so far
+	warnOnce      sync.Once          // the first delivery failure is logged as a warning
+}
+
+//newWebhookSink creates a webhook sink and starts its sender goroutine
+func newWebhookSink(conf *config.Config, dataset string, logger *log.Logger) *webhookSink {
+	cfg := conf.S.BeaconSNI.Webhook
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &webhookSink{
+		url:           cfg.URL,
+		authorization: cfg.Authorization,
+		dataset:       dataset,
+		version:       conf.S.Version,
+		minScore:      cfg.MinScore,
+		client:        &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second},
+		log:           logger,
+		queue:         make(chan Finding, cfg.BufferSize),
+		done:          make(chan struct{}),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+	go s.run()
+	return s
+}
+
+//Emit queues a finding to be posted. Findings scoring below BeaconSNI.Webhook.MinScore are
+//skipped, and if the buffer is full the finding is dropped.
+func (s *webhookSink) Emit(finding Finding) {
+	if finding.Score < s.minScore {
+		return
+	}
+	select {
+	case s.queue <- finding:
+	default:
+		s.drop(fmt.Errorf("the buffer of %d findings is full", cap(s.queue)))
+	}
+}
+
+//Close waits for the buffered findings to be posted. Findings still waiting after
+//webhookFlushTimeout are dropped, and the request in flight is cancelled. An error
+//is returned if any finding was dropped during the run.
+func (s *webhookSink) Close() error {
+	close(s.queue)
+	select {
+	case <-s.done:
+	case <-time.After(webhookFlushTimeout):
+		s.cancel()
+		<-s.done
+	}
+	s.cancel()
+
+	sent, dropped := atomic.LoadInt64(&s.sent), atomic.LoadInt64(&s.dropped)
+	s.log.WithFields(log.Fields{
+		"Module":  "beaconSNI",
+		"URL":     s.url,
+		"Sent":    sent,
+		"Dropped": dropped,
+	}).Info("posted SNI beacon findings to the webhook")
+
+	if dropped > 0 {
+		return fmt.Errorf("%d SNI beacon findings were not posted to the webhook at %s", dropped, s.url)
+	}
+	return nil
+}
+
+//run posts the queued findings until the queue is closed
+func (s *webhookSink) run() {
+	defer close(s.done)
+	for finding := range s.queue {
+		if s.ctx.Err() != nil {
+			s.drop(fmt.Errorf("timed out posting the buffered findings"))
+			continue
+		}
+
+		body, err := json.Marshal(newWebhookPayload(finding, s.dataset, s.version))
+		if err == nil {
+			err = s.post(body)
+		}
+		if err != nil {
+			s.drop(err)
+		}
+	}
+}
+
+//post sends a single payload to the webhook, retrying with an increasing delay while the
+//request fails or the webhook responds with a status worth retrying
+func (s *webhookSink) post(body []byte) error {
+	var err error
+	for attempt := 0; attempt < webhookAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-s.ctx.Done():
+				return err
+			case <-time.After(webhookRetryDelay << uint(attempt-1)):
+			}
+		}
+
+		var retry bool
+		if retry, err = s.request(body); err == nil {
+			atomic.AddInt64(&s.sent, 1)
+			return nil
+		}
+		if !retry {
+			return err
+		}
+	}
+	return err
+}
+
+//request makes a single POST to the webhook. The returned bool is false if the webhook
+//rejected the payload in a way retrying won't fix.
+func (s *webhookSink) request(body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "RITA/"+s.version)
+	if s.authorization != "" {
+		req.Header.Set("Authorization", s.authorization)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	// the body is drained so the connection can be reused
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("the webhook responded with %s", resp.Status)
+	return webhookRetryable(resp.StatusCode), err
+}
+
+//webhookRetryable returns whether a request answered with the given status should be tried
+//again. Server errors, throttling, and timeouts may pass, while other client errors won't.
+func webhookRetryable(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests || status == http.StatusRequestTimeout
+}
+
+//drop counts a finding which won't be posted. Only the first failure is logged as a warning,
+//so an unreachable webhook doesn't flood the log. The rest are logged at debug level.
+func (s *webhookSink) drop(err error) {
+	atomic.AddInt64(&s.dropped, 1)
+
+	entry := s.log.WithFields(log.Fields{
+		"Module": "beaconSNI",
+		"URL":    s.url,
+		"Error":  err.Error(),
+	})
+	warned := false
+	s.warnOnce.Do(func() {
+		warned = true
+		entry.Warn("could not post SNI beacon finding to the webhook, dropping it")
+	})
+	if !warned {
+		entry.Debug("could not post SNI beacon finding to the webhook, dropping it")
+	}
+}
+
+//newWebhookPayload builds the JSON object posted for a finding. The network UUID is written
+//as its canonical string, and timestamps are written in UTC. Either is left out if unknown.
+//The summary of the findings held back for a source has an empty fqdn and lists the held
+//back findings under suppressed and suppressed_fqdns.
+func newWebhookPayload(finding Finding, dataset string, version string) webhookPayload {
+	payload := webhookPayload{
+		Dataset:         dataset,
+		Src:             finding.Hosts.SrcIP,
+		SrcNetworkName:  finding.Hosts.SrcNetworkName,
+		FQDN:            finding.Hosts.FQDN,
+		Score:           finding.Score,
+		ConnectionCount: finding.ConnectionCount,
+		ScoreBreakdown:  finding.ScoreBreakdown,
+		Version:         version,
+	}
+	if id, err := uuid.FromBytes(finding.Hosts.SrcNetworkUUID.Data); err == nil {
+		payload.SrcNetworkUUID = id.String()
+	}
+	if payload.ScoreBreakdown == nil {
+		payload.ScoreBreakdown = map[string]float64{}
+	}
+	if !finding.FirstSeen.IsZero() {
+		payload.FirstSeen = finding.FirstSeen.UTC().Format(webhookTimeFormat)
+		payload.LastSeen = finding.LastSeen.UTC().Format(webhookTimeFormat)
+	}
+	if finding.Overflow != nil {
+		payload.Summary = true
+		payload.Suppressed = finding.Overflow.Suppressed
+		payload.SuppressedFQDNs = finding.Overflow.FQDNs
+	}
+	return payload
+}
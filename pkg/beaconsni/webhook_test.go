@@ -0,0 +1,137 @@
+package beaconsni
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/activecm/rita/config"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWebhookSink(url string, minScore float64) *webhookSink {
+	logger := log.New()
+	logger.Out = ioutil.Discard
+
+	conf := &config.Config{}
+	conf.S.Version = "v4.0.0"
+	conf.S.BeaconSNI.Webhook = config.WebhookStaticCfg{
+		Enabled: true, URL: url, Authorization: "Bearer token", MinScore: minScore, Timeout: 5, BufferSize: 10,
+	}
+	return newWebhookSink(conf, "dataset", logger)
+}
+
+func TestWebhookPayload(t *testing.T) {
+	finding := testFinding()
+	finding.ScoreBreakdown = map[string]float64{"ts_skew": 0.9}
+
+	payload := newWebhookPayload(finding, "dataset", "v4.0.0")
+	assert.Equal(t, "10.0.0.1", payload.Src)
+	assert.Equal(t, "c2.example.com", payload.FQDN)
+	assert.Equal(t, "2020-09-13T12:26:40Z", payload.FirstSeen)
+	assert.Equal(t, "2020-09-14T12:26:40Z", payload.LastSeen)
+	assert.Equal(t, 0.9, payload.ScoreBreakdown["ts_skew"])
+
+	// unknown timestamps and breakdowns are left out rather than zeroed
+	finding.FirstSeen, finding.LastSeen, finding.ScoreBreakdown = time.Time{}, time.Time{}, nil
+	body, err := json.Marshal(newWebhookPayload(finding, "dataset", "v4.0.0"))
+	require.Nil(t, err)
+	assert.NotContains(t, string(body), "first_seen")
+	assert.Contains(t, string(body), `"score_breakdown":{}`)
+	assert.NotContains(t, string(body), "summary", "regular findings should not carry the summary fields")
+
+	finding.Overflow = &OverflowSummary{Suppressed: 12, FQDNs: []string{"a.example.com"}}
+	payload = newWebhookPayload(finding, "dataset", "v4.0.0")
+	assert.True(t, payload.Summary)
+	assert.Equal(t, 12, payload.Suppressed)
+	assert.Equal(t, []string{"a.example.com"}, payload.SuppressedFQDNs)
+}
+
+func TestWebhookRetryable(t *testing.T) {
+	assert.True(t, webhookRetryable(http.StatusServiceUnavailable))
+	assert.True(t, webhookRetryable(http.StatusTooManyRequests))
+	assert.False(t, webhookRetryable(http.StatusBadRequest))
+	assert.False(t, webhookRetryable(http.StatusUnauthorized))
+}
+
+func TestWebhookSink(t *testing.T) {
+	received := make(chan webhookPayload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+
+		var payload webhookPayload
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&payload))
+		received <- payload
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := newTestWebhookSink(server.URL, 0.5)
+	sink.Emit(testFinding())
+	low := testFinding()
+	low.Score = 0.2
+	sink.Emit(low)
+	require.Nil(t, sink.Close())
+	close(received)
+
+	var payloads []webhookPayload
+	for payload := range received {
+		payloads = append(payloads, payload)
+	}
+	require.Len(t, payloads, 1, "findings below the minimum score should not be posted")
+	assert.Equal(t, "dataset", payloads[0].Dataset)
+	assert.Equal(t, int64(500), payloads[0].ConnectionCount)
+}
+
+func TestWebhookSinkRetries(t *testing.T) {
+	oldDelay := webhookRetryDelay
+	webhookRetryDelay = time.Millisecond
+	defer func() { webhookRetryDelay = oldDelay }()
+
+	// the webhook fails twice before accepting the finding
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&requests, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sink := newTestWebhookSink(server.URL, 0)
+	sink.Emit(testFinding())
+	assert.Nil(t, sink.Close())
+	assert.EqualValues(t, 3, requests)
+	assert.EqualValues(t, 1, sink.sent)
+}
+
+func TestWebhookSinkRejected(t *testing.T) {
+	oldDelay := webhookRetryDelay
+	webhookRetryDelay = time.Millisecond
+	defer func() { webhookRetryDelay = oldDelay }()
+
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sink := newTestWebhookSink(server.URL, 0)
+	sink.Emit(testFinding())
+	sink.Emit(testFinding())
+
+	assert.NotNil(t, sink.Close(), "dropped findings should be reported")
+	assert.EqualValues(t, 2, requests, "rejected findings should not be retried")
+	assert.EqualValues(t, 0, sink.sent)
+	assert.EqualValues(t, 2, sink.dropped)
+}
@@ -0,0 +1,126 @@
+package beaconsni
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo/bson"
+)
+
+const (
+	zeekIntelDomain = "Intel::DOMAIN"
+	zeekIntelAddr   = "Intel::ADDR"
+)
+
+//zeekIntelHeader names the columns of the intel file as required by Zeek's input framework
+const zeekIntelHeader = "#fields\tindicator\tindicator_type\tmeta.source\n"
+
+type (
+	//zeekIntelBeacon holds the fields of a beaconSNI document needed to export its indicators
+	zeekIntelBeacon struct {
+		FQDN          string          `bson:"fqdn"`
+		RespondingIPs []data.UniqueIP `bson:"responding_ips"`
+	}
+
+	//zeekIntelWriter streams indicators as a Zeek intel framework file, writing each
+	//indicator only once
+	zeekIntelWriter struct {
+		w               *bufio.Writer
+		err             error
+		source          string          // meta.source of every indicator
+		domains         bool            // write the SNI of each beacon
+		ips             bool            // write the responding IPs of each beacon
+		internalSubnets []*net.IPNet    // responding IPs within these subnets are never written
+		seen            map[string]bool // indicators written so far
+	}
+)
+
+//ExportZeekIntel writes the SNI beacons scoring at least BeaconSNI.ExportMinScore to w as a
+//Zeek intel framework file, so Zeek can flag or block the beacons' destinations. Depending on
+//BeaconSNI.ZeekIntel.Indicators, the SNIs are written as Intel::DOMAIN indicators, the
+//responding IPs as Intel::ADDR indicators, or both. The highest scoring beacons come first.
+func (r *repo) ExportZeekIntel(w io.Writer) error {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	iter := session.DB(r.database.GetSelectedDB()).C(r.config.T.BeaconSNI.BeaconSNITable).
+		Find(bson.M{"score": bson.M{"$gte": r.config.S.BeaconSNI.ExportMinScore}}).
+		Select(bson.M{"_id": 0, "fqdn": 1, "responding_ips": 1}).
+		Sort("-score").
+		Iter()
+
+	intel := newZeekIntelWriter(w, r.config.S.BeaconSNI.ZeekIntel, util.ParseSubnets(r.config.S.Filtering.InternalSubnets))
+
+	var beacon zeekIntelBeacon
+	for iter.Next(&beacon) {
+		intel.add(beacon)
+		beacon = zeekIntelBeacon{}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+
+	return intel.close()
+}
+
+//newZeekIntelWriter creates a zeekIntelWriter and writes the header of the intel file
+func newZeekIntelWriter(w io.Writer, cfg config.ZeekIntelStaticCfg, internalSubnets []*net.IPNet) *zeekIntelWriter {
+	intel := &zeekIntelWriter{
+		w:               bufio.NewWriter(w),
+		source:          cfg.Source,
+		domains:         cfg.Indicators == config.ZeekIntelDomains || cfg.Indicators == config.ZeekIntelBoth,
+		ips:             cfg.Indicators == config.ZeekIntelIPs || cfg.Indicators == config.ZeekIntelBoth,
+		internalSubnets: internalSubnets,
+		seen:            make(map[string]bool),
+	}
+	_, intel.err = intel.w.WriteString(zeekIntelHeader)
+	return intel
+}
+
+//add writes the indicators of a beacon which haven't been written yet. Internal responding
+//IPs are left out, since blocking them would cut off hosts on the local network.
+func (z *zeekIntelWriter) add(beacon zeekIntelBeacon) {
+	if z.domains {
+		z.write(beacon.FQDN, zeekIntelDomain)
+	}
+	if !z.ips {
+		return
+	}
+	for _, responder := range beacon.RespondingIPs {
+		ip := net.ParseIP(responder.IP)
+		if ip == nil || util.ContainsIP(z.internalSubnets, ip) {
+			continue
+		}
+		// normalize the address so the same IP is only written once
+		z.write(ip.String(), zeekIntelAddr)
+	}
+}
+
+//write writes a single indicator line. Indicators which are empty, already written, or
+//which would break up the tab separated line are skipped.
+func (z *zeekIntelWriter) write(indicator string, indicatorType string) {
+	if z.err != nil || indicator == "" || strings.ContainsAny(indicator, "\t\r\n") {
+		return
+	}
+
+	key := indicatorType + "\t" + indicator
+	if z.seen[key] {
+		return
+	}
+	z.seen[key] = true
+
+	_, z.err = z.w.WriteString(indicator + "\t" + indicatorType + "\t" + z.source + "\n")
+}
+
+//close writes out any buffered lines and returns the first error hit while writing
+func (z *zeekIntelWriter) close() error {
+	if z.err != nil {
+		return z.err
+	}
+	return z.w.Flush()
+}
@@ -0,0 +1,49 @@
+package beaconsni
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/activecm/rita/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testZeekIntel(indicators string) string {
+	beacons := []zeekIntelBeacon{
+		{FQDN: "a.example.com", RespondingIPs: []data.UniqueIP{{IP: "1.1.1.1"}, {IP: "10.0.0.5"}}},
+		{FQDN: "b.example.com", RespondingIPs: []data.UniqueIP{{IP: "1.1.1.1"}, {IP: "2001:db8:0::1"}}},
+		{FQDN: "a.example.com", RespondingIPs: []data.UniqueIP{{IP: "2.2.2.2"}}},
+		{FQDN: "bad\tname.example.com"},
+	}
+
+	var buf bytes.Buffer
+	intel := newZeekIntelWriter(&buf, config.ZeekIntelStaticCfg{Indicators: indicators, Source: "RITA"}, util.ParseSubnets([]string{"10.0.0.0/8"}))
+	for _, beacon := range beacons {
+		intel.add(beacon)
+	}
+	if err := intel.close(); err != nil {
+		return err.Error()
+	}
+	return buf.String()
+}
+
+func TestZeekIntelWriter(t *testing.T) {
+	header := "#fields\tindicator\tindicator_type\tmeta.source\n"
+	domains := "a.example.com\tIntel::DOMAIN\tRITA\n" +
+		"b.example.com\tIntel::DOMAIN\tRITA\n"
+
+	assert.Equal(t, header+domains, testZeekIntel(config.ZeekIntelDomains), "each SNI should be written once")
+
+	assert.Equal(t, header+
+		"1.1.1.1\tIntel::ADDR\tRITA\n"+
+		"2001:db8::1\tIntel::ADDR\tRITA\n"+
+		"2.2.2.2\tIntel::ADDR\tRITA\n",
+		testZeekIntel(config.ZeekIntelIPs), "internal responders should be left out")
+
+	both := testZeekIntel(config.ZeekIntelBoth)
+	require.Contains(t, both, "a.example.com\tIntel::DOMAIN\tRITA\n1.1.1.1\tIntel::ADDR\tRITA\n")
+	assert.NotContains(t, both, "bad", "indicators which would break up a line should be skipped")
+}
@@ -54,8 +54,8 @@ func (a *analyzer) close() {
 func (a *analyzer) start() {
 	a.analysisWg.Add(1)
 	go func() {
-		ssn := a.db.Session.Copy()
-		defer ssn.Close()
+		ssn := a.db.CopySession()
+		defer a.db.CloseSession(ssn)
 
 		for blacklistedIP := range a.analysisChannel {
 			blDstUconns, err := a.getUniqueConnsforBLDestination(blacklistedIP)
@@ -205,8 +205,8 @@ func appendBlacklistedSrcQuery(chunk int, blacklistedSrc data.UniqueIP, dstConnD
 //getUniqueConnsforBLDestination returns the IP addresses that contacted a given blacklisted IP along with the number
 //of connections and bytes sent
 func (a *analyzer) getUniqueConnsforBLDestination(blDestinationIP data.UniqueIP) ([]connectionPeer, error) {
-	ssn := a.db.Session.Copy()
-	defer ssn.Close()
+	ssn := a.db.CopySession()
+	defer a.db.CloseSession(ssn)
 
 	var blIPs []connectionPeer
 
@@ -250,8 +250,8 @@ func (a *analyzer) getUniqueConnsforBLDestination(blDestinationIP data.UniqueIP)
 //getUniqueConnsforBLSource returns the IP addresses that a given blacklisted IP contacted along with the number
 //of connections and bytes sent
 func (a *analyzer) getUniqueConnsforBLSource(blSourceIP data.UniqueIP) ([]connectionPeer, error) {
-	ssn := a.db.Session.Copy()
-	defer ssn.Close()
+	ssn := a.db.CopySession()
+	defer a.db.CloseSession(ssn)
 
 	var blIPs []connectionPeer
 
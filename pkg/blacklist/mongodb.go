@@ -33,8 +33,8 @@ func NewMongoRepository(db *database.DB, conf *config.Config, logger *log.Logger
 
 //CreateIndexes sets up the indices needed to find hosts which contacted unsafe hosts
 func (r *repo) CreateIndexes() error {
-	session := r.database.Session.Copy()
-	defer session.Close()
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
 
 	coll := session.DB(r.database.GetSelectedDB()).C(r.config.T.Structure.HostTable)
 
@@ -82,8 +82,8 @@ func (r *repo) Upsert() {
 	// NOTE: we cannot use the (hostMap map[string]*host.Input)
 	// since we are creating peer statistic summaries for the entire
 	// observation period not just this import session
-	session := r.database.Session.Copy()
-	defer session.Close()
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
 
 	unsafeHostsQuery := session.DB(r.database.GetSelectedDB()).C(r.config.T.Structure.HostTable).Find(bson.M{"blacklisted": true})
 
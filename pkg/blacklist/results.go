@@ -10,8 +10,8 @@ import (
 //descending order keyed on of {uconn_count, conn_count, total_bytes} depending on the value
 //of sort. limit and noLimit control how many results are returned.
 func HostnameResults(res *resources.Resources, sort string, limit int, noLimit bool) ([]HostnameResult, error) {
-	ssn := res.DB.Session.Copy()
-	defer ssn.Close()
+	ssn := res.DB.CopySession()
+	defer res.DB.CloseSession(ssn)
 
 	blHostsQuery := []bson.M{
 		// find blacklisted hostnames and the IPs associated with them
@@ -128,8 +128,8 @@ func DstIPResults(res *resources.Resources, sort string, limit int, noLimit bool
 //to find blacklisted source IPs. Set sourceDestFlag to false to find blacklisted
 //destination IPs.
 func ipResults(res *resources.Resources, sort string, limit int, noLimit bool, sourceDestFlag bool) ([]IPResult, error) {
-	ssn := res.DB.Session.Copy()
-	defer ssn.Close()
+	ssn := res.DB.CopySession()
+	defer res.DB.CloseSession(ssn)
 
 	var hostMatch bson.M
 	var blHostField string
@@ -46,8 +46,8 @@ func (w *writer) close() {
 func (w *writer) start() {
 	w.writeWg.Add(1)
 	go func() {
-		ssn := w.db.Session.Copy()
-		defer ssn.Close()
+		ssn := w.db.CopySession()
+		defer w.db.CloseSession(ssn)
 
 		bulk := ssn.DB(w.db.GetSelectedDB()).C(w.targetCollection).Bulk()
 		bulk.Unordered()
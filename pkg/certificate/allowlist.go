@@ -0,0 +1,51 @@
+package certificate
+
+import (
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+)
+
+//CertNameSet is a set of the issuer and subject names of the invalid certificates a server
+//presented. Unlike an IssuedCertSet, certificates without an issuer are kept, so that a
+//server is never mistaken for one which only presented allow listed certificates.
+type CertNameSet map[IssuedCert]struct{}
+
+//Insert adds a certificate to the set. Names logged as "-" are stored as empty strings.
+func (s CertNameSet) Insert(cert IssuedCert) {
+	if cert.Issuer == "-" {
+		cert.Issuer = ""
+	}
+	if cert.Subject == "-" {
+		cert.Subject = ""
+	}
+	s[cert] = struct{}{}
+}
+
+//filterAllowListed returns a copy of the given certificate input without its invalid
+//certificate details if every invalid certificate the server presented is allowed by the
+//allow list, or nil if the server has nothing else to flag. The input is returned as is when
+//the allow list is empty, the server presented no invalid certificates, or any of them is
+//not allowed.
+func filterAllowListed(input *Input, allowList config.CertAllowList) *Input {
+	if len(allowList) == 0 || len(input.InvalidCertNames) == 0 {
+		return input
+	}
+
+	for cert := range input.InvalidCertNames {
+		if !allowList.Allows(cert.Subject, cert.Issuer) {
+			return input
+		}
+	}
+
+	// the SNI mismatch, validity, and chain depth flags don't depend on the certificate being invalid
+	if len(input.SNIMismatches) == 0 && !input.YoungCert && !input.ExpiringCert && !input.OddChainDepth {
+		return nil
+	}
+
+	filtered := *input
+	filtered.Seen = 0
+	filtered.InvalidCerts = make(data.StringSet)
+	filtered.Issued = make(IssuedCertSet)
+	filtered.InvalidCertNames = make(CertNameSet)
+	return &filtered
+}
@@ -0,0 +1,61 @@
+package certificate
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterAllowListed(t *testing.T) {
+	allowList, err := config.ParseCertAllowList([]config.CertAllowRule{{Subject: "CN=printer-*.corp.local*"}})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	newInput := func(subject string) *Input {
+		input := &Input{
+			Host:             data.UniqueIP{IP: "10.0.0.9"},
+			Seen:             3,
+			InvalidCerts:     make(data.StringSet),
+			Issued:           make(IssuedCertSet),
+			InvalidCertNames: make(CertNameSet),
+		}
+		input.InvalidCerts.Insert("self signed certificate")
+		input.InvalidCertNames.Insert(IssuedCert{Issuer: subject, Subject: subject})
+		return input
+	}
+
+	printer := newInput("CN=printer-2nd-floor.corp.local,O=HP")
+	assert.Nil(t, filterAllowListed(printer, allowList), "servers only presenting allowed certificates should be skipped")
+
+	unknown := newInput("CN=login.example.com")
+	assert.Equal(t, unknown, filterAllowListed(unknown, allowList), "servers presenting other certificates should be kept as is")
+
+	// one certificate outside the allow list keeps the server flagged
+	printer.InvalidCertNames.Insert(IssuedCert{Issuer: "-", Subject: "-"})
+	assert.Equal(t, printer, filterAllowListed(printer, allowList))
+
+	// other flags are kept without the invalid certificate details
+	mismatched := newInput("CN=printer-lobby.corp.local")
+	mismatched.SNIMismatches = data.StringSet{"files.corp.local": struct{}{}}
+	filtered := filterAllowListed(mismatched, allowList)
+	if assert.NotNil(t, filtered) {
+		assert.Equal(t, int64(0), filtered.Seen)
+		assert.Len(t, filtered.InvalidCerts, 0)
+		assert.Len(t, filtered.SNIMismatches, 1)
+	}
+	assert.Len(t, mismatched.InvalidCerts, 1, "the input should be left alone")
+
+	// an odd chain depth keeps the server flagged as well
+	chained := newInput("CN=printer-basement.corp.local")
+	chained.OddChainDepth = true
+	filtered = filterAllowListed(chained, allowList)
+	if assert.NotNil(t, filtered) {
+		assert.True(t, filtered.OddChainDepth)
+		assert.Len(t, filtered.InvalidCerts, 0)
+	}
+
+	assert.Equal(t, printer, filterAllowListed(printer, nil), "an empty allow list should keep every server")
+}
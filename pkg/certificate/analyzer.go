@@ -1,6 +1,7 @@
 package certificate
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/activecm/rita/config"
@@ -15,7 +16,7 @@ type (
 		db               *database.DB   // provides access to MongoDB
 		conf             *config.Config // contains details needed to access MongoDB
 		analyzedCallback func(update)   // called on each analyzed result
-		closedCallback   func()         // called when .close() is called and no more calls to analyzedCallback will be made
+		closedCallback   func() error   // called when .close() is called and no more calls to analyzedCallback will be made
 		analysisChannel  chan *Input    // holds unanalyzed data
 		analysisWg       sync.WaitGroup // wait for analysis to finish
 	}
@@ -23,7 +24,7 @@ type (
 
 //newAnalyzer creates a new analyzer for recording connections that were made
 //with invalid certificates
-func newAnalyzer(chunk int, db *database.DB, conf *config.Config, analyzedCallback func(update), closedCallback func()) *analyzer {
+func newAnalyzer(chunk int, db *database.DB, conf *config.Config, analyzedCallback func(update), closedCallback func() error) *analyzer {
 	return &analyzer{
 		chunk:            chunk,
 		db:               db,
@@ -39,21 +40,27 @@ func (a *analyzer) collect(datum *Input) {
 	a.analysisChannel <- datum
 }
 
-//close waits for the analyzer to finish
-func (a *analyzer) close() {
+//close waits for the analyzer to finish and returns any error from the rest of the closing cascade
+func (a *analyzer) close() error {
 	close(a.analysisChannel)
 	a.analysisWg.Wait()
-	a.closedCallback()
+	return a.closedCallback()
 }
 
 //start kicks off a new analysis thread
 func (a *analyzer) start() {
 	a.analysisWg.Add(1)
 	go func() {
-		ssn := a.db.Session.Copy()
-		defer ssn.Close()
+		ssn := a.db.CopySession()
+		defer a.db.CloseSession(ssn)
 
 		for datum := range a.analysisChannel {
+			// servers which only presented known benign invalid certificates aren't flagged for them
+			datum = filterAllowListed(datum, a.conf.R.Certificate.AllowList)
+			if datum == nil {
+				continue
+			}
+
 			// cap the list to an arbitrary amount (hopefully smaller than the 16 MB document size cap)
 			// anything approaching this limit will cause performance issues in software that depends on rita
 			// anything tuncated over this limit won't be visible as an IP connecting to an invalid cert
@@ -72,16 +79,45 @@ func (a *analyzer) start() {
 				invalidCerts = invalidCerts[:10]
 			}
 
+			mismatchedSNIs := datum.SNIMismatches.Items()
+			if len(mismatchedSNIs) > 10 {
+				mismatchedSNIs = mismatchedSNIs[:10]
+			}
+
+			issued := datum.Issued.Items()
+			if len(issued) > 10 {
+				issued = issued[:10]
+			}
+
+			dat := bson.M{
+				"seen":            datum.Seen,
+				"orig_ips":        origIPs,
+				"tuples":          tuples,
+				"icodes":          invalidCerts,
+				"cid":             a.chunk,
+				"sni_mismatch":    len(mismatchedSNIs) > 0,
+				"mismatched_snis": mismatchedSNIs,
+				"young_cert":      datum.YoungCert,
+				"expiring_cert":   datum.ExpiringCert,
+			}
+			if datum.ValidityKnown {
+				dat["cert_age"] = datum.CertAge
+				dat["cert_remaining"] = datum.CertRemaining
+			}
+			if len(issued) > 0 {
+				dat["issued"] = issued
+			}
+			if len(datum.ChainDepths) > 0 {
+				chainDepths := datum.ChainDepths.Items()
+				sort.Ints(chainDepths)
+				dat["chain_depths"] = chainDepths
+				dat["odd_chain_depth"] = datum.OddChainDepth
+			}
+
 			// create certificateQuery
 			certificateQuery := bson.M{
 				"$push": bson.M{
-					"dat": bson.M{
-						"seen":     datum.Seen,
-						"orig_ips": origIPs,
-						"tuples":   tuples,
-						"icodes":   invalidCerts,
-						"cid":      a.chunk,
-					},
+					"dat": dat,
 				},
 				"$set": bson.M{
 					"cid":          a.chunk,
@@ -0,0 +1,11 @@
+package certificate
+
+//OddChainDepth returns true if a certificate chain holding depth certificates is shorter
+//than minDepth or longer than maxDepth. A limit of 0 disables its side of the check, and
+//an unknown depth of 0 is never odd.
+func OddChainDepth(depth int, minDepth int, maxDepth int) bool {
+	if depth <= 0 {
+		return false
+	}
+	return (minDepth > 0 && depth < minDepth) || (maxDepth > 0 && depth > maxDepth)
+}
@@ -0,0 +1,18 @@
+package certificate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOddChainDepth(t *testing.T) {
+	assert.True(t, OddChainDepth(1, 2, 4), "a lone self-signed certificate should be too short")
+	assert.True(t, OddChainDepth(6, 2, 4))
+	assert.False(t, OddChainDepth(2, 2, 4))
+	assert.False(t, OddChainDepth(4, 2, 4))
+
+	assert.False(t, OddChainDepth(9, 2, 0), "a maximum of 0 should disable the upper limit")
+	assert.False(t, OddChainDepth(1, 0, 4), "a minimum of 0 should disable the lower limit")
+	assert.False(t, OddChainDepth(0, 2, 4), "unknown depths should not be flagged")
+}
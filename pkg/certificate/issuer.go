@@ -0,0 +1,101 @@
+package certificate
+
+import (
+	"sort"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+type (
+	//IssuedCert is the issuer and subject distinguished names of a certificate
+	IssuedCert struct {
+		Issuer  string `bson:"issuer"`
+		Subject string `bson:"subject"`
+	}
+
+	//IssuedCertSet is a set of the certificates a server presented
+	IssuedCertSet map[IssuedCert]struct{}
+
+	//IssuerSummary counts the invalid certificates signed by a single issuer
+	IssuerSummary struct {
+		Issuer       string   `bson:"issuer"`
+		SubjectCount int      `bson:"subject_count"` // distinct subjects the issuer signed invalid certificates for
+		ServerCount  int      `bson:"server_count"`  // distinct servers which presented one of them
+		Subjects     []string `bson:"subjects"`      // up to 10 of the subjects
+	}
+)
+
+//Insert adds a certificate to the set. Certificates without an issuer are left out,
+//since they can't be grouped.
+func (s IssuedCertSet) Insert(cert IssuedCert) {
+	if cert.Issuer == "" || cert.Issuer == "-" {
+		return
+	}
+	if cert.Subject == "-" {
+		cert.Subject = ""
+	}
+	s[cert] = struct{}{}
+}
+
+//Items returns the certificates in the set ordered by issuer, then by subject
+func (s IssuedCertSet) Items() []IssuedCert {
+	certs := make([]IssuedCert, 0, len(s))
+	for cert := range s {
+		certs = append(certs, cert)
+	}
+	sort.Slice(certs, func(i, j int) bool {
+		if certs[i].Issuer != certs[j].Issuer {
+			return certs[i].Issuer < certs[j].Issuer
+		}
+		return certs[i].Subject < certs[j].Subject
+	})
+	return certs
+}
+
+//InvalidCertIssuers groups the invalid certificates recorded in the cert collection by issuer
+//and returns the issuers which signed invalid certificates for at least minSubjects distinct
+//subjects, ordered by descending subject count. Issuers are only recorded when
+//Certificate.GroupByIssuer is enabled.
+func (r *repo) InvalidCertIssuers(minSubjects int) ([]IssuerSummary, error) {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	var summaries []IssuerSummary
+
+	err := session.DB(r.database.GetSelectedDB()).C(r.config.T.Cert.CertificateTable).
+		Pipe(invalidCertIssuersPipeline(minSubjects)).AllowDiskUse().All(&summaries)
+
+	return summaries, err
+}
+
+//invalidCertIssuersPipeline unwinds the certificates recorded in each dat subdocument and
+//groups them by issuer, counting the distinct subjects and servers of each issuer. Subjects
+//which weren't logged are left out of the subject count.
+func invalidCertIssuersPipeline(minSubjects int) []bson.M {
+	return []bson.M{
+		{"$match": bson.M{"dat.issued.issuer": bson.M{"$exists": true}}},
+		{"$project": bson.M{
+			"_id":          0,
+			"ip":           1,
+			"network_uuid": 1,
+			"dat.issued":   1,
+		}},
+		{"$unwind": "$dat"},
+		{"$unwind": "$dat.issued"},
+		{"$group": bson.M{
+			"_id":      "$dat.issued.issuer",
+			"subjects": bson.M{"$addToSet": "$dat.issued.subject"},
+			"servers":  bson.M{"$addToSet": bson.M{"ip": "$ip", "network_uuid": "$network_uuid"}},
+		}},
+		{"$project": bson.M{
+			"_id":          0,
+			"issuer":       "$_id",
+			"subjects":     bson.M{"$setDifference": []interface{}{"$subjects", []string{""}}},
+			"server_count": bson.M{"$size": "$servers"},
+		}},
+		{"$addFields": bson.M{"subject_count": bson.M{"$size": "$subjects"}}},
+		{"$match": bson.M{"subject_count": bson.M{"$gte": minSubjects}}},
+		{"$sort": bson.D{{Name: "subject_count", Value: -1}, {Name: "server_count", Value: -1}, {Name: "issuer", Value: 1}}},
+		{"$addFields": bson.M{"subjects": bson.M{"$slice": []interface{}{"$subjects", 10}}}},
+	}
+}
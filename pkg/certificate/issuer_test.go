@@ -0,0 +1,35 @@
+package certificate
+
+import (
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIssuedCertSet(t *testing.T) {
+	issued := make(IssuedCertSet)
+	issued.Insert(IssuedCert{Issuer: "CN=Evil CA", Subject: "CN=b.example.com"})
+	issued.Insert(IssuedCert{Issuer: "CN=Evil CA", Subject: "CN=a.example.com"})
+	issued.Insert(IssuedCert{Issuer: "CN=Evil CA", Subject: "CN=a.example.com"})
+	issued.Insert(IssuedCert{Issuer: "CN=Another CA", Subject: "-"})
+
+	// certificates without an issuer can't be grouped
+	issued.Insert(IssuedCert{Issuer: "", Subject: "CN=c.example.com"})
+	issued.Insert(IssuedCert{Issuer: "-", Subject: "CN=c.example.com"})
+
+	assert.Equal(t, []IssuedCert{
+		{Issuer: "CN=Another CA", Subject: ""},
+		{Issuer: "CN=Evil CA", Subject: "CN=a.example.com"},
+		{Issuer: "CN=Evil CA", Subject: "CN=b.example.com"},
+	}, issued.Items())
+}
+
+func TestInvalidCertIssuersPipeline(t *testing.T) {
+	pipeline := invalidCertIssuersPipeline(3)
+
+	assert.Equal(t, bson.M{"dat.issued.issuer": bson.M{"$exists": true}}, pipeline[0]["$match"])
+	assert.Equal(t, "$dat.issued.issuer", pipeline[4]["$group"].(bson.M)["_id"])
+	assert.Equal(t, bson.M{"subject_count": bson.M{"$gte": 3}}, pipeline[7]["$match"])
+	assert.Equal(t, "subject_count", pipeline[8]["$sort"].(bson.D)[0].Name)
+}
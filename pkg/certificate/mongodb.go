@@ -7,8 +7,7 @@ import (
 	"github.com/activecm/rita/database"
 	"github.com/activecm/rita/util"
 	"github.com/globalsign/mgo"
-	"github.com/vbauerster/mpb"
-	"github.com/vbauerster/mpb/decor"
+	"github.com/globalsign/mgo/bson"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -30,8 +29,8 @@ func NewMongoRepository(db *database.DB, conf *config.Config, logger *log.Logger
 
 //CreateIndexes creates indexes for the certificate collection
 func (r *repo) CreateIndexes() error {
-	session := r.database.Session.Copy()
-	defer session.Close()
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
 
 	// set collection name
 	collectionName := r.config.T.Cert.CertificateTable
@@ -46,9 +45,11 @@ func (r *repo) CreateIndexes() error {
 		}
 	}
 
+	// every upsert during analysis selects on the unique index, so it is always built up front.
+	// The seen index only speeds up reporting, so it may be built in the background.
 	indexes := []mgo.Index{
 		{Key: []string{"ip", "network_uuid"}, Unique: true},
-		{Key: []string{"dat.seen"}},
+		{Key: []string{"dat.seen"}, Background: r.config.S.MongoDB.BackgroundIndexing},
 	}
 
 	// create collection
@@ -60,8 +61,31 @@ func (r *repo) CreateIndexes() error {
 	return nil
 }
 
-//Upser records the given certificate data in MongoDB
+//Upsert records the given certificate data in MongoDB
 func (r *repo) Upsert(certMap map[string]*Input) {
+	input := make(chan *Input)
+	go func() {
+		for _, value := range certMap {
+			input <- value
+		}
+		close(input)
+	}()
+
+	r.analyze(input, int64(len(certMap)))
+}
+
+//UpsertStream records the certificate data received from input in MongoDB, which the caller
+//populates and must close once every server has been sent. Servers are handed to the analyzer
+//workers as they arrive, so only the servers waiting in the worker queues are held in memory
+//rather than the whole dataset. Since the servers can't be counted ahead of time, progress is
+//shown with a spinner. Otherwise, the servers are recorded as they are in Upsert.
+func (r *repo) UpsertStream(input <-chan *Input) {
+	r.analyze(input, -1)
+}
+
+//analyze records the certificate data received from input until it is closed. total sizes
+//the progress bar, and a negative total shows a spinner instead.
+func (r *repo) analyze(input <-chan *Input, total int64) {
 	// Create the workers
 	writerWorker := newWriter(r.config.T.Cert.CertificateTable, r.database, r.config, r.log)
 
@@ -79,24 +103,85 @@ func (r *repo) Upsert(certMap map[string]*Input) {
 		writerWorker.start()
 	}
 
-	// progress bar for troubleshooting
-	p := mpb.New(mpb.WithWidth(20))
-	bar := p.AddBar(int64(len(certMap)),
-		mpb.PrependDecorators(
-			decor.Name("\t[-] Invalid Cert Analysis:", decor.WC{W: 30, C: decor.DidentRight}),
-			decor.CountersNoUnit(" %d / %d ", decor.WCSyncWidth),
-		),
-		mpb.AppendDecorators(decor.Percentage()),
-	)
+	// progress bar for troubleshooting. Streamed servers can't be counted ahead of time.
+	var bar *util.Progress
+	if total < 0 {
+		bar = util.NewIndeterminateProgress("\t[-] Invalid Cert Analysis")
+	} else {
+		bar = util.NewCountedProgress("\t[-] Invalid Cert Analysis:", total)
+	}
 
-	// loop over map entries
-	for _, value := range certMap {
-		analyzerWorker.collect(value)
-		bar.IncrBy(1)
+	// loop over the servers as they arrive
+	for value := range input {
+		// servers only contacted by sources which are never analyzed have nothing left to report
+		if filtered := filterSources(value, r.config.R.Filtering.NeverAnalyzeSources); filtered != nil {
+			analyzerWorker.collect(filtered)
+		}
+		bar.Increment()
 	}
 
-	p.Wait()
+	bar.Wait()
 
 	// start the closing cascade (this will also close the other channels)
-	analyzerWorker.close()
+	if err := analyzerWorker.close(); err != nil {
+		r.log.WithFields(log.Fields{
+			"Module": "cert",
+			"Error":  err.Error(),
+		}).Error("certificate analysis results were not fully saved")
+	}
+}
+
+//PurgeChunk removes the given chunk's contribution to the certificate collection. Each
+//import adds its own dat subdocument, so the chunk's subdocuments are pulled, which takes
+//away their seen counts, source IPs, tuples, and validation errors. Servers left without
+//any subdocuments are removed, and servers last updated in the chunk have their cid moved
+//back to the latest chunk which still has data.
+func (r *repo) PurgeChunk(chunkID int) error {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+	coll := session.DB(r.database.GetSelectedDB()).C(r.config.T.Cert.CertificateTable)
+
+	_, err := coll.UpdateAll(
+		bson.M{"dat.cid": chunkID},
+		bson.M{"$pull": bson.M{"dat": bson.M{"cid": chunkID}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err = coll.RemoveAll(bson.M{"dat": bson.M{"$size": 0}}); err != nil {
+		return err
+	}
+
+	var server struct {
+		ID  bson.ObjectId `bson:"_id"`
+		Dat []struct {
+			CID int `bson:"cid"`
+		} `bson:"dat"`
+	}
+
+	iter := coll.Find(bson.M{"cid": chunkID}).Select(bson.M{"dat.cid": 1}).Iter()
+	for iter.Next(&server) {
+		cids := make([]int, 0, len(server.Dat))
+		for _, dat := range server.Dat {
+			cids = append(cids, dat.CID)
+		}
+
+		if err = coll.UpdateId(server.ID, bson.M{"$set": bson.M{"cid": latestChunk(cids)}}); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
+
+//latestChunk returns the highest of the given chunk ids
+func latestChunk(cids []int) int {
+	latest := 0
+	for i, cid := range cids {
+		if i == 0 || cid > latest {
+			latest = cid
+		}
+	}
+	return latest
 }
@@ -10,7 +10,9 @@ import (
 	"github.com/activecm/rita/pkg/data"
 	"github.com/activecm/rita/resources"
 	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo/bson"
 	"github.com/globalsign/mgo/dbtest"
+	"github.com/stretchr/testify/assert"
 )
 
 // Server holds the dbtest DBServer
@@ -19,6 +21,8 @@ var Server dbtest.DBServer
 // Set the test database
 var testTargetDB = "tmp_test_db"
 
+var testRes *resources.Resources
+
 var testRepo Repository
 
 var testCertificate = map[string]*Input{
@@ -28,7 +32,8 @@ var testCertificate = map[string]*Input{
 			NetworkUUID: util.PublicNetworkUUID,
 			NetworkName: util.PublicNetworkName,
 		},
-		InvalidCerts: []string{"I'm an invalid cert!", "me too!"},
+		InvalidCerts: data.StringSet{"I'm an invalid cert!": struct{}{}, "me too!": struct{}{}},
+		OrigIps:      make(data.UniqueIPSet),
 		Seen:         123,
 	},
 }
@@ -55,6 +60,62 @@ func TestUpsert(t *testing.T) {
 
 }
 
+func TestUpsertStream(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	server := &Input{
+		Host:         data.UniqueIP{IP: "20.0.1.1", NetworkUUID: util.PublicNetworkUUID, NetworkName: util.PublicNetworkName},
+		InvalidCerts: data.StringSet{"self signed certificate": struct{}{}},
+		OrigIps:      make(data.UniqueIPSet),
+		Seen:         4,
+	}
+	server.OrigIps.Insert(data.UniqueIP{IP: "20.0.1.2", NetworkUUID: util.PublicNetworkUUID, NetworkName: util.PublicNetworkName})
+
+	// the caller produces the servers, closing the input once they're all sent
+	input := make(chan *Input)
+	go func() {
+		input <- server
+		close(input)
+	}()
+	testRepo.UpsertStream(input)
+
+	var result struct {
+		Dat []struct {
+			Seen int64 `bson:"seen"`
+		} `bson:"dat"`
+	}
+	coll := ssn.DB(testTargetDB).C(testRes.Config.T.Cert.CertificateTable)
+	assert.Nil(t, coll.Find(bson.M{"ip": "20.0.1.1"}).One(&result))
+	assert.Len(t, result.Dat, 1)
+	assert.Equal(t, int64(4), result.Dat[0].Seen)
+}
+
+func TestPurgeChunk(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	coll := ssn.DB(testTargetDB).C(testRes.Config.T.Cert.CertificateTable)
+	assert.Nil(t, coll.Insert(
+		bson.M{"ip": "20.0.0.1", "cid": 3, "dat": []bson.M{{"cid": 3, "seen": 5}}},
+		bson.M{"ip": "20.0.0.2", "cid": 3, "dat": []bson.M{{"cid": 1, "seen": 2}, {"cid": 2, "seen": 4}, {"cid": 3, "seen": 6}}},
+	))
+
+	assert.Nil(t, testRepo.PurgeChunk(3))
+
+	count, err := coll.Find(bson.M{"ip": "20.0.0.1"}).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count, "servers only seen in the purged chunk should be removed")
+
+	var server struct {
+		CID int      `bson:"cid"`
+		Dat []bson.M `bson:"dat"`
+	}
+	assert.Nil(t, coll.Find(bson.M{"ip": "20.0.0.2"}).One(&server))
+	assert.Len(t, server.Dat, 2, "the purged chunk's seen count should be gone")
+	assert.Equal(t, 2, server.CID, "cid should fall back to the latest remaining chunk")
+}
+
 // TestMain wraps all tests with the needed initialized mock DB and fixtures
 func TestMain(m *testing.M) {
 	// Store temporary databases files in a temporary directory
@@ -62,9 +123,10 @@ func TestMain(m *testing.M) {
 	Server.SetPath(tempDir)
 
 	// Set the main session variable to the temporary MongoDB instance
-	res := resources.InitTestResources()
+	testRes = resources.InitTestResources()
+	testRes.DB.SelectDB(testTargetDB)
 
-	testRepo = NewMongoRepository(res.DB, res.Config, res.Log)
+	testRepo = NewMongoRepository(testRes.DB, testRes.Config, testRes.Log)
 
 	// Run the test suite
 	retCode := m.Run()
@@ -9,6 +9,9 @@ import (
 type Repository interface {
 	CreateIndexes() error
 	Upsert(useragentMap map[string]*Input)
+	UpsertStream(input <-chan *Input)
+	PurgeChunk(chunkID int) error
+	InvalidCertIssuers(minSubjects int) ([]IssuerSummary, error)
 }
 
 //update ....
@@ -24,6 +27,27 @@ type Input struct {
 	OrigIps      data.UniqueIPSet
 	InvalidCerts data.StringSet
 	Tuples       data.StringSet
+	// server names which didn't match the subject of the certificate the server presented
+	SNIMismatches data.StringSet
+	// issuer and subject of each invalid certificate the server presented
+	Issued IssuedCertSet
+	// issuer and subject of each invalid certificate the server presented, including those
+	// without an issuer, which are checked against Certificate.AllowList
+	InvalidCertNames CertNameSet
+	// first and last time the server presented each leaf certificate, keyed by the
+	// certificate's x509.log id or fingerprint
+	LeafCerts map[string]*CertSighting
+	// set by FlagValidity when the validity period of a leaf certificate is known
+	ValidityKnown bool
+	CertAge       int64 // seconds between the youngest certificate's issue and its first sighting
+	CertRemaining int64 // seconds between the last sighting and the soonest expiry
+	YoungCert     bool
+	ExpiringCert  bool
+	// lengths of the certificate chains the server presented, recorded when
+	// Certificate.MinChainDepth or Certificate.MaxChainDepth is set
+	ChainDepths data.IntSet
+	// set when a chain the server presented was outside the configured depths
+	OddChainDepth bool
 }
 
 //AnalysisView (for reporting)
@@ -0,0 +1,58 @@
+package certificate
+
+import "strings"
+
+//SNIMismatch returns true if the server name requested by a TLS client does not match
+//the common name in the subject of the certificate the server presented. Mismatches are
+//a sign of domain fronting. The check is skipped, returning false, if either the server
+//name or the common name is missing. Wildcard common names match a single label.
+func SNIMismatch(serverName string, subject string) bool {
+	serverName = normalizeName(serverName)
+	commonName := normalizeName(commonName(subject))
+	if serverName == "" || commonName == "" {
+		return false
+	}
+
+	if strings.HasPrefix(commonName, "*.") {
+		// the wildcard covers exactly one label in front of the rest of the name
+		dot := strings.Index(serverName, ".")
+		return dot <= 0 || serverName[dot:] != commonName[1:]
+	}
+	return serverName != commonName
+}
+
+//commonName returns the value of the CN attribute in an RFC 2253 distinguished name such as
+//"CN=example.com,O=Example\, Inc.,C=US", or an empty string if there is none
+func commonName(subject string) string {
+	var attr strings.Builder
+	escaped := false
+
+	// walk the subject so escaped commas within a value don't split it
+	for _, c := range subject + "," {
+		switch {
+		case escaped:
+			attr.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == ',':
+			if name := strings.TrimSpace(attr.String()); len(name) > 3 && strings.EqualFold(name[:3], "CN=") {
+				return strings.TrimSpace(name[3:])
+			}
+			attr.Reset()
+		default:
+			attr.WriteRune(c)
+		}
+	}
+	return ""
+}
+
+//normalizeName lower cases a host name and strips its trailing dot. Zeek logs missing
+//values as "-", which is treated as an empty name.
+func normalizeName(name string) string {
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
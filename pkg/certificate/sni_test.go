@@ -0,0 +1,29 @@
+package certificate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommonName(t *testing.T) {
+	assert.Equal(t, "example.com", commonName("CN=example.com,O=Example Inc,C=US"))
+	assert.Equal(t, "example.com", commonName("C=US, O=Example\\, Inc., CN=example.com"))
+	assert.Equal(t, "", commonName("O=Example Inc,C=US"))
+	assert.Equal(t, "", commonName("-"))
+}
+
+func TestSNIMismatch(t *testing.T) {
+	assert.False(t, SNIMismatch("www.example.com", "CN=www.example.com,O=Example"))
+	assert.False(t, SNIMismatch("WWW.Example.com.", "CN=www.example.com"), "names should be compared case insensitively")
+	assert.False(t, SNIMismatch("a.example.com", "CN=*.example.com"))
+
+	assert.True(t, SNIMismatch("innocent.example.com", "CN=c2.evil.net"))
+	assert.True(t, SNIMismatch("a.b.example.com", "CN=*.example.com"), "a wildcard should only cover one label")
+	assert.True(t, SNIMismatch("example.com", "CN=*.example.com"))
+
+	// nothing can be said without both names
+	assert.False(t, SNIMismatch("", "CN=example.com"))
+	assert.False(t, SNIMismatch("-", "CN=example.com"))
+	assert.False(t, SNIMismatch("example.com", "O=Example Inc"))
+}
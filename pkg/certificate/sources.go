@@ -0,0 +1,33 @@
+package certificate
+
+import (
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+)
+
+//filterSources returns a copy of the given certificate input without the source IPs excluded
+//by the filter, or nil if every source was excluded. The input is returned as is when the
+//filter is empty or none of its sources are excluded.
+func filterSources(input *Input, neverAnalyze config.SourceFilter) *Input {
+	if len(neverAnalyze) == 0 {
+		return input
+	}
+
+	origIps := make(data.UniqueIPSet)
+	for key, ip := range input.OrigIps {
+		if !neverAnalyze.Excludes(ip.IP) {
+			origIps[key] = ip
+		}
+	}
+
+	if len(origIps) == len(input.OrigIps) {
+		return input
+	}
+	if len(origIps) == 0 {
+		return nil
+	}
+
+	filtered := *input
+	filtered.OrigIps = origIps
+	return &filtered
+}
@@ -0,0 +1,33 @@
+package certificate
+
+import (
+	"net"
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterSources(t *testing.T) {
+	_, scanners, _ := net.ParseCIDR("10.0.5.0/24")
+	filter := config.SourceFilter{scanners}
+
+	client := data.UniqueIP{IP: "10.0.0.1"}
+	scanner := data.UniqueIP{IP: "10.0.5.9"}
+	input := &Input{Host: data.UniqueIP{IP: "1.2.3.4"}, OrigIps: make(data.UniqueIPSet)}
+	input.OrigIps.Insert(client)
+
+	assert.Equal(t, input, filterSources(input, filter), "inputs without filtered sources should be kept as is")
+
+	input.OrigIps.Insert(scanner)
+	filtered := filterSources(input, filter)
+	if assert.NotNil(t, filtered) {
+		assert.Equal(t, []data.UniqueIP{client}, filtered.OrigIps.Items())
+	}
+	assert.Len(t, input.OrigIps, 2, "the input should be left alone")
+
+	onlyScanner := &Input{Host: data.UniqueIP{IP: "1.2.3.4"}, OrigIps: make(data.UniqueIPSet)}
+	onlyScanner.OrigIps.Insert(scanner)
+	assert.Nil(t, filterSources(onlyScanner, filter), "servers only contacted by filtered sources should be dropped")
+}
@@ -0,0 +1,58 @@
+package certificate
+
+type (
+	//Validity is the validity period of a certificate, as recorded in x509.log
+	Validity struct {
+		NotValidBefore int64
+		NotValidAfter  int64
+	}
+
+	//CertSighting records the first and last time a server presented a certificate
+	CertSighting struct {
+		FirstSeen int64
+		LastSeen  int64
+	}
+)
+
+//FlagValidity looks up the validity period of every leaf certificate the servers in certMap
+//presented and flags the servers which presented a certificate younger than minAge or
+//expiring within expiryWindow, both given in seconds. A threshold of 0 disables its flag.
+//Servers which were only recorded so their certificates could be checked, and weren't
+//flagged, are removed from certMap.
+func FlagValidity(certMap map[string]*Input, validity map[string]Validity, minAge int64, expiryWindow int64) {
+	for key, input := range certMap {
+		flagValidity(input, validity, minAge, expiryWindow)
+
+		if input.Seen == 0 && len(input.SNIMismatches) == 0 && !input.YoungCert && !input.ExpiringCert && !input.OddChainDepth {
+			delete(certMap, key)
+		}
+	}
+}
+
+//flagValidity sets the certificate age and remaining validity of a single server. The age is
+//measured when the server was first seen with a certificate and the remaining validity when
+//it was last seen, so the youngest and soonest expiring certificates decide the flags.
+func flagValidity(input *Input, validity map[string]Validity, minAge int64, expiryWindow int64) {
+	for cert, sighting := range input.LeafCerts {
+		period, ok := validity[cert]
+		if !ok {
+			continue // the certificate wasn't in the x509 logs parsed alongside this ssl log
+		}
+
+		age := sighting.FirstSeen - period.NotValidBefore
+		remaining := period.NotValidAfter - sighting.LastSeen
+		if !input.ValidityKnown || age < input.CertAge {
+			input.CertAge = age
+		}
+		if !input.ValidityKnown || remaining < input.CertRemaining {
+			input.CertRemaining = remaining
+		}
+		input.ValidityKnown = true
+	}
+
+	if !input.ValidityKnown {
+		return
+	}
+	input.YoungCert = minAge > 0 && input.CertAge < minAge
+	input.ExpiringCert = expiryWindow > 0 && input.CertRemaining < expiryWindow
+}
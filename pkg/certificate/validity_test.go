@@ -0,0 +1,82 @@
+package certificate
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/pkg/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagValidity(t *testing.T) {
+	const hour = int64(3600)
+	const now = int64(1517336042)
+
+	validity := map[string]Validity{
+		"young":    {NotValidBefore: now - 2*hour, NotValidAfter: now + 90*24*hour},
+		"old":      {NotValidBefore: now - 300*24*hour, NotValidAfter: now + 60*24*hour},
+		"expiring": {NotValidBefore: now - 300*24*hour, NotValidAfter: now + 5*hour},
+	}
+
+	sightings := func(certs ...string) map[string]*CertSighting {
+		leafCerts := make(map[string]*CertSighting)
+		for _, cert := range certs {
+			leafCerts[cert] = &CertSighting{FirstSeen: now, LastSeen: now}
+		}
+		return leafCerts
+	}
+
+	certMap := map[string]*Input{
+		"young":    {LeafCerts: sightings("young")},
+		"expiring": {LeafCerts: sightings("expiring")},
+		"both":     {LeafCerts: sightings("old", "young", "expiring")},
+		"old":      {LeafCerts: sightings("old")},
+		"unknown":  {LeafCerts: sightings("missing")},
+		// servers recorded for other reasons are kept even if their certificates check out
+		"invalid":  {Seen: 3, LeafCerts: sightings("old")},
+		"mismatch": {SNIMismatches: data.StringSet{"example.com": struct{}{}}, LeafCerts: sightings("missing")},
+		"chain":    {OddChainDepth: true, LeafCerts: sightings("old")},
+	}
+
+	FlagValidity(certMap, validity, 24*hour, 24*hour)
+
+	require.Len(t, certMap, 6)
+	assert.NotContains(t, certMap, "old")
+	assert.NotContains(t, certMap, "unknown")
+
+	assert.True(t, certMap["young"].YoungCert)
+	assert.False(t, certMap["young"].ExpiringCert)
+	assert.Equal(t, 2*hour, certMap["young"].CertAge)
+
+	assert.False(t, certMap["expiring"].YoungCert)
+	assert.True(t, certMap["expiring"].ExpiringCert)
+	assert.Equal(t, 5*hour, certMap["expiring"].CertRemaining)
+
+	// the youngest and the soonest expiring certificates decide the flags
+	assert.True(t, certMap["both"].YoungCert)
+	assert.True(t, certMap["both"].ExpiringCert)
+	assert.Equal(t, 2*hour, certMap["both"].CertAge)
+	assert.Equal(t, 5*hour, certMap["both"].CertRemaining)
+
+	assert.True(t, certMap["invalid"].ValidityKnown)
+	assert.False(t, certMap["invalid"].YoungCert)
+	assert.False(t, certMap["invalid"].ExpiringCert)
+	assert.False(t, certMap["mismatch"].ValidityKnown)
+	assert.True(t, certMap["chain"].ValidityKnown)
+}
+
+func TestFlagValidityDisabledThreshold(t *testing.T) {
+	certMap := map[string]*Input{
+		"server": {LeafCerts: map[string]*CertSighting{"cert": {FirstSeen: 100, LastSeen: 200}}},
+	}
+	validity := map[string]Validity{"cert": {NotValidBefore: 90, NotValidAfter: 210}}
+
+	// only the expiry window is enabled, so the young certificate isn't flagged
+	FlagValidity(certMap, validity, 0, 60)
+
+	require.Contains(t, certMap, "server")
+	assert.False(t, certMap["server"].YoungCert)
+	assert.True(t, certMap["server"].ExpiringCert)
+	assert.Equal(t, int64(10), certMap["server"].CertAge)
+	assert.Equal(t, int64(10), certMap["server"].CertRemaining)
+}
@@ -13,11 +13,13 @@ import (
 //UniqueIP binds an IP to an optional Network UUID and Network Name.
 //The UUID and Name serve to diffferentiate local IP addresses
 //appearing on distinct physical networks. The Network Name should
-//not be considered when determining equality.
+//not be considered when determining equality. ASN is only set when
+//the IP has been looked up in an ASN database.
 type UniqueIP struct {
 	IP          string      `bson:"ip"`
 	NetworkUUID bson.Binary `bson:"network_uuid"`
 	NetworkName string      `bson:"network_name"`
+	ASN         int64       `bson:"asn,omitempty"`
 }
 
 //NewUniqueIP returns a new UniqueIP. If the given ip is publicly routable, the resulting UniqueIP's
@@ -0,0 +1,220 @@
+package dedupedbeacon
+
+import (
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/database"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//insertBatchSize is the number of FQDN beacons added by each insert
+const insertBatchSize = 1000
+
+type repo struct {
+	database *database.DB
+	config   *config.Config
+	log      *log.Logger
+}
+
+//NewMongoRepository create new repository
+func NewMongoRepository(db *database.DB, conf *config.Config, logger *log.Logger) Repository {
+	return &repo{
+		database: db,
+		config:   conf,
+		log:      logger,
+	}
+}
+
+//CreateIndexes creates indexes for the deduped_beacons collection
+func (r *repo) CreateIndexes() error {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	// set collection name
+	collectionName := r.config.T.DedupedBeacon.DedupedBeaconTable
+
+	// check if collection already exists
+	names, _ := session.DB(r.database.GetSelectedDB()).CollectionNames()
+
+	// if collection exists, we don't need to do anything else
+	for _, name := range names {
+		if name == collectionName {
+			return nil
+		}
+	}
+
+	// set desired indexes
+	indexes := []mgo.Index{
+		{Key: []string{"-score"}},
+		{Key: []string{"src", "fqdn", "src_network_uuid"}, Unique: true},
+		{Key: []string{"fqdn"}},
+		{Key: []string{"sources"}},
+	}
+
+	// create collection
+	err := r.database.CreateCollection(collectionName, indexes)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//Dedup rebuilds the deduped_beacons collection from the SNI and FQDN beacons. The SNI
+//beacons are written first, each combined with the FQDN beacon sharing its key if there is
+//one. The FQDN beacons without a matching SNI beacon are then added. Readers may see the
+//SNI beacons alone while the FQDN beacons are being added.
+func (r *repo) Dedup() error {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	db := session.DB(r.database.GetSelectedDB())
+	sniTable := r.config.T.BeaconSNI.BeaconSNITable
+	fqdnTable := r.config.T.BeaconFQDN.BeaconFQDNTable
+	dedupedTable := r.config.T.DedupedBeacon.DedupedBeaconTable
+
+	// $out swaps in the SNI beacons once their aggregation succeeds, so readers never see a
+	// partially written set of them. It keeps the indexes of the collection it replaces.
+	err := db.C(sniTable).Pipe(sniPipeline(fqdnTable, dedupedTable)).AllowDiskUse().Iter().Close()
+
+	var fqdnOnly int
+	if err == nil {
+		fqdnOnly, err = insertFQDNOnly(
+			db.C(fqdnTable).Pipe(fqdnOnlyPipeline(sniTable)).AllowDiskUse().Iter(),
+			db.C(dedupedTable),
+		)
+	}
+
+	if err != nil {
+		r.log.WithFields(log.Fields{
+			"Module": "dedupedBeacon",
+			"Error":  err.Error(),
+		}).Error("could not deduplicate SNI and FQDN beacons")
+		return err
+	}
+
+	r.log.WithFields(log.Fields{
+		"Module":   "dedupedBeacon",
+		"FQDNOnly": fqdnOnly,
+	}).Info("deduplicated SNI and FQDN beacons")
+	return nil
+}
+
+//matchingBeacons joins each beacon with the beacons in otherTable sharing its source IP,
+//source network, and FQDN. The matches are stored in the field named as.
+func matchingBeacons(otherTable string, as string) []bson.M {
+	return []bson.M{
+		// the fqdn index on both beacon collections keeps the join cheap,
+		// the rest of the key is checked below
+		{"$lookup": bson.M{
+			"from":         otherTable,
+			"localField":   "fqdn",
+			"foreignField": "fqdn",
+			"as":           as,
+		}},
+		{"$addFields": bson.M{
+			as: bson.M{"$filter": bson.M{
+				"input": "$" + as,
+				"as":    "other",
+				"cond": bson.M{"$and": []bson.M{
+					{"$eq": []interface{}{"$$other.src", "$src"}},
+					{"$eq": []interface{}{"$$other.src_network_uuid", "$src_network_uuid"}},
+				}},
+			}},
+		}},
+	}
+}
+
+//sniPipeline writes every SNI beacon to dedupedTable, combined with the FQDN beacon from
+//fqdnTable sharing its key if there is one. The higher score is kept, and ties go to the
+//SNI beacon.
+func sniPipeline(fqdnTable string, dedupedTable string) []bson.M {
+	// fields of the FQDN beacon are missing when there isn't one, which sorts below any score
+	fqdnWins := bson.M{"$gt": []interface{}{"$fqdn_beacon.score", "$score"}}
+
+	pipeline := matchingBeacons(fqdnTable, "fqdn_beacon")
+	return append(pipeline,
+		// SNI beacons without an FQDN beacon are kept here
+		bson.M{"$unwind": bson.M{"path": "$fqdn_beacon", "preserveNullAndEmptyArrays": true}},
+		bson.M{"$project": bson.M{
+			"_id":              0,
+			"src":              1,
+			"src_network_uuid": 1,
+			"src_network_name": 1,
+			"fqdn":             1,
+			"score":            bson.M{"$cond": []interface{}{fqdnWins, "$fqdn_beacon.score", "$score"}},
+			"score_source":     bson.M{"$cond": []interface{}{fqdnWins, FQDNSource, SNISource}},
+			"connection_count": bson.M{"$cond": []interface{}{fqdnWins, "$fqdn_beacon.connection_count", "$connection_count"}},
+			"sources": bson.M{"$cond": []interface{}{
+				bson.M{"$eq": []interface{}{bson.M{"$type": "$fqdn_beacon"}, "missing"}},
+				bson.M{"$literal": []string{SNISource}},
+				bson.M{"$literal": []string{SNISource, FQDNSource}},
+			}},
+			"sni_score":             "$score",
+			"sni_connection_count":  "$connection_count",
+			"fqdn_score":            "$fqdn_beacon.score",
+			"fqdn_connection_count": "$fqdn_beacon.connection_count",
+			"responding_ips":        1,
+			"resolved_ips":          "$fqdn_beacon.resolved_ips",
+		}},
+		bson.M{"$out": dedupedTable},
+	)
+}
+
+//fqdnOnlyPipeline returns the FQDN beacons from the collection it runs on which don't share
+//their key with an SNI beacon in sniTable, in the shape of the deduped beacons
+func fqdnOnlyPipeline(sniTable string) []bson.M {
+	pipeline := matchingBeacons(sniTable, "sni_beacon")
+	return append(pipeline,
+		// pairs found by both analyses were written along with the SNI beacons
+		bson.M{"$match": bson.M{"sni_beacon": bson.M{"$size": 0}}},
+		bson.M{"$project": bson.M{
+			"_id":                   0,
+			"src":                   1,
+			"src_network_uuid":      1,
+			"src_network_name":      1,
+			"fqdn":                  1,
+			"score":                 1,
+			"score_source":          bson.M{"$literal": FQDNSource},
+			"connection_count":      1,
+			"sources":               bson.M{"$literal": []string{FQDNSource}},
+			"fqdn_score":            "$score",
+			"fqdn_connection_count": "$connection_count",
+			"resolved_ips":          1,
+		}},
+	)
+}
+
+//insertFQDNOnly adds the FQDN beacons which weren't written along with an SNI beacon to
+//coll. $merge would need MongoDB 4.2, so the beacons are inserted in batches instead.
+func insertFQDNOnly(iter *mgo.Iter, coll *mgo.Collection) (int, error) {
+	var inserted int
+	var batch []interface{}
+	var beacon bson.M
+	for iter.Next(&beacon) {
+		batch = append(batch, beacon)
+		beacon = nil
+		if len(batch) == insertBatchSize {
+			if err := coll.Insert(batch...); err != nil {
+				iter.Close()
+				return inserted, err
+			}
+			inserted += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return inserted, err
+	}
+
+	if len(batch) > 0 {
+		if err := coll.Insert(batch...); err != nil {
+			return inserted, err
+		}
+		inserted += len(batch)
+	}
+	return inserted, nil
+}
@@ -0,0 +1,120 @@
+// +build integration
+
+package dedupedbeacon
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/activecm/rita/resources"
+	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo/bson"
+	"github.com/globalsign/mgo/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Server holds the dbtest DBServer
+var Server dbtest.DBServer
+
+// Set the test database
+var testTargetDB = "tmp_test_db"
+
+var testRes *resources.Resources
+
+var testRepo Repository
+
+var testSNIBeacons = []bson.M{
+	{"src": "10.0.0.1", "src_network_uuid": util.UnknownPrivateNetworkUUID, "fqdn": "both.example.com", "score": 0.9, "connection_count": 100,
+		"responding_ips": []bson.M{{"ip": "1.1.1.1", "network_uuid": util.PublicNetworkUUID, "network_name": util.PublicNetworkName}}},
+	{"src": "10.0.0.2", "src_network_uuid": util.UnknownPrivateNetworkUUID, "fqdn": "both.example.com", "score": 0.4, "connection_count": 40},
+	{"src": "10.0.0.3", "src_network_uuid": util.UnknownPrivateNetworkUUID, "fqdn": "sni.example.com", "score": 0.8, "connection_count": 80},
+}
+
+var testFQDNBeacons = []bson.M{
+	{"src": "10.0.0.1", "src_network_uuid": util.UnknownPrivateNetworkUUID, "fqdn": "both.example.com", "score": 0.7, "connection_count": 50,
+		"resolved_ips": []bson.M{{"ip": "1.1.1.1", "network_uuid": util.PublicNetworkUUID, "network_name": util.PublicNetworkName}}},
+	{"src": "10.0.0.2", "src_network_uuid": util.UnknownPrivateNetworkUUID, "fqdn": "both.example.com", "score": 0.6, "connection_count": 60},
+	// same host and fqdn, but a different network
+	{"src": "10.0.0.3", "src_network_uuid": util.PublicNetworkUUID, "fqdn": "sni.example.com", "score": 0.5, "connection_count": 30},
+	{"src": "10.0.0.4", "src_network_uuid": util.UnknownPrivateNetworkUUID, "fqdn": "fqdn.example.com", "score": 0.3, "connection_count": 20},
+}
+
+func TestDedup(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	for _, beacon := range testSNIBeacons {
+		assert.Nil(t, ssn.DB(testTargetDB).C(testRes.Config.T.BeaconSNI.BeaconSNITable).Insert(beacon))
+	}
+	for _, beacon := range testFQDNBeacons {
+		assert.Nil(t, ssn.DB(testTargetDB).C(testRes.Config.T.BeaconFQDN.BeaconFQDNTable).Insert(beacon))
+	}
+
+	assert.Nil(t, testRepo.CreateIndexes())
+	assert.Nil(t, testRepo.Dedup())
+
+	var results []Result
+	err := ssn.DB(testTargetDB).C(testRes.Config.T.DedupedBeacon.DedupedBeaconTable).
+		Find(nil).Sort("src", "src_network_uuid").All(&results)
+	assert.Nil(t, err)
+	require.Equal(t, 5, len(results), "each source and fqdn should be listed once")
+
+	// found by both analyses, the SNI beacon scored higher
+	assert.Equal(t, "10.0.0.1", results[0].SrcIP)
+	assert.Equal(t, 0.9, results[0].Score)
+	assert.Equal(t, SNISource, results[0].ScoreSource)
+	assert.Equal(t, []string{SNISource, FQDNSource}, results[0].Sources)
+	assert.Equal(t, int64(100), results[0].Connections)
+	assert.Equal(t, 0.7, results[0].FQDNScore)
+	assert.Equal(t, int64(50), results[0].FQDNConnections)
+	assert.Len(t, results[0].RespondingIPs, 1)
+	assert.Len(t, results[0].ResolvedIPs, 1)
+
+	// found by both analyses, the FQDN beacon scored higher
+	assert.Equal(t, "10.0.0.2", results[1].SrcIP)
+	assert.Equal(t, 0.6, results[1].Score)
+	assert.Equal(t, FQDNSource, results[1].ScoreSource)
+	assert.Equal(t, int64(60), results[1].Connections)
+	assert.Equal(t, 0.4, results[1].SNIScore)
+
+	// only found by one analysis each
+	for _, res := range results[2:4] {
+		assert.Equal(t, "10.0.0.3", res.SrcIP)
+		assert.Len(t, res.Sources, 1)
+		assert.Equal(t, res.ScoreSource, res.Sources[0])
+	}
+	assert.Equal(t, "10.0.0.4", results[4].SrcIP)
+	assert.Equal(t, []string{FQDNSource}, results[4].Sources)
+	assert.Equal(t, 0.3, results[4].FQDNScore)
+	assert.Equal(t, 0.0, results[4].SNIScore)
+
+	// deduplicating again replaces the previous results
+	assert.Nil(t, testRepo.Dedup())
+	count, err := ssn.DB(testTargetDB).C(testRes.Config.T.DedupedBeacon.DedupedBeaconTable).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 5, count)
+}
+
+// TestMain wraps all tests with the needed initialized mock DB and fixtures
+func TestMain(m *testing.M) {
+	// Store temporary databases files in a temporary directory
+	tempDir, _ := ioutil.TempDir("", "testing")
+	Server.SetPath(tempDir)
+
+	// Set the main session variable to the temporary MongoDB instance
+	testRes = resources.InitTestResources()
+	testRes.DB.SelectDB(testTargetDB)
+
+	testRepo = NewMongoRepository(testRes.DB, testRes.Config, testRes.Log)
+
+	// Run the test suite
+	retCode := m.Run()
+
+	// Shut down the temporary server and removes data on disk.
+	Server.Stop()
+
+	// call with result of m.Run()
+	os.Exit(retCode)
+}
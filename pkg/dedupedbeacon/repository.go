@@ -0,0 +1,33 @@
+package dedupedbeacon
+
+import "github.com/activecm/rita/pkg/data"
+
+// Repository for deduped_beacons collection
+type Repository interface {
+	CreateIndexes() error
+	Dedup() error
+}
+
+//Result represents a source IP beaconing to an FQDN as found by SNI beacon analysis, FQDN
+//beacon analysis, or both. Score holds the higher scoring finding, and the score and
+//connection count of each analysis which found the pair are kept side by side.
+type Result struct {
+	data.UniqueSrcFQDNPair `bson:",inline"`
+	Score                  float64         `bson:"score"`
+	ScoreSource            string          `bson:"score_source"`
+	Sources                []string        `bson:"sources"`
+	Connections            int64           `bson:"connection_count"`
+	SNIScore               float64         `bson:"sni_score"`
+	FQDNScore              float64         `bson:"fqdn_score"`
+	SNIConnections         int64           `bson:"sni_connection_count"`
+	FQDNConnections        int64           `bson:"fqdn_connection_count"`
+	RespondingIPs          []data.UniqueIP `bson:"responding_ips"`
+	ResolvedIPs            []data.UniqueIP `bson:"resolved_ips"`
+}
+
+const (
+	//SNISource marks a finding made by SNI beacon analysis
+	SNISource = "sni"
+	//FQDNSource marks a finding made by FQDN beacon analysis
+	FQDNSource = "fqdn"
+)
@@ -53,8 +53,8 @@ func (a *analyzer) close() {
 func (a *analyzer) start() {
 	a.analysisWg.Add(1)
 	go func() {
-		ssn := a.db.Session.Copy()
-		defer ssn.Close()
+		ssn := a.db.CopySession()
+		defer a.db.CloseSession(ssn)
 		for data := range a.analysisChannel {
 
 			// check if this query string has already been parsed to add to the subdomain count by checking
@@ -8,8 +8,8 @@ import (
 //Results returns hostnames and their subdomain/ lookup statistics from the database.
 //limit and noLimit control how many results are returned.
 func Results(res *resources.Resources, limit int, noLimit bool) ([]Result, error) {
-	ssn := res.DB.Session.Copy()
-	defer ssn.Close()
+	ssn := res.DB.CopySession()
+	defer res.DB.CloseSession(ssn)
 
 	var explodedDNSResults []Result
 
@@ -31,8 +31,8 @@ func NewMongoRepository(db *database.DB, conf *config.Config, logger *log.Logger
 
 //CreateIndexes creates indexes for the host collection
 func (r *repo) CreateIndexes() error {
-	session := r.database.Session.Copy()
-	defer session.Close()
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
 
 	coll := session.DB(r.database.GetSelectedDB()).C(r.config.T.Structure.HostTable)
 
@@ -54,8 +54,8 @@ func (s *summarizer) close() {
 func (s *summarizer) start() {
 	s.summarizeWg.Add(1)
 	go func() {
-		ssn := s.db.Session.Copy()
-		defer ssn.Close()
+		ssn := s.db.CopySession()
+		defer s.db.CloseSession(ssn)
 
 		for datum := range s.summarizeChannel {
 			hostCollection := ssn.DB(s.db.GetSelectedDB()).C(s.conf.T.Structure.HostTable)
@@ -55,8 +55,8 @@ func (a *analyzer) close() {
 func (a *analyzer) start() {
 	a.analysisWg.Add(1)
 	go func() {
-		ssn := a.db.Session.Copy()
-		defer ssn.Close()
+		ssn := a.db.CopySession()
+		defer a.db.CloseSession(ssn)
 
 		for datum := range a.analysisChannel {
 
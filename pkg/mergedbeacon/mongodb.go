@@ -0,0 +1,129 @@
+package mergedbeacon
+
+import (
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/database"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type repo struct {
+	database *database.DB
+	config   *config.Config
+	log      *log.Logger
+}
+
+//NewMongoRepository create new repository
+func NewMongoRepository(db *database.DB, conf *config.Config, logger *log.Logger) Repository {
+	return &repo{
+		database: db,
+		config:   conf,
+		log:      logger,
+	}
+}
+
+//CreateIndexes creates indexes for the merged_beacons collection
+func (r *repo) CreateIndexes() error {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	// set collection name
+	collectionName := r.config.T.MergedBeacon.MergedBeaconTable
+
+	// check if collection already exists
+	names, _ := session.DB(r.database.GetSelectedDB()).CollectionNames()
+
+	// if collection exists, we don't need to do anything else
+	for _, name := range names {
+		if name == collectionName {
+			return nil
+		}
+	}
+
+	// set desired indexes
+	indexes := []mgo.Index{
+		{Key: []string{"-score"}},
+		{Key: []string{"src", "fqdn", "src_network_uuid"}, Unique: true},
+		{Key: []string{"fqdn"}},
+	}
+
+	// create collection
+	err := r.database.CreateCollection(collectionName, indexes)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//Merge rebuilds the merged_beacons collection from the SNI and proxy beacons which
+//share a source IP and FQDN
+func (r *repo) Merge() error {
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
+
+	// $out swaps in the new results once the whole aggregation succeeds,
+	// so readers never see a partially merged collection
+	err := session.DB(r.database.GetSelectedDB()).C(r.config.T.BeaconSNI.BeaconSNITable).
+		Pipe(mergePipeline(r.config.T.BeaconProxy.BeaconProxyTable, r.config.T.MergedBeacon.MergedBeaconTable)).
+		AllowDiskUse().Iter().Close()
+
+	if err != nil {
+		r.log.WithFields(log.Fields{
+			"Module": "mergedBeacon",
+			"Error":  err.Error(),
+		}).Error("could not merge SNI and proxy beacons")
+	}
+	return err
+}
+
+//mergePipeline joins each SNI beacon with the proxy beacon sharing its source IP, source
+//network, and FQDN, then writes the pairs found in both collections to mergedTable
+func mergePipeline(proxyTable string, mergedTable string) []bson.M {
+	return []bson.M{
+		// the fqdn index on the proxy beacons keeps the join cheap,
+		// the rest of the key is checked below
+		{"$lookup": bson.M{
+			"from":         proxyTable,
+			"localField":   "fqdn",
+			"foreignField": "fqdn",
+			"as":           "proxy_beacon",
+		}},
+		{"$project": bson.M{
+			"_id":              0,
+			"src":              1,
+			"src_network_uuid": 1,
+			"src_network_name": 1,
+			"fqdn":             1,
+			"score":            1,
+			"connection_count": 1,
+			"proxy_beacon": bson.M{"$filter": bson.M{
+				"input": "$proxy_beacon",
+				"as":    "proxy_beacon",
+				"cond": bson.M{"$and": []bson.M{
+					{"$eq": []interface{}{"$$proxy_beacon.src", "$src"}},
+					{"$eq": []interface{}{"$$proxy_beacon.src_network_uuid", "$src_network_uuid"}},
+				}},
+			}},
+		}},
+		// pairs which only beaconed one way are dropped here
+		{"$unwind": "$proxy_beacon"},
+		{"$project": bson.M{
+			"src":                    1,
+			"src_network_uuid":       1,
+			"src_network_name":       1,
+			"fqdn":                   1,
+			"score":                  bson.M{"$max": []interface{}{"$score", "$proxy_beacon.score"}},
+			"score_source":           bson.M{"$cond": []interface{}{bson.M{"$gte": []interface{}{"$score", "$proxy_beacon.score"}}, SNISource, ProxySource}},
+			"sni_score":              "$score",
+			"proxy_score":            "$proxy_beacon.score",
+			"sni_connection_count":   "$connection_count",
+			"proxy_connection_count": "$proxy_beacon.connection_count",
+			"proxy":                  "$proxy_beacon.proxy",
+		}},
+		{"$out": mergedTable},
+	}
+}
@@ -0,0 +1,103 @@
+// +build integration
+
+package mergedbeacon
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/activecm/rita/resources"
+	"github.com/activecm/rita/util"
+	"github.com/globalsign/mgo/bson"
+	"github.com/globalsign/mgo/dbtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// Server holds the dbtest DBServer
+var Server dbtest.DBServer
+
+// Set the test database
+var testTargetDB = "tmp_test_db"
+
+var testRes *resources.Resources
+
+var testRepo Repository
+
+var testSNIBeacons = []bson.M{
+	{"src": "10.0.0.1", "src_network_uuid": util.UnknownPrivateNetworkUUID, "fqdn": "both.example.com", "score": 0.9, "connection_count": 100},
+	{"src": "10.0.0.2", "src_network_uuid": util.UnknownPrivateNetworkUUID, "fqdn": "both.example.com", "score": 0.4, "connection_count": 40},
+	{"src": "10.0.0.3", "src_network_uuid": util.UnknownPrivateNetworkUUID, "fqdn": "sni.example.com", "score": 0.8, "connection_count": 80},
+}
+
+var testProxyBeacons = []bson.M{
+	{"src": "10.0.0.1", "src_network_uuid": util.UnknownPrivateNetworkUUID, "fqdn": "both.example.com", "score": 0.7, "connection_count": 50,
+		"proxy": bson.M{"ip": "10.0.0.254", "network_uuid": util.UnknownPrivateNetworkUUID, "network_name": util.UnknownPrivateNetworkName}},
+	{"src": "10.0.0.2", "src_network_uuid": util.UnknownPrivateNetworkUUID, "fqdn": "both.example.com", "score": 0.6, "connection_count": 60,
+		"proxy": bson.M{"ip": "10.0.0.254", "network_uuid": util.UnknownPrivateNetworkUUID, "network_name": util.UnknownPrivateNetworkName}},
+	// same host and fqdn, but a different network
+	{"src": "10.0.0.3", "src_network_uuid": util.PublicNetworkUUID, "fqdn": "sni.example.com", "score": 0.8, "connection_count": 80,
+		"proxy": bson.M{"ip": "10.0.0.254", "network_uuid": util.PublicNetworkUUID, "network_name": util.PublicNetworkName}},
+}
+
+func TestMerge(t *testing.T) {
+	ssn := testRes.DB.Session.Copy()
+	defer ssn.Close()
+
+	for _, beacon := range testSNIBeacons {
+		assert.Nil(t, ssn.DB(testTargetDB).C(testRes.Config.T.BeaconSNI.BeaconSNITable).Insert(beacon))
+	}
+	for _, beacon := range testProxyBeacons {
+		assert.Nil(t, ssn.DB(testTargetDB).C(testRes.Config.T.BeaconProxy.BeaconProxyTable).Insert(beacon))
+	}
+
+	assert.Nil(t, testRepo.CreateIndexes())
+	assert.Nil(t, testRepo.Merge())
+
+	var results []Result
+	err := ssn.DB(testTargetDB).C(testRes.Config.T.MergedBeacon.MergedBeaconTable).
+		Find(nil).Sort("src").All(&results)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results), "only pairs found by both analyses should be merged")
+
+	assert.Equal(t, "10.0.0.1", results[0].SrcIP)
+	assert.Equal(t, 0.9, results[0].Score)
+	assert.Equal(t, SNISource, results[0].ScoreSource)
+	assert.Equal(t, 0.9, results[0].SNIScore)
+	assert.Equal(t, 0.7, results[0].ProxyScore)
+	assert.Equal(t, int64(100), results[0].SNIConnections)
+	assert.Equal(t, int64(50), results[0].ProxyConnections)
+	assert.Equal(t, "10.0.0.254", results[0].Proxy.IP)
+
+	assert.Equal(t, "10.0.0.2", results[1].SrcIP)
+	assert.Equal(t, 0.6, results[1].Score)
+	assert.Equal(t, ProxySource, results[1].ScoreSource)
+
+	// merging again replaces the previous results
+	assert.Nil(t, testRepo.Merge())
+	count, err := ssn.DB(testTargetDB).C(testRes.Config.T.MergedBeacon.MergedBeaconTable).Count()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+// TestMain wraps all tests with the needed initialized mock DB and fixtures
+func TestMain(m *testing.M) {
+	// Store temporary databases files in a temporary directory
+	tempDir, _ := ioutil.TempDir("", "testing")
+	Server.SetPath(tempDir)
+
+	// Set the main session variable to the temporary MongoDB instance
+	testRes = resources.InitTestResources()
+	testRes.DB.SelectDB(testTargetDB)
+
+	testRepo = NewMongoRepository(testRes.DB, testRes.Config, testRes.Log)
+
+	// Run the test suite
+	retCode := m.Run()
+
+	// Shut down the temporary server and removes data on disk.
+	Server.Stop()
+
+	// call with result of m.Run()
+	os.Exit(retCode)
+}
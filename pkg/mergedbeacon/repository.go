@@ -0,0 +1,30 @@
+package mergedbeacon
+
+import "github.com/activecm/rita/pkg/data"
+
+// Repository for merged_beacons collection
+type Repository interface {
+	CreateIndexes() error
+	Merge() error
+}
+
+//Result represents a source IP which beaconed to the same FQDN both directly, as seen
+//through the SNI of its connections, and through a proxy. Both beacon scores are kept
+//side by side, and Score holds the higher of the two.
+type Result struct {
+	data.UniqueSrcFQDNPair `bson:",inline"`
+	Score                  float64       `bson:"score"`
+	ScoreSource            string        `bson:"score_source"`
+	SNIScore               float64       `bson:"sni_score"`
+	ProxyScore             float64       `bson:"proxy_score"`
+	SNIConnections         int64         `bson:"sni_connection_count"`
+	ProxyConnections       int64         `bson:"proxy_connection_count"`
+	Proxy                  data.UniqueIP `bson:"proxy"`
+}
+
+const (
+	//SNISource marks a merged beacon whose SNI beacon score is the highest
+	SNISource = "sni"
+	//ProxySource marks a merged beacon whose proxy beacon score is the highest
+	ProxySource = "proxy"
+)
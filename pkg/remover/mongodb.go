@@ -48,8 +48,8 @@ func (r *remover) Remove(cid int) error {
 }
 
 func (r *remover) reduceDNSSubCount(cid int) error {
-	ssn := r.database.Session.Copy()
-	defer ssn.Close()
+	ssn := r.database.CopySession()
+	defer r.database.CloseSession(ssn)
 
 	//Create the workers
 	writerWorker := newUpdater(
@@ -70,8 +70,8 @@ func (w *writer) closeUpdater() {
 func (w *writer) startCIDRemover() {
 	w.writeWg.Add(1)
 	go func() {
-		ssn := w.db.Session.Copy()
-		defer ssn.Close()
+		ssn := w.db.CopySession()
+		defer w.db.CloseSession(ssn)
 
 		for data := range w.cidRemoverChannel {
 
@@ -109,8 +109,8 @@ func (w *writer) startCIDRemover() {
 func (w *writer) startUpdater() {
 	w.writeWg.Add(1)
 	go func() {
-		ssn := w.db.Session.Copy()
-		defer ssn.Close()
+		ssn := w.db.CopySession()
+		defer w.db.CloseSession(ssn)
 
 		for data := range w.updaterChannel {
 
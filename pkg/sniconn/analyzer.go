@@ -1,6 +1,7 @@
 package sniconn
 
 import (
+	"math"
 	"sync"
 
 	"github.com/activecm/rita/config"
@@ -63,8 +64,10 @@ func (a *analyzer) start() {
 			}
 
 			netNameUpdate := mainQuery(selector, a.chunk)
-			tlsUpdate := tlsQuery(datum.TLS, datum.TLSZeekRecords, a.connLimit, a.chunk)
-			httpUpdate := httpQuery(datum.HTTP, datum.HTTPZeekRecords, a.connLimit, a.chunk)
+			storeDurations := a.conf.S.BeaconSNI.DurationScoring
+			strobeLimit := a.strobeLimit(selector.FQDN)
+			tlsUpdate := tlsQuery(datum.TLS, datum.TLSZeekRecords, strobeLimit, a.chunk, storeDurations)
+			httpUpdate := httpQuery(datum.HTTP, datum.HTTPZeekRecords, strobeLimit, a.chunk, storeDurations)
 
 			totalUpdate := database.MergeBSONMaps(netNameUpdate, tlsUpdate, httpUpdate)
 
@@ -78,6 +81,19 @@ func (a *analyzer) start() {
 	}()
 }
 
+//strobeLimit returns the number of connections in a chunk at which a pair with the given FQDN
+//is marked as a strobe while importing. A per destination threshold rule takes precedence over
+//the global limit. When burst detection or count smoothing is enabled, the beaconSNI dissector
+//decides on strobes from the connections in every chunk, so the timestamps and bytes of a busy
+//chunk are kept and no chunk is marked as a strobe.
+func (a *analyzer) strobeLimit(fqdn string) int64 {
+	if a.conf.S.BeaconSNI.BurstConcentration > 0 || a.conf.S.BeaconSNI.CountSmoothingWindow > 0 {
+		return math.MaxInt64
+	}
+	_, limit := a.conf.R.BeaconSNI.ThresholdRules.Thresholds(fqdn, 0, a.connLimit)
+	return limit
+}
+
 func mainQuery(selector data.UniqueSrcFQDNPair, chunk int) bson.M {
 	return bson.M{
 		"$set": bson.M{
@@ -87,7 +103,7 @@ func mainQuery(selector data.UniqueSrcFQDNPair, chunk int) bson.M {
 	}
 }
 
-func tlsQuery(datum *TLSInput, zeekRecords []*data.ZeekUIDRecord, strobeLimit int64, chunk int) bson.M {
+func tlsQuery(datum *TLSInput, zeekRecords []*data.ZeekUIDRecord, strobeLimit int64, chunk int, storeDurations bool) bson.M {
 	if datum == nil {
 		return bson.M{}
 	}
@@ -99,10 +115,14 @@ func tlsQuery(datum *TLSInput, zeekRecords []*data.ZeekUIDRecord, strobeLimit in
 	ts := datum.Timestamps
 
 	var bytes []int64
+	var durations []float64
 	var totalTwoWayBytes int64
 	var totalDuration float64
 	for _, zeekRecord := range zeekRecords {
 		bytes = append(bytes, zeekRecord.Conn.OrigBytes)
+		if storeDurations {
+			durations = append(durations, zeekRecord.Conn.Duration)
+		}
 		totalTwoWayBytes = totalTwoWayBytes + zeekRecord.Conn.OrigBytes + zeekRecord.Conn.RespBytes
 		totalDuration += zeekRecord.Conn.Duration
 	}
@@ -111,6 +131,28 @@ func tlsQuery(datum *TLSInput, zeekRecords []*data.ZeekUIDRecord, strobeLimit in
 	if isStrobe {
 		ts = []int64{}
 		bytes = []int64{}
+		durations = []float64{}
+	}
+
+	tlsEntry := bson.M{
+		"ts":        ts,
+		"bytes":     bytes,
+		"strobe":    isStrobe,
+		"count":     datum.ConnectionCount,
+		"tbytes":    totalTwoWayBytes,
+		"tdur":      totalDuration,
+		"dst_ips":   datum.RespondingIPs.Items(),
+		"dst_ports": datum.RespondingPorts.Items(),
+
+		"dst_cert_invalid": datum.RespondingCertInvalid,
+		"subjects":         datum.Subjects.Items(),
+		"ja3":              datum.JA3s.Items(),
+		"ja3s":             datum.JA3Ss.Items(),
+	}
+
+	// per connection durations are only kept when SNI beacons are scored on them
+	if storeDurations {
+		tlsEntry["durations"] = durations
 	}
 
 	return bson.M{
@@ -118,21 +160,7 @@ func tlsQuery(datum *TLSInput, zeekRecords []*data.ZeekUIDRecord, strobeLimit in
 			"dat": bson.M{
 				"$each": []bson.M{{
 					"cid": chunk,
-					"tls": bson.M{
-						"ts":        ts,
-						"bytes":     bytes,
-						"strobe":    isStrobe,
-						"count":     datum.ConnectionCount,
-						"tbytes":    totalTwoWayBytes,
-						"tdur":      totalDuration,
-						"dst_ips":   datum.RespondingIPs.Items(),
-						"dst_ports": datum.RespondingPorts.Items(),
-
-						"dst_cert_invalid": datum.RespondingCertInvalid,
-						"subjects":         datum.Subjects.Items(),
-						"ja3":              datum.JA3s.Items(),
-						"ja3s":             datum.JA3Ss.Items(),
-					},
+					"tls": tlsEntry,
 				}},
 			},
 		},
@@ -140,7 +168,7 @@ func tlsQuery(datum *TLSInput, zeekRecords []*data.ZeekUIDRecord, strobeLimit in
 
 }
 
-func httpQuery(datum *HTTPInput, zeekRecords []*data.ZeekUIDRecord, strobeLimit int64, chunk int) bson.M {
+func httpQuery(datum *HTTPInput, zeekRecords []*data.ZeekUIDRecord, strobeLimit int64, chunk int, storeDurations bool) bson.M {
 	if datum == nil {
 		return bson.M{}
 	}
@@ -152,10 +180,14 @@ func httpQuery(datum *HTTPInput, zeekRecords []*data.ZeekUIDRecord, strobeLimit
 	ts := datum.Timestamps
 
 	var bytes []int64
+	var durations []float64
 	var totalTwoWayBytes int64
 	var totalDuration float64
 	for _, zeekRecord := range zeekRecords {
 		bytes = append(bytes, zeekRecord.Conn.OrigBytes)
+		if storeDurations {
+			durations = append(durations, zeekRecord.Conn.Duration)
+		}
 		totalTwoWayBytes = totalTwoWayBytes + zeekRecord.Conn.OrigBytes + zeekRecord.Conn.RespBytes
 		totalDuration += zeekRecord.Conn.Duration
 	}
@@ -164,26 +196,34 @@ func httpQuery(datum *HTTPInput, zeekRecords []*data.ZeekUIDRecord, strobeLimit
 	if isStrobe {
 		ts = []int64{}
 		bytes = []int64{}
+		durations = []float64{}
+	}
+
+	httpEntry := bson.M{
+		"ts":        ts,
+		"bytes":     bytes,
+		"strobe":    isStrobe,
+		"count":     datum.ConnectionCount,
+		"tbytes":    totalTwoWayBytes,
+		"tdur":      totalDuration,
+		"dst_ips":   datum.RespondingIPs.Items(),
+		"dst_ports": datum.RespondingPorts.Items(),
+
+		"methods":     datum.Methods.Items(),
+		"user_agents": datum.UserAgents.Items(),
+	}
+
+	// per connection durations are only kept when SNI beacons are scored on them
+	if storeDurations {
+		httpEntry["durations"] = durations
 	}
 
 	return bson.M{
 		"$push": bson.M{
 			"dat": bson.M{
 				"$each": []bson.M{{
-					"cid": chunk,
-					"http": bson.M{
-						"ts":        ts,
-						"bytes":     bytes,
-						"strobe":    isStrobe,
-						"count":     datum.ConnectionCount,
-						"tbytes":    totalTwoWayBytes,
-						"tdur":      totalDuration,
-						"dst_ips":   datum.RespondingIPs.Items(),
-						"dst_ports": datum.RespondingPorts.Items(),
-
-						"methods":     datum.Methods.Items(),
-						"user_agents": datum.UserAgents.Items(),
-					},
+					"cid":  chunk,
+					"http": httpEntry,
 				}},
 			},
 		},
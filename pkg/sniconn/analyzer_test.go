@@ -0,0 +1,86 @@
+package sniconn
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/pkg/data"
+	"github.com/globalsign/mgo/bson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//analyzeTLS runs a single TLS input holding count connections through an analyzer and returns
+//the dat.tls entry it pushes
+func analyzeTLS(t *testing.T, conf *config.Config, count int64) bson.M {
+	input := &TLSInput{
+		Hosts:           data.UniqueSrcFQDNPair{UniqueSrcIP: data.UniqueSrcIP{SrcIP: "10.0.0.1"}, FQDN: "a.example.com"},
+		ConnectionCount: count,
+		Timestamps:      []int64{100, 200, 300},
+	}
+	records := []*data.ZeekUIDRecord{{}, {}, {}}
+
+	var updates []update
+	a := newAnalyzer(1, int64(conf.S.Strobe.ConnectionLimit), nil, conf,
+		func(u update) { updates = append(updates, u) }, func() {})
+	a.start()
+	a.collect(&linkedInput{TLS: input, TLSZeekRecords: records})
+	a.close()
+
+	require.Len(t, updates, 1)
+	entries := updates[0].query["$push"].(bson.M)["dat"].(bson.M)["$each"].([]bson.M)
+	require.Len(t, entries, 1)
+	return entries[0]["tls"].(bson.M)
+}
+
+func TestAnalyzerStrobeLimit(t *testing.T) {
+	conf := &config.Config{}
+	conf.S.Strobe.ConnectionLimit = 3
+
+	entry := analyzeTLS(t, conf, 2)
+	assert.Equal(t, false, entry["strobe"])
+	assert.Equal(t, []int64{100, 200, 300}, entry["ts"])
+
+	entry = analyzeTLS(t, conf, 3)
+	assert.Equal(t, true, entry["strobe"], "a chunk at the limit is a strobe")
+	assert.Empty(t, entry["ts"])
+	assert.Empty(t, entry["bytes"])
+}
+
+func TestAnalyzerThresholdRuleLimit(t *testing.T) {
+	conf := &config.Config{}
+	conf.S.Strobe.ConnectionLimit = 3
+	conf.R.BeaconSNI.ThresholdRules = config.ThresholdRules{
+		{Domain: "*.example.com", ConnectionLimit: 10},
+	}
+
+	entry := analyzeTLS(t, conf, 5)
+	assert.Equal(t, false, entry["strobe"], "a rule's limit above the global limit should apply")
+	assert.Equal(t, []int64{100, 200, 300}, entry["ts"])
+
+	conf.R.BeaconSNI.ThresholdRules = config.ThresholdRules{
+		{Domain: "a.example.com", ConnectionLimit: 2},
+	}
+	entry = analyzeTLS(t, conf, 2)
+	assert.Equal(t, true, entry["strobe"], "a rule's limit below the global limit should apply")
+}
+
+func TestAnalyzerDefersStrobeToDissector(t *testing.T) {
+	burst := &config.Config{}
+	burst.S.Strobe.ConnectionLimit = 3
+	burst.S.BeaconSNI.BurstConcentration = 0.8
+
+	smoothed := &config.Config{}
+	smoothed.S.Strobe.ConnectionLimit = 3
+	smoothed.S.BeaconSNI.CountSmoothingWindow = 3
+
+	for name, conf := range map[string]*config.Config{"burst": burst, "smoothing": smoothed} {
+		for _, count := range []int64{3, 4} {
+			entry := analyzeTLS(t, conf, count)
+			assert.Equal(t, false, entry["strobe"], "%s: a busy chunk is left to the dissector", name)
+			assert.Equal(t, []int64{100, 200, 300}, entry["ts"], name)
+			assert.Len(t, entry["bytes"], 3, name)
+			assert.Equal(t, count, entry["count"], name)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package uconn
+
+import (
+	"math"
+	"sort"
+
+	"github.com/activecm/rita/config"
+	"github.com/activecm/rita/resources"
+	"github.com/globalsign/mgo/bson"
+)
+
+type (
+	//ChunkStat summarizes the connections recorded in a single chunk of a database
+	ChunkStat struct {
+		ID          int
+		Connections int64
+		Pairs       int64 // host pairs with connections in the chunk
+		Start       int64 // first connection timestamp in the chunk (0 if only strobes were recorded)
+		End         int64 // last connection timestamp in the chunk
+	}
+
+	//ChunkCandidate holds the simulated outcome of importing the database's connections in
+	//chunks holding Hours of logs each
+	ChunkCandidate struct {
+		Hours         int
+		Connections   float64 // expected connections per chunk
+		SplitPairs    int64   // timed host pairs whose connections would fall in more than one chunk
+		SplitFraction float64 // SplitPairs over the timed host pairs
+		Feasible      bool    // false if Connections is above ChunkTuning.MaxConnectionsPerChunk
+	}
+
+	//ChunkReport holds the chunk statistics of a database and the chunk size recommended for it
+	ChunkReport struct {
+		Chunks            []ChunkStat // sorted by chunk ID
+		Pairs             int64       // host pairs in the uconn collection
+		TimedPairs        int64       // host pairs with connection timestamps (strobes have none)
+		SplitPairs        int64       // host pairs with connections in more than one chunk
+		ShortSplitPairs   int64       // split pairs whose connections all fall within DurationMean
+		ConnectionsMean   float64     // mean connections per chunk
+		ConnectionsStdDev float64
+		DurationMean      float64 // mean seconds between the first and last connection of each chunk
+		DurationStdDev    float64
+		Candidates        []ChunkCandidate
+		RecommendedHours  int // 0 if there were no timestamps to simulate the candidates with
+		RecommendedChunks int // chunks of RecommendedHours holding as much history as the database
+	}
+
+	//uconnChunks holds the per chunk details of a uconn entry needed for the chunk statistics
+	uconnChunks struct {
+		Dat []struct {
+			Count int64   `bson:"count"`
+			Ts    []int64 `bson:"ts"`
+			CID   int     `bson:"cid"`
+		} `bson:"dat"`
+	}
+
+	//chunkStatsBuilder gathers the chunk statistics one uconn entry at a time, so the
+	//uconn collection can be streamed rather than held in memory
+	chunkStatsBuilder struct {
+		cfg         config.ChunkTuningStaticCfg
+		totalChunks int // chunks the database keeps (0 if it isn't rolling)
+		chunks      map[int]*ChunkStat
+		splitSpans  []int64 // seconds between the first and last connection of each split pair
+		splits      []int64 // split pairs for each candidate
+		minTs       int64
+		maxTs       int64
+		report      ChunkReport
+	}
+)
+
+//ChunkTuningResults reports how the connections in the selected database fall into its
+//chunks, and recommends the chunk size from ChunkTuning which splits the fewest host
+//pairs across chunk boundaries. totalChunks is the number of chunks the database keeps, or 0
+//if it isn't rolling.
+func ChunkTuningResults(res *resources.Resources, totalChunks int) (ChunkReport, error) {
+	ssn := res.DB.CopySession()
+	defer res.DB.CloseSession(ssn)
+
+	builder := newChunkStatsBuilder(res.Config.S.ChunkTuning, totalChunks)
+
+	iter := ssn.DB(res.DB.GetSelectedDB()).C(res.Config.T.Structure.UniqueConnTable).
+		Find(nil).Select(bson.M{"dat.count": 1, "dat.ts": 1, "dat.cid": 1}).Iter()
+
+	var entry uconnChunks
+	for iter.Next(&entry) {
+		builder.add(entry)
+		entry = uconnChunks{}
+	}
+	if err := iter.Close(); err != nil {
+		return ChunkReport{}, err
+	}
+
+	return builder.build(), nil
+}
+
+//newChunkStatsBuilder creates a builder simulating each of the candidate chunk sizes in cfg
+func newChunkStatsBuilder(cfg config.ChunkTuningStaticCfg, totalChunks int) *chunkStatsBuilder {
+	return &chunkStatsBuilder{
+		cfg:         cfg,
+		totalChunks: totalChunks,
+		chunks:      make(map[int]*ChunkStat),
+		splits:      make([]int64, len(cfg.CandidateHours)),
+		minTs:       math.MaxInt64,
+		maxTs:       math.MinInt64,
+	}
+}
+
+//add tallies the connections of a single host pair
+func (b *chunkStatsBuilder) add(entry uconnChunks) {
+	b.report.Pairs++
+
+	first, last := int64(math.MaxInt64), int64(math.MinInt64)
+	seen := make(map[int]bool)
+	for _, datum := range entry.Dat {
+		chunk, ok := b.chunks[datum.CID]
+		if !ok {
+			chunk = &ChunkStat{ID: datum.CID}
+			b.chunks[datum.CID] = chunk
+		}
+		chunk.Connections += datum.Count
+		if !seen[datum.CID] {
+			seen[datum.CID] = true
+			chunk.Pairs++
+		}
+
+		for _, ts := range datum.Ts {
+			if chunk.Start == 0 || ts < chunk.Start {
+				chunk.Start = ts
+			}
+			if ts > chunk.End {
+				chunk.End = ts
+			}
+			if ts < first {
+				first = ts
+			}
+			if ts > last {
+				last = ts
+			}
+		}
+	}
+
+	timed := first <= last
+	if len(seen) > 1 {
+		b.report.SplitPairs++
+		if timed {
+			b.splitSpans = append(b.splitSpans, last-first)
+		}
+	}
+	if !timed {
+		return
+	}
+
+	b.report.TimedPairs++
+	if first < b.minTs {
+		b.minTs = first
+	}
+	if last > b.maxTs {
+		b.maxTs = last
+	}
+
+	// chunks are simulated from midnight UTC, so they start at the same hours each day
+	for i, hours := range b.cfg.CandidateHours {
+		length := int64(hours) * 3600
+		if first/length != last/length {
+			b.splits[i]++
+		}
+	}
+}
+
+//build computes the statistics of the chunks and candidates gathered so far and picks the
+//recommended chunk size
+func (b *chunkStatsBuilder) build() ChunkReport {
+	report := b.report
+
+	var connections, durations []float64
+	for _, chunk := range b.chunks {
+		report.Chunks = append(report.Chunks, *chunk)
+	}
+	sort.Slice(report.Chunks, func(i, j int) bool { return report.Chunks[i].ID < report.Chunks[j].ID })
+	for _, chunk := range report.Chunks {
+		connections = append(connections, float64(chunk.Connections))
+		// chunks holding only strobes have no timestamps to measure
+		if chunk.Start != 0 {
+			durations = append(durations, float64(chunk.End-chunk.Start))
+		}
+	}
+	report.ConnectionsMean, report.ConnectionsStdDev = meanStdDev(connections)
+	report.DurationMean, report.DurationStdDev = meanStdDev(durations)
+
+	for _, span := range b.splitSpans {
+		if float64(span) <= report.DurationMean {
+			report.ShortSplitPairs++
+		}
+	}
+
+	if report.TimedPairs == 0 {
+		return report
+	}
+
+	// the connection rate is measured over the timestamps seen, so expected chunk sizes
+	// don't depend on how the database was chunked
+	var total int64
+	for _, chunk := range report.Chunks {
+		total += chunk.Connections
+	}
+	seconds := math.Max(float64(b.maxTs-b.minTs), 1)
+	rate := float64(total) / seconds
+
+	for i, hours := range b.cfg.CandidateHours {
+		candidate := ChunkCandidate{
+			Hours:         hours,
+			Connections:   rate * float64(hours) * 3600,
+			SplitPairs:    b.splits[i],
+			SplitFraction: float64(b.splits[i]) / float64(report.TimedPairs),
+		}
+		candidate.Feasible = candidate.Connections <= float64(b.cfg.MaxConnectionsPerChunk)
+		report.Candidates = append(report.Candidates, candidate)
+	}
+	sort.Slice(report.Candidates, func(i, j int) bool { return report.Candidates[i].Hours < report.Candidates[j].Hours })
+
+	report.RecommendedHours = recommendChunkHours(report.Candidates, b.cfg.SplitTolerance)
+
+	// the recommended chunks keep as much history as the database does now
+	history := float64(b.maxTs - b.minTs)
+	if b.totalChunks > 0 {
+		history = math.Max(history, float64(b.totalChunks)*report.DurationMean)
+	}
+	report.RecommendedChunks = int(math.Max(math.Round(history/float64(report.RecommendedHours*3600)), 1))
+	return report
+}
+
+//recommendChunkHours picks the smallest feasible candidate splitting at most tolerance more
+//of the host pairs than the feasible candidate splitting the fewest. Smaller chunks roll old
+//data off in smaller steps, so they are preferred when larger ones don't keep many more
+//pairs whole. If no candidate is feasible, the smallest one is picked. candidates must be
+//sorted by Hours.
+func recommendChunkHours(candidates []ChunkCandidate, tolerance float64) int {
+	best := math.Inf(1)
+	for _, candidate := range candidates {
+		if candidate.Feasible && candidate.SplitFraction < best {
+			best = candidate.SplitFraction
+		}
+	}
+	for _, candidate := range candidates {
+		if candidate.Feasible && candidate.SplitFraction <= best+tolerance {
+			return candidate.Hours
+		}
+	}
+	return candidates[0].Hours
+}
+
+//meanStdDev returns the mean and population standard deviation of values (0 if empty)
+func meanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	mean := sum / float64(len(values))
+
+	var squares float64
+	for _, value := range values {
+		squares += (value - mean) * (value - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)))
+}
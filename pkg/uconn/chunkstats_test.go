@@ -0,0 +1,100 @@
+package uconn
+
+import (
+	"testing"
+
+	"github.com/activecm/rita/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkStatsBuilder(t *testing.T) {
+	const day = int64(1600041600) // midnight UTC
+	const minute = int64(60)
+	const hour = 60 * minute
+
+	entry := func(chunks ...int) uconnChunks {
+		var res uconnChunks
+		res.Dat = make([]struct {
+			Count int64   `bson:"count"`
+			Ts    []int64 `bson:"ts"`
+			CID   int     `bson:"cid"`
+		}, len(chunks))
+		for i, cid := range chunks {
+			res.Dat[i].CID = cid
+		}
+		return res
+	}
+
+	// a pair whose connections fall within an hour
+	short := entry(0)
+	short.Dat[0].Count, short.Dat[0].Ts = 2, []int64{day + 10*minute, day + 20*minute}
+
+	// a pair split across the stored chunks, though its connections were 20 minutes apart
+	straddling := entry(0, 1)
+	straddling.Dat[0].Count, straddling.Dat[0].Ts = 1, []int64{day + 50*minute}
+	straddling.Dat[1].Count, straddling.Dat[1].Ts = 1, []int64{day + 70*minute}
+
+	// a strobe, which has no timestamps
+	strobe := entry(0, 1)
+	strobe.Dat[0].Count, strobe.Dat[1].Count = 1000, 1000
+
+	// a pair active for 5 hours
+	long := entry(1)
+	long.Dat[0].Count, long.Dat[0].Ts = 2, []int64{day + 2*hour, day + 7*hour}
+
+	newBuilder := func(maxConnections int64, tolerance float64) *chunkStatsBuilder {
+		builder := newChunkStatsBuilder(config.ChunkTuningStaticCfg{
+			CandidateHours:         []int{24, 1, 6},
+			MaxConnectionsPerChunk: maxConnections,
+			SplitTolerance:         tolerance,
+		}, 2)
+		for _, pair := range []uconnChunks{short, straddling, strobe, long} {
+			builder.add(pair)
+		}
+		return builder
+	}
+
+	report := newBuilder(1000000, 0.05).build()
+
+	require.Len(t, report.Chunks, 2)
+	assert.Equal(t, ChunkStat{ID: 0, Connections: 1003, Pairs: 3, Start: day + 10*minute, End: day + 50*minute}, report.Chunks[0])
+	assert.Equal(t, ChunkStat{ID: 1, Connections: 1003, Pairs: 3, Start: day + 70*minute, End: day + 7*hour}, report.Chunks[1])
+	assert.EqualValues(t, 4, report.Pairs)
+	assert.EqualValues(t, 3, report.TimedPairs)
+	assert.EqualValues(t, 2, report.SplitPairs)
+	assert.EqualValues(t, 1, report.ShortSplitPairs, "only the straddling pair could have fit in a chunk")
+	assert.Equal(t, 1003.0, report.ConnectionsMean)
+	assert.Equal(t, 0.0, report.ConnectionsStdDev)
+	assert.Equal(t, 11700.0, report.DurationMean)
+	assert.Equal(t, 9300.0, report.DurationStdDev)
+
+	require.Len(t, report.Candidates, 3)
+	assert.Equal(t, 1, report.Candidates[0].Hours, "candidates should be sorted by size")
+	assert.EqualValues(t, 2, report.Candidates[0].SplitPairs)
+	assert.EqualValues(t, 1, report.Candidates[1].SplitPairs)
+	assert.EqualValues(t, 0, report.Candidates[2].SplitPairs)
+	assert.InDelta(t, 2006.0/float64(7*hour-10*minute)*float64(hour), report.Candidates[0].Connections, 0.001)
+
+	// the day long chunks keep every pair whole
+	assert.Equal(t, 24, report.RecommendedHours)
+	assert.Equal(t, 1, report.RecommendedChunks)
+
+	// a looser tolerance prefers smaller chunks
+	assert.Equal(t, 6, newBuilder(1000000, 0.5).build().RecommendedHours)
+
+	// day long chunks would hold too many connections
+	report = newBuilder(2000, 0.05).build()
+	assert.False(t, report.Candidates[2].Feasible)
+	assert.Equal(t, 6, report.RecommendedHours)
+
+	// no candidate fits, so the smallest is recommended
+	assert.Equal(t, 1, newBuilder(10, 0.05).build().RecommendedHours)
+}
+
+func TestChunkStatsBuilderEmpty(t *testing.T) {
+	report := newChunkStatsBuilder(config.ChunkTuningStaticCfg{CandidateHours: []int{1}}, 0).build()
+	assert.Empty(t, report.Chunks)
+	assert.Empty(t, report.Candidates)
+	assert.Equal(t, 0, report.RecommendedHours)
+}
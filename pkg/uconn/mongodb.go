@@ -34,8 +34,8 @@ func NewMongoRepository(db *database.DB, conf *config.Config, logger *log.Logger
 //CreateIndexes creates indexes for the uconn collection
 func (r *repo) CreateIndexes() error {
 
-	session := r.database.Session.Copy()
-	defer session.Close()
+	session := r.database.CopySession()
+	defer r.database.CloseSession(session)
 
 	// set collection name
 	collectionName := r.config.T.Structure.UniqueConnTable
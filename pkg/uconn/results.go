@@ -9,8 +9,8 @@ import (
 //seconds. The results will be sorted, descending by duration.
 //limit and noLimit control how many results are returned.
 func LongConnResults(res *resources.Resources, thresh int, limit int, noLimit bool) ([]LongConnResult, error) {
-	ssn := res.DB.Session.Copy()
-	defer ssn.Close()
+	ssn := res.DB.CopySession()
+	defer res.DB.CloseSession(ssn)
 
 	var longConnResults []LongConnResult
 
@@ -69,8 +69,8 @@ func LongConnResults(res *resources.Resources, thresh int, limit int, noLimit bo
 //OpenConnResults returns open connections. The results will be sorted, descending by duration.
 //limit and noLimit control how many results are returned.
 func OpenConnResults(res *resources.Resources, thresh int, limit int, noLimit bool) ([]OpenConnResult, error) {
-	ssn := res.DB.Session.Copy()
-	defer ssn.Close()
+	ssn := res.DB.CopySession()
+	defer res.DB.CloseSession(ssn)
 
 	var openConnResults []OpenConnResult
 
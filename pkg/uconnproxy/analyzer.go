@@ -79,10 +79,14 @@ func mainQuery(datum *Input, strobeLimit int64, chunk int) bson.M {
 	// it will not qualify to be downgraded to a proxy beacon until this chunk is
 	// outdated and removed. If only importing once - still just a strobe.
 	ts := datum.TsList
+	reqBytes := datum.ReqBytesList
+	respBytes := datum.RespBytesList
 
 	isStrobe := datum.ConnectionCount >= strobeLimit
 	if isStrobe {
 		ts = []int64{}
+		reqBytes = []int64{}
+		respBytes = []int64{}
 	}
 
 	return bson.M{
@@ -91,13 +95,16 @@ func mainQuery(datum *Input, strobeLimit int64, chunk int) bson.M {
 			"cid":              chunk,
 			"src_network_name": datum.Hosts.SrcNetworkName,
 			"proxy":            datum.Proxy,
+			"proxy_inferred":   datum.ProxyInferred,
 		},
 		"$push": bson.M{
 			"dat": bson.M{
 				"$each": []bson.M{{
-					"count": datum.ConnectionCount,
-					"ts":    ts,
-					"cid":   chunk,
+					"count":      datum.ConnectionCount,
+					"ts":         ts,
+					"req_bytes":  reqBytes,
+					"resp_bytes": respBytes,
+					"cid":        chunk,
 				}},
 			},
 		},
@@ -24,10 +24,23 @@ type update struct {
 // Contains a list of unique time stamps for the
 // connections out from the Src to the FQDN via the
 // proxy server and a count of the connections.
+// GroupedFQDNs is only set by the proxy beacon analysis when
+// Hosts.FQDN holds a registrable domain standing in for several FQDNs.
+// ReqBytesList and RespBytesList hold the request and response body
+// lengths of each connection, in the same order as TsList.
+// ByteRatioList is only set by the proxy beacon analysis when
+// byte ratios are enabled.
+// ProxyInferred is set when none of the connections were sent with the
+// CONNECT method, and Proxy was instead matched against BeaconProxy.KnownProxies.
 type Input struct {
 	Hosts           data.UniqueSrcFQDNPair
 	TsList          []int64
 	TsListFull      []int64
+	ReqBytesList    []int64
+	RespBytesList   []int64
+	ByteRatioList   []float64
 	Proxy           data.UniqueIP
 	ConnectionCount int64
+	GroupedFQDNs    []string
+	ProxyInferred   bool
 }
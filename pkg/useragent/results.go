@@ -10,8 +10,8 @@ import (
 //sorted in descending (sortDirection=-1) or ascending order (sortDirection=1).
 //limit and noLimit control how many results are returned.
 func Results(res *resources.Resources, sortDirection, limit int, noLimit bool) ([]Result, error) {
-	ssn := res.DB.Session.Copy()
-	defer ssn.Close()
+	ssn := res.DB.CopySession()
+	defer res.DB.CloseSession(ssn)
 
 	var useragentResults []Result
 
@@ -2,6 +2,7 @@ package reporting
 
 import (
 	"bytes"
+	"fmt"
 	"html/template"
 	"os"
 
@@ -35,6 +36,11 @@ func printBeaconsSNI(db string, showNetNames bool, res *resources.Resources, log
 		return err
 	}
 
+	// beacons scored by different versions or models can't be ranked against one another
+	if provenances := beaconsni.ResultProvenances(data); len(provenances) > 1 {
+		fmt.Printf("\t[!] The SNI beacons in %s were scored by %d different RITA versions or scoring models, so their scores may not be comparable\n", db, len(provenances))
+	}
+
 	if len(data) == 0 {
 		w = ""
 	} else {
@@ -0,0 +1,8 @@
+// +build mysql
+
+package main
+
+// registers the mysql driver used to write SNI beacon findings to SQL.
+// Its module isn't in go.mod, so add it before building with this tag:
+//   go get github.com/go-sql-driver/mysql@v1.7.1 && go build -tags mysql
+import _ "github.com/go-sql-driver/mysql"
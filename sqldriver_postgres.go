@@ -0,0 +1,8 @@
+// +build postgres
+
+package main
+
+// registers the postgres driver used to write SNI beacon findings to SQL.
+// Its module isn't in go.mod, so add it before building with this tag:
+//   go get github.com/lib/pq@v1.10.9 && go build -tags postgres
+import _ "github.com/lib/pq"
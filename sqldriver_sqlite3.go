@@ -0,0 +1,8 @@
+// +build sqlite3
+
+package main
+
+// registers the sqlite3 driver used to write SNI beacon findings to SQL.
+// Its module isn't in go.mod, so add it before building with this tag:
+//   go get github.com/mattn/go-sqlite3@v1.14.17 && CGO_ENABLED=1 go build -tags sqlite3
+import _ "github.com/mattn/go-sqlite3"
@@ -12,6 +12,8 @@ import (
 
 var privateIPBlocks []*net.IPNet
 
+var specialUseIPBlocks []*net.IPNet
+
 func init() {
 	privateIPBlocks = ParseSubnets(
 		[]string{
@@ -24,6 +26,24 @@ func init() {
 			"192.168.0.0/16", // RFC1918
 			"fc00::/7",       // IPv6 unique local addr
 		})
+
+	specialUseIPBlocks = ParseSubnets(
+		[]string{
+			//"127.0.0.0/8",    // IPv4 Loopback; handled by ip.IsLoopback
+			//"169.254.0.0/16", // RFC3927 link-local; handled by ip.IsLinkLocalUnicast()
+			//"224.0.0.0/4",    // IPv4 multicast; handled by ip.IsMulticast()
+			//"::/128",         // IPv6 unspecified; handled by ip.IsUnspecified()
+			"0.0.0.0/8",       // RFC1122 "this network"
+			"100.64.0.0/10",   // RFC6598 shared address space
+			"192.0.0.0/24",    // RFC6890 IETF protocol assignments
+			"192.0.2.0/24",    // RFC5737 TEST-NET-1
+			"198.18.0.0/15",   // RFC2544 benchmarking
+			"198.51.100.0/24", // RFC5737 TEST-NET-2
+			"203.0.113.0/24",  // RFC5737 TEST-NET-3
+			"240.0.0.0/4",     // RFC1112 reserved, including the limited broadcast address
+			"100::/64",        // RFC6666 IPv6 discard only
+			"2001:db8::/32",   // RFC3849 IPv6 documentation
+		})
 }
 
 //ParseSubnets parses the provided subnets into net.ipnet format
@@ -69,6 +89,22 @@ func IPIsPubliclyRoutable(ip net.IP) bool {
 	return true
 }
 
+//IPIsSpecialUse checks if an IP address is in a special use range which real servers never
+//answer from, such as loopback, link local, documentation, and reserved ranges (RFC 5735
+//and RFC 6890). Private ranges are not special use here, since internal servers use them.
+func IPIsSpecialUse(ip net.IP) bool {
+	// cache IPv4 conversion so it not performed every in every ip.IsXXX method
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip = ipv4
+	}
+
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+
+	return ContainsIP(specialUseIPBlocks, ip)
+}
+
 //ContainsIP checks if a collection of subnets contains an IP
 func ContainsIP(subnets []*net.IPNet, ip net.IP) bool {
 	// cache IPv4 conversion so it not performed every in every Contains call
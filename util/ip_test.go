@@ -36,6 +36,37 @@ func TestIPIsPublicRoutable(t *testing.T) {
 	}
 }
 
+func TestIPIsSpecialUse(t *testing.T) {
+
+	testCases := []ipBoolTestCase{
+		{"127.0.0.1", true, "IPv4 loopback"},
+		{"::1", true, "IPv6 loopback"},
+		{"169.254.169.254", true, "IPv4 link local"},
+		{"fe80::1", true, "IPv6 link local"},
+		{"0.0.0.0", true, "IPv4 unspecified"},
+		{"::", true, "IPv6 unspecified"},
+		{"224.0.0.251", true, "IPv4 multicast"},
+		{"ff02::1", true, "IPv6 multicast"},
+		{"100.64.1.1", true, "shared address space"},
+		{"192.0.2.10", true, "TEST-NET-1"},
+		{"198.18.5.5", true, "benchmarking"},
+		{"203.0.113.7", true, "TEST-NET-3"},
+		{"255.255.255.255", true, "limited broadcast"},
+		{"2001:db8::1", true, "IPv6 documentation"},
+		{"::ffff:127.0.0.1", true, "IPv4 mapped loopback"},
+		{"10.1.2.3", false, "RFC1918 Class A"},
+		{"192.168.1.2", false, "RFC1918 Class C"},
+		{"fc00:1234::", false, "IPv6 local address"},
+		{"8.8.8.8", false, "google dns ipv4"},
+		{"2001:4860:4860::8888", false, "google dns ipv6"},
+	}
+
+	for _, testCase := range testCases {
+		output := IPIsSpecialUse(net.ParseIP(testCase.ip))
+		assert.Equal(t, testCase.out, output, testCase.msg)
+	}
+}
+
 func TestIsIP(t *testing.T) {
 	testIP := "1.1.1.1"
 	notIP := "a.b.c.d"
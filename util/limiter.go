@@ -0,0 +1,33 @@
+package util
+
+//Limiter caps how many callers may run at once, such as the MongoDB queries of several
+//analysis modules running at the same time. A nil Limiter never blocks, so callers can use
+//one whether or not a limit is configured.
+type Limiter struct {
+	slots chan struct{}
+}
+
+//NewLimiter creates a Limiter which lets up to max callers run at once. nil is returned
+//if max is 0 or below, meaning there is no limit.
+func NewLimiter(max int) *Limiter {
+	if max <= 0 {
+		return nil
+	}
+	return &Limiter{slots: make(chan struct{}, max)}
+}
+
+//Acquire blocks until a slot is free and takes it. Every Acquire must be followed by a Release.
+func (l *Limiter) Acquire() {
+	if l == nil {
+		return
+	}
+	l.slots <- struct{}{}
+}
+
+//Release frees the slot taken by Acquire
+func (l *Limiter) Release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
@@ -0,0 +1,46 @@
+package util
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	limiter := NewLimiter(2)
+
+	var running, maxRunning int64
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Acquire()
+			defer limiter.Release()
+
+			now := atomic.AddInt64(&running, 1)
+			for {
+				seen := atomic.LoadInt64(&maxRunning)
+				if now <= seen || atomic.CompareAndSwapInt64(&maxRunning, seen, now) {
+					break
+				}
+			}
+			atomic.AddInt64(&running, -1)
+		}()
+	}
+	wg.Wait()
+
+	assert.True(t, maxRunning <= 2, "no more than 2 callers should run at once")
+}
+
+func TestNilLimiter(t *testing.T) {
+	limiter := NewLimiter(0)
+	assert.Nil(t, limiter, "a limit of 0 should mean no limit")
+
+	// a nil limiter never blocks
+	limiter.Acquire()
+	limiter.Acquire()
+	limiter.Release()
+}
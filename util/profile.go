@@ -0,0 +1,56 @@
+package util
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"syscall"
+)
+
+//AnalysisProfile records how long an analysis module took to process a single chunk.
+//Durations are given in milliseconds.
+type AnalysisProfile struct {
+	Time          int64  `json:"time"`           // unix time at which the analysis finished
+	Module        string `json:"module"`         // analysis module which ran, e.g. beaconSNI
+	Database      string `json:"database"`       // database the chunk was imported into
+	Chunk         int    `json:"chunk"`          // chunk id of the analyzed import
+	PairsExamined int64  `json:"pairs_examined"` // pairs collected by the module's dissector
+	BeaconsFound  int64  `json:"beacons_found"`  // pairs sent on for beacon scoring
+	DurationMs    int64  `json:"duration_ms"`    // wall clock time of the whole analysis
+	QueryMs       int64  `json:"query_ms"`       // time spent waiting on MongoDB, summed over every dissector thread
+}
+
+// profileMu keeps modules running in the same process from interleaving their records,
+// since flock locks are held by the open file rather than the goroutine
+var profileMu sync.Mutex
+
+//AppendProfile appends the record to the file at path as a single line of JSON, creating
+//the file if needed. The file is locked while the record is written so that several RITA
+//processes may share a profile file.
+func AppendProfile(path string, record AnalysisProfile) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	profileMu.Lock()
+	defer profileMu.Unlock()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return err
+	}
+
+	// closing the file releases the lock
+	_, err = file.Write(line)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+package util
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile.json")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(chunk int) {
+			defer wg.Done()
+			assert.Nil(t, AppendProfile(path, AnalysisProfile{Module: "beaconSNI", Chunk: chunk, DurationMs: 5}))
+		}(i)
+	}
+	wg.Wait()
+
+	file, err := os.Open(path)
+	assert.Nil(t, err)
+	defer file.Close()
+
+	chunks := make(map[int]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AnalysisProfile
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &record), "every line should hold a whole record")
+		assert.Equal(t, "beaconSNI", record.Module)
+		chunks[record.Chunk] = true
+	}
+	assert.Len(t, chunks, 10)
+}
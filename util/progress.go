@@ -0,0 +1,145 @@
+package util
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/vbauerster/mpb"
+	"github.com/vbauerster/mpb/decor"
+)
+
+//Progress displays how far along a module's analysis is. Counted progress shows a bar
+//sized to the amount of work, while indeterminate progress shows a spinner for work
+//which can't be sized cheaply.
+type Progress struct {
+	container *mpb.Progress    // holds the bar (nil for indeterminate progress)
+	bar       *mpb.Bar         // counted progress bar (nil for indeterminate progress)
+	spin      *spinner.Spinner // spinner shown for indeterminate progress (nil for counted progress)
+	done      int64            // units of work finished so far
+	grouped   bool             // the container is shared by a ProgressGroup, which waits on it
+}
+
+//ProgressGroup shows the progress of several modules running at the same time in a single
+//display, so their bars don't draw over one another
+type ProgressGroup struct {
+	container *mpb.Progress
+	mu        sync.Mutex // guards lines
+	lines     []string   // status lines held until the bars complete
+}
+
+//NewCountedProgress displays a progress bar for total units of work. Modules which
+//hold their work in memory, such as a map of unique connections, should size the
+//bar with its length.
+func NewCountedProgress(label string, total int64) *Progress {
+	container := mpb.New(mpb.WithWidth(20))
+	return &Progress{container: container, bar: addCountedBar(container, label, total)}
+}
+
+//addCountedBar adds a labeled bar counting up to total to the given container
+func addCountedBar(container *mpb.Progress, label string, total int64) *mpb.Bar {
+	return container.AddBar(total,
+		mpb.PrependDecorators(
+			decor.Name(label, decor.WC{W: 30, C: decor.DidentRight}),
+			decor.CountersNoUnit(" %d / %d ", decor.WCSyncWidth),
+		),
+		mpb.AppendDecorators(decor.Percentage()),
+	)
+}
+
+//NewProgressGroup creates a display shared by the bars of several modules
+func NewProgressGroup() *ProgressGroup {
+	return &ProgressGroup{container: mpb.New(mpb.WithWidth(20))}
+}
+
+//NewCountedProgress adds a progress bar for total units of work to the group. A nil group
+//creates a standalone bar, as the package level NewCountedProgress does.
+func (g *ProgressGroup) NewCountedProgress(label string, total int64) *Progress {
+	if g == nil {
+		return NewCountedProgress(label, total)
+	}
+	return &Progress{container: g.container, bar: addCountedBar(g.container, label, total), grouped: true}
+}
+
+//Println shows a status line for a module in the group. The line is held until every bar
+//in the group completes, since printing it while the bars are drawn would garble them. A
+//nil group prints the line straight away.
+func (g *ProgressGroup) Println(line string) {
+	if g == nil {
+		fmt.Println(line)
+		return
+	}
+	g.mu.Lock()
+	g.lines = append(g.lines, line)
+	g.mu.Unlock()
+}
+
+//Wait waits for every bar in the group to complete, then prints the status lines held
+//by Println in the order they were given
+func (g *ProgressGroup) Wait() {
+	g.container.Wait()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, line := range g.lines {
+		fmt.Println(line)
+	}
+	g.lines = nil
+}
+
+//NewIndeterminateProgress displays a spinner for an unknown amount of work
+func NewIndeterminateProgress(label string) *Progress {
+	spin := spinner.New(spinner.CharSets[36], 200*time.Millisecond)
+	spin.Prefix = label + " ...\t"
+	spin.Start()
+	return &Progress{spin: spin}
+}
+
+//NewQueriedProgress displays a progress bar sized by count, which is expected to be a
+//pre-run count query such as beaconsni.CountEligible. Modules which stream their work
+//from MongoDB should use it to size their bars. If skipCount is set, typically from
+//Config.S.Log.SkipProgressCount, or the count fails, a spinner is shown instead.
+func NewQueriedProgress(label string, skipCount bool, count func() (int64, error)) *Progress {
+	total, ok := progressTotal(skipCount, count)
+	if !ok {
+		return NewIndeterminateProgress(label)
+	}
+	return NewCountedProgress(label, total)
+}
+
+//progressTotal runs the count query unless it is skipped. The returned bool is false
+//if progress should be indeterminate.
+func progressTotal(skipCount bool, count func() (int64, error)) (int64, bool) {
+	if skipCount || count == nil {
+		return 0, false
+	}
+	total, err := count()
+	if err != nil || total < 0 {
+		return 0, false
+	}
+	return total, true
+}
+
+//Increment records a finished unit of work. It is safe to call from several goroutines.
+func (p *Progress) Increment() {
+	atomic.AddInt64(&p.done, 1)
+	if p.bar != nil {
+		p.bar.IncrBy(1)
+	}
+}
+
+//Wait completes the progress display. Counted bars are completed with the amount of
+//work actually done, since a count query may only be an estimate. Bars in a ProgressGroup
+//are completed without waiting on the rest of the group.
+func (p *Progress) Wait() {
+	if p.spin != nil {
+		p.spin.Stop()
+		fmt.Println()
+		return
+	}
+	p.bar.SetTotal(atomic.LoadInt64(&p.done), true)
+	if !p.grouped {
+		p.container.Wait()
+	}
+}
@@ -0,0 +1,46 @@
+package util
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressTotal(t *testing.T) {
+	queried := false
+	count := func() (int64, error) {
+		queried = true
+		return 42, nil
+	}
+
+	total, ok := progressTotal(false, count)
+	assert.True(t, ok)
+	assert.Equal(t, int64(42), total)
+
+	// skipping the count must not run the query
+	queried = false
+	_, ok = progressTotal(true, count)
+	assert.False(t, ok)
+	assert.False(t, queried)
+
+	// failed counts fall back to indeterminate progress
+	_, ok = progressTotal(false, func() (int64, error) { return 0, errors.New("timed out") })
+	assert.False(t, ok)
+}
+
+func TestProgressGroupPrintln(t *testing.T) {
+	group := NewProgressGroup()
+
+	// lines are held while the bars may still be drawn
+	group.Println("\t[!] No Proxy Beacon data to analyze")
+	group.Println("\t[!] No TLS or HTTP Beacon data to analyze")
+	assert.Equal(t, []string{
+		"\t[!] No Proxy Beacon data to analyze",
+		"\t[!] No TLS or HTTP Beacon data to analyze",
+	}, group.lines)
+
+	// and printed once the group completes
+	group.Wait()
+	assert.Empty(t, group.lines)
+}